@@ -0,0 +1,103 @@
+package nimsforestsmarttv
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// AccessEntry describes one request served by the ImageServer
+type AccessEntry struct {
+	Time      time.Time     // When the request started
+	ClientIP  string        // Address of the client (usually the TV)
+	Method    string        // HTTP method
+	Path      string        // Requested path (e.g. "/img_3_1700000000.jpg")
+	Status    int           // HTTP status code sent
+	Bytes     int64         // Response body bytes written
+	Duration  time.Duration // Time taken to serve the request
+	UserAgent string        // Client User-Agent header
+	TV        *TV           // TV at ClientIP (nil if unknown, see WithClientResolver)
+}
+
+// ServerOption configures an ImageServer
+type ServerOption func(*ImageServer)
+
+// WithAccessLogger calls fn after every request the server handles, e.g. to
+// confirm which TV actually fetched which frame. fn must be safe for
+// concurrent use.
+func WithAccessLogger(fn func(AccessEntry)) ServerOption {
+	return func(s *ImageServer) {
+		s.accessLog = fn
+	}
+}
+
+// instrument wraps h to count bytes served per client and report every
+// request to the access logger
+func (s *ImageServer) instrument(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+
+		clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			clientIP = r.RemoteAddr
+		}
+
+		s.bandwidth.add(clientIP, rec.bytes, start)
+		if s.accessLog == nil && s.fetchObserver == nil {
+			return
+		}
+
+		tv := s.resolveClient(clientIP)
+		if s.fetchObserver != nil && rec.status == http.StatusOK && r.Method == http.MethodGet {
+			s.fetchObserver.ObserveFetch(tv, clientIP, rec.bytes, time.Since(start))
+		}
+		if s.accessLog == nil {
+			return
+		}
+
+		s.accessLog(AccessEntry{
+			Time:      start,
+			ClientIP:  clientIP,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Status:    rec.status,
+			Bytes:     rec.bytes,
+			Duration:  time.Since(start),
+			UserAgent: r.UserAgent(),
+			TV:        tv,
+		})
+	})
+}
+
+// responseRecorder captures the status and size of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush lets streamed responses reach the client as they are written
+func (w *responseRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the connection, e.g. to
+// lift the write deadline for proxied streams
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
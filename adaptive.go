@@ -0,0 +1,128 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"time"
+)
+
+// QualityLevel is a reduced encoding used for TVs with slow downloads
+type QualityLevel struct {
+	Quality int     // JPEG quality (ignored for non-JPEG encoders)
+	Scale   float64 // Resolution factor (e.g. 0.5 for half width and height)
+}
+
+// AdaptiveQuality steps image quality down for a TV that keeps downloading
+// frames slowly, and back up once its downloads are fast again. Each TV
+// adapts on its own; other TVs keep full quality.
+type AdaptiveQuality struct {
+	// SlowFetch is the download time above which a fetch counts as slow
+	// (default 1s). Fetches under half of it count as fast.
+	SlowFetch time.Duration
+
+	// Samples is how many consecutive slow or fast fetches change the
+	// level by one step (default 3)
+	Samples int
+
+	// Levels are the step-downs from the renderer's own encoder, mildest
+	// first (default quality 70, then 60 at 75% size, then 50 at half size)
+	Levels []QualityLevel
+}
+
+// WithAdaptiveQuality enables per-TV quality adaptation for DisplayImage
+// and DisplayText. Frames shared by several TVs (DisplayTextAll, tiled
+// walls) are not adapted.
+func WithAdaptiveQuality(aq AdaptiveQuality) Option {
+	return func(r *Renderer) {
+		if aq.SlowFetch <= 0 {
+			aq.SlowFetch = time.Second
+		}
+		if aq.Samples <= 0 {
+			aq.Samples = 3
+		}
+		if len(aq.Levels) == 0 {
+			aq.Levels = []QualityLevel{{70, 1}, {60, 0.75}, {50, 0.5}}
+		}
+		r.adaptive = &aq
+	}
+}
+
+// adaptState tracks a TV's quality level; 0 is the renderer's own encoding
+type adaptState struct {
+	level int
+	slow  int // consecutive slow fetches
+	fast  int // consecutive fast fetches
+}
+
+// adaptQuality folds a fetch duration into the TV's quality level.
+// Called with r.mu held.
+func (r *Renderer) adaptQuality(tvKey string, d time.Duration) {
+	if r.adaptive == nil {
+		return
+	}
+
+	st, ok := r.quality[tvKey]
+	if !ok {
+		st = &adaptState{}
+		r.quality[tvKey] = st
+	}
+
+	switch {
+	case d > r.adaptive.SlowFetch:
+		st.slow, st.fast = st.slow+1, 0
+	case d < r.adaptive.SlowFetch/2:
+		st.slow, st.fast = 0, st.fast+1
+	default:
+		st.slow, st.fast = 0, 0
+	}
+
+	if st.slow >= r.adaptive.Samples && st.level < len(r.adaptive.Levels) {
+		st.level++
+		st.slow = 0
+	}
+	if st.fast >= r.adaptive.Samples && st.level > 0 {
+		st.level--
+		st.fast = 0
+	}
+}
+
+// QualityLevel returns the reduced encoding currently used for the TV, and
+// false when it gets full quality
+func (r *Renderer) QualityLevel(tv *TV) (QualityLevel, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st, ok := r.quality[tv.ControlURL]
+	if r.adaptive == nil || !ok || st.level == 0 {
+		return QualityLevel{}, false
+	}
+	return r.adaptive.Levels[st.level-1], true
+}
+
+// storeImageFor encodes a frame for one TV, applying its quality level,
+// and returns its URL and content type
+func (r *Renderer) storeImageFor(tv *TV, img image.Image) (string, string, error) {
+	level, reduced := r.QualityLevel(tv)
+	if !reduced {
+		return r.storeImage(img)
+	}
+
+	if level.Scale > 0 && level.Scale < 1 {
+		b := img.Bounds()
+		w := max(int(float64(b.Dx())*level.Scale), 1)
+		h := max(int(float64(b.Dy())*level.Scale), 1)
+		img = r.resizer.Resize(img, b, w, h)
+	}
+
+	enc := r.frameEncoder()
+	if _, ok := enc.(JPEGEncoder); ok && level.Quality > 0 {
+		enc = JPEGEncoder{Quality: level.Quality}
+	}
+
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, img); err != nil {
+		return "", "", fmt.Errorf("encode %s: %w", enc.ContentType(), err)
+	}
+	return r.server.StoreContent(buf.Bytes(), enc.ContentType()), enc.ContentType(), nil
+}
@@ -0,0 +1,50 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"image"
+	"testing"
+	"time"
+)
+
+// TestAdaptiveQuality tests stepping quality down on slow fetches and back up
+func TestAdaptiveQuality(t *testing.T) {
+	renderer, err := NewRenderer(WithAdaptiveQuality(AdaptiveQuality{SlowFetch: time.Second, Samples: 2}))
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	tv := &TV{Name: "Slow TV", ControlURL: "http://10.0.0.9/ctl"}
+	fetches := func(d time.Duration, n int) {
+		renderer.mu.Lock()
+		defer renderer.mu.Unlock()
+		for i := 0; i < n; i++ {
+			renderer.adaptQuality(tv.ControlURL, d)
+		}
+	}
+
+	fetches(3*time.Second, 4)
+	level, reduced := renderer.QualityLevel(tv)
+	if !reduced || level.Scale != 0.75 {
+		t.Fatalf("Expected two steps down (75%% scale), got %+v reduced=%v", level, reduced)
+	}
+
+	url, contentType, err := renderer.storeImageFor(tv, image.NewRGBA(image.Rect(0, 0, 400, 200)))
+	if err != nil {
+		t.Fatalf("storeImageFor failed: %v", err)
+	}
+	stored, _ := renderer.server.lookup(url)
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(stored.data))
+	if err != nil || contentType != "image/jpeg" {
+		t.Fatalf("Expected a JPEG, got %s: %v", contentType, err)
+	}
+	if cfg.Width != 300 || cfg.Height != 150 {
+		t.Errorf("Expected 300x150 frame, got %dx%d", cfg.Width, cfg.Height)
+	}
+
+	fetches(100*time.Millisecond, 4)
+	if level, reduced := renderer.QualityLevel(tv); reduced {
+		t.Errorf("Expected full quality after fast fetches, got %+v", level)
+	}
+}
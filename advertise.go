@@ -0,0 +1,332 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DaemonService is the mDNS service type daemons are advertised under
+const DaemonService = "_smarttv._tcp.local."
+
+const (
+	mdnsServicesName = "_services._dns-sd._udp.local." // Lists the service types of a host
+	mdnsTTL          = 120                             // Seconds, for SRV and A records
+	mdnsLongTTL      = 4500                            // Seconds, for PTR and TXT records
+	mdnsMaxTXT       = 1300                            // Bytes of TXT data, to fit one packet
+	dnsTypeANY       = 255
+)
+
+// Daemon is a smarttv daemon found by DiscoverDaemons
+type Daemon struct {
+	Name    string // Instance name, e.g. "Living room"
+	Host    string // e.g. "pi.local."
+	IP      string
+	Port    int
+	Version string
+	TVs     []string          // Names of the TVs it drives
+	TXT     map[string]string // All TXT values, e.g. "path"
+}
+
+// URL returns the base URL of the daemon
+func (d Daemon) URL() string {
+	return "http://" + net.JoinHostPort(d.IP, strconv.Itoa(d.Port))
+}
+
+// DiscoverDaemons finds daemons advertised with an Advertiser, e.g. for a
+// companion app that shouldn't ask for an IP address
+func DiscoverDaemons(ctx context.Context, timeout time.Duration) ([]Daemon, error) {
+	return discoverDaemons(ctx, nil, timeout)
+}
+
+func discoverDaemons(ctx context.Context, addr *net.UDPAddr, timeout time.Duration) ([]Daemon, error) {
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	services, err := browseMDNS(ctx, addr, DaemonService, timeout)
+	daemons := make([]Daemon, 0, len(services))
+	for _, s := range services {
+		d := Daemon{
+			Host:    s.Host,
+			IP:      s.IP,
+			Port:    s.Port,
+			Version: s.TXT["version"],
+			TXT:     s.TXT,
+		}
+		d.Name, _, _ = strings.Cut(s.Instance, ".")
+		n, _ := strconv.Atoi(s.TXT["tvs"])
+		for i := 1; i <= n; i++ {
+			if name, ok := s.TXT["tv"+strconv.Itoa(i)]; ok {
+				d.TVs = append(d.TVs, name)
+			}
+		}
+		daemons = append(daemons, d)
+	}
+	return daemons, err
+}
+
+// Advertiser announces a daemon on the local network over mDNS as
+// DaemonService, so apps can find it without asking for its address. TXT
+// records carry the daemon's version and the names of its TVs:
+//
+//	adv := smarttv.NewAdvertiser("Living room", 8096)
+//	adv.SetTVs(tvs)
+//	go adv.Run(ctx)
+type Advertiser struct {
+	instance string // e.g. "Living room._smarttv._tcp.local."
+	host     string // e.g. "pi.local."
+	port     int
+
+	mu      sync.Mutex
+	tvs     []string
+	extra   map[string]string
+	ips     []net.IP
+	changed chan struct{}
+}
+
+// NewAdvertiser creates an advertiser for a daemon listening on port.
+// Dots in name are replaced, as they would split the instance name.
+func NewAdvertiser(name string, port int) *Advertiser {
+	host, _ := os.Hostname()
+	host, _, _ = strings.Cut(host, ".")
+	if host == "" {
+		host = "smarttv"
+	}
+	return &Advertiser{
+		instance: strings.ReplaceAll(name, ".", "-") + "." + DaemonService,
+		host:     host + ".local.",
+		port:     port,
+		extra:    make(map[string]string),
+		changed:  make(chan struct{}, 1),
+	}
+}
+
+// SetTVs sets the TVs listed in the TXT records and announces the change
+func (a *Advertiser) SetTVs(tvs []*TV) {
+	names := make([]string, len(tvs))
+	for i, tv := range tvs {
+		names[i] = tv.Name
+	}
+	a.mu.Lock()
+	a.tvs = names
+	a.mu.Unlock()
+	a.notify()
+}
+
+// SetTXT sets an extra TXT value, e.g. "path" for the path of an API, and
+// announces the change
+func (a *Advertiser) SetTXT(key, value string) {
+	a.mu.Lock()
+	a.extra[strings.ToLower(key)] = value
+	a.mu.Unlock()
+	a.notify()
+}
+
+func (a *Advertiser) notify() {
+	select {
+	case a.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Run answers mDNS queries for the daemon until ctx is done, then tells the
+// network it is gone. It announces the daemon when started and whenever
+// its TXT records change.
+func (a *Advertiser) Run(ctx context.Context) error {
+	group, err := net.ResolveUDPAddr("udp4", mdnsAddr)
+	if err != nil {
+		return fmt.Errorf("resolve mDNS address: %w", err)
+	}
+	conn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return fmt.Errorf("join mDNS group: %w", err)
+	}
+	defer conn.Close()
+	a.mu.Lock()
+	a.ips = localIPv4s()
+	a.mu.Unlock()
+
+	go func() {
+		for {
+			// Announce twice, a second apart, as RFC 6762 asks
+			for i := range 2 {
+				if i > 0 {
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(time.Second):
+					}
+				}
+				conn.WriteToUDP(mdnsResponse(0, a.records(mdnsTTL, mdnsLongTTL)), group)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-a.changed:
+			}
+		}
+	}()
+
+	a.serve(ctx, conn, group)
+
+	// Goodbye: the same records with a TTL of zero
+	conn.WriteToUDP(mdnsResponse(0, a.records(0, 0)), group)
+	return ctx.Err()
+}
+
+// serve answers queries read from conn until ctx is done. Replies go to
+// group unless the query asks for a unicast reply.
+func (a *Advertiser) serve(ctx context.Context, conn *net.UDPConn, group *net.UDPAddr) {
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return
+		}
+		questions, err := parseDNSQuestions(buf[:n])
+		if err != nil {
+			continue
+		}
+		records, unicast := a.answer(questions)
+		if len(records) == 0 {
+			continue
+		}
+
+		// Queries not from port 5353 are one-shot unicast queries, which
+		// expect the query ID back
+		switch {
+		case from.Port != group.Port:
+			conn.WriteToUDP(mdnsResponse(binary.BigEndian.Uint16(buf), records), from)
+		case unicast:
+			conn.WriteToUDP(mdnsResponse(0, records), from)
+		default:
+			conn.WriteToUDP(mdnsResponse(0, records), group)
+		}
+	}
+}
+
+// answer returns the records answering questions, and whether all of them
+// asked for a unicast reply
+func (a *Advertiser) answer(questions []dnsQuestion) (records []dnsRecord, unicast bool) {
+	all := a.records(mdnsTTL, mdnsLongTTL)
+	unicast = len(questions) > 0
+	added := make([]bool, len(all))
+	add := func(match func(rr dnsRecord) bool) {
+		for i, rr := range all {
+			if match(rr) && !added[i] {
+				added[i] = true
+				records = append(records, rr)
+			}
+		}
+	}
+
+	for _, q := range questions {
+		if q.Class&0x8000 == 0 {
+			unicast = false
+		}
+		name := strings.ToLower(q.Name)
+		switch {
+		case name == mdnsServicesName && (q.Type == dnsTypePTR || q.Type == dnsTypeANY):
+			records = append(records, dnsRecord{Name: mdnsServicesName, Type: dnsTypePTR, TTL: mdnsLongTTL, Data: appendDNSName(nil, DaemonService)})
+		case name == DaemonService && (q.Type == dnsTypePTR || q.Type == dnsTypeANY):
+			// The PTR, with what a browser needs next
+			add(func(dnsRecord) bool { return true })
+		case name == strings.ToLower(a.instance):
+			add(func(rr dnsRecord) bool {
+				return strings.EqualFold(rr.Name, a.instance) && (q.Type == dnsTypeANY || q.Type == rr.Type)
+			})
+			if q.Type == dnsTypeSRV || q.Type == dnsTypeANY {
+				add(func(rr dnsRecord) bool { return rr.Type == dnsTypeA })
+			}
+		case name == strings.ToLower(a.host) && (q.Type == dnsTypeA || q.Type == dnsTypeANY):
+			add(func(rr dnsRecord) bool { return rr.Type == dnsTypeA })
+		}
+	}
+	return records, unicast
+}
+
+// records returns the daemon's PTR, SRV, TXT and A records
+func (a *Advertiser) records(ttl, longTTL uint32) []dnsRecord {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	srv := binary.BigEndian.AppendUint16([]byte{0, 0, 0, 0}, uint16(a.port)) // Priority and weight 0
+	records := []dnsRecord{
+		{Name: DaemonService, Type: dnsTypePTR, TTL: longTTL, Data: appendDNSName(nil, a.instance)},
+		{Name: a.instance, Type: dnsTypeSRV, TTL: ttl, Data: appendDNSName(srv, a.host)},
+		{Name: a.instance, Type: dnsTypeTXT, TTL: longTTL, Data: a.txt()},
+	}
+	for _, ip := range a.ips {
+		records = append(records, dnsRecord{Name: a.host, Type: dnsTypeA, TTL: ttl, Data: ip.To4()})
+	}
+	return records
+}
+
+// txt encodes the TXT record. TVs that don't fit in a packet are left out
+// of the list but still counted in "tvs". Call with mu held.
+func (a *Advertiser) txt() []byte {
+	var b []byte
+	appendString := func(s string) bool {
+		if len(s) > 255 || len(b)+1+len(s) > mdnsMaxTXT {
+			return false
+		}
+		b = append(append(b, byte(len(s))), s...)
+		return true
+	}
+
+	appendString("txtvers=1")
+	appendString("version=" + Build().Version)
+	keys := make([]string, 0, len(a.extra))
+	for key := range a.extra {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		appendString(key + "=" + a.extra[key])
+	}
+	appendString("tvs=" + strconv.Itoa(len(a.tvs)))
+	for i, name := range a.tvs {
+		appendString("tv" + strconv.Itoa(i+1) + "=" + name)
+	}
+	return b
+}
+
+// mdnsResponse encodes records as an authoritative mDNS response
+func mdnsResponse(id uint16, records []dnsRecord) []byte {
+	msg := appendDNSHeader(nil, id, 0x8400, 0, len(records))
+	for _, rr := range records {
+		msg = appendDNSRecord(msg, rr)
+	}
+	return msg
+}
+
+// localIPv4s returns the IPv4 addresses of the host's network interfaces
+func localIPv4s() []net.IP {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+			ips = append(ips, ipnet.IP.To4())
+		}
+	}
+	return ips
+}
@@ -0,0 +1,71 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdvertiser(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+
+	adv := NewAdvertiser("Living.room", 8096)
+	adv.SetTVs([]*TV{{Name: "Lobby Left"}, {Name: "Lobby Right"}})
+	adv.SetTXT("path", "/frames")
+	adv.ips = []net.IP{net.IPv4(192, 168, 1, 70)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	group := &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+	go adv.serve(ctx, conn, group)
+
+	daemons, err := discoverDaemons(ctx, conn.LocalAddr().(*net.UDPAddr), 500*time.Millisecond)
+	if err != nil || len(daemons) != 1 {
+		t.Fatalf("discoverDaemons = %+v, %v", daemons, err)
+	}
+	d := daemons[0]
+	if d.Name != "Living-room" || d.Port != 8096 || d.IP != "192.168.1.70" || d.URL() != "http://192.168.1.70:8096" {
+		t.Errorf("Unexpected daemon: %+v", d)
+	}
+	if !slices.Equal(d.TVs, []string{"Lobby Left", "Lobby Right"}) || d.TXT["path"] != "/frames" || d.Version == "" {
+		t.Errorf("Unexpected TXT: %v %v", d.TVs, d.TXT)
+	}
+
+	// Service enumeration lists the service type
+	records, unicast := adv.answer([]dnsQuestion{{Name: mdnsServicesName, Type: dnsTypePTR, Class: 1}})
+	if len(records) != 1 || records[0].Type != dnsTypePTR || unicast {
+		t.Errorf("Service enumeration = %+v, unicast %v", records, unicast)
+	}
+	if records, _ := adv.answer([]dnsQuestion{{Name: "_googlecast._tcp.local.", Type: dnsTypePTR, Class: 1}}); len(records) != 0 {
+		t.Errorf("Answered a query for another service: %+v", records)
+	}
+}
+
+func TestAdvertiserManyTVs(t *testing.T) {
+	adv := NewAdvertiser("Office", 8096)
+	tvs := make([]*TV, 100)
+	for i := range tvs {
+		tvs[i] = &TV{Name: fmt.Sprintf("Meeting room screen number %d", i+1)}
+	}
+	adv.SetTVs(tvs)
+
+	data := adv.txt()
+	if len(data) > mdnsMaxTXT {
+		t.Errorf("TXT record has %d bytes", len(data))
+	}
+	txt := parseTXT(data)
+	if txt["tvs"] != "100" || txt["tv1"] != tvs[0].Name || txt["tv100"] != "" {
+		t.Errorf("Unexpected TXT: tvs=%s tv1=%s tv100=%s", txt["tvs"], txt["tv1"], txt["tv100"])
+	}
+	if !strings.HasPrefix(string(data[1:]), "txtvers=1") {
+		t.Errorf("TXT doesn't start with txtvers: %q", data[:12])
+	}
+}
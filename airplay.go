@@ -0,0 +1,264 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	airplayDefaultPort = 7000
+	airplayService     = "_airplay._tcp.local."
+	airplayUserAgent   = "MediaControl/1.0"
+)
+
+// AirPlay feature bits from the "features" TXT record
+const (
+	airplayFeatureVideo  = 1 << 0
+	airplayFeaturePhoto  = 1 << 1
+	airplayFeatureScreen = 1 << 7 // screen mirroring
+)
+
+// airplayTimeout bounds an AirPlay command when ctx has no deadline
+const airplayTimeout = 15 * time.Second
+
+// DiscoverAirPlay finds AirPlay receivers (Apple TVs and TVs with AirPlay
+// built in) on the local network using mDNS. They are returned as TVs with
+// Protocol set to ProtocolAirPlay; AVTransport-only calls such as Pause or
+// Seek return ErrUnsupportedAction for them.
+//
+// Receivers are driven with the unencrypted HTTP photo and video commands.
+// AirPlay 2 pairing (pair-verify and the encrypted session) isn't
+// implemented, so receivers that only accept paired senders are listed but
+// refuse the commands.
+//
+// If ctx is done before the timeout, the receivers found so far are
+// returned together with ctx.Err().
+func DiscoverAirPlay(ctx context.Context, timeout time.Duration) ([]TV, error) {
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	services, err := browseMDNS(ctx, nil, airplayService, timeout)
+	tvs := make([]TV, 0, len(services))
+	for _, s := range services {
+		if airplaySpeaker(s.TXT) {
+			continue
+		}
+		tvs = append(tvs, airplayTV(s))
+	}
+	return tvs, err
+}
+
+// airplayTV builds the TV for an AirPlay receiver from its mDNS record
+func airplayTV(s mdnsService) TV {
+	name, _, _ := strings.Cut(s.Instance, ".")
+	port := s.Port
+	if port == 0 {
+		port = airplayDefaultPort
+	}
+	tv := TV{
+		Name:       name,
+		IP:         s.IP,
+		Port:       port,
+		ControlURL: "airplay://" + net.JoinHostPort(s.IP, strconv.Itoa(port)),
+		ModelName:  s.TXT["model"],
+		Protocol:   ProtocolAirPlay,
+		Actions:    []string{},
+		Addresses:  []string{s.IP},
+	}
+	if id := s.TXT["deviceid"]; id != "" {
+		tv.UDN = "airplay:" + strings.ToLower(id)
+	}
+	return tv
+}
+
+// airplaySpeaker reports whether a receiver plays audio only, like HomePods
+// and AirPort Expresses. AirPlay 2 TVs may leave the legacy photo and video
+// bits unset, so those alone don't rule a receiver out.
+func airplaySpeaker(txt map[string]string) bool {
+	model := txt["model"]
+	if strings.HasPrefix(model, "AudioAccessory") || strings.HasPrefix(model, "AirPort") {
+		return true
+	}
+	features, ok := airplayFeatures(txt["features"])
+	return ok && features&(airplayFeatureVideo|airplayFeaturePhoto|airplayFeatureScreen) == 0
+}
+
+// airplayFeatures parses the "features" TXT record, e.g. "0x5A7FFFF7,0x1E".
+// Only the lower 32 bits, which hold the photo, video and screen bits, are
+// read.
+func airplayFeatures(txt string) (uint64, bool) {
+	low, _, _ := strings.Cut(txt, ",")
+	n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(low), "0x"), 16, 32)
+	return n, err == nil
+}
+
+// airplaySession is the connection to one receiver. Receivers end a
+// slideshow or video when the sender disconnects, so it is kept open
+// between commands.
+type airplaySession struct {
+	id     string
+	client *http.Client
+}
+
+var (
+	airplaySessionsMu sync.Mutex
+	airplaySessions   = make(map[string]*airplaySession)
+)
+
+// airplaySessionFor returns the session with the receiver at controlURL
+func airplaySessionFor(controlURL string) *airplaySession {
+	airplaySessionsMu.Lock()
+	defer airplaySessionsMu.Unlock()
+	s, ok := airplaySessions[controlURL]
+	if !ok {
+		s = &airplaySession{
+			id: newUUID(),
+			client: &http.Client{Transport: &http.Transport{
+				MaxIdleConnsPerHost: 1,
+				DisableCompression:  true,
+			}},
+		}
+		airplaySessions[controlURL] = s
+	}
+	return s
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0F | 0x40
+	b[8] = b[8]&0x3F | 0x80
+	return fmt.Sprintf("%X-%X-%X-%X-%X", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// airplayDevice drives an AirPlay receiver with the HTTP photo and video
+// commands. Receivers that ask for a PIN or password, or for AirPlay 2
+// pairing, aren't supported.
+type airplayDevice struct {
+	tv *TV
+
+	policy  *URLPolicy // checks images fetched from elsewhere (nil = none)
+	trusted string     // URL of the renderer's server, exempt from policy
+	limits  Limits
+}
+
+func (d *airplayDevice) Load(ctx context.Context, media Media) (err error) {
+	ctx, span := startSpan(ctx, "smarttv.airplay LOAD", append(d.tv.traceAttributes(), Attribute{Key: "url.full", Value: d.tv.ControlURL})...)
+	defer func() { endSpan(span, err) }()
+
+	contentType := media.ContentType
+	if contentType == "" {
+		contentType = guessContentType(media.URL)
+	}
+	if strings.HasPrefix(contentType, "image/") {
+		return d.tv.wrapError("PHOTO", d.tv.ControlURL, d.photo(ctx, media.URL))
+	}
+	return d.tv.wrapError("PLAY", d.tv.ControlURL, d.play(ctx, media.URL))
+}
+
+// photo shows an image. Receivers take the image itself rather than a URL,
+// so it is fetched first.
+func (d *airplayDevice) photo(ctx context.Context, imageURL string) error {
+	client := &http.Client{Timeout: airplayTimeout}
+	if d.policy != nil && (d.trusted == "" || !strings.HasPrefix(imageURL, d.trusted+"/")) {
+		client = d.policy.client(client)
+		defer client.CloseIdleConnections()
+	}
+	data, contentType, err := fetchAirPlayImage(ctx, client, d.limits, imageURL)
+	if err != nil {
+		return err
+	}
+	header := http.Header{
+		"Content-Type":       {contentType},
+		"X-Apple-AssetKey":   {newUUID()},
+		"X-Apple-Transition": {"Dissolve"},
+	}
+	return d.do(ctx, http.MethodPut, "/photo", header, data)
+}
+
+// play starts a video from its URL
+func (d *airplayDevice) play(ctx context.Context, videoURL string) error {
+	body := fmt.Sprintf("Content-Location: %s\nStart-Position: 0.0\n", videoURL)
+	return d.do(ctx, http.MethodPost, "/play", http.Header{"Content-Type": {"text/parameters"}}, []byte(body))
+}
+
+func (d *airplayDevice) Stop(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, "smarttv.airplay STOP", append(d.tv.traceAttributes(), Attribute{Key: "url.full", Value: d.tv.ControlURL})...)
+	defer func() { endSpan(span, err) }()
+	return d.tv.wrapError("STOP", d.tv.ControlURL, d.do(ctx, http.MethodPost, "/stop", nil, nil))
+}
+
+// do sends a command in the TV's session
+func (d *airplayDevice) do(ctx context.Context, method, path string, header http.Header, body []byte) error {
+	u, err := url.Parse(d.tv.ControlURL)
+	if err != nil || u.Scheme != "airplay" {
+		return fmt.Errorf("invalid AirPlay address %q", d.tv.ControlURL)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, airplayTimeout)
+		defer cancel()
+	}
+
+	session := airplaySessionFor(d.tv.ControlURL)
+	req, err := http.NewRequestWithContext(ctx, method, "http://"+u.Host+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("User-Agent", airplayUserAgent)
+	req.Header.Set("X-Apple-Session-ID", session.id)
+
+	resp, err := session.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	switch {
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized:
+		return fmt.Errorf("HTTP %d: the receiver asks for a PIN, a password or AirPlay 2 pairing", resp.StatusCode)
+	case resp.StatusCode/100 != 2:
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// fetchAirPlayImage downloads an image to send to a receiver, usually from
+// the renderer's own server, within limits
+func fetchAirPlayImage(ctx context.Context, client *http.Client, limits Limits, imageURL string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("fetch image: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("fetch image: HTTP %d", resp.StatusCode)
+	}
+	data, err := limits.readPayload(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("fetch image: %w", err)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "image/jpeg"
+	}
+	return data, contentType, nil
+}
@@ -0,0 +1,168 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAirPlayDevice(t *testing.T) {
+	var mu sync.Mutex
+	var requests, sessions []string
+	var photo []byte
+	var playBody string
+	locked := false
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		sessions = append(sessions, r.Header.Get("X-Apple-Session-ID"))
+		if locked {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/photo":
+			photo = body
+		case "/play":
+			playBody = string(body)
+		}
+	}))
+	defer mock.Close()
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tv := &TV{Name: "Apple TV", ControlURL: "airplay://" + strings.TrimPrefix(mock.URL, "http://"), Protocol: ProtocolAirPlay, Actions: []string{}}
+
+	if err := renderer.DisplayText(ctx, tv, "Hello"); err != nil {
+		t.Fatalf("DisplayText failed: %v", err)
+	}
+	if err := renderer.StreamVideo(ctx, tv, "http://media/movie.mp4", "Movie"); err != nil {
+		t.Fatalf("StreamVideo failed: %v", err)
+	}
+	if err := renderer.Stop(ctx, tv); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+
+	mu.Lock()
+	if got := strings.Join(requests, ","); got != "PUT /photo,POST /play,POST /stop" {
+		t.Errorf("Requests = %s", got)
+	}
+	if !bytes.HasPrefix(photo, []byte{0xFF, 0xD8}) {
+		t.Errorf("Photo isn't a JPEG: % x", photo[:min(len(photo), 4)])
+	}
+	if !strings.Contains(playBody, "Content-Location: http://media/movie.mp4\n") {
+		t.Errorf("Play body = %q", playBody)
+	}
+	if sessions[0] == "" || sessions[0] != sessions[2] {
+		t.Errorf("Commands in different sessions: %q", sessions)
+	}
+	locked = true
+	mu.Unlock()
+
+	err = renderer.Stop(ctx, tv)
+	var tvErr *TVError
+	if !errors.As(err, &tvErr) || tvErr.Action != "STOP" || !strings.Contains(err.Error(), "AirPlay 2 pairing") {
+		t.Errorf("Expected a refused STOP, got %v", err)
+	}
+	if err := tv.Pause(ctx); !errors.Is(err, ErrUnsupportedAction) {
+		t.Errorf("Expected ErrUnsupportedAction for Pause, got %v", err)
+	}
+}
+
+func TestAirPlayTV(t *testing.T) {
+	tv := airplayTV(mdnsService{
+		Instance: "Living Room." + airplayService,
+		IP:       "192.168.1.60",
+		Port:     7000,
+		TXT:      map[string]string{"deviceid": "AA:BB:CC:DD:EE:FF", "model": "AppleTV6,2", "features": "0x5A7FFFF7,0x1E"},
+	})
+	if tv.Name != "Living Room" || tv.UDN != "airplay:aa:bb:cc:dd:ee:ff" || tv.ModelName != "AppleTV6,2" ||
+		tv.ControlURL != "airplay://192.168.1.60:7000" || tv.Protocol != ProtocolAirPlay {
+		t.Errorf("Unexpected TV: %+v", tv)
+	}
+
+	tests := []struct {
+		txt      string
+		features uint64
+		ok       bool
+	}{
+		{"0x5A7FFFF7,0x1E", 0x5A7FFFF7, true},
+		{"0x445F8A00,0x1C340", 0x445F8A00, true}, // HomePod: no photo or video
+		{"0x77", 0x77, true},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		features, ok := airplayFeatures(tt.txt)
+		if features != tt.features || ok != tt.ok {
+			t.Errorf("airplayFeatures(%q) = %#x, %v", tt.txt, features, ok)
+		}
+	}
+
+	speakers := []struct {
+		txt     map[string]string
+		speaker bool
+	}{
+		{map[string]string{"model": "AppleTV6,2", "features": "0x5A7FFFF7,0x1E"}, false},
+		{map[string]string{"model": "AudioAccessory5,1", "features": "0x445F8A00,0x1C340"}, true},
+		{map[string]string{"model": "AirPort10,115", "features": "0x5A7FFFF7"}, true},
+		{map[string]string{"model": "TV", "features": "0x4A7FDF80,0xBC354BD0"}, false}, // AirPlay 2 TV: screen bit only
+		{map[string]string{"model": "Speaker", "features": "0x445F0A00"}, true},
+		{map[string]string{"model": "TV"}, false},
+	}
+	for _, tt := range speakers {
+		if got := airplaySpeaker(tt.txt); got != tt.speaker {
+			t.Errorf("airplaySpeaker(%v) = %v", tt.txt, got)
+		}
+	}
+}
+
+// TestAirPlayPhotoFetch tests that images from elsewhere are fetched under
+// the renderer's URL policy and limits
+func TestAirPlayPhotoFetch(t *testing.T) {
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer mock.Close()
+	media := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(bytes.Repeat([]byte{0xFF}, 4096))
+	}))
+	defer media.Close()
+
+	renderer, err := NewRenderer(WithURLPolicy(URLPolicy{BlockPrivate: true}), WithLimits(Limits{MaxBytes: 1 << 20}))
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tv := &TV{Name: "Apple TV", ControlURL: "airplay://" + strings.TrimPrefix(mock.URL, "http://"), Protocol: ProtocolAirPlay, Actions: []string{}}
+	d := renderer.device(tv).(*airplayDevice)
+
+	if err := renderer.DisplayText(ctx, tv, "Hello"); err != nil {
+		t.Errorf("Image from the renderer's server: %v", err)
+	}
+	if err := d.photo(ctx, media.URL+"/photo.jpg"); !errors.Is(err, ErrURLNotAllowed) {
+		t.Errorf("Expected ErrURLNotAllowed for a private host, got %v", err)
+	}
+
+	d.policy = nil
+	d.limits = Limits{MaxBytes: 1024}
+	if err := d.photo(ctx, media.URL+"/photo.jpg"); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("Expected ErrImageTooLarge, got %v", err)
+	}
+}
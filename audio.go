@@ -0,0 +1,104 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// audioTypes maps audio file extensions to MIME types
+var audioTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".wav":  "audio/wav",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg",
+	".flac": "audio/flac",
+}
+
+// audioContentType guesses the MIME type of an audio URL from its
+// extension, defaulting to MP3
+func audioContentType(audioURL string) string {
+	p := audioURL
+	if u, err := url.Parse(audioURL); err == nil {
+		p = u.Path
+	}
+	if ct, ok := audioTypes[strings.ToLower(path.Ext(p))]; ok {
+		return ct
+	}
+	return "audio/mpeg"
+}
+
+// imageAudioMetadata returns metadata for an image carrying a second res
+// with the audio, for TVs that play both
+func (tv *TV) imageAudioMetadata(imageURL string, res imageRes, audioURL string) string {
+	audioRes := fmt.Sprintf(`<res protocolInfo="http-get:*:%s:*">%s</res>`, audioContentType(audioURL), escapeXML(audioURL))
+	return didlItem("Image", tv.imageClass(), tv.imageResElement(imageURL, res)+audioRes)
+}
+
+// albumArtMetadata returns metadata for the audio with the image as its
+// album art, which TVs show while the audio plays
+func albumArtMetadata(imageURL string, audioURL string) string {
+	body := fmt.Sprintf(`<upnp:albumArtURI>%s</upnp:albumArtURI><res protocolInfo="http-get:*:%s:*">%s</res>`,
+		imageURL, audioContentType(audioURL), escapeXML(audioURL))
+	return didlItem("Message", "object.item.audioItem.musicTrack", body)
+}
+
+// DisplayImageWithAudio shows an image while playing audio from audioURL,
+// e.g. a photo with a voice message.
+//
+// The image is sent with the audio as a second resource, which TVs that
+// understand it play together. TVs that reject that get the audio with the
+// image as its album art instead, which most TVs show full screen during
+// playback. Only DLNA TVs can; others return ErrUnsupportedAction.
+func (r *Renderer) DisplayImageWithAudio(ctx context.Context, tv *TV, img image.Image, audioURL string) error {
+	if tv.Protocol != ProtocolDLNA {
+		return tv.wrapError("DisplayImageWithAudio", "", ErrUnsupportedAction)
+	}
+	if err := r.checkMediaURL(ctx, audioURL); err != nil {
+		return err
+	}
+	imageURL, contentType, err := r.storeImageFor(tv, img)
+	if err != nil {
+		return err
+	}
+	res := r.imageRes(imageURL, contentType)
+
+	unlock, err := r.lockTV(ctx, tv)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := r.intend(ctx, tv, JournalCast, imageURL, contentType, ""); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	r.expectFetch(tv, imageURL, start)
+
+	err = tv.setAVTransportURIMetadata(ctx, imageURL, tv.imageAudioMetadata(imageURL, res, audioURL))
+	var soapErr *SOAPError
+	if errors.As(err, &soapErr) {
+		err = tv.setAVTransportURIMetadata(ctx, audioURL, albumArtMetadata(imageURL, audioURL))
+	}
+	if err != nil {
+		return fmt.Errorf("set URI: %w", err)
+	}
+
+	if err := tv.play(ctx); err != nil {
+		return fmt.Errorf("play: %w", err)
+	}
+	if err := r.verifyPlaying(ctx, tv); err != nil {
+		return err
+	}
+
+	r.shown(ctx, tv, imageURL, start)
+	return nil
+}
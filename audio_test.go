@@ -0,0 +1,70 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestDisplayImageWithAudio tests that the audio is sent as a second
+// resource, or as the audio track with album art to TVs rejecting that
+func TestDisplayImageWithAudio(t *testing.T) {
+	tests := []struct {
+		name       string
+		rejectBoth bool
+		wantURI    string // Prefix of the URI the TV plays
+		wantMeta   string
+	}{
+		{"two resources", false, "http://", `protocolInfo="http-get:*:audio/mp4:*">https://example.com/msg.m4a?a=1&amp;b=2</res>`},
+		{"album art", true, "https://example.com/msg.m4a", "<upnp:albumArtURI>http://"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var uri, metadata string
+			mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if strings.Contains(r.Header.Get("SOAPAction"), "#SetAVTransportURI") {
+					meta := soapArg(body, "CurrentURIMetaData")
+					if tt.rejectBoth && strings.Count(meta, "<res ") > 1 {
+						w.WriteHeader(http.StatusInternalServerError)
+						io.WriteString(w, soapFault(714, "Illegal MIME-type"))
+						return
+					}
+					mu.Lock()
+					uri, metadata = soapArg(body, "CurrentURI"), meta
+					mu.Unlock()
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer mockTV.Close()
+
+			renderer, err := NewRenderer()
+			if err != nil {
+				t.Fatalf("Failed to create renderer: %v", err)
+			}
+			defer renderer.Close()
+
+			tv := &TV{Name: "Grandma", ControlURL: mockTV.URL}
+			img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+			if err := renderer.DisplayImageWithAudio(context.Background(), tv, img, "https://example.com/msg.m4a?a=1&b=2"); err != nil {
+				t.Fatalf("DisplayImageWithAudio failed: %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !strings.HasPrefix(uri, tt.wantURI) {
+				t.Errorf("Expected URI starting with %s, got %s", tt.wantURI, uri)
+			}
+			if !strings.Contains(metadata, tt.wantMeta) {
+				t.Errorf("Expected %s in metadata: %s", tt.wantMeta, metadata)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timing of AudioQueue transitions
+const (
+	fadeStep   = 100 * time.Millisecond // Volume change interval while fading
+	startGrace = 2 * time.Second        // TVs may report STOPPED while loading a track
+)
+
+// Track is an audio file played by an AudioQueue
+type Track struct {
+	URL   string
+	Title string
+}
+
+// AudioQueue plays a list of audio tracks on a TV's speakers one after the
+// other, e.g. background music. Each next track is pre-staged with
+// SetNextAVTransportURI, so TVs that support it switch without a gap; on
+// others the switch is timed off GetPositionInfo. With SetCrossfade the
+// volume fades out at the end of each track and back in on the next. It is
+// safe for concurrent use.
+type AudioQueue struct {
+	renderer *Renderer
+	tv       *TV
+	interval time.Duration
+
+	mu        sync.Mutex
+	tracks    []Track
+	current   int // Index of the track playing (-1 = not started)
+	crossfade time.Duration
+	listeners []func(track Track, err error)
+}
+
+// NewAudioQueue creates a queue for the TV, polling its position every
+// interval (default 1s)
+func NewAudioQueue(renderer *Renderer, tv *TV, interval time.Duration) *AudioQueue {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &AudioQueue{renderer: renderer, tv: tv, interval: interval, current: -1}
+}
+
+// Append adds tracks to the end of the queue, also while it plays
+func (q *AudioQueue) Append(tracks ...Track) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.tracks = append(q.tracks, tracks...)
+}
+
+// SetCrossfade sets how long the transition between tracks takes: the
+// volume fades out over the first half and in over the second. TVs without
+// a RenderingControl service switch without fading. 0 (default) switches
+// gaplessly.
+func (q *AudioQueue) SetCrossfade(d time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.crossfade = d
+}
+
+// OnTrack registers fn to be called when a track starts playing, with the
+// error if it could not be started. fn runs on the queue's goroutine and
+// should not block.
+func (q *AudioQueue) OnTrack(fn func(track Track, err error)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.listeners = append(q.listeners, fn)
+}
+
+// Current returns the track playing
+func (q *AudioQueue) Current() (Track, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.current < 0 || q.current >= len(q.tracks) {
+		return Track{}, false
+	}
+	return q.tracks[q.current], true
+}
+
+// next returns the track after the current one
+func (q *AudioQueue) next() (Track, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.current+1 >= len(q.tracks) {
+		return Track{}, false
+	}
+	return q.tracks[q.current+1], true
+}
+
+// advance makes the next track the current one and tells the listeners
+func (q *AudioQueue) advance(err error) {
+	q.mu.Lock()
+	q.current++
+	track := q.tracks[q.current]
+	listeners := slices.Clone(q.listeners)
+	q.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(track, err)
+	}
+}
+
+// Run plays the queue until the last track ended or ctx is done
+func (q *AudioQueue) Run(ctx context.Context) error {
+	first, ok := q.next()
+	if !ok {
+		return nil
+	}
+	if err := q.play(ctx, first); err != nil {
+		return err
+	}
+	started, staged := time.Now(), ""
+
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		q.mu.Lock()
+		crossfade := q.crossfade
+		q.mu.Unlock()
+		next, hasNext := q.next()
+
+		// Pre-stage the next track so the TV switches on its own
+		if hasNext && crossfade == 0 && staged != next.URL && q.tv.SupportsAction("SetNextAVTransportURI") {
+			if err := q.tv.setNextAVTransportURIMetadata(ctx, next.URL, trackMetadata(next)); err == nil {
+				staged = next.URL
+			}
+		}
+
+		pos, err := q.tv.GetPositionInfo(ctx)
+		if err != nil {
+			// Rely on the transport state below
+			pos = PositionInfo{}
+		}
+		if staged != "" && pos.TrackURI == staged {
+			q.advance(nil)
+			started, staged = time.Now(), ""
+			continue
+		}
+
+		info, err := q.tv.GetTransportInfo(ctx)
+		if err == nil && (info.State == "STOPPED" || info.State == "NO_MEDIA_PRESENT") && time.Since(started) > startGrace {
+			if !hasNext {
+				return nil
+			}
+			if err := q.play(ctx, next); err != nil {
+				return err
+			}
+			started, staged = time.Now(), ""
+			continue
+		}
+
+		duration, ok1 := parseUPnPDuration(pos.TrackDuration)
+		position, ok2 := parseUPnPDuration(pos.RelTime)
+		if !hasNext || !ok1 || !ok2 || duration == 0 || staged != "" {
+			continue
+		}
+		remaining := duration - position
+
+		switch {
+		case crossfade > 0 && remaining <= crossfade/2:
+			if err := q.crossfadeTo(ctx, next, remaining, crossfade/2); err != nil {
+				return err
+			}
+			started = time.Now()
+		case crossfade == 0 && remaining <= q.interval:
+			// Switch just as the track ends
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(max(remaining, 0)):
+			}
+			if err := q.play(ctx, next); err != nil {
+				return err
+			}
+			started = time.Now()
+		}
+	}
+}
+
+// play casts a track, which becomes the current one
+func (q *AudioQueue) play(ctx context.Context, track Track) error {
+	err := q.cast(ctx, track)
+	q.advance(err)
+	return err
+}
+
+// cast sends a track to the TV and starts it
+func (q *AudioQueue) cast(ctx context.Context, track Track) error {
+	if err := q.renderer.checkMediaURL(ctx, track.URL); err != nil {
+		return err
+	}
+	if err := q.renderer.intend(ctx, q.tv, JournalAudio, track.URL, "", track.Title); err != nil {
+		return err
+	}
+	unlock, err := q.renderer.lockTV(ctx, q.tv)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := q.tv.setAVTransportURIMetadata(ctx, track.URL, trackMetadata(track)); err != nil {
+		return fmt.Errorf("set URI: %w", err)
+	}
+	if err := q.tv.play(ctx); err != nil {
+		return fmt.Errorf("play: %w", err)
+	}
+	return nil
+}
+
+// crossfadeTo fades the current track out over fadeOut, switches to next
+// and fades it in over fadeIn. Without volume control it only switches.
+func (q *AudioQueue) crossfadeTo(ctx context.Context, next Track, fadeOut, fadeIn time.Duration) error {
+	volume, err := q.tv.GetVolume(ctx)
+	if err != nil {
+		volume = -1
+	}
+	if volume > 0 {
+		// Never leave the TV quieter than it was, even if ctx ends mid-fade
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			defer cancel()
+			q.tv.SetVolume(ctx, volume)
+		}()
+		q.fade(ctx, volume, 0, fadeOut)
+	}
+	err = q.play(ctx, next)
+	if volume > 0 {
+		q.fade(ctx, 0, volume, fadeIn)
+	}
+	return err
+}
+
+// fade changes the volume from one level to another in steps over d
+func (q *AudioQueue) fade(ctx context.Context, from, to int, d time.Duration) {
+	steps := max(int(d/fadeStep), 1)
+	for i := 1; i <= steps; i++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d / time.Duration(steps)):
+		}
+		q.tv.SetVolume(ctx, from+(to-from)*i/steps)
+	}
+}
+
+// trackMetadata returns the DIDL-Lite metadata of an audio track
+func trackMetadata(track Track) string {
+	res := fmt.Sprintf(`<res protocolInfo="http-get:*:%s:*">%s</res>`, audioContentType(track.URL), escapeXML(track.URL))
+	return didlItem(track.Title, "object.item.audioItem.musicTrack", res)
+}
+
+// parseUPnPDuration parses an AVTransport time such as "0:03:27" or
+// "00:00:01.500". TVs report "NOT_IMPLEMENTED" or nothing when they don't
+// know, which returns false.
+func parseUPnPDuration(s string) (time.Duration, bool) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	hours, err1 := strconv.Atoi(strings.TrimPrefix(parts[0], "+"))
+	minutes, err2 := strconv.Atoi(parts[1])
+	seconds, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil || hours < 0 || minutes < 0 || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds*float64(time.Second)), true
+}
+
+// formatUPnPDuration formats a position for Seek as "H:MM:SS.mmm"
+func formatUPnPDuration(d time.Duration) string {
+	d = max(d, 0).Round(time.Millisecond)
+	h, m := d/time.Hour, d%time.Hour/time.Minute
+	s := float64(d%time.Minute) / float64(time.Second)
+	return fmt.Sprintf("%d:%02d:%06.3f", h, m, s)
+}
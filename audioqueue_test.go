@@ -0,0 +1,194 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// audioTV is a mock TV playing tracks of a fixed length, switching to the
+// next URI on its own like a TV with SetNextAVTransportURI. It starts
+// playing delay after Play and reports whole seconds if coarse is set.
+type audioTV struct {
+	length time.Duration
+	delay  time.Duration
+	coarse bool
+
+	mu      sync.Mutex
+	uri     string
+	next    string
+	started time.Time
+	volume  int
+	volumes []int
+	actions []string
+}
+
+// position advances to the staged track when the current one ended; mu
+// must be held
+func (tv *audioTV) position() (string, time.Duration, bool) {
+	if tv.uri == "" {
+		return "", 0, false
+	}
+	elapsed := time.Since(tv.started)
+	if elapsed >= tv.length && tv.next != "" {
+		tv.uri, tv.next = tv.next, ""
+		tv.started = tv.started.Add(tv.length)
+		elapsed -= tv.length
+	}
+	return tv.uri, max(min(elapsed, tv.length), 0), elapsed < tv.length
+}
+
+func (tv *audioTV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	action := r.Header.Get("SOAPAction")
+	action = strings.Trim(action[strings.LastIndex(action, "#")+1:], `"`)
+	hms := func(d time.Duration) string {
+		if tv.coarse {
+			return fmt.Sprintf("0:00:%02d", int(d.Seconds()))
+		}
+		return fmt.Sprintf("0:00:%06.3f", d.Seconds())
+	}
+	respond := func(args string) {
+		fmt.Fprintf(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:%sResponse xmlns:u="urn:schemas-upnp-org:service:AVTransport:1">%s</u:%sResponse></s:Body></s:Envelope>`, action, args, action)
+	}
+
+	tv.mu.Lock()
+	defer tv.mu.Unlock()
+	if action != "GetPositionInfo" && action != "GetTransportInfo" && action != "GetVolume" {
+		tv.actions = append(tv.actions, action)
+	}
+	switch action {
+	case "SetAVTransportURI":
+		tv.uri, tv.next = soapArg(body, "CurrentURI"), ""
+	case "SetNextAVTransportURI":
+		tv.next = soapArg(body, "NextURI")
+	case "Play":
+		tv.started = time.Now().Add(tv.delay)
+	case "Seek":
+		target, _ := parseUPnPDuration(soapArg(body, "Target"))
+		tv.started = time.Now().Add(-target)
+	case "GetPositionInfo":
+		uri, pos, _ := tv.position()
+		respond(fmt.Sprintf("<TrackURI>%s</TrackURI><TrackDuration>%s</TrackDuration><RelTime>%s</RelTime>", uri, hms(tv.length), hms(pos)))
+	case "GetTransportInfo":
+		state := "STOPPED"
+		if _, _, playing := tv.position(); playing {
+			state = "PLAYING"
+		}
+		respond("<CurrentTransportState>" + state + "</CurrentTransportState>")
+	case "GetVolume":
+		respond("<CurrentVolume>" + strconv.Itoa(tv.volume) + "</CurrentVolume>")
+	case "SetVolume":
+		tv.volume, _ = strconv.Atoi(soapArg(body, "DesiredVolume"))
+		tv.volumes = append(tv.volumes, tv.volume)
+	}
+}
+
+func TestAudioQueue(t *testing.T) {
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	tracks := []Track{
+		{URL: "http://music/a.mp3", Title: "A"},
+		{URL: "http://music/b.mp3", Title: "B"},
+		{URL: "http://music/c.mp3", Title: "C"},
+	}
+	run := func(crossfade time.Duration) *audioTV {
+		t.Helper()
+		mock := &audioTV{length: 600 * time.Millisecond, volume: 30}
+		server := httptest.NewServer(mock)
+		t.Cleanup(server.Close)
+		tv := &TV{Name: "Bar", ControlURL: server.URL + "/avt", VolumeControlURL: server.URL + "/rc"}
+
+		q := NewAudioQueue(renderer, tv, 20*time.Millisecond)
+		q.Append(tracks...)
+		q.SetCrossfade(crossfade)
+		var played []string
+		q.OnTrack(func(track Track, err error) {
+			if err != nil {
+				t.Errorf("track %s failed: %v", track.Title, err)
+			}
+			played = append(played, track.Title)
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := q.Run(ctx); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+		if got := strings.Join(played, ","); got != "A,B,C" {
+			t.Errorf("played %s, want A,B,C", got)
+		}
+		return mock
+	}
+
+	// Gapless: the TV switches to the pre-staged tracks on its own
+	mock := run(0)
+	if got := strings.Join(mock.actions, " "); got != "SetAVTransportURI Play SetNextAVTransportURI SetNextAVTransportURI" {
+		t.Errorf("gapless actions: %s", got)
+	}
+
+	// Crossfade: the volume dips between tracks and ends where it was
+	mock = run(300 * time.Millisecond)
+	if n := strings.Count(strings.Join(mock.actions, " "), "SetAVTransportURI"); n != 3 {
+		t.Errorf("crossfade cast %d tracks, want 3: %v", n, mock.actions)
+	}
+	if len(mock.volumes) == 0 || mock.volume != 30 || !strings.Contains(fmt.Sprint(mock.volumes), " 0 ") {
+		t.Errorf("volumes %v ending at %d, want a fade through 0 back to 30", mock.volumes, mock.volume)
+	}
+}
+
+// TestAudioQueueCrossfadeCancel tests that the volume is restored when
+// the queue is stopped in the middle of a crossfade
+func TestAudioQueueCrossfadeCancel(t *testing.T) {
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	mock := &audioTV{length: time.Minute, volume: 30}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+	tv := &TV{Name: "Bar", ControlURL: server.URL + "/avt", VolumeControlURL: server.URL + "/rc"}
+
+	q := NewAudioQueue(renderer, tv, 20*time.Millisecond)
+	q.Append(Track{URL: "http://music/a.mp3", Title: "A"})
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	q.crossfadeTo(ctx, Track{URL: "http://music/b.mp3", Title: "B"}, time.Second, time.Second)
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	if len(mock.volumes) < 2 || mock.volume != 30 {
+		t.Errorf("volumes %v ending at %d, want a partial fade back to 30", mock.volumes, mock.volume)
+	}
+}
+
+func TestParseUPnPDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"0:03:27":      3*time.Minute + 27*time.Second,
+		"01:00:00.500": time.Hour + 500*time.Millisecond,
+		"+10:00:00":    10 * time.Hour,
+	}
+	for s, want := range tests {
+		if got, ok := parseUPnPDuration(s); !ok || got != want {
+			t.Errorf("parseUPnPDuration(%q) = %v, %v; want %v", s, got, ok, want)
+		}
+	}
+	for _, s := range []string{"", "NOT_IMPLEMENTED", "1:2"} {
+		if _, ok := parseUPnPDuration(s); ok {
+			t.Errorf("parseUPnPDuration(%q) succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditFormat is the file format of an audit trail
+type AuditFormat string
+
+const (
+	AuditJSON AuditFormat = "json" // One JSON object per line
+	AuditCSV  AuditFormat = "csv"  // With a header row
+)
+
+// AuditRecord is one row of an audit trail: what was sent to which TV,
+// when and by whom
+type AuditRecord struct {
+	Seq         uint64    `json:"seq,omitempty"` // Journal sequence number, if journaled
+	Time        time.Time `json:"time"`
+	Op          string    `json:"op"` // JournalCast, JournalVideo, JournalAudio, ...
+	TV          string    `json:"tv"`
+	TVID        string    `json:"tv_id,omitempty"` // UDN
+	TVIP        string    `json:"tv_ip,omitempty"`
+	Session     string    `json:"session,omitempty"`
+	Owner       string    `json:"owner,omitempty"`
+	URL         string    `json:"url,omitempty"`
+	Title       string    `json:"title,omitempty"`
+	Frame       string    `json:"frame,omitempty"` // Content hash of the image, as named in the journal
+	ContentType string    `json:"content_type,omitempty"`
+	Entry       string    `json:"entry,omitempty"`
+}
+
+// auditColumns are the CSV columns, in the order of AuditRecord
+var auditColumns = []string{"seq", "time", "op", "tv", "tv_id", "tv_ip", "session", "owner", "url", "title", "frame", "content_type", "entry"}
+
+// NewAuditRecord flattens a journal entry into an audit record
+func NewAuditRecord(e JournalEntry) AuditRecord {
+	rec := AuditRecord{
+		Seq:         e.Seq,
+		Time:        e.Time,
+		Op:          e.Op,
+		Session:     e.Session.Name,
+		Owner:       e.Session.Owner,
+		URL:         e.URL,
+		Title:       e.Title,
+		Frame:       e.Frame,
+		ContentType: e.ContentType,
+		Entry:       e.Entry,
+	}
+	if e.TV != nil {
+		rec.TV, rec.TVID, rec.TVIP = e.TV.Name, e.TV.UDN, e.TV.IP
+	}
+	return rec
+}
+
+func (rec AuditRecord) csvRow() []string {
+	seq := ""
+	if rec.Seq > 0 {
+		seq = strconv.FormatUint(rec.Seq, 10)
+	}
+	row := []string{seq, rec.Time.UTC().Format(time.RFC3339Nano), rec.Op, rec.TV, rec.TVID, rec.TVIP,
+		rec.Session, rec.Owner, rec.URL, rec.Title, rec.Frame, rec.ContentType, rec.Entry}
+	for i, cell := range row {
+		row[i] = csvCell(cell)
+	}
+	return row
+}
+
+// csvCell escapes a cell spreadsheets would take for a formula, such as a
+// title of "=HYPERLINK(...)", by prefixing it with a quote
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// WriteAudit writes records to w in format, e.g. to export a journal for
+// an auditor. CSV output starts with a header row.
+func WriteAudit(w io.Writer, format AuditFormat, records []AuditRecord) error {
+	switch format {
+	case AuditJSON:
+		enc := json.NewEncoder(w)
+		for _, rec := range records {
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	case AuditCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(auditColumns)
+		for _, rec := range records {
+			cw.Write(rec.csvRow())
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown audit format %q", format)
+}
+
+// Export writes every entry of the journal to w as an audit trail
+func (j *Journal) Export(w io.Writer, format AuditFormat) error {
+	entries, err := j.Entries()
+	if err != nil {
+		return err
+	}
+	records := make([]AuditRecord, len(entries))
+	for i, e := range entries {
+		records[i] = NewAuditRecord(e)
+	}
+	return WriteAudit(w, format, records)
+}
+
+// AuditLog keeps an audit trail of what a Renderer sends to TVs in files,
+// for organizations that must retain records of what public displays
+// showed. Unlike a Journal it is never compacted: files are rotated by
+// size or time and kept, named after the time they were started (e.g.
+// "audit-20261016T120000Z.csv").
+type AuditLog struct {
+	dir    string
+	format AuditFormat
+	every  time.Duration
+	max    int64
+
+	mu      sync.Mutex
+	f       *os.File
+	size    int64 // Bytes in f
+	records int   // Records in f
+	opened  time.Time
+	now     func() time.Time
+}
+
+// AuditOption configures an AuditLog
+type AuditOption func(*AuditLog)
+
+// WithAuditFormat sets the file format (default AuditJSON)
+func WithAuditFormat(format AuditFormat) AuditOption {
+	return func(a *AuditLog) {
+		a.format = format
+	}
+}
+
+// WithAuditMaxSize starts a new file once the current one would grow past
+// size bytes
+func WithAuditMaxSize(size int64) AuditOption {
+	return func(a *AuditLog) {
+		a.max = size
+	}
+}
+
+// WithAuditRotateEvery starts a new file every period, e.g. 24h for one
+// file per day. Periods are aligned to UTC, so daily files start at
+// midnight UTC.
+func WithAuditRotateEvery(period time.Duration) AuditOption {
+	return func(a *AuditLog) {
+		a.every = period
+	}
+}
+
+// OpenAuditLog creates dir if needed and starts a new audit file in it
+func OpenAuditLog(dir string, opts ...AuditOption) (*AuditLog, error) {
+	a := &AuditLog{dir: dir, format: AuditJSON, now: time.Now}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if a.format != AuditJSON && a.format != AuditCSV {
+		return nil, fmt.Errorf("unknown audit format %q", a.format)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create audit log: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.rotate(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Append writes the record of a journal entry and syncs it to disk
+func (a *AuditLog) Append(e JournalEntry) error {
+	if e.Time.IsZero() {
+		e.Time = a.now()
+	}
+	rec := NewAuditRecord(e)
+
+	var line []byte
+	var err error
+	if a.format == AuditCSV {
+		line, err = csvLine(rec.csvRow())
+	} else {
+		line, err = json.Marshal(rec)
+		line = append(line, '\n')
+	}
+	if err != nil {
+		return fmt.Errorf("encode audit record: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return fmt.Errorf("audit log closed")
+	}
+	if a.due(int64(len(line))) {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+	if _, err := a.f.Write(line); err != nil {
+		return fmt.Errorf("write audit log: %w", err)
+	}
+	a.size += int64(len(line))
+	a.records++
+	if err := a.f.Sync(); err != nil {
+		return fmt.Errorf("sync audit log: %w", err)
+	}
+	return nil
+}
+
+// Rotate closes the current file and starts a new one
+func (a *AuditLog) Rotate() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return fmt.Errorf("audit log closed")
+	}
+	return a.rotate()
+}
+
+// Close closes the current file
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return nil
+	}
+	err := a.f.Close()
+	a.f = nil
+	return err
+}
+
+// due reports whether a record of n bytes belongs in a new file. Call with
+// mu held.
+func (a *AuditLog) due(n int64) bool {
+	if a.every > 0 && !a.now().Truncate(a.every).Equal(a.opened.Truncate(a.every)) {
+		return true
+	}
+	return a.max > 0 && a.records > 0 && a.size+n > a.max
+}
+
+// rotate starts a new file. Call with mu held.
+func (a *AuditLog) rotate() error {
+	now := a.now().UTC()
+	base := filepath.Join(a.dir, "audit-"+now.Format("20060102T150405Z"))
+	path := base + "." + string(a.format)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	for i := 1; os.IsExist(err); i++ {
+		// Several files started in the same second
+		path = fmt.Sprintf("%s-%d.%s", base, i, a.format)
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	}
+	if err != nil {
+		return fmt.Errorf("create audit file: %w", err)
+	}
+
+	var size int64
+	if a.format == AuditCSV {
+		header, _ := csvLine(auditColumns)
+		if _, err := f.Write(header); err != nil {
+			f.Close()
+			return fmt.Errorf("write audit log: %w", err)
+		}
+		size = int64(len(header))
+	}
+	if a.f != nil {
+		a.f.Close()
+	}
+	a.f, a.size, a.records, a.opened = f, size, 0, now
+	return nil
+}
+
+// csvLine encodes one CSV row
+func csvLine(row []string) ([]byte, error) {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	cw.Write(row)
+	cw.Flush()
+	return buf.Bytes(), cw.Error()
+}
+
+// WithAuditLog records every cast, video, audio clip and stop in a before
+// it is sent to the TV. Display calls fail if the record can't be written,
+// so nothing is shown without a trace. Frames of a stream are recorded at
+// most every 10 seconds per TV, like in the journal.
+func WithAuditLog(a *AuditLog) Option {
+	return func(r *Renderer) {
+		r.audit = a
+	}
+}
@@ -0,0 +1,150 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditLogRenderer(t *testing.T) {
+	dir := t.TempDir()
+	audit, err := OpenAuditLog(dir, WithAuditFormat(AuditCSV))
+	if err != nil {
+		t.Fatalf("OpenAuditLog failed: %v", err)
+	}
+	defer audit.Close()
+
+	vtv, err := NewVirtualTV("Lobby")
+	if err != nil {
+		t.Fatalf("NewVirtualTV failed: %v", err)
+	}
+	defer vtv.Close()
+	tv := vtv.TV()
+
+	renderer, err := NewRenderer(WithAuditLog(audit))
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	ctx := WithSession(context.Background(), Session{Name: "menu", Owner: "kitchen"})
+	if err := renderer.DisplayText(ctx, tv, "SOUP"); err != nil {
+		t.Fatalf("DisplayText failed: %v", err)
+	}
+	if err := renderer.StreamVideo(context.Background(), tv, "http://example.com/promo.m3u8", "Promo"); err != nil {
+		t.Fatalf("StreamVideo failed: %v", err)
+	}
+	if err := renderer.PlayAudio(context.Background(), tv, sineWAV(16000, 2, -6), "=HYPERLINK(\"http://evil\")"); err != nil {
+		t.Fatalf("PlayAudio failed: %v", err)
+	}
+	if err := renderer.Stop(context.Background(), tv); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "audit-*.csv"))
+	if len(files) != 1 {
+		t.Fatalf("Audit files = %v", files)
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("Invalid CSV: %v", err)
+	}
+	if len(rows) != 5 || strings.Join(rows[0], ",") != strings.Join(auditColumns, ",") {
+		t.Fatalf("Unexpected rows: %q", rows)
+	}
+	cast, video, audio, stop := rows[1], rows[2], rows[3], rows[4]
+	if cast[2] != JournalCast || cast[3] != "Lobby" || cast[6] != "menu" || cast[7] != "kitchen" || len(cast[10]) != 32 {
+		t.Errorf("Unexpected cast row: %q", cast)
+	}
+	if video[2] != JournalVideo || video[8] != "http://example.com/promo.m3u8" || video[9] != "Promo" {
+		t.Errorf("Unexpected video row: %q", video)
+	}
+	// Spreadsheets mustn't take the title for a formula
+	if audio[2] != JournalAudio || audio[9] != `'=HYPERLINK("http://evil")` || audio[11] != "audio/wav" {
+		t.Errorf("Unexpected audio row: %q", audio)
+	}
+	if stop[2] != JournalStop {
+		t.Errorf("Unexpected stop row: %q", stop)
+	}
+}
+
+func TestAuditLogRotation(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC)
+	audit, err := OpenAuditLog(dir, WithAuditMaxSize(250), WithAuditRotateEvery(24*time.Hour))
+	if err != nil {
+		t.Fatalf("OpenAuditLog failed: %v", err)
+	}
+	defer audit.Close()
+	audit.now = func() time.Time { return now }
+	audit.Rotate()
+
+	e := JournalEntry{Op: JournalStop, TV: &TV{Name: "Lobby", UDN: "uuid:lobby"}}
+	for range 4 {
+		if err := audit.Append(e); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	// The next day starts a new file, however small the last one
+	now = now.Add(15 * time.Hour)
+	if err := audit.Append(e); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	count := func(name string) int {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("Read %s: %v", name, err)
+			return 0
+		}
+		if len(data) > 250 {
+			t.Errorf("%s has %d bytes", name, len(data))
+		}
+		return bytes.Count(data, []byte("\n"))
+	}
+	if n := count("audit-20261016T093000Z.json") + count("audit-20261016T093000Z-1.json"); n != 4 {
+		t.Errorf("First day has %d records", n)
+	}
+	if n := count("audit-20261017T003000Z.json"); n != 1 {
+		t.Errorf("Second day has %d records", n)
+	}
+}
+
+func TestJournalExport(t *testing.T) {
+	journal, err := OpenJournal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	journal.Append(JournalEntry{Op: JournalVideo, TV: &TV{Name: "Lobby, left"}, URL: "http://example.com/a.mp4"})
+	journal.Append(JournalEntry{Op: JournalStop, TV: &TV{Name: "Lobby, left"}})
+
+	var buf bytes.Buffer
+	if err := journal.Export(&buf, AuditCSV); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil || len(rows) != 3 || rows[1][0] != "1" || rows[1][3] != "Lobby, left" || rows[2][2] != JournalStop {
+		t.Errorf("CSV export = %q, %v", rows, err)
+	}
+
+	buf.Reset()
+	if err := journal.Export(&buf, AuditJSON); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	var rec AuditRecord
+	if err := json.NewDecoder(&buf).Decode(&rec); err != nil || rec.Seq != 1 || rec.URL != "http://example.com/a.mp4" {
+		t.Errorf("JSON export = %+v, %v", rec, err)
+	}
+}
@@ -0,0 +1,118 @@
+package nimsforestsmarttv
+
+import (
+	"sync"
+	"time"
+)
+
+// bandwidthBuckets is how many per-minute buckets are kept per client (24h)
+const bandwidthBuckets = 24 * 60
+
+// bandwidthMeter counts response bytes per client IP in per-minute buckets.
+// It is safe for concurrent use.
+type bandwidthMeter struct {
+	mu      sync.Mutex
+	clients map[string]*clientUsage
+}
+
+// clientUsage is one client's byte counts
+type clientUsage struct {
+	total   int64
+	bytes   [bandwidthBuckets]int64
+	minutes [bandwidthBuckets]int64 // Unix minute each bucket holds
+}
+
+func newBandwidthMeter() *bandwidthMeter {
+	return &bandwidthMeter{clients: make(map[string]*clientUsage)}
+}
+
+// add records n bytes sent to a client at time t
+func (m *bandwidthMeter) add(clientIP string, n int64, t time.Time) {
+	if n <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.clients[clientIP]
+	if !ok {
+		u = &clientUsage{}
+		m.clients[clientIP] = u
+	}
+
+	minute := t.Unix() / 60
+	i := minute % bandwidthBuckets
+	if u.minutes[i] != minute {
+		u.minutes[i] = minute
+		u.bytes[i] = 0
+	}
+	u.bytes[i] += n
+	u.total += n
+}
+
+// usage returns the bytes sent to a client within window before now, or
+// since the server started when window is 0. Windows are counted in whole
+// minutes and capped at 24 hours.
+func (m *bandwidthMeter) usage(clientIP string, window time.Duration, now time.Time) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.clients[clientIP]
+	if !ok {
+		return 0
+	}
+	if window <= 0 {
+		return u.total
+	}
+
+	minute := now.Unix() / 60
+	oldest := minute - int64((window+time.Minute-1)/time.Minute) + 1
+	var sum int64
+	for i, bucketMinute := range u.minutes {
+		if bucketMinute >= oldest && bucketMinute <= minute {
+			sum += u.bytes[i]
+		}
+	}
+	return sum
+}
+
+// clientIPs returns every client IP that has been sent data
+func (m *bandwidthMeter) clientIPs() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ips := make([]string, 0, len(m.clients))
+	for ip := range m.clients {
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+// BytesServed returns the bytes sent to each client IP within window (or
+// since the server started when window is 0)
+func (s *ImageServer) BytesServed(window time.Duration) map[string]int64 {
+	now := time.Now()
+	served := make(map[string]int64)
+	for _, ip := range s.bandwidth.clientIPs() {
+		served[ip] = s.bandwidth.usage(ip, window, now)
+	}
+	return served
+}
+
+// Bandwidth returns the bytes the TV fetched from the renderer's image
+// server within window (or since start when window is 0), matched by the
+// TV's IP addresses. Windows are counted in whole minutes, up to 24 hours.
+func (r *Renderer) Bandwidth(tv *TV, window time.Duration) int64 {
+	now := time.Now()
+	ips := tv.Addresses
+	if len(ips) == 0 {
+		ips = []string{tv.IP}
+	}
+
+	var sum int64
+	for _, ip := range ips {
+		sum += r.server.bandwidth.usage(ip, window, now)
+	}
+	return sum
+}
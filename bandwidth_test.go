@@ -0,0 +1,68 @@
+package nimsforestsmarttv
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestBandwidthMeterWindows tests per-minute bucketing and windows
+func TestBandwidthMeterWindows(t *testing.T) {
+	m := newBandwidthMeter()
+	now := time.Date(2024, 5, 1, 12, 0, 30, 0, time.UTC)
+
+	m.add("10.0.0.5", 100, now.Add(-2*time.Hour))
+	m.add("10.0.0.5", 200, now.Add(-5*time.Minute))
+	m.add("10.0.0.5", 300, now)
+	m.add("10.0.0.6", 999, now)
+
+	tests := []struct {
+		window time.Duration
+		want   int64
+	}{
+		{time.Minute, 300},
+		{10 * time.Minute, 500},
+		{24 * time.Hour, 600},
+		{0, 600},
+	}
+	for _, tt := range tests {
+		if got := m.usage("10.0.0.5", tt.window, now); got != tt.want {
+			t.Errorf("usage(%v) = %d, want %d", tt.window, got, tt.want)
+		}
+	}
+
+	// A day later the old buckets are reused
+	m.add("10.0.0.5", 50, now.Add(24*time.Hour))
+	if got := m.usage("10.0.0.5", time.Minute, now.Add(24*time.Hour)); got != 50 {
+		t.Errorf("Expected reused bucket to hold 50 bytes, got %d", got)
+	}
+}
+
+// TestBytesServed tests that served bytes are counted per client
+func TestBytesServed(t *testing.T) {
+	server, err := NewImageServer()
+	if err != nil {
+		t.Fatalf("Failed to create image server: %v", err)
+	}
+	defer server.Close()
+
+	payload := make([]byte, 4096)
+	url := server.Store(payload)
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	var total int64
+	for _, n := range server.BytesServed(time.Hour) {
+		total += n
+	}
+	if total != 2*4096 {
+		t.Errorf("Expected %d bytes served, got %d", 2*4096, total)
+	}
+}
@@ -0,0 +1,138 @@
+package nimsforestsmarttv
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// WithBrowserPlayback makes the virtual TV's web page fetch and play media
+// itself instead of the virtual TV rendering frames. Images are shown and
+// videos played by the browser, which makes any screen with a browser
+// (e.g. a Raspberry Pi running Chromium in kiosk mode) a TV of the fleet.
+// Start Chromium with --autoplay-policy=no-user-gesture-required to play
+// video with sound.
+func WithBrowserPlayback() VirtualTVOption {
+	return func(v *VirtualTV) {
+		v.inBrowser = true
+	}
+}
+
+// browserMedia is what a browser-backed virtual TV shows (zero = nothing)
+type browserMedia struct {
+	URI  string `json:"uri"`
+	Type string `json:"type"`
+}
+
+// showInBrowser tells connected pages to show uri
+func (v *VirtualTV) showInBrowser(uri string, gen int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.closed || gen != v.loadGen {
+		return
+	}
+	v.media = browserMedia{URI: uri, Type: v.contentType}
+	v.frames++
+	v.notify()
+}
+
+// Media returns the URI and MIME type the page is told to show (empty if
+// nothing). Only set with WithBrowserPlayback.
+func (v *VirtualTV) Media() (uri string, contentType string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.media.URI, v.media.Type
+}
+
+// handleEvents pushes what to show to the page as server-sent events. The
+// current media is sent right away so reconnecting pages catch up.
+func (v *VirtualTV) handleEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+
+	for {
+		v.mu.Lock()
+		media, changed := v.media, v.changed
+		v.mu.Unlock()
+
+		data, err := json.Marshal(media)
+		if err != nil {
+			return
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// didlContentType returns the MIME type from the protocolInfo of the first
+// res element in DIDL-Lite metadata (empty if there is none)
+func didlContentType(metadata string) string {
+	dec := xml.NewDecoder(strings.NewReader(metadata))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return ""
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "res" {
+			continue
+		}
+		for _, attr := range start.Attr {
+			// protocolInfo is "http-get:*:image/jpeg:*"
+			if parts := strings.Split(attr.Value, ":"); attr.Name.Local == "protocolInfo" && len(parts) == 4 {
+				return parts[2]
+			}
+		}
+		return ""
+	}
+}
+
+// browserPage shows images and plays videos as the server tells it to
+const browserPage = `<!DOCTYPE html>
+<html><head><title>%s</title>
+<style>html,body{margin:0;height:100%%;background:#000;overflow:hidden}img,video{width:100%%;height:100%%;object-fit:contain}</style>
+</head><body><img id="image" hidden alt=""><video id="video" hidden playsinline></video>
+<script>
+const image = document.getElementById("image");
+const video = document.getElementById("video");
+
+function show(media) {
+  const isVideo = media.type.startsWith("video/") || media.type.toLowerCase().includes("mpegurl");
+  if (!media.uri || !isVideo) {
+    video.pause();
+    video.removeAttribute("src");
+    video.hidden = true;
+  }
+  if (!media.uri) {
+    image.hidden = true;
+    return;
+  }
+  if (isVideo) {
+    image.hidden = true;
+    video.src = media.uri;
+    video.hidden = false;
+    // Browsers refuse to autoplay sound without a user gesture
+    video.play().catch(() => { video.muted = true; video.play(); });
+    return;
+  }
+  image.src = media.uri;
+  image.hidden = false;
+}
+
+new EventSource("/events").onmessage = (e) => show(JSON.parse(e.data));
+</script>
+</body></html>
+`
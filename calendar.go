@@ -0,0 +1,263 @@
+package nimsforestsmarttv
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Calendar is a set of blackout dates, e.g. public holidays, on which
+// schedules skip their runs or show alternate content. It is safe for
+// concurrent use.
+type Calendar struct {
+	mu      sync.RWMutex
+	entries []calendarEntry
+}
+
+// calendarEntry is a span of whole days, optionally repeating every year
+type calendarEntry struct {
+	start   time.Time // First day, midnight UTC
+	end     time.Time // Last day (inclusive), midnight UTC
+	yearly  bool
+	summary string
+}
+
+// dateLayouts are the date formats of date lists
+const (
+	dateLayout   = "2006-01-02"
+	yearlyLayout = "01-02"
+)
+
+// NewCalendar creates an empty calendar
+func NewCalendar() *Calendar {
+	return &Calendar{}
+}
+
+// Add blacks out the days from start to end (inclusive) with a summary
+// like "Christmas". Only the dates of start and end count.
+func (c *Calendar) Add(start, end time.Time, summary string) {
+	c.add(calendarEntry{start: civilDay(start), end: civilDay(end), summary: summary})
+}
+
+// AddYearly blacks out a date every year, e.g. AddYearly(time.December, 25, "Christmas")
+func (c *Calendar) AddYearly(month time.Month, day int, summary string) {
+	d := time.Date(2000, month, day, 0, 0, 0, 0, time.UTC)
+	c.add(calendarEntry{start: d, end: d, yearly: true, summary: summary})
+}
+
+func (c *Calendar) add(e calendarEntry) {
+	switch {
+	case e.end.Before(e.start) && e.yearly:
+		e.end = e.end.AddDate(1, 0, 0) // Spans New Year
+	case e.end.Before(e.start):
+		e.start, e.end = e.end, e.start
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = append(c.entries, e)
+}
+
+// civilDay returns midnight UTC of t's date in t's location
+func civilDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// Contains reports whether t's date, in t's location, is blacked out and
+// returns the summary of the matching entry
+func (c *Calendar) Contains(t time.Time) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	day := civilDay(t)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, e := range c.entries {
+		if !e.yearly {
+			if !day.Before(e.start) && !day.After(e.end) {
+				return e.summary, true
+			}
+			continue
+		}
+		// Try this year's and last year's occurrence, for spans over New Year
+		span := e.end.Sub(e.start)
+		for _, year := range []int{day.Year(), day.Year() - 1} {
+			start := time.Date(year, e.start.Month(), e.start.Day(), 0, 0, 0, 0, time.UTC)
+			if !day.Before(start) && !day.After(start.Add(span)) {
+				return e.summary, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Len returns the number of entries
+func (c *Calendar) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries)
+}
+
+// ParseDateList reads a calendar from a simple list, one entry per line:
+//
+//	# Comments and blank lines are ignored
+//	2026-12-24..2026-12-26 Christmas
+//	2026-05-01 Labour Day
+//	01-01 New Year (every year)
+func ParseDateList(r io.Reader) (*Calendar, error) {
+	c := NewCalendar()
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		dates, summary, _ := strings.Cut(line, " ")
+		summary = strings.TrimSpace(summary)
+		from, to, isRange := strings.Cut(dates, "..")
+		if !isRange {
+			to = from
+		}
+
+		if start, err := time.Parse(yearlyLayout, from); err == nil {
+			end, err := time.Parse(yearlyLayout, to)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			c.add(calendarEntry{
+				start:   time.Date(2000, start.Month(), start.Day(), 0, 0, 0, 0, time.UTC),
+				end:     time.Date(2000, end.Month(), end.Day(), 0, 0, 0, 0, time.UTC),
+				yearly:  true,
+				summary: summary,
+			})
+			continue
+		}
+
+		start, err := time.Parse(dateLayout, from)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		end, err := time.Parse(dateLayout, to)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		c.Add(start, end, summary)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("read date list: %w", err)
+	}
+	return c, nil
+}
+
+// ParseICal reads the all-day events of an iCalendar (.ics) file, as
+// exported by most calendar apps. Events with RRULE:FREQ=YEARLY repeat
+// every year; other recurrence rules are ignored.
+func ParseICal(r io.Reader) (*Calendar, error) {
+	lines, err := unfoldICal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewCalendar()
+	var event map[string]string
+	for n, line := range lines {
+		switch {
+		case line == "BEGIN:VEVENT":
+			event = make(map[string]string)
+			continue
+		case line == "END:VEVENT":
+			if event == nil {
+				return nil, fmt.Errorf("line %d: END:VEVENT without BEGIN", n+1)
+			}
+			e, err := icalEvent(event)
+			if err != nil {
+				return nil, fmt.Errorf("event %q: %w", event["SUMMARY"], err)
+			}
+			c.add(e)
+			event = nil
+			continue
+		case event == nil:
+			continue
+		}
+
+		// NAME;PARAM=VALUE:value
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, _, _ = strings.Cut(name, ";")
+		event[strings.ToUpper(name)] = value
+	}
+	return c, nil
+}
+
+// unfoldICal reads content lines, joining folded continuation lines
+func unfoldICal(r io.Reader) ([]string, error) {
+	var lines []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("read iCalendar: %w", err)
+	}
+	return lines, nil
+}
+
+// icalEvent converts a VEVENT's properties to a calendar entry
+func icalEvent(props map[string]string) (calendarEntry, error) {
+	start, err := icalDate(props["DTSTART"])
+	if err != nil {
+		return calendarEntry{}, fmt.Errorf("DTSTART: %w", err)
+	}
+	end := start
+	if v, ok := props["DTEND"]; ok {
+		// DTEND of all-day events is exclusive
+		if end, err = icalDate(v); err != nil {
+			return calendarEntry{}, fmt.Errorf("DTEND: %w", err)
+		}
+		if end.After(start) {
+			end = end.AddDate(0, 0, -1)
+		}
+	}
+	return calendarEntry{
+		start:   start,
+		end:     end,
+		yearly:  strings.Contains(strings.ToUpper(props["RRULE"]), "FREQ=YEARLY"),
+		summary: strings.ReplaceAll(props["SUMMARY"], `\,`, ","),
+	}, nil
+}
+
+// icalDate parses the date part of an iCalendar DATE or DATE-TIME value
+func icalDate(v string) (time.Time, error) {
+	if len(v) < 8 {
+		return time.Time{}, fmt.Errorf("invalid date %q", v)
+	}
+	return time.Parse("20060102", v[:8])
+}
+
+// LoadCalendar reads a calendar file: iCalendar for .ics files, a date
+// list (see ParseDateList) otherwise
+func LoadCalendar(path string) (*Calendar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open calendar: %w", err)
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".ics") {
+		return ParseICal(f)
+	}
+	return ParseDateList(f)
+}
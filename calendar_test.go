@@ -0,0 +1,152 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDateList(t *testing.T) {
+	cal, err := ParseDateList(strings.NewReader(`
+# Office closures
+2026-12-24..2026-12-26 Christmas
+2026-05-01 Labour Day
+12-31..01-01 New Year
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		date    time.Time
+		holiday string
+		want    bool
+	}{
+		{time.Date(2026, 12, 25, 9, 0, 0, 0, time.UTC), "Christmas", true},
+		{time.Date(2026, 12, 27, 9, 0, 0, 0, time.UTC), "", false},
+		{time.Date(2026, 5, 1, 23, 59, 0, 0, time.UTC), "Labour Day", true},
+		{time.Date(2027, 5, 1, 9, 0, 0, 0, time.UTC), "", false},
+		{time.Date(2030, 12, 31, 9, 0, 0, 0, time.UTC), "New Year", true},
+		{time.Date(2031, 1, 1, 9, 0, 0, 0, time.UTC), "New Year", true},
+		{time.Date(2031, 1, 2, 9, 0, 0, 0, time.UTC), "", false},
+	}
+	for _, tt := range tests {
+		holiday, ok := cal.Contains(tt.date)
+		if ok != tt.want || holiday != tt.holiday {
+			t.Errorf("Contains(%v) = %q, %v, want %q, %v", tt.date, holiday, ok, tt.holiday, tt.want)
+		}
+	}
+
+	if _, err := ParseDateList(strings.NewReader("tomorrow Party")); err == nil {
+		t.Error("invalid date accepted")
+	}
+}
+
+func TestParseICal(t *testing.T) {
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20261224",
+		"DTEND;VALUE=DATE:20261227",
+		"SUMMARY:Christmas\\, office",
+		"  closed",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20200501",
+		"RRULE:FREQ=YEARLY",
+		"SUMMARY:Labour Day",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	path := filepath.Join(t.TempDir(), "holidays.ics")
+	if err := os.WriteFile(path, []byte(ics), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cal, err := LoadCalendar(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cal.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", cal.Len())
+	}
+
+	// A Berlin morning is still the previous day in New York
+	berlin, newYork := mustLoadLocation(t, "Europe/Berlin"), mustLoadLocation(t, "America/New_York")
+	morning := time.Date(2026, 12, 24, 2, 0, 0, 0, berlin)
+	if holiday, ok := cal.Contains(morning); !ok || holiday != "Christmas, office closed" {
+		t.Errorf("Contains(Christmas Eve) = %q, %v", holiday, ok)
+	}
+	if _, ok := cal.Contains(morning.In(newYork)); ok {
+		t.Error("23 December in New York is not a holiday")
+	}
+	if _, ok := cal.Contains(time.Date(2026, 12, 27, 12, 0, 0, 0, berlin)); ok {
+		t.Error("DTEND should be exclusive")
+	}
+	if _, ok := cal.Contains(time.Date(2031, 5, 1, 12, 0, 0, 0, berlin)); !ok {
+		t.Error("yearly event should repeat")
+	}
+}
+
+// TestSchedulerBlackout tests that runs on blackout dates are skipped or
+// show the alternate content
+func TestSchedulerBlackout(t *testing.T) {
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	vtv, err := NewVirtualTV("Lobby")
+	if err != nil {
+		t.Fatalf("NewVirtualTV failed: %v", err)
+	}
+	defer vtv.Close()
+	tv := vtv.TV()
+
+	cal := NewCalendar()
+	cal.AddYearly(time.December, 25, "Christmas")
+
+	now := time.Date(2026, 12, 24, 12, 0, 0, 0, time.UTC)
+	scheduler := NewScheduler(renderer, nil)
+	scheduler.now = func() time.Time { return now }
+	scheduler.SetBlackout(cal)
+
+	var runs []ScheduleRun
+	scheduler.OnRun(func(run ScheduleRun) { runs = append(runs, run) })
+
+	text := func(s string) func(time.Time) Content {
+		return func(time.Time) Content { return Content{Text: s} }
+	}
+	scheduler.Add(ScheduleEntry{
+		Name:     "menu",
+		Schedule: Schedule{Hour: 11, Location: time.UTC},
+		TVs:      []*TV{tv},
+		Content:  text("MENU"),
+	})
+	scheduler.Add(ScheduleEntry{
+		Name:      "greeting",
+		Schedule:  Schedule{Hour: 10, Location: time.UTC},
+		TVs:       []*TV{tv},
+		Content:   text("HELLO"),
+		Alternate: text("MERRY CHRISTMAS"),
+	})
+
+	now = time.Date(2026, 12, 25, 11, 0, 0, 0, time.UTC)
+	scheduler.RunDue(context.Background())
+
+	if len(runs) != 2 {
+		t.Fatalf("runs = %+v, want 2", runs)
+	}
+	for _, run := range runs {
+		if run.Holiday != "Christmas" || run.Err != nil {
+			t.Errorf("run = %+v, want Christmas", run)
+		}
+		if skipped := run.Entry == "menu"; run.Skipped != skipped {
+			t.Errorf("%s skipped = %v, want %v", run.Entry, run.Skipped, skipped)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package nimsforestsmarttv
+
+import "slices"
+
+// Capability is an optional feature a TV may support
+type Capability string
+
+const (
+	CapImage      Capability = "image"      // Static images via SetAVTransportURI
+	CapGapless    Capability = "gapless"    // Smooth updates via SetNextAVTransportURI
+	CapIcon       Capability = "icon"       // Icon advertised in the device description
+	CapRemoteKeys Capability = "keys"       // SendKey
+	CapTextInput  Capability = "text_input" // TypeText
+	CapScreenshot Capability = "screenshot" // Screenshot
+	CapTrickPlay  Capability = "trick_play" // Play at other speeds, FastForward, Rewind
+)
+
+// Capabilities lists the optional features the TV supports, as far as is
+// known from discovery (AVTransport actions are assumed supported until
+// LoadActions has run)
+func (tv *TV) Capabilities() []Capability {
+	var caps []Capability
+	for _, c := range []Capability{CapImage, CapGapless, CapIcon, CapRemoteKeys, CapTextInput, CapScreenshot, CapTrickPlay} {
+		if tv.Has(c) {
+			caps = append(caps, c)
+		}
+	}
+	return caps
+}
+
+// Has reports whether the TV supports a capability
+func (tv *TV) Has(c Capability) bool {
+	switch c {
+	case CapImage:
+		return tv.SupportsAction("SetAVTransportURI")
+	case CapGapless:
+		return tv.SupportsAction("SetNextAVTransportURI")
+	case CapIcon:
+		return tv.IconURL != ""
+	case CapRemoteKeys:
+		return tv.Remote != nil || tv.KeyControlURL != "" || tv.isRoku()
+	case CapTextInput:
+		return tv.Remote != nil || tv.isRoku()
+	case CapScreenshot:
+		return tv.Screenshotter != nil
+	case CapTrickPlay:
+		return len(tv.PlaySpeeds) > 1 || slices.Contains(tv.Actions, "X_DLNA_FF")
+	default:
+		return false
+	}
+}
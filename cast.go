@@ -0,0 +1,415 @@
+package nimsforestsmarttv
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cast v2 namespaces
+const (
+	castNSConnection = "urn:x-cast:com.google.cast.tp.connection"
+	castNSHeartbeat  = "urn:x-cast:com.google.cast.tp.heartbeat"
+	castNSReceiver   = "urn:x-cast:com.google.cast.receiver"
+	castNSMedia      = "urn:x-cast:com.google.cast.media"
+)
+
+const (
+	castDefaultPort     = 8009
+	castService         = "_googlecast._tcp.local."
+	castMediaReceiverID = "CC1AD845" // Default Media Receiver app
+	castSender          = "sender-0"
+	castReceiver        = "receiver-0"
+)
+
+// castTimeout bounds a Cast command when ctx has no deadline
+const castTimeout = 15 * time.Second
+
+// maxCastMessage bounds the size of a message read from a device
+const maxCastMessage = 64 << 10
+
+// DiscoverCast finds Google Cast devices (Chromecasts and TVs with Cast
+// built in) on the local network using mDNS. They are returned as TVs with
+// Protocol set to ProtocolCast; AVTransport-only calls such as Pause or
+// Seek return ErrUnsupportedAction for them.
+//
+// If ctx is done before the timeout, the devices found so far are returned
+// together with ctx.Err().
+func DiscoverCast(ctx context.Context, timeout time.Duration) ([]TV, error) {
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	services, err := browseMDNS(ctx, nil, castService, timeout)
+	tvs := make([]TV, 0, len(services))
+	for _, s := range services {
+		tvs = append(tvs, castTV(s))
+	}
+	return tvs, err
+}
+
+// castTV builds the TV for a Cast device from its mDNS record
+func castTV(s mdnsService) TV {
+	name := s.TXT["fn"]
+	if name == "" {
+		name, _, _ = strings.Cut(s.Instance, ".")
+	}
+	port := s.Port
+	if port == 0 {
+		port = castDefaultPort
+	}
+	tv := TV{
+		Name:       name,
+		IP:         s.IP,
+		Port:       port,
+		ControlURL: "cast://" + net.JoinHostPort(s.IP, strconv.Itoa(port)),
+		ModelName:  s.TXT["md"],
+		Protocol:   ProtocolCast,
+		Actions:    []string{},
+		Addresses:  []string{s.IP},
+	}
+	if id := s.TXT["id"]; id != "" {
+		tv.UDN = "uuid:" + id
+	}
+	return tv
+}
+
+// castDevice drives a Google Cast device through its Default Media Receiver
+type castDevice struct {
+	tv *TV
+}
+
+func (d *castDevice) Load(ctx context.Context, media Media) (err error) {
+	ctx, span := startSpan(ctx, "smarttv.cast LOAD", append(d.tv.traceAttributes(), Attribute{Key: "url.full", Value: d.tv.ControlURL})...)
+	defer func() { endSpan(span, err) }()
+	return d.tv.wrapError("LOAD", d.tv.ControlURL, d.load(ctx, media))
+}
+
+func (d *castDevice) load(ctx context.Context, media Media) error {
+	c, err := dialCast(ctx, d.tv.ControlURL)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	// Launching an app that is running already just returns its status
+	status, err := c.request(castReceiver, castNSReceiver, map[string]any{"type": "LAUNCH", "appId": castMediaReceiverID})
+	if err != nil {
+		return fmt.Errorf("launch media receiver: %w", err)
+	}
+	app, ok := status.app(castMediaReceiverID)
+	if !ok {
+		return errors.New("launch media receiver: not running")
+	}
+	if err := c.send(app.TransportID, castNSConnection, map[string]any{"type": "CONNECT"}); err != nil {
+		return err
+	}
+
+	contentType := media.ContentType
+	if contentType == "" {
+		contentType = guessContentType(media.URL)
+	}
+	load := map[string]any{
+		"type": "LOAD",
+		"media": map[string]any{
+			"contentId":   media.URL,
+			"contentType": contentType,
+			"streamType":  "BUFFERED",
+			"metadata":    map[string]any{"metadataType": 0, "title": media.Title},
+		},
+		"autoplay": true,
+	}
+	if _, err := c.request(app.TransportID, castNSMedia, load); err != nil {
+		return fmt.Errorf("load media: %w", err)
+	}
+	return nil
+}
+
+func (d *castDevice) Stop(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, "smarttv.cast STOP", append(d.tv.traceAttributes(), Attribute{Key: "url.full", Value: d.tv.ControlURL})...)
+	defer func() { endSpan(span, err) }()
+	return d.tv.wrapError("STOP", d.tv.ControlURL, d.stop(ctx))
+}
+
+func (d *castDevice) stop(ctx context.Context) error {
+	c, err := dialCast(ctx, d.tv.ControlURL)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	status, err := c.request(castReceiver, castNSReceiver, map[string]any{"type": "GET_STATUS"})
+	if err != nil {
+		return err
+	}
+	for _, app := range status.Status.Applications {
+		// The backdrop shown when idle isn't ours to stop
+		if app.IsIdleScreen {
+			continue
+		}
+		if _, err := c.request(castReceiver, castNSReceiver, map[string]any{"type": "STOP", "sessionId": app.SessionID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// guessContentType returns the MIME type of a media URL from its extension
+func guessContentType(mediaURL string) string {
+	ext := ""
+	if u, err := url.Parse(mediaURL); err == nil {
+		ext = strings.ToLower(path.Ext(u.Path))
+	}
+	switch ext {
+	case ".m3u8":
+		return "application/x-mpegURL"
+	case ".ts":
+		return "video/mp2t"
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "video/mp4"
+}
+
+// castMessage is a Cast v2 CastMessage with a string payload
+type castMessage struct {
+	Source      string
+	Destination string
+	Namespace   string
+	Payload     string
+}
+
+// castApp is a running receiver application
+type castApp struct {
+	AppID        string `json:"appId"`
+	SessionID    string `json:"sessionId"`
+	TransportID  string `json:"transportId"`
+	IsIdleScreen bool   `json:"isIdleScreen"`
+}
+
+// castReply is the JSON payload of a message from the device
+type castReply struct {
+	Type      string `json:"type"`
+	RequestID int    `json:"requestId"`
+	Reason    string `json:"reason"`
+
+	// Receiver status only; media status sends a list
+	Status struct {
+		Applications []castApp `json:"applications"`
+	} `json:"-"`
+}
+
+// app returns the running application with the given ID
+func (r castReply) app(appID string) (castApp, bool) {
+	for _, app := range r.Status.Applications {
+		if app.AppID == appID {
+			return app, true
+		}
+	}
+	return castApp{}, false
+}
+
+// castConn is a connection to a Cast device
+type castConn struct {
+	conn      net.Conn
+	r         *bufio.Reader
+	requestID int
+	stop      func() bool
+}
+
+// dialCast connects to the device at a cast:// control URL and opens the
+// virtual connection to its platform receiver
+func dialCast(ctx context.Context, controlURL string) (*castConn, error) {
+	u, err := url.Parse(controlURL)
+	if err != nil || u.Scheme != "cast" {
+		return nil, fmt.Errorf("invalid Cast address %q", controlURL)
+	}
+
+	// Cast devices present certificates signed by Google's device CA,
+	// which isn't in the system roots
+	dialer := &tls.Dialer{Config: &tls.Config{InsecureSkipVerify: true}}
+	conn, err := dialer.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(castTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	c := &castConn{conn: conn, r: bufio.NewReader(conn)}
+	c.stop = context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	if err := c.send(castReceiver, castNSConnection, map[string]any{"type": "CONNECT"}); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close closes the connection
+func (c *castConn) Close() error {
+	c.stop()
+	return c.conn.Close()
+}
+
+// send sends a JSON payload to a destination
+func (c *castConn) send(destination string, namespace string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	msg := encodeCastMessage(castMessage{Source: castSender, Destination: destination, Namespace: namespace, Payload: string(data)})
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(msg)))
+	if _, err := c.conn.Write(append(frame, msg...)); err != nil {
+		return fmt.Errorf("send: %w", err)
+	}
+	return nil
+}
+
+// read reads the next message, answering heartbeats on the way
+func (c *castConn) read() (castMessage, error) {
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(c.r, size[:]); err != nil {
+			return castMessage{}, fmt.Errorf("read: %w", err)
+		}
+		n := binary.BigEndian.Uint32(size[:])
+		if n > maxCastMessage {
+			return castMessage{}, fmt.Errorf("message of %d bytes too large", n)
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return castMessage{}, fmt.Errorf("read: %w", err)
+		}
+		msg, err := decodeCastMessage(data)
+		if err != nil {
+			return castMessage{}, err
+		}
+		if msg.Namespace == castNSHeartbeat && strings.Contains(msg.Payload, `"PING"`) {
+			if err := c.send(msg.Source, castNSHeartbeat, map[string]any{"type": "PONG"}); err != nil {
+				return castMessage{}, err
+			}
+			continue
+		}
+		return msg, nil
+	}
+}
+
+// request sends payload with a new request ID and returns the reply to it.
+// Error replies (LAUNCH_ERROR, LOAD_FAILED, INVALID_REQUEST, ...) are
+// returned as errors.
+func (c *castConn) request(destination string, namespace string, payload map[string]any) (castReply, error) {
+	c.requestID++
+	payload["requestId"] = c.requestID
+	if err := c.send(destination, namespace, payload); err != nil {
+		return castReply{}, err
+	}
+
+	for {
+		msg, err := c.read()
+		if err != nil {
+			return castReply{}, err
+		}
+		var reply castReply
+		if err := json.Unmarshal([]byte(msg.Payload), &reply); err != nil || reply.RequestID != c.requestID {
+			continue
+		}
+		switch reply.Type {
+		case "RECEIVER_STATUS":
+			var status struct {
+				Status json.RawMessage `json:"status"`
+			}
+			if json.Unmarshal([]byte(msg.Payload), &status) == nil {
+				json.Unmarshal(status.Status, &reply.Status)
+			}
+		case "LAUNCH_ERROR", "LOAD_FAILED", "LOAD_CANCELLED", "INVALID_REQUEST":
+			if reply.Reason != "" {
+				return reply, fmt.Errorf("%s: %s", reply.Type, reply.Reason)
+			}
+			return reply, errors.New(reply.Type)
+		}
+		return reply, nil
+	}
+}
+
+// encodeCastMessage encodes the CastMessage protobuf
+func encodeCastMessage(m castMessage) []byte {
+	var b []byte
+	b = append(b, 1<<3, 0) // protocol_version: CASTV2_1_0
+	b = appendProtoString(b, 2, m.Source)
+	b = appendProtoString(b, 3, m.Destination)
+	b = appendProtoString(b, 4, m.Namespace)
+	b = append(b, 5<<3, 0) // payload_type: STRING
+	return appendProtoString(b, 6, m.Payload)
+}
+
+// appendProtoString appends a length-delimited protobuf field
+func appendProtoString(b []byte, field int, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(field<<3|2))
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// decodeCastMessage decodes the CastMessage protobuf, skipping unknown
+// fields
+func decodeCastMessage(data []byte) (castMessage, error) {
+	var m castMessage
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return m, errors.New("malformed Cast message")
+		}
+		data = data[n:]
+
+		switch key & 7 {
+		case 0: // varint
+			if _, n = binary.Uvarint(data); n <= 0 {
+				return m, errors.New("malformed Cast message")
+			}
+			data = data[n:]
+		case 1: // 64-bit
+			if len(data) < 8 {
+				return m, errors.New("malformed Cast message")
+			}
+			data = data[8:]
+		case 5: // 32-bit
+			if len(data) < 4 {
+				return m, errors.New("malformed Cast message")
+			}
+			data = data[4:]
+		case 2: // length-delimited
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return m, errors.New("malformed Cast message")
+			}
+			value := string(data[n : n+int(size)])
+			data = data[n+int(size):]
+			switch key >> 3 {
+			case 2:
+				m.Source = value
+			case 3:
+				m.Destination = value
+			case 4:
+				m.Namespace = value
+			case 6:
+				m.Payload = value
+			}
+		default:
+			return m, errors.New("malformed Cast message")
+		}
+	}
+	return m, nil
+}
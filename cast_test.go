@@ -0,0 +1,264 @@
+package nimsforestsmarttv
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"image"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// castMock is a Cast device running the Default Media Receiver
+type castMock struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	messages []string // "namespace type" of every message received
+	loaded   string   // contentId of the last LOAD
+	running  bool
+	failLoad bool
+}
+
+func newCastMock(t *testing.T) *castMock {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	m := &castMock{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go m.serve(conn)
+		}
+	}()
+	return m
+}
+
+func (m *castMock) tv() *TV {
+	return &TV{Name: "Kitchen", ControlURL: "cast://" + m.listener.Addr().String(), Protocol: ProtocolCast, Actions: []string{}}
+}
+
+func (m *castMock) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(source, namespace string, payload map[string]any) {
+		data, _ := json.Marshal(payload)
+		msg := encodeCastMessage(castMessage{Source: source, Destination: castSender, Namespace: namespace, Payload: string(data)})
+		conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(msg))), msg...))
+	}
+	status := func(id any) map[string]any {
+		apps := []map[string]any{{"appId": "E8C28D3C", "sessionId": "backdrop", "transportId": "backdrop", "isIdleScreen": true}}
+		if m.running {
+			apps = []map[string]any{{"appId": castMediaReceiverID, "sessionId": "session-1", "transportId": "web-1"}}
+		}
+		return map[string]any{"type": "RECEIVER_STATUS", "requestId": id, "status": map[string]any{"applications": apps}}
+	}
+
+	// Devices ping their senders; the PONG may come at any point
+	reply(castReceiver, castNSHeartbeat, map[string]any{"type": "PING"})
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return
+		}
+		data := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			return
+		}
+		msg, err := decodeCastMessage(data)
+		if err != nil {
+			return
+		}
+		var payload struct {
+			Type      string `json:"type"`
+			RequestID int    `json:"requestId"`
+			Media     struct {
+				ContentID string `json:"contentId"`
+			} `json:"media"`
+		}
+		json.Unmarshal([]byte(msg.Payload), &payload)
+
+		m.mu.Lock()
+		m.messages = append(m.messages, msg.Namespace[strings.LastIndex(msg.Namespace, ".")+1:]+" "+payload.Type)
+		switch payload.Type {
+		case "LAUNCH":
+			m.running = true
+			reply(castReceiver, castNSReceiver, status(payload.RequestID))
+		case "GET_STATUS":
+			reply(castReceiver, castNSReceiver, status(payload.RequestID))
+		case "STOP":
+			m.running = false
+			reply(castReceiver, castNSReceiver, status(payload.RequestID))
+		case "LOAD":
+			if m.failLoad {
+				reply("web-1", castNSMedia, map[string]any{"type": "LOAD_FAILED", "requestId": payload.RequestID})
+			} else {
+				m.loaded = payload.Media.ContentID
+				reply("web-1", castNSMedia, map[string]any{"type": "MEDIA_STATUS", "requestId": payload.RequestID, "status": []any{}})
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+func TestCastDevice(t *testing.T) {
+	mock := newCastMock(t)
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tv := mock.tv()
+
+	if err := renderer.DisplayText(ctx, tv, "Hello"); err != nil {
+		t.Fatalf("DisplayText failed: %v", err)
+	}
+	mock.mu.Lock()
+	loaded, messages := mock.loaded, strings.Join(mock.messages, ",")
+	mock.mu.Unlock()
+	if !strings.HasPrefix(loaded, renderer.ServerURL()) {
+		t.Errorf("Loaded %q, want an image of the renderer", loaded)
+	}
+	if !strings.Contains(messages, "heartbeat PONG") || strings.Replace(messages, "heartbeat PONG,", "", 1) != "connection CONNECT,receiver LAUNCH,connection CONNECT,media LOAD" {
+		t.Errorf("Unexpected messages: %s", messages)
+	}
+
+	if err := renderer.Stop(ctx, tv); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	mock.mu.Lock()
+	running := mock.running
+	mock.mu.Unlock()
+	if running {
+		t.Error("Media receiver still running after Stop")
+	}
+
+	// Nothing but the backdrop runs now, which stays
+	if err := renderer.Stop(ctx, tv); err != nil {
+		t.Fatalf("Second Stop failed: %v", err)
+	}
+
+	// Announcements go through the Cast device too
+	if err := renderer.PlayAudio(ctx, tv, []byte("ID3 clip"), ""); err != nil {
+		t.Fatalf("PlayAudio failed: %v", err)
+	}
+	mock.mu.Lock()
+	loaded = mock.loaded
+	mock.mu.Unlock()
+	if !strings.HasPrefix(loaded, renderer.ServerURL()) || !strings.HasSuffix(loaded, ".mp3") {
+		t.Errorf("Loaded %q, want the clip on the renderer", loaded)
+	}
+
+	// Image and audio together and speaker groups need DLNA
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	if err := renderer.DisplayImageWithAudio(ctx, tv, img, "http://media/voice.mp3"); !errors.Is(err, ErrUnsupportedAction) {
+		t.Errorf("Expected ErrUnsupportedAction for DisplayImageWithAudio, got %v", err)
+	}
+	group := NewSpeakerGroup(renderer, []*TV{tv}, 0)
+	if _, err := group.Play(ctx, "http://media/song.mp3", "Song"); !errors.Is(err, ErrUnsupportedAction) {
+		t.Errorf("Expected ErrUnsupportedAction for SpeakerGroup.Play, got %v", err)
+	}
+
+	mock.mu.Lock()
+	mock.failLoad = true
+	mock.mu.Unlock()
+	err = renderer.StreamVideo(ctx, tv, "http://media/movie.mp4", "Movie")
+	var tvErr *TVError
+	if !errors.As(err, &tvErr) || tvErr.Action != "LOAD" || !strings.Contains(err.Error(), "LOAD_FAILED") {
+		t.Errorf("Expected a failed LOAD, got %v", err)
+	}
+
+	if err := tv.Pause(ctx); !errors.Is(err, ErrUnsupportedAction) {
+		t.Errorf("Expected ErrUnsupportedAction for Pause, got %v", err)
+	}
+}
+
+func TestCastMessage(t *testing.T) {
+	m := castMessage{Source: "sender-0", Destination: "receiver-0", Namespace: castNSReceiver, Payload: `{"type":"GET_STATUS"}`}
+	got, err := decodeCastMessage(encodeCastMessage(m))
+	if err != nil || got != m {
+		t.Errorf("Round trip = %+v, %v", got, err)
+	}
+	for _, data := range [][]byte{{0x32, 0x05, 'a'}, {0x08}, {0x0f}} {
+		if _, err := decodeCastMessage(data); err == nil {
+			t.Errorf("decodeCastMessage(%x) succeeded", data)
+		}
+	}
+}
+
+func TestBrowseMDNS(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+
+	go func() {
+		buf := make([]byte, 1500)
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil || !strings.Contains(string(buf[:n]), "_googlecast") {
+			return
+		}
+		instance := "Chromecast-1234." + castService
+		port := binary.BigEndian.AppendUint16([]byte{0, 0, 0, 0}, 8009)
+		txt := []byte("\x06fn=Den\x07id=1234\x0dmd=Chromecast")
+		msg := appendDNSHeader(nil, 0, 0x8400, 0, 4)
+		msg = appendDNSRecord(msg, dnsRecord{Name: castService, Type: dnsTypePTR, Data: appendDNSName(nil, instance)})
+		msg = appendDNSRecord(msg, dnsRecord{Name: instance, Type: dnsTypeSRV, Data: appendDNSName(port, "cc-1234.local.")})
+		msg = appendDNSRecord(msg, dnsRecord{Name: instance, Type: dnsTypeTXT, Data: txt})
+		msg = appendDNSRecord(msg, dnsRecord{Name: "cc-1234.local.", Type: dnsTypeA, Data: []byte{192, 168, 1, 50}})
+		conn.WriteToUDP(msg, from)
+	}()
+
+	services, err := browseMDNS(context.Background(), conn.LocalAddr().(*net.UDPAddr), castService, 500*time.Millisecond)
+	if err != nil || len(services) != 1 {
+		t.Fatalf("browseMDNS = %+v, %v", services, err)
+	}
+	tv := castTV(services[0])
+	if tv.Name != "Den" || tv.UDN != "uuid:1234" || tv.ModelName != "Chromecast" || tv.ControlURL != "cast://192.168.1.50:8009" {
+		t.Errorf("Unexpected TV: %+v", tv)
+	}
+}
+
+func TestReadDNSName(t *testing.T) {
+	// "b.local." followed by "a" pointing back at it
+	msg := []byte{1, 'b', 5, 'l', 'o', 'c', 'a', 'l', 0, 1, 'a', 0xC0, 0}
+	name, next, err := readDNSName(msg, 9)
+	if err != nil || name != "a.b.local." || next != len(msg) {
+		t.Errorf("readDNSName = %q, %d, %v", name, next, err)
+	}
+	if _, _, err := readDNSName([]byte{0xC0, 0}, 0); err == nil {
+		t.Error("Compression loop not detected")
+	}
+}
@@ -0,0 +1,106 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// windows1252 maps the bytes 0x80-0x9F of Windows-1252, where it differs
+// from ISO-8859-1 (0 = unassigned)
+var windows1252 = [32]rune{
+	0x20AC, 0, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017D, 0,
+	0, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0, 0x017E, 0x0178,
+}
+
+// sjisTable is sjisRows split into runes, built on first use
+var sjisTable = sync.OnceValue(func() *[256][]rune {
+	var table [256][]rune
+	for lead, row := range sjisRows {
+		if row != "" {
+			table[lead] = []rune(row)
+		}
+	}
+	return &table
+})
+
+// charsetReader converts XML documents declaring a charset other than
+// UTF-8 in their prolog, so names such as "リビングのテレビ" or "Télé du
+// salon" don't turn into mojibake. It knows ISO-8859-1, Windows-1252,
+// Shift_JIS (as Windows-31J) and US-ASCII.
+func charsetReader(label string, input io.Reader) (io.Reader, error) {
+	var decode func([]byte) []byte
+	switch strings.ToLower(strings.TrimSpace(label)) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		decode = func(data []byte) []byte { return bytes.ToValidUTF8(data, []byte("\uFFFD")) }
+	case "iso-8859-1", "iso8859-1", "iso_8859-1", "latin1", "latin-1", "l1":
+		decode = func(data []byte) []byte { return decodeSingleByte(data, false) }
+	case "windows-1252", "cp1252", "x-cp1252":
+		decode = func(data []byte) []byte { return decodeSingleByte(data, true) }
+	case "shift_jis", "shift-jis", "sjis", "x-sjis", "ms_kanji", "windows-31j", "cp932":
+		decode = decodeShiftJIS
+	default:
+		return nil, fmt.Errorf("unsupported charset %q", label)
+	}
+
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(decode(data)), nil
+}
+
+// decodeSingleByte converts ISO-8859-1, or Windows-1252 if cp1252 is set,
+// to UTF-8
+func decodeSingleByte(data []byte, cp1252 bool) []byte {
+	out := make([]byte, 0, len(data)+len(data)/4)
+	for _, b := range data {
+		r := rune(b)
+		if cp1252 && b >= 0x80 && b < 0xA0 {
+			if r = windows1252[b-0x80]; r == 0 {
+				r = utf8.RuneError
+			}
+		}
+		out = utf8.AppendRune(out, r)
+	}
+	return out
+}
+
+// decodeShiftJIS converts Shift_JIS to UTF-8. Invalid and unassigned codes
+// become U+FFFD.
+func decodeShiftJIS(data []byte) []byte {
+	table := sjisTable()
+	out := make([]byte, 0, len(data)*3/2)
+	for i := 0; i < len(data); i++ {
+		b := data[i]
+		switch {
+		case b < 0x80:
+			out = append(out, b)
+		case b >= 0xA1 && b <= 0xDF:
+			// Half-width katakana
+			out = utf8.AppendRune(out, 0xFF61+rune(b-0xA1))
+		case table[b] != nil && i+1 < len(data):
+			t := data[i+1]
+			var cell int
+			switch {
+			case t >= 0x40 && t <= 0x7E:
+				cell = int(t - 0x40)
+			case t >= 0x80 && t <= 0xFC:
+				cell = int(t - 0x41)
+			default:
+				out = utf8.AppendRune(out, utf8.RuneError)
+				continue
+			}
+			out = utf8.AppendRune(out, table[b][cell])
+			i++
+		default:
+			out = utf8.AppendRune(out, utf8.RuneError)
+		}
+	}
+	return out
+}
@@ -0,0 +1,41 @@
+package nimsforestsmarttv
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDescriptionCharsets(t *testing.T) {
+	tests := []struct {
+		charset string
+		name    string // Encoded in charset
+		want    string
+	}{
+		{"Shift_JIS", "\x83\x8a\x83\x72\x83\x93\x83\x4f\x82\xcc\x83\x65\x83\x8c\x83\x72", "リビングのテレビ"},
+		{"shift_jis", "\xb6\xd7\xb0\x87\x40", "ｶﾗｰ①"}, // Half-width katakana and an NEC extension
+		{"ISO-8859-1", "T\xe9l\xe9 du salon", "Télé du salon"},
+		{"windows-1252", "\x80 TV \x96 Caf\xe9", "€ TV – Café"},
+	}
+	for _, tt := range tests {
+		desc := strings.NewReplacer(
+			`<?xml version="1.0"?>`, `<?xml version="1.0" encoding="`+tt.charset+`"?>`,
+			"TV Salon", tt.name,
+		).Replace(testDescription)
+
+		for _, lenient := range []bool{false, true} {
+			tv, err := parseDeviceDescription(strings.NewReader(desc), "http://192.168.1.20:9197/dmr", lenient)
+			if err != nil {
+				t.Fatalf("%s (lenient %v): %v", tt.charset, lenient, err)
+			}
+			if tv.Name != tt.want {
+				t.Errorf("%s (lenient %v): name %q, want %q", tt.charset, lenient, tv.Name, tt.want)
+			}
+		}
+	}
+
+	// Strict parsing still rejects charsets it can't convert
+	desc := strings.Replace(testDescription, `<?xml version="1.0"?>`, `<?xml version="1.0" encoding="KOI8-R"?>`, 1)
+	if _, err := parseDeviceDescription(strings.NewReader(desc), "http://192.168.1.20:9197/dmr", false); err == nil {
+		t.Error("Expected an error for an unsupported charset")
+	}
+}
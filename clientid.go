@@ -0,0 +1,68 @@
+package nimsforestsmarttv
+
+import (
+	"slices"
+	"time"
+)
+
+// WithClientResolver identifies the TV behind a client IP, so access log
+// entries and fetches name the TV that made them, e.g.
+// WithClientResolver(reg.LookupIP). Resolvers are tried in order; a
+// Renderer adds one for the TVs it has sent content to.
+func WithClientResolver(fn func(ip string) (*TV, bool)) ServerOption {
+	return func(s *ImageServer) {
+		s.resolvers = append(s.resolvers, fn)
+	}
+}
+
+// resolveClient returns the TV at a client IP (nil if unknown)
+func (s *ImageServer) resolveClient(ip string) *TV {
+	for _, resolve := range s.resolvers {
+		if tv, ok := resolve(ip); ok {
+			return tv
+		}
+	}
+	return nil
+}
+
+// hasIP reports whether ip is one of the TV's addresses
+func (tv *TV) hasIP(ip string) bool {
+	return ip != "" && (tv.IP == ip || slices.Contains(tv.Addresses, ip))
+}
+
+// LookupIP finds a TV by any of its IP addresses
+func (reg *Registry) LookupIP(ip string) (*TV, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	for _, tv := range reg.tvs {
+		if tv.hasIP(ip) {
+			return tv, true
+		}
+	}
+	return nil, false
+}
+
+// knownTV finds a TV the renderer is showing or sending content to by IP
+func (r *Renderer) knownTV(ip string) (*TV, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, waiting := range r.pending {
+		for _, p := range waiting {
+			if p.tv.hasIP(ip) {
+				return p.tv, true
+			}
+		}
+	}
+	for _, state := range r.sessions {
+		if state.TV.hasIP(ip) {
+			return state.TV, true
+		}
+	}
+	return nil, false
+}
+
+// FetchObserver is an optional extension of Metrics that receives every
+// image fetch with the TV that made it (nil if unknown)
+type FetchObserver interface {
+	ObserveFetch(tv *TV, clientIP string, bytes int64, d time.Duration)
+}
@@ -0,0 +1,104 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fetchRecorder is a Metrics that also observes fetches
+type fetchRecorder struct {
+	metricsRecorder
+	fetchedBy []*TV
+}
+
+func (m *fetchRecorder) ObserveFetch(tv *TV, clientIP string, bytes int64, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fetchedBy = append(m.fetchedBy, tv)
+}
+
+// TestClientIdentity tests that fetches are attributed to the TV at the
+// client's address
+func TestClientIdentity(t *testing.T) {
+	imageURL := regexp.MustCompile(`<CurrentURI>([^<]+)</CurrentURI>`)
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if m := imageURL.FindSubmatch(body); m != nil {
+			if resp, err := http.Get(string(m[1])); err == nil {
+				resp.Body.Close()
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	var mu sync.Mutex
+	var entries []AccessEntry
+	metrics := &fetchRecorder{}
+	reg := NewRegistry()
+
+	renderer, err := NewRenderer(
+		WithMetrics(metrics),
+		WithServerOptions(
+			WithClientResolver(reg.LookupIP),
+			WithAccessLogger(func(e AccessEntry) {
+				mu.Lock()
+				defer mu.Unlock()
+				entries = append(entries, e)
+			}),
+		),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	// The mock TV fetches from the server's own address
+	reg.AddTV(TV{Name: "Lobby", IP: "192.0.2.1", Addresses: []string{"192.0.2.1", renderer.server.localIP}, ControlURL: mockTV.URL})
+	tv, _ := reg.Lookup("Lobby")
+
+	if err := renderer.DisplayImage(context.Background(), tv, image.NewRGBA(image.Rect(0, 0, 16, 9))); err != nil {
+		t.Fatalf("DisplayImage failed: %v", err)
+	}
+
+	info, ok := renderer.LastFrame(tv)
+	if !ok || info.FetchedTV != tv {
+		t.Errorf("FetchedTV = %v, want %s", info.FetchedTV, tv.Name)
+	}
+
+	mu.Lock()
+	if len(entries) != 1 || entries[0].TV != tv {
+		t.Errorf("access entries = %+v, want one by %s", entries, tv.Name)
+	}
+	mu.Unlock()
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if len(metrics.fetchedBy) != 1 || metrics.fetchedBy[0] != tv {
+		t.Errorf("observed fetches = %v, want one by %s", metrics.fetchedBy, tv.Name)
+	}
+}
+
+func TestRendererKnownTV(t *testing.T) {
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	tv := &TV{Name: "Office", IP: "192.0.2.7", ControlURL: "http://192.0.2.7:1/ctl"}
+	if _, ok := renderer.knownTV(tv.IP); ok {
+		t.Fatal("TV known before anything was sent to it")
+	}
+	renderer.recordSession(context.Background(), tv, "image")
+	if got := renderer.server.resolveClient(tv.IP); got != tv {
+		t.Errorf("resolveClient = %v, want %s", got, tv.Name)
+	}
+}
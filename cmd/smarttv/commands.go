@@ -0,0 +1,1104 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	smarttv "github.com/nimsforest/nimsforestsmarttv"
+	"github.com/nimsforest/nimsforestsmarttv/samsung"
+	"github.com/nimsforest/nimsforestsmarttv/webos"
+)
+
+const usage = `Usage:
+  smarttv                                 Interactive mode
+  smarttv discover                        Scan for TVs and remember them
+  smarttv add (IP | URL)                  Remember a TV discovery can't reach
+  smarttv list                            List remembered TVs and zones
+  smarttv text [--tv NAME | --zone ZONE] [--color C] [--bg C] TEXT
+  smarttv image [--tv NAME | --zone ZONE] (--stdin | FILE | URL)
+  smarttv watch [--tv NAME | --zone ZONE] [--interval D] [--endpoint URL] (DIR | s3://BUCKET/PREFIX)
+                                          Show images saved to DIR or uploaded to a bucket
+  smarttv receive [--tv NAME | --zone ZONE] [--addr ADDR] [--token T] [--fps N]
+                  [--relay URL [--relay-token T] [--relay-name NAME]]
+                  [--name NAME | --no-advertise]
+                                          Show frames pushed by a remote producer,
+                                          directly or through a relay
+  smarttv serve [--addr ADDR] [--name NAME | --no-advertise]
+                [--relay URL [--relay-token T] [--relay-name NAME]]
+                [--audit DIR [--audit-format json|csv] [--audit-rotate D] [--audit-max-size BYTES]]
+                                          Serve a web UI for phones on the home network,
+                                          and through a relay
+  smarttv announce [--tv NAME | --zone ZONE] [--lufs N | --raw] FILE
+                                          Play an audio clip at a consistent loudness
+  smarttv stop [--tv NAME | --zone ZONE]
+  smarttv key [--tv NAME | --zone ZONE] KEY...
+  smarttv type [--tv NAME | --zone ZONE] TEXT
+  smarttv app [--tv NAME | --zone ZONE] APP_ID
+                                          Launch an app (Roku and Samsung TVs)
+  smarttv virtual [--name NAME] [--addr ADDR] [--dir DIR] [--browser]
+                                          Run a virtual TV in this terminal
+  smarttv kiosk [--name NAME] [--addr ADDR] [--browser CMD | --fb DEVICE]
+                                          Show content on this host's screen
+  smarttv explore [--json] (IP | URL) [SERVICE ACTION [ARG=VALUE...]]
+                                          Show a device's UPnP services or call an action
+  smarttv zone set ZONE TV...             Create or replace a zone
+  smarttv zone rm ZONE                    Delete a zone
+  smarttv zone tz ZONE TIMEZONE           Set a zone's time zone (e.g. Europe/Berlin)
+  smarttv version                         Show version and features
+`
+
+// openRegistry loads the default registry. With SMARTTV_KEY_FILE set,
+// pairing tokens are kept encrypted with the hex-encoded AES key in that
+// file (e.g. made with "openssl rand -hex 32") in credentials.enc next to
+// the registry, and moved out of registry.json on the next save.
+func openRegistry() (*smarttv.Registry, error) {
+	path, err := smarttv.DefaultRegistryPath()
+	if err != nil {
+		return nil, err
+	}
+	reg, err := smarttv.LoadRegistry(path)
+	if err != nil {
+		return nil, err
+	}
+
+	keyFile := os.Getenv("SMARTTV_KEY_FILE")
+	if keyFile == "" {
+		return reg, nil
+	}
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("key file %s: not a hex-encoded key", keyFile)
+	}
+	store, err := smarttv.NewFileCredentialStore(filepath.Join(filepath.Dir(path), "credentials.enc"), key)
+	if err != nil {
+		return nil, err
+	}
+	if err := reg.SetCredentialStore(store); err != nil {
+		return nil, err
+	}
+	return reg, reg.Save()
+}
+
+// runCommand executes a single non-interactive subcommand
+func runCommand(ctx context.Context, args []string) error {
+	reg, err := openRegistry()
+	if err != nil {
+		return err
+	}
+	config.ApplyTo(reg)
+
+	switch args[0] {
+	case "discover":
+		tvs := discoverTVs(ctx)
+		for _, tv := range tvs {
+			reg.AddTV(tv)
+		}
+		return reg.Save()
+
+	case "add":
+		return runAdd(ctx, reg, args[1:])
+
+	case "list":
+		return listRegistry(reg)
+
+	case "text":
+		return runText(ctx, reg, args[1:])
+
+	case "image":
+		return runImage(ctx, reg, args[1:])
+
+	case "watch":
+		return runWatch(ctx, reg, args[1:])
+
+	case "receive":
+		return runReceive(ctx, reg, args[1:])
+
+	case "serve":
+		return runServe(ctx, reg, args[1:])
+
+	case "announce":
+		return runAnnounce(ctx, reg, args[1:])
+
+	case "stop":
+		return runStop(ctx, reg, args[1:])
+
+	case "key":
+		return runKey(ctx, reg, args[1:])
+
+	case "type":
+		return runType(ctx, reg, args[1:])
+
+	case "app":
+		return runApp(ctx, reg, args[1:])
+
+	case "zone":
+		return runZone(reg, args[1:])
+
+	case "explore":
+		return runExplore(ctx, args[1:])
+
+	case "virtual":
+		return runVirtual(ctx, reg, args[1:])
+
+	case "kiosk":
+		return runKiosk(ctx, reg, args[1:])
+
+	case "version", "--version":
+		fmt.Println("smarttv", smarttv.Build())
+		features := smarttv.Features()
+		names := make([]string, len(features))
+		for i, f := range features {
+			names[i] = string(f)
+		}
+		fmt.Println("features:", strings.Join(names, " "))
+		return nil
+
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return nil
+
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+}
+
+// targetFlags registers the --tv and --zone flags shared by display commands
+func targetFlags(fs *flag.FlagSet) (tv *string, zone *string) {
+	tv = fs.String("tv", "", "TV name, slug or UDN")
+	zone = fs.String("zone", "", "zone name")
+	return tv, zone
+}
+
+func runText(ctx context.Context, reg *smarttv.Registry, args []string) error {
+	fs := flag.NewFlagSet("text", flag.ContinueOnError)
+	tvName, zone := targetFlags(fs)
+	fg := fs.String("color", "", "text color (name or #rrggbb, default from config)")
+	bg := fs.String("bg", "", "background color (name or #rrggbb, default from config)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	text := strings.Join(fs.Args(), " ")
+	if text == "" {
+		return errors.New("no text given")
+	}
+
+	opts, err := config.TextOptions()
+	if err != nil {
+		return err
+	}
+	if *fg != "" {
+		if opts.Color, err = smarttv.ParseColor(*fg); err != nil {
+			return err
+		}
+	}
+	if *bg != "" {
+		if opts.Background, err = smarttv.ParseColor(*bg); err != nil {
+			return err
+		}
+	}
+
+	tvs, err := resolveTargets(ctx, reg, *tvName, *zone)
+	if err != nil {
+		return err
+	}
+
+	fetches, track := trackFetches()
+	renderer, err := smarttv.NewRenderer(append(config.RendererOptions(), smarttv.WithTextOptions(opts), track)...)
+	if err != nil {
+		return fmt.Errorf("create renderer: %w", err)
+	}
+	defer renderer.Close()
+
+	if err := renderer.DisplayTextAll(ctx, tvs, text); err != nil {
+		return err
+	}
+
+	fetches.wait(ctx, tvs, false)
+	return nil
+}
+
+func runAnnounce(ctx context.Context, reg *smarttv.Registry, args []string) error {
+	fs := flag.NewFlagSet("announce", flag.ContinueOnError)
+	tvName, zone := targetFlags(fs)
+	lufs := fs.Float64("lufs", smarttv.DefaultLoudness, "loudness WAV clips are normalized to")
+	raw := fs.Bool("raw", false, "play the clip as it is")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("give an audio file")
+	}
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	tvs, err := resolveTargets(ctx, reg, *tvName, *zone)
+	if err != nil {
+		return err
+	}
+
+	fetches, track := trackFetches()
+	opts := append(config.RendererOptions(), track)
+	if !*raw {
+		opts = append(opts, smarttv.WithAudioNormalization(*lufs))
+	}
+	renderer, err := smarttv.NewRenderer(opts...)
+	if err != nil {
+		return fmt.Errorf("create renderer: %w", err)
+	}
+	defer renderer.Close()
+
+	err = renderer.Broadcast(ctx, tvs, func(ctx context.Context, tv *smarttv.TV) error {
+		return renderer.PlayAudio(ctx, tv, data, "")
+	})
+	if err != nil {
+		return err
+	}
+
+	fetches.wait(ctx, tvs, true)
+	return nil
+}
+
+func runImage(ctx context.Context, reg *smarttv.Registry, args []string) error {
+	fs := flag.NewFlagSet("image", flag.ContinueOnError)
+	tvName, zone := targetFlags(fs)
+	stdin := fs.Bool("stdin", false, "read a raw or base64 image from stdin")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var in io.Reader
+	var imageURL string
+	switch {
+	case fs.NArg() == 1 && (strings.HasPrefix(fs.Arg(0), "http://") || strings.HasPrefix(fs.Arg(0), "https://")):
+		imageURL = fs.Arg(0)
+	case *stdin:
+		in = os.Stdin
+	case fs.NArg() == 1:
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	default:
+		return errors.New("give an image file, URL or --stdin")
+	}
+
+	var data []byte
+	var contentType string
+	if in != nil {
+		var err error
+		if data, contentType, err = smarttv.ReadImagePayload(in); err != nil {
+			return err
+		}
+	}
+
+	tvs, err := resolveTargets(ctx, reg, *tvName, *zone)
+	if err != nil {
+		return err
+	}
+
+	fetches, track := trackFetches()
+	renderer, err := smarttv.NewRenderer(append(config.RendererOptions(), track)...)
+	if err != nil {
+		return fmt.Errorf("create renderer: %w", err)
+	}
+	defer renderer.Close()
+
+	err = renderer.Broadcast(ctx, tvs, func(ctx context.Context, tv *smarttv.TV) error {
+		if imageURL != "" {
+			return renderer.DisplayImageURL(ctx, tv, imageURL)
+		}
+		return renderer.DisplayImageData(ctx, tv, data, contentType)
+	})
+	if err != nil {
+		return err
+	}
+
+	fetches.wait(ctx, tvs, false)
+	return nil
+}
+
+func runStop(ctx context.Context, reg *smarttv.Registry, args []string) error {
+	fs := flag.NewFlagSet("stop", flag.ContinueOnError)
+	tvName, zone := targetFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	tvs, err := resolveTargets(ctx, reg, *tvName, *zone)
+	if err != nil {
+		return err
+	}
+
+	renderer, err := smarttv.NewRenderer(config.RendererOptions()...)
+	if err != nil {
+		return fmt.Errorf("create renderer: %w", err)
+	}
+	defer renderer.Close()
+
+	return renderer.StopAll(ctx, tvs)
+}
+
+func runKey(ctx context.Context, reg *smarttv.Registry, args []string) error {
+	fs := flag.NewFlagSet("key", flag.ContinueOnError)
+	tvName, zone := targetFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("no key given")
+	}
+
+	tvs, err := resolveTargets(ctx, reg, *tvName, *zone)
+	if err != nil {
+		return err
+	}
+	if err := attachRemotes(ctx, reg, tvs); err != nil {
+		return err
+	}
+
+	for _, key := range fs.Args() {
+		for _, tv := range tvs {
+			if err := tv.SendKey(ctx, smarttv.Key(strings.ToLower(key))); err != nil {
+				return fmt.Errorf("%s: %w", tv.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func runApp(ctx context.Context, reg *smarttv.Registry, args []string) error {
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	tvName, zone := targetFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("give one app ID")
+	}
+
+	tvs, err := resolveTargets(ctx, reg, *tvName, *zone)
+	if err != nil {
+		return err
+	}
+	if err := attachRemotes(ctx, reg, tvs); err != nil {
+		return err
+	}
+
+	for _, tv := range tvs {
+		if err := tv.LaunchApp(ctx, fs.Arg(0)); err != nil {
+			return fmt.Errorf("%s: %w", tv.Name, err)
+		}
+	}
+	return nil
+}
+
+// attachRemotes attaches vendor remote controls to the TVs that need one
+// for keys, text and apps (Samsung, LG), pairing on first use
+func attachRemotes(ctx context.Context, reg *smarttv.Registry, tvs []*smarttv.TV) error {
+	for _, tv := range tvs {
+		if _, err := samsung.Attach(ctx, reg, tv, confirmOnTV); err != nil {
+			return fmt.Errorf("%s: %w", tv.Name, err)
+		}
+		if _, err := webos.Attach(ctx, reg, tv, confirmOnTV); err != nil {
+			return fmt.Errorf("%s: %w", tv.Name, err)
+		}
+	}
+	return nil
+}
+
+// confirmOnTV tells the user to accept a pairing request on the TV, which
+// is waited for anyway
+func confirmOnTV(ctx context.Context, p smarttv.Prompt) (string, error) {
+	fmt.Fprintln(os.Stderr, p.Message)
+	return "", nil
+}
+
+func runType(ctx context.Context, reg *smarttv.Registry, args []string) error {
+	fs := flag.NewFlagSet("type", flag.ContinueOnError)
+	tvName, zone := targetFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	text := strings.Join(fs.Args(), " ")
+	if text == "" {
+		return errors.New("no text given")
+	}
+
+	tvs, err := resolveTargets(ctx, reg, *tvName, *zone)
+	if err != nil {
+		return err
+	}
+	if err := attachRemotes(ctx, reg, tvs); err != nil {
+		return err
+	}
+
+	for _, tv := range tvs {
+		if err := tv.TypeText(ctx, text); err != nil {
+			return fmt.Errorf("%s: %w", tv.Name, err)
+		}
+	}
+	return nil
+}
+
+func runVirtual(ctx context.Context, reg *smarttv.Registry, args []string) error {
+	fs := flag.NewFlagSet("virtual", flag.ContinueOnError)
+	name := fs.String("name", "Virtual TV", "friendly name")
+	addr := fs.String("addr", ":8095", "listen address")
+	dir := fs.String("dir", "", "write every frame to this directory")
+	browser := fs.Bool("browser", false, "let the browser showing the page play the media")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := []smarttv.VirtualTVOption{smarttv.WithListenAddr(*addr)}
+	if *dir != "" {
+		opts = append(opts, smarttv.WithFrameDir(*dir))
+	}
+	if *browser {
+		opts = append(opts, smarttv.WithBrowserPlayback())
+	}
+	vtv, err := smarttv.NewVirtualTV(*name, opts...)
+	if err != nil {
+		return err
+	}
+	defer vtv.Close()
+
+	// Remember it so other commands can target it with --tv
+	reg.AddTV(*vtv.TV())
+	if err := reg.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s is running, open %s to watch it (Ctrl+C to stop)\n", *name, vtv.URL())
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-vtv.Done():
+		return vtv.Err()
+	}
+}
+
+func runWatch(ctx context.Context, reg *smarttv.Registry, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	tvName, zone := targetFlags(fs)
+	interval := fs.Duration("interval", 0, "how often to look for new files (default 1s, 10s for buckets)")
+	endpoint := fs.String("endpoint", "", "S3 compatible server, e.g. http://minio:9000 (default AWS)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("give a directory or s3://BUCKET/PREFIX to watch")
+	}
+	dir := fs.Arg(0)
+
+	tvs, err := resolveTargets(ctx, reg, *tvName, *zone)
+	if err != nil {
+		return err
+	}
+
+	renderer, err := smarttv.NewRenderer(config.RendererOptions()...)
+	if err != nil {
+		return fmt.Errorf("create renderer: %w", err)
+	}
+	defer renderer.Close()
+
+	report := func(name string, err error) {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			return
+		}
+		fmt.Println("Showing", name)
+	}
+
+	var run func(ctx context.Context) error
+	if bucket, ok := strings.CutPrefix(dir, "s3://"); ok {
+		// Credentials as for the AWS CLI
+		source := smarttv.S3Source{
+			Endpoint:  *endpoint,
+			Region:    os.Getenv("AWS_REGION"),
+			AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			PathStyle: *endpoint != "",
+		}
+		source.Bucket, source.Prefix, _ = strings.Cut(bucket, "/")
+		watcher := smarttv.NewS3Watcher(renderer, source, tvs, *interval)
+		watcher.OnDisplay(report)
+		run = watcher.Run
+	} else {
+		watcher := smarttv.NewFolderWatcher(renderer, dir, tvs, *interval)
+		watcher.OnDisplay(report)
+		run = watcher.Run
+	}
+
+	fmt.Printf("Watching %s (Ctrl+C to stop)\n", dir)
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	if err := run(ctx); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+func runReceive(ctx context.Context, reg *smarttv.Registry, args []string) error {
+	fs := flag.NewFlagSet("receive", flag.ContinueOnError)
+	tvName, zone := targetFlags(fs)
+	addr := fs.String("addr", ":8096", "listen address")
+	token := fs.String("token", os.Getenv("SMARTTV_UPLOAD_TOKEN"), "token producers must send (default $SMARTTV_UPLOAD_TOKEN)")
+	fps := fs.Float64("fps", 1, "most frames per second sent to the TVs")
+	relayURL := fs.String("relay", "", "also take frames through a tunnel to this relay")
+	relayToken := fs.String("relay-token", os.Getenv("SMARTTV_RELAY_TOKEN"), "token for the relay (default $SMARTTV_RELAY_TOKEN)")
+	relayName := fs.String("relay-name", "", "name at the relay (default the host name)")
+	advertiseName := fs.String("name", "", "name announced over mDNS (default the host name)")
+	noAdvertise := fs.Bool("no-advertise", false, "don't announce the receiver over mDNS")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *relayURL != "" && *relayToken == "" {
+		return fmt.Errorf("--relay needs --relay-token or $SMARTTV_RELAY_TOKEN")
+	}
+
+	tvs, err := resolveTargets(ctx, reg, *tvName, *zone)
+	if err != nil {
+		return err
+	}
+
+	renderer, err := smarttv.NewRenderer(config.RendererOptions()...)
+	if err != nil {
+		return fmt.Errorf("create renderer: %w", err)
+	}
+	defer renderer.Close()
+
+	receiver := smarttv.NewFrameReceiver(append(config.UploadOptions(), smarttv.WithUploadToken(*token))...)
+	mux := http.NewServeMux()
+	mux.Handle("/frames", receiver)
+	server := &http.Server{Addr: *addr, Handler: mux}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	defer server.Close()
+
+	// Every TV gets every frame; each drops what it can't keep up with
+	outs := make(map[*smarttv.TV]chan smarttv.StreamFrame, len(tvs))
+	for _, tv := range tvs {
+		outs[tv] = make(chan smarttv.StreamFrame, 1)
+	}
+	go func() {
+		for frame := range receiver.Frames() {
+			for _, out := range outs {
+				select {
+				case out <- frame:
+				default:
+				}
+			}
+		}
+		for _, out := range outs {
+			close(out)
+		}
+	}()
+
+	if *token == "" {
+		fmt.Fprintln(os.Stderr, "Warning: no --token, anyone on the network can push frames")
+	}
+	fmt.Printf("Receiving frames on %s/frames (Ctrl+C to stop)\n", *addr)
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	if *relayURL != "" {
+		tunnel, err := smarttv.NewTunnel(*relayURL, mux, smarttv.WithTunnelToken(*relayToken), smarttv.WithTunnelName(*relayName))
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := tunnel.Run(ctx); err != nil && ctx.Err() == nil {
+				select {
+				case serveErr <- fmt.Errorf("tunnel: %w", err):
+				default:
+				}
+			}
+		}()
+		fmt.Printf("Taking frames through %s\n", *relayURL)
+	}
+
+	// Let apps on the network find the receiver without its address
+	if !*noAdvertise {
+		advertise(ctx, *addr, *advertiseName, tvs, "/frames")
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+		case err := <-serveErr:
+			fmt.Fprintln(os.Stderr, err)
+			stop()
+		}
+		receiver.Close()
+	}()
+
+	err = renderer.Broadcast(ctx, tvs, func(ctx context.Context, tv *smarttv.TV) error {
+		return renderer.DisplayFrameStream(ctx, tv, outs[tv], smarttv.StreamOptions{MaxFPS: *fps})
+	})
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+func runAdd(ctx context.Context, reg *smarttv.Registry, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: smarttv add (IP | URL)")
+	}
+	var tv *smarttv.TV
+	var err error
+	if strings.Contains(args[0], "://") {
+		tv, err = smarttv.FromLocation(ctx, args[0])
+	} else {
+		tv, err = smarttv.FromIP(ctx, args[0])
+	}
+	if err != nil {
+		return err
+	}
+	config.ApplyQuirks(tv)
+	reg.AddTV(*tv)
+	if err := reg.Save(); err != nil {
+		return err
+	}
+	fmt.Println("Added", tv.String())
+	return nil
+}
+
+// advertise announces the daemon listening on addr over mDNS until ctx is
+// done, with path as the "path" TXT value
+func advertise(ctx context.Context, addr, name string, tvs []*smarttv.TV, path string) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	n, _ := strconv.Atoi(port)
+	adv := smarttv.NewAdvertiser(name, n)
+	adv.SetTVs(tvs)
+	adv.SetTXT("path", path)
+	go func() {
+		if err := adv.Run(ctx); err != nil && ctx.Err() == nil {
+			fmt.Fprintln(os.Stderr, "Not advertised over mDNS:", err)
+		}
+	}()
+}
+
+func runServe(ctx context.Context, reg *smarttv.Registry, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", ":8090", "listen address")
+	advertiseName := fs.String("name", "", "name announced over mDNS (default the host name)")
+	noAdvertise := fs.Bool("no-advertise", false, "don't announce the web UI over mDNS")
+	auditDir := fs.String("audit", "", "keep an audit trail of what is sent to the TVs in this directory")
+	auditFormat := fs.String("audit-format", "json", "audit file format: json or csv")
+	auditRotate := fs.Duration("audit-rotate", 24*time.Hour, "start a new audit file this often (0 = never)")
+	auditMaxSize := fs.Int64("audit-max-size", 0, "start a new audit file past this many bytes (0 = no limit)")
+	relayURL := fs.String("relay", "", "also serve the web UI through a tunnel to this relay")
+	relayToken := fs.String("relay-token", os.Getenv("SMARTTV_RELAY_TOKEN"), "token for the relay (default $SMARTTV_RELAY_TOKEN)")
+	relayName := fs.String("relay-name", "", "name at the relay (default the host name)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *relayURL != "" && *relayToken == "" {
+		return fmt.Errorf("--relay needs --relay-token or $SMARTTV_RELAY_TOKEN")
+	}
+	// Without users every client is an admin, which only the home network
+	// may be trusted with
+	if *relayURL != "" && len(config.WebUI.Users) == 0 {
+		return fmt.Errorf("--relay needs web_ui users in the config, or every relay client would be an admin")
+	}
+
+	opts := config.RendererOptions()
+	if *auditDir != "" {
+		audit, err := smarttv.OpenAuditLog(*auditDir,
+			smarttv.WithAuditFormat(smarttv.AuditFormat(*auditFormat)),
+			smarttv.WithAuditRotateEvery(*auditRotate),
+			smarttv.WithAuditMaxSize(*auditMaxSize))
+		if err != nil {
+			return err
+		}
+		defer audit.Close()
+		opts = append(opts, smarttv.WithAuditLog(audit))
+	}
+	renderer, err := smarttv.NewRenderer(opts...)
+	if err != nil {
+		return fmt.Errorf("create renderer: %w", err)
+	}
+	defer renderer.Close()
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	ui := smarttv.NewWebUI(renderer, reg, config.WebUIOptions()...)
+	server := &http.Server{Handler: ui}
+	defer server.Close()
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	if *relayURL != "" {
+		tunnel, err := smarttv.NewTunnel(*relayURL, ui, smarttv.WithTunnelToken(*relayToken), smarttv.WithTunnelName(*relayName))
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := tunnel.Run(ctx); err != nil && ctx.Err() == nil {
+				fmt.Fprintln(os.Stderr, "Tunnel:", err)
+				stop()
+			}
+		}()
+		fmt.Printf("Serving the web UI through %s\n", *relayURL)
+	}
+	if !*noAdvertise {
+		advertise(ctx, *addr, *advertiseName, reg.TVs(), "/")
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	if len(config.WebUI.Users) == 0 {
+		fmt.Fprintln(os.Stderr, "Warning: no web_ui users configured, anyone on the network is an admin")
+	}
+	fmt.Printf("Serving the web UI on %s (Ctrl+C to stop)\n", *addr)
+	if err := server.Serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func runKiosk(ctx context.Context, reg *smarttv.Registry, args []string) error {
+	fs := flag.NewFlagSet("kiosk", flag.ContinueOnError)
+	name := fs.String("name", "Kiosk", "friendly name")
+	addr := fs.String("addr", ":8095", "listen address")
+	browser := fs.String("browser", "", "browser to run (default chromium)")
+	fb := fs.String("fb", "", "write frames to this framebuffer device instead")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	kiosk, err := smarttv.NewKiosk(*name, smarttv.KioskOptions{
+		Browser:     *browser,
+		Framebuffer: *fb,
+		Addr:        *addr,
+	})
+	if err != nil {
+		return err
+	}
+	defer kiosk.Close()
+
+	reg.AddTV(*kiosk.TV())
+	if err := reg.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s is running (Ctrl+C to stop)\n", *name)
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-kiosk.Done():
+		return kiosk.Err()
+	}
+}
+
+func runExplore(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("explore", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print JSON for scripts")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 || fs.NArg() == 2 {
+		return errors.New("give an IP or description URL, optionally with SERVICE ACTION")
+	}
+
+	target := fs.Arg(0)
+	var devices []*smarttv.UPnPDevice
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		dev, err := smarttv.ExploreDevice(ctx, target)
+		if err != nil {
+			return err
+		}
+		devices = append(devices, dev)
+	} else {
+		var err error
+		if devices, err = smarttv.ExploreIP(ctx, target); err != nil {
+			return err
+		}
+	}
+
+	// Call an action on the first device offering the service
+	if fs.NArg() > 2 {
+		service, action := fs.Arg(1), fs.Arg(2)
+		callArgs := make(map[string]string)
+		for _, arg := range fs.Args()[3:] {
+			name, value, ok := strings.Cut(arg, "=")
+			if !ok {
+				return fmt.Errorf("argument %q is not NAME=VALUE", arg)
+			}
+			callArgs[name] = value
+		}
+		for _, dev := range devices {
+			if _, ok := dev.Service(service); !ok {
+				continue
+			}
+			out, err := dev.Call(ctx, service, action, callArgs)
+			if err != nil {
+				return err
+			}
+			if *asJSON {
+				return printJSON(out)
+			}
+			for name, value := range out {
+				fmt.Printf("%s=%s\n", name, value)
+			}
+			return nil
+		}
+		return fmt.Errorf("no %s service at %s", service, target)
+	}
+
+	if *asJSON {
+		return printJSON(devices)
+	}
+	for _, dev := range devices {
+		printDevice(dev, "")
+	}
+	return nil
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printDevice prints a device tree with its services, actions and state
+// variables
+func printDevice(dev *smarttv.UPnPDevice, indent string) {
+	fmt.Printf("%s%s (%s)\n", indent, dev.FriendlyName, dev.DeviceType)
+	if dev.Location != "" {
+		fmt.Printf("%s  %s\n", indent, dev.Location)
+	}
+	fmt.Printf("%s  %s %s %s\n", indent, dev.Manufacturer, dev.ModelName, dev.UDN)
+
+	for _, svc := range dev.Services {
+		fmt.Printf("%s  service %s\n", indent, svc.ServiceType)
+		fmt.Printf("%s    control %s\n", indent, svc.ControlURL)
+		if svc.Error != "" {
+			fmt.Printf("%s    (%s)\n", indent, svc.Error)
+		}
+		for _, action := range svc.Actions {
+			var params []string
+			for _, arg := range action.Arguments {
+				params = append(params, arg.Direction+" "+arg.Name)
+			}
+			fmt.Printf("%s    action %s(%s)\n", indent, action.Name, strings.Join(params, ", "))
+		}
+		for _, v := range svc.StateVariables {
+			line := v.Name + " " + v.DataType
+			if len(v.AllowedValues) > 0 {
+				line += " [" + strings.Join(v.AllowedValues, " ") + "]"
+			}
+			if v.Minimum != "" || v.Maximum != "" {
+				line += " " + v.Minimum + ".." + v.Maximum
+			}
+			if v.SendEvents {
+				line += " evented"
+			}
+			fmt.Printf("%s    state %s\n", indent, line)
+		}
+	}
+
+	for i := range dev.Devices {
+		printDevice(&dev.Devices[i], indent+"  ")
+	}
+}
+
+func runZone(reg *smarttv.Registry, args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: smarttv zone set ZONE TV... | smarttv zone rm ZONE | smarttv zone tz ZONE TIMEZONE")
+	}
+
+	switch args[0] {
+	case "set":
+		if len(args) < 3 {
+			return errors.New("zone needs at least one TV")
+		}
+		reg.SetZone(args[1], args[2:]...)
+		if _, err := reg.Zone(args[1]); err != nil {
+			return err
+		}
+	case "rm":
+		reg.RemoveZone(args[1])
+	case "tz":
+		if len(args) != 3 {
+			return errors.New("usage: smarttv zone tz ZONE TIMEZONE")
+		}
+		if err := reg.SetZoneTimeZone(args[1], args[2]); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown zone command: %s", args[0])
+	}
+
+	return reg.Save()
+}
+
+func listRegistry(reg *smarttv.Registry) error {
+	fmt.Println("TVs:")
+	for _, tv := range reg.TVs() {
+		fmt.Printf("  %-24s %s\n", tv.Slug, tv.String())
+	}
+
+	fmt.Println("Zones:")
+	for _, zone := range reg.Zones() {
+		members := strings.Join(zone.Members, ", ")
+		if zone.TimeZone != "" {
+			members += " (" + zone.TimeZone + ")"
+		}
+		fmt.Printf("  %s: %s\n", zone.Name, members)
+	}
+	return nil
+}
+
+// serveWait is the longest a one-shot command keeps serving content for TVs
+// that never fetch it completely or never finish playing it
+const serveWait = time.Minute
+
+// servePoll is how often a one-shot command checks whether it can exit
+const servePoll = 250 * time.Millisecond
+
+// fetchTracker remembers the clients that downloaded content completely
+// from a one-shot command's image server
+type fetchTracker struct {
+	mu      sync.Mutex
+	fetched map[string]bool // By client IP
+}
+
+// trackFetches returns a tracker and the renderer option reporting
+// downloads to it
+func trackFetches() (*fetchTracker, smarttv.Option) {
+	f := &fetchTracker{fetched: make(map[string]bool)}
+	return f, smarttv.WithServerOptions(smarttv.WithAccessLogger(func(e smarttv.AccessEntry) {
+		if e.Method != http.MethodGet || e.Status != http.StatusOK {
+			return
+		}
+		f.mu.Lock()
+		f.fetched[e.ClientIP] = true
+		f.mu.Unlock()
+	}))
+}
+
+// done reports whether tv downloaded its content. A TV answering from
+// another address counts once as many clients as TVs fetched.
+func (f *fetchTracker) done(tv *smarttv.TV, total int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fetched[tv.IP] || len(f.fetched) >= total
+}
+
+// wait keeps the command serving until every TV is done with its content:
+// it fetched it completely or, with untilStopped, its transport left
+// PLAYING after playing it (for TVs streaming a clip in ranges). TVs doing
+// neither within serveWait are given up on.
+func (f *fetchTracker) wait(ctx context.Context, tvs []*smarttv.TV, untilStopped bool) {
+	ctx, cancel := context.WithTimeout(ctx, serveWait)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, tv := range tvs {
+		wg.Go(func() {
+			played := false
+			for !f.done(tv, len(tvs)) {
+				if untilStopped && tv.SupportsAction("GetTransportInfo") {
+					if info, err := tv.GetTransportInfo(ctx); err == nil {
+						switch {
+						case info.State == "PLAYING" || info.State == "TRANSITIONING":
+							played = true
+						case played:
+							return
+						}
+					}
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(servePoll):
+				}
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// resolveTargets picks the TVs a command applies to. Unknown TV names
+// trigger a discovery whose results are remembered in the registry.
+func resolveTargets(ctx context.Context, reg *smarttv.Registry, tvName string, zone string) ([]*smarttv.TV, error) {
+	if zone != "" {
+		return reg.Zone(zone)
+	}
+
+	if tvName != "" {
+		if tv, ok := reg.Lookup(tvName); ok {
+			return []*smarttv.TV{tv}, nil
+		}
+	}
+
+	tvs := reg.TVs()
+	if tvName != "" || len(tvs) == 0 {
+		for _, tv := range discoverTVs(ctx) {
+			reg.AddTV(tv)
+		}
+		if err := reg.Save(); err != nil {
+			return nil, err
+		}
+		tvs = reg.TVs()
+	}
+
+	if tvName != "" {
+		tv, ok := reg.Lookup(tvName)
+		if !ok {
+			return nil, fmt.Errorf("TV not found: %s", tvName)
+		}
+		return []*smarttv.TV{tv}, nil
+	}
+
+	switch len(tvs) {
+	case 0:
+		return nil, errors.New("no TVs found")
+	case 1:
+		return tvs, nil
+	default:
+		return nil, errors.New("several TVs known, choose one with --tv or --zone")
+	}
+}
@@ -8,51 +8,83 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	smarttv "github.com/nimsforest/nimsforestsmarttv"
 )
 
 var scanner *bufio.Scanner
 
+// config holds the settings from the config file and SMARTTV_* variables
+var config smarttv.Config
+
 func main() {
 	ctx := context.Background()
+
+	var err error
+	if config, err = loadConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Screen and prompt texts follow the config, then the system locale
+	if config.Renderer.Language == "" {
+		config.Renderer.Language = smarttv.SystemLanguage()
+	}
+	catalog = messages.Lookup(config.Renderer.Language)
+
+	// Subcommands run once and exit; without arguments start interactive mode
+	if len(os.Args) > 1 {
+		if err := runCommand(ctx, os.Args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	runInteractive(ctx)
+}
+
+func runInteractive(ctx context.Context) {
 	scanner = bufio.NewScanner(os.Stdin)
 
-	fmt.Println("Smart TV Renderer")
-	fmt.Println("=================")
+	title := msg(msgTitle)
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("=", utf8.RuneCountInString(title)))
 	fmt.Println()
 
 	// Discover TVs
 	tvs := discoverTVs(ctx)
 	if len(tvs) == 0 {
-		fmt.Println("No TVs found. Use /discover to scan again.")
+		say(msgNoTVsRescan)
 	}
 
 	// Select TV
 	var selectedTV *smarttv.TV
 	if len(tvs) == 1 {
 		selectedTV = &tvs[0]
-		fmt.Printf("Selected: %s\n", selectedTV)
+		say(msgSelected, selectedTV)
 	} else if len(tvs) > 1 {
 		selectedTV = selectTV(tvs)
 	}
 
 	// Create renderer
-	renderer, err := smarttv.NewRenderer()
+	renderer, err := smarttv.NewRenderer(config.RendererOptions()...)
 	if err != nil {
-		fmt.Printf("Error creating renderer: %v\n", err)
+		say(msgRendererError, err)
 		os.Exit(1)
 	}
 	defer renderer.Close()
 
 	fmt.Println()
-	fmt.Println("Commands:")
-	fmt.Println("  /discover  - Scan for TVs")
-	fmt.Println("  /select    - Select a different TV")
-	fmt.Println("  /stop      - Stop displaying")
-	fmt.Println("  /quit      - Exit")
+	say(msgCommands)
+	fmt.Printf("  /discover  - %s\n", msg(msgCmdDiscover))
+	fmt.Printf("  /select    - %s\n", msg(msgCmdSelect))
+	fmt.Printf("  /stop      - %s\n", msg(msgCmdStop))
+	fmt.Printf("  /bandwidth - %s\n", msg(msgCmdBandwidth))
+	fmt.Printf("  /quit      - %s\n", msg(msgCmdQuit))
 	fmt.Println()
-	fmt.Println("Type any text to display it on the TV.")
+	say(msgTypeText)
 	fmt.Println()
 
 	// Interactive loop
@@ -69,62 +101,85 @@ func main() {
 
 		switch {
 		case input == "/quit" || input == "/exit" || input == "/q":
-			fmt.Println("Goodbye!")
+			say(msgGoodbye)
 			return
 
 		case input == "/discover":
 			tvs = discoverTVs(ctx)
 			if len(tvs) == 0 {
-				fmt.Println("No TVs found.")
+				say(msgNoTVs)
 			}
 
 		case input == "/select":
 			if len(tvs) == 0 {
-				fmt.Println("No TVs available. Use /discover first.")
+				say(msgNoTVsAvailable)
 				continue
 			}
 			selectedTV = selectTV(tvs)
 
 		case input == "/stop":
 			if selectedTV == nil {
-				fmt.Println("No TV selected. Use /select first.")
+				say(msgNoTVSelected)
 				continue
 			}
 			if err := renderer.Stop(ctx, selectedTV); err != nil {
-				fmt.Printf("Error: %v\n", err)
+				say(msgError, err)
 			} else {
-				fmt.Println("Stopped.")
+				say(msgStopped)
+			}
+
+		case input == "/bandwidth":
+			for _, tv := range tvs {
+				fmt.Println("  " + msg(msgBandwidth, tv.Name,
+					formatBytes(renderer.Bandwidth(&tv, time.Hour)), formatBytes(renderer.Bandwidth(&tv, 0))))
 			}
 
 		case strings.HasPrefix(input, "/"):
-			fmt.Printf("Unknown command: %s\n", input)
+			say(msgUnknownCommand, input)
 
 		default:
 			// Display text on TV
 			if selectedTV == nil {
-				fmt.Println("No TV selected. Use /select first.")
+				say(msgNoTVSelected)
 				continue
 			}
 
-			fmt.Printf("Sending to %s...\n", selectedTV.Name)
+			say(msgSending, selectedTV.Name)
 			if err := renderer.DisplayText(ctx, selectedTV, input); err != nil {
-				fmt.Printf("Error: %v\n", err)
+				say(msgError, err)
 			} else {
-				fmt.Println("Done!")
+				say(msgDone)
 			}
 		}
 	}
 }
 
+// loadConfig reads the config file named by SMARTTV_CONFIG, or the default
+// one, if it exists
+func loadConfig() (smarttv.Config, error) {
+	path := os.Getenv("SMARTTV_CONFIG")
+	if path == "" {
+		var err error
+		if path, err = smarttv.DefaultConfigPath(); err != nil {
+			return smarttv.Config{}, err
+		}
+	}
+	return smarttv.LoadConfig(path)
+}
+
 func discoverTVs(ctx context.Context) []smarttv.TV {
-	fmt.Println("Discovering TVs...")
-	tvs, err := smarttv.Discover(ctx, 5*time.Second)
-	if err != nil {
-		fmt.Printf("Discovery error: %v\n", err)
+	say(msgDiscovering)
+	result := smarttv.DiscoverPartial(ctx, config.DiscoverOptions())
+	if result.Err != nil {
+		say(msgDiscoveryError, result.Err)
 		return nil
 	}
+	tvs := result.TVs
+	for i := range tvs {
+		config.ApplyQuirks(&tvs[i])
+	}
 
-	fmt.Printf("Found %d TV(s):\n", len(tvs))
+	say(msgFound, len(tvs))
 	for i, tv := range tvs {
 		fmt.Printf("  [%d] %s\n", i+1, tv.String())
 	}
@@ -138,18 +193,18 @@ func selectTV(tvs []smarttv.TV) *smarttv.TV {
 	}
 
 	if len(tvs) == 1 {
-		fmt.Printf("Selected: %s\n", tvs[0].String())
+		say(msgSelected, tvs[0].String())
 		return &tvs[0]
 	}
 
 	fmt.Println()
-	fmt.Println("Select a TV:")
+	say(msgSelectTV)
 	for i, tv := range tvs {
 		fmt.Printf("  [%d] %s\n", i+1, tv.String())
 	}
 
 	for {
-		fmt.Print("Enter number: ")
+		fmt.Print(msg(msgEnterNumber))
 		if !scanner.Scan() {
 			return nil
 		}
@@ -157,12 +212,26 @@ func selectTV(tvs []smarttv.TV) *smarttv.TV {
 		input := strings.TrimSpace(scanner.Text())
 		num, err := strconv.Atoi(input)
 		if err != nil || num < 1 || num > len(tvs) {
-			fmt.Printf("Please enter a number between 1 and %d\n", len(tvs))
+			say(msgNumberOutOfRange, len(tvs))
 			continue
 		}
 
 		selected := &tvs[num-1]
-		fmt.Printf("Selected: %s\n", selected.String())
+		say(msgSelected, selected.String())
 		return selected
 	}
 }
+
+// formatBytes formats a byte count for humans (e.g. "12.3 MB")
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+
+	smarttv "github.com/nimsforest/nimsforestsmarttv"
+)
+
+// Interactive mode messages
+const (
+	msgTitle            smarttv.Message = "title"
+	msgCommands         smarttv.Message = "commands"
+	msgCmdDiscover      smarttv.Message = "cmd-discover"
+	msgCmdSelect        smarttv.Message = "cmd-select"
+	msgCmdStop          smarttv.Message = "cmd-stop"
+	msgCmdBandwidth     smarttv.Message = "cmd-bandwidth"
+	msgCmdQuit          smarttv.Message = "cmd-quit"
+	msgTypeText         smarttv.Message = "type-text"
+	msgGoodbye          smarttv.Message = "goodbye"
+	msgNoTVsRescan      smarttv.Message = "no-tvs-rescan"
+	msgNoTVs            smarttv.Message = "no-tvs"
+	msgNoTVsAvailable   smarttv.Message = "no-tvs-available"
+	msgNoTVSelected     smarttv.Message = "no-tv-selected"
+	msgError            smarttv.Message = "error"
+	msgRendererError    smarttv.Message = "renderer-error"
+	msgStopped          smarttv.Message = "stopped"
+	msgBandwidth        smarttv.Message = "bandwidth"
+	msgUnknownCommand   smarttv.Message = "unknown-command"
+	msgSending          smarttv.Message = "sending"
+	msgDone             smarttv.Message = "done"
+	msgDiscovering      smarttv.Message = "discovering"
+	msgDiscoveryError   smarttv.Message = "discovery-error"
+	msgFound            smarttv.Message = "found"
+	msgSelectTV         smarttv.Message = "select-tv"
+	msgSelected         smarttv.Message = "selected"
+	msgEnterNumber      smarttv.Message = "enter-number"
+	msgNumberOutOfRange smarttv.Message = "number-out-of-range"
+)
+
+// messages are the interactive mode catalogs
+var messages = smarttv.Catalogs{
+	"en": {
+		msgTitle:            "Smart TV Renderer",
+		msgCommands:         "Commands:",
+		msgCmdDiscover:      "Scan for TVs",
+		msgCmdSelect:        "Select a different TV",
+		msgCmdStop:          "Stop displaying",
+		msgCmdBandwidth:     "Show data sent to each TV",
+		msgCmdQuit:          "Exit",
+		msgTypeText:         "Type any text to display it on the TV.",
+		msgGoodbye:          "Goodbye!",
+		msgNoTVsRescan:      "No TVs found. Use /discover to scan again.",
+		msgNoTVs:            "No TVs found.",
+		msgNoTVsAvailable:   "No TVs available. Use /discover first.",
+		msgNoTVSelected:     "No TV selected. Use /select first.",
+		msgError:            "Error: %v",
+		msgRendererError:    "Error creating renderer: %v",
+		msgStopped:          "Stopped.",
+		msgBandwidth:        "%s: %s last hour, %s total",
+		msgUnknownCommand:   "Unknown command: %s",
+		msgSending:          "Sending to %s...",
+		msgDone:             "Done!",
+		msgDiscovering:      "Discovering TVs...",
+		msgDiscoveryError:   "Discovery error: %v",
+		msgFound:            "Found %d TV(s):",
+		msgSelectTV:         "Select a TV:",
+		msgSelected:         "Selected: %s",
+		msgEnterNumber:      "Enter number: ",
+		msgNumberOutOfRange: "Please enter a number between 1 and %d",
+	},
+	"de": {
+		msgCommands:         "Befehle:",
+		msgCmdDiscover:      "Nach Fernsehern suchen",
+		msgCmdSelect:        "Anderen Fernseher auswählen",
+		msgCmdStop:          "Anzeige beenden",
+		msgCmdBandwidth:     "An jeden Fernseher gesendete Daten",
+		msgCmdQuit:          "Beenden",
+		msgTypeText:         "Text eingeben, um ihn auf dem Fernseher anzuzeigen.",
+		msgGoodbye:          "Auf Wiedersehen!",
+		msgNoTVsRescan:      "Keine Fernseher gefunden. Mit /discover erneut suchen.",
+		msgNoTVs:            "Keine Fernseher gefunden.",
+		msgNoTVsAvailable:   "Keine Fernseher verfügbar. Zuerst /discover verwenden.",
+		msgNoTVSelected:     "Kein Fernseher ausgewählt. Zuerst /select verwenden.",
+		msgError:            "Fehler: %v",
+		msgRendererError:    "Fehler beim Erstellen des Renderers: %v",
+		msgStopped:          "Angehalten.",
+		msgBandwidth:        "%s: %s in der letzten Stunde, %s gesamt",
+		msgUnknownCommand:   "Unbekannter Befehl: %s",
+		msgSending:          "Sende an %s...",
+		msgDone:             "Fertig!",
+		msgDiscovering:      "Suche Fernseher...",
+		msgDiscoveryError:   "Fehler bei der Suche: %v",
+		msgFound:            "%d Fernseher gefunden:",
+		msgSelectTV:         "Fernseher auswählen:",
+		msgSelected:         "Ausgewählt: %s",
+		msgEnterNumber:      "Nummer eingeben: ",
+		msgNumberOutOfRange: "Bitte eine Zahl zwischen 1 und %d eingeben",
+	},
+	"es": {
+		msgCommands:         "Comandos:",
+		msgCmdDiscover:      "Buscar televisores",
+		msgCmdSelect:        "Elegir otro televisor",
+		msgCmdStop:          "Dejar de mostrar",
+		msgCmdBandwidth:     "Datos enviados a cada televisor",
+		msgCmdQuit:          "Salir",
+		msgTypeText:         "Escribe un texto para mostrarlo en el televisor.",
+		msgGoodbye:          "¡Adiós!",
+		msgNoTVsRescan:      "No se encontraron televisores. Usa /discover para buscar de nuevo.",
+		msgNoTVs:            "No se encontraron televisores.",
+		msgNoTVsAvailable:   "No hay televisores. Usa /discover primero.",
+		msgNoTVSelected:     "Ningún televisor elegido. Usa /select primero.",
+		msgError:            "Error: %v",
+		msgRendererError:    "Error al crear el renderizador: %v",
+		msgStopped:          "Detenido.",
+		msgBandwidth:        "%s: %s en la última hora, %s en total",
+		msgUnknownCommand:   "Comando desconocido: %s",
+		msgSending:          "Enviando a %s...",
+		msgDone:             "¡Hecho!",
+		msgDiscovering:      "Buscando televisores...",
+		msgDiscoveryError:   "Error de búsqueda: %v",
+		msgFound:            "%d televisor(es) encontrado(s):",
+		msgSelectTV:         "Elige un televisor:",
+		msgSelected:         "Elegido: %s",
+		msgEnterNumber:      "Número: ",
+		msgNumberOutOfRange: "Escribe un número entre 1 y %d",
+	},
+	"fr": {
+		msgCommands:         "Commandes :",
+		msgCmdDiscover:      "Rechercher des téléviseurs",
+		msgCmdSelect:        "Choisir un autre téléviseur",
+		msgCmdStop:          "Arrêter l'affichage",
+		msgCmdBandwidth:     "Données envoyées à chaque téléviseur",
+		msgCmdQuit:          "Quitter",
+		msgTypeText:         "Saisissez un texte pour l'afficher sur le téléviseur.",
+		msgGoodbye:          "Au revoir !",
+		msgNoTVsRescan:      "Aucun téléviseur trouvé. Utilisez /discover pour relancer la recherche.",
+		msgNoTVs:            "Aucun téléviseur trouvé.",
+		msgNoTVsAvailable:   "Aucun téléviseur disponible. Utilisez d'abord /discover.",
+		msgNoTVSelected:     "Aucun téléviseur choisi. Utilisez d'abord /select.",
+		msgError:            "Erreur : %v",
+		msgRendererError:    "Erreur de création du moteur de rendu : %v",
+		msgStopped:          "Arrêté.",
+		msgBandwidth:        "%s : %s la dernière heure, %s au total",
+		msgUnknownCommand:   "Commande inconnue : %s",
+		msgSending:          "Envoi vers %s...",
+		msgDone:             "Terminé !",
+		msgDiscovering:      "Recherche des téléviseurs...",
+		msgDiscoveryError:   "Erreur de recherche : %v",
+		msgFound:            "%d téléviseur(s) trouvé(s) :",
+		msgSelectTV:         "Choisissez un téléviseur :",
+		msgSelected:         "Choisi : %s",
+		msgEnterNumber:      "Numéro : ",
+		msgNumberOutOfRange: "Saisissez un nombre entre 1 et %d",
+	},
+	"nl": {
+		msgCommands:         "Opdrachten:",
+		msgCmdDiscover:      "Tv's zoeken",
+		msgCmdSelect:        "Andere tv kiezen",
+		msgCmdStop:          "Weergave stoppen",
+		msgCmdBandwidth:     "Data verzonden naar elke tv",
+		msgCmdQuit:          "Afsluiten",
+		msgTypeText:         "Typ tekst om die op de tv te tonen.",
+		msgGoodbye:          "Tot ziens!",
+		msgNoTVsRescan:      "Geen tv's gevonden. Gebruik /discover om opnieuw te zoeken.",
+		msgNoTVs:            "Geen tv's gevonden.",
+		msgNoTVsAvailable:   "Geen tv's beschikbaar. Gebruik eerst /discover.",
+		msgNoTVSelected:     "Geen tv gekozen. Gebruik eerst /select.",
+		msgError:            "Fout: %v",
+		msgRendererError:    "Fout bij het maken van de renderer: %v",
+		msgStopped:          "Gestopt.",
+		msgBandwidth:        "%s: %s afgelopen uur, %s totaal",
+		msgUnknownCommand:   "Onbekende opdracht: %s",
+		msgSending:          "Verzenden naar %s...",
+		msgDone:             "Klaar!",
+		msgDiscovering:      "Tv's zoeken...",
+		msgDiscoveryError:   "Fout bij zoeken: %v",
+		msgFound:            "%d tv('s) gevonden:",
+		msgSelectTV:         "Kies een tv:",
+		msgSelected:         "Gekozen: %s",
+		msgEnterNumber:      "Nummer: ",
+		msgNumberOutOfRange: "Voer een getal tussen 1 en %d in",
+	},
+}
+
+// catalog holds the interactive mode messages in the configured language
+var catalog = messages.Lookup("en")
+
+// msg returns a message in the configured language
+func msg(m smarttv.Message, args ...any) string {
+	return catalog.Text(m, args...)
+}
+
+// say prints a message in the configured language
+func say(m smarttv.Message, args ...any) {
+	fmt.Println(msg(m, args...))
+}
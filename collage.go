@@ -0,0 +1,142 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// ErrCollageSize is returned for collages with fewer than 1 or more than 6
+// photos
+var ErrCollageSize = errors.New("collage needs 1 to 6 photos")
+
+// Collage packs several photos into one frame, e.g. to rotate through a
+// large photo library without flashing single images rapidly
+type Collage struct {
+	Width      int         // Frame width (default 1920)
+	Height     int         // Frame height (default 1080)
+	Gutter     int         // Space between and around photos (default 16, -1 = none)
+	Background color.Color // Shows in the gutters (default black)
+	Resizer    Resizer     // Default BilinearResizer
+
+	// Detector keeps each photo's subject in its cell (nil = center crop)
+	Detector SubjectDetector
+}
+
+// collageLayout arranges cells in lines: rows of cells, or columns of
+// cells when vertical is set
+type collageLayout struct {
+	vertical bool
+	counts   []int // Cells per line
+}
+
+// collageLayouts are the layouts by number of photos
+var collageLayouts = map[int]collageLayout{
+	1: {counts: []int{1}},
+	2: {counts: []int{2}},
+	3: {vertical: true, counts: []int{1, 2}}, // One large photo, two stacked
+	4: {counts: []int{2, 2}},
+	5: {counts: []int{2, 3}},
+	6: {counts: []int{3, 3}},
+}
+
+// Cells returns the rectangles the photos of an n-photo collage fill
+func (c Collage) Cells(n int) ([]image.Rectangle, error) {
+	c = c.withDefaults()
+	layout, ok := collageLayouts[n]
+	if !ok {
+		return nil, fmt.Errorf("%w, got %d", ErrCollageSize, n)
+	}
+
+	g := c.Gutter
+	inner := image.Rect(g, g, c.Width-g, c.Height-g)
+
+	// Lines run across the main axis, cells along the cross axis
+	mainSize, crossSize := inner.Dy(), inner.Dx()
+	if layout.vertical {
+		mainSize, crossSize = crossSize, mainSize
+	}
+
+	var cells []image.Rectangle
+	lines := len(layout.counts)
+	for li, count := range layout.counts {
+		m0 := li * (mainSize + g) / lines
+		m1 := (li+1)*(mainSize+g)/lines - g
+		for ci := 0; ci < count; ci++ {
+			c0 := ci * (crossSize + g) / count
+			c1 := (ci+1)*(crossSize+g)/count - g
+			cell := image.Rect(c0, m0, c1, m1)
+			if layout.vertical {
+				cell = image.Rect(m0, c0, m1, c1)
+			}
+			cells = append(cells, cell.Add(inner.Min))
+		}
+	}
+	return cells, nil
+}
+
+// withDefaults returns the collage with zero fields set to defaults
+func (c Collage) withDefaults() Collage {
+	if c.Width <= 0 {
+		c.Width = 1920
+	}
+	if c.Height <= 0 {
+		c.Height = 1080
+	}
+	switch {
+	case c.Gutter == 0:
+		c.Gutter = 16
+	case c.Gutter < 0:
+		c.Gutter = 0
+	}
+	if c.Background == nil {
+		c.Background = Black
+	}
+	if c.Resizer == nil {
+		c.Resizer = BilinearResizer{}
+	}
+	return c
+}
+
+// Compose draws 1 to 6 photos into one frame. Each photo is cropped to fill
+// its cell.
+func (c Collage) Compose(photos ...image.Image) (image.Image, error) {
+	c = c.withDefaults()
+	cells, err := c.Cells(len(photos))
+	if err != nil {
+		return nil, err
+	}
+
+	frame := image.NewRGBA(image.Rect(0, 0, c.Width, c.Height))
+	draw.Draw(frame, frame.Bounds(), &image.Uniform{c.Background}, image.Point{}, draw.Src)
+
+	for i, photo := range photos {
+		cell := cells[i]
+		if cell.Empty() {
+			continue
+		}
+		src := SmartCrop(photo, cell.Dx(), cell.Dy(), c.Detector)
+		scaled := c.Resizer.Resize(photo, src, cell.Dx(), cell.Dy())
+		draw.Draw(frame, cell, scaled, scaled.Bounds().Min, draw.Src)
+	}
+	return frame, nil
+}
+
+// DisplayCollage composes photos with the collage settings and shows them
+// on the TV
+func (r *Renderer) DisplayCollage(ctx context.Context, tv *TV, c Collage, photos ...image.Image) error {
+	if c.Resizer == nil {
+		c.Resizer = r.resizer
+	}
+	if c.Detector == nil {
+		c.Detector = r.detector
+	}
+	frame, err := c.Compose(photos...)
+	if err != nil {
+		return err
+	}
+	return r.DisplayImage(ctx, tv, frame)
+}
@@ -0,0 +1,140 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingTV starts a mock TV and returns it with a function returning
+// the last URI it was told to show
+func recordingTV(t *testing.T) (*TV, func() string) {
+	t.Helper()
+	var mu sync.Mutex
+	var uri string
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(r.Header.Get("SOAPAction"), "#SetAVTransportURI") {
+			mu.Lock()
+			uri = soapArg(body, "CurrentURI")
+			mu.Unlock()
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(mockTV.Close)
+
+	return &TV{Name: "Test TV", ControlURL: mockTV.URL}, func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return uri
+	}
+}
+
+// fetchJPEG fetches and decodes the image a TV was pointed at
+func fetchJPEG(t *testing.T, uri string) image.Image {
+	t.Helper()
+	if uri == "" {
+		t.Fatal("Nothing reached the TV")
+	}
+	resp, err := http.Get(uri)
+	if err != nil {
+		t.Fatalf("Fetch %s: %v", uri, err)
+	}
+	defer resp.Body.Close()
+	img, err := jpeg.Decode(resp.Body)
+	if err != nil {
+		t.Fatalf("Decode %s: %v", uri, err)
+	}
+	return img
+}
+
+// TestCollageCells tests the cell layout for different photo counts
+func TestCollageCells(t *testing.T) {
+	c := Collage{Width: 100, Height: 50, Gutter: 10}
+
+	tests := []struct {
+		n    int
+		want []image.Rectangle
+	}{
+		{1, []image.Rectangle{image.Rect(10, 10, 90, 40)}},
+		{3, []image.Rectangle{image.Rect(10, 10, 45, 40), image.Rect(55, 10, 90, 20), image.Rect(55, 30, 90, 40)}},
+		{4, []image.Rectangle{image.Rect(10, 10, 45, 20), image.Rect(55, 10, 90, 20), image.Rect(10, 30, 45, 40), image.Rect(55, 30, 90, 40)}},
+	}
+
+	for _, tt := range tests {
+		cells, err := c.Cells(tt.n)
+		if err != nil {
+			t.Fatalf("Cells(%d) failed: %v", tt.n, err)
+		}
+		if len(cells) != len(tt.want) {
+			t.Fatalf("Cells(%d): expected %d cells, got %d", tt.n, len(tt.want), len(cells))
+		}
+		for i := range cells {
+			if cells[i] != tt.want[i] {
+				t.Errorf("Cells(%d)[%d] = %v, want %v", tt.n, i, cells[i], tt.want[i])
+			}
+		}
+	}
+
+	for _, n := range []int{0, 7} {
+		if _, err := c.Cells(n); !errors.Is(err, ErrCollageSize) {
+			t.Errorf("Cells(%d): expected ErrCollageSize, got %v", n, err)
+		}
+	}
+}
+
+// TestCollageCompose tests that photos fill their cells and gutters keep
+// the background
+func TestCollageCompose(t *testing.T) {
+	c := Collage{Width: 100, Height: 50, Gutter: 10, Background: Navy}
+	frame, err := c.Compose(solid(30, 40, Red), solid(400, 100, Yellow))
+	if err != nil {
+		t.Fatalf("Compose failed: %v", err)
+	}
+
+	at := func(x, y int) color.RGBA {
+		return color.RGBAModel.Convert(frame.At(x, y)).(color.RGBA)
+	}
+	if got := at(5, 5); got != Navy {
+		t.Errorf("Expected the background in the gutter, got %v", got)
+	}
+	if got := at(20, 25); got != Red {
+		t.Errorf("Expected the first photo on the left, got %v", got)
+	}
+	if got := at(80, 25); got != Yellow {
+		t.Errorf("Expected the second photo on the right, got %v", got)
+	}
+}
+
+// TestDisplayCollage tests that the composed collage reaches the TV
+func TestDisplayCollage(t *testing.T) {
+	tv, lastURI := recordingTV(t)
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	c := Collage{Width: 320, Height: 180, Background: Navy}
+	if err := renderer.DisplayCollage(context.Background(), tv, c, solid(30, 40, Red), solid(400, 100, Yellow)); err != nil {
+		t.Fatalf("DisplayCollage failed: %v", err)
+	}
+
+	frame := fetchJPEG(t, lastURI())
+	if frame.Bounds() != image.Rect(0, 0, 320, 180) {
+		t.Errorf("Sent a %v frame, want the collage's 320x180", frame.Bounds())
+	}
+
+	if err := renderer.DisplayCollage(context.Background(), tv, c); !errors.Is(err, ErrCollageSize) {
+		t.Errorf("Expected ErrCollageSize without photos, got %v", err)
+	}
+}
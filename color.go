@@ -0,0 +1,191 @@
+package nimsforestsmarttv
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidColor is returned by ParseColor for unknown names and malformed
+// hex codes
+var ErrInvalidColor = errors.New("invalid color")
+
+// More predefined colors (see also Black and White)
+var (
+	Red         = color.RGBA{230, 25, 35, 255}
+	Green       = color.RGBA{30, 170, 70, 255}
+	Blue        = color.RGBA{30, 100, 220, 255}
+	Yellow      = color.RGBA{255, 210, 0, 255}
+	Orange      = color.RGBA{255, 136, 0, 255}
+	Purple      = color.RGBA{140, 60, 190, 255}
+	Gray        = color.RGBA{128, 128, 128, 255}
+	Navy        = color.RGBA{0, 31, 84, 255}
+	Transparent = color.RGBA{0, 0, 0, 0}
+)
+
+// namedColors maps the names ParseColor accepts to colors
+var namedColors = map[string]color.RGBA{
+	"black":       Black,
+	"white":       White,
+	"red":         Red,
+	"green":       Green,
+	"blue":        Blue,
+	"yellow":      Yellow,
+	"orange":      Orange,
+	"purple":      Purple,
+	"gray":        Gray,
+	"grey":        Gray,
+	"navy":        Navy,
+	"transparent": Transparent,
+	"cyan":        {0, 200, 220, 255},
+	"magenta":     {220, 0, 160, 255},
+	"pink":        {255, 120, 170, 255},
+	"brown":       {130, 80, 40, 255},
+	"teal":        {0, 128, 128, 255},
+	"silver":      {192, 192, 192, 255},
+	"darkgray":    {64, 64, 64, 255},
+	"lightgray":   {211, 211, 211, 255},
+}
+
+// ColorNames returns the names ParseColor accepts, sorted
+func ColorNames() []string {
+	names := make([]string, 0, len(namedColors))
+	for name := range namedColors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseColor parses a color name (e.g. "orange", see ColorNames) or a hex
+// code as #rgb, #rgba, #rrggbb or #rrggbbaa. The # is optional and case
+// doesn't matter. Hex codes are straight alpha, as in CSS; the color.RGBA
+// returned is alpha-premultiplied, as the image/color package expects.
+func ParseColor(s string) (color.RGBA, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if c, ok := namedColors[s]; ok {
+		return c, nil
+	}
+
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 || len(hex) == 4 {
+		// Expand shorthand: "f80" is "ff8800"
+		var long strings.Builder
+		for _, ch := range hex {
+			long.WriteRune(ch)
+			long.WriteRune(ch)
+		}
+		hex = long.String()
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || err != nil {
+		return color.RGBA{}, fmt.Errorf("%w: %q", ErrInvalidColor, s)
+	}
+	a := v & 0xff
+	premultiply := func(c uint64) uint8 {
+		return uint8((c&0xff*a + 127) / 255)
+	}
+	return color.RGBA{premultiply(v >> 24), premultiply(v >> 16), premultiply(v >> 8), uint8(a)}, nil
+}
+
+// HexColor formats a color as #rrggbb, or #rrggbbaa (straight alpha) if
+// not opaque
+func HexColor(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	if n.A == 255 {
+		return fmt.Sprintf("#%02x%02x%02x", n.R, n.G, n.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", n.R, n.G, n.B, n.A)
+}
+
+// Palette is an ordered set of colors, e.g. for chart series or zones
+type Palette []color.RGBA
+
+// Predefined palettes
+var (
+	// CategoricalPalette has ten colors that are easy to tell apart
+	CategoricalPalette = Palette{
+		{31, 119, 180, 255},
+		{255, 127, 14, 255},
+		{44, 160, 44, 255},
+		{214, 39, 40, 255},
+		{148, 103, 189, 255},
+		{140, 86, 75, 255},
+		{227, 119, 194, 255},
+		{127, 127, 127, 255},
+		{188, 189, 34, 255},
+		{23, 190, 207, 255},
+	}
+
+	// StatusPalette is ok, warning, error and unknown
+	StatusPalette = Palette{Green, Orange, Red, Gray}
+
+	// HighContrastPalette reads well across a room
+	HighContrastPalette = Palette{White, Yellow, {0, 230, 255, 255}, {255, 80, 200, 255}, {120, 255, 80, 255}}
+)
+
+// ParsePalette parses every color with ParseColor
+func ParsePalette(colors ...string) (Palette, error) {
+	p := make(Palette, 0, len(colors))
+	for _, s := range colors {
+		c, err := ParseColor(s)
+		if err != nil {
+			return nil, err
+		}
+		p = append(p, c)
+	}
+	return p, nil
+}
+
+// At returns the i-th color, wrapping around so any index is valid. An
+// empty palette returns Black.
+func (p Palette) At(i int) color.RGBA {
+	if len(p) == 0 {
+		return Black
+	}
+	i %= len(p)
+	if i < 0 {
+		i += len(p)
+	}
+	return p[i]
+}
+
+// Gradient returns n colors evenly spaced between from and to
+func Gradient(from, to color.Color, n int) Palette {
+	if n <= 0 {
+		return nil
+	}
+	a := color.RGBAModel.Convert(from).(color.RGBA)
+	b := color.RGBAModel.Convert(to).(color.RGBA)
+	p := make(Palette, n)
+	for i := range p {
+		t := 0.0
+		if n > 1 {
+			t = float64(i) / float64(n-1)
+		}
+		lerp := func(x, y uint8) uint8 {
+			return uint8(float64(x) + (float64(y)-float64(x))*t + 0.5)
+		}
+		p[i] = color.RGBA{lerp(a.R, b.R), lerp(a.G, b.G), lerp(a.B, b.B), lerp(a.A, b.A)}
+	}
+	return p
+}
+
+// ReadableOn returns Black or White, whichever contrasts more with the
+// background, e.g. for text on a colored tile
+func ReadableOn(background color.Color) color.RGBA {
+	r, g, b, _ := background.RGBA()
+	// Perceived brightness (ITU-R BT.601 luma) on the 16-bit scale
+	luma := (299*r + 587*g + 114*b) / 1000
+	if luma > 0x8000 {
+		return Black
+	}
+	return White
+}
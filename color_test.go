@@ -0,0 +1,81 @@
+package nimsforestsmarttv
+
+import (
+	"errors"
+	"image/color"
+	"testing"
+)
+
+// TestParseColor tests color names and hex codes
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		in   string
+		want color.RGBA
+	}{
+		{"#ff8800", color.RGBA{255, 136, 0, 255}},
+		{"FF8800", color.RGBA{255, 136, 0, 255}},
+		{"#f80", color.RGBA{255, 136, 0, 255}},
+		{"#f808", color.RGBA{136, 73, 0, 136}}, // Premultiplied
+		{"#11223344", color.RGBA{5, 9, 14, 68}},
+		{"#ffffff00", color.RGBA{}},
+		{" Orange ", Orange},
+		{"grey", Gray},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseColor(tt.in)
+		if err != nil {
+			t.Errorf("ParseColor(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseColor(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "#12", "#12345", "#gggggg", "octarine"} {
+		if _, err := ParseColor(in); !errors.Is(err, ErrInvalidColor) {
+			t.Errorf("ParseColor(%q): expected ErrInvalidColor, got %v", in, err)
+		}
+	}
+}
+
+// TestHexColorRoundTrip tests that HexColor output parses back, within
+// rounding for translucent colors
+func TestHexColorRoundTrip(t *testing.T) {
+	for _, c := range []color.RGBA{Orange, {100, 50, 0, 200}, {1, 2, 3, 4}} {
+		got, err := ParseColor(HexColor(c))
+		if err != nil {
+			t.Errorf("Round trip of %v failed: %v", c, err)
+			continue
+		}
+		for i, v := range []uint8{got.R - c.R, got.G - c.G, got.B - c.B, got.A - c.A} {
+			if v > 1 && v < 255 {
+				t.Errorf("Round trip of %v gave %v (channel %d)", c, got, i)
+			}
+		}
+	}
+	if got := HexColor(color.NRGBA{255, 136, 0, 128}); got != "#ff880080" {
+		t.Errorf("HexColor = %s, want straight alpha #ff880080", got)
+	}
+}
+
+// TestPalette tests palette helpers
+func TestPalette(t *testing.T) {
+	p, err := ParsePalette("red", "#00ff00", "#00f")
+	if err != nil {
+		t.Fatalf("ParsePalette failed: %v", err)
+	}
+	if p.At(3) != Red || p.At(-1) != (color.RGBA{0, 0, 255, 255}) {
+		t.Errorf("At should wrap around, got %v and %v", p.At(3), p.At(-1))
+	}
+
+	g := Gradient(Black, White, 3)
+	if g[0] != Black || g[1] != (color.RGBA{128, 128, 128, 255}) || g[2] != White {
+		t.Errorf("Unexpected gradient %v", g)
+	}
+
+	if ReadableOn(Yellow) != Black || ReadableOn(Navy) != White {
+		t.Error("Expected black on yellow and white on navy")
+	}
+}
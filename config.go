@@ -0,0 +1,574 @@
+package nimsforestsmarttv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidConfig is returned by Config.Validate and LoadConfig
+var ErrInvalidConfig = errors.New("invalid config")
+
+// Config is the configuration shared by the library constructors, the CLI
+// and long-running services. It is loaded from a JSON file and SMARTTV_*
+// environment variables with LoadConfig.
+type Config struct {
+	Renderer  RendererConfig  `json:"renderer"`
+	Server    ServerConfig    `json:"server"`
+	Discovery DiscoveryConfig `json:"discovery"`
+	Security  SecurityConfig  `json:"security"`
+	WebUI     WebUIConfig     `json:"web_ui"`
+
+	// Quirks override the quirks of TVs by name or UDN
+	Quirks map[string]Quirks `json:"quirks,omitempty"`
+
+	// Zones map zone names to their members (TV names or UDNs)
+	Zones map[string][]string `json:"zones,omitempty"`
+}
+
+// RendererConfig holds the Renderer defaults
+type RendererConfig struct {
+	FontSize    int      `json:"font_size,omitempty"`
+	Width       int      `json:"width,omitempty"`
+	Height      int      `json:"height,omitempty"`
+	Color       string   `json:"color,omitempty"`      // Name or hex code (see ParseColor)
+	Background  string   `json:"background,omitempty"` // Name or hex code
+	JPEGQuality int      `json:"jpeg_quality,omitempty"`
+	VerifyPlay  Duration `json:"verify_play,omitempty"` // See WithPlayVerification (0 = off)
+	BusyPolicy  string   `json:"busy_policy,omitempty"` // "queue" (default) or "fail"
+	Language    string   `json:"language,omitempty"`    // Language of screen and CLI texts (see CatalogFor)
+
+	// Converter commands for photos TVs can't show, by format ("heic",
+	// "avif"), e.g. {"heic": ["magick", "-", "png:-"]} (see CommandDecoder)
+	Decoders map[string][]string `json:"decoders,omitempty"`
+}
+
+// ServerConfig holds the embedded image server's binding
+type ServerConfig struct {
+	Addr       string `json:"addr,omitempty"` // Listen address (default ":0")
+	PathPrefix string `json:"path_prefix,omitempty"`
+	RandomIDs  bool   `json:"random_ids,omitempty"`
+}
+
+// DiscoveryConfig holds the discovery defaults (see DiscoverOptions)
+type DiscoveryConfig struct {
+	Timeout         Duration `json:"timeout,omitempty"`
+	ListenMulticast bool     `json:"listen_multicast,omitempty"`
+	ListenPort      int      `json:"listen_port,omitempty"`
+	SweepSubnets    []string `json:"sweep_subnets,omitempty"`
+	NoSweepFallback bool     `json:"no_sweep_fallback,omitempty"`
+	LenientXML      bool     `json:"lenient_xml,omitempty"`
+	Cast            bool     `json:"cast,omitempty"`
+	AirPlay         bool     `json:"airplay,omitempty"`
+	SearchTargets   []string `json:"search_targets,omitempty"`
+	MX              int      `json:"mx,omitempty"`
+	Repeat          int      `json:"repeat,omitempty"`
+	Interface       string   `json:"interface,omitempty"`
+}
+
+// SecurityConfig restricts the media URLs callers can pass (see URLPolicy)
+// and the images they can send (see Limits)
+type SecurityConfig struct {
+	Schemes      []string `json:"schemes,omitempty"`
+	AllowHosts   []string `json:"allow_hosts,omitempty"`
+	DenyHosts    []string `json:"deny_hosts,omitempty"`
+	BlockPrivate bool     `json:"block_private,omitempty"`
+
+	// Image limits; zero keeps the one of DefaultLimits
+	MaxImageBytes  int `json:"max_image_bytes,omitempty"`
+	MaxImageWidth  int `json:"max_image_width,omitempty"`
+	MaxImageHeight int `json:"max_image_height,omitempty"`
+	MaxImagePixels int `json:"max_image_pixels,omitempty"`
+}
+
+// WebUIConfig holds who may use the web UI API (see WithWebUIUsers)
+type WebUIConfig struct {
+	Users     []WebUIUser `json:"users,omitempty"`
+	Anonymous Role        `json:"anonymous,omitempty"` // Role of requests without a token
+}
+
+// Duration is a time.Duration written as a string ("5s") in JSON
+type Duration time.Duration
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON reads a duration string ("5s", "1m30s") or seconds
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var secs float64
+		if err := json.Unmarshal(data, &secs); err != nil {
+			return errors.New(`duration must be a string like "5s" or seconds`)
+		}
+		*d = Duration(secs * float64(time.Second))
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// DefaultConfig returns the configuration used when nothing is set
+func DefaultConfig() Config {
+	return Config{
+		Renderer: RendererConfig{
+			FontSize:    100,
+			Width:       1920,
+			Height:      1080,
+			Color:       "white",
+			Background:  "black",
+			JPEGQuality: 85,
+			BusyPolicy:  "queue",
+		},
+		Server:    ServerConfig{Addr: ":0"},
+		Discovery: DiscoveryConfig{Timeout: Duration(5 * time.Second)},
+	}
+}
+
+// DefaultConfigPath returns the config file location in the user's config
+// directory (e.g. ~/.config/smarttv/config.json)
+func DefaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("locate config directory: %w", err)
+	}
+	return filepath.Join(dir, "smarttv", "config.json"), nil
+}
+
+// LoadConfig reads the JSON config file at path on top of DefaultConfig,
+// applies SMARTTV_* environment variables and validates the result. A
+// missing file is not an error. YAML files are refused: the package has
+// no dependencies, and the standard library reads no YAML.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		return cfg, fmt.Errorf("%w: %s: YAML is not supported, use JSON", ErrInvalidConfig, path)
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return cfg, fmt.Errorf("read config: %w", err)
+		default:
+			if err := json.Unmarshal(data, &cfg); err != nil {
+				return cfg, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, path, err)
+			}
+		}
+	}
+
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// configEnv maps environment variables to the config field they set
+var configEnv = map[string]func(c *Config, v string) error{
+	"SMARTTV_FONT_SIZE":         func(c *Config, v string) error { return setInt(&c.Renderer.FontSize, v) },
+	"SMARTTV_WIDTH":             func(c *Config, v string) error { return setInt(&c.Renderer.Width, v) },
+	"SMARTTV_HEIGHT":            func(c *Config, v string) error { return setInt(&c.Renderer.Height, v) },
+	"SMARTTV_COLOR":             func(c *Config, v string) error { c.Renderer.Color = v; return nil },
+	"SMARTTV_BACKGROUND":        func(c *Config, v string) error { c.Renderer.Background = v; return nil },
+	"SMARTTV_JPEG_QUALITY":      func(c *Config, v string) error { return setInt(&c.Renderer.JPEGQuality, v) },
+	"SMARTTV_VERIFY_PLAY":       func(c *Config, v string) error { return setDuration(&c.Renderer.VerifyPlay, v) },
+	"SMARTTV_BUSY_POLICY":       func(c *Config, v string) error { c.Renderer.BusyPolicy = v; return nil },
+	"SMARTTV_LANGUAGE":          func(c *Config, v string) error { c.Renderer.Language = v; return nil },
+	"SMARTTV_SERVER_ADDR":       func(c *Config, v string) error { c.Server.Addr = v; return nil },
+	"SMARTTV_PATH_PREFIX":       func(c *Config, v string) error { c.Server.PathPrefix = v; return nil },
+	"SMARTTV_RANDOM_IDS":        func(c *Config, v string) error { return setBool(&c.Server.RandomIDs, v) },
+	"SMARTTV_DISCOVERY_TIMEOUT": func(c *Config, v string) error { return setDuration(&c.Discovery.Timeout, v) },
+	"SMARTTV_LISTEN_MULTICAST":  func(c *Config, v string) error { return setBool(&c.Discovery.ListenMulticast, v) },
+	"SMARTTV_LENIENT_XML":       func(c *Config, v string) error { return setBool(&c.Discovery.LenientXML, v) },
+	"SMARTTV_CAST":              func(c *Config, v string) error { return setBool(&c.Discovery.Cast, v) },
+	"SMARTTV_AIRPLAY":           func(c *Config, v string) error { return setBool(&c.Discovery.AirPlay, v) },
+	"SMARTTV_MX":                func(c *Config, v string) error { return setInt(&c.Discovery.MX, v) },
+	"SMARTTV_SEARCH_REPEAT":     func(c *Config, v string) error { return setInt(&c.Discovery.Repeat, v) },
+	"SMARTTV_INTERFACE":         func(c *Config, v string) error { c.Discovery.Interface = v; return nil },
+	"SMARTTV_BLOCK_PRIVATE":     func(c *Config, v string) error { return setBool(&c.Security.BlockPrivate, v) },
+	"SMARTTV_MAX_IMAGE_BYTES":   func(c *Config, v string) error { return setInt(&c.Security.MaxImageBytes, v) },
+	"SMARTTV_MAX_IMAGE_WIDTH":   func(c *Config, v string) error { return setInt(&c.Security.MaxImageWidth, v) },
+	"SMARTTV_MAX_IMAGE_HEIGHT":  func(c *Config, v string) error { return setInt(&c.Security.MaxImageHeight, v) },
+	"SMARTTV_MAX_IMAGE_PIXELS":  func(c *Config, v string) error { return setInt(&c.Security.MaxImagePixels, v) },
+	"SMARTTV_SWEEP_SUBNETS": func(c *Config, v string) error {
+		c.Discovery.SweepSubnets = splitList(v)
+		return nil
+	},
+	"SMARTTV_SEARCH_TARGETS": func(c *Config, v string) error {
+		c.Discovery.SearchTargets = splitList(v)
+		return nil
+	},
+	"SMARTTV_ALLOW_HOSTS": func(c *Config, v string) error {
+		c.Security.AllowHosts = splitList(v)
+		return nil
+	},
+	"SMARTTV_DENY_HOSTS": func(c *Config, v string) error {
+		c.Security.DenyHosts = splitList(v)
+		return nil
+	},
+}
+
+// splitList splits a comma or space separated list
+func splitList(v string) []string {
+	return strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+// ApplyEnv overrides fields from SMARTTV_* variables found by lookup
+// (usually os.LookupEnv)
+func (c *Config) ApplyEnv(lookup func(key string) (string, bool)) error {
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(configEnv)) {
+		set := configEnv[key]
+		v, ok := lookup(key)
+		if !ok {
+			continue
+		}
+		if err := set(c, strings.TrimSpace(v)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, errors.Join(errs...))
+	}
+	return nil
+}
+
+func setInt(dst *int, v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return err
+	}
+	*dst = n
+	return nil
+}
+
+func setBool(dst *bool, v string) error {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return err
+	}
+	*dst = b
+	return nil
+}
+
+func setDuration(dst *Duration, v string) error {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return err
+	}
+	*dst = Duration(d)
+	return nil
+}
+
+// Validate checks the config and returns all problems at once
+func (c Config) Validate() error {
+	var errs []error
+
+	if _, err := c.TextOptions(); err != nil {
+		errs = append(errs, err)
+	}
+	if q := c.Renderer.JPEGQuality; q < 0 || q > 100 {
+		errs = append(errs, fmt.Errorf("jpeg_quality %d is not between 1 and 100", q))
+	}
+	if c.Renderer.VerifyPlay < 0 {
+		errs = append(errs, errors.New("verify_play is negative"))
+	}
+	if _, err := c.busyPolicy(); err != nil {
+		errs = append(errs, err)
+	}
+	for _, format := range slices.Sorted(maps.Keys(c.Renderer.Decoders)) {
+		if _, ok := transcodedTypes["image/"+format]; !ok {
+			errs = append(errs, fmt.Errorf("decoder for unknown format %q", format))
+		}
+		if len(c.Renderer.Decoders[format]) == 0 {
+			errs = append(errs, fmt.Errorf("decoder for %q has no command", format))
+		}
+	}
+
+	if c.Server.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+			errs = append(errs, fmt.Errorf("server addr: %w", err))
+		}
+	}
+
+	if c.Discovery.Timeout < 0 {
+		errs = append(errs, errors.New("discovery timeout is negative"))
+	}
+	if p := c.Discovery.ListenPort; p < 0 || p > 65535 {
+		errs = append(errs, fmt.Errorf("listen_port %d is out of range", p))
+	}
+	if mx := c.Discovery.MX; mx < 0 || mx > 5 {
+		errs = append(errs, fmt.Errorf("mx %d is not between 1 and 5", mx))
+	}
+	if c.Discovery.Repeat < 0 {
+		errs = append(errs, errors.New("discovery repeat is negative"))
+	}
+	for _, subnet := range c.Discovery.SweepSubnets {
+		if _, err := sweepTargets([]string{subnet}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if s := c.Security; s.MaxImageBytes < 0 || s.MaxImageWidth < 0 || s.MaxImageHeight < 0 || s.MaxImagePixels < 0 {
+		errs = append(errs, errors.New("image limits are negative"))
+	}
+	for _, rule := range slices.Concat(c.Security.AllowHosts, c.Security.DenyHosts) {
+		if strings.Contains(rule, "/") {
+			if _, err := netip.ParsePrefix(rule); err != nil {
+				errs = append(errs, fmt.Errorf("security: %w", err))
+			}
+		}
+	}
+
+	tokens := make(map[string]bool)
+	for _, user := range c.WebUI.Users {
+		switch {
+		case user.Token == "":
+			errs = append(errs, fmt.Errorf("web_ui user %q has no token", user.Name))
+		case tokens[user.Token]:
+			errs = append(errs, fmt.Errorf("web_ui user %q shares a token", user.Name))
+		}
+		tokens[user.Token] = true
+		if !user.Role.Valid() {
+			errs = append(errs, fmt.Errorf("web_ui user %q has unknown role %q", user.Name, user.Role))
+		}
+	}
+	if r := c.WebUI.Anonymous; r != "" && !r.Valid() {
+		errs = append(errs, fmt.Errorf("web_ui anonymous role %q is unknown", r))
+	}
+
+	for zone, members := range c.Zones {
+		if len(members) == 0 {
+			errs = append(errs, fmt.Errorf("zone %q has no members", zone))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, errors.Join(errs...))
+	}
+	return nil
+}
+
+// busyPolicy parses Renderer.BusyPolicy
+func (c Config) busyPolicy() (BusyPolicy, error) {
+	switch strings.ToLower(c.Renderer.BusyPolicy) {
+	case "", "queue":
+		return BusyQueue, nil
+	case "fail":
+		return BusyFail, nil
+	default:
+		return 0, fmt.Errorf("busy_policy %q is not queue or fail", c.Renderer.BusyPolicy)
+	}
+}
+
+// TextOptions returns the text defaults of the config
+func (c Config) TextOptions() (TextOptions, error) {
+	opts := TextOptions{
+		FontSize: c.Renderer.FontSize,
+		Width:    c.Renderer.Width,
+		Height:   c.Renderer.Height,
+	}
+	var errs []error
+	if c.Renderer.Color != "" {
+		col, err := ParseColor(c.Renderer.Color)
+		errs = append(errs, err)
+		opts.Color = col
+	}
+	if c.Renderer.Background != "" {
+		col, err := ParseColor(c.Renderer.Background)
+		errs = append(errs, err)
+		opts.Background = col
+	}
+	if err := errors.Join(errs...); err != nil {
+		return opts, err
+	}
+	opts = opts.withDefaults()
+	return opts, opts.Validate()
+}
+
+// RendererOptions returns the options to create a Renderer with, e.g.
+// NewRenderer(cfg.RendererOptions()...). Call Validate first; invalid
+// fields are left at their defaults.
+func (c Config) RendererOptions() []Option {
+	var opts []Option
+	if text, err := c.TextOptions(); err == nil {
+		opts = append(opts, WithTextOptions(text))
+	}
+	if q := c.Renderer.JPEGQuality; q > 0 && q <= 100 {
+		opts = append(opts, WithEncoder(JPEGEncoder{Quality: q}))
+	}
+	if c.Renderer.VerifyPlay > 0 {
+		opts = append(opts, WithPlayVerification(time.Duration(c.Renderer.VerifyPlay)))
+	}
+	if policy, err := c.busyPolicy(); err == nil {
+		opts = append(opts, WithBusyPolicy(policy))
+	}
+	if c.Renderer.Language != "" {
+		opts = append(opts, WithLanguage(c.Renderer.Language))
+	}
+	for format, command := range c.Renderer.Decoders {
+		if len(command) > 0 {
+			opts = append(opts, WithImageDecoder(format, CommandDecoder(command[0], command[1:]...)))
+		}
+	}
+	if policy, ok := c.urlPolicy(); ok {
+		opts = append(opts, WithURLPolicy(policy))
+	}
+	if limits, ok := c.limits(); ok {
+		opts = append(opts, WithLimits(limits))
+	}
+	return append(opts, WithServerOptions(c.ServerOptions()...))
+}
+
+// ApplySettings sets the renderer defaults of the config on s, for
+// reloading a running Renderer: r.Configure(cfg.ApplySettings). Call
+// Validate first; invalid fields are left unchanged.
+func (c Config) ApplySettings(s *Settings) {
+	if text, err := c.TextOptions(); err == nil {
+		s.Text.FontSize, s.Text.Width, s.Text.Height = text.FontSize, text.Width, text.Height
+		s.Text.Color, s.Text.Background = text.Color, text.Background
+	}
+	if q := c.Renderer.JPEGQuality; q > 0 && q <= 100 {
+		s.Encoder = JPEGEncoder{Quality: q}
+	}
+	if c.Renderer.Language != "" {
+		s.Catalog = CatalogFor(c.Renderer.Language)
+	}
+}
+
+// ServerOptions returns the options for the image server
+func (c Config) ServerOptions() []ServerOption {
+	var opts []ServerOption
+	if c.Server.Addr != "" {
+		opts = append(opts, WithServerAddr(c.Server.Addr))
+	}
+	if c.Server.PathPrefix != "" {
+		opts = append(opts, WithPathPrefix(c.Server.PathPrefix))
+	}
+	if c.Server.RandomIDs {
+		opts = append(opts, WithRandomIDs())
+	}
+	if policy, ok := c.urlPolicy(); ok {
+		opts = append(opts, WithServerURLPolicy(policy))
+	}
+	if limits, ok := c.limits(); ok {
+		opts = append(opts, WithServerLimits(limits))
+	}
+	return opts
+}
+
+// UploadOptions returns the options for a FrameReceiver
+func (c Config) UploadOptions() []UploadOption {
+	var opts []UploadOption
+	if limits, ok := c.limits(); ok {
+		opts = append(opts, WithUploadLimits(limits))
+	}
+	return opts
+}
+
+// WebUIOptions returns the options for a WebUI
+func (c Config) WebUIOptions() []WebUIOption {
+	var opts []WebUIOption
+	if len(c.WebUI.Users) > 0 {
+		opts = append(opts, WithWebUIUsers(c.WebUI.Users...))
+	}
+	if c.WebUI.Anonymous != "" {
+		opts = append(opts, WithWebUIAnonymous(c.WebUI.Anonymous))
+	}
+	return opts
+}
+
+// limits returns the image limits of the config, if it changes any
+func (c Config) limits() (Limits, bool) {
+	s := c.Security
+	limits := DefaultLimits
+	if s.MaxImageBytes > 0 {
+		limits.MaxBytes = s.MaxImageBytes
+	}
+	if s.MaxImageWidth > 0 {
+		limits.MaxWidth = s.MaxImageWidth
+	}
+	if s.MaxImageHeight > 0 {
+		limits.MaxHeight = s.MaxImageHeight
+	}
+	if s.MaxImagePixels > 0 {
+		limits.MaxPixels = s.MaxImagePixels
+	}
+	return limits, limits != DefaultLimits
+}
+
+// urlPolicy returns the URL policy of the config, if it sets one
+func (c Config) urlPolicy() (URLPolicy, bool) {
+	s := c.Security
+	policy := URLPolicy{Schemes: s.Schemes, Allow: s.AllowHosts, Deny: s.DenyHosts, BlockPrivate: s.BlockPrivate}
+	return policy, len(s.Schemes) > 0 || len(s.AllowHosts) > 0 || len(s.DenyHosts) > 0 || s.BlockPrivate
+}
+
+// DiscoverOptions returns the discovery options of the config
+func (c Config) DiscoverOptions() DiscoverOptions {
+	return DiscoverOptions{
+		Timeout:         time.Duration(c.Discovery.Timeout),
+		ListenMulticast: c.Discovery.ListenMulticast,
+		ListenPort:      c.Discovery.ListenPort,
+		SweepSubnets:    c.Discovery.SweepSubnets,
+		NoSweepFallback: c.Discovery.NoSweepFallback,
+		LenientXML:      c.Discovery.LenientXML,
+		Cast:            c.Discovery.Cast,
+		AirPlay:         c.Discovery.AirPlay,
+		SearchTargets:   c.Discovery.SearchTargets,
+		MX:              c.Discovery.MX,
+		Repeat:          c.Discovery.Repeat,
+		Interface:       c.Discovery.Interface,
+	}
+}
+
+// ApplyQuirks sets the TV's quirks from the config's overrides, matched by
+// UDN, (case-insensitive) name or slug
+func (c Config) ApplyQuirks(tv *TV) {
+	if q, ok := c.Quirks[tv.UDN]; ok && tv.UDN != "" {
+		tv.Quirks = q
+		return
+	}
+	for name, q := range c.Quirks {
+		if tv.Matches(name) {
+			tv.Quirks = q
+			return
+		}
+	}
+}
+
+// ApplyTo adds the config's zones to the registry and applies the quirk
+// overrides to its TVs. They are not saved with the registry, so the
+// config stays the one place they are set: the registry's own zones and
+// quirks are written back as they were.
+func (c Config) ApplyTo(reg *Registry) {
+	for zone, members := range c.Zones {
+		reg.overrideZone(zone, members...)
+	}
+	if len(c.Quirks) == 0 {
+		return
+	}
+	for _, tv := range reg.TVs() {
+		updated := *tv
+		c.ApplyQuirks(&updated)
+		if updated.Quirks != tv.Quirks {
+			reg.overrideQuirks(tv, updated.Quirks)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package nimsforestsmarttv
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLoadConfig tests that the file is read on top of the defaults and
+// environment variables override it
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{
+  "renderer": {"font_size": 80, "color": "#ff8800", "verify_play": "3s", "busy_policy": "fail"},
+  "server": {"addr": "127.0.0.1:0", "path_prefix": "smarttv"},
+  "discovery": {"timeout": 2},
+  "zones": {"lobby": ["Lobby Left", "Lobby Right"]}
+}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SMARTTV_FONT_SIZE", "120")
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Renderer.FontSize != 120 {
+		t.Errorf("FontSize = %d, want env override 120", cfg.Renderer.FontSize)
+	}
+	if cfg.Renderer.Width != 1920 || cfg.Renderer.Background != "black" {
+		t.Errorf("defaults not kept: %+v", cfg.Renderer)
+	}
+	if cfg.Renderer.VerifyPlay != Duration(3*time.Second) || cfg.Discovery.Timeout != Duration(2*time.Second) {
+		t.Errorf("durations = %v, %v", cfg.Renderer.VerifyPlay, cfg.Discovery.Timeout)
+	}
+	if len(cfg.Zones["lobby"]) != 2 {
+		t.Errorf("zones = %v", cfg.Zones)
+	}
+
+	r, err := NewRenderer(cfg.RendererOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.busy != BusyFail || r.verifyPlay != 3*time.Second {
+		t.Errorf("renderer busy = %v, verifyPlay = %v", r.busy, r.verifyPlay)
+	}
+}
+
+// TestLoadConfigMissingFile tests that a missing file leaves the defaults
+func TestLoadConfigMissingFile(t *testing.T) {
+	cfg, err := LoadConfig(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Renderer.FontSize != DefaultConfig().Renderer.FontSize {
+		t.Errorf("FontSize = %d, want default", cfg.Renderer.FontSize)
+	}
+}
+
+// TestConfigValidate tests that invalid values are all reported
+func TestConfigValidate(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Renderer.Color = "not-a-color"
+	cfg.Renderer.JPEGQuality = 101
+	cfg.Renderer.BusyPolicy = "sometimes"
+	cfg.Server.Addr = "nohost"
+	cfg.Discovery.SweepSubnets = []string{"10.0.0.0/33"}
+	cfg.Zones = map[string][]string{"empty": nil}
+	cfg.Renderer.Decoders = map[string][]string{"webp": {"dwebp"}}
+	cfg.Security.DenyHosts = []string{"10.0.0.0/99"}
+	cfg.WebUI.Users = []WebUIUser{{Name: "ana", Role: "boss"}}
+
+	err := cfg.Validate()
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("err = %v, want ErrInvalidConfig", err)
+	}
+	for _, want := range []string{"not-a-color", "jpeg_quality", "sometimes", "server addr", "sweep subnet", `"empty"`, `"webp"`, "security", "no token", `"boss"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Errorf("default config invalid: %v", err)
+	}
+}
+
+// TestConfigApplyEnv tests that SMARTTV_* variables set their fields
+func TestConfigApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"SMARTTV_RANDOM_IDS":    "true",
+		"SMARTTV_SWEEP_SUBNETS": "192.168.1.0/24, 10.0.0.0/24",
+		"SMARTTV_WIDTH":         "wide",
+		"SMARTTV_BLOCK_PRIVATE": "1",
+		"SMARTTV_ALLOW_HOSTS":   "*.example.com,192.168.1.0/24",
+	}
+	lookup := func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+
+	cfg := DefaultConfig()
+	err := cfg.ApplyEnv(lookup)
+	if !errors.Is(err, ErrInvalidConfig) || !strings.Contains(err.Error(), "SMARTTV_WIDTH") {
+		t.Errorf("err = %v, want invalid SMARTTV_WIDTH", err)
+	}
+	if !cfg.Server.RandomIDs {
+		t.Error("RandomIDs not set")
+	}
+	if len(cfg.Discovery.SweepSubnets) != 2 {
+		t.Errorf("SweepSubnets = %v", cfg.Discovery.SweepSubnets)
+	}
+	if policy, ok := cfg.urlPolicy(); !ok || !policy.BlockPrivate || len(policy.Allow) != 2 {
+		t.Errorf("urlPolicy = %+v, %v", policy, ok)
+	}
+}
+
+// TestConfigApplyTo tests that the config's zones and quirks apply to a
+// registry without being saved into its file
+func TestConfigApplyTo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	reg, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.AddTV(TV{Name: "Lobby Left", UDN: "uuid:left"})
+	reg.AddTV(TV{Name: "Lobby Right", UDN: "uuid:right", Quirks: Quirks{ImageClass: "object.item"}})
+	reg.SetZone("lobby", "Lobby Left")
+	reg.SetZoneTimeZone("lobby", "Europe/Berlin")
+
+	cfg := DefaultConfig()
+	cfg.Zones = map[string][]string{"lobby": {"Lobby Left", "uuid:right"}}
+	cfg.Quirks = map[string]Quirks{
+		"lobby left": {ImageClass: "object.item.imageItem"},
+		"uuid:right": {ResolutionInRes: true},
+	}
+	cfg.ApplyTo(reg)
+
+	tvs, err := reg.Zone("lobby")
+	if err != nil || len(tvs) != 2 {
+		t.Fatalf("zone = %v, %v", tvs, err)
+	}
+	left, _ := reg.Lookup("Lobby Left")
+	right, _ := reg.Lookup("uuid:right")
+	if left.Quirks.ImageClass != "object.item.imageItem" || !right.Quirks.ResolutionInRes {
+		t.Errorf("quirks = %+v, %+v", left.Quirks, right.Quirks)
+	}
+
+	cfg.ApplyTo(reg)
+	reg.SetZone("hall", "Lobby Right")
+	if err := reg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tvs, err = saved.Zone("lobby")
+	if err != nil || len(tvs) != 1 || saved.Zones()[1].TimeZone != "Europe/Berlin" {
+		t.Errorf("Saved lobby zone = %v, %v, %+v", tvs, err, saved.Zones())
+	}
+	if _, err := saved.Zone("hall"); err != nil {
+		t.Errorf("Zone set by hand not saved: %v", err)
+	}
+	left, _ = saved.Lookup("Lobby Left")
+	right, _ = saved.Lookup("uuid:right")
+	if left.Quirks != (Quirks{}) || right.Quirks != (Quirks{ImageClass: "object.item"}) {
+		t.Errorf("Saved quirks = %+v, %+v", left.Quirks, right.Quirks)
+	}
+}
+
+// TestLoadConfigYAML tests that YAML files are refused rather than read as
+// JSON
+func TestLoadConfigYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("renderer:\n  font_size: 80\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); !errors.Is(err, ErrInvalidConfig) || !strings.Contains(err.Error(), "YAML") {
+		t.Errorf("err = %v, want YAML refused", err)
+	}
+}
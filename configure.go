@@ -0,0 +1,55 @@
+package nimsforestsmarttv
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Settings are the Renderer defaults that can change while it runs
+type Settings struct {
+	Text    TextOptions // Default text options: size, colors (the theme)
+	Encoder Encoder     // Encoder for rendered frames, e.g. JPEGEncoder{Quality: 70}
+	Catalog Catalog     // Built-in strings shown on screens, e.g. CatalogFor("de")
+}
+
+// Settings returns the Renderer's current defaults
+func (r *Renderer) Settings() Settings {
+	r.settingsMu.RLock()
+	defer r.settingsMu.RUnlock()
+	return Settings{Text: r.textOpts, Encoder: r.encoder, Catalog: r.catalog}
+}
+
+// Configure changes the defaults of a running Renderer. fn edits a copy of
+// the current settings; invalid results are rejected and leave the
+// Renderer unchanged. The new defaults apply to frames rendered after
+// Configure returns, while streams and sessions already on a TV keep
+// playing. fn runs under a lock and must not call the Renderer.
+func (r *Renderer) Configure(fn func(s *Settings)) error {
+	r.settingsMu.Lock()
+	defer r.settingsMu.Unlock()
+
+	s := Settings{Text: r.textOpts, Encoder: r.encoder, Catalog: r.catalog}
+	fn(&s)
+	if err := s.Text.Validate(); err != nil {
+		return fmt.Errorf("configure: %w", err)
+	}
+	if s.Encoder == nil {
+		return errors.New("configure: no encoder")
+	}
+	r.textOpts, r.encoder, r.catalog = s.Text, s.Encoder, s.Catalog
+	return nil
+}
+
+// defaultText returns the default text options
+func (r *Renderer) defaultText() TextOptions {
+	r.settingsMu.RLock()
+	defer r.settingsMu.RUnlock()
+	return r.textOpts
+}
+
+// frameEncoder returns the encoder for rendered frames
+func (r *Renderer) frameEncoder() Encoder {
+	r.settingsMu.RLock()
+	defer r.settingsMu.RUnlock()
+	return r.encoder
+}
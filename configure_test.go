@@ -0,0 +1,81 @@
+package nimsforestsmarttv
+
+import (
+	"errors"
+	"image/color"
+	"sync"
+	"testing"
+)
+
+func TestConfigure(t *testing.T) {
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer renderer.Close()
+
+	err = renderer.Configure(func(s *Settings) {
+		s.Text.Background = color.RGBA{R: 255, A: 255}
+		s.Encoder = PNGEncoder{}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := renderer.Preview(Content{Text: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, b, _ := img.At(0, 0).RGBA(); r>>8 != 255 || g != 0 || b != 0 {
+		t.Errorf("background = %v, want red", img.At(0, 0))
+	}
+	if _, contentType, err := renderer.storeImage(img); err != nil || contentType != "image/png" {
+		t.Errorf("content type = %q, %v, want image/png", contentType, err)
+	}
+
+	// Invalid settings leave the renderer unchanged
+	err = renderer.Configure(func(s *Settings) { s.Text.FontSize = 1 })
+	if !errors.Is(err, ErrInvalidTextOptions) {
+		t.Errorf("err = %v, want ErrInvalidTextOptions", err)
+	}
+	if err := renderer.Configure(func(s *Settings) { s.Encoder = nil }); err == nil {
+		t.Error("nil encoder accepted")
+	}
+	if s := renderer.Settings(); s.Text.FontSize != 100 || s.Encoder != (PNGEncoder{}) {
+		t.Errorf("settings = %+v after rejected changes", s)
+	}
+}
+
+func TestConfigureConcurrent(t *testing.T) {
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer renderer.Close()
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			renderer.Configure(func(s *Settings) { s.Text.FontSize = 50 + i })
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := renderer.Preview(Content{Text: "x"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	cfg := DefaultConfig()
+	cfg.Renderer.JPEGQuality = 60
+	cfg.Renderer.FontSize = 80
+	if err := renderer.Configure(cfg.ApplySettings); err != nil {
+		t.Fatal(err)
+	}
+	if s := renderer.Settings(); s.Text.FontSize != 80 || s.Encoder != (JPEGEncoder{Quality: 60}) {
+		t.Errorf("settings = %+v, want config values", s)
+	}
+}
@@ -0,0 +1,112 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+)
+
+// Content is something to show on a TV. Exactly one of Text, Image, JPEG or
+// VideoURL is expected to be set; they are checked in that order.
+type Content struct {
+	Tags []string // Routing tags (e.g. "alert", "menu")
+
+	Text     string      // Rendered with the renderer's text options
+	Image    image.Image // Encoded as JPEG
+	JPEG     []byte      // Pre-encoded JPEG data
+	VideoURL string      // Video/HLS stream played by the TV
+	Title    string      // Title shown for video streams
+
+	// Transition animates the change to Text and Image content (nil = cut)
+	Transition *Transition
+}
+
+// ErrEmptyContent is returned when Content has nothing to show
+var ErrEmptyContent = errors.New("content has nothing to show")
+
+// HasTag reports whether the content carries the tag
+func (c Content) HasTag(tag string) bool {
+	for _, t := range c.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Show displays content on the TV using the matching display mode
+func (r *Renderer) Show(ctx context.Context, tv *TV, c Content) error {
+	var err error
+	switch {
+	case c.Text != "" && c.Transition != nil:
+		err = r.DisplayWithTransition(ctx, tv, RenderText(c.Text, r.defaultText()), *c.Transition)
+	case c.Text != "":
+		err = r.DisplayText(ctx, tv, c.Text)
+	case c.Image != nil && c.Transition != nil:
+		err = r.DisplayWithTransition(ctx, tv, c.Image, *c.Transition)
+	case c.Image != nil:
+		err = r.DisplayImage(ctx, tv, c.Image)
+	case c.JPEG != nil:
+		err = r.DisplayImageJPEG(ctx, tv, c.JPEG)
+	case c.VideoURL != "":
+		return r.StreamVideo(ctx, tv, c.VideoURL, c.Title)
+	default:
+		return ErrEmptyContent
+	}
+	if err != nil {
+		return err
+	}
+
+	// Remember the tags so audits can tell which content is on screen
+	r.mu.Lock()
+	if frame, ok := r.lastFrame[tv.ControlURL]; ok {
+		frame.tags = c.Tags
+		r.lastFrame[tv.ControlURL] = frame
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+// ErrNoPreview is returned by Preview for content the TV fetches and
+// renders itself, such as video streams
+var ErrNoPreview = errors.New("content cannot be previewed")
+
+// Preview returns the frame that Show would send to a TV for this content,
+// without any network activity. Use it to show previews in web UIs or for
+// golden-image comparisons in tests.
+func (r *Renderer) Preview(c Content) (image.Image, error) {
+	switch {
+	case c.Text != "":
+		return RenderText(c.Text, r.defaultText()), nil
+	case c.Image != nil:
+		return c.Image, nil
+	case c.JPEG != nil:
+		img, err := jpeg.Decode(bytes.NewReader(c.JPEG))
+		if err != nil {
+			return nil, fmt.Errorf("decode JPEG: %w", err)
+		}
+		return img, nil
+	case c.VideoURL != "":
+		return nil, ErrNoPreview
+	default:
+		return nil, ErrEmptyContent
+	}
+}
+
+// PreviewPNG is like Preview but returns the frame encoded as PNG
+func (r *Renderer) PreviewPNG(c Content) ([]byte, error) {
+	img, err := r.Preview(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("encode PNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,91 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestPreview tests that Preview returns exactly the frame Show sends
+func TestPreview(t *testing.T) {
+	var mu sync.Mutex
+	var uri string
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(r.Header.Get("SOAPAction"), "#SetAVTransportURI") {
+			mu.Lock()
+			uri = soapArg(body, "CurrentURI")
+			mu.Unlock()
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	renderer, err := NewRenderer(WithEncoder(PNGEncoder{}))
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	photo := image.NewRGBA(image.Rect(0, 0, 64, 36))
+	for x := range 64 {
+		photo.Set(x, x%36, color.RGBA{uint8(x * 4), 0, 255, 255})
+	}
+
+	tv := &TV{Name: "Salon", ControlURL: mockTV.URL}
+	for _, c := range []Content{{Text: "Golden"}, {Image: photo}} {
+		preview, err := renderer.Preview(c)
+		if err != nil {
+			t.Fatalf("Preview failed: %v", err)
+		}
+		if err := renderer.Show(context.Background(), tv, c); err != nil {
+			t.Fatalf("Show failed: %v", err)
+		}
+
+		mu.Lock()
+		resp, err := http.Get(uri)
+		mu.Unlock()
+		if err != nil {
+			t.Fatalf("Fetch frame: %v", err)
+		}
+		sent, err := png.Decode(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Decode frame: %v", err)
+		}
+
+		if sent.Bounds() != preview.Bounds() {
+			t.Fatalf("Sent a %v frame, previewed %v", sent.Bounds(), preview.Bounds())
+		}
+		for y := sent.Bounds().Min.Y; y < sent.Bounds().Max.Y; y++ {
+			for x := sent.Bounds().Min.X; x < sent.Bounds().Max.X; x++ {
+				if !sameColor(sent.At(x, y), preview.At(x, y)) {
+					t.Fatalf("Pixel %d,%d sent %v, previewed %v", x, y, sent.At(x, y), preview.At(x, y))
+				}
+			}
+		}
+	}
+
+	pngData, err := renderer.PreviewPNG(Content{Text: "Golden"})
+	if err != nil {
+		t.Fatalf("PreviewPNG failed: %v", err)
+	}
+	if _, err := png.Decode(bytes.NewReader(pngData)); err != nil {
+		t.Errorf("PreviewPNG returned no PNG: %v", err)
+	}
+	if _, err := renderer.Preview(Content{VideoURL: "http://example.com/v.mp4"}); !errors.Is(err, ErrNoPreview) {
+		t.Errorf("Video preview err = %v, want ErrNoPreview", err)
+	}
+	if _, err := renderer.Preview(Content{}); !errors.Is(err, ErrEmptyContent) {
+		t.Errorf("Empty preview err = %v, want ErrEmptyContent", err)
+	}
+}
@@ -0,0 +1,181 @@
+package nimsforestsmarttv
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrNotPaired is returned when no credentials are stored for a TV and backend
+var ErrNotPaired = errors.New("not paired")
+
+// CredentialStore persists pairing credentials. TVs are identified by their
+// registry ID (UDN, or control URL when the TV has none).
+//
+// Registries keep credentials in their own file by default; plug in an
+// encrypted store with Registry.SetCredentialStore. Implementations backed
+// by an OS keyring only need to implement these three methods.
+type CredentialStore interface {
+	// Load returns the stored credentials or ErrNotPaired
+	Load(tvID, backend string) (Credentials, error)
+	// Store saves credentials, replacing any previous ones
+	Store(tvID, backend string, creds Credentials) error
+	// Delete removes stored credentials; deleting unknown ones is not an error
+	Delete(tvID, backend string) error
+}
+
+// credentialMap is an in-memory set of credentials: tvID -> backend -> creds
+type credentialMap map[string]map[string]Credentials
+
+func (m credentialMap) load(tvID, backend string) (Credentials, error) {
+	creds, ok := m[tvID][backend]
+	if !ok {
+		return nil, ErrNotPaired
+	}
+	return creds, nil
+}
+
+func (m credentialMap) store(tvID, backend string, creds Credentials) {
+	if m[tvID] == nil {
+		m[tvID] = make(map[string]Credentials)
+	}
+	m[tvID][backend] = creds
+}
+
+func (m credentialMap) delete(tvID, backend string) {
+	delete(m[tvID], backend)
+	if len(m[tvID]) == 0 {
+		delete(m, tvID)
+	}
+}
+
+// memoryCredentialStore keeps credentials in memory; registries save them in
+// plaintext alongside the TVs
+type memoryCredentialStore struct {
+	mu    sync.RWMutex
+	creds credentialMap
+}
+
+func newMemoryCredentialStore() *memoryCredentialStore {
+	return &memoryCredentialStore{creds: make(credentialMap)}
+}
+
+func (s *memoryCredentialStore) Load(tvID, backend string) (Credentials, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.creds.load(tvID, backend)
+}
+
+func (s *memoryCredentialStore) Store(tvID, backend string, creds Credentials) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.creds.store(tvID, backend, creds)
+	return nil
+}
+
+func (s *memoryCredentialStore) Delete(tvID, backend string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.creds.delete(tvID, backend)
+	return nil
+}
+
+// FileCredentialStore keeps credentials in a file encrypted with AES-GCM
+// under a user-supplied key. It is safe for concurrent use.
+type FileCredentialStore struct {
+	mu    sync.Mutex
+	path  string
+	aead  cipher.AEAD
+	creds credentialMap
+}
+
+// NewFileCredentialStore opens the encrypted credentials file at path,
+// creating it on the first Store. The key must be 16, 24 or 32 bytes
+// (AES-128, AES-192 or AES-256); a wrong key fails to decrypt an existing
+// file rather than silently starting empty.
+func NewFileCredentialStore(path string, key []byte) (*FileCredentialStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+
+	s := &FileCredentialStore{path: path, aead: aead, creds: make(credentialMap)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read credentials: %w", err)
+	}
+
+	nonceSize := aead.NonceSize()
+	if len(data) < nonceSize {
+		return nil, fmt.Errorf("read credentials: file is truncated")
+	}
+	plain, err := aead.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt credentials (wrong key?): %w", err)
+	}
+	if err := json.Unmarshal(plain, &s.creds); err != nil {
+		return nil, fmt.Errorf("parse credentials: %w", err)
+	}
+
+	return s, nil
+}
+
+// Load returns the stored credentials or ErrNotPaired
+func (s *FileCredentialStore) Load(tvID, backend string) (Credentials, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.creds.load(tvID, backend)
+}
+
+// Store saves credentials and rewrites the encrypted file
+func (s *FileCredentialStore) Store(tvID, backend string, creds Credentials) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.creds.store(tvID, backend, creds)
+	return s.save()
+}
+
+// Delete removes credentials and rewrites the encrypted file
+func (s *FileCredentialStore) Delete(tvID, backend string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.creds.delete(tvID, backend)
+	return s.save()
+}
+
+// save encrypts the credentials with a fresh nonce and writes them atomically
+func (s *FileCredentialStore) save() error {
+	plain, err := json.Marshal(s.creds)
+	if err != nil {
+		return fmt.Errorf("encode credentials: %w", err)
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("generate nonce: %w", err)
+	}
+	data := s.aead.Seal(nonce, nonce, plain, nil)
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("create credentials directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write credentials: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
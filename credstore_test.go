@@ -0,0 +1,79 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestFileCredentialStore tests that credentials round-trip encrypted
+func TestFileCredentialStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.bin")
+	key := bytes.Repeat([]byte{7}, 32)
+
+	store, err := NewFileCredentialStore(path, key)
+	if err != nil {
+		t.Fatalf("NewFileCredentialStore failed: %v", err)
+	}
+	if err := store.Store("uuid:salon", "samsung", Credentials{"token": "s3cret-token"}); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if bytes.Contains(data, []byte("s3cret-token")) {
+		t.Error("Expected the token to be encrypted on disk")
+	}
+
+	reopened, err := NewFileCredentialStore(path, key)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	creds, err := reopened.Load("uuid:salon", "samsung")
+	if err != nil || creds["token"] != "s3cret-token" {
+		t.Errorf("Expected stored token, got %v, %v", creds, err)
+	}
+	if _, err := reopened.Load("uuid:salon", "lg"); !errors.Is(err, ErrNotPaired) {
+		t.Errorf("Expected ErrNotPaired, got %v", err)
+	}
+
+	if _, err := NewFileCredentialStore(path, bytes.Repeat([]byte{8}, 32)); err == nil {
+		t.Error("Expected a wrong key to fail")
+	}
+}
+
+// TestRegistryCredentialMigration tests moving plaintext credentials into a store
+func TestRegistryCredentialMigration(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "registry.json")
+
+	reg, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatalf("LoadRegistry failed: %v", err)
+	}
+	tv := &TV{Name: "TV Salon", UDN: "uuid:salon"}
+	reg.SetCredentials(tv, "samsung", Credentials{"token": "s3cret-token"})
+
+	store, err := NewFileCredentialStore(filepath.Join(dir, "credentials.bin"), bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatalf("NewFileCredentialStore failed: %v", err)
+	}
+	if err := reg.SetCredentialStore(store); err != nil {
+		t.Fatalf("SetCredentialStore failed: %v", err)
+	}
+	if err := reg.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if bytes.Contains(data, []byte("s3cret-token")) {
+		t.Error("Expected the registry file to no longer hold the token")
+	}
+	if creds, err := reg.Credentials(tv, "samsung"); err != nil || creds["token"] != "s3cret-token" {
+		t.Errorf("Expected migrated token, got %v, %v", creds, err)
+	}
+}
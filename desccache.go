@@ -0,0 +1,74 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// descCache holds device descriptions that came with an ETag, keyed by
+// location. Rediscovering a TV sends If-None-Match, so TVs that support it
+// answer 304 instead of sending their description again.
+var descCache = struct {
+	sync.Mutex
+	entries map[string]cachedDescription
+}{entries: make(map[string]cachedDescription)}
+
+// maxCachedDescriptions bounds the description and SCPD caches
+const maxCachedDescriptions = 256
+
+// cachedDescription is a device description and the ETag it was served with
+type cachedDescription struct {
+	etag string
+	data []byte
+}
+
+// fetchDescription fetches the device description at location, or returns
+// the cached one when the TV reports it unchanged
+func fetchDescription(ctx context.Context, location string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", location, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	descCache.Lock()
+	cached, ok := descCache.entries[location]
+	descCache.Unlock()
+	if ok {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if ok && resp.StatusCode == http.StatusNotModified {
+		return cached.data, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	data, err := readLimited(resp.Body, maxXMLSize)
+	if err != nil {
+		return nil, fmt.Errorf("read device description: %w", err)
+	}
+
+	descCache.Lock()
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		// Locations come from the network, so the cache mustn't grow freely
+		if len(descCache.entries) >= maxCachedDescriptions {
+			clear(descCache.entries)
+		}
+		descCache.entries[location] = cachedDescription{etag: etag, data: data}
+	} else {
+		delete(descCache.entries, location)
+	}
+	descCache.Unlock()
+	return data, nil
+}
@@ -0,0 +1,52 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDescriptionCache(t *testing.T) {
+	var full, notModified atomic.Int32
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, testDescription)
+	}))
+	defer mockTV.Close()
+
+	location := mockTV.URL + "/dmr"
+	for range 3 {
+		tv, err := fetchTVInfo(context.Background(), location, false)
+		if err != nil {
+			t.Fatalf("fetchTVInfo failed: %v", err)
+		}
+		if tv.Name != "TV Salon" || tv.ControlURL != mockTV.URL+"/upnp/control/AVTransport" {
+			t.Errorf("Unexpected TV: %+v", tv)
+		}
+	}
+	if full.Load() != 1 || notModified.Load() != 2 {
+		t.Errorf("Expected 1 full fetch and 2 revalidations, got %d and %d", full.Load(), notModified.Load())
+	}
+}
+
+func TestParseDeviceDescriptionBytes(t *testing.T) {
+	tv, err := ParseDeviceDescriptionBytes([]byte(testDescription), "http://192.168.1.20:9197/dmr")
+	if err != nil {
+		t.Fatalf("ParseDeviceDescriptionBytes failed: %v", err)
+	}
+	if tv.ControlURL != "http://192.168.1.20:9197/upnp/control/AVTransport" || tv.Actions != nil {
+		t.Errorf("Unexpected TV: %+v", tv)
+	}
+	if _, err := ParseDeviceDescriptionBytes([]byte("<html>"), "http://192.168.1.20/"); err == nil {
+		t.Error("Expected an error for a non-description document")
+	}
+}
@@ -0,0 +1,75 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Protocols a TV is driven with (see TV.Protocol)
+const (
+	ProtocolDLNA    = ""        // UPnP AVTransport
+	ProtocolCast    = "cast"    // Google Cast v2 (Chromecast and Cast-enabled TVs)
+	ProtocolAirPlay = "airplay" // AirPlay photos and video (Apple TV and AirPlay TVs)
+)
+
+// Media is something a Device is told to show
+type Media struct {
+	URL         string
+	ContentType string // e.g. "image/jpeg", "video/mp4" (empty = guessed from the URL)
+	Title       string
+}
+
+// Device is a screen media can be shown on, whatever protocol it speaks.
+// The Renderer's Display and Stream methods use it for TVs that aren't
+// DLNA renderers, so they work the same on both.
+type Device interface {
+	// Load shows media on the device and starts playing it
+	Load(ctx context.Context, media Media) error
+
+	// Stop stops whatever the device is playing
+	Stop(ctx context.Context) error
+}
+
+// Device returns the backend that drives the TV, by its Protocol
+func (tv *TV) Device() Device {
+	switch tv.Protocol {
+	case ProtocolCast:
+		return &castDevice{tv: tv}
+	case ProtocolAirPlay:
+		return &airplayDevice{tv: tv, limits: DefaultLimits}
+	}
+	return &dlnaDevice{tv: tv}
+}
+
+// device returns the backend for the TV, set up with the renderer's URL
+// policy and limits
+func (r *Renderer) device(tv *TV) Device {
+	if tv.Protocol == ProtocolAirPlay {
+		return &airplayDevice{tv: tv, policy: r.urlPolicy, trusted: r.server.URL(), limits: r.limits}
+	}
+	return tv.Device()
+}
+
+// dlnaDevice drives a DLNA renderer over AVTransport
+type dlnaDevice struct {
+	tv *TV
+}
+
+func (d *dlnaDevice) Load(ctx context.Context, media Media) error {
+	if strings.HasPrefix(media.ContentType, "image/") {
+		if err := d.tv.setAVTransportURI(ctx, media.URL, imageRes{contentType: media.ContentType}); err != nil {
+			return fmt.Errorf("set URI: %w", err)
+		}
+	} else if err := d.tv.setAVTransportURIForVideo(ctx, media.URL, media.Title); err != nil {
+		return fmt.Errorf("set video URI: %w", err)
+	}
+	if err := d.tv.play(ctx); err != nil {
+		return fmt.Errorf("play: %w", err)
+	}
+	return nil
+}
+
+func (d *dlnaDevice) Stop(ctx context.Context) error {
+	return d.tv.stop(ctx)
+}
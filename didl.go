@@ -0,0 +1,96 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"strings"
+)
+
+// defaultImageClass is the DIDL-Lite class of images for TVs without quirks
+const defaultImageClass = "object.item.imageItem.photo"
+
+// Quirks adjust the metadata sent to TVs that deviate from what most DLNA
+// renderers accept. They are filled in from the manufacturer at discovery
+// and can be edited in the registry for TVs we don't know about.
+type Quirks struct {
+	// ImageClass is the DIDL-Lite class of images (empty =
+	// object.item.imageItem.photo). Some TVs only accept
+	// object.item.imageItem.
+	ImageClass string `json:",omitempty"`
+
+	// ResolutionInRes adds resolution and size attributes to the res
+	// element of images, which some Sony models require
+	ResolutionInRes bool `json:",omitempty"`
+}
+
+// knownQuirks are the quirks of TVs by lower-case manufacturer
+var knownQuirks = map[string]Quirks{
+	"sony": {ResolutionInRes: true},
+}
+
+// QuirksFor returns the known quirks of a TV model
+func QuirksFor(manufacturer, model string) Quirks {
+	m := strings.ToLower(manufacturer)
+	for name, q := range knownQuirks {
+		if strings.Contains(m, name) {
+			return q
+		}
+	}
+	return Quirks{}
+}
+
+// imageRes describes an image for the res element of its metadata
+type imageRes struct {
+	contentType   string
+	width, height int // 0 if unknown
+	size          int // Bytes, 0 if unknown
+}
+
+// imageMetadata returns the DIDL-Lite metadata for an image, unescaped
+func (tv *TV) imageMetadata(uri string, res imageRes) string {
+	return didlItem("Image", tv.imageClass(), tv.imageResElement(uri, res))
+}
+
+// imageClass returns the DIDL-Lite class the TV accepts for images
+func (tv *TV) imageClass() string {
+	if tv.Quirks.ImageClass == "" {
+		return defaultImageClass
+	}
+	return tv.Quirks.ImageClass
+}
+
+// imageResElement returns the res element of an image
+func (tv *TV) imageResElement(uri string, res imageRes) string {
+	attrs := fmt.Sprintf(`protocolInfo="http-get:*:%s:*"`, res.contentType)
+	if tv.Quirks.ResolutionInRes {
+		if res.width > 0 && res.height > 0 {
+			attrs += fmt.Sprintf(` resolution="%dx%d"`, res.width, res.height)
+		}
+		if res.size > 0 {
+			attrs += fmt.Sprintf(` size="%d"`, res.size)
+		}
+	}
+	return fmt.Sprintf(`<res %s>%s</res>`, attrs, uri)
+}
+
+// didlItem returns DIDL-Lite metadata for a single item, unescaped. body
+// holds the item's res and other elements.
+func didlItem(title, class, body string) string {
+	return fmt.Sprintf(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/"><item id="1" parentID="0" restricted="1"><dc:title>%s</dc:title><upnp:class>%s</upnp:class>%s</item></DIDL-Lite>`, escapeXML(title), class, body)
+}
+
+// imageRes describes an image stored on our server. Images streamed from
+// a reader have no known size yet and only get their content type.
+func (r *Renderer) imageRes(imageURL string, contentType string) imageRes {
+	res := imageRes{contentType: contentType}
+	stored, ok := r.server.lookup(imageURL)
+	if !ok {
+		return res
+	}
+	res.size = len(stored.data)
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(stored.data)); err == nil {
+		res.width, res.height = cfg.Width, cfg.Height
+	}
+	return res
+}
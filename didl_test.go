@@ -0,0 +1,79 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestImageMetadataQuirks tests that quirks change the image class and
+// res attributes
+func TestImageMetadataQuirks(t *testing.T) {
+	res := imageRes{contentType: "image/jpeg", width: 1920, height: 1080, size: 2048}
+
+	plain := (&TV{}).imageMetadata("http://host/a.jpg", res)
+	if !strings.Contains(plain, "<upnp:class>object.item.imageItem.photo</upnp:class>") {
+		t.Errorf("Expected the photo class by default: %s", plain)
+	}
+	if strings.Contains(plain, "resolution=") {
+		t.Errorf("Expected no resolution by default: %s", plain)
+	}
+
+	tv := &TV{Quirks: Quirks{ImageClass: "object.item.imageItem", ResolutionInRes: true}}
+	quirky := tv.imageMetadata("http://host/a.jpg", res)
+	for _, want := range []string{
+		"<upnp:class>object.item.imageItem</upnp:class>",
+		`resolution="1920x1080"`,
+		`size="2048"`,
+	} {
+		if !strings.Contains(quirky, want) {
+			t.Errorf("Expected %s in %s", want, quirky)
+		}
+	}
+
+	if q := QuirksFor("Sony Corporation", "KD-55XH9005"); !q.ResolutionInRes {
+		t.Errorf("Expected Sony TVs to get resolution attributes, got %+v", q)
+	}
+	if q := QuirksFor("JVC", "LT-43"); q != (Quirks{}) {
+		t.Errorf("Expected no quirks for JVC, got %+v", q)
+	}
+}
+
+// TestDisplaySendsResolution tests that the renderer sends the size of the
+// image to TVs that need it
+func TestDisplaySendsResolution(t *testing.T) {
+	var mu sync.Mutex
+	var metadata string
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(r.Header.Get("SOAPAction"), "#SetAVTransportURI") {
+			mu.Lock()
+			metadata = soapArg(body, "CurrentURIMetaData")
+			mu.Unlock()
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	tv := &TV{Name: "Bravia", ControlURL: mockTV.URL, Quirks: QuirksFor("Sony", "")}
+	if err := renderer.DisplayImage(context.Background(), tv, image.NewRGBA(image.Rect(0, 0, 64, 48))); err != nil {
+		t.Fatalf("DisplayImage failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !strings.Contains(metadata, `resolution="64x48"`) || !strings.Contains(metadata, ` size="`) {
+		t.Errorf("Expected resolution and size in metadata: %s", metadata)
+	}
+}
@@ -0,0 +1,94 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// ErrNoRenderer is returned by FromIP when no media renderer is found at
+// the address
+var ErrNoRenderer = errors.New("no media renderer found")
+
+// descriptionProbes are where well-known TVs serve their device
+// description, tried by FromIP when the TV doesn't answer an M-SEARCH
+var descriptionProbes = []struct {
+	port int
+	path string
+}{
+	{9197, "/dmr"},              // Samsung
+	{52323, "/dmr.xml"},         // Sony
+	{49152, "/description.xml"}, // libupnp-based renderers
+}
+
+// FromLocation returns the TV whose device description is at location
+// (the LOCATION of an SSDP answer, e.g. "http://192.168.1.20:9197/dmr"),
+// for networks where multicast is blocked and Discover finds nothing
+func FromLocation(ctx context.Context, location string) (*TV, error) {
+	tv, err := fetchTVInfo(ctx, location, false)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", location, err)
+	}
+	return tv, nil
+}
+
+// FromIP returns the TV at ip, for networks where multicast is blocked
+// (VLANs, Docker, VPNs) but the TV can be reached directly. It asks the TV
+// for its description with a unicast M-SEARCH, to "ip:port" for a
+// non-standard SSDP port, and then tries the description URLs of
+// well-known TVs.
+func FromIP(ctx context.Context, ip string) (*TV, error) {
+	host, port := ip, "1900"
+	if h, p, err := net.SplitHostPort(ip); err == nil {
+		host, port = h, p
+	}
+
+	// A unicast search names the host it is sent to, as UDA 1.1 asks
+	search := DiscoverOptions{}.searches(net.JoinHostPort(host, port))[0]
+
+	var errs []error
+	if locations, err := searchIP(ctx, ip, string(search)); err == nil {
+		for _, location := range locations {
+			tv, err := FromLocation(ctx, location)
+			if err == nil {
+				return tv, nil
+			}
+			errs = append(errs, err)
+		}
+	} else if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	// Some TVs only answer multicast searches; probe them all at once
+	type probe struct {
+		tv  *TV
+		err error
+	}
+	results := make([]chan probe, len(descriptionProbes))
+	for i, p := range descriptionProbes {
+		results[i] = make(chan probe, 1)
+		location := "http://" + net.JoinHostPort(host, strconv.Itoa(p.port)) + p.path
+		go func() {
+			tv, err := FromLocation(ctx, location)
+			results[i] <- probe{tv, err}
+		}()
+	}
+	var found *TV
+	for _, result := range results {
+		if r := <-result; r.err == nil && found == nil {
+			found = r.tv
+		}
+	}
+	if found != nil {
+		return found, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%w at %s: %w", ErrNoRenderer, ip, errors.Join(errs...))
+	}
+	return nil, fmt.Errorf("%w at %s", ErrNoRenderer, ip)
+}
@@ -0,0 +1,100 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// descriptionServer serves testDescription at /dmr
+func descriptionServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dmr" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, testDescription)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFromLocation(t *testing.T) {
+	server := descriptionServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tv, err := FromLocation(ctx, server.URL+"/dmr")
+	if err != nil {
+		t.Fatalf("FromLocation failed: %v", err)
+	}
+	if tv.Name != "TV Salon" || tv.ControlURL != server.URL+"/upnp/control/AVTransport" {
+		t.Errorf("Unexpected TV: %+v", tv)
+	}
+	if _, err := FromLocation(ctx, server.URL+"/missing"); err == nil {
+		t.Error("Expected an error for a missing description")
+	}
+}
+
+func TestFromIP(t *testing.T) {
+	server := descriptionServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The TV answers a unicast M-SEARCH, but only one addressed to itself
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		n, from, err := conn.ReadFromUDP(buf)
+		search := string(buf[:n])
+		if err != nil || !strings.Contains(search, "MediaRenderer") || !strings.Contains(search, "HOST: "+conn.LocalAddr().String()+"\r\n") {
+			return
+		}
+		reply := fmt.Sprintf("HTTP/1.1 200 OK\r\nST: urn:schemas-upnp-org:device:MediaRenderer:1\r\nLOCATION: %s/dmr\r\nUSN: uuid:tv\r\n\r\n", server.URL)
+		conn.WriteToUDP([]byte(reply), from)
+	}()
+	tv, err := FromIP(ctx, conn.LocalAddr().String())
+	if err != nil || tv.Name != "TV Salon" {
+		t.Fatalf("FromIP = %+v, %v", tv, err)
+	}
+
+	// The TV ignores M-SEARCH but serves its description where TVs of its
+	// make do
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+	probes := descriptionProbes
+	defer func() { descriptionProbes = probes }()
+	descriptionProbes = []struct {
+		port int
+		path string
+	}{{1, "/dmr"}, {port, "/dmr"}}
+
+	silent, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer silent.Close()
+	tv, err = FromIP(ctx, silent.LocalAddr().String())
+	if err != nil || tv.Name != "TV Salon" {
+		t.Fatalf("FromIP without SSDP = %+v, %v", tv, err)
+	}
+
+	descriptionProbes = descriptionProbes[:1]
+	if _, err := FromIP(ctx, silent.LocalAddr().String()); !errors.Is(err, ErrNoRenderer) {
+		t.Errorf("Expected ErrNoRenderer, got %v", err)
+	}
+}
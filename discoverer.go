@@ -0,0 +1,241 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DiscoveryEventType says what happened to a TV
+type DiscoveryEventType int
+
+const (
+	TVAdded   DiscoveryEventType = iota + 1 // A TV answered for the first time
+	TVRemoved                               // A known TV stopped answering
+)
+
+// String returns "added" or "removed"
+func (t DiscoveryEventType) String() string {
+	switch t {
+	case TVAdded:
+		return "added"
+	case TVRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// DiscoveryEvent is a TV appearing on or leaving the network
+type DiscoveryEvent struct {
+	Type DiscoveryEventType
+	TV   TV
+}
+
+// Discoverer discovers TVs continuously and reports the ones that appear
+// or go offline as events, so long-running apps don't need to re-scan
+// themselves. A TV missing from a scan is probed before it counts as
+// removed, since SSDP answers get lost now and then. It is safe for
+// concurrent use.
+type Discoverer struct {
+	opts     DiscoverOptions
+	interval time.Duration
+	registry *Registry
+	events   chan DiscoveryEvent
+
+	// scan runs one discovery; replaced in tests
+	scan func(ctx context.Context) ([]TV, error)
+
+	mu      sync.Mutex
+	tvs     map[string]*TV // keyed by registryKey
+	lastErr error
+}
+
+// NewDiscoverer creates a discoverer scanning with opts every interval
+// (default 1m). TVs it finds are added to registry, if not nil; TVs that
+// go offline stay there, as zones may refer to them.
+func NewDiscoverer(registry *Registry, opts DiscoverOptions, interval time.Duration) *Discoverer {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	d := &Discoverer{
+		opts:     opts,
+		interval: interval,
+		registry: registry,
+		events:   make(chan DiscoveryEvent, 16),
+		tvs:      make(map[string]*TV),
+	}
+	d.scan = func(ctx context.Context) ([]TV, error) {
+		result := DiscoverPartial(ctx, d.opts)
+		return result.TVs, result.Err
+	}
+	return d
+}
+
+// Events returns the channel events are delivered on. It is closed when Run
+// returns. Run waits for events to be received, so keep reading.
+func (d *Discoverer) Events() <-chan DiscoveryEvent {
+	return d.events
+}
+
+// TVs returns the TVs currently online, sorted by name
+func (d *Discoverer) TVs() []*TV {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tvs := make([]*TV, 0, len(d.tvs))
+	for _, tv := range d.tvs {
+		copied := *tv
+		tvs = append(tvs, &copied)
+	}
+	sort.Slice(tvs, func(i, j int) bool { return tvs[i].Name < tvs[j].Name })
+	return tvs
+}
+
+// Err returns why the last scan failed (nil = ok)
+func (d *Discoverer) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.lastErr
+}
+
+// Run scans right away and then every interval until ctx is done. With
+// DiscoverOptions.ListenMulticast it also listens for TVs announcing
+// themselves in between, which are added or removed right away.
+func (d *Discoverer) Run(ctx context.Context) error {
+	defer close(d.events)
+
+	if d.opts.ListenMulticast {
+		listenCtx, cancel := context.WithCancel(ctx)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ListenNotify(listenCtx, d.opts, func(a Announcement) { d.announce(listenCtx, a) })
+		}()
+		// The listener must be done sending before events is closed
+		defer wg.Wait()
+		defer cancel()
+	}
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.Scan(ctx); err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// announce adds a TV that said ssdp:alive and removes one that said
+// ssdp:byebye
+func (d *Discoverer) announce(ctx context.Context, a Announcement) {
+	var ev DiscoveryEvent
+	d.mu.Lock()
+	if a.Alive {
+		key := registryKey(&a.TV)
+		if _, ok := d.tvs[key]; !ok {
+			ev = DiscoveryEvent{Type: TVAdded, TV: a.TV}
+		}
+		d.tvs[key] = &a.TV
+	} else {
+		for key, tv := range d.tvs {
+			if tv.UDN == a.UDN {
+				delete(d.tvs, key)
+				ev = DiscoveryEvent{Type: TVRemoved, TV: *tv}
+			}
+		}
+	}
+	d.mu.Unlock()
+
+	if a.Alive && d.registry != nil {
+		d.registry.AddTV(a.TV)
+	}
+	if ev.Type != 0 {
+		select {
+		case d.events <- ev:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// Scan discovers once and sends events for the TVs that appeared or went
+// offline since the previous scan
+func (d *Discoverer) Scan(ctx context.Context) error {
+	found, err := d.scan(ctx)
+	d.mu.Lock()
+	d.lastErr = err
+	d.mu.Unlock()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	var events []DiscoveryEvent
+	seen := make(map[string]bool, len(found))
+	d.mu.Lock()
+	for _, tv := range found {
+		key := registryKey(&tv)
+		seen[key] = true
+		if _, ok := d.tvs[key]; !ok {
+			events = append(events, DiscoveryEvent{Type: TVAdded, TV: tv})
+		}
+		// Known TVs may have moved to another address
+		d.tvs[key] = &tv
+	}
+	var missing []*TV
+	for key, tv := range d.tvs {
+		if !seen[key] {
+			missing = append(missing, tv)
+		}
+	}
+	d.mu.Unlock()
+
+	if d.registry != nil {
+		for _, tv := range found {
+			d.registry.AddTV(tv)
+		}
+	}
+
+	// A TV that still accepts connections only missed the search; a failed
+	// scan says nothing about the TVs, so nobody is removed then
+	if err == nil && len(missing) > 0 {
+		gone := make([]bool, len(missing))
+		fanOut(ctx, missing, func(ctx context.Context, tv *TV) error {
+			for i, m := range missing {
+				if m == tv {
+					gone[i] = Probe(ctx, tv) != nil
+				}
+			}
+			return nil
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		d.mu.Lock()
+		for i, tv := range missing {
+			// A byebye may have removed it meanwhile
+			if key := registryKey(tv); gone[i] && d.tvs[key] == tv {
+				delete(d.tvs, key)
+				events = append(events, DiscoveryEvent{Type: TVRemoved, TV: *tv})
+			}
+		}
+		d.mu.Unlock()
+	}
+
+	for _, ev := range events {
+		select {
+		case d.events <- ev:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
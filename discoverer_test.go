@@ -0,0 +1,118 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiscoverer(t *testing.T) {
+	online := httptest.NewServer(http.NotFoundHandler())
+	defer online.Close()
+	offline := httptest.NewServer(http.NotFoundHandler())
+	offline.Close()
+
+	salon := TV{Name: "Salon", UDN: "uuid:salon", ControlURL: online.URL + "/avt"}
+	lobby := TV{Name: "Lobby", UDN: "uuid:lobby", ControlURL: offline.URL + "/avt"}
+	kitchen := TV{Name: "Kitchen", UDN: "uuid:kitchen", ControlURL: online.URL + "/avt2"}
+	scans := [][]TV{
+		{salon, lobby},
+		{salon, lobby},
+		{kitchen}, // Salon missed the search but still answers; Lobby is gone
+	}
+
+	reg := NewRegistry()
+	d := NewDiscoverer(reg, DiscoverOptions{}, time.Hour)
+	d.scan = func(ctx context.Context) ([]TV, error) {
+		found := scans[0]
+		scans = scans[1:]
+		return found, nil
+	}
+
+	ctx := context.Background()
+	var got []string
+	for range 3 {
+		if err := d.Scan(ctx); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+	drain:
+		for {
+			select {
+			case ev := <-d.Events():
+				got = append(got, ev.Type.String()+" "+ev.TV.Name)
+			default:
+				break drain
+			}
+		}
+	}
+
+	want := []string{"added Salon", "added Lobby", "added Kitchen", "removed Lobby"}
+	if len(got) != len(want) {
+		t.Fatalf("events %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	tvs := d.TVs()
+	if len(tvs) != 2 || tvs[0].Name != "Kitchen" || tvs[1].Name != "Salon" {
+		t.Errorf("online TVs %v, want Kitchen and Salon", tvs)
+	}
+	if len(reg.TVs()) != 3 {
+		t.Errorf("registry has %d TVs, want all 3 ever seen", len(reg.TVs()))
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Replace(testDescription, "<friendlyName>", "<UDN>uuid:salon</UDN><friendlyName>", 1))
+	}))
+	defer mockTV.Close()
+
+	alive := func(nt string) ssdpResponse {
+		return ssdpResponse{Notify: true, NTS: "ssdp:alive", NT: nt, USN: "uuid:salon::" + nt, Location: mockTV.URL + "/dmr"}
+	}
+	byebye := func(nt string) ssdpResponse {
+		return ssdpResponse{Notify: true, NTS: "ssdp:byebye", NT: nt, USN: "uuid:salon::" + nt}
+	}
+	packets := make(chan ssdpResponse, 10)
+	for _, p := range []ssdpResponse{
+		alive("urn:schemas-upnp-org:device:MediaRenderer:1"),
+		alive("urn:schemas-upnp-org:service:AVTransport:1"), // Same TV again
+		alive("urn:schemas-upnp-org:service:ContentDirectory:1"),
+		{Location: mockTV.URL + "/dmr"}, // An M-SEARCH reply
+		byebye("upnp:rootdevice"),
+		byebye("urn:schemas-upnp-org:device:MediaRenderer:1"),
+		alive("urn:schemas-upnp-org:device:MediaRenderer:1"), // Back again
+	} {
+		packets <- p
+	}
+	close(packets)
+
+	d := NewDiscoverer(nil, DiscoverOptions{}, time.Hour)
+	var got []string
+	notifications(context.Background(), packets, false, func(a Announcement) {
+		got = append(got, fmt.Sprintf("%v %s %s", a.Alive, a.UDN, a.TV.Name))
+		d.announce(context.Background(), a)
+	})
+
+	want := "true uuid:salon TV Salon|false uuid:salon |true uuid:salon TV Salon"
+	if strings.Join(got, "|") != want {
+		t.Errorf("announcements %q, want %q", strings.Join(got, "|"), want)
+	}
+	var events []string
+	for range 3 {
+		ev := <-d.Events()
+		events = append(events, ev.Type.String())
+	}
+	if strings.Join(events, " ") != "added removed added" {
+		t.Errorf("events %v, want added removed added", events)
+	}
+}
@@ -2,11 +2,15 @@ package nimsforestsmarttv
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"iter"
 	"net"
-	"net/http"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,82 +19,638 @@ const (
 	ssdpSearch  = "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 2\r\nST: urn:schemas-upnp-org:device:MediaRenderer:1\r\n\r\n"
 )
 
-// ssdpResponse represents a parsed SSDP response
+// Search target of media renderers, always searched for
+const mediaRendererST = "urn:schemas-upnp-org:device:MediaRenderer:1"
+
+// maxSSDPRepeatInterval is the most time between repeated M-SEARCHes
+const maxSSDPRepeatInterval = 500 * time.Millisecond
+
+// ssdpResponse represents a parsed SSDP response or NOTIFY announcement
 type ssdpResponse struct {
+	Notify   bool // NOTIFY announcement rather than an M-SEARCH reply
 	Location string
 	Server   string
 	USN      string
+	NT       string // Notification type (NOTIFY only)
+	NTS      string // ssdp:alive or ssdp:byebye (NOTIFY only)
+}
+
+// DiscoverOptions configures discovery
+type DiscoverOptions struct {
+	Timeout time.Duration // How long to collect responses (default 5s)
+
+	// ListenMulticast additionally binds the SSDP port and joins the
+	// multicast group on every interface, so ssdp:alive NOTIFY
+	// announcements are received as well as M-SEARCH replies. The socket
+	// is opened with SO_REUSEADDR (plus SO_REUSEPORT where the platform
+	// requires it) so it can coexist with other SSDP listeners. A
+	// Discoverer then also listens between its scans.
+	ListenMulticast bool
+
+	// ListenPort is the port joined when ListenMulticast is set (default 1900)
+	ListenPort int
+
+	// SweepSubnets lists CIDRs (e.g. "192.168.1.0/24") whose addresses each
+	// get a unicast M-SEARCH, for networks where multicast doesn't reach
+	// the TVs. Large subnets are capped at maxSweepHosts addresses, and
+	// subnets larger than a /16 are refused.
+	SweepSubnets []string
+
+	// NoSweepFallback disables the automatic unicast sweep of the local
+	// subnets that runs when nothing answered inside a container
+	NoSweepFallback bool
+
+	// LenientXML accepts slightly malformed device and service
+	// descriptions (bare ampersands, HTML entities, stray control
+	// characters, invalid UTF-8, unknown charsets) that strict parsing,
+	// the default, rejects
+	LenientXML bool
+
+	// Cast also browses for Google Cast devices over mDNS (see
+	// DiscoverCast), which are returned alongside the DLNA renderers
+	Cast bool
+
+	// AirPlay also browses for AirPlay receivers over mDNS (see
+	// DiscoverAirPlay). Receivers at the address of a TV found otherwise
+	// are left out, so TVs speaking DLNA and AirPlay are listed once.
+	AirPlay bool
+
+	// SearchTargets are searched for in addition to media renderers, e.g.
+	// "urn:dial-multiscreen-org:service:dial:1" for TVs that only answer
+	// DIAL searches. They only help find renderers: devices found are
+	// kept only if their description has an AVTransport service, so e.g.
+	// a MediaServer search finds no NAS that isn't also a renderer.
+	SearchTargets []string
+
+	// MX is the most seconds devices wait before answering (1 to 5,
+	// default 2). Larger values spread the answers of busy networks out;
+	// keep Timeout above it.
+	MX int
+
+	// Repeat sends each M-SEARCH this many times (default once), spread
+	// over the first half of Timeout, for lossy Wi-Fi
+	Repeat int
+
+	// Interface binds the SSDP search and multicast listening to one
+	// network interface (e.g. "eth0") on multi-homed hosts. Cast and
+	// AirPlay browsing are not affected.
+	Interface string
+}
+
+// DiscoverResult is the outcome of a discovery scan
+type DiscoverResult struct {
+	// TVs found before the scan ended
+	TVs []TV
+
+	// Interrupted is true when the context ended the scan before the
+	// timeout. TVs then holds whatever answered until that point.
+	Interrupted bool
+
+	// Err reports real failures such as being unable to open the socket
+	// or send the search. It is never a context error.
+	Err error
 }
 
 // Discover finds Smart TVs on the local network using SSDP.
 // It returns a list of discovered TVs within the given timeout.
+//
+// If ctx is done before the timeout, the TVs found so far are returned
+// together with ctx.Err(). Use DiscoverPartial to treat that as success.
 func Discover(ctx context.Context, timeout time.Duration) ([]TV, error) {
-	// Create UDP connection for multicast
-	addr, err := net.ResolveUDPAddr("udp4", ssdpAddr)
-	if err != nil {
-		return nil, fmt.Errorf("resolve SSDP address: %w", err)
+	return DiscoverWithOptions(ctx, DiscoverOptions{Timeout: timeout})
+}
+
+// DiscoverWithOptions is like Discover with the search configured by opts,
+// e.g. to search for more service types, repeat the search on lossy
+// Wi-Fi, or search on one interface of a multi-homed host:
+//
+//	tvs, err := smarttv.DiscoverWithOptions(ctx, smarttv.DiscoverOptions{
+//		MX:        3,
+//		Repeat:    3,
+//		Interface: "wlan0",
+//		Timeout:   5 * time.Second,
+//	})
+func DiscoverWithOptions(ctx context.Context, opts DiscoverOptions) ([]TV, error) {
+	var tvs []TV
+	err := discover(ctx, opts, func(tv TV) bool {
+		tvs = append(tvs, tv)
+		return true
+	})
+	return mergeDuplicates(tvs), err
+}
+
+// DiscoverPartial is like Discover but treats the context ending as a
+// graceful stop: the TVs found so far are returned with Interrupted set
+// and a nil Err, which is reserved for real failures.
+func DiscoverPartial(ctx context.Context, opts DiscoverOptions) DiscoverResult {
+	var result DiscoverResult
+	err := discover(ctx, opts, func(tv TV) bool {
+		result.TVs = append(result.TVs, tv)
+		return true
+	})
+
+	if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		result.Interrupted = true
+		err = nil
 	}
+	result.TVs = mergeDuplicates(result.TVs)
+	result.Err = err
+	return result
+}
 
-	conn, err := net.ListenUDP("udp4", nil)
-	if err != nil {
-		return nil, fmt.Errorf("listen UDP: %w", err)
+// Devices returns an iterator over TVs as they answer the SSDP search:
+//
+//	for tv, err := range smarttv.Devices(ctx, smarttv.DiscoverOptions{}) {
+//		if err != nil {
+//			return err
+//		}
+//		if tv.Name == "TV Salon" {
+//			break // stops the scan
+//		}
+//	}
+//
+// A failure is yielded once, with a zero TV, as the last element.
+// TVs answering on several addresses are yielded once, on the address
+// that answered first.
+func Devices(ctx context.Context, opts DiscoverOptions) iter.Seq2[TV, error] {
+	return func(yield func(TV, error) bool) {
+		stopped := false
+		udns := make(map[string]bool)
+		err := discover(ctx, opts, func(tv TV) bool {
+			if tv.UDN != "" {
+				if udns[tv.UDN] {
+					return true
+				}
+				udns[tv.UDN] = true
+			}
+			if !yield(tv, nil) {
+				stopped = true
+			}
+			return !stopped
+		})
+		if err != nil && !stopped {
+			yield(TV{}, err)
+		}
 	}
-	defer conn.Close()
+}
 
-	// Set read deadline
-	conn.SetReadDeadline(time.Now().Add(timeout))
+// discover runs an SSDP search and calls found for each new TV until the
+// timeout expires, ctx is done, or found returns false
+func discover(ctx context.Context, opts DiscoverOptions, found func(TV) bool) (err error) {
+	ctx, span := startSpan(ctx, "smarttv.discover")
+	defer func() { endSpan(span, err) }()
 
-	// Send M-SEARCH request
-	_, err = conn.WriteToUDP([]byte(ssdpSearch), addr)
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Second
+	}
+
+	// Multicast search plus any explicitly requested unicast sweep
+	addr, err := net.ResolveUDPAddr("udp4", ssdpAddr)
 	if err != nil {
-		return nil, fmt.Errorf("send SSDP search: %w", err)
+		return fmt.Errorf("resolve SSDP address: %w", err)
+	}
+	sweep, err := sweepTargets(opts.SweepSubnets)
+	if err != nil {
+		return err
 	}
 
-	// Collect responses
 	seen := make(map[string]bool)
-	var tvs []TV
+	ips := make(map[string]bool)
+	count := 0
+	counted := func(tv TV) bool {
+		count++
+		ips[tv.IP] = true
+		return found(tv)
+	}
 
-	buf := make([]byte, 65535)
-	for {
-		select {
-		case <-ctx.Done():
-			return tvs, ctx.Err()
-		default:
+	// Cast and AirPlay devices are browsed for during the SSDP search
+	type browseResult struct {
+		kind string
+		tvs  []TV
+		err  error
+	}
+	var browses []chan browseResult
+	browse := func(kind string, discover func(context.Context, time.Duration) ([]TV, error)) {
+		results := make(chan browseResult, 1)
+		go func() {
+			tvs, err := discover(ctx, opts.Timeout)
+			results <- browseResult{kind, tvs, err}
+		}()
+		browses = append(browses, results)
+	}
+	if opts.Cast {
+		browse("Cast", DiscoverCast)
+	}
+	if opts.AirPlay {
+		browse("AirPlay", DiscoverAirPlay)
+	}
+
+	stopped, err := scanSSDP(ctx, opts, append([]*net.UDPAddr{addr}, sweep...), opts.ListenMulticast, seen, counted)
+	for _, results := range browses {
+		if err != nil || stopped {
+			break
+		}
+		result := <-results
+		if result.err != nil && ctx.Err() == nil {
+			return fmt.Errorf("browse %s devices: %w", result.kind, result.err)
+		}
+		for _, tv := range result.tvs {
+			if seen[tv.ControlURL] || (tv.Protocol == ProtocolAirPlay && ips[tv.IP]) {
+				continue
+			}
+			seen[tv.ControlURL] = true
+			if !counted(tv) {
+				return nil
+			}
+		}
+	}
+	if err != nil || stopped || count > 0 {
+		return err
+	}
+
+	// Nothing answered. Inside a container multicast is often blackholed,
+	// so fall back to asking every address of the local subnets directly.
+	if opts.NoSweepFallback || len(opts.SweepSubnets) > 0 || !inContainer() {
+		return nil
+	}
+
+	sweep, err = sweepTargets(localSubnets())
+	if err != nil || len(sweep) == 0 {
+		return ErrMulticastBlocked
+	}
+	if _, err := scanSSDP(ctx, opts, sweep, false, seen, counted); err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrMulticastBlocked
+	}
+	return nil
+}
+
+// scanSSDP is the search discover runs, replaced in tests
+var scanSSDP = scan
+
+// scan sends M-SEARCH to each target and reports new TVs until the timeout
+// expires. stopped is true when found asked to stop.
+func scan(ctx context.Context, opts DiscoverOptions, targets []*net.UDPAddr, multicast bool, seen map[string]bool, found func(TV) bool) (stopped bool, err error) {
+	// Bound to an interface's address, multicast goes out on that interface
+	var laddr *net.UDPAddr
+	if opts.Interface != "" {
+		if laddr, err = interfaceAddr(opts.Interface); err != nil {
+			return false, err
 		}
+	}
+	conn, err := net.ListenUDP("udp4", laddr)
+	if err != nil {
+		return false, fmt.Errorf("listen UDP: %w", err)
+	}
+	conns := []*net.UDPConn{conn}
 
-		n, _, err := conn.ReadFromUDP(buf)
+	if multicast {
+		mconns, err := listenMulticast(opts.ListenPort, opts.Interface)
 		if err != nil {
-			// Timeout or other error - we're done collecting
-			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-				break
+			conn.Close()
+			return false, err
+		}
+		conns = append(conns, mconns...)
+	}
+
+	defer func() {
+		for _, c := range conns {
+			c.Close()
+		}
+	}()
+
+	// Set read deadline
+	deadline := time.Now().Add(opts.Timeout)
+	for _, c := range conns {
+		c.SetReadDeadline(deadline)
+	}
+
+	// Unblock the reads as soon as the context is done
+	stop := context.AfterFunc(ctx, func() {
+		for _, c := range conns {
+			c.SetReadDeadline(time.Now())
+		}
+	})
+	defer stop()
+
+	// Send M-SEARCH requests; only the first (multicast) target is fatal.
+	// Unicast searches name the host they are sent to, as UDA 1.1 asks.
+	searches := make([][][]byte, len(targets))
+	for i, addr := range targets {
+		host := ssdpAddr
+		if !addr.IP.IsMulticast() {
+			host = addr.String()
+		}
+		searches[i] = opts.searches(host)
+	}
+	send := func() error {
+		for i, addr := range targets {
+			for _, search := range searches[i] {
+				if _, err := conn.WriteToUDP(search, addr); err != nil && i == 0 {
+					return fmt.Errorf("send SSDP search: %w", err)
+				}
 			}
-			break
+		}
+		return nil
+	}
+	if err := send(); err != nil {
+		return false, err
+	}
+
+	// Collect responses
+	done := make(chan struct{})
+	defer close(done)
+
+	// Repeats go out while answers are read
+	if opts.Repeat > 1 {
+		interval := min(maxSSDPRepeatInterval, opts.Timeout/time.Duration(2*opts.Repeat))
+		go func() {
+			for range opts.Repeat - 1 {
+				select {
+				case <-done:
+					return
+				case <-time.After(interval):
+				}
+				send()
+			}
+		}()
+	}
+
+	for resp := range readSSDP(conns, done) {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
 		}
 
-		resp := parseSSDP(string(buf[:n]))
 		if resp.Location == "" {
 			continue
 		}
 
-		// Skip if we've already seen this device
-		if seen[resp.Location] {
+		// Only renderers announcing themselves are of interest
+		if resp.Notify && (resp.NTS != "ssdp:alive" || !opts.wantsType(resp.NT)) {
+			continue
+		}
+
+		// Skip if we've already seen this device. Past maxSSDPLocations
+		// somebody is flooding the network with fake answers.
+		if seen[resp.Location] || len(seen) >= maxSSDPLocations {
 			continue
 		}
 		seen[resp.Location] = true
 
 		// Fetch device description and create TV struct
-		tv, err := fetchTVInfo(ctx, resp.Location)
+		tv, err := fetchTVInfo(ctx, resp.Location, opts.LenientXML)
 		if err != nil {
 			// Skip devices we can't get info for
 			continue
 		}
 
-		tvs = append(tvs, *tv)
+		if !found(*tv) {
+			return true, nil
+		}
 	}
 
-	return tvs, nil
+	return false, ctx.Err()
+}
+
+// Announcement is a TV's ssdp:alive or ssdp:byebye NOTIFY
+type Announcement struct {
+	Alive bool   // ssdp:alive; false for ssdp:byebye
+	UDN   string // Unique device name of the announcing device
+	TV    TV     // The announcing TV (ssdp:alive only)
 }
 
+// ListenNotify joins the SSDP multicast group and calls fn for every media
+// renderer announcing itself until ctx is done, so TVs that boot after a
+// search are picked up without polling. TVs are announced alive once, and
+// again after they said byebye; fn runs on the listening goroutine.
+func ListenNotify(ctx context.Context, opts DiscoverOptions, fn func(Announcement)) error {
+	conns, err := listenMulticast(opts.ListenPort, opts.Interface)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		for _, c := range conns {
+			c.Close()
+		}
+	})
+	defer stop()
+
+	done := make(chan struct{})
+	defer close(done)
+	notifications(ctx, readSSDP(conns, done), opts.LenientXML, fn)
+	return ctx.Err()
+}
+
+// notifications turns NOTIFY packets into announcements until the packets
+// end. Each alive TV's description is fetched once per location.
+func notifications(ctx context.Context, packets <-chan ssdpResponse, lenient bool, fn func(Announcement)) {
+	locations := make(map[string]string) // Location of each alive UDN
+	gone := make(map[string]bool)        // UDNs that said byebye
+
+	for resp := range packets {
+		if !resp.Notify {
+			continue
+		}
+		udn, _, _ := strings.Cut(resp.USN, "::")
+
+		switch resp.NTS {
+		case "ssdp:alive":
+			if resp.Location == "" || !isRendererType(resp.NT) || locations[udn] == resp.Location {
+				continue
+			}
+			tv, err := fetchTVInfo(ctx, resp.Location, lenient)
+			if err != nil {
+				continue
+			}
+			if tv.UDN != "" {
+				udn = tv.UDN
+			}
+			if len(locations) >= maxSSDPDevices {
+				clear(locations)
+			}
+			locations[udn] = resp.Location
+			delete(gone, udn)
+			fn(Announcement{Alive: true, UDN: udn, TV: *tv})
+
+		case "ssdp:byebye":
+			// Devices say byebye once per device and service type
+			if udn == "" || gone[udn] {
+				continue
+			}
+			if len(gone) >= maxSSDPDevices {
+				clear(gone)
+			}
+			gone[udn] = true
+			delete(locations, udn)
+			fn(Announcement{UDN: udn})
+		}
+	}
+}
+
+// mergeDuplicates collapses TVs that answered on several addresses (same
+// UDN) into one entry that uses the address with the fastest description
+// fetch and lists all addresses for failover
+func mergeDuplicates(tvs []TV) []TV {
+	var merged []TV
+	index := make(map[string]int)
+
+	for _, tv := range tvs {
+		i, ok := index[tv.UDN]
+		if tv.UDN == "" || !ok {
+			if tv.UDN != "" {
+				index[tv.UDN] = len(merged)
+			}
+			merged = append(merged, tv)
+			continue
+		}
+
+		prev := merged[i]
+		if tv.descLatency < prev.descLatency {
+			tv.Addresses = append(tv.Addresses, prev.Addresses...)
+			merged[i] = tv
+		} else {
+			merged[i].Addresses = append(prev.Addresses, tv.Addresses...)
+		}
+	}
+
+	return merged
+}
+
+// listenMulticast binds the SSDP port and joins the multicast group on each
+// multicast-capable interface, or only on the one named iface
+func listenMulticast(port int, iface string) ([]*net.UDPConn, error) {
+	if port == 0 {
+		port = 1900
+	}
+	group := &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: port}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("list interfaces: %w", err)
+	}
+
+	var conns []*net.UDPConn
+	var lastErr error
+	for _, ifi := range ifaces {
+		if iface != "" && ifi.Name != iface {
+			continue
+		}
+		if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagMulticast == 0 || (ifi.Flags&net.FlagLoopback != 0 && iface == "") {
+			continue
+		}
+
+		// ListenMulticastUDP sets the reuse socket options itself
+		c, err := net.ListenMulticastUDP("udp4", &ifi, group)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		conns = append(conns, c)
+	}
+
+	if len(conns) == 0 {
+		if lastErr == nil {
+			lastErr = errors.New("no multicast-capable interface")
+		}
+		return nil, fmt.Errorf("join SSDP multicast group: %w", lastErr)
+	}
+
+	return conns, nil
+}
+
+// readSSDP reads packets from all connections until their deadlines expire
+// or done is closed, and delivers them parsed on the returned channel
+func readSSDP(conns []*net.UDPConn, done <-chan struct{}) <-chan ssdpResponse {
+	out := make(chan ssdpResponse)
+
+	var wg sync.WaitGroup
+	for _, c := range conns {
+		wg.Add(1)
+		go func(c *net.UDPConn) {
+			defer wg.Done()
+			buf := make([]byte, 65535)
+			for {
+				n, _, err := c.ReadFromUDP(buf)
+				if err != nil {
+					// Timeout or other error - we're done collecting
+					return
+				}
+				select {
+				case out <- parseSSDP(string(buf[:n])):
+				case <-done:
+					return
+				}
+			}
+		}(c)
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// isRendererType reports whether an SSDP NT/ST value denotes a media renderer
+func isRendererType(nt string) bool {
+	return strings.Contains(nt, "MediaRenderer") || strings.Contains(nt, "AVTransport")
+}
+
+// wantsType reports whether an SSDP NT value is a renderer or one of the
+// extra search targets
+func (opts DiscoverOptions) wantsType(nt string) bool {
+	return isRendererType(nt) || slices.Contains(opts.SearchTargets, nt)
+}
+
+// searches returns the M-SEARCH messages for the search targets, sent to
+// host (ssdpAddr for multicast)
+func (opts DiscoverOptions) searches(host string) [][]byte {
+	mx := opts.MX
+	switch {
+	case mx <= 0:
+		mx = 2
+	case mx > 5:
+		mx = 5 // UPnP devices treat more as 5
+	}
+	targets := append([]string{mediaRendererST}, opts.SearchTargets...)
+	searches := make([][]byte, 0, len(targets))
+	for i, st := range targets {
+		if i > 0 && slices.Contains(targets[:i], st) {
+			continue
+		}
+		searches = append(searches, fmt.Appendf(nil, "M-SEARCH * HTTP/1.1\r\nHOST: %s\r\nMAN: \"ssdp:discover\"\r\nMX: %d\r\nST: %s\r\n\r\n", host, mx, st))
+	}
+	return searches
+}
+
+// interfaceAddr returns the first IPv4 address of the named interface
+func interfaceAddr(name string) (*net.UDPAddr, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("interface %s: %w", name, err)
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("interface %s: %w", name, err)
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+			return &net.UDPAddr{IP: ipnet.IP.To4()}, nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s has no IPv4 address", name)
+}
+
+// Limits on what SSDP packets from the network can make us do
+const (
+	maxSSDPValue     = 1024 // Length of a header value kept from a packet
+	maxSSDPLocations = 256  // Device descriptions fetched per scan
+	maxSSDPDevices   = 1024 // Devices tracked by a NOTIFY listener
+)
+
 // parseSSDP parses an SSDP response into structured data
 func parseSSDP(data string) ssdpResponse {
 	var resp ssdpResponse
@@ -98,10 +658,11 @@ func parseSSDP(data string) ssdpResponse {
 	reader := bufio.NewReader(strings.NewReader(data))
 
 	// Read status line
-	_, err := reader.ReadString('\n')
+	status, err := reader.ReadString('\n')
 	if err != nil {
 		return resp
 	}
+	resp.Notify = strings.HasPrefix(status, "NOTIFY")
 
 	// Parse headers
 	for {
@@ -118,6 +679,10 @@ func parseSSDP(data string) ssdpResponse {
 
 		key := strings.ToLower(strings.TrimSpace(parts[0]))
 		value := strings.TrimSpace(parts[1])
+		// A bare CR left in a value could forge lines in logs and requests
+		if len(value) > maxSSDPValue || strings.ContainsRune(value, '\r') {
+			continue
+		}
 
 		switch key {
 		case "location":
@@ -126,6 +691,10 @@ func parseSSDP(data string) ssdpResponse {
 			resp.Server = value
 		case "usn":
 			resp.USN = value
+		case "nt":
+			resp.NT = value
+		case "nts":
+			resp.NTS = value
 		}
 	}
 
@@ -133,22 +702,27 @@ func parseSSDP(data string) ssdpResponse {
 }
 
 // fetchTVInfo fetches the device description XML and extracts TV information
-func fetchTVInfo(ctx context.Context, location string) (*TV, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", location, nil)
+func fetchTVInfo(ctx context.Context, location string, lenient bool) (tv *TV, err error) {
+	ctx, span := startSpan(ctx, "smarttv.describe", Attribute{Key: "url.full", Value: location})
+	defer func() { endSpan(span, err) }()
+
+	start := time.Now()
+	data, err := fetchDescription(ctx, location)
 	if err != nil {
 		return nil, err
 	}
 
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Do(req)
+	tv, err = parseDeviceDescription(bytes.NewReader(data), location, lenient)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	tv.lenientXML = lenient
+	tv.descLatency = time.Since(start)
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	// Best effort: without an action list every action is attempted
+	if tv.SCPDURL != "" {
+		tv.LoadActions(ctx)
 	}
 
-	return parseDeviceDescription(resp.Body, location)
+	return tv, nil
 }
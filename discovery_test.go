@@ -0,0 +1,266 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseSSDPNotify tests parsing of NOTIFY announcements
+func TestParseSSDPNotify(t *testing.T) {
+	data := "NOTIFY * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"LOCATION: http://192.168.1.20:9197/dmr\r\n" +
+		"NT: urn:schemas-upnp-org:device:MediaRenderer:1\r\n" +
+		"NTS: ssdp:alive\r\n" +
+		"USN: uuid:1234::urn:schemas-upnp-org:device:MediaRenderer:1\r\n\r\n"
+
+	resp := parseSSDP(data)
+	if !resp.Notify {
+		t.Error("Expected NOTIFY to be detected")
+	}
+	if resp.Location != "http://192.168.1.20:9197/dmr" {
+		t.Errorf("Unexpected location: %s", resp.Location)
+	}
+	if resp.NTS != "ssdp:alive" || !isRendererType(resp.NT) {
+		t.Errorf("Unexpected NT/NTS: %s %s", resp.NT, resp.NTS)
+	}
+}
+
+// TestSweepTargets tests expansion of sweep subnets into host addresses
+func TestSweepTargets(t *testing.T) {
+	targets, err := sweepTargets([]string{"192.168.1.10/24"})
+	if err != nil {
+		t.Fatalf("sweepTargets failed: %v", err)
+	}
+
+	// 254 hosts minus our own address
+	if len(targets) != 253 {
+		t.Fatalf("Expected 253 targets, got %d", len(targets))
+	}
+	if targets[0].String() != "192.168.1.1:1900" {
+		t.Errorf("Unexpected first target: %s", targets[0])
+	}
+
+	targets, err = sweepTargets([]string{"10.0.0.0/16"})
+	if err != nil {
+		t.Fatalf("sweepTargets failed: %v", err)
+	}
+	if len(targets) != maxSweepHosts {
+		t.Errorf("Expected large subnet capped at %d, got %d", maxSweepHosts, len(targets))
+	}
+
+	if _, err := sweepTargets([]string{"10.0.0.0/8"}); err == nil {
+		t.Error("Expected error for a subnet larger than a /16")
+	}
+
+	if _, err := sweepTargets([]string{"not-a-cidr"}); err == nil {
+		t.Error("Expected error for invalid CIDR")
+	}
+}
+
+// TestMergeDuplicates tests that a TV answering on two interfaces is listed once
+func TestMergeDuplicates(t *testing.T) {
+	tvs := []TV{
+		{Name: "TV Salon", IP: "192.168.1.20", UDN: "uuid:1", Addresses: []string{"192.168.1.20"}, descLatency: 80 * time.Millisecond},
+		{Name: "Kitchen", IP: "192.168.1.30", UDN: "uuid:2", Addresses: []string{"192.168.1.30"}},
+		{Name: "TV Salon", IP: "192.168.1.21", UDN: "uuid:1", Addresses: []string{"192.168.1.21"}, descLatency: 5 * time.Millisecond},
+	}
+
+	merged := mergeDuplicates(tvs)
+	if len(merged) != 2 {
+		t.Fatalf("Expected 2 TVs, got %d", len(merged))
+	}
+
+	salon := merged[0]
+	if salon.IP != "192.168.1.21" {
+		t.Errorf("Expected faster address 192.168.1.21, got %s", salon.IP)
+	}
+	if len(salon.Addresses) != 2 || salon.Addresses[1] != "192.168.1.20" {
+		t.Errorf("Expected both addresses fastest first, got %v", salon.Addresses)
+	}
+}
+
+func TestScanOptions(t *testing.T) {
+	if got := string(DiscoverOptions{}.searches(ssdpAddr)[0]); got != ssdpSearch {
+		t.Errorf("Default search = %q", got)
+	}
+
+	server := descriptionServer(t)
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+	searches := make(chan string, 16)
+	go func() {
+		defer close(searches)
+		buf := make([]byte, 1024)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			searches <- string(buf[:n])
+			reply := fmt.Sprintf("HTTP/1.1 200 OK\r\nST: %s\r\nLOCATION: %s/dmr\r\nUSN: uuid:tv\r\n\r\n", mediaRendererST, server.URL)
+			conn.WriteToUDP([]byte(reply), from)
+		}
+	}()
+
+	opts := DiscoverOptions{
+		Timeout:       time.Second,
+		SearchTargets: []string{"urn:dial-multiscreen-org:service:dial:1", mediaRendererST},
+		MX:            9,
+		Repeat:        3,
+	}
+	ifaces, _ := net.Interfaces()
+	for _, ifi := range ifaces {
+		if ifi.Flags&net.FlagLoopback != 0 {
+			opts.Interface = ifi.Name
+		}
+	}
+
+	var names []string
+	_, err = scan(context.Background(), opts, []*net.UDPAddr{conn.LocalAddr().(*net.UDPAddr)}, false, make(map[string]bool), func(tv TV) bool {
+		names = append(names, tv.Name)
+		return true
+	})
+	if err != nil || len(names) != 1 || names[0] != "TV Salon" {
+		t.Errorf("scan = %v, %v", names, err)
+	}
+
+	// Both targets once per repeat, with MX capped
+	conn.Close()
+	var dial, renderer int
+	for search := range searches {
+		if !strings.Contains(search, "MX: 5\r\n") {
+			t.Errorf("Search without MX 5: %q", search)
+		}
+		if !strings.Contains(search, "HOST: "+conn.LocalAddr().String()+"\r\n") {
+			t.Errorf("Unicast search without the target's HOST: %q", search)
+		}
+		switch {
+		case strings.Contains(search, "ST: urn:dial-multiscreen-org:service:dial:1\r\n"):
+			dial++
+		case strings.Contains(search, "ST: "+mediaRendererST+"\r\n"):
+			renderer++
+		}
+	}
+	if dial != 3 || renderer != 3 {
+		t.Errorf("Sent %d DIAL and %d renderer searches, want 3 each", dial, renderer)
+	}
+
+	if _, err := scan(context.Background(), DiscoverOptions{Interface: "nosuch0"}, nil, false, nil, nil); err == nil {
+		t.Error("Expected an error for an unknown interface")
+	}
+}
+
+// fakeScan makes discover find tvs without a network, then fail with err
+// or keep listening until the timeout or ctx ends the search
+func fakeScan(t *testing.T, err error, tvs ...TV) *int {
+	t.Helper()
+	var yielded int
+	scanSSDP = func(ctx context.Context, opts DiscoverOptions, targets []*net.UDPAddr, multicast bool, seen map[string]bool, found func(TV) bool) (bool, error) {
+		for _, tv := range tvs {
+			yielded++
+			if !found(tv) {
+				return true, nil
+			}
+		}
+		if err != nil {
+			return false, err
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(opts.Timeout):
+			return false, nil
+		}
+	}
+	t.Cleanup(func() { scanSSDP = scan })
+	return &yielded
+}
+
+// TestDevices tests that the iterator yields each TV once, stops the scan
+// when the loop breaks and yields failures last
+func TestDevices(t *testing.T) {
+	salon := TV{Name: "Salon", UDN: "uuid:salon", IP: "192.168.1.20"}
+	salonWired := TV{Name: "Salon", UDN: "uuid:salon", IP: "192.168.1.21"}
+	lobby := TV{Name: "Lobby", UDN: "uuid:lobby", IP: "192.168.1.30"}
+	opts := DiscoverOptions{Timeout: 10 * time.Millisecond, NoSweepFallback: true}
+
+	fakeScan(t, nil, salon, salonWired, lobby)
+	var got []string
+	for tv, err := range Devices(context.Background(), opts) {
+		if err != nil {
+			t.Fatalf("Devices failed: %v", err)
+		}
+		got = append(got, tv.Name+" "+tv.IP)
+	}
+	if strings.Join(got, ",") != "Salon 192.168.1.20,Lobby 192.168.1.30" {
+		t.Errorf("Devices yielded %v", got)
+	}
+
+	yielded := fakeScan(t, nil, salon, lobby)
+	for range Devices(context.Background(), opts) {
+		break
+	}
+	if *yielded != 1 {
+		t.Errorf("Scan went on for %d TVs after the loop broke", *yielded)
+	}
+
+	boom := errors.New("boom")
+	fakeScan(t, boom, salon)
+	got = nil
+	var last error
+	for tv, err := range Devices(context.Background(), opts) {
+		if last != nil {
+			t.Error("Devices yielded after the failure")
+		}
+		got = append(got, tv.Name)
+		last = err
+	}
+	if !errors.Is(last, boom) || len(got) != 2 || got[1] != "" {
+		t.Errorf("Devices yielded %v then %v, want Salon then the failure", got, last)
+	}
+}
+
+// TestDiscoverPartial tests that a canceled scan keeps what it found
+// without an error, unlike Discover, while real failures are reported
+func TestDiscoverPartial(t *testing.T) {
+	salon := TV{Name: "Salon", UDN: "uuid:salon", ControlURL: "http://192.168.1.20/avt"}
+	opts := DiscoverOptions{Timeout: time.Minute, NoSweepFallback: true}
+
+	fakeScan(t, nil, salon)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	result := DiscoverPartial(ctx, opts)
+	if result.Err != nil || !result.Interrupted || len(result.TVs) != 1 || result.TVs[0].Name != "Salon" {
+		t.Errorf("DiscoverPartial = %+v, want Salon interrupted without error", result)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	tvs, err := DiscoverWithOptions(ctx, opts)
+	if !errors.Is(err, context.DeadlineExceeded) || len(tvs) != 1 {
+		t.Errorf("DiscoverWithOptions = %v, %v, want Salon and the context error", tvs, err)
+	}
+
+	// Running out the timeout is no interruption
+	opts.Timeout = 10 * time.Millisecond
+	result = DiscoverPartial(context.Background(), opts)
+	if result.Err != nil || result.Interrupted || len(result.TVs) != 1 {
+		t.Errorf("DiscoverPartial = %+v, want Salon", result)
+	}
+
+	boom := errors.New("boom")
+	fakeScan(t, boom, salon)
+	result = DiscoverPartial(context.Background(), opts)
+	if !errors.Is(result.Err, boom) || result.Interrupted || len(result.TVs) != 1 {
+		t.Errorf("DiscoverPartial = %+v, want Salon and the failure", result)
+	}
+}
@@ -0,0 +1,171 @@
+package nimsforestsmarttv
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"regexp"
+)
+
+// shortcodes maps :shortcode: names to the emoji they stand for
+var shortcodes = map[string]rune{
+	"smile":            '😀',
+	"grinning":         '😀',
+	"cry":              '😢',
+	"sob":              '😢',
+	"heart":            '❤',
+	"thumbsup":         '👍',
+	"+1":               '👍',
+	"fire":             '🔥',
+	"star":             '⭐',
+	"white_check_mark": '✅',
+	"check":            '✅',
+	"x":                '❌',
+	"warning":          '⚠',
+}
+
+// shortcodePattern matches :name: with the characters shortcodes use
+var shortcodePattern = regexp.MustCompile(`:[a-z0-9_+-]+:`)
+
+// ExpandShortcodes replaces known :shortcodes: (e.g. ":fire:") with their
+// emoji. Unknown shortcodes are left as they are.
+func ExpandShortcodes(text string) string {
+	return shortcodePattern.ReplaceAllStringFunc(text, func(code string) string {
+		if r, ok := shortcodes[code[1:len(code)-1]]; ok {
+			return string(r)
+		}
+		return code
+	})
+}
+
+// emojiPalette are the colors used by the emoji sprites ('.' is transparent)
+var emojiPalette = map[byte]color.RGBA{
+	'y': {255, 204, 0, 255},
+	'k': {60, 40, 20, 255},
+	'r': {220, 30, 40, 255},
+	'o': {255, 130, 0, 255},
+	'g': {40, 170, 70, 255},
+	'b': {70, 150, 240, 255},
+	'w': {255, 255, 255, 255},
+}
+
+// emojiSprites are 8x8 color bitmaps for the emoji ExpandShortcodes
+// produces. The bitmap font has no color glyphs, so these are drawn instead.
+var emojiSprites = map[rune][]string{
+	'😀': {
+		"..yyyy..",
+		".yyyyyy.",
+		"yykyykyy",
+		"yyyyyyyy",
+		"ykyyyyky",
+		"yykkkkyy",
+		".yyyyyy.",
+		"..yyyy..",
+	},
+	'😢': {
+		"..yyyy..",
+		".yyyyyy.",
+		"yykyykyy",
+		"ybyyyyyy",
+		"ybyyyyyy",
+		"yyykkyyy",
+		".ykyyky.",
+		"..yyyy..",
+	},
+	'❤': {
+		"........",
+		".rr..rr.",
+		"rrrrrrrr",
+		"rrrrrrrr",
+		".rrrrrr.",
+		"..rrrr..",
+		"...rr...",
+		"........",
+	},
+	'👍': {
+		"...yy...",
+		"...yy...",
+		"..yyy...",
+		"yyyyyyy.",
+		"yyyyyyy.",
+		"yyyyyy..",
+		"yyyyyy..",
+		"........",
+	},
+	'🔥': {
+		"...r....",
+		"..rr..r.",
+		".rror.r.",
+		".roorrr.",
+		"rrooyorr",
+		"rroyyyor",
+		".royyor.",
+		"..rrrr..",
+	},
+	'⭐': {
+		"...yy...",
+		"...yy...",
+		"yyyyyyyy",
+		".yyyyyy.",
+		"..yyyy..",
+		".yyyyyy.",
+		".yy..yy.",
+		"y......y",
+	},
+	'✅': {
+		"gggggggg",
+		"ggggggwg",
+		"gggggwwg",
+		"gwgggwgg",
+		"gwwgwwgg",
+		"ggwwwggg",
+		"gggwgggg",
+		"gggggggg",
+	},
+	'❌': {
+		"rr....rr",
+		"rrr..rrr",
+		".rrrrrr.",
+		"..rrrr..",
+		"..rrrr..",
+		".rrrrrr.",
+		"rrr..rrr",
+		"rr....rr",
+	},
+	'⚠': {
+		"...yy...",
+		"...yy...",
+		"..ykky..",
+		"..ykky..",
+		".yykkyy.",
+		".yyyyyy.",
+		"yyykkyyy",
+		"yyyyyyyy",
+	},
+}
+
+// isEmoji reports whether a color sprite exists for r
+func isEmoji(r rune) bool {
+	_, ok := emojiSprites[r]
+	return ok
+}
+
+// drawEmoji draws the sprite for r as a size x size square at x, y
+func drawEmoji(img *image.RGBA, x, y, size int, r rune) {
+	sprite := emojiSprites[r]
+	rows := len(sprite)
+	for sy, row := range sprite {
+		for sx := 0; sx < len(row); sx++ {
+			c, ok := emojiPalette[row[sx]]
+			if !ok {
+				continue
+			}
+			// Scale each sprite pixel to a block of screen pixels
+			cell := image.Rect(
+				x+sx*size/len(row), y+sy*size/rows,
+				x+(sx+1)*size/len(row), y+(sy+1)*size/rows,
+			)
+			draw.Draw(img, cell, &image.Uniform{c}, image.Point{}, draw.Src)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package nimsforestsmarttv
+
+import (
+	"image/color"
+	"testing"
+)
+
+// TestExpandShortcodes tests shortcode expansion
+func TestExpandShortcodes(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Build :white_check_mark:", "Build ✅"},
+		{":fire::fire:", "🔥🔥"},
+		{"Nice :+1:", "Nice 👍"},
+		{"Keep :unknown: and 12:30:45", "Keep :unknown: and 12:30:45"},
+	}
+
+	for _, tt := range tests {
+		if got := ExpandShortcodes(tt.in); got != tt.want {
+			t.Errorf("ExpandShortcodes(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestEmojiSprites tests that every sprite is 8x8 and uses known colors,
+// and that every shortcode has a sprite
+func TestEmojiSprites(t *testing.T) {
+	for r, sprite := range emojiSprites {
+		if len(sprite) != 8 {
+			t.Errorf("%c: expected 8 rows, got %d", r, len(sprite))
+		}
+		for _, row := range sprite {
+			if len(row) != 8 {
+				t.Errorf("%c: row %q is not 8 wide", r, row)
+			}
+			for i := 0; i < len(row); i++ {
+				if _, ok := emojiPalette[row[i]]; !ok && row[i] != '.' {
+					t.Errorf("%c: unknown color %q", r, row[i])
+				}
+			}
+		}
+	}
+
+	for code, r := range shortcodes {
+		if !isEmoji(r) {
+			t.Errorf(":%s: has no sprite", code)
+		}
+	}
+}
+
+// TestRenderTextEmoji tests that emoji are drawn in color
+func TestRenderTextEmoji(t *testing.T) {
+	img := RenderText(":heart:", TextOptions{Width: 200, Height: 100, FontSize: 80, Shortcodes: true})
+
+	// The heart is centered; its middle row is solid red
+	got := color.RGBAModel.Convert(img.At(100, 40)).(color.RGBA)
+	if got != emojiPalette['r'] {
+		t.Errorf("Expected a red heart in the middle, got %v", got)
+	}
+}
@@ -0,0 +1,88 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// Encoder turns frames into bytes a TV can display.
+// Plug in a custom implementation (turbo-jpeg bindings, WebP, hardware
+// encoders) with WithEncoder.
+type Encoder interface {
+	// Encode writes img to w
+	Encode(w io.Writer, img image.Image) error
+
+	// ContentType returns the MIME type of the encoded data (e.g. "image/jpeg")
+	ContentType() string
+}
+
+// JPEGEncoder encodes frames with the standard library JPEG encoder
+type JPEGEncoder struct {
+	Quality int // 1-100 (default 85)
+}
+
+// Encode converts img to RGBA and encodes it as JPEG
+func (e JPEGEncoder) Encode(w io.Writer, img image.Image) error {
+	quality := e.Quality
+	if quality == 0 {
+		quality = 85
+	}
+	return jpeg.Encode(w, toRGBA(img), &jpeg.Options{Quality: quality})
+}
+
+// ContentType returns "image/jpeg"
+func (e JPEGEncoder) ContentType() string {
+	return "image/jpeg"
+}
+
+// PNGEncoder encodes frames losslessly as PNG. Not every TV displays PNG.
+type PNGEncoder struct{}
+
+// Encode encodes img as PNG
+func (PNGEncoder) Encode(w io.Writer, img image.Image) error {
+	return png.Encode(w, img)
+}
+
+// ContentType returns "image/png"
+func (PNGEncoder) ContentType() string {
+	return "image/png"
+}
+
+// WithEncoder sets the encoder used for images rendered by the Renderer
+// (default JPEGEncoder with quality 85)
+func WithEncoder(enc Encoder) Option {
+	return func(r *Renderer) {
+		r.encoder = enc
+	}
+}
+
+// storeImage encodes a frame with the renderer's encoder, stores it on the
+// image server and returns its URL and content type
+func (r *Renderer) storeImage(img image.Image) (string, string, error) {
+	enc := r.frameEncoder()
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, img); err != nil {
+		return "", "", fmt.Errorf("encode %s: %w", enc.ContentType(), err)
+	}
+	return r.server.StoreContent(buf.Bytes(), enc.ContentType()), enc.ContentType(), nil
+}
+
+// toRGBA returns img as *image.RGBA, converting only when needed
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			rgba.Set(x, y, img.At(x, y))
+		}
+	}
+	return rgba
+}
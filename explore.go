@@ -0,0 +1,370 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// exploreWait is how long ExploreIP waits for SSDP answers
+const exploreWait = 2 * time.Second
+
+// ssdpSearchAll asks a device for all of its root devices and services
+const ssdpSearchAll = "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 1\r\nST: ssdp:all\r\n\r\n"
+
+// UPnPDevice is the full tree of a UPnP device description: every service
+// with its actions and state variables, and the embedded devices. Unlike
+// TV, which keeps only what casting needs, it covers everything a device
+// offers.
+type UPnPDevice struct {
+	Location     string `json:",omitempty"` // Description URL (root devices only)
+	DeviceType   string
+	FriendlyName string
+	Manufacturer string
+	ModelName    string
+	ModelNumber  string `json:",omitempty"`
+	SerialNumber string `json:",omitempty"`
+	UDN          string
+	Services     []UPnPService
+	Devices      []UPnPDevice `json:",omitempty"` // Embedded devices
+}
+
+// UPnPService is a service of a UPnPDevice with its service description
+type UPnPService struct {
+	ServiceType    string
+	ServiceID      string
+	ControlURL     string
+	EventSubURL    string
+	SCPDURL        string
+	Actions        []UPnPAction
+	StateVariables []UPnPStateVariable
+
+	// Error is why the service description could not be loaded
+	Error string `json:",omitempty"`
+}
+
+// UPnPAction is a SOAP action of a service
+type UPnPAction struct {
+	Name      string
+	Arguments []UPnPArgument
+}
+
+// UPnPArgument is an argument of an action
+type UPnPArgument struct {
+	Name          string
+	Direction     string // "in" or "out"
+	StateVariable string // Related state variable, which gives the type
+}
+
+// UPnPStateVariable is a state variable of a service
+type UPnPStateVariable struct {
+	Name          string
+	DataType      string
+	SendEvents    bool     // Changes are evented to subscribers
+	Default       string   `json:",omitempty"`
+	AllowedValues []string `json:",omitempty"`
+	Minimum       string   `json:",omitempty"` // Allowed range (numbers)
+	Maximum       string   `json:",omitempty"`
+	Step          string   `json:",omitempty"`
+}
+
+// deviceTree is a device description with all fields and embedded devices
+type deviceTree struct {
+	XMLName xml.Name   `xml:"root"`
+	URLBase string     `xml:"URLBase"`
+	Device  deviceNode `xml:"device"`
+}
+
+type deviceNode struct {
+	DeviceType   string `xml:"deviceType"`
+	FriendlyName string `xml:"friendlyName"`
+	Manufacturer string `xml:"manufacturer"`
+	ModelName    string `xml:"modelName"`
+	ModelNumber  string `xml:"modelNumber"`
+	SerialNumber string `xml:"serialNumber"`
+	UDN          string `xml:"UDN"`
+	Services     []struct {
+		ServiceType string `xml:"serviceType"`
+		ServiceID   string `xml:"serviceId"`
+		ControlURL  string `xml:"controlURL"`
+		EventSubURL string `xml:"eventSubURL"`
+		SCPDURL     string `xml:"SCPDURL"`
+	} `xml:"serviceList>service"`
+	Devices []deviceNode `xml:"deviceList>device"`
+}
+
+// ExploreDevice fetches the device description at location and the
+// description of every service in it. Services whose description can't be
+// loaded are kept with their Error set.
+func ExploreDevice(ctx context.Context, location string) (*UPnPDevice, error) {
+	data, err := fetchDescription(ctx, location)
+	if err != nil {
+		return nil, fmt.Errorf("fetch device description: %w", err)
+	}
+	var tree deviceTree
+	if err := decodeXML(bytes.NewReader(data), &tree, false); err != nil {
+		return nil, fmt.Errorf("parse device description: %w", err)
+	}
+
+	locURL, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("parse location URL: %w", err)
+	}
+	baseURL := tree.URLBase
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("%s://%s", locURL.Scheme, locURL.Host)
+	}
+	baseURL = strings.TrimSuffix(strings.TrimSpace(baseURL), "/")
+
+	dev := exploreNode(ctx, tree.Device, baseURL)
+	dev.Location = location
+	return &dev, nil
+}
+
+// exploreNode converts a device and its embedded devices, loading the
+// description of each service
+func exploreNode(ctx context.Context, node deviceNode, baseURL string) UPnPDevice {
+	dev := UPnPDevice{
+		DeviceType:   strings.TrimSpace(node.DeviceType),
+		FriendlyName: strings.TrimSpace(node.FriendlyName),
+		Manufacturer: strings.TrimSpace(node.Manufacturer),
+		ModelName:    strings.TrimSpace(node.ModelName),
+		ModelNumber:  strings.TrimSpace(node.ModelNumber),
+		SerialNumber: strings.TrimSpace(node.SerialNumber),
+		UDN:          strings.TrimSpace(node.UDN),
+	}
+
+	for _, s := range node.Services {
+		svc := UPnPService{
+			ServiceType: strings.TrimSpace(s.ServiceType),
+			ServiceID:   strings.TrimSpace(s.ServiceID),
+		}
+		if ref := strings.TrimSpace(s.ControlURL); ref != "" {
+			svc.ControlURL = resolveURL(baseURL, ref)
+		}
+		if ref := strings.TrimSpace(s.EventSubURL); ref != "" {
+			svc.EventSubURL = resolveURL(baseURL, ref)
+		}
+		if ref := strings.TrimSpace(s.SCPDURL); ref != "" {
+			svc.SCPDURL = resolveURL(baseURL, ref)
+			if err := svc.load(ctx); err != nil {
+				svc.Error = err.Error()
+			}
+		} else {
+			svc.Error = "no SCPD URL"
+		}
+		dev.Services = append(dev.Services, svc)
+	}
+
+	for _, child := range node.Devices {
+		dev.Devices = append(dev.Devices, exploreNode(ctx, child, baseURL))
+	}
+	return dev
+}
+
+// load fetches the service description and fills in the actions and state
+// variables
+func (svc *UPnPService) load(ctx context.Context) error {
+	var desc scpd
+	if err := fetchXML(ctx, svc.SCPDURL, &desc); err != nil {
+		return fmt.Errorf("fetch SCPD: %w", err)
+	}
+
+	for _, a := range desc.Actions {
+		action := UPnPAction{Name: strings.TrimSpace(a.Name)}
+		for _, arg := range a.Arguments {
+			action.Arguments = append(action.Arguments, UPnPArgument{
+				Name:          strings.TrimSpace(arg.Name),
+				Direction:     strings.ToLower(strings.TrimSpace(arg.Direction)),
+				StateVariable: strings.TrimSpace(arg.StateVariable),
+			})
+		}
+		svc.Actions = append(svc.Actions, action)
+	}
+
+	for _, v := range desc.StateVariables {
+		sv := UPnPStateVariable{
+			Name:       strings.TrimSpace(v.Name),
+			DataType:   strings.TrimSpace(v.DataType),
+			SendEvents: strings.EqualFold(strings.TrimSpace(v.SendEvents), "yes"),
+			Default:    strings.TrimSpace(v.Default),
+		}
+		for _, value := range v.AllowedValues {
+			sv.AllowedValues = append(sv.AllowedValues, strings.TrimSpace(value))
+		}
+		if v.Range != nil {
+			sv.Minimum = strings.TrimSpace(v.Range.Minimum)
+			sv.Maximum = strings.TrimSpace(v.Range.Maximum)
+			sv.Step = strings.TrimSpace(v.Range.Step)
+		}
+		svc.StateVariables = append(svc.StateVariables, sv)
+	}
+	return nil
+}
+
+// fetchXML fetches an XML document and decodes it into v
+func fetchXML(ctx context.Context, location string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", location, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if err := decodeXML(resp.Body, v, false); err != nil {
+		return fmt.Errorf("parse %s: %w", location, err)
+	}
+	return nil
+}
+
+// ExploreIP asks the host at ip (optionally "ip:port" for a non-standard
+// SSDP port) for its root devices with a unicast M-SEARCH and explores each
+// of them. It waits two seconds for answers.
+func ExploreIP(ctx context.Context, ip string) ([]*UPnPDevice, error) {
+	locations, err := searchIP(ctx, ip, ssdpSearchAll)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []*UPnPDevice
+	var errs []error
+	for _, location := range locations {
+		dev, err := ExploreDevice(ctx, location)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", location, err))
+			continue
+		}
+		devices = append(devices, dev)
+	}
+	if len(devices) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	return devices, nil
+}
+
+// searchIP sends search as a unicast M-SEARCH to the host at ip (or
+// "ip:port") and returns the description locations it answers with
+func searchIP(ctx context.Context, ip, search string) ([]string, error) {
+	host, port := ip, "1900"
+	if h, p, err := net.SplitHostPort(ip); err == nil {
+		host, port = h, p
+	}
+	addr, err := net.ResolveUDPAddr("udp4", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", ip, err)
+	}
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, fmt.Errorf("listen UDP: %w", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(exploreWait))
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	if _, err := conn.WriteToUDP([]byte(search), addr); err != nil {
+		return nil, fmt.Errorf("send SSDP search: %w", err)
+	}
+
+	// Devices answer once per device and service type; keep each location
+	done := make(chan struct{})
+	defer close(done)
+	var locations []string
+	for resp := range readSSDP([]*net.UDPConn{conn}, done) {
+		if resp.Location != "" && !resp.Notify && !slices.Contains(locations, resp.Location) {
+			locations = append(locations, resp.Location)
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if len(locations) == 0 {
+		return nil, fmt.Errorf("no UPnP device answered at %s", ip)
+	}
+	return locations, nil
+}
+
+// Service returns the service of the device or one of its embedded devices
+// matching serviceType: the full URN, or just its name (e.g.
+// "RenderingControl")
+func (d *UPnPDevice) Service(serviceType string) (*UPnPService, bool) {
+	for i := range d.Services {
+		svc := &d.Services[i]
+		if svc.ServiceType == serviceType || strings.Contains(svc.ServiceType, ":service:"+serviceType+":") {
+			return svc, true
+		}
+	}
+	for i := range d.Devices {
+		if svc, ok := d.Devices[i].Service(serviceType); ok {
+			return svc, true
+		}
+	}
+	return nil, false
+}
+
+// Call invokes a SOAP action on one of the device's services and returns
+// its output arguments. Arguments are sent in the order the service
+// description lists them. Failures reported by the device are returned as
+// *SOAPError.
+func (d *UPnPDevice) Call(ctx context.Context, serviceType string, action string, args map[string]string) (map[string]string, error) {
+	svc, ok := d.Service(serviceType)
+	if !ok {
+		return nil, fmt.Errorf("no %s service on %s", serviceType, d.FriendlyName)
+	}
+	if svc.ControlURL == "" {
+		return nil, fmt.Errorf("%s has no control URL", svc.ServiceType)
+	}
+
+	// The argument order matters to some devices
+	var names []string
+	if svc.Actions != nil {
+		i := slices.IndexFunc(svc.Actions, func(a UPnPAction) bool { return a.Name == action })
+		if i < 0 {
+			return nil, fmt.Errorf("%s: %w", action, ErrUnsupportedAction)
+		}
+		for _, arg := range svc.Actions[i].Arguments {
+			if _, ok := args[arg.Name]; ok && arg.Direction == "in" {
+				names = append(names, arg.Name)
+			}
+		}
+	}
+	var extra []string
+	for name := range args {
+		if !slices.Contains(names, name) {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	names = append(names, extra...)
+
+	var body strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&body, "\n      <%s>%s</%s>", name, escapeXML(args[name]), name)
+	}
+
+	resp, err := postSOAP(ctx, svc.ControlURL, svc.ServiceType, action, serviceEnvelope(svc.ServiceType, action, body.String()))
+	if err != nil {
+		return nil, fmt.Errorf("send SOAP request: %w", err)
+	}
+	defer resp.Body.Close()
+	return readSOAPResponse(action, resp.StatusCode, resp.Body)
+}
@@ -0,0 +1,170 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const exploreDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:Basic:1</deviceType>
+    <friendlyName>Living Room</friendlyName>
+    <manufacturer>Acme</manufacturer>
+    <modelName>TV 9000</modelName>
+    <UDN>uuid:root</UDN>
+    <serviceList>
+      <service>
+        <serviceType>urn:acme-com:service:Ambilight:1</serviceType>
+        <serviceId>urn:acme-com:serviceId:Ambilight</serviceId>
+        <controlURL>/ambilight/control</controlURL>
+        <SCPDURL>/ambilight.xml</SCPDURL>
+      </service>
+    </serviceList>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:MediaRenderer:1</deviceType>
+        <friendlyName>Living Room Renderer</friendlyName>
+        <UDN>uuid:renderer</UDN>
+        <serviceList>
+          <service>
+            <serviceType>urn:schemas-upnp-org:service:RenderingControl:1</serviceType>
+            <serviceId>urn:upnp-org:serviceId:RenderingControl</serviceId>
+            <controlURL>rc/control</controlURL>
+            <eventSubURL>rc/event</eventSubURL>
+            <SCPDURL>rc.xml</SCPDURL>
+          </service>
+        </serviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`
+
+const exploreSCPD = `<?xml version="1.0"?>
+<scpd xmlns="urn:schemas-upnp-org:service-1-0">
+  <actionList>
+    <action>
+      <name>SetVolume</name>
+      <argumentList>
+        <argument><name>InstanceID</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_InstanceID</relatedStateVariable></argument>
+        <argument><name>Channel</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_Channel</relatedStateVariable></argument>
+        <argument><name>DesiredVolume</name><direction>in</direction><relatedStateVariable>Volume</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+  </actionList>
+  <serviceStateTable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_InstanceID</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="no">
+      <name>A_ARG_TYPE_Channel</name><dataType>string</dataType>
+      <allowedValueList><allowedValue>Master</allowedValue></allowedValueList>
+    </stateVariable>
+    <stateVariable sendEvents="yes">
+      <name>Volume</name><dataType>ui2</dataType><defaultValue>20</defaultValue>
+      <allowedValueRange><minimum>0</minimum><maximum>100</maximum><step>1</step></allowedValueRange>
+    </stateVariable>
+  </serviceStateTable>
+</scpd>`
+
+// exploreServer serves exploreDescription; the Ambilight SCPD is missing
+func exploreServer(t *testing.T, calls chan<- string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/desc.xml":
+			io.WriteString(w, exploreDescription)
+		case "/rc.xml":
+			io.WriteString(w, exploreSCPD)
+		case "/rc/control":
+			body, _ := io.ReadAll(r.Body)
+			calls <- r.Header.Get("SOAPAction") + " " + string(body)
+			io.WriteString(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:SetVolumeResponse xmlns:u="urn:schemas-upnp-org:service:RenderingControl:1"/></s:Body></s:Envelope>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestExploreDevice(t *testing.T) {
+	calls := make(chan string, 1)
+	server := exploreServer(t, calls)
+
+	dev, err := ExploreDevice(context.Background(), server.URL+"/desc.xml")
+	if err != nil {
+		t.Fatalf("ExploreDevice failed: %v", err)
+	}
+	if dev.FriendlyName != "Living Room" || dev.Location != server.URL+"/desc.xml" || len(dev.Services) != 1 || len(dev.Devices) != 1 {
+		t.Fatalf("unexpected device: %+v", dev)
+	}
+	if svc := dev.Services[0]; !strings.Contains(svc.Error, "404") || svc.ControlURL != server.URL+"/ambilight/control" {
+		t.Errorf("service with missing SCPD: %+v", svc)
+	}
+
+	svc, ok := dev.Service("RenderingControl")
+	if !ok {
+		t.Fatal("RenderingControl not found in embedded device")
+	}
+	if svc.EventSubURL != server.URL+"/rc/event" || svc.Error != "" {
+		t.Errorf("unexpected service: %+v", svc)
+	}
+	if len(svc.Actions) != 1 || len(svc.Actions[0].Arguments) != 3 || svc.Actions[0].Arguments[2].StateVariable != "Volume" {
+		t.Errorf("unexpected actions: %+v", svc.Actions)
+	}
+	volume := svc.StateVariables[2]
+	if !volume.SendEvents || volume.DataType != "ui2" || volume.Default != "20" || volume.Maximum != "100" || svc.StateVariables[1].AllowedValues[0] != "Master" {
+		t.Errorf("unexpected state variables: %+v", svc.StateVariables)
+	}
+
+	// Arguments go out in the order of the service description
+	_, err = dev.Call(context.Background(), "RenderingControl", "SetVolume", map[string]string{
+		"DesiredVolume": "12", "Channel": "Master", "InstanceID": "0",
+	})
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	call := <-calls
+	if !strings.Contains(call, "RenderingControl:1#SetVolume") || !strings.Contains(call, "<InstanceID>0</InstanceID>\n      <Channel>Master</Channel>\n      <DesiredVolume>12</DesiredVolume>") {
+		t.Errorf("unexpected call: %s", call)
+	}
+
+	if _, err := dev.Call(context.Background(), "RenderingControl", "SetMute", nil); !errors.Is(err, ErrUnsupportedAction) {
+		t.Errorf("Expected ErrUnsupportedAction, got %v", err)
+	}
+}
+
+func TestExploreIP(t *testing.T) {
+	server := exploreServer(t, make(chan string, 1))
+
+	// A device answers ssdp:all once per type, all with the same location
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil || !strings.Contains(string(buf[:n]), "ST: ssdp:all") {
+			return
+		}
+		for _, st := range []string{"upnp:rootdevice", "urn:schemas-upnp-org:device:MediaRenderer:1"} {
+			reply := fmt.Sprintf("HTTP/1.1 200 OK\r\nST: %s\r\nLOCATION: %s/desc.xml\r\nUSN: uuid:root\r\n\r\n", st, server.URL)
+			conn.WriteToUDP([]byte(reply), from)
+		}
+	}()
+
+	devices, err := ExploreIP(context.Background(), conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("ExploreIP failed: %v", err)
+	}
+	if len(devices) != 1 || devices[0].UDN != "uuid:root" {
+		t.Errorf("Expected the root device once, got %d devices", len(devices))
+	}
+}
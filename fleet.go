@@ -0,0 +1,188 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Expectation says what a set of TVs should be showing during a daily
+// window, e.g. "the lobby zone shows 'menu' content from 11:00 to 15:00"
+type Expectation struct {
+	Name string
+
+	// Targets: a zone from the registry and/or individual TV names
+	Zone string
+	TVs  []string
+
+	// Tag is a tag the content on screen must carry ("" = any content)
+	Tag string
+
+	// From and Until limit the expectation to a daily window, as offsets
+	// since local midnight (see Rule). Both zero means all day.
+	From, Until time.Duration
+
+	// MaxAge fails TVs whose frame was sent longer ago than this (0 = no limit)
+	MaxAge time.Duration
+
+	// Verify checks a screenshot of TVs that support Screenshot (optional)
+	Verify func(screenshot image.Image) bool
+}
+
+// AuditIssue is a reason a TV is not showing what it should
+type AuditIssue string
+
+const (
+	IssueOffline          AuditIssue = "offline"           // TV doesn't respond
+	IssueNothingShown     AuditIssue = "nothing shown"     // No frame sent since start
+	IssueWrongContent     AuditIssue = "wrong content"     // Frame lacks the expected tag
+	IssueNotFetched       AuditIssue = "not fetched"       // TV never downloaded the frame
+	IssueStale            AuditIssue = "stale"             // Frame older than MaxAge
+	IssueScreenshotFailed AuditIssue = "screenshot failed" // Screenshot could not be taken
+	IssueScreenMismatch   AuditIssue = "screen mismatch"   // Screenshot failed Verify
+)
+
+// AuditFinding lists the issues found for one TV
+type AuditFinding struct {
+	TV          *TV
+	Expectation string
+	Issues      []AuditIssue
+	Frame       FrameInfo // Last frame shown (zero if none)
+}
+
+// AuditReport is the result of a fleet audit
+type AuditReport struct {
+	At       time.Time
+	Checked  int            // TVs checked against an active expectation
+	Findings []AuditFinding // TVs not showing what they should
+}
+
+// Compliant reports whether every checked TV passed
+func (rep AuditReport) Compliant() bool {
+	return len(rep.Findings) == 0
+}
+
+// Fleet checks a registry's TVs against content expectations, combining
+// health probes, the renderer's record of what it sent and which TVs
+// fetched it, and screenshots where available
+type Fleet struct {
+	renderer     *Renderer
+	registry     *Registry
+	health       *HealthChecker
+	expectations []Expectation
+
+	now func() time.Time
+}
+
+// NewFleet creates a fleet auditor. health may be nil, in which case TVs
+// are probed during the audit.
+func NewFleet(renderer *Renderer, registry *Registry, health *HealthChecker, expectations ...Expectation) *Fleet {
+	return &Fleet{
+		renderer:     renderer,
+		registry:     registry,
+		health:       health,
+		expectations: expectations,
+		now:          time.Now,
+	}
+}
+
+// Audit checks every TV covered by a currently active expectation and
+// reports those that are not showing what they should
+func (f *Fleet) Audit(ctx context.Context) (AuditReport, error) {
+	now := f.now()
+	report := AuditReport{At: now}
+
+	var mu sync.Mutex
+	for _, exp := range f.expectations {
+		if !inDailyWindow(exp.From, exp.Until, now) {
+			continue
+		}
+
+		tvs, err := f.targets(exp)
+		if err != nil {
+			return report, fmt.Errorf("expectation %q: %w", exp.Name, err)
+		}
+		report.Checked += len(tvs)
+
+		fanOut(ctx, tvs, func(ctx context.Context, tv *TV) error {
+			finding := f.check(ctx, tv, exp, now)
+			if len(finding.Issues) > 0 {
+				mu.Lock()
+				report.Findings = append(report.Findings, finding)
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+
+	return report, nil
+}
+
+// check audits one TV against an expectation
+func (f *Fleet) check(ctx context.Context, tv *TV, exp Expectation, now time.Time) AuditFinding {
+	finding := AuditFinding{TV: tv, Expectation: exp.Name}
+
+	var online bool
+	if f.health != nil {
+		online = f.health.Online(tv)
+	} else {
+		online = Probe(ctx, tv) == nil
+	}
+	if !online {
+		finding.Issues = append(finding.Issues, IssueOffline)
+		return finding
+	}
+
+	frame, ok := f.renderer.LastFrame(tv)
+	if !ok {
+		finding.Issues = append(finding.Issues, IssueNothingShown)
+		return finding
+	}
+	finding.Frame = frame
+
+	if exp.Tag != "" && !slices.Contains(frame.Tags, exp.Tag) {
+		finding.Issues = append(finding.Issues, IssueWrongContent)
+	}
+	if frame.FetchedAt.IsZero() {
+		finding.Issues = append(finding.Issues, IssueNotFetched)
+	}
+	if exp.MaxAge > 0 && now.Sub(frame.ShownAt) > exp.MaxAge {
+		finding.Issues = append(finding.Issues, IssueStale)
+	}
+
+	if exp.Verify != nil && tv.Has(CapScreenshot) {
+		shot, err := tv.Screenshot(ctx)
+		switch {
+		case err != nil:
+			finding.Issues = append(finding.Issues, IssueScreenshotFailed)
+		case !exp.Verify(shot):
+			finding.Issues = append(finding.Issues, IssueScreenMismatch)
+		}
+	}
+
+	return finding
+}
+
+// targets resolves an expectation's zone and TV names
+func (f *Fleet) targets(exp Expectation) ([]*TV, error) {
+	var tvs []*TV
+	if exp.Zone != "" {
+		zone, err := f.registry.Zone(exp.Zone)
+		if err != nil {
+			return nil, err
+		}
+		tvs = append(tvs, zone...)
+	}
+
+	for _, name := range exp.TVs {
+		tv, ok := f.registry.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown TV %q", name)
+		}
+		tvs = append(tvs, tv)
+	}
+	return tvs, nil
+}
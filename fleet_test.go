@@ -0,0 +1,79 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+// TestFleetAudit tests that TVs showing the wrong or no content are reported
+func TestFleetAudit(t *testing.T) {
+	imageURL := regexp.MustCompile(`<CurrentURI>([^<]+)</CurrentURI>`)
+
+	// The fetching TV downloads every image it is pointed at, like a real TV
+	fetchingTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if m := imageURL.FindSubmatch(body); m != nil {
+			if resp, err := http.Get(string(m[1])); err == nil {
+				resp.Body.Close()
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer fetchingTV.Close()
+
+	lazyTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer lazyTV.Close()
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	reg := NewRegistry()
+	reg.AddTV(TV{Name: "Good", ControlURL: fetchingTV.URL})
+	reg.AddTV(TV{Name: "Lazy", ControlURL: lazyTV.URL})
+	reg.AddTV(TV{Name: "Blank", ControlURL: fetchingTV.URL + "/blank"})
+	reg.SetZone("lobby", "Good", "Lazy", "Blank")
+
+	ctx := context.Background()
+	good, _ := reg.Lookup("Good")
+	lazy, _ := reg.Lookup("Lazy")
+	if err := renderer.Show(ctx, good, Content{Text: "MENU", Tags: []string{"menu"}}); err != nil {
+		t.Fatalf("Show failed: %v", err)
+	}
+	if err := renderer.Show(ctx, lazy, Content{Text: "AD", Tags: []string{"ad"}}); err != nil {
+		t.Fatalf("Show failed: %v", err)
+	}
+
+	fleet := NewFleet(renderer, reg, nil, Expectation{Name: "menu", Zone: "lobby", Tag: "menu"})
+	report, err := fleet.Audit(ctx)
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+
+	if report.Checked != 3 {
+		t.Errorf("Expected 3 TVs checked, got %d", report.Checked)
+	}
+
+	issues := make(map[string][]AuditIssue)
+	for _, f := range report.Findings {
+		issues[f.TV.Name] = f.Issues
+	}
+	if _, ok := issues["Good"]; ok {
+		t.Errorf("Expected Good to be compliant, got %v", issues["Good"])
+	}
+	if !slices.Contains(issues["Lazy"], IssueWrongContent) || !slices.Contains(issues["Lazy"], IssueNotFetched) {
+		t.Errorf("Expected Lazy to show wrong, unfetched content, got %v", issues["Lazy"])
+	}
+	if !slices.Equal(issues["Blank"], []AuditIssue{IssueNothingShown}) {
+		t.Errorf("Expected nothing shown on Blank, got %v", issues["Blank"])
+	}
+}
@@ -0,0 +1,116 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"time"
+)
+
+// Frame is a single image scheduled to appear at a specific time
+type Frame struct {
+	At    time.Time   // When the frame should be on screen
+	JPEG  []byte      // Pre-encoded JPEG data (takes precedence over Image)
+	Image image.Image // Image encoded with the renderer's Encoder when JPEG is nil
+}
+
+// FramePlan is a timeline of frames shown on one or more TVs.
+//
+// Frames are scheduled against their absolute timestamps, so sleep jitter
+// never accumulates. Each TV is sent its frame early by its measured action
+// latency, so TVs with slow control endpoints still switch on time.
+type FramePlan struct {
+	Frames []Frame
+
+	// LateTolerance is how far past its timestamp a frame may still be
+	// sent. Later frames are skipped (default 500ms).
+	LateTolerance time.Duration
+
+	// Prefetch is how many upcoming frames are encoded and stored on the
+	// image server ahead of time (default 2).
+	Prefetch int
+}
+
+// FramePlanResult summarizes a played FramePlan
+type FramePlanResult struct {
+	Shown   int // Frames sent to every TV
+	Skipped int // Frames dropped because they were late
+}
+
+// PlayFramePlan shows each frame of the plan on all TVs at its timestamp.
+// Frames must be sorted by At. It blocks until the last frame was sent
+// or ctx is done.
+func (r *Renderer) PlayFramePlan(ctx context.Context, tvs []*TV, plan FramePlan) (FramePlanResult, error) {
+	var result FramePlanResult
+
+	if plan.LateTolerance == 0 {
+		plan.LateTolerance = 500 * time.Millisecond
+	}
+	if plan.Prefetch <= 0 {
+		plan.Prefetch = 2
+	}
+
+	late := func(frame Frame) bool {
+		return time.Since(frame.At) > plan.LateTolerance
+	}
+
+	// URLs and content types of frames already stored on the image server.
+	// Frames that are already late are never stored: they'd only push live
+	// images off the server.
+	urls := make([]string, len(plan.Frames))
+	types := make([]string, len(plan.Frames))
+	prefetch := func(upTo int) error {
+		for i := 0; i <= upTo && i < len(plan.Frames); i++ {
+			if urls[i] != "" || late(plan.Frames[i]) {
+				continue
+			}
+			if data := plan.Frames[i].JPEG; data != nil {
+				urls[i], types[i] = r.server.Store(data), "image/jpeg"
+				continue
+			}
+			url, contentType, err := r.storeImage(plan.Frames[i].Image)
+			if err != nil {
+				return fmt.Errorf("frame %d: %w", i, err)
+			}
+			urls[i], types[i] = url, contentType
+		}
+		return nil
+	}
+
+	for i, frame := range plan.Frames {
+		if err := prefetch(i + plan.Prefetch); err != nil {
+			return result, err
+		}
+
+		if urls[i] == "" || late(frame) {
+			result.Skipped++
+			continue
+		}
+
+		url, contentType := urls[i], types[i]
+		err := fanOut(ctx, tvs, func(ctx context.Context, tv *TV) error {
+			// Send early by this TV's action latency
+			wait := time.Until(frame.At) - r.actionLatency(tv)
+			if wait > 0 {
+				timer := time.NewTimer(wait)
+				defer timer.Stop()
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-timer.C:
+				}
+			}
+			return r.showURL(ctx, tv, url, contentType)
+		})
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return result, ctxErr
+		}
+		if err != nil {
+			return result, fmt.Errorf("frame %d: %w", i, err)
+		}
+
+		result.Shown++
+	}
+
+	return result, nil
+}
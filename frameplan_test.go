@@ -0,0 +1,69 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestPlayFramePlanSkipsLateFrames tests that frames past their tolerance are dropped
+func TestPlayFramePlanSkipsLateFrames(t *testing.T) {
+	var mu sync.Mutex
+	var plays int
+
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("SOAPAction"), "#Play") {
+			mu.Lock()
+			plays++
+			mu.Unlock()
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body></s:Body></s:Envelope>`))
+	}))
+	defer mockTV.Close()
+
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	img := image.NewRGBA(image.Rect(0, 0, 16, 9))
+	now := time.Now()
+	plan := FramePlan{
+		Frames: []Frame{
+			{At: now.Add(-time.Minute), Image: img},
+			{At: now.Add(50 * time.Millisecond), Image: img},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := renderer.PlayFramePlan(ctx, []*TV{tv}, plan)
+	if err != nil {
+		t.Fatalf("PlayFramePlan failed: %v", err)
+	}
+
+	if result.Shown != 1 || result.Skipped != 1 {
+		t.Errorf("Expected 1 shown and 1 skipped, got %+v", result)
+	}
+	if plays != 1 {
+		t.Errorf("Expected 1 Play request, got %d", plays)
+	}
+
+	// The late frame was never encoded and stored
+	renderer.server.mu.RLock()
+	stored := len(renderer.server.images)
+	renderer.server.mu.RUnlock()
+	if stored != 1 {
+		t.Errorf("Stored %d frames, want only the one shown", stored)
+	}
+}
@@ -0,0 +1,494 @@
+package nimsforestsmarttv
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Frame upload protocol
+//
+// A remote producer, e.g. a frame generator in the cloud, POSTs frames to a
+// FrameReceiver next to the TVs, either one per request or many in one
+// long-running request:
+//
+//   - Content-Type image/jpeg: the body is one frame. X-Frame-Seq and
+//     X-Frame-Timestamp headers, as served to TVs, give its sequence number
+//     and capture time; Content-Encoding: gzip compresses it.
+//   - Content-Type application/x-smarttv-frames: the body is a sequence of
+//     frames, each a 21-byte header followed by the frame data. The header
+//     holds the sequence number (uint64), the capture time in Unix
+//     microseconds (int64), flags (uint8, 1 = gzip) and the length of the
+//     data (uint32), all big-endian. Sent with chunked encoding, each frame
+//     is handed on as soon as it arrives.
+//
+// Sequence numbers start at 1. A producer that starts over, numbering from
+// 1 again or opening a new long-running request, has its frames renumbered
+// after the last one received, so consumers don't take them for stale.
+//
+// Requests carry the shared token as "Authorization: Bearer TOKEN".
+// Accepted uploads are answered with 204 No Content.
+const (
+	frameStreamType   = "application/x-smarttv-frames"
+	frameHeaderSize   = 21
+	frameFlagGzip     = 1
+	frameReceiverSlot = 1 // Frames buffered for a slow consumer
+)
+
+// ErrUploadRejected is returned by FramePusher when the receiver refuses
+// an upload
+var ErrUploadRejected = errors.New("frame upload rejected")
+
+// UploadOption configures a FrameReceiver or FramePusher
+type UploadOption func(*uploadConfig)
+
+type uploadConfig struct {
+	token    string
+	compress bool
+	limits   Limits
+	client   *http.Client
+}
+
+// WithUploadToken sets the shared token: receivers refuse uploads without
+// it and pushers send it
+func WithUploadToken(token string) UploadOption {
+	return func(c *uploadConfig) {
+		c.token = token
+	}
+}
+
+// WithUploadCompression makes a pusher gzip frame data. JPEG frames rarely
+// shrink much, so this pays off on slow links with compressible frames.
+func WithUploadCompression() UploadOption {
+	return func(c *uploadConfig) {
+		c.compress = true
+	}
+}
+
+// WithUploadLimits sets the limits for frames a receiver takes (default
+// DefaultLimits). MaxBytes applies to the uncompressed data.
+func WithUploadLimits(l Limits) UploadOption {
+	return func(c *uploadConfig) {
+		c.limits = l
+	}
+}
+
+// WithUploadClient sets the HTTP client of a pusher (default
+// http.DefaultClient)
+func WithUploadClient(client *http.Client) UploadOption {
+	return func(c *uploadConfig) {
+		c.client = client
+	}
+}
+
+func newUploadConfig(opts []UploadOption) uploadConfig {
+	cfg := uploadConfig{limits: DefaultLimits, client: http.DefaultClient}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// FrameReceiver is an HTTP handler taking frames pushed by remote
+// producers. Frames come out of Frames, ready for DisplayFrameStream:
+//
+//	receiver := smarttv.NewFrameReceiver(smarttv.WithUploadToken(token))
+//	http.Handle("/frames", receiver)
+//	go renderer.DisplayFrameStream(ctx, tv, receiver.Frames(), smarttv.StreamOptions{MaxFPS: 2})
+type FrameReceiver struct {
+	cfg    uploadConfig
+	frames chan StreamFrame
+	done   chan struct{}
+
+	mu       sync.Mutex
+	closed   bool
+	active   sync.WaitGroup // Uploads in progress
+	received int
+	offset   uint64 // Added to producers' numbers since they last started over
+	last     uint64 // Highest number handed on
+}
+
+// NewFrameReceiver creates a receiver for pushed frames
+func NewFrameReceiver(opts ...UploadOption) *FrameReceiver {
+	return &FrameReceiver{
+		cfg:    newUploadConfig(opts),
+		frames: make(chan StreamFrame, frameReceiverSlot),
+		done:   make(chan struct{}),
+	}
+}
+
+// Frames returns the received frames. It is closed by Close.
+func (fr *FrameReceiver) Frames() <-chan StreamFrame {
+	return fr.frames
+}
+
+// Received returns the number of frames received so far
+func (fr *FrameReceiver) Received() int {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	return fr.received
+}
+
+// Close stops taking uploads, waits for those in progress to end and
+// closes Frames
+func (fr *FrameReceiver) Close() error {
+	fr.mu.Lock()
+	if fr.closed {
+		fr.mu.Unlock()
+		return nil
+	}
+	fr.closed = true
+	close(fr.done)
+	fr.mu.Unlock()
+
+	fr.active.Wait()
+	close(fr.frames)
+	return nil
+}
+
+// ServeHTTP takes an upload
+func (fr *FrameReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !fr.authorized(req) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	fr.mu.Lock()
+	if fr.closed {
+		fr.mu.Unlock()
+		http.Error(w, "Receiver closed", http.StatusServiceUnavailable)
+		return
+	}
+	fr.active.Add(1)
+	fr.mu.Unlock()
+	defer fr.active.Done()
+
+	var err error
+	mediaType, _, _ := strings.Cut(req.Header.Get("Content-Type"), ";")
+	switch strings.TrimSpace(mediaType) {
+	case frameStreamType:
+		err = fr.receiveStream(req)
+	case "image/jpeg":
+		err = fr.receiveFrame(req)
+	default:
+		http.Error(w, "Unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, ErrImageTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, errReceiverClosed):
+		http.Error(w, "Receiver closed", http.StatusServiceUnavailable)
+	case req.Context().Err() != nil:
+		// The producer went away
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// errReceiverClosed ends uploads in progress when the receiver is closed
+var errReceiverClosed = errors.New("receiver closed")
+
+// authorized checks the bearer token of an upload
+func (fr *FrameReceiver) authorized(req *http.Request) bool {
+	if fr.cfg.token == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(fr.cfg.token)) == 1
+}
+
+// receiveFrame takes a single frame with its position in headers
+func (fr *FrameReceiver) receiveFrame(req *http.Request) error {
+	var frame StreamFrame
+	if seq := req.Header.Get("X-Frame-Seq"); seq != "" {
+		n, err := strconv.ParseUint(seq, 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad X-Frame-Seq: %w", err)
+		}
+		frame.Seq = n
+	}
+	if ts := req.Header.Get("X-Frame-Timestamp"); ts != "" {
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return fmt.Errorf("bad X-Frame-Timestamp: %w", err)
+		}
+		frame.CapturedAt = t
+	}
+	restart := frame.Seq == 1
+
+	var err error
+	switch req.Header.Get("Content-Encoding") {
+	case "", "identity":
+		frame.JPEG, err = fr.readData(req.Body, false)
+	case "gzip":
+		frame.JPEG, err = fr.readData(req.Body, true)
+	default:
+		return fmt.Errorf("unsupported Content-Encoding %q", req.Header.Get("Content-Encoding"))
+	}
+	if err != nil {
+		return err
+	}
+	return fr.deliver(req.Context(), frame, restart)
+}
+
+// receiveStream takes frames from a long-running upload until it ends
+func (fr *FrameReceiver) receiveStream(req *http.Request) error {
+	body := bufio.NewReader(req.Body)
+	for first := true; ; first = false {
+		var head [frameHeaderSize]byte
+		if _, err := io.ReadFull(body, head[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("read frame header: %w", err)
+		}
+		frame := StreamFrame{Seq: binary.BigEndian.Uint64(head[0:8])}
+		if us := int64(binary.BigEndian.Uint64(head[8:16])); us != 0 {
+			frame.CapturedAt = time.UnixMicro(us)
+		}
+		flags := head[16]
+		size := binary.BigEndian.Uint32(head[17:21])
+
+		// Compressed data can't be larger than what it decompresses to
+		if max := fr.cfg.limits.MaxBytes; max > 0 && int64(size) > int64(max) {
+			return fmt.Errorf("%w: frame %d has %d bytes (limit %d)", ErrImageTooLarge, frame.Seq, size, max)
+		}
+		data := &io.LimitedReader{R: body, N: int64(size)}
+		var err error
+		if frame.JPEG, err = fr.readData(data, flags&frameFlagGzip != 0); err != nil {
+			return fmt.Errorf("frame %d: %w", frame.Seq, err)
+		}
+		if data.N > 0 {
+			// Truncated, or trailing bytes after the gzip stream
+			return fmt.Errorf("frame %d: %d of %d bytes unread", frame.Seq, data.N, size)
+		}
+		if err := fr.deliver(req.Context(), frame, first || frame.Seq == 1); err != nil {
+			return err
+		}
+	}
+}
+
+// readData reads frame data, decompressing it if needed, and checks it
+// against the limits
+func (fr *FrameReceiver) readData(r io.Reader, compressed bool) ([]byte, error) {
+	if compressed {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	if max := fr.cfg.limits.MaxBytes; max > 0 {
+		r = io.LimitReader(r, int64(max)+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := fr.cfg.limits.Check(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// deliver numbers a frame and hands it to the consumer of Frames. restart
+// is true for the first frame of a producer that may have started over.
+func (fr *FrameReceiver) deliver(ctx context.Context, frame StreamFrame, restart bool) error {
+	fr.number(&frame, restart)
+	select {
+	case fr.frames <- frame:
+	case <-fr.done:
+		return errReceiverClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	fr.mu.Lock()
+	fr.received++
+	fr.mu.Unlock()
+	return nil
+}
+
+// number maps a producer's frame number onto the receiver's, which never
+// goes back: a producer starting over continues after the last frame
+// handed on, and frames without a number are numbered after it
+func (fr *FrameReceiver) number(frame *StreamFrame, restart bool) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	switch {
+	case frame.Seq == 0:
+		frame.Seq = fr.last + 1
+	case restart && frame.Seq+fr.offset <= fr.last:
+		fr.offset = fr.last + 1 - frame.Seq
+		frame.Seq = fr.last + 1
+	default:
+		frame.Seq += fr.offset
+	}
+	fr.last = max(fr.last, frame.Seq)
+}
+
+// FramePusher uploads frames to a FrameReceiver, e.g. from a frame
+// generator in the cloud to the receiver on the TVs' network
+type FramePusher struct {
+	url string
+	cfg uploadConfig
+
+	mu  sync.Mutex
+	seq uint64 // Last sequence number sent
+}
+
+// NewFramePusher creates a pusher for the receiver at url
+func NewFramePusher(url string, opts ...UploadOption) *FramePusher {
+	return &FramePusher{url: url, cfg: newUploadConfig(opts)}
+}
+
+// number fills in the sequence number and capture time of a frame.
+// Frames without a number are numbered after the last one.
+func (p *FramePusher) number(frame *StreamFrame) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if frame.Seq == 0 {
+		frame.Seq = p.seq + 1
+	}
+	p.seq = max(p.seq, frame.Seq)
+	if frame.CapturedAt.IsZero() {
+		frame.CapturedAt = time.Now()
+	}
+}
+
+// Send uploads a single frame in its own request
+func (p *FramePusher) Send(ctx context.Context, frame StreamFrame) error {
+	p.number(&frame)
+	data := frame.JPEG
+	if p.cfg.compress {
+		var err error
+		if data, err = gzipData(data); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "image/jpeg")
+	req.Header.Set("X-Frame-Seq", strconv.FormatUint(frame.Seq, 10))
+	req.Header.Set("X-Frame-Timestamp", frame.CapturedAt.UTC().Format(time.RFC3339Nano))
+	if p.cfg.compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if err := p.do(req); err != nil {
+		return fmt.Errorf("send frame %d: %w", frame.Seq, err)
+	}
+	return nil
+}
+
+// Push uploads the frames from a channel in one request until the channel
+// is closed or ctx is done. Each frame is sent as soon as it arrives.
+func (p *FramePusher) Push(ctx context.Context, frames <-chan StreamFrame) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(p.writeFrames(ctx, pw, frames))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, pr)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", frameStreamType)
+	if err := p.do(req); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("push frames: %w", err)
+	}
+	return nil
+}
+
+// writeFrames writes frames in the stream format until the channel is
+// closed
+func (p *FramePusher) writeFrames(ctx context.Context, w io.Writer, frames <-chan StreamFrame) error {
+	for {
+		var frame StreamFrame
+		var ok bool
+		select {
+		case frame, ok = <-frames:
+			if !ok {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		p.number(&frame)
+
+		data, flags := frame.JPEG, byte(0)
+		if p.cfg.compress {
+			var err error
+			if data, err = gzipData(data); err != nil {
+				return err
+			}
+			flags |= frameFlagGzip
+		}
+
+		head := binary.BigEndian.AppendUint64(nil, frame.Seq)
+		head = binary.BigEndian.AppendUint64(head, uint64(frame.CapturedAt.UnixMicro()))
+		head = append(head, flags)
+		head = binary.BigEndian.AppendUint32(head, uint32(len(data)))
+		if _, err := w.Write(append(head, data...)); err != nil {
+			return err
+		}
+	}
+}
+
+// do sends an upload and checks the receiver's answer
+func (p *FramePusher) do(req *http.Request) error {
+	if p.cfg.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.cfg.token)
+	}
+	resp, err := p.cfg.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%w: HTTP %d: %s", ErrUploadRejected, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// gzipData compresses data
+func gzipData(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,142 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFramePusherPush(t *testing.T) {
+	receiver := NewFrameReceiver(WithUploadToken("secret"))
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	pusher := NewFramePusher(server.URL, WithUploadToken("secret"), WithUploadCompression())
+	frames := make(chan StreamFrame)
+	pushed := make(chan error, 1)
+	go func() {
+		pushed <- pusher.Push(context.Background(), frames)
+	}()
+
+	captured := time.Now().Add(-time.Second).Truncate(time.Microsecond)
+	sent := []StreamFrame{
+		{JPEG: []byte(strings.Repeat("a", 1000))},
+		{Seq: 7, CapturedAt: captured, JPEG: []byte("frame 7")},
+		{JPEG: []byte("frame 8")},
+	}
+	for _, frame := range sent {
+		frames <- frame
+		// Each frame arrives while the upload is still running
+		got := <-receiver.Frames()
+		if string(got.JPEG) != string(frame.JPEG) {
+			t.Errorf("Received %q, want %q", got.JPEG, frame.JPEG)
+		}
+		if frame.Seq != 0 && got.Seq != frame.Seq {
+			t.Errorf("Seq = %d, want %d", got.Seq, frame.Seq)
+		}
+		if !frame.CapturedAt.IsZero() && !got.CapturedAt.Equal(frame.CapturedAt) {
+			t.Errorf("CapturedAt = %v, want %v", got.CapturedAt, frame.CapturedAt)
+		}
+		if got.CapturedAt.IsZero() {
+			t.Error("Frame without capture time")
+		}
+	}
+	close(frames)
+	if err := <-pushed; err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if receiver.Received() != 3 {
+		t.Errorf("Received() = %d, want 3", receiver.Received())
+	}
+
+	// Numbering goes on after the highest number sent
+	done := make(chan error, 1)
+	go func() {
+		done <- pusher.Send(context.Background(), StreamFrame{JPEG: []byte("single")})
+	}()
+	if got := <-receiver.Frames(); got.Seq != 9 || string(got.JPEG) != "single" {
+		t.Errorf("Send delivered frame %d %q, want 9 \"single\"", got.Seq, got.JPEG)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Send failed: %v", err)
+	}
+}
+
+// TestFrameReceiverRestart tests that a producer starting over is not taken
+// for one sending stale frames
+func TestFrameReceiverRestart(t *testing.T) {
+	receiver := NewFrameReceiver()
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	send := func(pusher *FramePusher, frame StreamFrame) uint64 {
+		t.Helper()
+		done := make(chan error, 1)
+		go func() {
+			done <- pusher.Send(context.Background(), frame)
+		}()
+		got := <-receiver.Frames()
+		if err := <-done; err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+		return got.Seq
+	}
+
+	first := NewFramePusher(server.URL)
+	for want := range uint64(3) {
+		if seq := send(first, StreamFrame{JPEG: []byte("a")}); seq != want+1 {
+			t.Errorf("Seq = %d, want %d", seq, want+1)
+		}
+	}
+	// The producer restarts and numbers from 1 again
+	second := NewFramePusher(server.URL)
+	if seq := send(second, StreamFrame{JPEG: []byte("b")}); seq != 4 {
+		t.Errorf("Seq after a restart = %d, want 4", seq)
+	}
+	if seq := send(second, StreamFrame{JPEG: []byte("b")}); seq != 5 {
+		t.Errorf("Seq after a restart = %d, want 5", seq)
+	}
+	// Frame 1 always starts over
+	if seq := send(second, StreamFrame{Seq: 1, JPEG: []byte("b")}); seq != 6 {
+		t.Errorf("Seq of a second restart = %d, want 6", seq)
+	}
+}
+
+func TestFrameReceiverRejects(t *testing.T) {
+	receiver := NewFrameReceiver(WithUploadToken("secret"), WithUploadLimits(Limits{MaxBytes: 100}))
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	ctx := context.Background()
+
+	err := NewFramePusher(server.URL, WithUploadToken("wrong")).Send(ctx, StreamFrame{JPEG: []byte("x")})
+	if !errors.Is(err, ErrUploadRejected) || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Wrong token: got %v", err)
+	}
+
+	pusher := NewFramePusher(server.URL, WithUploadToken("secret"), WithUploadCompression())
+	err = pusher.Send(ctx, StreamFrame{JPEG: make([]byte, 1000)})
+	if !errors.Is(err, ErrUploadRejected) || !strings.Contains(err.Error(), "413") {
+		t.Errorf("Frame over the limit: got %v", err)
+	}
+
+	frames := make(chan StreamFrame, 1)
+	frames <- StreamFrame{JPEG: make([]byte, 1000)}
+	close(frames)
+	if err := pusher.Push(ctx, frames); !errors.Is(err, ErrUploadRejected) {
+		t.Errorf("Pushed frame over the limit: got %v", err)
+	}
+	if receiver.Received() != 0 {
+		t.Errorf("Received() = %d for refused frames", receiver.Received())
+	}
+
+	receiver.Close()
+	if _, ok := <-receiver.Frames(); ok {
+		t.Error("Frames still open after Close")
+	}
+	if err := pusher.Send(ctx, StreamFrame{JPEG: []byte("x")}); !errors.Is(err, ErrUploadRejected) {
+		t.Errorf("Send after Close: got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// FuzzParseSSDP feeds arbitrary datagrams to the SSDP parser, as anyone on
+// the LAN can
+func FuzzParseSSDP(f *testing.F) {
+	f.Add("HTTP/1.1 200 OK\r\nCACHE-CONTROL: max-age=1800\r\nLOCATION: http://192.168.1.20:9197/dmr\r\nST: urn:schemas-upnp-org:device:MediaRenderer:1\r\nUSN: uuid:1234::urn:schemas-upnp-org:device:MediaRenderer:1\r\n\r\n")
+	f.Add("NOTIFY * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nNT: upnp:rootdevice\r\nNTS: ssdp:byebye\r\nUSN: uuid:1234::upnp:rootdevice\r\n\r\n")
+	f.Add("NOTIFY * HTTP/1.1\nlocation:http://[::1]:80/\nnts :  ssdp:alive \n")
+
+	f.Fuzz(func(t *testing.T, data string) {
+		resp := parseSSDP(data)
+		for _, v := range []string{resp.Location, resp.Server, resp.USN, resp.NT, resp.NTS} {
+			if strings.ContainsAny(v, "\r\n") || strings.TrimSpace(v) != v || len(v) > maxSSDPValue {
+				t.Errorf("unclean header value %q", v)
+			}
+		}
+	})
+}
+
+// FuzzParseDeviceDescription feeds arbitrary documents to the device
+// description parser, as a device on the LAN can
+func FuzzParseDeviceDescription(f *testing.F) {
+	f.Add([]byte(testDescription), false)
+	f.Add([]byte(testDescription), true)
+	f.Add([]byte(exploreDescription), false)
+	f.Add([]byte(`<root><URLBase>http://10.0.0.2:8080/</URLBase><device><friendlyName>A &amp; B</friendlyName><serviceList><service><serviceType>urn:schemas-upnp-org:service:AVTransport:1</serviceType><controlURL> /avt </controlURL></service></serviceList></device></root>`), false)
+	f.Add([]byte("<?xml version=\"1.0\" encoding=\"Shift_JIS\"?><root><device><friendlyName>\x83e\x83\x8c\x83r</friendlyName></device></root>"), true)
+
+	f.Fuzz(func(t *testing.T, data []byte, lenient bool) {
+		tv, err := parseDeviceDescription(bytes.NewReader(data), "http://192.168.1.20:9197/dmr", lenient)
+		if err != nil {
+			return
+		}
+		if !isHTTPURL(tv.ControlURL) {
+			t.Errorf("invalid control URL %q", tv.ControlURL)
+		}
+		for _, u := range []string{tv.SCPDURL, tv.IconURL, tv.KeyControlURL, tv.VolumeControlURL} {
+			if u != "" && !isHTTPURL(u) {
+				t.Errorf("invalid URL %q", u)
+			}
+		}
+		for _, s := range []string{tv.Name, tv.UDN, tv.Manufacturer, tv.ModelName} {
+			if strings.IndexFunc(s, unicode.IsControl) >= 0 {
+				t.Errorf("control characters in %q", s)
+			}
+		}
+	})
+}
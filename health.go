@@ -0,0 +1,129 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// HealthChecker periodically probes TVs and reports when they go offline
+// or come back. It is safe for concurrent use.
+type HealthChecker struct {
+	interval time.Duration
+
+	mu        sync.Mutex
+	tvs       map[string]*TV
+	online    map[string]bool
+	listeners []func(tv *TV, online bool)
+}
+
+// NewHealthChecker creates a checker probing every interval (default 30s)
+func NewHealthChecker(interval time.Duration) *HealthChecker {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	return &HealthChecker{
+		interval: interval,
+		tvs:      make(map[string]*TV),
+		online:   make(map[string]bool),
+	}
+}
+
+// Watch adds a TV to the set of probed TVs. It counts as online until the
+// first failed probe.
+func (h *HealthChecker) Watch(tv *TV) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.tvs[tv.ControlURL]; !ok {
+		h.online[tv.ControlURL] = true
+	}
+	h.tvs[tv.ControlURL] = tv
+}
+
+// OnChange registers fn to be called whenever a TV changes between online
+// and offline. fn runs on the checker's goroutine and should not block.
+func (h *HealthChecker) OnChange(fn func(tv *TV, online bool)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners = append(h.listeners, fn)
+}
+
+// Online reports the last known state of a TV
+func (h *HealthChecker) Online(tv *TV) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	online, ok := h.online[tv.ControlURL]
+	return !ok || online
+}
+
+// Run probes all watched TVs every interval until ctx is done
+func (h *HealthChecker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		h.CheckAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll probes every watched TV once and fires change notifications
+func (h *HealthChecker) CheckAll(ctx context.Context) {
+	h.mu.Lock()
+	tvs := make([]*TV, 0, len(h.tvs))
+	for _, tv := range h.tvs {
+		tvs = append(tvs, tv)
+	}
+	h.mu.Unlock()
+
+	fanOut(ctx, tvs, func(ctx context.Context, tv *TV) error {
+		h.setOnline(tv, Probe(ctx, tv) == nil)
+		return nil
+	})
+}
+
+// setOnline records a probe result and notifies listeners on changes
+func (h *HealthChecker) setOnline(tv *TV, online bool) {
+	h.mu.Lock()
+	changed := h.online[tv.ControlURL] != online
+	h.online[tv.ControlURL] = online
+	listeners := h.listeners
+	h.mu.Unlock()
+
+	if changed {
+		for _, fn := range listeners {
+			fn(tv, online)
+		}
+	}
+}
+
+// Probe checks that the TV's control endpoint accepts connections
+func Probe(ctx context.Context, tv *TV) error {
+	u, err := url.Parse(tv.ControlURL)
+	if err != nil {
+		return err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "80")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -2,6 +2,7 @@ package nimsforestsmarttv
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -195,9 +196,11 @@ func TestDisplayHLSDefaultTitle(t *testing.T) {
 	var receivedBody string
 
 	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		buf := make([]byte, 8192)
-		n, _ := r.Body.Read(buf)
-		receivedBody = string(buf[:n])
+		body, _ := io.ReadAll(r.Body)
+		// Only the SetAVTransportURI request carries the title
+		if strings.Contains(r.Header.Get("SOAPAction"), "SetAVTransportURI") {
+			receivedBody = string(body)
+		}
 
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(`<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body></s:Body></s:Envelope>`))
@@ -228,7 +231,7 @@ func TestDisplayHLSDefaultTitle(t *testing.T) {
 }
 
 // ExampleDisplayHLS demonstrates how to stream HLS to a TV
-func ExampleDisplayHLS() {
+func ExampleRenderer_DisplayHLS() {
 	ctx := context.Background()
 
 	// Discover TVs
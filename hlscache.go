@@ -0,0 +1,350 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hlsSegmentDir is the proxy path under which rewritten playlist entries
+// are served
+const hlsSegmentDir = "_seg/"
+
+// Limits for cached HLS data
+const (
+	maxPlaylistSize = 4 << 20
+	maxSegmentSize  = 64 << 20
+	segmentTimeout  = time.Minute
+)
+
+// playlistURI matches URI attributes of playlist tags, e.g. EXT-X-KEY
+var playlistURI = regexp.MustCompile(`URI="([^"]*)"`)
+
+// WithSegmentCache makes the proxy rewrite HLS playlists so the TV fetches
+// every segment, key and variant playlist from the proxy, and downloads the
+// next ahead segments (default 3) before the TV asks for them. This smooths
+// playback on TVs with tiny buffers and flaky CDNs, and also proxies
+// segments that playlists list with absolute URLs.
+func WithSegmentCache(ahead int) ProxyOption {
+	return func(t *proxyTarget) {
+		if ahead <= 0 {
+			ahead = 3
+		}
+		t.hls = &hlsCache{
+			ahead:    ahead,
+			urls:     make(map[string]*url.URL),
+			listed:   make(map[string][]string),
+			segments: make(map[string]*cachedSegment),
+			keys:     make(map[string]bool),
+		}
+	}
+}
+
+// hlsCache holds the segments of one proxied HLS stream
+type hlsCache struct {
+	ahead int
+
+	mu       sync.Mutex
+	urls     map[string]*url.URL       // Source of every rewritten entry by ID
+	listed   map[string][]string       // IDs of the entries of each playlist, by its host and path
+	segments map[string]*cachedSegment // Downloaded or downloading segments by ID
+	cached   []string                  // Segment IDs in the order they were cached
+	order    []string                  // Segment IDs of the last media playlist
+	keys     map[string]bool           // IDs of encryption keys
+}
+
+// cachedSegment is a segment download; done is closed when it finished
+type cachedSegment struct {
+	done        chan struct{}
+	data        []byte
+	contentType string
+	err         error
+}
+
+// isPlaylist reports whether a response is an HLS playlist
+func isPlaylist(resp *http.Response) bool {
+	contentType := strings.ToLower(resp.Header.Get("Content-Type"))
+	return strings.Contains(contentType, "mpegurl") || path.Ext(resp.Request.URL.Path) == ".m3u8"
+}
+
+// entryID names a playlist entry after its source URL, so refreshed live
+// playlists map the same segments to the same IDs
+func entryID(u *url.URL) string {
+	h := fnv.New64a()
+	h.Write([]byte(u.String()))
+	ext := path.Ext(u.Path)
+	if len(ext) > 6 || strings.ContainsAny(ext, "/?#%") {
+		ext = ""
+	}
+	return fmt.Sprintf("%016x%s", h.Sum64(), ext)
+}
+
+// rewrite points every URI of a playlist fetched from base at the proxy
+// path prefix. It returns the rewritten playlist, the IDs of its media
+// segments in order and whether the playlist is complete (VOD).
+func (c *hlsCache) rewrite(playlist []byte, base *url.URL, prefix string) ([]byte, []string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var ids []string
+	local := func(uri string) (string, string, bool) {
+		ref, err := url.Parse(strings.TrimSpace(uri))
+		if err != nil {
+			return uri, "", false
+		}
+		abs := base.ResolveReference(ref)
+		if abs.Scheme != "http" && abs.Scheme != "https" {
+			return uri, "", false
+		}
+		id := entryID(abs)
+		c.urls[id] = abs
+		ids = append(ids, id)
+		return prefix + id, id, true
+	}
+
+	var out bytes.Buffer
+	var order []string
+	complete := false
+	for line := range strings.Lines(string(playlist)) {
+		text := strings.TrimRight(line, "\r\n")
+		switch {
+		case text == "":
+		case strings.HasPrefix(text, "#"):
+			if text == "#EXT-X-ENDLIST" {
+				complete = true
+			}
+			key := strings.HasPrefix(text, "#EXT-X-KEY:") || strings.HasPrefix(text, "#EXT-X-SESSION-KEY:")
+			text = playlistURI.ReplaceAllStringFunc(text, func(attr string) string {
+				uri, id, ok := local(playlistURI.FindStringSubmatch(attr)[1])
+				if ok && key {
+					c.keys[id] = true
+				}
+				return `URI="` + uri + `"`
+			})
+		default:
+			var id string
+			var ok bool
+			if text, id, ok = local(text); ok && path.Ext(id) != ".m3u8" {
+				order = append(order, id)
+			}
+		}
+		out.WriteString(text + "\n")
+	}
+	c.listed[base.Host+base.Path] = ids
+	c.prune()
+	return out.Bytes(), order, complete
+}
+
+// prune forgets entries that no playlist lists anymore and that aren't
+// cached, e.g. the segments that fell off a live playlist. Call with mu
+// held.
+func (c *hlsCache) prune() {
+	listed := make(map[string]bool, len(c.urls))
+	for _, ids := range c.listed {
+		for _, id := range ids {
+			listed[id] = true
+		}
+	}
+	for id := range c.urls {
+		if _, cached := c.segments[id]; !cached && !listed[id] {
+			delete(c.urls, id)
+			delete(c.keys, id)
+		}
+	}
+}
+
+// get returns the download of a segment, starting it if needed. It returns
+// nil for IDs no playlist listed.
+func (c *hlsCache) get(id string, download func(u *url.URL) ([]byte, string, error)) *cachedSegment {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if seg, ok := c.segments[id]; ok {
+		return seg
+	}
+	u, ok := c.urls[id]
+	if !ok {
+		return nil
+	}
+
+	seg := &cachedSegment{done: make(chan struct{})}
+	c.segments[id] = seg
+	c.cached = append(c.cached, id)
+	if len(c.cached) > 3*c.ahead+1 {
+		for len(c.cached) > 3*c.ahead+1 {
+			delete(c.segments, c.cached[0])
+			c.cached = c.cached[1:]
+		}
+		c.prune()
+	}
+
+	go func() {
+		seg.data, seg.contentType, seg.err = download(u)
+		close(seg.done)
+		if seg.err != nil {
+			// Let the next request try again
+			c.mu.Lock()
+			if c.segments[id] == seg {
+				delete(c.segments, id)
+			}
+			c.mu.Unlock()
+		}
+	}()
+	return seg
+}
+
+// prefetch starts downloading the segments after the one at index from of
+// the last media playlist (-1 = from the start)
+func (c *hlsCache) prefetch(from int, download func(u *url.URL) ([]byte, string, error)) {
+	c.mu.Lock()
+	var next []string
+	if from+1 < len(c.order) {
+		next = c.order[from+1 : min(from+1+c.ahead, len(c.order))]
+	}
+	c.mu.Unlock()
+
+	for _, id := range next {
+		c.get(id, download)
+	}
+}
+
+// isKey reports whether an entry is an encryption key rather than media
+func (c *hlsCache) isKey(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.keys[id]
+}
+
+// position returns the index of a segment in the last media playlist
+func (c *hlsCache) position(id string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, seg := range c.order {
+		if seg == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// servePlaylist rewrites a fetched playlist and starts caching the
+// segments the TV will ask for first
+func (s *ImageServer) servePlaylist(w http.ResponseWriter, token string, target proxyTarget, resp *http.Response) {
+	if resp.StatusCode != http.StatusOK {
+		w.WriteHeader(resp.StatusCode)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPlaylistSize))
+	if err != nil {
+		http.Error(w, "proxy: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	c := target.hls
+	prefix := s.pathPrefix + "/proxy/" + token + "/" + hlsSegmentDir
+	playlist, order, complete := c.rewrite(body, resp.Request.URL, prefix)
+	if len(order) > 0 {
+		c.mu.Lock()
+		c.order = order
+		c.mu.Unlock()
+
+		// VOD players start at the beginning, live players near the end
+		from := -1
+		if !complete {
+			from = len(order) - c.ahead - 1
+		}
+		c.prefetch(max(from, -1), target.downloader())
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(playlist)
+}
+
+// serveHLS serves a rewritten playlist entry: variant playlists are fetched
+// and rewritten, segments and keys come from the cache
+func (s *ImageServer) serveHLS(w http.ResponseWriter, r *http.Request, token string, target proxyTarget, id string) {
+	c := target.hls
+	if path.Ext(id) == ".m3u8" {
+		c.mu.Lock()
+		source, ok := c.urls[id]
+		c.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		resp, err := target.fetch(r.Context(), http.MethodGet, source, nil)
+		if err != nil {
+			http.Error(w, "proxy: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		s.servePlaylist(w, token, target, resp)
+		return
+	}
+
+	download := target.downloader()
+	seg := c.get(id, download)
+	if seg == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if i := c.position(id); i >= 0 {
+		c.prefetch(i, download)
+	}
+
+	select {
+	case <-seg.done:
+	case <-r.Context().Done():
+		return
+	}
+	if seg.err != nil {
+		http.Error(w, "proxy: "+seg.err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if target.record != nil && r.Method == http.MethodGet && !c.isKey(id) {
+		target.record.segment(id, seg.data)
+	}
+
+	if seg.contentType != "" {
+		w.Header().Set("Content-Type", seg.contentType)
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(seg.data))
+}
+
+// downloader returns a function downloading segments with the target's
+// credentials
+func (t proxyTarget) downloader() func(u *url.URL) ([]byte, string, error) {
+	return func(u *url.URL) ([]byte, string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), segmentTimeout)
+		defer cancel()
+
+		resp, err := t.fetch(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, "", fmt.Errorf("segment: HTTP %d", resp.StatusCode)
+		}
+
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxSegmentSize+1))
+		if err != nil {
+			return nil, "", err
+		}
+		if len(data) > maxSegmentSize {
+			return nil, "", fmt.Errorf("segment larger than %d bytes", maxSegmentSize)
+		}
+		return data, resp.Header.Get("Content-Type"), nil
+	}
+}
@@ -0,0 +1,153 @@
+package nimsforestsmarttv
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSegmentCache(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	leaked := false
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		leaked = leaked || r.Header.Get("Authorization") != ""
+		mu.Unlock()
+		w.Header().Set("Content-Type", "video/mp2t")
+		io.WriteString(w, "segment "+r.URL.Path)
+	}))
+	defer cdn.Close()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t1" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		switch r.URL.Path {
+		case "/master.m3u8":
+			io.WriteString(w, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000\nhd/index.m3u8\n")
+		case "/hd/index.m3u8":
+			fmt.Fprintf(w, "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"key.bin\"\n")
+			for i := range 5 {
+				fmt.Fprintf(w, "#EXTINF:2,\n%s/seg%d.ts\n", cdn.URL, i)
+			}
+			io.WriteString(w, "#EXT-X-ENDLIST\n")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer origin.Close()
+
+	server, err := NewImageServer()
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Close()
+
+	proxied, err := server.Proxy(origin.URL+"/master.m3u8", WithSegmentCache(2), WithBearerToken("t1"))
+	if err != nil {
+		t.Fatalf("Proxy failed: %v", err)
+	}
+
+	get := func(url string) string {
+		t.Helper()
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("GET %s: %v", url, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: HTTP %d", url, resp.StatusCode)
+		}
+		return string(body)
+	}
+	entries := func(playlist string) []string {
+		var uris []string
+		for line := range strings.Lines(playlist) {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				uris = append(uris, server.URL()+line)
+			}
+		}
+		return uris
+	}
+
+	master := get(proxied)
+	variants := entries(master)
+	if len(variants) != 1 || !strings.Contains(variants[0], "/_seg/") {
+		t.Fatalf("master playlist not rewritten:\n%s", master)
+	}
+
+	media := get(variants[0])
+	segments := entries(media)
+	if len(segments) != 5 || strings.Contains(media, cdn.URL) || strings.Contains(media, `URI="key.bin"`) {
+		t.Fatalf("media playlist not rewritten:\n%s", media)
+	}
+
+	// The first segments of a VOD playlist are fetched before the TV asks
+	waitFor := func(path string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mu.Lock()
+			n := hits[path]
+			mu.Unlock()
+			if n > 0 {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s was not prefetched", path)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor("/seg0.ts")
+	waitFor("/seg1.ts")
+
+	for i, seg := range segments {
+		if body := get(seg); body != fmt.Sprintf("segment /seg%d.ts", i) {
+			t.Errorf("segment %d = %q", i, body)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if leaked {
+		t.Error("the source's token was sent to the CDN")
+	}
+	for i := range 5 {
+		if n := hits[fmt.Sprintf("/seg%d.ts", i)]; n != 1 {
+			t.Errorf("segment %d fetched %d times from the CDN, want once", i, n)
+		}
+	}
+}
+
+// TestSegmentCachePrune tests that entries of a live playlist are forgotten
+// once they fall off it
+func TestSegmentCachePrune(t *testing.T) {
+	var target proxyTarget
+	WithSegmentCache(1)(&target)
+	c := target.hls
+	base, _ := url.Parse("http://origin/live.m3u8")
+
+	for first := range 20 {
+		var playlist strings.Builder
+		playlist.WriteString("#EXTM3U\n")
+		for i := first; i < first+3; i++ {
+			fmt.Fprintf(&playlist, "#EXTINF:2,\nseg%d.ts\n", i)
+		}
+		c.rewrite([]byte(playlist.String()), base, "/")
+	}
+	if len(c.urls) != 3 {
+		t.Errorf("cache knows %d entries, want the 3 of the last playlist", len(c.urls))
+	}
+}
@@ -0,0 +1,92 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrNoIcon is returned when the TV doesn't advertise an icon
+var ErrNoIcon = errors.New("TV has no icon")
+
+// ErrNoThumbnail is returned when nothing has been shown on the TV yet
+var ErrNoThumbnail = errors.New("no frame shown on TV")
+
+// icon is an entry of the device description's iconList
+type icon struct {
+	MimeType string `xml:"mimetype"`
+	Width    int    `xml:"width"`
+	Height   int    `xml:"height"`
+	URL      string `xml:"url"`
+}
+
+// pickIcon returns the URL of the largest icon Go can decode
+func pickIcon(icons []icon) string {
+	var best icon
+	for _, ic := range icons {
+		switch strings.TrimSpace(ic.MimeType) {
+		case "image/png", "image/jpeg", "image/gif":
+		default:
+			continue
+		}
+		if best.URL == "" || ic.Width*ic.Height > best.Width*best.Height {
+			best = ic
+		}
+	}
+	return strings.TrimSpace(best.URL)
+}
+
+// Icon downloads and decodes the icon the TV advertises in its device
+// description, e.g. for a TV picker UI
+func (tv *TV) Icon(ctx context.Context) (image.Image, error) {
+	if tv.IconURL == "" {
+		return nil, ErrNoIcon
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", tv.IconURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch icon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch icon: HTTP %d", resp.StatusCode)
+	}
+
+	img, _, err := image.Decode(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("decode icon: %w", err)
+	}
+	return img, nil
+}
+
+// Thumbnail returns a small copy of the last frame shown on the TV, scaled
+// to fit within width x height, e.g. for a live preview in a TV picker UI
+func (r *Renderer) Thumbnail(tv *TV, width, height int) (image.Image, error) {
+	r.mu.Lock()
+	frame, ok := r.lastFrame[tv.ControlURL]
+	r.mu.Unlock()
+
+	if !ok {
+		return nil, ErrNoThumbnail
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(frame.img.data))
+	if err != nil {
+		return nil, fmt.Errorf("decode frame: %w", err)
+	}
+
+	w, h := fitSize(img.Bounds(), width, height)
+	return r.resizer.Resize(img, img.Bounds(), w, h), nil
+}
@@ -0,0 +1,80 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestPickIcon tests that the largest decodable icon is chosen
+func TestPickIcon(t *testing.T) {
+	icons := []icon{
+		{MimeType: "image/png", Width: 48, Height: 48, URL: "/icon48.png"},
+		{MimeType: "image/bmp", Width: 256, Height: 256, URL: "/icon256.bmp"},
+		{MimeType: "image/jpeg", Width: 120, Height: 120, URL: "/icon120.jpg"},
+	}
+
+	if got := pickIcon(icons); got != "/icon120.jpg" {
+		t.Errorf("Expected /icon120.jpg, got %q", got)
+	}
+	if got := pickIcon(nil); got != "" {
+		t.Errorf("Expected no icon, got %q", got)
+	}
+}
+
+// TestIcon tests downloading and decoding the TV's icon
+func TestIcon(t *testing.T) {
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		png.Encode(w, image.NewRGBA(image.Rect(0, 0, 48, 32)))
+	}))
+	defer mockTV.Close()
+
+	tv := &TV{Name: "Test TV", IconURL: mockTV.URL + "/icon.png"}
+	img, err := tv.Icon(context.Background())
+	if err != nil {
+		t.Fatalf("Icon failed: %v", err)
+	}
+	if img.Bounds().Dx() != 48 || img.Bounds().Dy() != 32 {
+		t.Errorf("Expected 48x32 icon, got %v", img.Bounds())
+	}
+
+	if _, err := (&TV{}).Icon(context.Background()); err != ErrNoIcon {
+		t.Errorf("Expected ErrNoIcon, got %v", err)
+	}
+}
+
+// TestThumbnail tests that the last shown frame is available as a thumbnail
+func TestThumbnail(t *testing.T) {
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	if _, err := renderer.Thumbnail(tv, 160, 160); err != ErrNoThumbnail {
+		t.Errorf("Expected ErrNoThumbnail, got %v", err)
+	}
+
+	if err := renderer.DisplayImage(context.Background(), tv, image.NewRGBA(image.Rect(0, 0, 1920, 1080))); err != nil {
+		t.Fatalf("DisplayImage failed: %v", err)
+	}
+
+	thumb, err := renderer.Thumbnail(tv, 160, 160)
+	if err != nil {
+		t.Fatalf("Thumbnail failed: %v", err)
+	}
+	if thumb.Bounds().Dx() != 160 || thumb.Bounds().Dy() != 90 {
+		t.Errorf("Expected 160x90 thumbnail, got %v", thumb.Bounds())
+	}
+}
@@ -0,0 +1,242 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ErrUnsupportedImage is returned for image formats no decoder is registered
+// for, e.g. HEIC photos without WithImageDecoder("heic", ...)
+var ErrUnsupportedImage = errors.New("unsupported image format")
+
+// ImageDecoder decodes one image format, e.g. HEIC, that Go's standard
+// library can't read
+type ImageDecoder func(r io.Reader) (image.Image, error)
+
+// WithImageDecoder registers a decoder for an image format ("heic" or
+// "avif") that TVs can't show. Such images are transcoded with the decoder
+// and the renderer's Encoder before they are sent. Formats registered with
+// image.RegisterFormat work without this option.
+func WithImageDecoder(format string, dec ImageDecoder) Option {
+	return func(r *Renderer) {
+		if r.decoders == nil {
+			r.decoders = make(map[string]ImageDecoder)
+		}
+		r.decoders[strings.ToLower(format)] = dec
+	}
+}
+
+// CommandDecoder returns an ImageDecoder that pipes the image through an
+// external converter writing PNG or JPEG to stdout, e.g.
+// CommandDecoder("magick", "-", "png:-") or
+// CommandDecoder("heif-dec", "-", "-o", "-")
+func CommandDecoder(name string, args ...string) ImageDecoder {
+	return func(r io.Reader) (image.Image, error) {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(name, args...)
+		cmd.Stdin = r
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return nil, fmt.Errorf("%s: %w: %s", name, err, msg)
+			}
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		img, _, err := image.Decode(&stdout)
+		if err != nil {
+			return nil, fmt.Errorf("%s output: %w", name, err)
+		}
+		return img, nil
+	}
+}
+
+// transcodedTypes are image types TVs can't show, which are decoded and
+// re-encoded before sending
+var transcodedTypes = map[string]string{
+	"image/heic": "heic",
+	"image/avif": "avif",
+	"image/tiff": "tiff", // RAW photos, see ExtractRAWPreview
+}
+
+// heifBrands maps ISO base media file brands to the image type they mark
+var heifBrands = map[string]string{
+	"avif": "image/avif",
+	"avis": "image/avif",
+	"heic": "image/heic",
+	"heix": "image/heic",
+	"heim": "image/heic",
+	"heis": "image/heic",
+	"hevc": "image/heic",
+	"hevx": "image/heic",
+}
+
+// sniffImageType returns the MIME type of image data. It recognizes TIFF,
+// HEIC and AVIF, which http.DetectContentType doesn't.
+func sniffImageType(data []byte) string {
+	// TIFF, which RAW photos are based on
+	if bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*")) {
+		return "image/tiff"
+	}
+
+	// HEIF files start with an ftyp box: size, "ftyp", major brand, minor
+	// version, compatible brands
+	if len(data) >= 16 && string(data[4:8]) == "ftyp" {
+		size := int(data[0])<<24 | int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+		size = min(max(size, 16), len(data))
+		if t, ok := heifBrands[string(data[8:12])]; ok {
+			return t
+		}
+		for i := 16; i+4 <= size; i += 4 {
+			if t, ok := heifBrands[string(data[i:i+4])]; ok {
+				return t
+			}
+		}
+	}
+	return http.DetectContentType(data)
+}
+
+// DecodeImage decodes image data of any format Go knows or a decoder is
+// registered for with WithImageDecoder, within the renderer's Limits
+func (r *Renderer) DecodeImage(data []byte) (image.Image, error) {
+	if err := r.limits.Check(data); err != nil {
+		return nil, err
+	}
+	contentType := sniffImageType(data)
+	format, transcoded := transcodedTypes[contentType]
+	if dec, ok := r.decoders[format]; ok && transcoded {
+		img, err := dec(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", format, err)
+		}
+		if err := r.limits.CheckDimensions(img.Bounds().Dx(), img.Bounds().Dy()); err != nil {
+			return nil, err
+		}
+		return img, nil
+	}
+	if format == "tiff" {
+		img, err := decodeRAW(data, r.limits)
+		if errors.Is(err, ErrImageTooLarge) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: tiff: %w", ErrUnsupportedImage, err)
+		}
+		return img, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) {
+		if transcoded {
+			return nil, fmt.Errorf("%w: %s (register a decoder with WithImageDecoder)", ErrUnsupportedImage, format)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedImage, contentType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	return img, nil
+}
+
+// DisplayImageFile shows an image file on the TV. JPEG, PNG and GIF files
+// are sent as they are; HEIC and AVIF photos, e.g. straight from a phone's
+// camera roll, are transcoded with the decoder set with WithImageDecoder.
+// RAW photos (CR2, NEF, ARW) show their embedded JPEG preview.
+func (r *Renderer) DisplayImageFile(ctx context.Context, tv *TV, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, contentType, err := readImagePayload(f, r.limits)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return r.DisplayImageData(ctx, tv, data, contentType)
+}
+
+// maxImageDownload limits images fetched by DisplayImageURL
+const maxImageDownload = 64 << 20
+
+// DisplayImageURL downloads an image and shows it from the renderer's own
+// server, so TVs that can't do HTTPS or follow redirects can show images
+// from anywhere. The download is checked to be an image TVs can show (or
+// one that is transcoded, as for DisplayImageFile) before the TV is told.
+func (r *Renderer) DisplayImageURL(ctx context.Context, tv *TV, imageURL string) error {
+	if err := r.checkMediaURL(ctx, imageURL); err != nil {
+		return err
+	}
+	data, contentType, err := fetchImage(ctx, imageURL, r.urlPolicy)
+	if err != nil {
+		return err
+	}
+	if _, ok := transcodedTypes[contentType]; !ok {
+		if _, _, err := image.DecodeConfig(bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("%s: %w: %w", imageURL, ErrNotImage, err)
+		}
+	}
+	return r.DisplayImageData(ctx, tv, data, contentType)
+}
+
+// fetchImage downloads an image, following redirects the policy (if any)
+// allows
+func fetchImage(ctx context.Context, imageURL string, policy *URLPolicy) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("create request: %w", err)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	if policy != nil {
+		client = policy.client(client)
+		defer client.CloseIdleConnections()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("fetch image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("fetch image: HTTP %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxImageDownload {
+		return nil, "", fmt.Errorf("fetch image: %d bytes is too large", resp.ContentLength)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageDownload+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("fetch image: %w", err)
+	}
+	if len(data) > maxImageDownload {
+		return nil, "", fmt.Errorf("fetch image: larger than %d bytes", maxImageDownload)
+	}
+
+	contentType := sniffImageType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, "", fmt.Errorf("%s: %w (got %s)", imageURL, ErrNotImage, contentType)
+	}
+	return data, contentType, nil
+}
+
+// transcode decodes data of a type TVs can't show and shows it encoded with
+// the renderer's Encoder
+func (r *Renderer) transcode(ctx context.Context, tv *TV, data []byte) error {
+	img, err := r.DecodeImage(data)
+	if err != nil {
+		return err
+	}
+	return r.DisplayImage(ctx, tv, img)
+}
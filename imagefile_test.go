@@ -0,0 +1,150 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ftyp builds the start of an ISO base media file with the given brands
+func ftyp(major string, compatible ...string) []byte {
+	box := "ftyp" + major + "\x00\x00\x00\x00" + strings.Join(compatible, "")
+	size := len(box) + 4
+	return append([]byte{0, 0, 0, byte(size)}, box+"\x00\x00\x00\x08mdat"...)
+}
+
+func TestSniffImageType(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"heic", ftyp("heic", "mif1", "heic"), "image/heic"},
+		{"avif", ftyp("avif", "mif1", "avif"), "image/avif"},
+		{"generic heif with avif brand", ftyp("mif1", "mif1", "avif"), "image/avif"},
+		{"mp4", ftyp("isom", "isom", "mp41"), "video/mp4"},
+		{"jpeg", []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), "image/jpeg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffImageType(tt.data); got != tt.want {
+				t.Errorf("sniffImageType = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDisplayImageFileTranscodes tests that HEIC photos are sent as JPEG
+func TestDisplayImageFileTranscodes(t *testing.T) {
+	var soap string
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(r.Header.Get("SOAPAction"), "SetAVTransportURI") {
+			soap = string(body)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+
+	path := filepath.Join(t.TempDir(), "IMG_0001.HEIC")
+	if err := os.WriteFile(path, ftyp("heic", "mif1", "heic"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a decoder the photo is rejected
+	plain, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer plain.Close()
+	if err := plain.DisplayImageFile(context.Background(), tv, path); !errors.Is(err, ErrUnsupportedImage) {
+		t.Errorf("Expected ErrUnsupportedImage, got %v", err)
+	}
+
+	decoded := 0
+	renderer, err := NewRenderer(WithImageDecoder("HEIC", func(r io.Reader) (image.Image, error) {
+		decoded++
+		return image.NewRGBA(image.Rect(0, 0, 40, 30)), nil
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	if err := renderer.DisplayImageFile(context.Background(), tv, path); err != nil {
+		t.Fatalf("DisplayImageFile failed: %v", err)
+	}
+	if decoded != 1 {
+		t.Errorf("decoder called %d times, want 1", decoded)
+	}
+	if !strings.Contains(soap, "image/jpeg") {
+		t.Errorf("Expected a JPEG to be sent, got %s", soap)
+	}
+}
+
+// TestDisplayImageURL tests that remote images are re-served by the
+// renderer after following redirects
+func TestDisplayImageURL(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest":
+			http.Redirect(w, r, "/dash.png", http.StatusFound)
+		case "/dash.png":
+			w.Write(buf.Bytes())
+		case "/broken.png":
+			w.Write(buf.Bytes()[:20])
+		case "/page":
+			w.Write([]byte("<html>not an image</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer remote.Close()
+
+	var soap string
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(r.Header.Get("SOAPAction"), "SetAVTransportURI") {
+			soap = string(body)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	ctx := context.Background()
+	if err := renderer.DisplayImageURL(ctx, tv, remote.URL+"/latest"); err != nil {
+		t.Fatalf("DisplayImageURL failed: %v", err)
+	}
+	if strings.Contains(soap, remote.URL) || !strings.Contains(soap, renderer.ServerURL()) {
+		t.Errorf("Expected the TV to fetch from the renderer, got %s", soap)
+	}
+
+	for _, path := range []string{"/broken.png", "/page"} {
+		if err := renderer.DisplayImageURL(ctx, tv, remote.URL+path); !errors.Is(err, ErrNotImage) {
+			t.Errorf("%s: expected ErrNotImage, got %v", path, err)
+		}
+	}
+	if err := renderer.DisplayImageURL(ctx, tv, remote.URL+"/gone.png"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected HTTP 404, got %v", err)
+	}
+}
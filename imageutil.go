@@ -0,0 +1,193 @@
+package nimsforestsmarttv
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Resizer scales a region of an image to a target size.
+// The default is BilinearResizer; plug in SIMD or hardware accelerated
+// implementations (e.g. cgo bindings to libvips) with WithResizer.
+type Resizer interface {
+	Resize(img image.Image, src image.Rectangle, w, h int) image.Image
+}
+
+// BilinearResizer scales with bilinear interpolation in pure Go.
+// It works directly on RGBA pixel buffers with fixed-point weights.
+type BilinearResizer struct{}
+
+// Resize scales the src region of img to w x h. The parts of src outside
+// img are left blank; a src entirely outside it gives a blank image.
+func (BilinearResizer) Resize(img image.Image, src image.Rectangle, w, h int) image.Image {
+	return scaleImage(img, src, w, h)
+}
+
+// NearestResizer scales by picking the nearest source pixel. It is several
+// times faster than bilinear but aliases when shrinking a lot.
+type NearestResizer struct{}
+
+// Resize scales the src region of img to w x h, leaving the parts of src
+// outside img blank
+func (NearestResizer) Resize(img image.Image, src image.Rectangle, w, h int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	out, src, ok := clipRegion(dst, img, src)
+	if !ok {
+		return dst
+	}
+	rgba := regionRGBA(img, src)
+	w, h = out.Rect.Dx(), out.Rect.Dy()
+
+	xs := make([]int, w)
+	for x := range xs {
+		xs[x] = (x*src.Dx() + src.Dx()/2) / w * 4
+	}
+
+	for y := 0; y < h; y++ {
+		sy := (y*src.Dy() + src.Dy()/2) / h
+		srow := rgba.Pix[sy*rgba.Stride:]
+		drow := out.Pix[y*out.Stride:]
+		for x, sx := range xs {
+			copy(drow[x*4:x*4+4], srow[sx:sx+4])
+		}
+	}
+	return dst
+}
+
+// WithResizer sets the resizer used when frames are scaled (default
+// BilinearResizer)
+func WithResizer(resizer Resizer) Option {
+	return func(r *Renderer) {
+		r.resizer = resizer
+	}
+}
+
+// scaleImage resamples the src region of img to a w x h RGBA image using
+// bilinear interpolation. Parts of src outside img are left blank.
+func scaleImage(img image.Image, src image.Rectangle, w, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	out, src, ok := clipRegion(dst, img, src)
+	if !ok {
+		return dst
+	}
+	rgba := regionRGBA(img, src)
+	sw, sh := src.Dx(), src.Dy()
+	w, h = out.Rect.Dx(), out.Rect.Dy()
+
+	// Precompute source columns and 8-bit fixed-point weights
+	x0s, x1s, wxs := bilinearTaps(sw, w)
+	y0s, y1s, wys := bilinearTaps(sh, h)
+
+	for y := 0; y < h; y++ {
+		row0 := rgba.Pix[y0s[y]*rgba.Stride:]
+		row1 := rgba.Pix[y1s[y]*rgba.Stride:]
+		wy := wys[y]
+		drow := out.Pix[y*out.Stride:]
+
+		for x := 0; x < w; x++ {
+			i0, i1, wx := x0s[x]*4, x1s[x]*4, wxs[x]
+			for c := 0; c < 4; c++ {
+				top := uint32(row0[i0+c])*(256-wx) + uint32(row0[i1+c])*wx
+				bottom := uint32(row1[i0+c])*(256-wx) + uint32(row1[i1+c])*wx
+				drow[x*4+c] = uint8((top*(256-wy) + bottom*wy + 1<<15) >> 16)
+			}
+		}
+	}
+
+	return dst
+}
+
+// clipRegion clips src to the bounds of img and returns the part of dst
+// the clipped region lands on when src is scaled to fill dst. ok is false
+// if nothing of src is left to draw.
+func clipRegion(dst *image.RGBA, img image.Image, src image.Rectangle) (out *image.RGBA, clipped image.Rectangle, ok bool) {
+	w, h := dst.Rect.Dx(), dst.Rect.Dy()
+	clipped = src.Intersect(img.Bounds())
+	if clipped.Empty() || w <= 0 || h <= 0 {
+		return nil, clipped, false
+	}
+	r := image.Rect(
+		(clipped.Min.X-src.Min.X)*w/src.Dx(),
+		(clipped.Min.Y-src.Min.Y)*h/src.Dy(),
+		(clipped.Max.X-src.Min.X)*w/src.Dx(),
+		(clipped.Max.Y-src.Min.Y)*h/src.Dy(),
+	)
+	if r.Empty() {
+		return nil, clipped, false
+	}
+	return dst.SubImage(r).(*image.RGBA), clipped, true
+}
+
+// bilinearTaps returns, for every destination index, the two neighbouring
+// source indices and the weight (0-256) of the second one
+func bilinearTaps(srcSize, dstSize int) (i0, i1 []int, weight []uint32) {
+	i0 = make([]int, dstSize)
+	i1 = make([]int, dstSize)
+	weight = make([]uint32, dstSize)
+
+	scale := float64(srcSize) / float64(dstSize)
+	for d := 0; d < dstSize; d++ {
+		// Sample at pixel centers
+		f := (float64(d)+0.5)*scale - 0.5
+		if f < 0 {
+			f = 0
+		}
+		s := int(f)
+		i0[d] = clampInt(s, 0, srcSize-1)
+		i1[d] = clampInt(s+1, 0, srcSize-1)
+		weight[d] = uint32((f - float64(s)) * 256)
+	}
+	return i0, i1, weight
+}
+
+// regionRGBA returns the src region of img, which must lie within its
+// bounds, as an RGBA image whose pixels start at index 0. RGBA sources are
+// sliced without copying; other types go through draw.Draw, which has fast
+// paths for e.g. decoded JPEGs.
+func regionRGBA(img image.Image, src image.Rectangle) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		sub := rgba.SubImage(src).(*image.RGBA)
+		if sub.Rect.Min == (image.Point{}) {
+			return sub
+		}
+		return &image.RGBA{Pix: sub.Pix, Stride: sub.Stride, Rect: image.Rect(0, 0, sub.Rect.Dx(), sub.Rect.Dy())}
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, src.Dx(), src.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, src.Min, draw.Src)
+	return rgba
+}
+
+// coverRect returns the centered region of src with the aspect ratio w:h,
+// i.e. the crop that fills a w x h target without letterboxing
+func coverRect(src image.Rectangle, w, h int) image.Rectangle {
+	if src.Dx()*h > src.Dy()*w {
+		// Source is wider: crop the sides
+		cw := src.Dy() * w / h
+		x := src.Min.X + (src.Dx()-cw)/2
+		return image.Rect(x, src.Min.Y, x+cw, src.Max.Y)
+	}
+
+	// Source is taller: crop top and bottom
+	ch := src.Dx() * h / w
+	y := src.Min.Y + (src.Dy()-ch)/2
+	return image.Rect(src.Min.X, y, src.Max.X, y+ch)
+}
+
+// fitSize returns the largest size with src's aspect ratio that fits within
+// w x h, i.e. the letterboxed size
+func fitSize(src image.Rectangle, w, h int) (int, int) {
+	if src.Dx()*h > src.Dy()*w {
+		return w, max(src.Dy()*w/src.Dx(), 1)
+	}
+	return max(src.Dx()*h/src.Dy(), 1), h
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,118 @@
+package nimsforestsmarttv
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// TestCoverRect tests that crops keep the target aspect ratio and stay centered
+func TestCoverRect(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      image.Rectangle
+		w, h     int
+		expected image.Rectangle
+	}{
+		{"wider source", image.Rect(0, 0, 400, 100), 2, 1, image.Rect(100, 0, 300, 100)},
+		{"taller source", image.Rect(0, 0, 100, 400), 1, 2, image.Rect(0, 100, 100, 300)},
+		{"same aspect", image.Rect(0, 0, 1920, 1080), 16, 9, image.Rect(0, 0, 1920, 1080)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := coverRect(tt.src, tt.w, tt.h); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestScaleImage tests that scaling preserves solid colors and target size
+func TestScaleImage(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	src := image.NewRGBA(image.Rect(0, 0, 64, 36))
+	draw.Draw(src, src.Bounds(), &image.Uniform{red}, image.Point{}, draw.Src)
+
+	dst := scaleImage(src, src.Bounds(), 16, 9)
+	if dst.Bounds().Dx() != 16 || dst.Bounds().Dy() != 9 {
+		t.Fatalf("Expected 16x9 image, got %v", dst.Bounds())
+	}
+	if got := dst.RGBAAt(8, 4); got != red {
+		t.Errorf("Expected %v, got %v", red, got)
+	}
+}
+
+// TestResizersOnRegion tests that both resizers sample only the requested region
+func TestResizersOnRegion(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+
+	// Left half red, right half blue
+	src := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	draw.Draw(src, image.Rect(0, 0, 100, 100), &image.Uniform{red}, image.Point{}, draw.Src)
+	draw.Draw(src, image.Rect(100, 0, 200, 100), &image.Uniform{blue}, image.Point{}, draw.Src)
+
+	for _, resizer := range []Resizer{BilinearResizer{}, NearestResizer{}} {
+		dst := resizer.Resize(src, image.Rect(100, 0, 200, 100), 10, 10)
+		if got := color.RGBAModel.Convert(dst.At(5, 5)); got != blue {
+			t.Errorf("%T: expected %v from right half, got %v", resizer, blue, got)
+		}
+	}
+}
+
+// TestResizersOutOfBounds tests that regions reaching past the image are
+// clipped to it rather than read out of range, leaving the rest blank
+func TestResizersOutOfBounds(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	src := image.NewRGBA(image.Rect(0, 0, 64, 36))
+	draw.Draw(src, src.Bounds(), &image.Uniform{red}, image.Point{}, draw.Src)
+	gray := image.NewGray(src.Bounds())
+	draw.Draw(gray, gray.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+
+	for _, resizer := range []Resizer{BilinearResizer{}, NearestResizer{}} {
+		for _, img := range []image.Image{src, gray} {
+			dst := resizer.Resize(img, image.Rect(32, 18, 200, 100), 16, 9)
+			if dst.Bounds() != image.Rect(0, 0, 16, 9) {
+				t.Errorf("%T on %T: expected 16x9 image, got %v", resizer, img, dst.Bounds())
+			}
+			if got := color.RGBAModel.Convert(dst.At(1, 0)); got != color.RGBAModel.Convert(img.At(40, 20)) {
+				t.Errorf("%T on %T: expected the image's color, got %v", resizer, img, got)
+			}
+			if got := color.RGBAModel.Convert(dst.At(8, 4)); got != (color.RGBA{}) {
+				t.Errorf("%T on %T: expected blank past the image, got %v", resizer, img, got)
+			}
+
+			dst = resizer.Resize(img, image.Rect(-50, -50, -10, -10), 16, 9)
+			if got := color.RGBAModel.Convert(dst.At(8, 4)); got != (color.RGBA{}) {
+				t.Errorf("%T on %T: expected a blank image outside the bounds, got %v", resizer, img, got)
+			}
+		}
+	}
+}
+
+// TestResizersClippedRegion tests that a region hanging off the image keeps
+// its scale: the part inside lands where it would unclipped, not stretched
+// over the whole output
+func TestResizersClippedRegion(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	src := image.NewRGBA(image.Rect(0, 0, 64, 36))
+	draw.Draw(src, src.Bounds(), &image.Uniform{red}, image.Point{}, draw.Src)
+
+	// The left third of the region is off the image
+	region := image.Rect(-32, 0, 64, 36)
+	for _, resizer := range []Resizer{BilinearResizer{}, NearestResizer{}} {
+		dst := resizer.Resize(src, region, 24, 9)
+		for _, tt := range []struct {
+			x    int
+			want color.RGBA
+		}{
+			{0, color.RGBA{}}, {7, color.RGBA{}}, {8, red}, {23, red},
+		} {
+			if got := color.RGBAModel.Convert(dst.At(tt.x, 4)); got != tt.want {
+				t.Errorf("%T: pixel %d is %v, want %v", resizer, tt.x, got, tt.want)
+			}
+		}
+	}
+}
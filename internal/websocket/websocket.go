@@ -0,0 +1,225 @@
+// Package websocket is a minimal WebSocket client (RFC 6455) for the remote
+// control APIs of TVs, with just what they need: text messages, ping and
+// close.
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// WebSocket opcodes
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// GUID is appended to the key to compute Sec-WebSocket-Accept
+const GUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// MaxMessage limits messages from the TV; app lists are the largest
+const MaxMessage = 1 << 20
+
+// Conn is a WebSocket client connection
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	wmu sync.Mutex // Serializes frame writes
+}
+
+// NewConn wraps a connection that was already upgraded, e.g. the server
+// side of one in tests. r buffers reads from conn.
+func NewConn(conn net.Conn, r *bufio.Reader) *Conn {
+	return &Conn{conn: conn, r: r}
+}
+
+// Dial opens a WebSocket connection to rawURL (ws:// or wss://). TVs
+// serve wss with self-signed certificates, which are accepted.
+func Dial(ctx context.Context, rawURL string) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		conn, err = dialer.DialContext(ctx, "tcp", u.Host)
+	case "wss":
+		tlsDialer := &tls.Dialer{NetDialer: &dialer, Config: &tls.Config{InsecureSkipVerify: true}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", u.Host)
+	default:
+		return nil, fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c := &Conn{conn: conn, r: bufio.NewReader(conn)}
+	if err := c.handshake(u); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("WebSocket handshake: %w", err)
+	}
+	conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// handshake upgrades the connection to a WebSocket
+func (c *Conn) handshake(u *url.URL) error {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := fmt.Sprintf("GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", u.RequestURI(), u.Host, key)
+	if _, err := io.WriteString(c.conn, req); err != nil {
+		return err
+	}
+
+	resp, err := http.ReadResponse(c.r, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	sum := sha1.Sum([]byte(key + GUID))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		return errors.New("wrong Sec-WebSocket-Accept")
+	}
+	return nil
+}
+
+// ReadMessage returns the next text or binary message, answering pings
+// on the way. It returns io.EOF once the TV closes the connection.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	var msg []byte
+	for {
+		op, fin, payload, err := c.readFrame(MaxMessage - len(msg))
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case wsPing:
+			if err := c.write(wsPong, payload); err != nil {
+				return nil, err
+			}
+		case wsPong:
+		case wsClose:
+			c.write(wsClose, nil)
+			return nil, io.EOF
+		case wsText, wsBinary, wsContinuation:
+			msg = append(msg, payload...)
+			if fin {
+				return msg, nil
+			}
+		default:
+			return nil, fmt.Errorf("unknown WebSocket opcode %d", op)
+		}
+	}
+}
+
+// readFrame reads one frame of at most limit bytes
+func (c *Conn) readFrame(limit int) (op byte, fin bool, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.r, head[:]); err != nil {
+		return 0, false, nil, err
+	}
+	op, fin = head[0]&0x0F, head[0]&0x80 != 0
+
+	size := uint64(head[1] & 0x7F)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return 0, false, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return 0, false, nil, err
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if size > uint64(limit) {
+		return 0, false, nil, fmt.Errorf("WebSocket message larger than %d bytes", MaxMessage)
+	}
+
+	var mask [4]byte
+	masked := head[1]&0x80 != 0
+	if masked {
+		if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+			return 0, false, nil, err
+		}
+	}
+	payload = make([]byte, size)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, false, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return op, fin, payload, nil
+}
+
+// WriteText sends a text message
+func (c *Conn) WriteText(data []byte) error {
+	return c.write(wsText, data)
+}
+
+// write sends a single frame, masked as clients must
+func (c *Conn) write(op byte, payload []byte) error {
+	frame := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xFFFF:
+		frame = binary.BigEndian.AppendUint16(append(frame, 0x80|126), uint16(n))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, 0x80|127), uint64(n))
+	}
+
+	var mask [4]byte
+	rand.Read(mask[:])
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// Close says goodbye and closes the connection
+func (c *Conn) Close() error {
+	c.write(wsClose, []byte{0x03, 0xE8}) // 1000: normal closure
+	return c.conn.Close()
+}
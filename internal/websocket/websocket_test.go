@@ -0,0 +1,36 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+)
+
+// frame encodes an unmasked text frame, as servers send them
+func frame(data []byte) []byte {
+	b := []byte{0x80 | wsText}
+	switch {
+	case len(data) < 126:
+		b = append(b, byte(len(data)))
+	case len(data) <= 0xFFFF:
+		b = binary.BigEndian.AppendUint16(append(b, 126), uint16(len(data)))
+	default:
+		b = binary.BigEndian.AppendUint64(append(b, 127), uint64(len(data)))
+	}
+	return append(b, data...)
+}
+
+func TestReadFrameLimit(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		server.Write(frame(make([]byte, MaxMessage+1)))
+		server.Close()
+	}()
+	c := NewConn(client, bufio.NewReader(client))
+	if _, err := c.ReadMessage(); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("Expected an oversized message to fail, got %v", err)
+	}
+}
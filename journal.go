@@ -0,0 +1,438 @@
+package nimsforestsmarttv
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Journal operations
+const (
+	JournalCast     = "cast"     // An image is sent to a TV
+	JournalVideo    = "video"    // A video is sent to a TV
+	JournalAudio    = "audio"    // An audio clip or track is played on a TV
+	JournalStop     = "stop"     // A TV is stopped
+	JournalSchedule = "schedule" // A schedule entry runs on a TV
+)
+
+// JournalEntry is one intended state change
+type JournalEntry struct {
+	Seq     uint64    `json:"seq"`
+	Time    time.Time `json:"time"`
+	Op      string    `json:"op"`
+	TV      *TV       `json:"tv,omitempty"`
+	Session Session   `json:"session,omitzero"`
+
+	URL         string `json:"url,omitempty"`          // Video URL
+	Title       string `json:"title,omitempty"`        // Video title
+	Frame       string `json:"frame,omitempty"`        // Image file in the frames directory
+	ContentType string `json:"content_type,omitempty"` // Content type of Frame
+	Entry       string `json:"entry,omitempty"`        // Schedule entry name
+}
+
+// Journal is an append-only log of the state changes a Renderer intends,
+// written before they are sent to the TV. After a crash, Replay casts the
+// last intended content again, and operators can read what the process was
+// trying to do. Images are kept next to the log, by content hash. Every
+// 1000 entries the journal is compacted to the intended state.
+type Journal struct {
+	dir string
+
+	mu       sync.Mutex
+	f        *os.File
+	seq      uint64
+	appended int             // Entries appended since the last compaction
+	saved    map[string]bool // Frames saved for entries not appended yet
+}
+
+// journalFile is the log's name in the journal directory
+const journalFile = "journal.jsonl"
+
+// journalCompactEvery is how many entries Append writes before it compacts
+// the journal
+const journalCompactEvery = 1000
+
+// journalStreamInterval is how often a frame of a stream is journaled per
+// TV; the frames in between are only shown
+const journalStreamInterval = 10 * time.Second
+
+// OpenJournal opens or creates the journal in dir. A last entry torn by a
+// crash is dropped.
+func OpenJournal(dir string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "frames"), 0o700); err != nil {
+		return nil, fmt.Errorf("create journal: %w", err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, journalFile), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	entries, size, err := readJournal(f)
+	if err == nil {
+		err = f.Truncate(size)
+	}
+	if err == nil {
+		_, err = f.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+
+	j := &Journal{dir: dir, f: f, appended: len(entries), saved: make(map[string]bool)}
+	if len(entries) > 0 {
+		j.seq = entries[len(entries)-1].Seq
+	}
+	return j, nil
+}
+
+// readJournal reads entries from the start of f and returns them with the
+// length of the intact part of the file
+func readJournal(f *os.File) ([]JournalEntry, int64, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+
+	var entries []JournalEntry
+	var size int64
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// A line without newline is a torn write
+			return entries, size, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var e JournalEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return entries, size, nil
+		}
+		entries = append(entries, e)
+		size += int64(len(line))
+	}
+}
+
+// Append writes an entry and syncs it to disk, filling in its sequence
+// number and time. Every 1000 entries it compacts the journal.
+func (j *Journal) Append(e JournalEntry) (JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f == nil {
+		return e, errors.New("journal closed")
+	}
+	e.Seq = j.seq + 1
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return e, fmt.Errorf("encode journal entry: %w", err)
+	}
+	if _, err := j.f.Write(append(line, '\n')); err != nil {
+		return e, fmt.Errorf("write journal: %w", err)
+	}
+	if err := j.f.Sync(); err != nil {
+		return e, fmt.Errorf("sync journal: %w", err)
+	}
+	j.seq = e.Seq
+	delete(j.saved, e.Frame)
+
+	if j.appended++; j.appended >= journalCompactEvery {
+		if err := j.compact(); err != nil {
+			return e, err
+		}
+	}
+	return e, nil
+}
+
+// frameName names image data by content hash
+func frameName(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// SaveFrame stores image data for entries and returns its file name. The
+// frame is kept by compactions until an entry naming it is appended.
+func (j *Journal) SaveFrame(data []byte) (string, error) {
+	name := frameName(data)
+	path := filepath.Join(j.dir, "frames", name)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.saved[name] = true
+	if _, err := os.Stat(path); err == nil {
+		return name, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(j.dir, "frames"), name+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("save frame: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		delete(j.saved, name)
+		return "", fmt.Errorf("save frame: %w", err)
+	}
+	return name, nil
+}
+
+// Frame returns the image data of an entry
+func (j *Journal) Frame(name string) ([]byte, error) {
+	if name == "" || filepath.Base(name) != name {
+		return nil, fmt.Errorf("invalid frame name %q", name)
+	}
+	return os.ReadFile(filepath.Join(j.dir, "frames", name))
+}
+
+// Entries returns every entry in the journal, oldest first
+func (j *Journal) Entries() ([]JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.entries()
+}
+
+// entries reads the journal. Call with mu held.
+func (j *Journal) entries() ([]JournalEntry, error) {
+	f, err := os.Open(filepath.Join(j.dir, journalFile))
+	if err != nil {
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+	defer f.Close()
+	entries, _, err := readJournal(f)
+	if err != nil {
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+	return entries, nil
+}
+
+// Intended returns the last cast or video entry of each TV that was not
+// stopped afterwards, ordered by sequence number: the state the TVs should
+// be in
+func (j *Journal) Intended() ([]JournalEntry, error) {
+	entries, err := j.Entries()
+	if err != nil {
+		return nil, err
+	}
+	return intendedState(entries), nil
+}
+
+// intendedState returns the entries Intended returns of entries
+func intendedState(entries []JournalEntry) []JournalEntry {
+	latest := make(map[string]JournalEntry)
+	for _, e := range entries {
+		if e.TV == nil {
+			continue
+		}
+		switch e.Op {
+		case JournalCast, JournalVideo:
+			latest[e.TV.ControlURL] = e
+		case JournalStop:
+			delete(latest, e.TV.ControlURL)
+		}
+	}
+
+	intended := make([]JournalEntry, 0, len(latest))
+	for _, e := range latest {
+		intended = append(intended, e)
+	}
+	slices.SortFunc(intended, func(a, b JournalEntry) int { return cmp.Compare(a.Seq, b.Seq) })
+	return intended
+}
+
+// Compact rewrites the journal to just the intended state and deletes
+// frames no longer referenced
+func (j *Journal) Compact() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return errors.New("journal closed")
+	}
+	return j.compact()
+}
+
+// compact is Compact with mu held
+func (j *Journal) compact() error {
+	entries, err := j.entries()
+	if err != nil {
+		return err
+	}
+	intended := intendedState(entries)
+
+	var buf bytes.Buffer
+	keep := make(map[string]bool)
+	for _, e := range intended {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("encode journal entry: %w", err)
+		}
+		buf.Write(append(line, '\n'))
+		keep[e.Frame] = true
+	}
+
+	path := filepath.Join(j.dir, journalFile)
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("compact journal: %w", err)
+	}
+	_, err = f.Write(buf.Bytes())
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("compact journal: %w", err)
+	}
+	j.f.Close()
+	j.f = f
+	j.appended = len(intended)
+
+	frames, _ := os.ReadDir(filepath.Join(j.dir, "frames"))
+	for _, frame := range frames {
+		if !keep[frame.Name()] && !j.saved[frame.Name()] {
+			os.Remove(filepath.Join(j.dir, "frames", frame.Name()))
+		}
+	}
+	return nil
+}
+
+// Close closes the journal
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return nil
+	}
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
+
+// WithJournal writes every cast, video and stop to j before sending it to
+// the TV; of frame streams, one frame every 10s. Display calls fail if the
+// journal can't be written.
+func WithJournal(j *Journal) Option {
+	return func(r *Renderer) {
+		r.journal = j
+	}
+}
+
+// streamFrameKey marks the context of a frame stream's casts
+type streamFrameKey struct{}
+
+// intend journals a state change before it is sent to the TV, and records
+// it in the audit log. For casts, url is the stored image, which is saved
+// with the entry. Of a frame stream, one frame every 10s is recorded.
+func (r *Renderer) intend(ctx context.Context, tv *TV, op string, url string, contentType string, title string) error {
+	if r.journal == nil && r.audit == nil {
+		return nil
+	}
+	if op == JournalCast && ctx.Value(streamFrameKey{}) != nil {
+		r.mu.Lock()
+		due := time.Since(r.streamJournaled[tv.ControlURL]) >= journalStreamInterval
+		if due {
+			r.streamJournaled[tv.ControlURL] = time.Now()
+		}
+		r.mu.Unlock()
+		if !due {
+			return nil
+		}
+	}
+
+	session, _ := SessionFrom(ctx)
+	tvCopy := *tv
+	e := JournalEntry{Op: op, TV: &tvCopy, Session: session}
+	switch op {
+	case JournalCast:
+		if img, ok := r.server.lookup(url); ok {
+			e.Frame, e.ContentType = frameName(img.data), contentType
+			if r.journal != nil {
+				if _, err := r.journal.SaveFrame(img.data); err != nil {
+					return fmt.Errorf("journal: %w", err)
+				}
+			}
+		}
+	case JournalVideo:
+		e.URL, e.Title = url, title
+	case JournalAudio:
+		e.URL, e.ContentType, e.Title = url, contentType, title
+	}
+
+	if r.journal != nil {
+		var err error
+		if e, err = r.journal.Append(e); err != nil {
+			return fmt.Errorf("journal: %w", err)
+		}
+	}
+	if r.audit != nil {
+		if err := r.audit.Append(e); err != nil {
+			return fmt.Errorf("audit: %w", err)
+		}
+	}
+	return nil
+}
+
+// Replay restores every TV to the state intended in the journal, e.g.
+// after a crash: images are cast again and videos restarted, under their
+// original sessions. Streamed images that were never stored are skipped.
+func (r *Renderer) Replay(ctx context.Context, j *Journal) error {
+	intended, err := j.Intended()
+	if err != nil {
+		return err
+	}
+
+	byTV := make(map[*TV]JournalEntry, len(intended))
+	tvs := make([]*TV, 0, len(intended))
+	for _, e := range intended {
+		if e.Op == JournalCast && e.Frame == "" {
+			continue
+		}
+		byTV[e.TV] = e
+		tvs = append(tvs, e.TV)
+	}
+
+	return fanOut(ctx, tvs, func(ctx context.Context, tv *TV) error {
+		e := byTV[tv]
+		ctx = WithSession(ctx, e.Session)
+		if e.Op == JournalVideo {
+			return r.StreamVideo(ctx, tv, e.URL, e.Title)
+		}
+
+		data, err := j.Frame(e.Frame)
+		if err != nil {
+			return fmt.Errorf("replay: %w", err)
+		}
+		return r.showURL(ctx, tv, r.server.StoreContent(data, e.ContentType), e.ContentType)
+	})
+}
@@ -0,0 +1,212 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestJournalReplay tests that a new renderer restores the intended state
+// from the journal of a crashed one
+func TestJournalReplay(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	var tvs []*TV
+	for _, name := range []string{"Menu", "Promo", "Spare"} {
+		vtv, err := NewVirtualTV(name)
+		if err != nil {
+			t.Fatalf("NewVirtualTV failed: %v", err)
+		}
+		defer vtv.Close()
+		tvs = append(tvs, vtv.TV())
+	}
+
+	journal, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renderer, err := NewRenderer(WithJournal(journal))
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+
+	menu := WithSession(ctx, Session{Name: "menu", Owner: "kitchen"})
+	if err := renderer.DisplayText(menu, tvs[0], "SOUP"); err != nil {
+		t.Fatalf("DisplayText failed: %v", err)
+	}
+	if err := renderer.StreamVideo(ctx, tvs[1], "http://example.com/promo.m3u8", "Promo"); err != nil {
+		t.Fatalf("StreamVideo failed: %v", err)
+	}
+	if err := renderer.DisplayText(ctx, tvs[2], "SPARE"); err != nil {
+		t.Fatalf("DisplayText failed: %v", err)
+	}
+	if err := renderer.Stop(ctx, tvs[2]); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+
+	// Crash: nothing is closed cleanly, and the last write is torn
+	renderer.Close()
+	journal.Close()
+	f, err := os.OpenFile(filepath.Join(dir, journalFile), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq":5,"op":"ca`)
+	f.Close()
+
+	journal, err = OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	entries, err := journal.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []string
+	for _, e := range entries {
+		ops = append(ops, e.Op)
+	}
+	if len(ops) != 4 || ops[0] != JournalCast || ops[1] != JournalVideo || ops[3] != JournalStop {
+		t.Fatalf("ops = %v, want cast, video, cast, stop", ops)
+	}
+	if e, err := journal.Append(JournalEntry{Op: JournalSchedule, TV: tvs[0]}); err != nil || e.Seq != 5 {
+		t.Errorf("Append after torn write = seq %d, %v; want 5", e.Seq, err)
+	}
+
+	for _, tv := range tvs {
+		tv.stop(ctx)
+	}
+
+	restarted, err := NewRenderer(WithJournal(journal))
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer restarted.Close()
+	if err := restarted.Replay(ctx, journal); err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+
+	for i, want := range []string{"PLAYING", "PLAYING", "STOPPED"} {
+		if info, _ := tvs[i].GetTransportInfo(ctx); info.State != want {
+			t.Errorf("%s state = %s, want %s", tvs[i].Name, info.State, want)
+		}
+	}
+	states := restarted.State()
+	if len(states) != 2 || states[0].Session.Name != "menu" || states[1].Kind != "video" {
+		t.Errorf("state after replay = %+v", states)
+	}
+
+	if err := journal.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if entries, _ := journal.Entries(); len(entries) != 2 {
+		t.Errorf("%d entries after Compact, want 2", len(entries))
+	}
+	if frames, _ := os.ReadDir(filepath.Join(dir, "frames")); len(frames) != 1 {
+		t.Errorf("%d frames after Compact, want 1", len(frames))
+	}
+}
+
+// TestJournalCompact tests that compaction loses no concurrent entries or
+// frames about to be journaled, and that it runs by itself
+func TestJournalCompact(t *testing.T) {
+	dir := t.TempDir()
+	journal, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	// A frame saved for an entry that isn't appended yet survives
+	frame, err := journal.SaveFrame([]byte("frame"))
+	if err != nil {
+		t.Fatalf("SaveFrame failed: %v", err)
+	}
+	if err := journal.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if _, err := journal.Frame(frame); err != nil {
+		t.Errorf("Frame about to be journaled was deleted: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		tv := &TV{Name: "TV", ControlURL: fmt.Sprintf("http://tv%d/avt", i)}
+		wg.Go(func() {
+			for range 300 {
+				if _, err := journal.Append(JournalEntry{Op: JournalCast, TV: tv, Frame: frame}); err != nil {
+					t.Errorf("Append failed: %v", err)
+					return
+				}
+			}
+		})
+	}
+	wg.Go(func() {
+		for range 20 {
+			if err := journal.Compact(); err != nil {
+				t.Errorf("Compact failed: %v", err)
+			}
+		}
+	})
+	wg.Wait()
+
+	intended, err := journal.Intended()
+	if err != nil || len(intended) != 8 {
+		t.Errorf("Intended = %d entries, %v; want one per TV", len(intended), err)
+	}
+	// 2400 entries were compacted twice without calling Compact
+	if entries, _ := journal.Entries(); len(entries) >= journalCompactEvery {
+		t.Errorf("%d entries, expected automatic compaction", len(entries))
+	}
+	if _, err := journal.Frame(frame); err != nil {
+		t.Errorf("Frame in use was deleted: %v", err)
+	}
+}
+
+// TestJournalStream tests that a frame stream journals one frame every
+// journalStreamInterval, not every frame
+func TestJournalStream(t *testing.T) {
+	vtv, err := NewVirtualTV("Stream")
+	if err != nil {
+		t.Fatalf("NewVirtualTV failed: %v", err)
+	}
+	defer vtv.Close()
+
+	journal, err := OpenJournal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	renderer, err := NewRenderer(WithJournal(journal))
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	frames := make(chan StreamFrame)
+	go func() {
+		defer close(frames)
+		for i := range 5 {
+			frames <- StreamFrame{Seq: uint64(i + 1), JPEG: []byte{0xFF, 0xD8, byte(i), 0xFF, 0xD9}}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := renderer.DisplayFrameStream(ctx, vtv.TV(), frames, StreamOptions{MaxFPS: 1000}); err != nil {
+		t.Fatalf("DisplayFrameStream failed: %v", err)
+	}
+	if status, _ := renderer.StreamStatus(vtv.TV()); status.Sent < 2 {
+		t.Fatalf("Only %d frames sent", status.Sent)
+	}
+	if entries, _ := journal.Entries(); len(entries) != 1 {
+		t.Errorf("%d entries for a stream, want 1", len(entries))
+	}
+}
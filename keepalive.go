@@ -0,0 +1,152 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// KeepAlive watches TVs showing persistent sessions and casts the session
+// again when the TV stops on its own, e.g. TVs that return to their home
+// screen after showing a still image for a while. Sessions are marked
+// persistent with Session.Persistent. It is safe for concurrent use.
+type KeepAlive struct {
+	renderer *Renderer
+	interval time.Duration
+
+	mu        sync.Mutex
+	recasts   map[string]int
+	listeners []func(tv *TV, err error)
+}
+
+// NewKeepAlive creates a keep-alive polling every interval (default 30s)
+func NewKeepAlive(renderer *Renderer, interval time.Duration) *KeepAlive {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	return &KeepAlive{
+		renderer: renderer,
+		interval: interval,
+		recasts:  make(map[string]int),
+	}
+}
+
+// OnRecast registers fn to be called after each attempt to cast a session
+// again, with the error if it failed. fn runs on the keep-alive's goroutine
+// and should not block.
+func (k *KeepAlive) OnRecast(fn func(tv *TV, err error)) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.listeners = append(k.listeners, fn)
+}
+
+// Recasts returns how often the TV's session was cast again
+func (k *KeepAlive) Recasts(tv *TV) int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.recasts[tv.ControlURL]
+}
+
+// Run checks the TVs every interval until ctx is done
+func (k *KeepAlive) Run(ctx context.Context) error {
+	ticker := time.NewTicker(k.interval)
+	defer ticker.Stop()
+
+	for {
+		k.CheckAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll asks every TV with a persistent session for its transport state
+// once and casts the session again on TVs that stopped
+func (k *KeepAlive) CheckAll(ctx context.Context) {
+	var tvs []*TV
+	for _, state := range k.renderer.State() {
+		if state.Session.Persistent {
+			tvs = append(tvs, state.TV)
+		}
+	}
+
+	fanOut(ctx, tvs, func(ctx context.Context, tv *TV) error {
+		info, err := tv.GetTransportInfo(ctx)
+		if err != nil {
+			// Unreachable TVs are the HealthChecker's business
+			return nil
+		}
+		if info.State != "STOPPED" && info.State != "NO_MEDIA_PRESENT" {
+			return nil
+		}
+
+		recast, err := k.renderer.recast(ctx, tv)
+		if !recast {
+			return nil
+		}
+
+		k.mu.Lock()
+		k.recasts[tv.ControlURL]++
+		listeners := k.listeners
+		k.mu.Unlock()
+		for _, fn := range listeners {
+			fn(tv, err)
+		}
+		return nil
+	})
+}
+
+// recast sends the TV's persistent session to it again. It reports false
+// if the session ended in the meantime.
+func (r *Renderer) recast(ctx context.Context, tv *TV) (bool, error) {
+	unlock, err := r.lockTV(ctx, tv)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	// Look again under the TV lock: the session may have been stopped or
+	// replaced while we polled
+	r.mu.Lock()
+	state, ok := r.sessions[tv.ControlURL]
+	if !ok || !state.Session.Persistent {
+		r.mu.Unlock()
+		return false, nil
+	}
+	kind, videoURL, title := state.Kind, state.videoURL, state.videoTitle
+	frame, hasFrame := r.lastFrame[tv.ControlURL]
+	r.mu.Unlock()
+
+	if kind == "video" {
+		if err := tv.setAVTransportURIForVideo(ctx, videoURL, title); err != nil {
+			return true, fmt.Errorf("set video URI: %w", err)
+		}
+		if err := tv.play(ctx); err != nil {
+			return true, fmt.Errorf("play video: %w", err)
+		}
+		return true, nil
+	}
+
+	if !hasFrame {
+		return false, nil
+	}
+
+	// The old URL may have been evicted from the server; store it again
+	url := r.server.StoreContent(frame.img.data, frame.img.contentType)
+	if err := tv.setAVTransportURI(ctx, url, r.imageRes(url, frame.img.contentType)); err != nil {
+		return true, fmt.Errorf("set URI: %w", err)
+	}
+	if err := tv.play(ctx); err != nil {
+		return true, fmt.Errorf("play: %w", err)
+	}
+
+	r.mu.Lock()
+	frame.url = url
+	r.lastFrame[tv.ControlURL] = frame
+	r.mu.Unlock()
+	return true, nil
+}
@@ -0,0 +1,68 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestKeepAliveRecasts tests that a persistent session is cast again after
+// the TV stopped on its own, and other sessions are left alone
+func TestKeepAliveRecasts(t *testing.T) {
+	vtv, err := NewVirtualTV("Lobby")
+	if err != nil {
+		t.Fatalf("NewVirtualTV failed: %v", err)
+	}
+	defer vtv.Close()
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	ka := NewKeepAlive(renderer, time.Minute)
+	var recastErr error
+	ka.OnRecast(func(tv *TV, err error) { recastErr = err })
+
+	ctx := context.Background()
+	tv := vtv.TV()
+
+	// A non-persistent session stays stopped
+	if err := renderer.DisplayText(ctx, tv, "MENU"); err != nil {
+		t.Fatalf("DisplayText failed: %v", err)
+	}
+	if err := tv.stop(ctx); err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+	ka.CheckAll(ctx)
+	if ka.Recasts(tv) != 0 {
+		t.Fatal("Expected no recast for a non-persistent session")
+	}
+
+	persistent := WithSession(ctx, Session{Name: "menu", Persistent: true})
+	if err := renderer.DisplayText(persistent, tv, "MENU"); err != nil {
+		t.Fatalf("DisplayText failed: %v", err)
+	}
+
+	// The TV gives up on the image by itself
+	if err := tv.stop(ctx); err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+	ka.CheckAll(ctx)
+	if ka.Recasts(tv) != 1 || recastErr != nil {
+		t.Fatalf("Expected one successful recast, got %d (%v)", ka.Recasts(tv), recastErr)
+	}
+	if info, _ := tv.GetTransportInfo(ctx); info.State != "PLAYING" {
+		t.Errorf("Expected the TV to play again, got %s", info.State)
+	}
+
+	// Stopped through the renderer, the session is over
+	if err := renderer.Stop(ctx, tv); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	ka.CheckAll(ctx)
+	if ka.Recasts(tv) != 1 {
+		t.Errorf("Expected no recast after Stop, got %d recasts", ka.Recasts(tv))
+	}
+}
@@ -0,0 +1,123 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"time"
+)
+
+// KenBurnsView is a point of view on a photo
+type KenBurnsView struct {
+	Zoom float64 // 1 shows the whole photo cropped to the screen (minimum 1)
+	X, Y float64 // Center of the view as a fraction of the photo (0-1)
+}
+
+// KenBurns slowly pans and zooms over a still photo, the way photo-frame
+// slideshows bring pictures to life. The animation is sent as a sequence of
+// frames, so keep FPS low for TVs that switch images slowly.
+type KenBurns struct {
+	Duration time.Duration // Default 10s
+	FPS      float64       // Default 2
+	Width    int           // Frame width (default 1920)
+	Height   int           // Frame height (default 1080)
+
+	// From and To are the views at the start and end. The default zooms
+	// from the whole photo into its center by 20%.
+	From, To KenBurnsView
+
+	Easing Easing // Default EaseInOut
+}
+
+// withDefaults returns the effect with zero fields set to defaults
+func (k KenBurns) withDefaults() KenBurns {
+	if k.Duration <= 0 {
+		k.Duration = 10 * time.Second
+	}
+	if k.FPS <= 0 {
+		k.FPS = 2
+	}
+	if k.Width <= 0 {
+		k.Width = 1920
+	}
+	if k.Height <= 0 {
+		k.Height = 1080
+	}
+	if k.From == (KenBurnsView{}) && k.To == (KenBurnsView{}) {
+		k.From = KenBurnsView{Zoom: 1, X: 0.5, Y: 0.5}
+		k.To = KenBurnsView{Zoom: 1.2, X: 0.5, Y: 0.5}
+	}
+	if k.Easing == nil {
+		k.Easing = EaseInOut
+	}
+	return k
+}
+
+// FrameCount returns how many frames the animation has
+func (k KenBurns) FrameCount() int {
+	k = k.withDefaults()
+	return max(int(k.Duration.Seconds()*k.FPS), 1)
+}
+
+// Frame renders the animation at progress p (0 = From, 1 = To)
+func (k KenBurns) Frame(photo image.Image, p float64) image.Image {
+	return k.withDefaults().frame(photo, p, BilinearResizer{})
+}
+
+// frame renders the view at progress p with the given resizer
+func (k KenBurns) frame(photo image.Image, p float64, resizer Resizer) image.Image {
+	e := k.Easing(p)
+	lerp := func(a, b float64) float64 { return a + (b-a)*e }
+	view := KenBurnsView{
+		Zoom: lerp(k.From.Zoom, k.To.Zoom),
+		X:    lerp(k.From.X, k.To.X),
+		Y:    lerp(k.From.Y, k.To.Y),
+	}
+	return resizer.Resize(photo, viewRect(photo.Bounds(), view, k.Width, k.Height), k.Width, k.Height)
+}
+
+// viewRect returns the region of src seen by a view on a w x h screen,
+// kept inside src
+func viewRect(src image.Rectangle, view KenBurnsView, w, h int) image.Rectangle {
+	full := coverRect(src, w, h)
+	zoom := max(view.Zoom, 1)
+	vw := max(int(float64(full.Dx())/zoom), 1)
+	vh := max(int(float64(full.Dy())/zoom), 1)
+
+	cx := src.Min.X + int(view.X*float64(src.Dx()))
+	cy := src.Min.Y + int(view.Y*float64(src.Dy()))
+	x := clampInt(cx-vw/2, src.Min.X, src.Max.X-vw)
+	y := clampInt(cy-vh/2, src.Min.Y, src.Max.Y-vh)
+	return image.Rect(x, y, x+vw, y+vh)
+}
+
+// DisplayKenBurns shows the photo on the TV with a slow pan and zoom. It
+// blocks until the animation is done; the last frame stays on screen.
+func (r *Renderer) DisplayKenBurns(ctx context.Context, tv *TV, photo image.Image, k KenBurns) error {
+	k = k.withDefaults()
+	n := k.FrameCount()
+	interval := time.Duration(float64(time.Second) / k.FPS)
+
+	// Pre-encode so big photos aren't kept as raw frames
+	plan := FramePlan{LateTolerance: interval}
+	for i := 0; i < n; i++ {
+		p := 1.0
+		if n > 1 {
+			p = float64(i) / float64(n-1)
+		}
+		var buf bytes.Buffer
+		if err := (JPEGEncoder{}).Encode(&buf, k.frame(photo, p, r.resizer)); err != nil {
+			return err
+		}
+		plan.Frames = append(plan.Frames, Frame{JPEG: buf.Bytes()})
+	}
+
+	// Schedule from when encoding finished
+	start := time.Now()
+	for i := range plan.Frames {
+		plan.Frames[i].At = start.Add(time.Duration(i) * interval)
+	}
+
+	_, err := r.PlayFramePlan(ctx, []*TV{tv}, plan)
+	return err
+}
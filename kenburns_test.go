@@ -0,0 +1,65 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"image"
+	"testing"
+	"time"
+)
+
+// TestViewRect tests that views keep the screen's aspect ratio and stay
+// inside the photo
+func TestViewRect(t *testing.T) {
+	photo := image.Rect(0, 0, 4000, 3000)
+
+	tests := []struct {
+		name string
+		view KenBurnsView
+		want image.Rectangle
+	}{
+		{"whole photo", KenBurnsView{Zoom: 1, X: 0.5, Y: 0.5}, image.Rect(0, 375, 4000, 2625)},
+		{"zoomed center", KenBurnsView{Zoom: 2, X: 0.5, Y: 0.5}, image.Rect(1000, 938, 3000, 2063)},
+		{"clamped corner", KenBurnsView{Zoom: 2, X: 0, Y: 1}, image.Rect(0, 1875, 2000, 3000)},
+		{"zoom below 1", KenBurnsView{Zoom: 0.5, X: 0.5, Y: 0.5}, image.Rect(0, 375, 4000, 2625)},
+	}
+
+	for _, tt := range tests {
+		if got := viewRect(photo, tt.view, 1920, 1080); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestKenBurnsFrames tests frame count and size
+func TestKenBurnsFrames(t *testing.T) {
+	k := KenBurns{Duration: 3 * time.Second, FPS: 2, Width: 64, Height: 36}
+	if n := k.FrameCount(); n != 6 {
+		t.Errorf("Expected 6 frames, got %d", n)
+	}
+
+	frame := k.Frame(solid(400, 300, White), 0.5)
+	if b := frame.Bounds(); b.Dx() != 64 || b.Dy() != 36 {
+		t.Errorf("Expected a 64x36 frame, got %v", b)
+	}
+}
+
+// TestDisplayKenBurns tests that the animation's frames reach the TV
+func TestDisplayKenBurns(t *testing.T) {
+	tv, lastURI := recordingTV(t)
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	k := KenBurns{Duration: 500 * time.Millisecond, FPS: 4, Width: 320, Height: 180}
+	if err := renderer.DisplayKenBurns(context.Background(), tv, solid(400, 300, Red), k); err != nil {
+		t.Fatalf("DisplayKenBurns failed: %v", err)
+	}
+
+	frame := fetchJPEG(t, lastURI())
+	if frame.Bounds() != image.Rect(0, 0, 320, 180) {
+		t.Errorf("Sent a %v frame, want 320x180", frame.Bounds())
+	}
+}
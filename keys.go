@@ -0,0 +1,181 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Key is a remote control key understood across vendors
+type Key string
+
+const (
+	KeyUp         Key = "up"
+	KeyDown       Key = "down"
+	KeyLeft       Key = "left"
+	KeyRight      Key = "right"
+	KeyOK         Key = "ok"
+	KeyBack       Key = "back"
+	KeyHome       Key = "home"
+	KeyPower      Key = "power"
+	KeyPlay       Key = "play"
+	KeyPause      Key = "pause"
+	KeyVolumeUp   Key = "volume_up"
+	KeyVolumeDown Key = "volume_down"
+	KeyMute       Key = "mute"
+)
+
+// RemoteControl drives a TV through a vendor remote control API that needs
+// its own connection or pairing, such as the WebSocket APIs of Samsung and
+// LG TVs. It is attached per TV as TV.Remote.
+type RemoteControl interface {
+	SendKey(ctx context.Context, key Key) error
+	LaunchApp(ctx context.Context, appID string) error
+	TypeText(ctx context.Context, s string) error
+}
+
+// rokuKeys maps keys to Roku External Control Protocol key names
+var rokuKeys = map[Key]string{
+	KeyUp:         "Up",
+	KeyDown:       "Down",
+	KeyLeft:       "Left",
+	KeyRight:      "Right",
+	KeyOK:         "Select",
+	KeyBack:       "Back",
+	KeyHome:       "Home",
+	KeyPower:      "Power",
+	KeyPlay:       "Play",
+	KeyPause:      "Play", // Roku's Play key toggles play/pause
+	KeyVolumeUp:   "VolumeUp",
+	KeyVolumeDown: "VolumeDown",
+	KeyMute:       "VolumeMute",
+}
+
+// upnpKeys maps keys to X_SendKey events (Panasonic NetworkControl)
+var upnpKeys = map[Key]string{
+	KeyUp:         "NRC_UP-ONOFF",
+	KeyDown:       "NRC_DOWN-ONOFF",
+	KeyLeft:       "NRC_LEFT-ONOFF",
+	KeyRight:      "NRC_RIGHT-ONOFF",
+	KeyOK:         "NRC_ENTER-ONOFF",
+	KeyBack:       "NRC_RETURN-ONOFF",
+	KeyHome:       "NRC_HOME-ONOFF",
+	KeyPower:      "NRC_POWER-ONOFF",
+	KeyPlay:       "NRC_PLAY-ONOFF",
+	KeyPause:      "NRC_PAUSE-ONOFF",
+	KeyVolumeUp:   "NRC_VOLUP-ONOFF",
+	KeyVolumeDown: "NRC_VOLDOWN-ONOFF",
+	KeyMute:       "NRC_MUTE-ONOFF",
+}
+
+// rokuECPPort is the port of Roku's External Control Protocol
+var rokuECPPort = 8060
+
+// SendKey presses a remote control key on the TV.
+//
+// Supported protocols:
+//   - the TV's RemoteControl, if one is attached
+//   - UPnP X_SendKey, for TVs advertising a NetworkControl service (Panasonic)
+//   - Roku ECP, for Roku TVs
+//
+// Other TVs return ErrUnsupportedAction.
+func (tv *TV) SendKey(ctx context.Context, key Key) error {
+	switch {
+	case tv.Remote != nil:
+		return tv.wrapError("SendKey", "", tv.Remote.SendKey(ctx, key))
+
+	case tv.KeyControlURL != "":
+		event, ok := upnpKeys[key]
+		if !ok {
+			return tv.wrapError("X_SendKey", tv.KeyControlURL, fmt.Errorf("key %q: %w", key, ErrUnsupportedAction))
+		}
+		args := fmt.Sprintf(`
+      <X_KeyEvent>%s</X_KeyEvent>`, event)
+		body := serviceEnvelope(tv.KeyServiceType, "X_SendKey", args)
+		_, err := tv.sendServiceSOAP(ctx, tv.KeyControlURL, tv.KeyServiceType, "X_SendKey", body)
+		return err
+
+	case tv.isRoku():
+		name, ok := rokuKeys[key]
+		if !ok {
+			return tv.wrapError("keypress", "", fmt.Errorf("key %q: %w", key, ErrUnsupportedAction))
+		}
+		return tv.rokuPost(ctx, "/keypress/"+name)
+
+	default:
+		return tv.wrapError("SendKey", "", ErrUnsupportedAction)
+	}
+}
+
+// isRoku reports whether the TV is a Roku device
+func (tv *TV) isRoku() bool {
+	return strings.Contains(strings.ToLower(tv.Manufacturer), "roku")
+}
+
+// LaunchApp starts an app on the TV by its platform ID (e.g. "837" for
+// YouTube on Roku, "111299001912" on Samsung). Supported through the TV's
+// RemoteControl and on Roku TVs (ECP); other TVs return
+// ErrUnsupportedAction.
+func (tv *TV) LaunchApp(ctx context.Context, appID string) error {
+	switch {
+	case tv.Remote != nil:
+		return tv.wrapError("LaunchApp", "", tv.Remote.LaunchApp(ctx, appID))
+	case tv.isRoku():
+		return tv.rokuPost(ctx, "/launch/"+url.PathEscape(appID))
+	default:
+		return tv.wrapError("LaunchApp", "", ErrUnsupportedAction)
+	}
+}
+
+// TypeText types s into the on-screen keyboard or focused text field of the
+// TV, e.g. a search box or Wi-Fi password. Supported through the TV's
+// RemoteControl and on Roku TVs (ECP); other TVs return
+// ErrUnsupportedAction.
+func (tv *TV) TypeText(ctx context.Context, s string) error {
+	switch {
+	case tv.Remote != nil:
+		return tv.wrapError("TypeText", "", tv.Remote.TypeText(ctx, s))
+	case !tv.isRoku():
+		return tv.wrapError("TypeText", "", ErrUnsupportedAction)
+	}
+
+	// ECP types one literal character per keypress
+	for _, ch := range s {
+		if err := tv.rokuPost(ctx, "/keypress/Lit_"+url.PathEscape(string(ch))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rokuPost sends an ECP command to a Roku TV. path must already be escaped.
+func (tv *TV) rokuPost(ctx context.Context, path string) error {
+	ecpURL := "http://" + net.JoinHostPort(tv.IP, strconv.Itoa(rokuECPPort)) + path
+	command, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	return tv.wrapError(command, ecpURL, ecpPost(ctx, ecpURL))
+}
+
+// ecpPost sends an ECP request
+func ecpPost(ctx context.Context, ecpURL string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", ecpURL, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send ECP request: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ECP error: HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
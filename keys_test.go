@@ -0,0 +1,165 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestSendKeyUPnP tests X_SendKey requests to a NetworkControl service
+func TestSendKeyUPnP(t *testing.T) {
+	var soapAction, body string
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		soapAction = r.Header.Get("SOAPAction")
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	tv := &TV{
+		Name:           "Viera",
+		KeyControlURL:  mockTV.URL + "/nrc/control_0",
+		KeyServiceType: "urn:panasonic-com:service:p00NetworkControl:1",
+	}
+
+	if err := tv.SendKey(context.Background(), KeyUp); err != nil {
+		t.Fatalf("SendKey failed: %v", err)
+	}
+	if soapAction != `"urn:panasonic-com:service:p00NetworkControl:1#X_SendKey"` {
+		t.Errorf("Unexpected SOAPAction: %s", soapAction)
+	}
+	if !strings.Contains(body, "<X_KeyEvent>NRC_UP-ONOFF</X_KeyEvent>") {
+		t.Errorf("Expected NRC_UP-ONOFF in body, got %s", body)
+	}
+}
+
+// TestSendKeyRoku tests keypress requests over Roku ECP
+func TestSendKeyRoku(t *testing.T) {
+	var path string
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(mockTV.URL, "http://"))
+	defer func(p int) { rokuECPPort = p }(rokuECPPort)
+	rokuECPPort, _ = strconv.Atoi(port)
+
+	tv := &TV{Name: "Roku TV", IP: host, Manufacturer: "Roku"}
+	if err := tv.SendKey(context.Background(), KeyOK); err != nil {
+		t.Fatalf("SendKey failed: %v", err)
+	}
+	if path != "/keypress/Select" {
+		t.Errorf("Expected /keypress/Select, got %s", path)
+	}
+}
+
+// TestTypeTextRoku tests that text is typed as escaped literal keypresses
+func TestTypeTextRoku(t *testing.T) {
+	var paths []string
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(mockTV.URL, "http://"))
+	defer func(p int) { rokuECPPort = p }(rokuECPPort)
+	rokuECPPort, _ = strconv.Atoi(port)
+
+	tv := &TV{Name: "Roku TV", IP: host, Manufacturer: "Roku"}
+	if err := tv.TypeText(context.Background(), "a b/é"); err != nil {
+		t.Fatalf("TypeText failed: %v", err)
+	}
+
+	want := []string{"/keypress/Lit_a", "/keypress/Lit_%20", "/keypress/Lit_b", "/keypress/Lit_%2F", "/keypress/Lit_%C3%A9"}
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected %v, got %v", want, paths)
+	}
+}
+
+// TestSendKeyUnsupported tests that TVs without a key protocol are rejected
+func TestSendKeyUnsupported(t *testing.T) {
+	tv := &TV{Name: "Test TV", Manufacturer: "JVC"}
+	if err := tv.SendKey(context.Background(), KeyHome); !errors.Is(err, ErrUnsupportedAction) {
+		t.Errorf("Expected ErrUnsupportedAction, got %v", err)
+	}
+}
+
+// fakeRemote records what a RemoteControl is asked to do
+type fakeRemote struct {
+	calls []string
+}
+
+func (r *fakeRemote) SendKey(ctx context.Context, key Key) error {
+	r.calls = append(r.calls, "key "+string(key))
+	return nil
+}
+
+func (r *fakeRemote) LaunchApp(ctx context.Context, appID string) error {
+	r.calls = append(r.calls, "app "+appID)
+	return errors.New("app not installed")
+}
+
+func (r *fakeRemote) TypeText(ctx context.Context, s string) error {
+	r.calls = append(r.calls, "text "+s)
+	return nil
+}
+
+// TestRemoteControl tests that an attached RemoteControl takes over keys,
+// apps and text
+func TestRemoteControl(t *testing.T) {
+	remote := &fakeRemote{}
+	tv := &TV{Name: "Samsung", KeyControlURL: "http://192.0.2.1/nrc", Remote: remote}
+
+	if err := tv.SendKey(context.Background(), KeyBack); err != nil {
+		t.Fatalf("SendKey failed: %v", err)
+	}
+	err := tv.LaunchApp(context.Background(), "111299001912")
+	var tvErr *TVError
+	if !errors.As(err, &tvErr) || tvErr.Action != "LaunchApp" {
+		t.Errorf("Expected a TVError for LaunchApp, got %v", err)
+	}
+	if err := tv.TypeText(context.Background(), "guest wifi"); err != nil {
+		t.Fatalf("TypeText failed: %v", err)
+	}
+	if !tv.Has(CapRemoteKeys) || !tv.Has(CapTextInput) {
+		t.Errorf("Capabilities %v, want keys and text input", tv.Capabilities())
+	}
+	if strings.Join(remote.calls, ",") != "key back,app 111299001912,text guest wifi" {
+		t.Errorf("Unexpected calls: %v", remote.calls)
+	}
+}
+
+// TestLaunchAppRoku tests launching a channel over Roku ECP
+func TestLaunchAppRoku(t *testing.T) {
+	var path string
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(mockTV.URL, "http://"))
+	defer func(p int) { rokuECPPort = p }(rokuECPPort)
+	rokuECPPort, _ = strconv.Atoi(port)
+
+	tv := &TV{Name: "Roku TV", IP: host, Manufacturer: "Roku"}
+	if err := tv.LaunchApp(context.Background(), "837"); err != nil {
+		t.Fatalf("LaunchApp failed: %v", err)
+	}
+	if path != "/launch/837" {
+		t.Errorf("Expected /launch/837, got %s", path)
+	}
+	if err := (&TV{Name: "Test TV"}).LaunchApp(context.Background(), "837"); !errors.Is(err, ErrUnsupportedAction) {
+		t.Errorf("Expected ErrUnsupportedAction, got %v", err)
+	}
+}
@@ -0,0 +1,275 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoBrowser is returned when no browser to run a kiosk was found
+var ErrNoBrowser = errors.New("no browser found")
+
+// KioskOptions configures a Kiosk
+type KioskOptions struct {
+	// Browser is the browser to start (default: the first of chromium,
+	// chromium-browser and google-chrome found on PATH)
+	Browser string
+
+	// BrowserArgs are passed to the browser before the kiosk flags
+	BrowserArgs []string
+
+	// Framebuffer writes frames to this device (e.g. "/dev/fb0") instead
+	// of starting a browser. Only images are shown.
+	Framebuffer string
+
+	// Addr is the address the kiosk's virtual TV listens on (default ":0")
+	Addr string
+}
+
+// Kiosk drives a display attached to this host, e.g. the screen of a
+// Raspberry Pi signage player, so the Renderer treats it like a network TV.
+// It runs a virtual TV and shows it either in a supervised full screen
+// browser or by writing frames to the Linux framebuffer.
+type Kiosk struct {
+	*VirtualTV
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewKiosk starts a kiosk with the given friendly name
+func NewKiosk(name string, opts KioskOptions) (*Kiosk, error) {
+	var vopts []VirtualTVOption
+	if opts.Addr != "" {
+		vopts = append(vopts, WithListenAddr(opts.Addr))
+	}
+
+	var browser string
+	if opts.Framebuffer != "" {
+		fb := &Framebuffer{Device: opts.Framebuffer}
+		vopts = append(vopts, WithFrameHandler(func(frame []byte) {
+			// Best effort: the next frame tries again
+			fb.Show(frame)
+		}))
+	} else {
+		var err error
+		if browser, err = findBrowser(opts.Browser); err != nil {
+			return nil, err
+		}
+		vopts = append(vopts, WithBrowserPlayback())
+	}
+
+	vtv, err := NewVirtualTV(name, vopts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	k := &Kiosk{VirtualTV: vtv, cancel: cancel, done: make(chan struct{})}
+
+	if browser == "" {
+		close(k.done)
+		return k, nil
+	}
+
+	args := append(append([]string(nil), opts.BrowserArgs...),
+		"--kiosk",
+		"--noerrdialogs",
+		"--disable-session-crashed-bubble",
+		"--autoplay-policy=no-user-gesture-required",
+		vtv.URL(),
+	)
+	go k.superviseBrowser(ctx, browser, args)
+	return k, nil
+}
+
+// superviseBrowser keeps the browser running until the kiosk is closed
+func (k *Kiosk) superviseBrowser(ctx context.Context, browser string, args []string) {
+	defer close(k.done)
+
+	backoff := time.Second
+	for {
+		start := time.Now()
+		exec.CommandContext(ctx, browser, args...).Run()
+
+		// Reset the backoff after a browser ran for a while
+		if time.Since(start) > time.Minute {
+			backoff = time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+// Close stops the browser and the kiosk's virtual TV
+func (k *Kiosk) Close() error {
+	k.cancel()
+	<-k.done
+	return k.VirtualTV.Close()
+}
+
+// findBrowser returns the browser to run, looking it up on PATH
+func findBrowser(browser string) (string, error) {
+	candidates := []string{"chromium", "chromium-browser", "google-chrome"}
+	if browser != "" {
+		candidates = []string{browser}
+	}
+
+	for _, name := range candidates {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w (tried %s)", ErrNoBrowser, strings.Join(candidates, ", "))
+}
+
+// Framebuffer shows frames on a Linux framebuffer device. Frames are
+// letterboxed to the screen size. Pixels are written as BGRA for 32 bits
+// per pixel, BGR for 24 and RGB565 for 16.
+type Framebuffer struct {
+	Device string // e.g. "/dev/fb0"
+
+	// Screen geometry; read from /sys/class/graphics when zero
+	Width, Height int
+	BitsPerPixel  int
+
+	// Stride is the length of a row in bytes (line_length), which drivers
+	// may pad past the visible width. Read from sysfs along with the
+	// geometry; zero means rows aren't padded.
+	Stride int
+
+	mu sync.Mutex
+}
+
+// Show decodes a JPEG and writes it to the framebuffer. A nil frame
+// blanks the screen.
+func (fb *Framebuffer) Show(frame []byte) error {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	if err := fb.loadGeometry(); err != nil {
+		return err
+	}
+
+	screen := image.NewRGBA(image.Rect(0, 0, fb.Width, fb.Height))
+	draw.Draw(screen, screen.Bounds(), image.Black, image.Point{}, draw.Src)
+
+	if frame != nil {
+		img, err := jpeg.Decode(bytes.NewReader(frame))
+		if err != nil {
+			return fmt.Errorf("decode frame: %w", err)
+		}
+		w, h := fitSize(img.Bounds(), fb.Width, fb.Height)
+		scaled := scaleImage(img, img.Bounds(), w, h)
+		at := image.Pt((fb.Width-w)/2, (fb.Height-h)/2)
+		draw.Draw(screen, scaled.Bounds().Add(at), scaled, image.Point{}, draw.Src)
+	}
+
+	pixels, err := framebufferPixels(screen, fb.BitsPerPixel, fb.Stride)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(fb.Device, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(pixels); err != nil {
+		f.Close()
+		return fmt.Errorf("write framebuffer: %w", err)
+	}
+	return f.Close()
+}
+
+// loadGeometry reads the screen size and depth from sysfs unless set
+func (fb *Framebuffer) loadGeometry() error {
+	if fb.Width > 0 && fb.Height > 0 && fb.BitsPerPixel > 0 {
+		return nil
+	}
+
+	sys := filepath.Join("/sys/class/graphics", filepath.Base(fb.Device))
+	size, err := os.ReadFile(filepath.Join(sys, "virtual_size"))
+	if err != nil {
+		return fmt.Errorf("read framebuffer size: %w", err)
+	}
+	bpp, err := os.ReadFile(filepath.Join(sys, "bits_per_pixel"))
+	if err != nil {
+		return fmt.Errorf("read framebuffer depth: %w", err)
+	}
+
+	// virtual_size is "1920,1080"
+	w, h, _ := strings.Cut(strings.TrimSpace(string(size)), ",")
+	if fb.Width, err = strconv.Atoi(w); err != nil {
+		return fmt.Errorf("parse framebuffer size %q: %w", size, err)
+	}
+	if fb.Height, err = strconv.Atoi(h); err != nil {
+		return fmt.Errorf("parse framebuffer size %q: %w", size, err)
+	}
+	if fb.BitsPerPixel, err = strconv.Atoi(strings.TrimSpace(string(bpp))); err != nil {
+		return fmt.Errorf("parse framebuffer depth %q: %w", bpp, err)
+	}
+	// stride is the line_length of the driver; older kernels lack it
+	if stride, err := os.ReadFile(filepath.Join(sys, "stride")); err == nil && fb.Stride == 0 {
+		if fb.Stride, err = strconv.Atoi(strings.TrimSpace(string(stride))); err != nil {
+			return fmt.Errorf("parse framebuffer stride %q: %w", stride, err)
+		}
+	}
+	return nil
+}
+
+// framebufferPixels converts an RGBA image to the framebuffer's pixel
+// format, in rows of stride bytes (0 = unpadded)
+func framebufferPixels(img *image.RGBA, bitsPerPixel int, stride int) ([]byte, error) {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	var pixel func(dst []byte, src []byte)
+	switch bitsPerPixel {
+	case 32:
+		pixel = func(dst, src []byte) {
+			dst[0], dst[1], dst[2], dst[3] = src[2], src[1], src[0], 0xff
+		}
+	case 24:
+		pixel = func(dst, src []byte) {
+			dst[0], dst[1], dst[2] = src[2], src[1], src[0]
+		}
+	case 16:
+		pixel = func(dst, src []byte) {
+			p := uint16(src[0]>>3)<<11 | uint16(src[1]>>2)<<5 | uint16(src[2]>>3)
+			dst[0], dst[1] = byte(p), byte(p>>8)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported framebuffer depth: %d bits", bitsPerPixel)
+	}
+
+	size := bitsPerPixel / 8
+	if stride == 0 {
+		stride = width * size
+	}
+	if stride < width*size {
+		return nil, fmt.Errorf("framebuffer stride %d is shorter than a row of %d pixels", stride, width)
+	}
+	out := make([]byte, stride*height)
+	for y := range height {
+		src := img.Pix[y*img.Stride:]
+		dst := out[y*stride:]
+		for x := range width {
+			pixel(dst[x*size:], src[x*4:])
+		}
+	}
+	return out, nil
+}
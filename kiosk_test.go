@@ -0,0 +1,81 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestFramebufferShow tests that frames are letterboxed and written in the
+// framebuffer's pixel format
+func TestFramebufferShow(t *testing.T) {
+	// A red 4:1 frame on a 4x4 screen fills row 1 and leaves black bars
+	img := image.NewRGBA(image.Rect(0, 0, 40, 10))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+	var frame bytes.Buffer
+	if err := jpeg.Encode(&frame, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		bpp    int
+		size   int
+		stride int
+	}{
+		{32, 4, 0},
+		{24, 3, 0},
+		{16, 2, 0},
+		{24, 3, 16}, // Rows padded to 16 bytes
+	}
+
+	for _, tt := range tests {
+		device := filepath.Join(t.TempDir(), "fb0")
+		if err := os.WriteFile(device, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		fb := &Framebuffer{Device: device, Width: 4, Height: 4, BitsPerPixel: tt.bpp, Stride: tt.stride}
+		if err := fb.Show(frame.Bytes()); err != nil {
+			t.Fatalf("%d bpp: Show failed: %v", tt.bpp, err)
+		}
+
+		pixels, err := os.ReadFile(device)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stride := max(tt.stride, 4*tt.size)
+		if len(pixels) != 4*stride {
+			t.Fatalf("%d bpp: expected %d bytes, got %d", tt.bpp, 4*stride, len(pixels))
+		}
+
+		top := pixels[:tt.size]
+		row1 := pixels[stride : stride+tt.size]
+		if !bytes.Equal(top[:2], []byte{0, 0}) {
+			t.Errorf("%d bpp: expected a black bar, got %v", tt.bpp, top)
+		}
+		switch tt.bpp {
+		case 16:
+			if row1[1]>>3 < 30 {
+				t.Errorf("16 bpp: expected red, got %v", row1)
+			}
+		default:
+			if row1[0] > 10 || row1[2] < 240 {
+				t.Errorf("%d bpp: expected red in BGR order, got %v", tt.bpp, row1)
+			}
+		}
+	}
+}
+
+// TestKioskWithoutBrowser tests that a missing browser is reported
+func TestKioskWithoutBrowser(t *testing.T) {
+	_, err := NewKiosk("Pi", KioskOptions{Browser: "no-such-browser"})
+	if !errors.Is(err, ErrNoBrowser) {
+		t.Errorf("Expected ErrNoBrowser, got %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package nimsforestsmarttv
+
+import (
+	"slices"
+	"time"
+)
+
+// Metrics receives per-TV measurements, e.g. to export them to Prometheus.
+// Methods are called synchronously and should not block.
+type Metrics interface {
+	// ObserveDisplayLatency records the time from a Display call until the
+	// TV finished fetching the image
+	ObserveDisplayLatency(tv *TV, d time.Duration)
+}
+
+// WithMetrics reports measurements to m
+func WithMetrics(m Metrics) Option {
+	return func(r *Renderer) {
+		r.metrics = m
+	}
+}
+
+// LatencyStats summarizes recent display latencies of a TV
+type LatencyStats struct {
+	P50     time.Duration
+	P95     time.Duration
+	Samples int
+}
+
+// LatencySLO sets latency targets per TV. OnChange fires when a TV starts
+// or stops violating them, e.g. to flag a degrading Wi-Fi link early.
+type LatencySLO struct {
+	P50 time.Duration // Target median latency (0 = not checked)
+	P95 time.Duration // Target 95th percentile latency (0 = not checked)
+
+	// MinSamples is how many samples are needed before judging (default 10)
+	MinSamples int
+
+	OnChange func(tv *TV, stats LatencyStats, violated bool)
+}
+
+// WithLatencySLO checks every TV's display latency against slo
+func WithLatencySLO(slo LatencySLO) Option {
+	return func(r *Renderer) {
+		if slo.MinSamples <= 0 {
+			slo.MinSamples = 10
+		}
+		r.slo = &slo
+	}
+}
+
+// latencyWindow is how many recent samples per TV the stats are based on
+const latencyWindow = 100
+
+// pendingFetch is a frame sent to a TV that hasn't fetched it yet
+type pendingFetch struct {
+	tv    *TV
+	start time.Time
+}
+
+// expectFetch starts timing a display until the TV fetches imageURL
+func (r *Renderer) expectFetch(tv *TV, imageURL string, start time.Time) {
+	path, ok := imagePath(imageURL)
+	if !ok {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Forget frames that were never fetched
+	for p, waiting := range r.pending {
+		if start.Sub(waiting[0].start) > time.Minute {
+			delete(r.pending, p)
+		}
+	}
+	r.pending[path] = append(r.pending[path], pendingFetch{tv: tv, start: start})
+}
+
+// onFetch completes timing when a TV fetches a pending frame
+func (r *Renderer) onFetch(path string, f Fetch) {
+	r.mu.Lock()
+	waiting := r.pending[path]
+	match := -1
+	for i, p := range waiting {
+		// Frames shared by several TVs are told apart by client
+		if (f.TV != nil && f.TV.ControlURL == p.tv.ControlURL) || p.tv.hasIP(f.ClientIP) || len(waiting) == 1 {
+			match = i
+			break
+		}
+	}
+	if match < 0 {
+		r.mu.Unlock()
+		return
+	}
+
+	p := waiting[match]
+	if len(waiting) == 1 {
+		delete(r.pending, path)
+	} else {
+		r.pending[path] = slices.Delete(waiting, match, match+1)
+	}
+
+	d := f.At.Sub(p.start)
+	key := p.tv.ControlURL
+	samples := append(r.fetchSamples[key], d)
+	if len(samples) > latencyWindow {
+		samples = samples[len(samples)-latencyWindow:]
+	}
+	r.fetchSamples[key] = samples
+	stats := latencyStats(samples)
+	r.adaptQuality(key, f.Duration)
+
+	var changed, violated bool
+	if r.slo != nil && stats.Samples >= r.slo.MinSamples {
+		violated = (r.slo.P50 > 0 && stats.P50 > r.slo.P50) || (r.slo.P95 > 0 && stats.P95 > r.slo.P95)
+		changed = r.sloViolated[key] != violated
+		r.sloViolated[key] = violated
+	}
+	r.mu.Unlock()
+
+	if r.metrics != nil {
+		r.metrics.ObserveDisplayLatency(p.tv, d)
+	}
+	if changed && r.slo.OnChange != nil {
+		r.slo.OnChange(p.tv, stats, violated)
+	}
+}
+
+// DisplayLatency returns the TV's recent latency from Display call to
+// image fetched, over the last 100 frames
+func (r *Renderer) DisplayLatency(tv *TV) (LatencyStats, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	samples := r.fetchSamples[tv.ControlURL]
+	if len(samples) == 0 {
+		return LatencyStats{}, false
+	}
+	return latencyStats(samples), true
+}
+
+// latencyStats computes percentiles of samples
+func latencyStats(samples []time.Duration) LatencyStats {
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+	return LatencyStats{
+		P50:     percentile(sorted, 50),
+		P95:     percentile(sorted, 95),
+		Samples: len(sorted),
+	}
+}
+
+// percentile returns the p-th percentile of sorted samples (nearest rank)
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (len(sorted)*p + 99) / 100
+	return sorted[max(rank-1, 0)]
+}
@@ -0,0 +1,97 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+// metricsRecorder is a Metrics collecting observed latencies
+type metricsRecorder struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+}
+
+func (m *metricsRecorder) ObserveDisplayLatency(tv *TV, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latencies = append(m.latencies, d)
+}
+
+// TestDisplayLatencySLO tests display-to-fetch timing and SLO notifications
+func TestDisplayLatencySLO(t *testing.T) {
+	imageURL := regexp.MustCompile(`<CurrentURI>([^<]+)</CurrentURI>`)
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if m := imageURL.FindSubmatch(body); m != nil {
+			if resp, err := http.Get(string(m[1])); err == nil {
+				resp.Body.Close()
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	metrics := &metricsRecorder{}
+	violations := make(chan bool, 1)
+	renderer, err := NewRenderer(
+		WithMetrics(metrics),
+		WithLatencySLO(LatencySLO{
+			P95:        time.Nanosecond,
+			MinSamples: 2,
+			OnChange: func(tv *TV, stats LatencyStats, violated bool) {
+				violations <- violated
+			},
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	tv := &TV{Name: "Test TV", IP: "127.0.0.1", ControlURL: mockTV.URL}
+	img := image.NewRGBA(image.Rect(0, 0, 16, 9))
+	for i := 0; i < 2; i++ {
+		if err := renderer.DisplayImage(context.Background(), tv, img); err != nil {
+			t.Fatalf("DisplayImage failed: %v", err)
+		}
+	}
+
+	stats, ok := renderer.DisplayLatency(tv)
+	if !ok || stats.Samples != 2 || stats.P95 <= 0 {
+		t.Errorf("Expected 2 positive samples, got %+v", stats)
+	}
+	metrics.mu.Lock()
+	if len(metrics.latencies) != 2 {
+		t.Errorf("Expected 2 observed latencies, got %d", len(metrics.latencies))
+	}
+	metrics.mu.Unlock()
+
+	select {
+	case violated := <-violations:
+		if !violated {
+			t.Error("Expected an SLO violation")
+		}
+	default:
+		t.Error("Expected an SLO notification")
+	}
+}
+
+// TestPercentile tests nearest-rank percentiles
+func TestPercentile(t *testing.T) {
+	var samples []time.Duration
+	for i := 1; i <= 20; i++ {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+
+	stats := latencyStats(samples)
+	if stats.P50 != 10*time.Millisecond || stats.P95 != 19*time.Millisecond {
+		t.Errorf("Expected p50 10ms and p95 19ms, got %+v", stats)
+	}
+}
@@ -0,0 +1,70 @@
+package nimsforestsmarttv
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// lifecycle runs background goroutines and keeps the first error or panic
+// among them, so a dying HTTP server surfaces through Err and Done instead
+// of being swallowed
+type lifecycle struct {
+	done     chan struct{}
+	doneOnce sync.Once
+
+	mu  sync.Mutex
+	err error
+}
+
+// newLifecycle returns a lifecycle with nothing running
+func newLifecycle() *lifecycle {
+	return &lifecycle{done: make(chan struct{})}
+}
+
+// Go runs fn in the background. If it returns an error or panics, the
+// lifecycle ends with that error.
+func (l *lifecycle) Go(name string, fn func() error) {
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				l.fail(fmt.Errorf("%s panicked: %v\n%s", name, p, debug.Stack()))
+			}
+		}()
+		if err := fn(); err != nil {
+			l.fail(fmt.Errorf("%s: %w", name, err))
+		}
+	}()
+}
+
+// fail ends the lifecycle with err unless it already ended
+func (l *lifecycle) fail(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-l.done:
+		return
+	default:
+	}
+	l.err = err
+	l.stop()
+}
+
+// stop ends the lifecycle without an error
+func (l *lifecycle) stop() {
+	l.doneOnce.Do(func() { close(l.done) })
+}
+
+// Done is closed when the lifecycle ends
+func (l *lifecycle) Done() <-chan struct{} {
+	return l.done
+}
+
+// Err returns why the lifecycle ended, or nil while running or after a
+// clean stop
+func (l *lifecycle) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
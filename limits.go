@@ -0,0 +1,94 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+)
+
+// ErrImageTooLarge is returned for images over the size or dimension limits
+var ErrImageTooLarge = errors.New("image too large")
+
+// Limits caps the images the renderer takes from callers, so uploads and
+// API payloads can't exhaust its memory, e.g. with a small PNG declaring
+// 100000x100000 pixels (a decompression bomb). Zero fields are unlimited.
+type Limits struct {
+	// MaxBytes limits the encoded image data
+	MaxBytes int
+
+	// MaxWidth and MaxHeight limit the pixels an image may decode to. They
+	// are checked from the image header, before decoding.
+	MaxWidth  int
+	MaxHeight int
+
+	// MaxPixels limits width times height, which the other limits allow to
+	// grow to gigabytes of decoded pixels
+	MaxPixels int
+}
+
+// DefaultLimits are the limits of renderers without WithLimits and of
+// ReadImagePayload and ImageFromRequest. 50 megapixels decode to 200 MB.
+var DefaultLimits = Limits{MaxBytes: 64 << 20, MaxWidth: 16384, MaxHeight: 16384, MaxPixels: 50_000_000}
+
+// WithLimits sets the limits for images given to DisplayImageData,
+// DisplayImageFile, DecodeImage and the other calls taking encoded images
+// (default DefaultLimits). Streams of DisplayJPEGReader are cut off at
+// MaxBytes.
+func WithLimits(l Limits) Option {
+	return func(r *Renderer) {
+		r.limits = l
+		r.serverOpts = append(r.serverOpts, WithServerLimits(l))
+	}
+}
+
+// WithServerLimits cuts off images stored with StoreReader at l.MaxBytes
+func WithServerLimits(l Limits) ServerOption {
+	return func(s *ImageServer) {
+		s.limits = l
+	}
+}
+
+// Check checks the size of data and, for formats whose header Go can read,
+// its dimensions without decoding it. Images over a limit return an error
+// wrapping ErrImageTooLarge.
+func (l Limits) Check(data []byte) error {
+	if l.MaxBytes > 0 && len(data) > l.MaxBytes {
+		return fmt.Errorf("%w: %d bytes (limit %d)", ErrImageTooLarge, len(data), l.MaxBytes)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		// Decoders of other formats are checked on what they return
+		return nil
+	}
+	return l.CheckDimensions(cfg.Width, cfg.Height)
+}
+
+// CheckDimensions checks the dimensions of an image
+func (l Limits) CheckDimensions(width int, height int) error {
+	if (l.MaxWidth > 0 && width > l.MaxWidth) || (l.MaxHeight > 0 && height > l.MaxHeight) {
+		return fmt.Errorf("%w: %dx%d pixels (limit %dx%d)", ErrImageTooLarge, width, height, l.MaxWidth, l.MaxHeight)
+	}
+	if pixels := int64(width) * int64(height); l.MaxPixels > 0 && pixels > int64(l.MaxPixels) {
+		return fmt.Errorf("%w: %d pixels (limit %d)", ErrImageTooLarge, pixels, l.MaxPixels)
+	}
+	return nil
+}
+
+// readPayload reads an image payload from r. Base64 payloads are larger
+// than the image they carry, so up to half as much again is read.
+func (l Limits) readPayload(r io.Reader) ([]byte, error) {
+	if l.MaxBytes <= 0 {
+		return io.ReadAll(r)
+	}
+	limit := l.MaxBytes + l.MaxBytes/2
+	data, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrImageTooLarge, limit)
+	}
+	return data, nil
+}
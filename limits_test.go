@@ -0,0 +1,127 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// pngBomb returns the start of a PNG declaring width x height pixels, as a
+// decompression bomb does: tiny on the wire, huge once decoded
+func pngBomb(width, height uint32) []byte {
+	ihdr := binary.BigEndian.AppendUint32(nil, width)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+	ihdr = append(ihdr, 8, 2, 0, 0, 0) // 8-bit RGB
+	chunk := append([]byte("IHDR"), ihdr...)
+
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, uint32(len(ihdr)))
+	data = append(data, chunk...)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(chunk))
+}
+
+func TestLimitsCheck(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 64, 32)))
+
+	tests := []struct {
+		name   string
+		limits Limits
+		data   []byte
+		ok     bool
+	}{
+		{"within", DefaultLimits, buf.Bytes(), true},
+		{"bomb", DefaultLimits, pngBomb(100000, 100000), false},
+		{"too wide", Limits{MaxWidth: 32}, buf.Bytes(), false},
+		{"too tall", Limits{MaxHeight: 16}, buf.Bytes(), false},
+		{"too many pixels", DefaultLimits, pngBomb(16000, 16000), false},
+		{"few enough pixels", Limits{MaxPixels: 64 * 32}, buf.Bytes(), true},
+		{"too many bytes", Limits{MaxBytes: 10}, buf.Bytes(), false},
+		{"unlimited", Limits{}, pngBomb(100000, 100000), true},
+		{"unknown format", Limits{MaxWidth: 1}, []byte("not an image"), true},
+	}
+	for _, tt := range tests {
+		err := tt.limits.Check(tt.data)
+		if tt.ok && err != nil {
+			t.Errorf("%s: Check = %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrImageTooLarge) {
+			t.Errorf("%s: expected ErrImageTooLarge, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestRendererLimits(t *testing.T) {
+	var soapCalls int
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		soapCalls++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+
+	renderer, err := NewRenderer(WithLimits(Limits{MaxBytes: 1 << 20, MaxWidth: 4096, MaxHeight: 4096}))
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	ctx := context.Background()
+	bomb := pngBomb(8000, 8000)
+	if err := renderer.DisplayImageData(ctx, tv, bomb, "image/png"); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("DisplayImageData: expected ErrImageTooLarge, got %v", err)
+	}
+	if _, err := renderer.DecodeImage(bomb); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("DecodeImage: expected ErrImageTooLarge, got %v", err)
+	}
+	if err := renderer.DisplayImageJPEG(ctx, tv, make([]byte, 2<<20)); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("DisplayImageJPEG: expected ErrImageTooLarge, got %v", err)
+	}
+	if soapCalls != 0 {
+		t.Errorf("TV received %d commands for refused images", soapCalls)
+	}
+
+	// Base64 payloads may be larger than the image they carry
+	_, _, err = readImagePayload(strings.NewReader(strings.Repeat("A", 3<<20)), renderer.limits)
+	if !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("readImagePayload: expected ErrImageTooLarge, got %v", err)
+	}
+}
+
+func TestStoreReaderLimit(t *testing.T) {
+	server, err := NewImageServer(WithServerLimits(Limits{MaxBytes: 10}))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Close()
+
+	fetch := func(url string) ([]byte, error) {
+		resp, err := http.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+		}
+		return io.ReadAll(resp.Body)
+	}
+
+	data, err := fetch(server.StoreReader(strings.NewReader("0123456789")))
+	if err != nil || string(data) != "0123456789" {
+		t.Errorf("Stream at the limit = %q, %v", data, err)
+	}
+	if _, err := fetch(server.StoreReader(strings.NewReader("0123456789A"))); err == nil {
+		t.Error("Stream over the limit was served whole")
+	}
+}
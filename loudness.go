@@ -0,0 +1,370 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrUnsupportedAudio is returned for audio NormalizeWAV can't read
+var ErrUnsupportedAudio = errors.New("unsupported audio format")
+
+// DefaultLoudness is the loudness announcements are normalized to, in LUFS
+// (EBU R128's broadcast target)
+const DefaultLoudness = -23.0
+
+// Loudness measurement as in ITU-R BS.1770, which EBU R128 builds on
+const (
+	loudnessBlock    = 0.4 // Gating block length in seconds
+	loudnessStep     = 0.1 // Blocks overlap by 75%
+	absoluteGate     = -70.0
+	relativeGate     = -10.0
+	maxPeakDBFS      = -1.0 // Headroom left when turning quiet clips up
+	waveFormatPCM    = 1
+	waveFormatFloat  = 3
+	waveFormatExtend = 0xfffe
+)
+
+// wavClip is a parsed WAV file. Samples are read from and written back to
+// data, so every other chunk is kept as it is.
+type wavClip struct {
+	format     int
+	channels   int
+	sampleRate int
+	bits       int
+	data       []byte // The samples of the data chunk
+}
+
+// parseWAV reads the format and sample data of a RIFF WAVE file
+func parseWAV(wav []byte) (wavClip, error) {
+	if len(wav) < 12 || string(wav[:4]) != "RIFF" || string(wav[8:12]) != "WAVE" {
+		return wavClip{}, fmt.Errorf("%w: not a WAV file", ErrUnsupportedAudio)
+	}
+
+	var clip wavClip
+	for rest := wav[12:]; len(rest) >= 8; {
+		id, size := string(rest[:4]), int(binary.LittleEndian.Uint32(rest[4:8]))
+		body := rest[8:]
+		// Streamed WAVs leave the data size at 0 or 0xffffffff
+		if size > len(body) || (id == "data" && size == 0) {
+			size = len(body)
+		}
+		body = body[:size]
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return wavClip{}, fmt.Errorf("%w: short fmt chunk", ErrUnsupportedAudio)
+			}
+			clip.format = int(binary.LittleEndian.Uint16(body))
+			clip.channels = int(binary.LittleEndian.Uint16(body[2:]))
+			clip.sampleRate = int(binary.LittleEndian.Uint32(body[4:]))
+			clip.bits = int(binary.LittleEndian.Uint16(body[14:]))
+			if clip.format == waveFormatExtend && size >= 26 {
+				clip.format = int(binary.LittleEndian.Uint16(body[24:]))
+			}
+		case "data":
+			clip.data = body
+		}
+		// Chunks are padded to an even size
+		rest = rest[min(8+size+size%2, len(rest)):]
+	}
+
+	switch {
+	case clip.channels == 0 || clip.sampleRate == 0:
+		return wavClip{}, fmt.Errorf("%w: no fmt chunk", ErrUnsupportedAudio)
+	case clip.format == waveFormatPCM && (clip.bits == 8 || clip.bits == 16 || clip.bits == 24 || clip.bits == 32):
+	case clip.format == waveFormatFloat && (clip.bits == 32 || clip.bits == 64):
+	default:
+		return wavClip{}, fmt.Errorf("%w: WAV format %d with %d bits", ErrUnsupportedAudio, clip.format, clip.bits)
+	}
+	clip.data = clip.data[:len(clip.data)/clip.frameSize()*clip.frameSize()]
+	return clip, nil
+}
+
+// frameSize returns the bytes per sample of all channels
+func (c wavClip) frameSize() int {
+	return c.channels * c.bits / 8
+}
+
+// frames returns the number of samples per channel
+func (c wavClip) frames() int {
+	return len(c.data) / c.frameSize()
+}
+
+// sample returns sample i of channel ch, scaled to [-1, 1]
+func (c wavClip) sample(i, ch int) float64 {
+	b := c.data[(i*c.channels+ch)*c.bits/8:]
+	switch {
+	case c.format == waveFormatFloat && c.bits == 32:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	case c.format == waveFormatFloat:
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	case c.bits == 8:
+		return (float64(b[0]) - 128) / 128
+	case c.bits == 16:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+	case c.bits == 24:
+		return float64(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)>>8) / (1 << 23)
+	default:
+		return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+	}
+}
+
+// setSample writes sample i of channel ch, clipping it to [-1, 1]
+func (c wavClip) setSample(i, ch int, v float64) {
+	v = max(-1, min(v, 1))
+	b := c.data[(i*c.channels+ch)*c.bits/8:]
+	pcm := func(scale float64) int64 {
+		return int64(max(-scale, min(math.Round(v*scale), scale-1)))
+	}
+	switch {
+	case c.format == waveFormatFloat && c.bits == 32:
+		binary.LittleEndian.PutUint32(b, math.Float32bits(float32(v)))
+	case c.format == waveFormatFloat:
+		binary.LittleEndian.PutUint64(b, math.Float64bits(v))
+	case c.bits == 8:
+		b[0] = byte(pcm(128) + 128)
+	case c.bits == 16:
+		binary.LittleEndian.PutUint16(b, uint16(pcm(1<<15)))
+	case c.bits == 24:
+		s := pcm(1 << 23)
+		b[0], b[1], b[2] = byte(s), byte(s>>8), byte(s>>16)
+	default:
+		binary.LittleEndian.PutUint32(b, uint32(pcm(1<<31)))
+	}
+}
+
+// biquad is a second order IIR filter
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *biquad) filter(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// kWeighting returns the two filters of BS.1770's K-weighting for a sample
+// rate: a high shelf modelling the head and a high pass
+func kWeighting(sampleRate int) (biquad, biquad) {
+	fs := float64(sampleRate)
+
+	k := math.Tan(math.Pi * 1681.974450955533 / fs)
+	q := 0.7071752369554196
+	vh := math.Pow(10, 3.999843853973347/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	k = math.Tan(math.Pi * 38.13547087602444 / fs)
+	q = 0.5003270373238773
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1, b1: -2, b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return shelf, highPass
+}
+
+// channelWeight returns BS.1770's weight of a channel: surround channels
+// of 5.1 count more, the LFE channel not at all
+func channelWeight(ch, channels int) float64 {
+	if channels != 6 {
+		return 1
+	}
+	switch ch {
+	case 3:
+		return 0
+	case 4, 5:
+		return 1.41
+	}
+	return 1
+}
+
+// loudness returns the integrated loudness of a clip in LUFS, -Inf for
+// silence
+func (c wavClip) loudness() float64 {
+	frames := c.frames()
+	if frames == 0 {
+		return math.Inf(-1)
+	}
+
+	// Mean square of the K-weighted signal per 100ms step
+	step := max(int(loudnessStep*float64(c.sampleRate)), 1)
+	steps := (frames + step - 1) / step
+	power := make([]float64, steps)
+	for ch := range c.channels {
+		weight := channelWeight(ch, c.channels)
+		if weight == 0 {
+			continue
+		}
+		shelf, highPass := kWeighting(c.sampleRate)
+		for i := range frames {
+			y := highPass.filter(shelf.filter(c.sample(i, ch)))
+			power[i/step] += weight * y * y
+		}
+	}
+
+	// 400ms blocks of four steps; shorter clips are one block
+	perBlock := int(loudnessBlock / loudnessStep)
+	var blocks []float64
+	for i := 0; i+perBlock <= steps || (i == 0 && len(blocks) == 0); i++ {
+		n, sum := 0, 0.0
+		for j := i; j < min(i+perBlock, steps); j++ {
+			sum += power[j]
+			n += min(step, frames-j*step)
+		}
+		blocks = append(blocks, sum/float64(n))
+	}
+
+	lufs := func(p float64) float64 { return -0.691 + 10*math.Log10(p) }
+	gated := func(threshold float64) float64 {
+		n, sum := 0, 0.0
+		for _, p := range blocks {
+			if lufs(p) > threshold {
+				sum += p
+				n++
+			}
+		}
+		if n == 0 {
+			return math.Inf(-1)
+		}
+		return lufs(sum / float64(n))
+	}
+	ungated := gated(absoluteGate)
+	if math.IsInf(ungated, -1) {
+		return ungated
+	}
+	return gated(max(ungated+relativeGate, absoluteGate))
+}
+
+// peak returns the largest absolute sample value
+func (c wavClip) peak() float64 {
+	peak := 0.0
+	for i := range c.frames() {
+		for ch := range c.channels {
+			peak = max(peak, math.Abs(c.sample(i, ch)))
+		}
+	}
+	return peak
+}
+
+// Loudness returns the integrated loudness of a WAV clip in LUFS, as
+// measured by EBU R128. Silent clips measure -Inf.
+func Loudness(wav []byte) (float64, error) {
+	clip, err := parseWAV(wav)
+	if err != nil {
+		return 0, err
+	}
+	return clip.loudness(), nil
+}
+
+// NormalizeWAV returns a copy of a WAV clip turned up or down to the
+// target loudness in LUFS (e.g. DefaultLoudness). Quiet clips are only
+// turned up as far as their peaks stay below -1 dBFS, so nothing clips.
+// Silent clips are returned unchanged.
+func NormalizeWAV(wav []byte, target float64) ([]byte, error) {
+	out := bytes.Clone(wav)
+	clip, err := parseWAV(out)
+	if err != nil {
+		return nil, err
+	}
+	loudness := clip.loudness()
+	if math.IsInf(loudness, -1) {
+		return out, nil
+	}
+
+	gain := target - loudness
+	if peak := clip.peak(); peak > 0 {
+		gain = min(gain, maxPeakDBFS-20*math.Log10(peak))
+	}
+	factor := math.Pow(10, gain/20)
+	for i := range clip.frames() {
+		for ch := range clip.channels {
+			clip.setSample(i, ch, clip.sample(i, ch)*factor)
+		}
+	}
+	return out, nil
+}
+
+// WithAudioNormalization makes PlayAudio normalize WAV clips to the target
+// loudness in LUFS (e.g. DefaultLoudness), so announcements from different
+// sources come out equally loud
+func WithAudioNormalization(target float64) Option {
+	return func(r *Renderer) {
+		r.loudness = &target
+	}
+}
+
+// PlayAudio plays an audio clip on the TV, e.g. a text-to-speech
+// announcement. With WithAudioNormalization, WAV clips are normalized
+// first; other formats are played as they are. A KeepAlive casts
+// persistent sessions again once the clip ended.
+func (r *Renderer) PlayAudio(ctx context.Context, tv *TV, data []byte, title string) error {
+	contentType := audioClipType(data)
+	if r.loudness != nil && contentType == "audio/wav" {
+		normalized, err := NormalizeWAV(data, *r.loudness)
+		if err != nil {
+			return fmt.Errorf("normalize: %w", err)
+		}
+		data = normalized
+	}
+	if title == "" {
+		title = r.message(MsgAnnouncement)
+	}
+
+	audioURL := r.server.StoreContent(data, contentType)
+	unlock, err := r.lockTV(ctx, tv)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := r.intend(ctx, tv, JournalAudio, audioURL, contentType, title); err != nil {
+		return err
+	}
+
+	if tv.Protocol != ProtocolDLNA {
+		return r.device(tv).Load(ctx, Media{URL: audioURL, ContentType: contentType, Title: title})
+	}
+
+	res := fmt.Sprintf(`<res protocolInfo="http-get:*:%s:*" size="%d">%s</res>`, contentType, len(data), escapeXML(audioURL))
+	if err := tv.setAVTransportURIMetadata(ctx, audioURL, didlItem(title, "object.item.audioItem", res)); err != nil {
+		return fmt.Errorf("set URI: %w", err)
+	}
+	if err := tv.play(ctx); err != nil {
+		return fmt.Errorf("play: %w", err)
+	}
+	return r.verifyPlaying(ctx, tv)
+}
+
+// audioClipType returns the MIME type of an audio clip
+func audioClipType(data []byte) string {
+	switch {
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		return "audio/wav"
+	case bytes.HasPrefix(data, []byte("ID3")) || len(data) >= 2 && data[0] == 0xff && data[1]&0xe0 == 0xe0:
+		return "audio/mpeg"
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return "audio/ogg"
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		return "audio/flac"
+	case len(data) >= 12 && string(data[4:8]) == "ftyp":
+		return "audio/mp4"
+	}
+	return "audio/mpeg"
+}
@@ -0,0 +1,119 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// sineWAV returns a 16-bit stereo WAV of a 1 kHz sine with the given peak
+// level in dBFS
+func sineWAV(sampleRate int, seconds float64, dBFS float64) []byte {
+	amplitude := math.Pow(10, dBFS/20)
+	frames := int(seconds * float64(sampleRate))
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+frames*4))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, struct {
+		Size                   uint32
+		Format, Channels       uint16
+		SampleRate, ByteRate   uint32
+		BlockAlign, SampleBits uint16
+	}{16, 1, 2, uint32(sampleRate), uint32(sampleRate * 4), 4, 16})
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(frames*4))
+	for i := range frames {
+		s := int16(math.Round(amplitude * math.Sin(2*math.Pi*1000*float64(i)/float64(sampleRate)) * 32767))
+		binary.Write(&buf, binary.LittleEndian, []int16{s, s})
+	}
+	return buf.Bytes()
+}
+
+func TestLoudness(t *testing.T) {
+	// EBU Tech 3341 case 1: a stereo 1 kHz sine at -23 dBFS is -23 LUFS
+	for _, rate := range []int{44100, 48000} {
+		lufs, err := Loudness(sineWAV(rate, 5, -23))
+		if err != nil {
+			t.Fatalf("Loudness failed: %v", err)
+		}
+		if math.Abs(lufs-(-23)) > 0.1 {
+			t.Errorf("%d Hz: loudness = %.2f LUFS, want -23", rate, lufs)
+		}
+	}
+
+	quiet := sineWAV(48000, 3, -40)
+	normalized, err := NormalizeWAV(quiet, DefaultLoudness)
+	if err != nil {
+		t.Fatalf("NormalizeWAV failed: %v", err)
+	}
+	if lufs, _ := Loudness(normalized); math.Abs(lufs-DefaultLoudness) > 0.1 {
+		t.Errorf("normalized loudness = %.2f LUFS, want %.0f", lufs, DefaultLoudness)
+	}
+	if lufs, _ := Loudness(quiet); math.Abs(lufs-(-40)) > 0.1 {
+		t.Error("NormalizeWAV changed its input")
+	}
+
+	// Turning up stops short of clipping
+	normalized, _ = NormalizeWAV(quiet, 0)
+	clip, _ := parseWAV(normalized)
+	if peak := 20 * math.Log10(clip.peak()); peak > -0.99 || peak < -1.1 {
+		t.Errorf("peak after normalizing to 0 LUFS = %.2f dBFS, want -1", peak)
+	}
+
+	silence := sineWAV(48000, 1, math.Inf(-1))
+	if out, err := NormalizeWAV(silence, DefaultLoudness); err != nil || !bytes.Equal(out, silence) {
+		t.Errorf("silence changed by NormalizeWAV (err %v)", err)
+	}
+	if _, err := Loudness([]byte("ID3 not a wav")); !errors.Is(err, ErrUnsupportedAudio) {
+		t.Errorf("Expected ErrUnsupportedAudio, got %v", err)
+	}
+}
+
+func TestPlayAudioNormalizes(t *testing.T) {
+	var mu sync.Mutex
+	var uri, metadata string
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if v := soapArg(body, "CurrentURI"); v != "" {
+			mu.Lock()
+			uri, metadata = v, soapArg(body, "CurrentURIMetaData")
+			mu.Unlock()
+		}
+	}))
+	defer mockTV.Close()
+
+	renderer, err := NewRenderer(WithAudioNormalization(DefaultLoudness))
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	tv := &TV{Name: "Hall", ControlURL: mockTV.URL + "/control"}
+	if err := renderer.PlayAudio(context.Background(), tv, sineWAV(16000, 2, -6), ""); err != nil {
+		t.Fatalf("PlayAudio failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !strings.HasSuffix(uri, ".wav") || !strings.Contains(metadata, "audio/wav") || !strings.Contains(metadata, "Announcement") {
+		t.Errorf("TV got %s with metadata %s", uri, metadata)
+	}
+	resp, err := http.Get(uri)
+	if err != nil {
+		t.Fatalf("GET clip: %v", err)
+	}
+	played, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if lufs, _ := Loudness(played); math.Abs(lufs-DefaultLoudness) > 0.1 {
+		t.Errorf("played clip is %.2f LUFS, want %.0f", lufs, DefaultLoudness)
+	}
+}
@@ -0,0 +1,306 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// mdnsAddr is the multicast DNS group
+const mdnsAddr = "224.0.0.251:5353"
+
+// DNS record types used by mDNS service discovery
+const (
+	dnsTypeA   = 1
+	dnsTypePTR = 12
+	dnsTypeTXT = 16
+	dnsTypeSRV = 33
+)
+
+// dnsRecord is a resource record of a DNS message
+type dnsRecord struct {
+	Name string
+	Type uint16
+	TTL  uint32
+	Data []byte
+
+	// Decoded from Data for PTR and SRV records
+	Target string
+	Port   int
+}
+
+// mdnsService is one instance of a service found by browseMDNS
+type mdnsService struct {
+	Instance string // e.g. "Chromecast-1234._googlecast._tcp.local."
+	Host     string
+	Port     int
+	IP       string
+	TXT      map[string]string
+}
+
+// browseMDNS asks addr (nil = the mDNS group) for instances of service
+// (e.g. "_googlecast._tcp.local.") and collects the answers until the
+// timeout expires or ctx is done. The query asks for unicast replies, so no
+// port has to be shared with the system's mDNS responder.
+func browseMDNS(ctx context.Context, addr *net.UDPAddr, service string, timeout time.Duration) ([]mdnsService, error) {
+	if addr == nil {
+		var err error
+		if addr, err = net.ResolveUDPAddr("udp4", mdnsAddr); err != nil {
+			return nil, fmt.Errorf("resolve mDNS address: %w", err)
+		}
+	}
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, fmt.Errorf("listen UDP: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	// QU bit: unicast response requested
+	query := appendDNSQuestion(appendDNSHeader(nil, 0, 0, 1, 0), service, dnsTypePTR, 0x8001)
+	if _, err := conn.WriteToUDP(query, addr); err != nil {
+		return nil, fmt.Errorf("send mDNS query: %w", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	instances := make(map[string]bool)
+	var order []string
+	srv := make(map[string]dnsRecord)
+	txt := make(map[string]map[string]string)
+	hosts := make(map[string]string)
+	sources := make(map[string]string)
+
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break
+		}
+		records, err := parseDNS(buf[:n])
+		if err != nil {
+			continue
+		}
+		for _, rr := range records {
+			name := strings.ToLower(rr.Name)
+			switch rr.Type {
+			case dnsTypePTR:
+				if strings.EqualFold(rr.Name, service) && !instances[strings.ToLower(rr.Target)] {
+					instances[strings.ToLower(rr.Target)] = true
+					order = append(order, rr.Target)
+				}
+			case dnsTypeSRV:
+				srv[name] = rr
+				sources[name] = from.IP.String()
+			case dnsTypeTXT:
+				txt[name] = parseTXT(rr.Data)
+			case dnsTypeA:
+				if len(rr.Data) == 4 {
+					hosts[name] = net.IP(rr.Data).String()
+				}
+			}
+		}
+	}
+
+	var services []mdnsService
+	for _, instance := range order {
+		key := strings.ToLower(instance)
+		rr, ok := srv[key]
+		if !ok {
+			continue
+		}
+		s := mdnsService{Instance: instance, Host: rr.Target, Port: rr.Port, TXT: txt[key]}
+		if s.IP = hosts[strings.ToLower(rr.Target)]; s.IP == "" {
+			s.IP = sources[key]
+		}
+		services = append(services, s)
+	}
+	return services, ctx.Err()
+}
+
+// parseTXT splits TXT strings into key=value pairs
+func parseTXT(data []byte) map[string]string {
+	txt := make(map[string]string)
+	for len(data) > 0 {
+		n := int(data[0])
+		if n+1 > len(data) {
+			break
+		}
+		key, value, _ := strings.Cut(string(data[1:1+n]), "=")
+		if key != "" {
+			txt[strings.ToLower(key)] = value
+		}
+		data = data[1+n:]
+	}
+	return txt
+}
+
+// appendDNSHeader appends a DNS header with the given record counts
+func appendDNSHeader(b []byte, id uint16, flags uint16, questions int, answers int) []byte {
+	b = binary.BigEndian.AppendUint16(b, id)
+	b = binary.BigEndian.AppendUint16(b, flags)
+	b = binary.BigEndian.AppendUint16(b, uint16(questions))
+	b = binary.BigEndian.AppendUint16(b, uint16(answers))
+	return binary.BigEndian.AppendUint32(b, 0) // No authority or additional records
+}
+
+// appendDNSName appends name in uncompressed wire format
+func appendDNSName(b []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+// appendDNSQuestion appends a question for name
+func appendDNSQuestion(b []byte, name string, typ uint16, class uint16) []byte {
+	b = appendDNSName(b, name)
+	b = binary.BigEndian.AppendUint16(b, typ)
+	return binary.BigEndian.AppendUint16(b, class)
+}
+
+// appendDNSRecord appends a resource record of class IN
+func appendDNSRecord(b []byte, rr dnsRecord) []byte {
+	b = appendDNSName(b, rr.Name)
+	b = binary.BigEndian.AppendUint16(b, rr.Type)
+	b = binary.BigEndian.AppendUint16(b, 1)
+	b = binary.BigEndian.AppendUint32(b, rr.TTL)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(rr.Data)))
+	return append(b, rr.Data...)
+}
+
+// parseDNS returns the answer, authority and additional records of msg
+func parseDNS(msg []byte) ([]dnsRecord, error) {
+	if len(msg) < 12 {
+		return nil, errors.New("short DNS message")
+	}
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	count := int(binary.BigEndian.Uint16(msg[6:])) + int(binary.BigEndian.Uint16(msg[8:])) + int(binary.BigEndian.Uint16(msg[10:]))
+
+	off := 12
+	for range questions {
+		_, next, err := readDNSName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		off = next + 4
+	}
+
+	var records []dnsRecord
+	for range count {
+		name, next, err := readDNSName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		if next+10 > len(msg) {
+			return nil, errors.New("truncated DNS record")
+		}
+		rr := dnsRecord{
+			Name: name,
+			Type: binary.BigEndian.Uint16(msg[next:]),
+			TTL:  binary.BigEndian.Uint32(msg[next+4:]),
+		}
+		start := next + 10
+		end := start + int(binary.BigEndian.Uint16(msg[next+8:]))
+		if end > len(msg) {
+			return nil, errors.New("truncated DNS record")
+		}
+		rr.Data = msg[start:end]
+
+		switch rr.Type {
+		case dnsTypePTR:
+			if rr.Target, _, err = readDNSName(msg, start); err != nil {
+				return nil, err
+			}
+		case dnsTypeSRV:
+			if len(rr.Data) < 7 {
+				return nil, errors.New("short SRV record")
+			}
+			rr.Port = int(binary.BigEndian.Uint16(rr.Data[4:]))
+			if rr.Target, _, err = readDNSName(msg, start+6); err != nil {
+				return nil, err
+			}
+		}
+		records = append(records, rr)
+		off = end
+	}
+	return records, nil
+}
+
+// dnsQuestion is a question of a DNS message
+type dnsQuestion struct {
+	Name  string
+	Type  uint16
+	Class uint16 // The top bit asks mDNS responders for a unicast reply
+}
+
+// parseDNSQuestions returns the questions of msg
+func parseDNSQuestions(msg []byte) ([]dnsQuestion, error) {
+	if len(msg) < 12 {
+		return nil, errors.New("short DNS message")
+	}
+	var questions []dnsQuestion
+	off := 12
+	for range int(binary.BigEndian.Uint16(msg[4:])) {
+		name, next, err := readDNSName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		if next+4 > len(msg) {
+			return nil, errors.New("truncated DNS question")
+		}
+		questions = append(questions, dnsQuestion{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(msg[next:]),
+			Class: binary.BigEndian.Uint16(msg[next+2:]),
+		})
+		off = next + 4
+	}
+	return questions, nil
+}
+
+// readDNSName reads a possibly compressed name at off and returns it with
+// the offset following it
+func readDNSName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errors.New("truncated DNS name")
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case n&0xC0 == 0xC0:
+			if off+1 >= len(msg) {
+				return "", 0, errors.New("truncated DNS name")
+			}
+			if jumps++; jumps > 16 {
+				return "", 0, errors.New("DNS name compression loop")
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3FFF)
+		default:
+			if off+1+n > len(msg) {
+				return "", 0, errors.New("truncated DNS name")
+			}
+			labels = append(labels, string(msg[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package nimsforestsmarttv
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Message identifies a built-in string that can end up on a screen
+type Message string
+
+// Built-in messages
+const (
+	MsgVideoStream  Message = "video-stream" // Default title of videos
+	MsgHLSStream    Message = "hls-stream"   // Default title of DisplayHLS
+	MsgNoSignal     Message = "no-signal"    // Stale stream card; %s is the time of the last frame
+	MsgAnnouncement Message = "announcement" // Default title of PlayAudio
+)
+
+// Catalog maps messages to their text in one language. Texts are
+// fmt format strings when the message takes arguments.
+type Catalog map[Message]string
+
+// Text returns the text of msg formatted with args. Messages missing from
+// the catalog fall back to English.
+func (c Catalog) Text(msg Message, args ...any) string {
+	format, ok := c[msg]
+	if !ok {
+		if format, ok = messages["en"][msg]; !ok {
+			format = string(msg)
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Catalogs holds catalogs by language tag ("en", "de", "pt-br")
+type Catalogs map[string]Catalog
+
+// Lookup returns the catalog for a language such as "de", "de-CH" or the
+// POSIX form "de_CH.UTF-8", trying the full tag, then the base language.
+// Entries missing from the language come from the "en" catalog.
+func (cs Catalogs) Lookup(lang string) Catalog {
+	c := maps.Clone(cs["en"])
+	if c == nil {
+		c = make(Catalog)
+	}
+	tag := normalizeLanguage(lang)
+	base, _, _ := strings.Cut(tag, "-")
+	if l, ok := cs[tag]; ok {
+		maps.Copy(c, l)
+	} else if l, ok := cs[base]; ok {
+		maps.Copy(c, l)
+	}
+	return c
+}
+
+// normalizeLanguage turns "de_CH.UTF-8" into "de-ch"
+func normalizeLanguage(lang string) string {
+	lang, _, _ = strings.Cut(lang, ".")
+	lang, _, _ = strings.Cut(lang, "@")
+	lang = strings.ToLower(strings.ReplaceAll(lang, "_", "-"))
+	if lang == "" || lang == "c" || lang == "posix" {
+		return "en"
+	}
+	return lang
+}
+
+// messages are the built-in catalogs
+var messages = Catalogs{
+	"en": {
+		MsgVideoStream:  "Video Stream",
+		MsgHLSStream:    "HLS Stream",
+		MsgNoSignal:     "No signal since %s",
+		MsgAnnouncement: "Announcement",
+	},
+	"de": {
+		MsgVideoStream:  "Videostream",
+		MsgHLSStream:    "HLS-Stream",
+		MsgNoSignal:     "Kein Signal seit %s",
+		MsgAnnouncement: "Durchsage",
+	},
+	"es": {
+		MsgVideoStream:  "Transmisión de vídeo",
+		MsgHLSStream:    "Transmisión HLS",
+		MsgNoSignal:     "Sin señal desde las %s",
+		MsgAnnouncement: "Anuncio",
+	},
+	"fr": {
+		MsgVideoStream:  "Flux vidéo",
+		MsgHLSStream:    "Flux HLS",
+		MsgNoSignal:     "Aucun signal depuis %s",
+		MsgAnnouncement: "Annonce",
+	},
+	"nl": {
+		MsgVideoStream:  "Videostream",
+		MsgHLSStream:    "HLS-stream",
+		MsgNoSignal:     "Geen signaal sinds %s",
+		MsgAnnouncement: "Omroepbericht",
+	},
+}
+
+// CatalogFor returns the built-in catalog for a language, falling back to
+// English
+func CatalogFor(lang string) Catalog {
+	return messages.Lookup(lang)
+}
+
+// Languages returns the languages of the built-in catalogs
+func Languages() []string {
+	return slices.Sorted(maps.Keys(messages))
+}
+
+// SystemLanguage returns the language from LC_ALL, LC_MESSAGES or LANG,
+// e.g. "de_DE.UTF-8", or "" if none is set
+func SystemLanguage() string {
+	for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// WithLanguage sets the language of built-in strings shown on screens,
+// e.g. "de" or "fr-CH" (default English)
+func WithLanguage(lang string) Option {
+	return func(r *Renderer) {
+		r.catalog = CatalogFor(lang)
+	}
+}
+
+// WithCatalog sets a custom catalog for built-in strings shown on screens.
+// Missing messages fall back to English.
+func WithCatalog(c Catalog) Option {
+	return func(r *Renderer) {
+		r.catalog = c
+	}
+}
+
+// message returns the text of a built-in message in the renderer's language
+func (r *Renderer) message(msg Message, args ...any) string {
+	r.settingsMu.RLock()
+	c := r.catalog
+	r.settingsMu.RUnlock()
+	return c.Text(msg, args...)
+}
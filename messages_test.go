@@ -0,0 +1,52 @@
+package nimsforestsmarttv
+
+import "testing"
+
+func TestCatalogLookup(t *testing.T) {
+	tests := []struct {
+		lang string
+		want string
+	}{
+		{"", "Video Stream"},
+		{"C", "Video Stream"},
+		{"de", "Videostream"},
+		{"de_CH.UTF-8", "Videostream"},
+		{"fr-CA", "Flux vidéo"},
+		{"ja", "Video Stream"},
+	}
+	for _, tt := range tests {
+		if got := CatalogFor(tt.lang).Text(MsgVideoStream); got != tt.want {
+			t.Errorf("CatalogFor(%q) = %q, want %q", tt.lang, got, tt.want)
+		}
+	}
+
+	if got := CatalogFor("nl").Text(MsgNoSignal, "10:00:00"); got != "Geen signaal sinds 10:00:00" {
+		t.Errorf("no signal = %q", got)
+	}
+
+	// Custom catalogs fall back to English for missing messages
+	custom := Catalogs{"pt": {MsgVideoStream: "Transmissão de vídeo"}}.Lookup("pt-BR")
+	if got := custom.Text(MsgVideoStream); got != "Transmissão de vídeo" {
+		t.Errorf("custom = %q", got)
+	}
+	if got := custom.Text(MsgHLSStream); got != "HLS Stream" {
+		t.Errorf("fallback = %q, want English", got)
+	}
+}
+
+func TestRendererLanguage(t *testing.T) {
+	renderer, err := NewRenderer(WithLanguage("es_ES.UTF-8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer renderer.Close()
+
+	if got := renderer.message(MsgHLSStream); got != "Transmisión HLS" {
+		t.Errorf("message = %q", got)
+	}
+
+	renderer.Configure(func(s *Settings) { s.Catalog = CatalogFor("de") })
+	if got := renderer.message(MsgNoSignal, "09:30:00"); got != "Kein Signal seit 09:30:00" {
+		t.Errorf("message after Configure = %q", got)
+	}
+}
@@ -0,0 +1,71 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrPairingRejected is returned when the user or the TV declines pairing
+var ErrPairingRejected = errors.New("pairing rejected")
+
+// Credentials are the opaque values a backend keeps after pairing with a TV
+// (e.g. {"token": "..."} for Samsung, client keys for LG)
+type Credentials map[string]string
+
+// PromptKind says what a pairing prompt asks for
+type PromptKind int
+
+const (
+	// PromptPIN asks the user to enter the PIN shown on the TV
+	PromptPIN PromptKind = iota
+	// PromptConfirm asks the user to accept the request on the TV, then confirm
+	PromptConfirm
+)
+
+// Prompt is a question a Pairer needs the user to answer
+type Prompt struct {
+	Kind    PromptKind
+	TV      *TV
+	Message string // Human-readable instructions (e.g. "Enter the PIN shown on TV Salon")
+}
+
+// PromptFunc shows a prompt to the user and returns their answer: the PIN
+// for PromptPIN, anything for PromptConfirm. Returning an error cancels
+// pairing. Applications implement this once for all backends.
+type PromptFunc func(ctx context.Context, p Prompt) (string, error)
+
+// Pairer pairs with a TV using a vendor protocol (Samsung, LG, Vizio,
+// AirPlay...) and returns the credentials needed to control it afterwards
+type Pairer interface {
+	// Backend names the protocol, used to store credentials (e.g. "samsung")
+	Backend() string
+
+	// Pair runs the pairing handshake, calling prompt when user input is needed
+	Pair(ctx context.Context, tv *TV, prompt PromptFunc) (Credentials, error)
+}
+
+// Pair returns the TV's stored credentials for the pairer's backend, or runs
+// the pairing flow and saves the resulting credentials in the registry
+func (reg *Registry) Pair(ctx context.Context, tv *TV, pairer Pairer, prompt PromptFunc) (Credentials, error) {
+	creds, err := reg.Credentials(tv, pairer.Backend())
+	if err == nil {
+		return creds, nil
+	}
+	if !errors.Is(err, ErrNotPaired) {
+		return nil, fmt.Errorf("load credentials: %w", err)
+	}
+
+	creds, err = pairer.Pair(ctx, tv, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("pair %s with %s: %w", pairer.Backend(), tv.Name, err)
+	}
+
+	if err := reg.SetCredentials(tv, pairer.Backend(), creds); err != nil {
+		return nil, fmt.Errorf("store credentials: %w", err)
+	}
+	if err := reg.Save(); err != nil {
+		return nil, fmt.Errorf("save credentials: %w", err)
+	}
+	return creds, nil
+}
@@ -0,0 +1,70 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// pinPairer is a Pairer that accepts a fixed PIN
+type pinPairer struct {
+	pin string
+}
+
+func (p pinPairer) Backend() string { return "test" }
+
+func (p pinPairer) Pair(ctx context.Context, tv *TV, prompt PromptFunc) (Credentials, error) {
+	pin, err := prompt(ctx, Prompt{Kind: PromptPIN, TV: tv, Message: "Enter the PIN shown on " + tv.Name})
+	if err != nil {
+		return nil, err
+	}
+	if pin != p.pin {
+		return nil, ErrPairingRejected
+	}
+	return Credentials{"token": "secret-" + pin}, nil
+}
+
+// TestRegistryPair tests that pairing prompts once and persists the credentials
+func TestRegistryPair(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	reg, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatalf("LoadRegistry failed: %v", err)
+	}
+
+	tv := &TV{Name: "TV Salon", UDN: "uuid:salon"}
+	prompts := 0
+	prompt := func(ctx context.Context, p Prompt) (string, error) {
+		prompts++
+		if p.Kind != PromptPIN || p.TV != tv {
+			t.Errorf("Unexpected prompt: %+v", p)
+		}
+		return "1234", nil
+	}
+
+	for i := 0; i < 2; i++ {
+		creds, err := reg.Pair(context.Background(), tv, pinPairer{pin: "1234"}, prompt)
+		if err != nil {
+			t.Fatalf("Pair failed: %v", err)
+		}
+		if creds["token"] != "secret-1234" {
+			t.Errorf("Unexpected credentials: %v", creds)
+		}
+	}
+	if prompts != 1 {
+		t.Errorf("Expected 1 prompt, got %d", prompts)
+	}
+
+	reloaded, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatalf("LoadRegistry failed: %v", err)
+	}
+	if creds, err := reloaded.Credentials(tv, "test"); err != nil || creds["token"] != "secret-1234" {
+		t.Errorf("Expected persisted credentials, got %v", creds)
+	}
+
+	reloaded.RemoveCredentials(tv, "test")
+	if _, err := reloaded.Pair(context.Background(), tv, pinPairer{pin: "0000"}, prompt); err == nil {
+		t.Error("Expected pairing with a wrong PIN to fail")
+	}
+}
@@ -0,0 +1,106 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// ErrNotImage is returned when a payload doesn't contain a recognizable image
+var ErrNotImage = errors.New("payload is not an image")
+
+// ReadImagePayload reads an image that is either raw bytes or base64 text
+// (optionally a "data:image/...;base64," URI), as produced by
+// `screenshot-tool | smarttv image --stdin`. It returns the image bytes and
+// their sniffed MIME type.
+// Payloads over DefaultLimits return an error wrapping ErrImageTooLarge.
+func ReadImagePayload(r io.Reader) ([]byte, string, error) {
+	return readImagePayload(r, DefaultLimits)
+}
+
+// readImagePayload reads a payload within the limits l
+func readImagePayload(r io.Reader, l Limits) ([]byte, string, error) {
+	data, err := l.readPayload(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("read image: %w", err)
+	}
+	data, contentType, err := decodeImagePayload(data)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := l.Check(data); err != nil {
+		return nil, "", err
+	}
+	return data, contentType, nil
+}
+
+// decodeImagePayload sniffs raw image data, falling back to base64
+func decodeImagePayload(data []byte) ([]byte, string, error) {
+	if contentType := sniffImageType(data); strings.HasPrefix(contentType, "image/") {
+		return data, contentType, nil
+	}
+
+	text := strings.TrimSpace(string(data))
+	if strings.HasPrefix(text, "data:") {
+		if _, b64, ok := strings.Cut(text, ","); ok {
+			text = b64
+		}
+	}
+	text = strings.Join(strings.Fields(text), "")
+
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		decoded, err := enc.DecodeString(text)
+		if err != nil {
+			continue
+		}
+		if contentType := sniffImageType(decoded); strings.HasPrefix(contentType, "image/") {
+			return decoded, contentType, nil
+		}
+	}
+	return nil, "", ErrNotImage
+}
+
+// ImageFromRequest extracts an image from an HTTP request body: the first
+// file of a multipart/form-data upload, or a raw or base64 payload, within
+// DefaultLimits
+func ImageFromRequest(req *http.Request) ([]byte, string, error) {
+	mediaType, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return ReadImagePayload(req.Body)
+	}
+
+	mr := multipart.NewReader(req.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, "", ErrNotImage
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("read multipart: %w", err)
+		}
+		if part.FileName() == "" {
+			continue
+		}
+		return ReadImagePayload(part)
+	}
+}
+
+// DisplayImageData shows pre-encoded image data of the given MIME type
+// (e.g. from ReadImagePayload) on the TV. HEIC and AVIF data is transcoded
+// first, see WithImageDecoder.
+func (r *Renderer) DisplayImageData(ctx context.Context, tv *TV, data []byte, contentType string) error {
+	if err := r.limits.Check(data); err != nil {
+		return err
+	}
+	if _, ok := transcodedTypes[contentType]; ok {
+		return r.transcode(ctx, tv, data)
+	}
+	imageURL := r.server.StoreContent(data, contentType)
+	return r.showURL(ctx, tv, imageURL, contentType)
+}
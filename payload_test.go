@@ -0,0 +1,70 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestReadImagePayload tests raw, base64 and data URI payloads
+func TestReadImagePayload(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	raw := buf.Bytes()
+	b64 := base64.StdEncoding.EncodeToString(raw)
+
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{"raw", string(raw)},
+		{"base64", b64 + "\n"},
+		{"wrapped base64", b64[:20] + "\n" + b64[20:]},
+		{"data URI", "data:image/png;base64," + b64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, contentType, err := ReadImagePayload(strings.NewReader(tt.payload))
+			if err != nil {
+				t.Fatalf("ReadImagePayload failed: %v", err)
+			}
+			if contentType != "image/png" || !bytes.Equal(data, raw) {
+				t.Errorf("Expected the PNG back, got %s (%d bytes)", contentType, len(data))
+			}
+		})
+	}
+
+	if _, _, err := ReadImagePayload(strings.NewReader("hello")); !errors.Is(err, ErrNotImage) {
+		t.Errorf("Expected ErrNotImage, got %v", err)
+	}
+}
+
+// TestImageFromRequest tests extracting an uploaded file from a multipart form
+func TestImageFromRequest(t *testing.T) {
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("tv", "TV Salon")
+	fw, _ := mw.CreateFormFile("image", "frame.png")
+	fw.Write(img.Bytes())
+	mw.Close()
+
+	req, _ := http.NewRequest("POST", "/display", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	data, contentType, err := ImageFromRequest(req)
+	if err != nil {
+		t.Fatalf("ImageFromRequest failed: %v", err)
+	}
+	if contentType != "image/png" || !bytes.Equal(data, img.Bytes()) {
+		t.Errorf("Expected the uploaded PNG, got %s (%d bytes)", contentType, len(data))
+	}
+}
@@ -0,0 +1,77 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotPlaying is returned when a TV accepted Play but never started
+// playing, e.g. because it couldn't fetch or decode the content
+var ErrNotPlaying = errors.New("TV did not start playing")
+
+// playPollInterval is how often WaitForPlaying asks the TV for its state
+const playPollInterval = 250 * time.Millisecond
+
+// WithPlayVerification makes the renderer confirm that the TV is playing
+// after each Play, waiting up to timeout. Display and StreamVideo then
+// return ErrNotPlaying instead of success when the TV silently ignored
+// the content. TVs without GetTransportInfo are not checked.
+func WithPlayVerification(timeout time.Duration) Option {
+	return func(r *Renderer) {
+		r.verifyPlay = timeout
+	}
+}
+
+// WaitForPlaying polls GetTransportInfo until the TV reports PLAYING. It
+// returns ErrNotPlaying if the TV reports an error or is still not playing
+// after timeout, and nil right away for TVs that can't report their state.
+func (tv *TV) WaitForPlaying(ctx context.Context, timeout time.Duration) error {
+	if !tv.SupportsAction("GetTransportInfo") {
+		return nil
+	}
+
+	pollCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var last TransportInfo
+	for {
+		info, err := tv.GetTransportInfo(pollCtx)
+		switch {
+		case err == nil:
+			last = info
+			if info.State == "PLAYING" {
+				return nil
+			}
+			if info.Status == "ERROR_OCCURRED" {
+				return tv.wrapError("Play", tv.ControlURL, fmt.Errorf("%w: transport status %s", ErrNotPlaying, info.Status))
+			}
+		case errors.Is(err, ErrUnsupportedAction), IsUPnPError(err, 401):
+			// The SCPD didn't tell us, but the TV can't answer either
+			return nil
+		case pollCtx.Err() == nil:
+			return fmt.Errorf("get transport info: %w", err)
+		}
+
+		select {
+		case <-pollCtx.Done():
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if last.State == "" {
+				return tv.wrapError("Play", tv.ControlURL, fmt.Errorf("%w within %s", ErrNotPlaying, timeout))
+			}
+			return tv.wrapError("Play", tv.ControlURL, fmt.Errorf("%w within %s: state %s", ErrNotPlaying, timeout, last.State))
+		case <-time.After(playPollInterval):
+		}
+	}
+}
+
+// verifyPlaying checks that tv started playing if play verification is on
+func (r *Renderer) verifyPlaying(ctx context.Context, tv *TV) error {
+	if r.verifyPlay <= 0 {
+		return nil
+	}
+	return tv.WaitForPlaying(ctx, r.verifyPlay)
+}
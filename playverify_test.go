@@ -0,0 +1,72 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// transportStateTV returns a mock TV that reports the states in order for
+// GetTransportInfo, repeating the last one
+func transportStateTV(states ...string) *httptest.Server {
+	var polls atomic.Int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("SOAPAction"), "#GetTransportInfo") {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		state := states[min(int(polls.Add(1))-1, len(states)-1)]
+		fmt.Fprintf(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:GetTransportInfoResponse xmlns:u="urn:schemas-upnp-org:service:AVTransport:1"><CurrentTransportState>%s</CurrentTransportState><CurrentTransportStatus>OK</CurrentTransportStatus></u:GetTransportInfoResponse></s:Body></s:Envelope>`, state)
+	}))
+}
+
+// TestWaitForPlaying tests polling the TV until it plays
+func TestWaitForPlaying(t *testing.T) {
+	ctx := context.Background()
+
+	mockTV := transportStateTV("TRANSITIONING", "TRANSITIONING", "PLAYING")
+	defer mockTV.Close()
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+	if err := tv.WaitForPlaying(ctx, 5*time.Second); err != nil {
+		t.Errorf("Expected the TV to play, got %v", err)
+	}
+
+	idle := transportStateTV("STOPPED")
+	defer idle.Close()
+	tv = &TV{Name: "Test TV", ControlURL: idle.URL}
+	err := tv.WaitForPlaying(ctx, 300*time.Millisecond)
+	if !errors.Is(err, ErrNotPlaying) || !strings.Contains(err.Error(), "STOPPED") {
+		t.Errorf("Expected ErrNotPlaying with the last state, got %v", err)
+	}
+
+	// TVs that can't report their state are trusted
+	tv.Actions = []string{"SetAVTransportURI", "Play"}
+	if err := tv.WaitForPlaying(ctx, time.Second); err != nil {
+		t.Errorf("Expected no check without GetTransportInfo, got %v", err)
+	}
+}
+
+// TestPlayVerification tests that Display fails when the TV ignores Play
+func TestPlayVerification(t *testing.T) {
+	mockTV := transportStateTV("NO_MEDIA_PRESENT")
+	defer mockTV.Close()
+
+	renderer, err := NewRenderer(WithPlayVerification(300 * time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+	err = renderer.DisplayImage(context.Background(), tv, image.NewRGBA(image.Rect(0, 0, 8, 8)))
+	if !errors.Is(err, ErrNotPlaying) {
+		t.Errorf("Expected ErrNotPlaying, got %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// presentation is a session's content waiting on, or shown on, a TV
+type presentation struct {
+	session Session
+	content Content
+	seq     int
+	timer   *time.Timer // Ends the session (nil = none)
+}
+
+// stopTimer cancels the end of a timed presentation
+func (p *presentation) stopTimer() {
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+}
+
+// presentStack holds a TV's presented sessions; the highest priority (most
+// recent on ties) is on screen and the rest resume in turn
+type presentStack struct {
+	mu      sync.Mutex
+	entries []*presentation
+	seq     int
+}
+
+// top returns the entry that should be on screen (nil if none)
+func (s *presentStack) top() *presentation {
+	var best *presentation
+	for _, p := range s.entries {
+		if best == nil || p.session.Priority > best.session.Priority ||
+			(p.session.Priority == best.session.Priority && p.seq > best.seq) {
+			best = p
+		}
+	}
+	return best
+}
+
+// remove takes entry off the stack and reports whether it was on it
+func (s *presentStack) remove(entry *presentation) bool {
+	i := slices.Index(s.entries, entry)
+	if i < 0 {
+		return false
+	}
+	s.entries = slices.Delete(s.entries, i, i+1)
+	return true
+}
+
+// presentStackFor returns the TV's stack, creating it if needed
+func (r *Renderer) presentStackFor(tv *TV) *presentStack {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.presented[tv.ControlURL]
+	if !ok {
+		s = &presentStack{}
+		r.presented[tv.ControlURL] = s
+	}
+	return s
+}
+
+// Present shows content on the TV as part of ctx's session (see
+// WithSession), honoring Session.Priority: content outranked by what is on
+// screen is held back and shown once the higher-priority sessions End.
+// Presenting again under the same session name replaces its content.
+// It reports whether the content went on screen now. Content that fails
+// to show is taken off the stack again.
+//
+// For example, an alert presented at priority 10 preempts a slideshow at
+// priority 0, and the slideshow resumes when the alert ends.
+func (r *Renderer) Present(ctx context.Context, tv *TV, c Content) (bool, error) {
+	return r.present(ctx, tv, c, 0)
+}
+
+// PresentFor presents content like Present and ends its session after d,
+// e.g. for a timed emergency alert. Presenting or ending the session
+// before then cancels the timer.
+func (r *Renderer) PresentFor(ctx context.Context, tv *TV, c Content, d time.Duration) (bool, error) {
+	return r.present(ctx, tv, c, d)
+}
+
+// present is Present, ending the session after d unless d is 0
+func (r *Renderer) present(ctx context.Context, tv *TV, c Content, d time.Duration) (bool, error) {
+	session, _ := SessionFrom(ctx)
+	s := r.presentStackFor(tv)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	entry := &presentation{session: session, content: c, seq: s.seq}
+	var replaced *presentation
+	for i, p := range s.entries {
+		if p.session.Name == session.Name {
+			// Keep its place among equal priorities
+			entry.seq = p.seq
+			s.entries[i] = entry
+			replaced = p
+			break
+		}
+	}
+	if replaced == nil {
+		s.entries = append(s.entries, entry)
+	}
+
+	shown := s.top() == entry
+	if shown {
+		if err := r.Show(ctx, tv, c); err != nil {
+			// What was on screen still is
+			if replaced != nil {
+				s.entries[slices.Index(s.entries, entry)] = replaced
+			} else {
+				s.remove(entry)
+			}
+			return false, err
+		}
+	}
+
+	if replaced != nil {
+		replaced.stopTimer()
+	}
+	if d > 0 {
+		bg := context.WithoutCancel(ctx)
+		entry.timer = time.AfterFunc(d, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			r.pop(bg, tv, s, entry)
+		})
+	}
+	return shown, nil
+}
+
+// End removes a presented session from the TV. If it was on screen, the
+// highest-priority remaining session resumes, or the TV stops when none
+// is left.
+func (r *Renderer) End(ctx context.Context, tv *TV, sessionName string) error {
+	s := r.presentStackFor(tv)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.entries {
+		if p.session.Name == sessionName {
+			return r.pop(ctx, tv, s, p)
+		}
+	}
+	return nil
+}
+
+// pop removes entry from the stack and shows what is on top then. Call
+// with s.mu held.
+func (r *Renderer) pop(ctx context.Context, tv *TV, s *presentStack, entry *presentation) error {
+	current := s.top()
+	if !s.remove(entry) {
+		return nil
+	}
+	entry.stopTimer()
+
+	next := s.top()
+	switch {
+	case next == current:
+		return nil
+	case next == nil:
+		return r.Stop(ctx, tv)
+	default:
+		// Resume under the original session so State shows its name
+		return r.Show(WithSession(ctx, next.session), tv, next.content)
+	}
+}
@@ -0,0 +1,127 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestPresentPreemption tests that higher priority content preempts and the
+// preempted session resumes when it ends
+func TestPresentPreemption(t *testing.T) {
+	var mu sync.Mutex
+	var actions []string
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		soapAction := r.Header.Get("SOAPAction")
+		mu.Lock()
+		actions = append(actions, strings.Trim(soapAction[strings.Index(soapAction, "#")+1:], `"`))
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	tv := &TV{Name: "Lobby", ControlURL: mockTV.URL, Actions: []string{"SetAVTransportURI", "Play", "Stop"}}
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	ctx := context.Background()
+	slideshow := WithSession(ctx, Session{Name: "slideshow"})
+	alert := WithSession(ctx, Session{Name: "alert", Priority: 10})
+
+	present := func(ctx context.Context, text string, wantShown bool) {
+		t.Helper()
+		shown, err := renderer.Present(ctx, tv, Content{Text: text})
+		if err != nil {
+			t.Fatalf("Present failed: %v", err)
+		}
+		if shown != wantShown {
+			t.Errorf("Present(%q): expected shown=%v", text, wantShown)
+		}
+	}
+
+	present(slideshow, "SLIDE 1", true)
+	present(alert, "FIRE DRILL", true)
+	present(slideshow, "SLIDE 2", false)
+
+	if state := renderer.State(); state[0].Session.Name != "alert" {
+		t.Errorf("Expected the alert on screen, got %q", state[0].Session.Name)
+	}
+
+	if err := renderer.End(ctx, tv, "alert"); err != nil {
+		t.Fatalf("End failed: %v", err)
+	}
+	if state := renderer.State(); state[0].Session.Name != "slideshow" {
+		t.Errorf("Expected the slideshow to resume, got %q", state[0].Session.Name)
+	}
+
+	if err := renderer.End(ctx, tv, "slideshow"); err != nil {
+		t.Fatalf("End failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	got := strings.Join(actions, ",")
+	want := "SetAVTransportURI,Play,SetAVTransportURI,Play,SetAVTransportURI,Play,Stop"
+	if got != want {
+		t.Errorf("Expected actions %s, got %s", want, got)
+	}
+}
+
+// TestPresentForTimer tests that presenting a session again cancels its
+// timer, and that content failing to show is taken off the stack
+func TestPresentForTimer(t *testing.T) {
+	var failing atomic.Bool
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	tv := &TV{Name: "Lobby", ControlURL: mockTV.URL, Actions: []string{"SetAVTransportURI", "Play", "Stop"}}
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	ctx := context.Background()
+	alert := WithSession(ctx, Session{Name: "alert", Priority: 10})
+	if _, err := renderer.PresentFor(alert, tv, Content{Text: "DRILL"}, 50*time.Millisecond); err != nil {
+		t.Fatalf("PresentFor failed: %v", err)
+	}
+	if _, err := renderer.Present(alert, tv, Content{Text: "FIRE"}); err != nil {
+		t.Fatalf("Present failed: %v", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+
+	stack := renderer.presentStackFor(tv)
+	stack.mu.Lock()
+	if len(stack.entries) != 1 || stack.entries[0].content.Text != "FIRE" {
+		t.Errorf("The replaced presentation's timer ended the session: %d entries", len(stack.entries))
+	}
+	stack.mu.Unlock()
+
+	failing.Store(true)
+	urgent := WithSession(ctx, Session{Name: "urgent", Priority: 20})
+	if _, err := renderer.PresentFor(urgent, tv, Content{Text: "EVACUATE"}, time.Hour); err == nil {
+		t.Fatal("Expected PresentFor to fail")
+	}
+	stack.mu.Lock()
+	if len(stack.entries) != 1 || stack.entries[0].session.Name != "alert" {
+		t.Errorf("Content that failed to show stayed on the stack: %d entries", len(stack.entries))
+	}
+	stack.mu.Unlock()
+}
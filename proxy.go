@@ -0,0 +1,314 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// proxyTarget is a source the media proxy streams from
+type proxyTarget struct {
+	source    *url.URL
+	base      *url.URL // Where source redirected to, for relative paths
+	jar       http.CookieJar
+	authorize []func(req *http.Request) error
+	hls       *hlsCache       // Rewrite playlists and cache segments (nil = off)
+	record    *streamRecorder // Write what TVs fetch to a file (nil = off)
+	client    *http.Client    // Fetches the source (nil = proxyClient)
+}
+
+// ProxyOption configures how the media proxy fetches a source
+type ProxyOption func(*proxyTarget)
+
+// WithProxyHeader sends header with every request to the source, e.g. an
+// API key header
+func WithProxyHeader(header http.Header) ProxyOption {
+	header = header.Clone()
+	return WithProxyAuth(func(req *http.Request) error {
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		return nil
+	})
+}
+
+// WithProxyCookies sends cookies with requests to the source, e.g. a
+// session cookie of a logged-in browser. Cookies the source sets, for
+// example while redirecting through a login, are kept for later requests.
+func WithProxyCookies(cookies ...*http.Cookie) ProxyOption {
+	return func(t *proxyTarget) {
+		t.jar.SetCookies(t.source, cookies)
+	}
+}
+
+// WithBearerToken authorizes requests to the source with a bearer token
+func WithBearerToken(token string) ProxyOption {
+	return WithProxyHeader(http.Header{"Authorization": {"Bearer " + token}})
+}
+
+// WithProxyAuth calls fn on every request to the source before it is
+// sent, e.g. to add a token that is refreshed when it expires or to sign
+// the request. An error answers the TV with 502 Bad Gateway.
+func WithProxyAuth(fn func(req *http.Request) error) ProxyOption {
+	return func(t *proxyTarget) {
+		t.authorize = append(t.authorize, fn)
+	}
+}
+
+// proxyRequestHeaders are the request headers passed on to the source, so TVs can
+// seek (Range) and revalidate
+var proxyRequestHeaders = []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since", "User-Agent"}
+
+// proxyResponseHeaders are the response headers passed back to the TV
+var proxyResponseHeaders = []string{
+	"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges",
+	"ETag", "Last-Modified", "Cache-Control",
+}
+
+// proxyClient fetches proxied media. Streams can run for hours, so only
+// waiting for the response headers is limited.
+var proxyClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// Proxy returns a plain HTTP URL on this server that streams sourceURL,
+// for TVs that can't fetch HTTPS, follow redirects or send credentials.
+// Credentials for the source are given as options, e.g. WithBearerToken;
+// they are only sent to the source's host, not to other hosts the source
+// redirects to or its playlists list. Relative
+// URLs below the proxied one, such as the segments of an HLS playlist, are
+// proxied too. The URL works until Unproxy or Close.
+func (s *ImageServer) Proxy(sourceURL string, opts ...ProxyOption) (string, error) {
+	source, err := url.Parse(sourceURL)
+	if err != nil {
+		return "", fmt.Errorf("proxy: %w", err)
+	}
+	target, err := newProxyTarget(source, opts)
+	if err != nil {
+		return "", fmt.Errorf("proxy: %w", err)
+	}
+	if err := s.applyURLPolicy(context.Background(), &target); err != nil {
+		return "", fmt.Errorf("proxy: %w", err)
+	}
+
+	token := rand.Text()
+	s.mu.Lock()
+	s.proxies[token] = target
+	s.mu.Unlock()
+
+	return fmt.Sprintf("http://%s:%d%s/proxy/%s/%s", s.localIP, s.port, s.pathPrefix, token, url.PathEscape(proxyName(source))), nil
+}
+
+// Unproxy stops serving a URL returned by Proxy. TVs still fetching it
+// get 404 Not Found.
+func (s *ImageServer) Unproxy(proxied string) {
+	rest, ok := strings.CutPrefix(proxied, s.URL()+s.pathPrefix+"/proxy/")
+	if !ok {
+		return
+	}
+	token, _, _ := strings.Cut(rest, "/")
+	s.mu.Lock()
+	delete(s.proxies, token)
+	s.mu.Unlock()
+}
+
+// newProxyTarget checks a source URL and applies the proxy options
+func newProxyTarget(source *url.URL, opts []ProxyOption) (proxyTarget, error) {
+	if source.Scheme != "http" && source.Scheme != "https" {
+		return proxyTarget{}, fmt.Errorf("unsupported URL scheme %q", source.Scheme)
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return proxyTarget{}, err
+	}
+	target := proxyTarget{source: source, jar: jar}
+	for _, opt := range opts {
+		opt(&target)
+	}
+	return target, nil
+}
+
+// applyURLPolicy checks the source of target against the server's policy
+// and has it fetched through a client checking redirects and addresses
+func (s *ImageServer) applyURLPolicy(ctx context.Context, target *proxyTarget) error {
+	if s.urlPolicy == nil {
+		return nil
+	}
+	if err := s.urlPolicy.Check(ctx, target.source.String()); err != nil {
+		return err
+	}
+	target.client = s.urlPolicy.client(proxyClient)
+	return nil
+}
+
+// proxyName returns the file name of a proxied URL. It keeps the source's
+// name because some TVs decide by extension what they can play.
+func proxyName(source *url.URL) string {
+	name := path.Base(source.Path)
+	if name == "." || name == "/" {
+		return "media"
+	}
+	return name
+}
+
+// handleProxy streams a proxied source to the TV
+func (s *ImageServer) handleProxy(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, s.pathPrefix+"/proxy/")
+	token, name, _ := strings.Cut(rest, "/")
+
+	s.mu.RLock()
+	target, ok := s.proxies[token]
+	s.mu.RUnlock()
+	if !ok || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if id, ok := strings.CutPrefix(name, hlsSegmentDir); ok && target.hls != nil {
+		s.serveHLS(w, r, token, target, id)
+		return
+	}
+
+	// Paths other than the proxied file are relative to it, e.g. segments
+	source := target.source
+	main := name == proxyName(source)
+	if !main {
+		ref, err := url.Parse(name)
+		if err != nil || ref.IsAbs() || strings.HasPrefix(name, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		ref.RawQuery = r.URL.RawQuery
+		base := target.base
+		if base == nil {
+			base = source
+		}
+		source = base.ResolveReference(ref)
+	}
+
+	resp, err := target.fetch(r.Context(), r.Method, source, r.Header)
+	if err != nil {
+		http.Error(w, "proxy: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	if main {
+		// Unproxy may have revoked the token while the source was fetched
+		s.mu.Lock()
+		target.base = resp.Request.URL
+		if _, ok := s.proxies[token]; ok {
+			s.proxies[token] = target
+		}
+		s.mu.Unlock()
+	}
+
+	if target.hls != nil && isPlaylist(resp) {
+		s.servePlaylist(w, token, target, resp)
+		return
+	}
+
+	for _, h := range proxyResponseHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			w.Header().Set(h, v)
+		}
+	}
+	if w.Header().Get("Accept-Ranges") == "" && resp.StatusCode == http.StatusOK {
+		w.Header().Set("Accept-Ranges", "none")
+	}
+
+	// Videos outlast the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	body := io.Reader(resp.Body)
+	if start := rangeStart(resp); target.record != nil && main && r.Method == http.MethodGet && start >= 0 {
+		body = io.TeeReader(resp.Body, target.record.at(start))
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, body)
+}
+
+// fetch requests source, with the target's credentials if it is on the
+// proxied host, passing on the TV's request headers that matter for
+// seeking and caching (if any)
+func (t proxyTarget) fetch(ctx context.Context, method string, source *url.URL, from http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, source.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range proxyRequestHeaders {
+		if v := from.Get(h); v != "" {
+			req.Header.Set(h, v)
+		}
+	}
+	// Playlists may list absolute URLs on other hosts, e.g. a CDN, which
+	// must not see the source's credentials
+	var injected []string
+	if source.Host == t.source.Host {
+		before := req.Header.Clone()
+		for _, fn := range t.authorize {
+			if err := fn(req); err != nil {
+				return nil, err
+			}
+		}
+		for name, values := range req.Header {
+			if !slices.Equal(before[name], values) {
+				injected = append(injected, name)
+			}
+		}
+	}
+
+	client := *proxyClient
+	if t.client != nil {
+		client = *t.client
+	}
+	client.Jar = t.jar
+	client.CheckRedirect = t.checkRedirect(client.CheckRedirect, injected)
+	return client.Do(req)
+}
+
+// checkRedirect returns a redirect policy that drops the credential
+// headers named in injected from requests leaving the source's host, as
+// http.Client would pass custom headers on to any host. It then applies
+// check, or http.Client's default policy if check is nil.
+func (t proxyTarget) checkRedirect(check func(*http.Request, []*http.Request) error, injected []string) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if req.URL.Host != t.source.Host {
+			for _, name := range injected {
+				req.Header.Del(name)
+			}
+		}
+		if check != nil {
+			return check(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+}
+
+// Proxy returns a URL on the renderer's server that streams sourceURL to
+// TVs, e.g. to play an HTTPS video with StreamVideo (see ImageServer.Proxy)
+func (r *Renderer) Proxy(sourceURL string, opts ...ProxyOption) (string, error) {
+	return r.server.Proxy(sourceURL, opts...)
+}
+
+// Unproxy stops serving a URL returned by Proxy
+func (r *Renderer) Unproxy(proxied string) {
+	r.server.Unproxy(proxied)
+}
@@ -0,0 +1,260 @@
+package nimsforestsmarttv
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestProxy tests streaming an HTTPS source that redirects and needs
+// credentials, including HLS segments relative to where the playlist
+// redirected to and range requests
+func TestProxy(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// The CDN wants the session cookie it hands out while redirecting
+		if strings.HasPrefix(r.URL.Path, "/cdn/") {
+			if c, err := r.Cookie("cdn"); err != nil || c.Value != "ok" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+		}
+		switch r.URL.Path {
+		case "/live/index.m3u8":
+			http.SetCookie(w, &http.Cookie{Name: "cdn", Value: "ok", Path: "/"})
+			http.Redirect(w, r, "/cdn/live/index.m3u8", http.StatusFound)
+		case "/cdn/live/index.m3u8":
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			io.WriteString(w, "#EXTM3U\n#EXTINF:2,\nseg1.ts\n")
+		case "/cdn/live/seg1.ts":
+			http.ServeContent(w, r, "seg1.ts", time.Time{}, strings.NewReader("0123456789"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	saved := proxyClient
+	proxyClient = upstream.Client()
+	defer func() { proxyClient = saved }()
+
+	server, err := NewImageServer(WithPathPrefix("/smarttv"))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Close()
+
+	proxied, err := server.Proxy(upstream.URL+"/live/index.m3u8", WithBearerToken("secret"))
+	if err != nil {
+		t.Fatalf("Proxy failed: %v", err)
+	}
+	if !strings.HasPrefix(proxied, server.URL()+"/smarttv/proxy/") || !strings.HasSuffix(proxied, "/index.m3u8") {
+		t.Errorf("proxy URL = %s", proxied)
+	}
+
+	get := func(url, rangeHeader string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", url, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", url, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, body := get(proxied, "")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "seg1.ts") {
+		t.Fatalf("playlist: %d %q", resp.StatusCode, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/vnd.apple.mpegurl" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	segment := strings.TrimSuffix(proxied, "index.m3u8") + "seg1.ts"
+	resp, body = get(segment, "bytes=2-5")
+	if resp.StatusCode != http.StatusPartialContent || body != "2345" {
+		t.Errorf("segment range: %d %q, want 206 \"2345\"", resp.StatusCode, body)
+	}
+
+	if resp, _ := get(server.URL()+"/smarttv/proxy/unknown/index.m3u8", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown token: %d, want 404", resp.StatusCode)
+	}
+	server.Unproxy(proxied)
+	if resp, _ := get(segment, ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("after Unproxy: %d, want 404", resp.StatusCode)
+	}
+	if _, err := server.Proxy("file:///etc/passwd"); err == nil {
+		t.Error("Expected file URLs to be rejected")
+	}
+}
+
+// TestProxyCredentials tests headers, cookies and per-request auth sent to
+// the source
+func TestProxyCredentials(t *testing.T) {
+	var got *http.Request
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		io.WriteString(w, "video")
+	}))
+	defer upstream.Close()
+
+	server, err := NewImageServer()
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Close()
+
+	refreshes := 0
+	proxied, err := server.Proxy(upstream.URL+"/movie.mp4",
+		WithProxyHeader(http.Header{"X-Api-Key": {"k1"}}),
+		WithProxyCookies(&http.Cookie{Name: "session", Value: "s1"}),
+		WithProxyAuth(func(req *http.Request) error {
+			refreshes++
+			req.Header.Set("Authorization", "Bearer fresh")
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Proxy failed: %v", err)
+	}
+
+	for range 2 {
+		resp, err := http.Get(proxied)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if refreshes != 2 {
+		t.Errorf("auth called %d times, want once per request", refreshes)
+	}
+	if got.Header.Get("X-Api-Key") != "k1" || got.Header.Get("Authorization") != "Bearer fresh" {
+		t.Errorf("source got headers %v", got.Header)
+	}
+	if c, err := got.Cookie("session"); err != nil || c.Value != "s1" {
+		t.Errorf("source got cookies %v", got.Cookies())
+	}
+
+	failing, _ := server.Proxy(upstream.URL+"/movie.mp4", WithProxyAuth(func(*http.Request) error {
+		return errors.New("token expired")
+	}))
+	resp, err := http.Get(failing)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("failing auth: %d, want 502", resp.StatusCode)
+	}
+}
+
+// TestProxyRedirectCredentials tests that a source redirecting to another
+// host doesn't pass the credentials on to it
+func TestProxyRedirectCredentials(t *testing.T) {
+	var got *http.Request
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		io.WriteString(w, "video")
+	}))
+	defer other.Close()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "k1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, other.URL+"/movie.mp4", http.StatusFound)
+	}))
+	defer upstream.Close()
+
+	server, err := NewImageServer()
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Close()
+
+	proxied, err := server.Proxy(upstream.URL+"/movie.mp4",
+		WithProxyHeader(http.Header{"X-Api-Key": {"k1"}}),
+		WithBearerToken("secret"),
+		WithProxyAuth(func(req *http.Request) error {
+			req.Header.Set("X-Signature", "sig")
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Proxy failed: %v", err)
+	}
+
+	resp, err := http.Get(proxied)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || got == nil {
+		t.Fatalf("GET: %d, want 200 from the redirect target", resp.StatusCode)
+	}
+	for _, h := range []string{"X-Api-Key", "Authorization", "X-Signature"} {
+		if v := got.Header.Get(h); v != "" {
+			t.Errorf("redirect target got %s: %q", h, v)
+		}
+	}
+}
+
+// TestUnproxyDuringFetch tests that a proxy revoked while its source is
+// being fetched stays revoked
+func TestUnproxyDuringFetch(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "video")
+	}))
+	defer upstream.Close()
+
+	server, err := NewImageServer()
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Close()
+
+	proxied, err := server.Proxy(upstream.URL + "/movie.mp4")
+	if err != nil {
+		t.Fatalf("Proxy failed: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(proxied)
+		if err == nil {
+			resp.Body.Close()
+		}
+		done <- err
+	}()
+	<-started
+	server.Unproxy(proxied)
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+
+	resp, err := http.Get(proxied)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET after Unproxy: %d, want 404", resp.StatusCode)
+	}
+}
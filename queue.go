@@ -0,0 +1,132 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxQueued bounds the items an OfflineQueue keeps per TV; the oldest are
+// dropped first
+const maxQueued = 100
+
+// OfflineQueue stores content for TVs that are unreachable and delivers it
+// once the health checker sees them come back. Every item carries a TTL so
+// stale alerts are dropped instead of flashing hours later.
+type OfflineQueue struct {
+	renderer *Renderer
+	health   *HealthChecker
+
+	mu      sync.Mutex
+	pending map[string][]queuedContent
+}
+
+type queuedContent struct {
+	content Content
+	expires time.Time
+}
+
+// NewOfflineQueue creates a queue that flushes a TV's pending content
+// whenever health reports it online again. TVs with queued content are
+// watched by health, which must be running.
+func NewOfflineQueue(renderer *Renderer, health *HealthChecker) *OfflineQueue {
+	q := &OfflineQueue{
+		renderer: renderer,
+		health:   health,
+		pending:  make(map[string][]queuedContent),
+	}
+
+	health.OnChange(func(tv *TV, online bool) {
+		if online {
+			go q.Flush(context.Background(), tv)
+		}
+	})
+
+	return q
+}
+
+// Show displays content on the TV, or queues it for up to ttl when the TV
+// is unreachable. queued reports whether the content was queued.
+func (q *OfflineQueue) Show(ctx context.Context, tv *TV, c Content, ttl time.Duration) (queued bool, err error) {
+	err = q.renderer.Show(ctx, tv, c)
+	if err == nil || !isUnreachable(err) {
+		return false, err
+	}
+
+	q.Enqueue(tv, c, ttl)
+	return true, nil
+}
+
+// Enqueue stores content for later delivery to the TV. The TV counts as
+// offline until the health checker reaches it again, which flushes the
+// queue. At most 100 items are kept per TV.
+func (q *OfflineQueue) Enqueue(tv *TV, c Content, ttl time.Duration) {
+	now := time.Now()
+	q.mu.Lock()
+	items := slices.DeleteFunc(q.pending[tv.ControlURL], func(item queuedContent) bool {
+		return now.After(item.expires)
+	})
+	items = append(items, queuedContent{content: c, expires: now.Add(ttl)})
+	if len(items) > maxQueued {
+		items = items[len(items)-maxQueued:]
+	}
+	q.pending[tv.ControlURL] = items
+	q.mu.Unlock()
+
+	q.health.Watch(tv)
+	q.health.setOnline(tv, false)
+}
+
+// Pending returns how many unexpired items are queued for the TV
+func (q *OfflineQueue) Pending(tv *TV) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := 0
+	for _, item := range q.pending[tv.ControlURL] {
+		if time.Now().Before(item.expires) {
+			n++
+		}
+	}
+	return n
+}
+
+// Flush delivers the TV's unexpired queued content in order. Items that
+// fail because the TV is unreachable again are put back.
+func (q *OfflineQueue) Flush(ctx context.Context, tv *TV) error {
+	q.mu.Lock()
+	items := q.pending[tv.ControlURL]
+	delete(q.pending, tv.ControlURL)
+	q.mu.Unlock()
+
+	var errs []error
+	for i, item := range items {
+		if time.Now().After(item.expires) {
+			continue
+		}
+
+		err := q.renderer.Show(ctx, tv, item.content)
+		if err != nil && isUnreachable(err) {
+			// Gone again: requeue the rest for the next recovery
+			q.mu.Lock()
+			q.pending[tv.ControlURL] = append(items[i:], q.pending[tv.ControlURL]...)
+			q.mu.Unlock()
+			return err
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// isUnreachable reports whether err means the TV could not be contacted,
+// as opposed to the TV rejecting the command
+func isUnreachable(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
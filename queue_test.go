@@ -0,0 +1,116 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestOfflineQueue tests that content for an unreachable TV is queued and flushed later
+func TestOfflineQueue(t *testing.T) {
+	var requests atomic.Int32
+	var down atomic.Bool
+	down.Store(true)
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			// Drop the connection like an unreachable TV
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		requests.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	queue := NewOfflineQueue(renderer, NewHealthChecker(time.Minute))
+	ctx := context.Background()
+
+	queued, err := queue.Show(ctx, tv, Content{Text: "Hello"}, time.Hour)
+	if err != nil || !queued {
+		t.Fatalf("Expected content to be queued, got queued=%v err=%v", queued, err)
+	}
+	queue.Enqueue(tv, Content{Text: "Expired"}, -time.Second)
+	if n := queue.Pending(tv); n != 1 {
+		t.Errorf("Expected 1 pending item, got %d", n)
+	}
+
+	// TV comes back
+	down.Store(false)
+
+	if err := queue.Flush(ctx, tv); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("Expected SetAVTransportURI + Play for the one live item, got %d requests", n)
+	}
+	if n := queue.Pending(tv); n != 0 {
+		t.Errorf("Expected empty queue after flush, got %d", n)
+	}
+}
+
+// TestOfflineQueueHealth tests that the health checker flushes the queue
+// once the TV answers again, and that the queue is bounded
+func TestOfflineQueueHealth(t *testing.T) {
+	var requests atomic.Int32
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	jpeg := Content{JPEG: []byte{0xFF, 0xD8, 0xFF, 0xD9}}
+	health := NewHealthChecker(time.Minute)
+	queue := NewOfflineQueue(renderer, health)
+	for range maxQueued + 20 {
+		queue.Enqueue(tv, jpeg, -time.Second)
+	}
+	queue.Enqueue(tv, jpeg, time.Hour)
+	queue.mu.Lock()
+	n := len(queue.pending[tv.ControlURL])
+	queue.mu.Unlock()
+	if n != 1 {
+		t.Errorf("Expected expired items to be dropped, %d kept", n)
+	}
+	for range maxQueued + 20 {
+		queue.Enqueue(tv, jpeg, time.Hour)
+	}
+	if n := queue.Pending(tv); n != maxQueued {
+		t.Errorf("Expected %d pending items, got %d", maxQueued, n)
+	}
+	if health.Online(tv) {
+		t.Error("Expected a TV with queued content to count as offline")
+	}
+
+	// SetAVTransportURI + Play for every item once the TV is back
+	health.CheckAll(context.Background())
+	deadline := time.Now().Add(10 * time.Second)
+	for requests.Load() < 2*maxQueued && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := requests.Load(); n != 2*maxQueued {
+		t.Errorf("Expected the queue to be flushed when the TV came back, got %d requests", n)
+	}
+	if n := queue.Pending(tv); n != 0 {
+		t.Errorf("Expected an empty queue, %d left", n)
+	}
+}
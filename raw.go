@@ -0,0 +1,220 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+)
+
+// ErrNoRAWPreview is returned when a RAW file has no JPEG preview Go can
+// decode
+var ErrNoRAWPreview = errors.New("no embedded JPEG preview")
+
+// TIFF tags used to find the previews embedded in RAW files
+const (
+	tagCompression  = 0x0103
+	tagStripOffsets = 0x0111
+	tagOrientation  = 0x0112
+	tagStripCounts  = 0x0117
+	tagSubIFDs      = 0x014a
+	tagJPEGOffset   = 0x0201
+	tagJPEGLength   = 0x0202
+	compressionJPEG = 6
+
+	tiffHeaderBytes  = 8
+	ifdEntryBytes    = 12
+	maxIFDs          = 32
+	maxEntriesPerIFD = 1024
+	minPreviewBytes  = 1024
+)
+
+// RAWPreview is a JPEG embedded in a RAW photo
+type RAWPreview struct {
+	JPEG        []byte
+	Width       int
+	Height      int
+	Orientation int // EXIF orientation of the photo (1 = upright)
+}
+
+// ExtractRAWPreview returns the largest JPEG preview embedded in a
+// TIFF-based RAW photo (Canon CR2, Nikon NEF, Sony ARW and most DNGs).
+// Cameras store a full-size or near full-size preview, so photos can be
+// shown without converting the raw sensor data.
+func ExtractRAWPreview(data []byte) (RAWPreview, error) {
+	if len(data) < tiffHeaderBytes {
+		return RAWPreview{}, ErrNoRAWPreview
+	}
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(data, []byte("II*\x00")):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(data, []byte("MM\x00*")):
+		order = binary.BigEndian
+	default:
+		return RAWPreview{}, ErrNoRAWPreview
+	}
+
+	var best RAWPreview
+	orientation := 1
+	consider := func(offset, length uint32) {
+		end := uint64(offset) + uint64(length)
+		if length < minPreviewBytes || end > uint64(len(data)) {
+			return
+		}
+		candidate := data[offset:end]
+		// Lossless JPEG raw data fails here, as Go only reads baseline
+		// and progressive JPEG
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(candidate))
+		if err != nil || cfg.Width*cfg.Height <= best.Width*best.Height {
+			return
+		}
+		best = RAWPreview{JPEG: candidate, Width: cfg.Width, Height: cfg.Height}
+	}
+
+	// Walk the IFD chain and every sub-IFD, bounded against loops
+	queue := []uint32{order.Uint32(data[4:tiffHeaderBytes])}
+	seen := make(map[uint32]bool)
+	for len(queue) > 0 && len(seen) < maxIFDs {
+		offset := queue[0]
+		queue = queue[1:]
+		if offset < tiffHeaderBytes || seen[offset] || uint64(offset)+2 > uint64(len(data)) {
+			continue
+		}
+		seen[offset] = true
+
+		count := int(order.Uint16(data[offset:]))
+		entries := int(offset) + 2
+		if count > maxEntriesPerIFD || entries+count*ifdEntryBytes+4 > len(data) {
+			continue
+		}
+
+		var compression, jpegOffset, jpegLength uint32
+		var strips, stripCounts []uint32
+		for i := range count {
+			entry := data[entries+i*ifdEntryBytes:]
+			switch tag := order.Uint16(entry); tag {
+			case tagCompression:
+				compression = tiffValue(data, order, entry)[0]
+			case tagOrientation:
+				if len(seen) == 1 {
+					orientation = int(tiffValue(data, order, entry)[0])
+				}
+			case tagJPEGOffset:
+				jpegOffset = tiffValue(data, order, entry)[0]
+			case tagJPEGLength:
+				jpegLength = tiffValue(data, order, entry)[0]
+			case tagStripOffsets:
+				strips = tiffValue(data, order, entry)
+			case tagStripCounts:
+				stripCounts = tiffValue(data, order, entry)
+			case tagSubIFDs:
+				queue = append(queue, tiffValue(data, order, entry)...)
+			}
+		}
+
+		if jpegOffset > 0 {
+			consider(jpegOffset, jpegLength)
+		}
+		if compression == compressionJPEG && len(strips) == 1 && len(stripCounts) == 1 {
+			consider(strips[0], stripCounts[0])
+		}
+
+		next := order.Uint32(data[entries+count*ifdEntryBytes:])
+		queue = append(queue, next)
+	}
+
+	if best.JPEG == nil {
+		return RAWPreview{}, ErrNoRAWPreview
+	}
+	best.Orientation = orientation
+	return best, nil
+}
+
+// tiffValue reads the SHORT or LONG values of an IFD entry. Other types
+// read as a single zero.
+func tiffValue(data []byte, order binary.ByteOrder, entry []byte) []uint32 {
+	typ, count := order.Uint16(entry[2:]), order.Uint32(entry[4:])
+
+	size := 0
+	switch typ {
+	case 3: // SHORT
+		size = 2
+	case 4, 13: // LONG, IFD
+		size = 4
+	}
+	if size == 0 || count == 0 || count > maxEntriesPerIFD {
+		return []uint32{0}
+	}
+
+	raw := entry[8:12]
+	if total := int(count) * size; total > 4 {
+		offset := order.Uint32(entry[8:])
+		if uint64(offset)+uint64(total) > uint64(len(data)) {
+			return []uint32{0}
+		}
+		raw = data[offset : int(offset)+total]
+	}
+
+	values := make([]uint32, count)
+	for i := range values {
+		if size == 2 {
+			values[i] = uint32(order.Uint16(raw[i*2:]))
+		} else {
+			values[i] = order.Uint32(raw[i*4:])
+		}
+	}
+	return values
+}
+
+// decodeRAW decodes the preview of a RAW photo within limits, turned
+// upright
+func decodeRAW(data []byte, limits Limits) (image.Image, error) {
+	preview, err := ExtractRAWPreview(data)
+	if err != nil {
+		return nil, err
+	}
+	// The container's size says nothing about the preview's pixels
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(preview.JPEG))
+	if err != nil {
+		return nil, err
+	}
+	if err := limits.CheckDimensions(cfg.Width, cfg.Height); err != nil {
+		return nil, err
+	}
+	img, err := jpeg.Decode(bytes.NewReader(preview.JPEG))
+	if err != nil {
+		return nil, err
+	}
+	return orient(img, preview.Orientation), nil
+}
+
+// orient rotates an image upright according to its EXIF orientation.
+// Mirrored orientations, which cameras don't write, are left as they are.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation != 3 && orientation != 6 && orientation != 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if orientation != 3 {
+		w, h = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			sx, sy := x-b.Min.X, y-b.Min.Y
+			switch orientation {
+			case 3: // 180°
+				dst.Set(w-1-sx, h-1-sy, img.At(x, y))
+			case 6: // 90° clockwise
+				dst.Set(w-1-sy, sx, img.At(x, y))
+			case 8: // 90° counter-clockwise
+				dst.Set(sy, h-1-sx, img.At(x, y))
+			}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,185 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// noisyJPEG encodes a w x h image that doesn't compress to nothing
+func noisyJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7919 % 251)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// ifdEntry is a tag of a test TIFF with a single SHORT or LONG value
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	value uint32
+}
+
+// buildTIFF lays out a TIFF with IFD0 and one sub-IFD. Offsets of blobs are
+// filled in for entries whose value is blobOffset+index.
+func buildTIFF(order binary.ByteOrder, ifd0, sub []ifdEntry, blobs ...[]byte) []byte {
+	const blobOffset = 0x10000000
+
+	ifdSize := func(n int) int { return 2 + n*12 + 4 }
+	ifd0At := 8
+	subAt := ifd0At + ifdSize(len(ifd0)+1)
+	blobAt := []uint32{}
+	next := subAt + ifdSize(len(sub))
+	for _, b := range blobs {
+		blobAt = append(blobAt, uint32(next))
+		next += len(b)
+	}
+
+	var buf bytes.Buffer
+	if order == binary.LittleEndian {
+		buf.WriteString("II*\x00")
+	} else {
+		buf.WriteString("MM\x00*")
+	}
+	binary.Write(&buf, order, uint32(ifd0At))
+
+	writeIFD := func(entries []ifdEntry) {
+		binary.Write(&buf, order, uint16(len(entries)))
+		for _, e := range entries {
+			v := e.value
+			if v >= blobOffset {
+				v = blobAt[v-blobOffset]
+			}
+			binary.Write(&buf, order, e.tag)
+			binary.Write(&buf, order, e.typ)
+			binary.Write(&buf, order, uint32(1))
+			if e.typ == 3 {
+				binary.Write(&buf, order, uint16(v))
+				binary.Write(&buf, order, uint16(0))
+			} else {
+				binary.Write(&buf, order, v)
+			}
+		}
+		binary.Write(&buf, order, uint32(0))
+	}
+	writeIFD(append(ifd0, ifdEntry{tagSubIFDs, 4, uint32(subAt)}))
+	writeIFD(sub)
+	for _, b := range blobs {
+		buf.Write(b)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractRAWPreview(t *testing.T) {
+	thumb := noisyJPEG(t, 32, 24)
+	full := noisyJPEG(t, 64, 48)
+	const blob = 0x10000000
+
+	tests := []struct {
+		name  string
+		order binary.ByteOrder
+		ifd0  []ifdEntry
+		sub   []ifdEntry
+	}{
+		{
+			// Nikon: thumbnail in IFD0, large preview in a sub-IFD
+			name:  "NEF",
+			order: binary.BigEndian,
+			ifd0: []ifdEntry{
+				{tagOrientation, 3, 6},
+				{tagJPEGOffset, 4, blob}, {tagJPEGLength, 4, uint32(len(thumb))},
+			},
+			sub: []ifdEntry{{tagJPEGOffset, 4, blob + 1}, {tagJPEGLength, 4, uint32(len(full))}},
+		},
+		{
+			// Canon: full-size preview as a JPEG strip in IFD0
+			name:  "CR2",
+			order: binary.LittleEndian,
+			ifd0: []ifdEntry{
+				{tagOrientation, 3, 6},
+				{tagCompression, 3, compressionJPEG},
+				{tagStripOffsets, 4, blob + 1}, {tagStripCounts, 4, uint32(len(full))},
+			},
+			sub: []ifdEntry{{tagJPEGOffset, 4, blob}, {tagJPEGLength, 4, uint32(len(thumb))}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := buildTIFF(tt.order, tt.ifd0, tt.sub, thumb, full)
+			preview, err := ExtractRAWPreview(data)
+			if err != nil {
+				t.Fatalf("ExtractRAWPreview failed: %v", err)
+			}
+			if !bytes.Equal(preview.JPEG, full) || preview.Width != 64 || preview.Orientation != 6 {
+				t.Errorf("got %dx%d preview (%d bytes), orientation %d; want the 64x48 one, orientation 6",
+					preview.Width, preview.Height, len(preview.JPEG), preview.Orientation)
+			}
+
+			renderer, err := NewRenderer()
+			if err != nil {
+				t.Fatalf("Failed to create renderer: %v", err)
+			}
+			defer renderer.Close()
+			img, err := renderer.DecodeImage(data)
+			if err != nil {
+				t.Fatalf("DecodeImage failed: %v", err)
+			}
+			if b := img.Bounds(); b.Dx() != 48 || b.Dy() != 64 {
+				t.Errorf("decoded %v, want the preview turned upright (48x64)", b)
+			}
+		})
+	}
+
+	// A preview larger than the renderer's limits is refused before it is
+	// decoded
+	renderer, err := NewRenderer(WithLimits(Limits{MaxWidth: 100, MaxHeight: 100}))
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+	large := noisyJPEG(t, 400, 300)
+	data := buildTIFF(binary.LittleEndian, []ifdEntry{{tagJPEGOffset, 4, blob}, {tagJPEGLength, 4, uint32(len(large))}}, nil, large)
+	if _, err := renderer.DecodeImage(data); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("DecodeImage of an oversized preview: expected ErrImageTooLarge, got %v", err)
+	}
+
+	// A TIFF without previews, and a truncated one
+	empty := buildTIFF(binary.LittleEndian, []ifdEntry{{tagOrientation, 3, 1}}, nil)
+	for _, data := range [][]byte{empty, empty[:12], []byte("II*\x00")} {
+		if _, err := ExtractRAWPreview(data); !errors.Is(err, ErrNoRAWPreview) {
+			t.Errorf("Expected ErrNoRAWPreview, got %v", err)
+		}
+	}
+}
+
+func TestOrient(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	marker := color.RGBA{255, 0, 0, 255}
+	img.Set(0, 0, marker) // top left
+
+	tests := []struct {
+		orientation int
+		x, y        int // where the marker ends up
+	}{
+		{1, 0, 0},
+		{3, 2, 1},
+		{6, 1, 0},
+		{8, 0, 2},
+	}
+	for _, tt := range tests {
+		if got := orient(img, tt.orientation).At(tt.x, tt.y); got != color.Color(marker) {
+			t.Errorf("orientation %d: marker not at %d,%d", tt.orientation, tt.x, tt.y)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package nimsforestsmarttv
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RecordTo returns a copy of the session whose videos are recorded to the
+// file at path while TVs play them, e.g. for compliance records of what
+// public screens showed. The recording holds the bytes the TV was sent:
+// progressive videos keep their container, HLS streams are written as their
+// segments joined, which plays as MPEG-TS (or fragmented MP4). Streams are
+// cast through the media proxy to be recorded, with the segment cache on.
+// The file is closed when the TV stops or shows something else.
+//
+//	ctx = smarttv.WithSession(ctx, smarttv.Session{Name: "lobby"}.RecordTo("lobby.ts"))
+//	renderer.StreamVideo(ctx, tv, "https://example.com/live.m3u8", "")
+func (s Session) RecordTo(path string) Session {
+	s.record = path
+	return s
+}
+
+// streamRecorder writes what TVs fetch of one stream to a file. Writing
+// errors end the recording but never the TV's playback.
+type streamRecorder struct {
+	path string
+
+	mu       sync.Mutex
+	f        *os.File        // nil once closed
+	written  int64           // Bytes written of a progressive stream
+	segments map[string]bool // HLS segments written
+	proxies  []string        // Tokens of the proxies created to record
+	err      error
+}
+
+// recorder returns the recording to path, creating the file unless it is
+// already being recorded, e.g. when a KeepAlive casts the stream again
+func (s *ImageServer) recorder(path string) (*streamRecorder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rec, ok := s.recordings[path]; ok {
+		return rec, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	rec := &streamRecorder{path: path, f: f, segments: make(map[string]bool)}
+	s.recordings[path] = rec
+	return rec, nil
+}
+
+// stopRecording closes a recording
+func (s *ImageServer) stopRecording(rec *streamRecorder) error {
+	s.mu.Lock()
+	if s.recordings[rec.path] == rec {
+		delete(s.recordings, rec.path)
+	}
+	for _, token := range rec.proxies {
+		delete(s.proxies, token)
+	}
+	s.mu.Unlock()
+	return rec.close()
+}
+
+// recordStream attaches a recording to the stream at videoURL and returns
+// the URL the TV plays it from. Streams this server doesn't serve are
+// proxied first.
+func (s *ImageServer) recordStream(videoURL string, rec *streamRecorder) (string, error) {
+	local := s.URL() + s.pathPrefix
+	if rest, ok := strings.CutPrefix(videoURL, local+"/timeshift/"); ok {
+		token, _, _ := strings.Cut(rest, "/")
+		s.mu.RLock()
+		b, ok := s.timeshifts[token]
+		s.mu.RUnlock()
+		if ok {
+			b.mu.Lock()
+			b.recording = rec
+			b.mu.Unlock()
+			return videoURL, nil
+		}
+	}
+
+	rest, proxied := strings.CutPrefix(videoURL, local+"/proxy/")
+	if !proxied {
+		u, err := s.Proxy(videoURL)
+		if err != nil {
+			return "", err
+		}
+		videoURL = u
+		rest = strings.TrimPrefix(u, local+"/proxy/")
+	}
+	token, _, _ := strings.Cut(rest, "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	target, ok := s.proxies[token]
+	if !ok {
+		return "", fmt.Errorf("unknown proxy URL %s", videoURL)
+	}
+	if !proxied {
+		rec.mu.Lock()
+		rec.proxies = append(rec.proxies, token)
+		rec.mu.Unlock()
+	}
+	// Segments reach the recording only if they come through the proxy
+	if target.hls == nil {
+		WithSegmentCache(0)(&target)
+	}
+	target.record = rec
+	s.proxies[token] = target
+	return videoURL, nil
+}
+
+// segment appends an HLS segment the first time a TV fetches it
+func (rec *streamRecorder) segment(id string, data []byte) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.f == nil || rec.segments[id] {
+		return
+	}
+	rec.segments[id] = true
+	rec.write(data)
+}
+
+// at returns a writer for the bytes of a progressive stream starting at
+// offset start. Only bytes continuing the recording are written, so TVs
+// that read ahead or fetch the same range twice don't garble the file.
+func (rec *streamRecorder) at(start int64) io.Writer {
+	return &recordWriter{rec: rec, pos: start}
+}
+
+// write writes to the file; rec.mu must be held
+func (rec *streamRecorder) write(data []byte) {
+	if _, err := rec.f.Write(data); err != nil {
+		rec.err = err
+		rec.f.Close()
+		rec.f = nil
+	}
+}
+
+// close closes the file, returning the first error recording hit
+func (rec *streamRecorder) close() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.f != nil {
+		if err := rec.f.Close(); err != nil && rec.err == nil {
+			rec.err = err
+		}
+		rec.f = nil
+	}
+	return rec.err
+}
+
+// recordWriter writes one response of a progressive stream to a recording
+type recordWriter struct {
+	rec *streamRecorder
+	pos int64
+}
+
+func (w *recordWriter) Write(p []byte) (int, error) {
+	rec := w.rec
+	start, end := w.pos, w.pos+int64(len(p))
+	w.pos = end
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.f != nil && start <= rec.written && end > rec.written {
+		rec.write(p[rec.written-start:])
+		rec.written = end
+	}
+	return len(p), nil
+}
+
+// rangeStart returns where the body of a proxied response starts in the
+// source, or -1 for responses that aren't media
+func rangeStart(resp *http.Response) int64 {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return 0
+	case http.StatusPartialContent:
+		// Content-Range: bytes 100-199/1000
+		spec, ok := strings.CutPrefix(resp.Header.Get("Content-Range"), "bytes ")
+		if !ok {
+			return -1
+		}
+		first, _, _ := strings.Cut(spec, "-")
+		start, err := strconv.ParseInt(first, 10, 64)
+		if err != nil {
+			return -1
+		}
+		return start
+	}
+	return -1
+}
@@ -0,0 +1,131 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecordTo(t *testing.T) {
+	video := bytes.Repeat([]byte("0123456789"), 100)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/video.mp4":
+			http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(video))
+		case r.URL.Path == "/live.m3u8":
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			io.WriteString(w, "#EXTM3U\n#EXT-X-KEY:METHOD=NONE,URI=\"none.key\"\n")
+			for i := range 3 {
+				fmt.Fprintf(w, "#EXTINF:2,\nseg%d.ts\n", i)
+			}
+		case strings.HasPrefix(r.URL.Path, "/seg"):
+			io.WriteString(w, "<"+strings.TrimSuffix(r.URL.Path[1:], ".ts")+">")
+		default:
+			io.WriteString(w, "key")
+		}
+	}))
+	defer origin.Close()
+
+	var mu sync.Mutex
+	var uri string
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if v := soapArg(body, "CurrentURI"); v != "" {
+			mu.Lock()
+			uri = v
+			mu.Unlock()
+		}
+	}))
+	defer mockTV.Close()
+	tv := &TV{Name: "Lobby", ControlURL: mockTV.URL + "/control"}
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	get := func(url, rangeHeader string) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", url, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", url, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	cast := func(path, source string) string {
+		t.Helper()
+		ctx := WithSession(context.Background(), Session{Name: "lobby"}.RecordTo(path))
+		if err := renderer.StreamVideo(ctx, tv, source, ""); err != nil {
+			t.Fatalf("StreamVideo failed: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if !strings.HasPrefix(uri, renderer.ServerURL()+"/proxy/") {
+			t.Fatalf("TV got %s, want a proxy URL", uri)
+		}
+		return uri
+	}
+	dir := t.TempDir()
+
+	// Progressive: overlapping and repeated ranges are written once
+	mp4 := filepath.Join(dir, "lobby.mp4")
+	played := cast(mp4, origin.URL+"/video.mp4")
+	get(played, "bytes=0-99")
+	get(played, "bytes=50-499")
+	get(played, "bytes=700-")
+	get(played, "bytes=500-")
+	get(played, "")
+	if state := renderer.State(); len(state) != 1 || state[0].Recording != mp4 {
+		t.Errorf("State = %+v, want recording to %s", state, mp4)
+	}
+
+	// HLS: segments are joined in the order they were played; keys are left
+	// out
+	ts := filepath.Join(dir, "lobby.ts")
+	played = cast(ts, origin.URL+"/live.m3u8")
+	if data, _ := os.ReadFile(mp4); !bytes.Equal(data, video) {
+		t.Errorf("progressive recording has %d bytes, want the %d of the video", len(data), len(video))
+	}
+
+	resp, err := http.Get(played)
+	if err != nil {
+		t.Fatalf("GET playlist: %v", err)
+	}
+	playlist, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	for line := range strings.Lines(string(playlist)) {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#EXT-X-KEY") {
+			get(renderer.ServerURL()+strings.TrimSuffix(strings.SplitN(line, `URI="`, 2)[1], `"`), "")
+		} else if line != "" && !strings.HasPrefix(line, "#") {
+			get(renderer.ServerURL()+line, "")
+			get(renderer.ServerURL()+line, "")
+		}
+	}
+
+	if err := renderer.Stop(context.Background(), tv); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if data, _ := os.ReadFile(ts); string(data) != "<seg0><seg1><seg2>" {
+		t.Errorf("HLS recording = %q, want the segments joined", data)
+	}
+
+	if err := renderer.StreamVideo(WithSession(context.Background(), Session{}.RecordTo(filepath.Join(dir, "missing", "x.ts"))), tv, origin.URL+"/video.mp4", ""); err == nil {
+		t.Error("Expected an error recording to a missing directory")
+	}
+}
@@ -0,0 +1,431 @@
+package nimsforestsmarttv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Zone is a named set of TVs (e.g. "lobby") addressed as one group
+type Zone struct {
+	Name     string   `json:"name"`
+	Members  []string `json:"members"`             // TV names or UDNs
+	TimeZone string   `json:"time_zone,omitempty"` // IANA time zone, e.g. "Europe/Berlin"
+}
+
+// Registry is a persisted set of known TVs and zones.
+// It is safe for concurrent use.
+//
+// Pairing credentials, such as Samsung tokens and LG client keys, are saved
+// in plaintext in the registry file unless a CredentialStore is plugged in
+// with SetCredentialStore.
+type Registry struct {
+	mu   sync.RWMutex
+	path string
+
+	tvs   map[string]*TV // keyed by registryKey
+	zones map[string]*Zone
+	creds CredentialStore // pairing credentials, keyed by registryKey
+
+	// Zones and quirks set by Config.ApplyTo, which Save leaves out
+	zoneOverrides  map[string]zoneOverride   // keyed by lower-case name
+	quirkOverrides map[string]quirksOverride // keyed by registryKey
+}
+
+// zoneOverride is a zone set by the config and the saved zone it hides
+// (nil = none)
+type zoneOverride struct {
+	zone, saved *Zone
+}
+
+// quirksOverride are quirks set by the config and the saved ones they hide
+type quirksOverride struct {
+	quirks, saved Quirks
+}
+
+// registryFile is the on-disk JSON layout of a Registry
+type registryFile struct {
+	TVs         []TV              `json:"tvs"`
+	Zones       []Zone            `json:"zones"`
+	Credentials []credentialEntry `json:"credentials,omitempty"`
+}
+
+// credentialEntry is one TV's stored credentials for a backend
+type credentialEntry struct {
+	TV      string      `json:"tv"` // registryKey of the TV
+	Backend string      `json:"backend"`
+	Values  Credentials `json:"values"`
+}
+
+// DefaultRegistryPath returns the registry location in the user's config
+// directory (e.g. ~/.config/smarttv/registry.json)
+func DefaultRegistryPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("locate config directory: %w", err)
+	}
+	return filepath.Join(dir, "smarttv", "registry.json"), nil
+}
+
+// NewRegistry creates an empty in-memory registry. Save is a no-op.
+func NewRegistry() *Registry {
+	return &Registry{
+		tvs:            make(map[string]*TV),
+		zones:          make(map[string]*Zone),
+		creds:          newMemoryCredentialStore(),
+		zoneOverrides:  make(map[string]zoneOverride),
+		quirkOverrides: make(map[string]quirksOverride),
+	}
+}
+
+// LoadRegistry reads the registry stored at path. A missing file yields an
+// empty registry that will be created on Save.
+func LoadRegistry(path string) (*Registry, error) {
+	reg := NewRegistry()
+	reg.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return reg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read registry: %w", err)
+	}
+
+	var file registryFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse registry: %w", err)
+	}
+
+	for _, tv := range file.TVs {
+		reg.tvs[registryKey(&tv)] = &tv
+	}
+	// Registries written before slugs existed get them now
+	for _, tv := range file.TVs {
+		if tv.Slug == "" {
+			stored := reg.tvs[registryKey(&tv)]
+			stored.Slug = reg.newSlug(stored)
+		}
+	}
+	for _, zone := range file.Zones {
+		reg.zones[strings.ToLower(zone.Name)] = &zone
+	}
+	for _, entry := range file.Credentials {
+		reg.creds.Store(entry.TV, entry.Backend, entry.Values)
+	}
+
+	return reg, nil
+}
+
+// Save writes the registry back to the file it was loaded from
+func (reg *Registry) Save() error {
+	if reg.path == "" {
+		return nil
+	}
+
+	reg.mu.RLock()
+	var file registryFile
+	for key, tv := range reg.tvs {
+		saved := *tv
+		if o, ok := reg.quirkOverrides[key]; ok && saved.Quirks == o.quirks {
+			saved.Quirks = o.saved
+		}
+		file.TVs = append(file.TVs, saved)
+	}
+	for key, zone := range reg.zones {
+		if o, ok := reg.zoneOverrides[key]; ok && o.zone == zone {
+			zone = o.saved
+		}
+		if zone != nil {
+			file.Zones = append(file.Zones, *zone)
+		}
+	}
+	// Credentials are only written here while no other store is plugged in
+	if mem, ok := reg.creds.(*memoryCredentialStore); ok {
+		mem.mu.RLock()
+		for key, byBackend := range mem.creds {
+			for backend, creds := range byBackend {
+				file.Credentials = append(file.Credentials, credentialEntry{TV: key, Backend: backend, Values: creds})
+			}
+		}
+		mem.mu.RUnlock()
+	}
+	reg.mu.RUnlock()
+
+	sort.Slice(file.TVs, func(i, j int) bool { return file.TVs[i].Name < file.TVs[j].Name })
+	sort.Slice(file.Zones, func(i, j int) bool { return file.Zones[i].Name < file.Zones[j].Name })
+	sort.Slice(file.Credentials, func(i, j int) bool {
+		a, b := file.Credentials[i], file.Credentials[j]
+		return a.TV < b.TV || (a.TV == b.TV && a.Backend < b.Backend)
+	})
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode registry: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(reg.path), 0o755); err != nil {
+		return fmt.Errorf("create registry directory: %w", err)
+	}
+
+	// Write atomically so a crash never leaves a truncated registry.
+	// The file may hold pairing credentials, so keep it private.
+	tmp := reg.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write registry: %w", err)
+	}
+	return os.Rename(tmp, reg.path)
+}
+
+// registryKey identifies a TV across discoveries
+func registryKey(tv *TV) string {
+	if tv.UDN != "" {
+		return tv.UDN
+	}
+	return tv.ControlURL
+}
+
+// AddTV adds a TV to the registry or refreshes a known one. New TVs get a
+// unique slug; known ones keep theirs.
+func (reg *Registry) AddTV(tv TV) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	key := registryKey(&tv)
+	if known, ok := reg.tvs[key]; ok && known.Slug != "" {
+		tv.Slug = known.Slug
+	} else {
+		tv.Slug = reg.newSlug(&tv)
+	}
+	reg.tvs[key] = &tv
+}
+
+// newSlug returns a slug for the TV that no other TV in the registry uses.
+// reg.mu must be held.
+func (reg *Registry) newSlug(tv *TV) string {
+	key := registryKey(tv)
+	return uniqueSlug(Slugify(tv.Name), func(slug string) bool {
+		for k, other := range reg.tvs {
+			if k != key && other.Slug == slug {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// TVs returns all known TVs sorted by name
+func (reg *Registry) TVs() []*TV {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	tvs := make([]*TV, 0, len(reg.tvs))
+	for _, tv := range reg.tvs {
+		tvs = append(tvs, tv)
+	}
+	sort.Slice(tvs, func(i, j int) bool { return tvs[i].Name < tvs[j].Name })
+	return tvs
+}
+
+// Lookup finds a TV by UDN, name (case-insensitive) or slug
+func (reg *Registry) Lookup(nameOrID string) (*TV, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	return reg.lookup(nameOrID)
+}
+
+func (reg *Registry) lookup(nameOrID string) (*TV, bool) {
+	if tv, ok := reg.tvs[nameOrID]; ok {
+		return tv, true
+	}
+	for _, tv := range reg.tvs {
+		if tv.Matches(nameOrID) {
+			return tv, true
+		}
+	}
+	return nil, false
+}
+
+// SetZone creates or replaces a zone with the given members (TV names or
+// UDNs). A replaced zone keeps its time zone.
+func (reg *Registry) SetZone(name string, members ...string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	zone := &Zone{Name: name, Members: members}
+	if old, ok := reg.zones[strings.ToLower(name)]; ok {
+		zone.TimeZone = old.TimeZone
+	}
+	reg.zones[strings.ToLower(name)] = zone
+}
+
+// SetZoneTimeZone sets the IANA time zone of a zone's TVs, e.g.
+// "America/New_York" ("" = local time)
+func (reg *Registry) SetZoneTimeZone(name string, tz string) error {
+	if _, err := time.LoadLocation(tz); err != nil {
+		return fmt.Errorf("zone %q: %w", name, err)
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	zone, ok := reg.zones[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown zone %q", name)
+	}
+	zone.TimeZone = tz
+	if o, ok := reg.zoneOverrides[strings.ToLower(name)]; ok && o.zone == zone && o.saved != nil {
+		o.saved.TimeZone = tz
+	}
+	return nil
+}
+
+// overrideZone sets a zone like SetZone, but Save keeps writing the zone
+// it replaces (or none)
+func (reg *Registry) overrideZone(name string, members ...string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	key := strings.ToLower(name)
+	o := zoneOverride{zone: &Zone{Name: name, Members: members}, saved: reg.zones[key]}
+	if prev, ok := reg.zoneOverrides[key]; ok && prev.zone == o.saved {
+		o.saved = prev.saved
+	}
+	if o.saved != nil {
+		o.zone.TimeZone = o.saved.TimeZone
+	}
+	reg.zones[key] = o.zone
+	reg.zoneOverrides[key] = o
+}
+
+// overrideQuirks sets the quirks of a known TV, but Save keeps writing the
+// quirks they replace
+func (reg *Registry) overrideQuirks(tv *TV, q Quirks) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	key := registryKey(tv)
+	stored, ok := reg.tvs[key]
+	if !ok {
+		return
+	}
+	o := quirksOverride{quirks: q, saved: stored.Quirks}
+	if prev, ok := reg.quirkOverrides[key]; ok && prev.quirks == stored.Quirks {
+		o.saved = prev.saved
+	}
+	updated := *stored
+	updated.Quirks = q
+	reg.tvs[key] = &updated
+	reg.quirkOverrides[key] = o
+}
+
+// Location returns a TV's time zone: its own TimeZone, else that of the
+// first zone (by name) it belongs to, else time.Local
+func (reg *Registry) Location(tv *TV) *time.Location {
+	if loc, err := time.LoadLocation(tv.TimeZone); err == nil && tv.TimeZone != "" {
+		return loc
+	}
+	for _, zone := range reg.Zones() {
+		if zone.TimeZone == "" {
+			continue
+		}
+		for _, member := range zone.Members {
+			if tv.Matches(member) {
+				if loc, err := time.LoadLocation(zone.TimeZone); err == nil {
+					return loc
+				}
+			}
+		}
+	}
+	return time.Local
+}
+
+// RemoveZone deletes a zone
+func (reg *Registry) RemoveZone(name string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	delete(reg.zones, strings.ToLower(name))
+}
+
+// Zones returns all zones sorted by name
+func (reg *Registry) Zones() []Zone {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	zones := make([]Zone, 0, len(reg.zones))
+	for _, zone := range reg.zones {
+		zones = append(zones, *zone)
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].Name < zones[j].Name })
+	return zones
+}
+
+// Zone resolves a zone to its TVs. Members that are not in the registry
+// are reported as an error.
+func (reg *Registry) Zone(name string) ([]*TV, error) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	zone, ok := reg.zones[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown zone %q", name)
+	}
+
+	tvs := make([]*TV, 0, len(zone.Members))
+	for _, member := range zone.Members {
+		tv, ok := reg.lookup(member)
+		if !ok {
+			return nil, fmt.Errorf("zone %q: unknown TV %q", name, member)
+		}
+		tvs = append(tvs, tv)
+	}
+	return tvs, nil
+}
+
+// SetCredentialStore moves pairing credentials into store, e.g. a
+// FileCredentialStore to encrypt them at rest. Credentials held in the
+// registry file are copied over and dropped from it on the next Save.
+func (reg *Registry) SetCredentialStore(store CredentialStore) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if mem, ok := reg.creds.(*memoryCredentialStore); ok {
+		mem.mu.RLock()
+		defer mem.mu.RUnlock()
+		for key, byBackend := range mem.creds {
+			for backend, creds := range byBackend {
+				if err := store.Store(key, backend, creds); err != nil {
+					return fmt.Errorf("migrate credentials: %w", err)
+				}
+			}
+		}
+	}
+
+	reg.creds = store
+	return nil
+}
+
+// credentialStore returns the current credential store
+func (reg *Registry) credentialStore() CredentialStore {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	return reg.creds
+}
+
+// Credentials returns the TV's stored credentials for a backend, or
+// ErrNotPaired
+func (reg *Registry) Credentials(tv *TV, backend string) (Credentials, error) {
+	return reg.credentialStore().Load(registryKey(tv), backend)
+}
+
+// SetCredentials stores the TV's credentials for a backend
+func (reg *Registry) SetCredentials(tv *TV, backend string, creds Credentials) error {
+	return reg.credentialStore().Store(registryKey(tv), backend, creds)
+}
+
+// RemoveCredentials forgets the TV's credentials for a backend (unpairing it)
+func (reg *Registry) RemoveCredentials(tv *TV, backend string) error {
+	return reg.credentialStore().Delete(registryKey(tv), backend)
+}
@@ -0,0 +1,42 @@
+package nimsforestsmarttv
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestRegistryZones tests zone resolution and persistence across loads
+func TestRegistryZones(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+
+	reg, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatalf("LoadRegistry failed: %v", err)
+	}
+
+	reg.AddTV(TV{Name: "Lobby Left", UDN: "uuid:left", ControlURL: "http://10.0.0.2/ctl"})
+	reg.AddTV(TV{Name: "Lobby Right", UDN: "uuid:right", ControlURL: "http://10.0.0.3/ctl"})
+	reg.SetZone("Lobby", "lobby left", "uuid:right")
+
+	if err := reg.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	reloaded, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatalf("LoadRegistry failed: %v", err)
+	}
+
+	tvs, err := reloaded.Zone("lobby")
+	if err != nil {
+		t.Fatalf("Zone failed: %v", err)
+	}
+	if len(tvs) != 2 || tvs[0].Name != "Lobby Left" || tvs[1].Name != "Lobby Right" {
+		t.Errorf("Unexpected zone members: %v", tvs)
+	}
+
+	reloaded.SetZone("broken", "nobody")
+	if _, err := reloaded.Zone("broken"); err == nil {
+		t.Error("Expected error for zone with unknown member")
+	}
+}
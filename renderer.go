@@ -1,12 +1,13 @@
 package nimsforestsmarttv
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"image"
-	"image/jpeg"
+	"io"
 	"sync"
+	"time"
 )
 
 // Renderer is the high-level API for displaying content on Smart TVs.
@@ -27,32 +28,105 @@ type Renderer struct {
 	server *ImageServer
 	mu     sync.Mutex
 
-	// Text rendering options
-	textOpts TextOptions
+	// Defaults that can change with Configure, guarded by settingsMu
+	settingsMu sync.RWMutex
+	textOpts   TextOptions
+	encoder    Encoder
+	catalog    Catalog
+
+	// Resizer for scaled frames
+	resizer Resizer
+
+	// Finds the subject of photos when cropping (nil = center crop)
+	detector SubjectDetector
 
 	// Track active sessions per TV (for smooth updates)
 	activeTVs map[string]bool
+
+	// Per-TV command queues so commands to different TVs can run
+	// concurrently and commands to one TV run in order
+	tvLocks map[string]*tvQueue
+	busy    BusyPolicy
+
+	// Last frame shown per TV, for thumbnails and audits
+	lastFrame map[string]shownFrame
+
+	// How long to wait for the TV to report PLAYING after Play (0 = don't check)
+	verifyPlay time.Duration
+
+	// Smoothed SetURI+Play round trip per TV, used to send frames early
+	latency map[string]time.Duration
+
+	// Options for the embedded image server
+	serverOpts []ServerOption
+
+	// Display-to-fetch latency tracking
+	pending      map[string][]pendingFetch // by image path
+	fetchSamples map[string][]time.Duration
+	sloViolated  map[string]bool
+	slo          *LatencySLO
+	metrics      Metrics
+
+	// Per-TV quality adaptation (nil = off)
+	adaptive *AdaptiveQuality
+	quality  map[string]*adaptState
+
+	// Session currently shown per TV
+	sessions map[string]*SessionState
+
+	// Sessions passed to Present per TV, by priority
+	presented map[string]*presentStack
+
+	// Write-ahead log of intended state changes (nil = off)
+	journal *Journal
+
+	// Audit trail of what is sent to TVs (nil = off)
+	audit *AuditLog
+
+	// Progress of the frame stream last sent to each TV
+	streams map[string]StreamStatus
+
+	// When a stream frame was last journaled per TV
+	streamJournaled map[string]time.Time
+
+	// Decoders for image formats TVs can't show, by format name
+	decoders map[string]ImageDecoder
+
+	// Loudness PlayAudio normalizes WAV clips to in LUFS (nil = off)
+	loudness *float64
+
+	// Traces pipelines and the commands they send (nil = off)
+	tracer Tracer
+
+	// Checks media URLs taken from callers (nil = off)
+	urlPolicy *URLPolicy
+
+	// Caps images taken from callers
+	limits Limits
 }
 
 // Option configures a Renderer
 type Option func(*Renderer)
 
-// WithTextOptions sets the default text rendering options
+// WithTextOptions sets the default text rendering options. NewRenderer
+// fails if they don't pass TextOptions.Validate.
 func WithTextOptions(opts TextOptions) Option {
 	return func(r *Renderer) {
 		r.textOpts = opts
 	}
 }
 
-// NewRenderer creates a new Renderer with an embedded image server
-func NewRenderer(opts ...Option) (*Renderer, error) {
-	server, err := NewImageServer()
-	if err != nil {
-		return nil, fmt.Errorf("create image server: %w", err)
+// WithServerOptions configures the embedded image server,
+// e.g. WithServerOptions(WithAccessLogger(fn))
+func WithServerOptions(opts ...ServerOption) Option {
+	return func(r *Renderer) {
+		r.serverOpts = append(r.serverOpts, opts...)
 	}
+}
 
+// NewRenderer creates a new Renderer with an embedded image server
+func NewRenderer(opts ...Option) (*Renderer, error) {
 	r := &Renderer{
-		server: server,
 		textOpts: TextOptions{
 			FontSize:   100,
 			Width:      1920,
@@ -60,13 +134,43 @@ func NewRenderer(opts ...Option) (*Renderer, error) {
 			Color:      White,
 			Background: Black,
 		},
+		encoder:   JPEGEncoder{Quality: 85},
+		resizer:   BilinearResizer{},
+		limits:    DefaultLimits,
 		activeTVs: make(map[string]bool),
+		tvLocks:   make(map[string]*tvQueue),
+		latency:   make(map[string]time.Duration),
+		lastFrame: make(map[string]shownFrame),
+
+		pending:      make(map[string][]pendingFetch),
+		fetchSamples: make(map[string][]time.Duration),
+		sloViolated:  make(map[string]bool),
+		quality:      make(map[string]*adaptState),
+		sessions:     make(map[string]*SessionState),
+		presented:    make(map[string]*presentStack),
+		streams:      make(map[string]StreamStatus),
+
+		streamJournaled: make(map[string]time.Time),
 	}
 
 	for _, opt := range opts {
 		opt(r)
 	}
 
+	if err := r.textOpts.Validate(); err != nil {
+		return nil, err
+	}
+
+	serverOpts := append(r.serverOpts, withFetchHook(r.onFetch), WithClientResolver(r.knownTV))
+	if o, ok := r.metrics.(FetchObserver); ok {
+		serverOpts = append(serverOpts, withFetchObserver(o))
+	}
+	server, err := NewImageServer(serverOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("create image server: %w", err)
+	}
+	r.server = server
+
 	return r, nil
 }
 
@@ -78,26 +182,20 @@ func NewRenderer(opts ...Option) (*Renderer, error) {
 // The image remains displayed until another DisplayImage call or Stop.
 // Each call triggers a content switch which may cause a brief transition.
 //
+// The image is encoded with the renderer's Encoder (JPEG by default).
 // Note: Go's standard JPEG encoder may not be compatible with all TVs.
 // If you encounter "file not supported" errors, use DisplayImageJPEG with
-// JPEG data generated by ffmpeg+imagemagick for proper JFIF headers.
+// JPEG data generated by ffmpeg+imagemagick for proper JFIF headers, or
+// plug in a different encoder with WithEncoder.
 func (r *Renderer) DisplayImage(ctx context.Context, tv *TV, img image.Image) error {
-	// Convert to RGBA
-	bounds := img.Bounds()
-	rgba := image.NewRGBA(bounds)
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			rgba.Set(x, y, img.At(x, y))
-		}
-	}
-
-	// Encode as JPEG
-	var buf bytes.Buffer
-	if err := jpeg.Encode(&buf, rgba, &jpeg.Options{Quality: 85}); err != nil {
-		return fmt.Errorf("encode JPEG: %w", err)
+	_, span := r.startSpan(ctx, "smarttv.encode", tv)
+	imageURL, contentType, err := r.storeImageFor(tv, img)
+	endSpan(span, err)
+	if err != nil {
+		return err
 	}
 
-	return r.DisplayImageJPEG(ctx, tv, buf.Bytes())
+	return r.showURL(ctx, tv, imageURL, contentType)
 }
 
 // DisplayImageJPEG shows a static JPEG image on the TV.
@@ -107,23 +205,69 @@ func (r *Renderer) DisplayImage(ctx context.Context, tv *TV, img image.Image) er
 // For JVC and similar TVs that require JFIF-compliant JPEGs, generate
 // the JPEG using: ffmpeg -> imagemagick (magick convert)
 func (r *Renderer) DisplayImageJPEG(ctx context.Context, tv *TV, jpegData []byte) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
+	if err := r.limits.Check(jpegData); err != nil {
+		return err
+	}
 	// Store image on our server with unique URL
 	imageURL := r.server.Store(jpegData)
+	return r.showURL(ctx, tv, imageURL, "image/jpeg")
+}
+
+// DisplayJPEGReader shows a JPEG image read from r on the TV.
+// The data is streamed to the TV as it is read, so producers of unknown
+// length (e.g. a camera writing to stdin) don't have to buffer it first.
+// Streams longer than the renderer's Limits.MaxBytes are cut off.
+func (r *Renderer) DisplayJPEGReader(ctx context.Context, tv *TV, jpegReader io.Reader) error {
+	imageURL := r.server.StoreReader(jpegReader)
+	return r.showURL(ctx, tv, imageURL, "image/jpeg")
+}
+
+// showURL points the TV at an image already stored on our server
+func (r *Renderer) showURL(ctx context.Context, tv *TV, imageURL string, contentType string) (err error) {
+	ctx, span := r.startSpan(ctx, "smarttv.display", tv)
+	span.SetAttributes(Attribute{Key: "url.full", Value: imageURL})
+	defer func() { endSpan(span, err) }()
+
+	unlock, err := r.lockTV(ctx, tv)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := r.intend(ctx, tv, JournalCast, imageURL, contentType, ""); err != nil {
+		return err
+	}
+
 	tvKey := tv.ControlURL
+	start := time.Now()
+	r.expectFetch(tv, imageURL, start)
+
+	// Other protocols don't need the AVTransport tricks below
+	if tv.Protocol != ProtocolDLNA {
+		if err := r.device(tv).Load(ctx, Media{URL: imageURL, ContentType: contentType}); err != nil {
+			return err
+		}
+		r.shown(ctx, tv, imageURL, start)
+		return nil
+	}
+
+	res := r.imageRes(imageURL, contentType)
+
+	r.mu.Lock()
+	active := r.activeTVs[tvKey]
+	r.mu.Unlock()
 
 	// If we already have an active session, try SetNextAVTransportURI first
 	// This may provide smoother transitions without "connecting" message
-	if r.activeTVs[tvKey] {
+	if active && tv.SupportsAction("SetNextAVTransportURI") {
 		// Try to queue next image and trigger switch
-		err := tv.setNextAVTransportURI(ctx, imageURL)
+		err := tv.setNextAVTransportURI(ctx, imageURL, res)
 		if err == nil {
 			// Now set it as current and play to switch
-			if err := tv.setAVTransportURI(ctx, imageURL); err == nil {
+			if err := tv.setAVTransportURI(ctx, imageURL, res); err == nil {
 				// Don't call Play - just setting URI might be enough
 				// If TV doesn't update, we'll fall through to full reconnect next time
+				r.shown(ctx, tv, imageURL, start)
 				return nil
 			}
 		}
@@ -131,25 +275,163 @@ func (r *Renderer) DisplayImageJPEG(ctx context.Context, tv *TV, jpegData []byte
 	}
 
 	// Full connection: Set URI + Play
-	if err := tv.setAVTransportURI(ctx, imageURL); err != nil {
+	if err := tv.setAVTransportURI(ctx, imageURL, res); err != nil {
 		return fmt.Errorf("set URI: %w", err)
 	}
 
 	if err := tv.play(ctx); err != nil {
 		return fmt.Errorf("play: %w", err)
 	}
+	if err := r.verifyPlaying(ctx, tv); err != nil {
+		return err
+	}
 
+	r.mu.Lock()
 	r.activeTVs[tvKey] = true
+	r.mu.Unlock()
+	r.shown(ctx, tv, imageURL, start)
 	return nil
 }
 
+// shown records a frame the TV accepted
+func (r *Renderer) shown(ctx context.Context, tv *TV, imageURL string, start time.Time) {
+	r.recordLatency(tv.ControlURL, time.Since(start))
+	r.recordFrame(tv.ControlURL, imageURL)
+	r.recordSession(ctx, tv, "image")
+}
+
+// shownFrame is the image last shown on a TV
+type shownFrame struct {
+	img  storedImage
+	url  string
+	at   time.Time
+	tags []string
+}
+
+// recordFrame remembers the image last shown on a TV
+func (r *Renderer) recordFrame(tvKey string, imageURL string) {
+	img, ok := r.server.lookup(imageURL)
+	if !ok {
+		return
+	}
+
+	r.mu.Lock()
+	r.lastFrame[tvKey] = shownFrame{img: img, url: imageURL, at: time.Now()}
+	r.mu.Unlock()
+}
+
+// FrameInfo describes the frame last shown on a TV
+type FrameInfo struct {
+	ShownAt   time.Time // When the frame was sent to the TV
+	Tags      []string  // Tags of the Content shown (nil for direct Display calls)
+	FetchedAt time.Time // When the frame was last downloaded (zero if never)
+	FetchedBy string    // Client IP of that download
+	FetchedTV *TV       // TV at that IP (nil if unknown)
+
+	// Stream frames only (see DisplayFrameStream)
+	Seq        uint64    // Frame number (0 if not a stream frame)
+	CapturedAt time.Time // When the producer captured it
+}
+
+// LastFrame reports what was last shown on the TV and whether the TV
+// actually fetched it
+func (r *Renderer) LastFrame(tv *TV) (FrameInfo, bool) {
+	r.mu.Lock()
+	frame, ok := r.lastFrame[tv.ControlURL]
+	r.mu.Unlock()
+	if !ok {
+		return FrameInfo{}, false
+	}
+
+	info := FrameInfo{ShownAt: frame.at, Tags: frame.tags, Seq: frame.img.seq, CapturedAt: frame.img.capturedAt}
+	if fetch, ok := r.server.LastFetch(frame.url); ok {
+		info.FetchedAt = fetch.At
+		info.FetchedBy = fetch.ClientIP
+		info.FetchedTV = fetch.TV
+	}
+	return info, true
+}
+
+// recordLatency folds a new command round trip into the TV's moving average
+func (r *Renderer) recordLatency(tvKey string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prev, ok := r.latency[tvKey]
+	if !ok {
+		r.latency[tvKey] = d
+		return
+	}
+	r.latency[tvKey] = (prev*3 + d) / 4
+}
+
+// actionLatency returns the smoothed command round trip for a TV (0 if unknown)
+func (r *Renderer) actionLatency(tv *TV) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.latency[tv.ControlURL]
+}
+
+// Broadcast runs fn against every TV concurrently, e.g. for all TVs of a
+// zone. Failures are joined into one error naming each failed TV.
+func (r *Renderer) Broadcast(ctx context.Context, tvs []*TV, fn func(ctx context.Context, tv *TV) error) error {
+	return fanOut(ctx, tvs, fn)
+}
+
+// DisplayTextAll renders text once and displays it on every TV
+func (r *Renderer) DisplayTextAll(ctx context.Context, tvs []*TV, text string) error {
+	imageURL, contentType, err := r.storeImage(RenderText(text, r.defaultText()))
+	if err != nil {
+		return err
+	}
+
+	return fanOut(ctx, tvs, func(ctx context.Context, tv *TV) error {
+		return r.showURL(ctx, tv, imageURL, contentType)
+	})
+}
+
+// StopAll stops playback on every TV
+func (r *Renderer) StopAll(ctx context.Context, tvs []*TV) error {
+	return fanOut(ctx, tvs, r.Stop)
+}
+
+// fanOut runs fn against every TV concurrently and joins the failures,
+// naming the TV unless the error already carries a TVError
+func fanOut(ctx context.Context, tvs []*TV, fn func(ctx context.Context, tv *TV) error) error {
+	errs := make([]error, len(tvs))
+
+	var wg sync.WaitGroup
+	for i, tv := range tvs {
+		wg.Add(1)
+		go func(i int, tv *TV) {
+			defer wg.Done()
+			err := fn(ctx, tv)
+			var tvErr *TVError
+			if err != nil && !errors.As(err, &tvErr) {
+				err = fmt.Errorf("%s: %w", tv.Name, err)
+			}
+			errs[i] = err
+		}(i, tv)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
 // DisplayText renders text as an image and displays it on the TV
 func (r *Renderer) DisplayText(ctx context.Context, tv *TV, text string) error {
-	return r.DisplayTextWithOptions(ctx, tv, text, r.textOpts)
+	return r.DisplayTextWithOptions(ctx, tv, text, r.defaultText())
 }
 
-// DisplayTextWithOptions renders text with custom options and displays it
-func (r *Renderer) DisplayTextWithOptions(ctx context.Context, tv *TV, text string, opts TextOptions) error {
+// DisplayTextWithOptions renders text with custom options and displays it.
+// Invalid options are rejected with ErrInvalidTextOptions.
+func (r *Renderer) DisplayTextWithOptions(ctx context.Context, tv *TV, text string, opts TextOptions) (err error) {
+	ctx, span := r.startSpan(ctx, "smarttv.display_text", tv)
+	defer func() { endSpan(span, err) }()
+
+	if err := opts.Validate(); err != nil {
+		return err
+	}
 	img := RenderText(text, opts)
 	return r.DisplayImage(ctx, tv, img)
 }
@@ -163,12 +445,43 @@ func (r *Renderer) DisplayTextWithOptions(ctx context.Context, tv *TV, text stri
 //
 // Note: Many consumer TVs (including JVC VIDAA) do not support video
 // streaming via DLNA AVTransport. Use Static Image Mode for these TVs.
-func (r *Renderer) StreamVideo(ctx context.Context, tv *TV, videoURL string, title string) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+func (r *Renderer) StreamVideo(ctx context.Context, tv *TV, videoURL string, title string) (err error) {
+	ctx, span := r.startSpan(ctx, "smarttv.stream_video", tv)
+	span.SetAttributes(Attribute{Key: "url.full", Value: videoURL})
+	defer func() { endSpan(span, err) }()
+
+	if err := r.checkMediaURL(ctx, videoURL); err != nil {
+		return err
+	}
+	unlock, err := r.lockTV(ctx, tv)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	if title == "" {
-		title = "Video Stream"
+		title = r.message(MsgVideoStream)
+	}
+	if err := r.intend(ctx, tv, JournalVideo, videoURL, "", title); err != nil {
+		return err
+	}
+
+	var rec *streamRecorder
+	if session, _ := SessionFrom(ctx); session.record != "" {
+		if rec, err = r.server.recorder(session.record); err != nil {
+			return fmt.Errorf("record: %w", err)
+		}
+		if videoURL, err = r.server.recordStream(videoURL, rec); err != nil {
+			return fmt.Errorf("record: %w", err)
+		}
+	}
+
+	if tv.Protocol != ProtocolDLNA {
+		if err := r.device(tv).Load(ctx, Media{URL: videoURL, Title: title}); err != nil {
+			return err
+		}
+		r.recordVideo(ctx, tv, videoURL, title, rec)
+		return nil
 	}
 
 	// Set video URI with appropriate metadata
@@ -180,7 +493,11 @@ func (r *Renderer) StreamVideo(ctx context.Context, tv *TV, videoURL string, tit
 	if err := tv.play(ctx); err != nil {
 		return fmt.Errorf("play video: %w", err)
 	}
+	if err := r.verifyPlaying(ctx, tv); err != nil {
+		return err
+	}
 
+	r.recordVideo(ctx, tv, videoURL, title, rec)
 	return nil
 }
 
@@ -189,8 +506,25 @@ func (r *Renderer) StreamVideo(ctx context.Context, tv *TV, videoURL string, tit
 // =============================================================================
 
 // Stop stops playback on the TV
-func (r *Renderer) Stop(ctx context.Context, tv *TV) error {
-	return tv.stop(ctx)
+func (r *Renderer) Stop(ctx context.Context, tv *TV) (err error) {
+	ctx, span := r.startSpan(ctx, "smarttv.stop", tv)
+	defer func() { endSpan(span, err) }()
+
+	// Don't cut into a SetAVTransportURI/Play sequence in progress
+	unlock, err := r.lockTV(ctx, tv)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := r.intend(ctx, tv, JournalStop, "", "", ""); err != nil {
+		return err
+	}
+	if err := r.device(tv).Stop(ctx); err != nil {
+		return err
+	}
+	r.clearSession(tv)
+	return nil
 }
 
 // Close shuts down the renderer and its image server
@@ -198,6 +532,18 @@ func (r *Renderer) Close() error {
 	return r.server.Close()
 }
 
+// Done is closed when the embedded image server stops, e.g. after Close or
+// when it failed and TVs can no longer fetch frames
+func (r *Renderer) Done() <-chan struct{} {
+	return r.server.Done()
+}
+
+// Err returns why the embedded image server stopped, or nil while it runs
+// and after Close
+func (r *Renderer) Err() error {
+	return r.server.Err()
+}
+
 // ServerURL returns the URL of the embedded image server
 func (r *Renderer) ServerURL() string {
 	return r.server.URL()
@@ -219,6 +565,9 @@ func (r *Renderer) DisplayJPEG(ctx context.Context, tv *TV, jpegData []byte) err
 
 // DisplayHLS is deprecated. Use StreamVideo instead.
 func (r *Renderer) DisplayHLS(ctx context.Context, tv *TV, hlsURL string, title string) error {
+	if title == "" {
+		title = r.message(MsgHLSStream)
+	}
 	return r.StreamVideo(ctx, tv, hlsURL, title)
 }
 
@@ -0,0 +1,110 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Role is what a web UI user may do. Each role may also do everything the
+// roles below it may.
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"   // Sees the TVs, their state and screenshots
+	RoleOperator Role = "operator" // Also shows content on TVs and stops them
+	RoleAdmin    Role = "admin"    // Also configures zones
+)
+
+var roleRank = map[Role]int{RoleViewer: 1, RoleOperator: 2, RoleAdmin: 3}
+
+// Valid reports whether r is one of the known roles
+func (r Role) Valid() bool {
+	return roleRank[r] > 0
+}
+
+// Allows reports whether r may do what need may
+func (r Role) Allows(need Role) bool {
+	return r.Valid() && roleRank[r] >= roleRank[need]
+}
+
+// WebUIUser is someone allowed to use the web UI API, identified by the
+// token they send as "Authorization: Bearer TOKEN"
+type WebUIUser struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	Role  Role   `json:"role"`
+}
+
+// WebUIOption configures a WebUI
+type WebUIOption func(*webUIConfig)
+
+type webUIConfig struct {
+	users     []WebUIUser
+	anonymous Role
+}
+
+// WithWebUIUsers adds users of the API. Once there are any, requests
+// without a known token are refused, unless WithWebUIAnonymous gives them
+// a role. Without users everyone is an admin, as suits a household.
+func WithWebUIUsers(users ...WebUIUser) WebUIOption {
+	return func(c *webUIConfig) {
+		c.users = append(c.users, users...)
+	}
+}
+
+// WithWebUIAnonymous sets the role of requests without a token when there
+// are users, e.g. RoleViewer for a screen in the hallway
+func WithWebUIAnonymous(role Role) WebUIOption {
+	return func(c *webUIConfig) {
+		c.anonymous = role
+	}
+}
+
+type webUIUserKey struct{}
+
+// authenticate returns the user making the request. Anonymous users have
+// no name.
+func (c webUIConfig) authenticate(req *http.Request) (WebUIUser, bool) {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		switch {
+		case len(c.users) == 0:
+			return WebUIUser{Role: RoleAdmin}, true
+		case c.anonymous.Valid():
+			return WebUIUser{Role: c.anonymous}, true
+		}
+		return WebUIUser{}, false
+	}
+	for _, user := range c.users {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(user.Token)) == 1 {
+			return user, true
+		}
+	}
+	return WebUIUser{}, false
+}
+
+// authorize wraps h so only users whose role allows need reach it. The user
+// is put in the request's context.
+func (c webUIConfig) authorize(need Role, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := c.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="smarttv"`)
+			writeJSONError(w, http.StatusUnauthorized, "unknown or missing token")
+			return
+		}
+		if !user.Role.Allows(need) {
+			writeJSONError(w, http.StatusForbidden, "needs the "+string(need)+" role")
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), webUIUserKey{}, user)))
+	}
+}
+
+// webUIUserFrom returns the user authorized for the request's context
+func webUIUserFrom(ctx context.Context) WebUIUser {
+	user, _ := ctx.Value(webUIUserKey{}).(WebUIUser)
+	return user
+}
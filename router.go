@@ -0,0 +1,153 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNoRoute is returned by Publish when no rule matches the content
+var ErrNoRoute = errors.New("no routing rule matches content")
+
+// Rule decides which TVs receive matching content. All conditions that
+// are set must hold for the rule to match.
+type Rule struct {
+	Name string
+
+	// Tags matches content carrying any of these tags (empty: any content)
+	Tags []string
+
+	// From and Until limit the rule to a daily window, as offsets since
+	// local midnight. Windows may wrap past midnight (From > Until).
+	// Both zero means all day.
+	From, Until time.Duration
+
+	// Require filters target TVs by capability, e.g.
+	// func(tv *TV) bool { return tv.SupportsAction("Play") }
+	Require func(tv *TV) bool
+
+	// Targets: a zone from the registry and/or individual TV names
+	Zone string
+	TVs  []string
+}
+
+// Router fans published content out to TVs according to rules
+type Router struct {
+	renderer *Renderer
+	registry *Registry
+	rules    []Rule
+
+	now func() time.Time
+}
+
+// NewRouter creates a router resolving zones and TV names via registry
+func NewRouter(renderer *Renderer, registry *Registry, rules ...Rule) *Router {
+	return &Router{
+		renderer: renderer,
+		registry: registry,
+		rules:    rules,
+		now:      time.Now,
+	}
+}
+
+// Route returns the TVs that should receive content: the union of the
+// targets of every matching rule
+func (rt *Router) Route(c Content) ([]*TV, error) {
+	var tvs []*TV
+	seen := make(map[string]bool)
+	matched := false
+
+	for _, rule := range rt.rules {
+		if !rule.matches(c, rt.now()) {
+			continue
+		}
+		matched = true
+
+		targets, err := rt.targets(rule)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		for _, tv := range targets {
+			if seen[tv.ControlURL] || (rule.Require != nil && !rule.Require(tv)) {
+				continue
+			}
+			seen[tv.ControlURL] = true
+			tvs = append(tvs, tv)
+		}
+	}
+
+	if !matched {
+		return nil, ErrNoRoute
+	}
+	return tvs, nil
+}
+
+// Publish routes content and shows it on every selected TV concurrently
+func (rt *Router) Publish(ctx context.Context, c Content) error {
+	tvs, err := rt.Route(c)
+	if err != nil {
+		return err
+	}
+
+	return fanOut(ctx, tvs, func(ctx context.Context, tv *TV) error {
+		return rt.renderer.Show(ctx, tv, c)
+	})
+}
+
+// targets resolves a rule's zone and TV names
+func (rt *Router) targets(rule Rule) ([]*TV, error) {
+	var tvs []*TV
+	if rule.Zone != "" {
+		zone, err := rt.registry.Zone(rule.Zone)
+		if err != nil {
+			return nil, err
+		}
+		tvs = append(tvs, zone...)
+	}
+
+	for _, name := range rule.TVs {
+		tv, ok := rt.registry.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown TV %q", name)
+		}
+		tvs = append(tvs, tv)
+	}
+	return tvs, nil
+}
+
+// matches checks the rule's tag and time-of-day conditions
+func (rule Rule) matches(c Content, now time.Time) bool {
+	if len(rule.Tags) > 0 {
+		tagged := false
+		for _, tag := range rule.Tags {
+			if c.HasTag(tag) {
+				tagged = true
+				break
+			}
+		}
+		if !tagged {
+			return false
+		}
+	}
+
+	return inDailyWindow(rule.From, rule.Until, now)
+}
+
+// inDailyWindow reports whether now falls in the daily window [from, until),
+// given as offsets since local midnight. Both zero means all day.
+func inDailyWindow(from, until time.Duration, now time.Time) bool {
+	if from == 0 && until == 0 {
+		return true
+	}
+
+	// The wall clock, not the time elapsed since midnight, which is an
+	// hour off on days the clocks change
+	h, m, s := now.Clock()
+	offset := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second + time.Duration(now.Nanosecond())
+	if from <= until {
+		return offset >= from && offset < until
+	}
+	// Window wraps past midnight (e.g. 22:00 - 06:00)
+	return offset >= from || offset < until
+}
@@ -0,0 +1,141 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRouterRoute tests tag, time window and capability routing
+func TestRouterRoute(t *testing.T) {
+	reg := NewRegistry()
+	reg.AddTV(TV{Name: "Lobby", UDN: "uuid:lobby", ControlURL: "http://10.0.0.2/ctl"})
+	reg.AddTV(TV{Name: "Office", UDN: "uuid:office", ControlURL: "http://10.0.0.3/ctl", Actions: []string{"SetAVTransportURI"}})
+	reg.SetZone("all", "Lobby", "Office")
+
+	router := NewRouter(nil, reg,
+		Rule{Name: "alerts", Tags: []string{"alert"}, Zone: "all"},
+		Rule{Name: "night", Tags: []string{"menu"}, From: 22 * time.Hour, Until: 6 * time.Hour, TVs: []string{"Lobby"}},
+		Rule{Name: "video", Tags: []string{"video"}, Zone: "all", Require: func(tv *TV) bool { return tv.SupportsAction("Play") }},
+	)
+	router.now = func() time.Time { return time.Date(2026, 1, 1, 23, 0, 0, 0, time.Local) }
+
+	tests := []struct {
+		name     string
+		tags     []string
+		expected []string
+	}{
+		{"alert goes everywhere", []string{"alert"}, []string{"Lobby", "Office"}},
+		{"menu at night", []string{"menu"}, []string{"Lobby"}},
+		{"video only where Play is supported", []string{"video"}, []string{"Lobby"}},
+		{"union without duplicates", []string{"alert", "menu"}, []string{"Lobby", "Office"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tvs, err := router.Route(Content{Tags: tt.tags, Text: "x"})
+			if err != nil {
+				t.Fatalf("Route failed: %v", err)
+			}
+			var names []string
+			for _, tv := range tvs {
+				names = append(names, tv.Name)
+			}
+			if len(names) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, names)
+			}
+			for i := range names {
+				if names[i] != tt.expected[i] {
+					t.Errorf("Expected %v, got %v", tt.expected, names)
+				}
+			}
+		})
+	}
+
+	router.now = func() time.Time { return time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local) }
+	if _, err := router.Route(Content{Tags: []string{"menu"}}); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("Expected ErrNoRoute outside the window, got %v", err)
+	}
+}
+
+// TestInDailyWindowDST tests that windows follow the wall clock on the
+// days the clocks change
+func TestInDailyWindowDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("No time zone data: %v", err)
+	}
+	// Clocks went forward at 02:00, so 10:00 is only 9 hours after midnight
+	springForward := time.Date(2026, 3, 29, 10, 30, 0, 0, berlin)
+	if !inDailyWindow(10*time.Hour, 11*time.Hour, springForward) {
+		t.Error("10:30 not in the 10:00-11:00 window on the day DST starts")
+	}
+	// Clocks went back at 03:00, so 10:30 is 11.5 hours after midnight
+	fallBack := time.Date(2026, 10, 25, 10, 30, 0, 0, berlin)
+	if !inDailyWindow(10*time.Hour, 11*time.Hour, fallBack) {
+		t.Error("10:30 not in the 10:00-11:00 window on the day DST ends")
+	}
+}
+
+// TestRouterPublish tests that published content reaches the routed TVs
+// only, and nothing is sent outside a rule's daily window
+func TestRouterPublish(t *testing.T) {
+	var mu sync.Mutex
+	loaded := make(map[string]int)
+	newMock := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(io.Discard, r.Body)
+			if strings.Contains(r.Header.Get("SOAPAction"), "#SetAVTransportURI") {
+				mu.Lock()
+				loaded[name]++
+				mu.Unlock()
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+	lobby := newMock("Lobby")
+	defer lobby.Close()
+	office := newMock("Office")
+	defer office.Close()
+
+	reg := NewRegistry()
+	reg.AddTV(TV{Name: "Lobby", UDN: "uuid:lobby", ControlURL: lobby.URL})
+	reg.AddTV(TV{Name: "Office", UDN: "uuid:office", ControlURL: office.URL})
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	router := NewRouter(renderer, reg,
+		Rule{Name: "menu", Tags: []string{"menu"}, From: 11 * time.Hour, Until: 14 * time.Hour, TVs: []string{"Lobby"}},
+	)
+	ctx := context.Background()
+
+	router.now = func() time.Time { return time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local) }
+	if err := router.Publish(ctx, Content{Tags: []string{"menu"}, Text: "Soup"}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	mu.Lock()
+	if loaded["Lobby"] != 1 || loaded["Office"] != 0 {
+		t.Errorf("Loaded %v, want the lobby only", loaded)
+	}
+	mu.Unlock()
+
+	router.now = func() time.Time { return time.Date(2026, 1, 1, 18, 0, 0, 0, time.Local) }
+	if err := router.Publish(ctx, Content{Tags: []string{"menu"}, Text: "Soup"}); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("Expected ErrNoRoute outside the window, got %v", err)
+	}
+	mu.Lock()
+	if loaded["Lobby"] != 1 {
+		t.Errorf("Lobby loaded %d times, want nothing sent outside the window", loaded["Lobby"])
+	}
+	mu.Unlock()
+}
@@ -0,0 +1,450 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// emptySHA256 is the hex SHA-256 of an empty request body
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Source is a bucket (or a prefix of one) on Amazon S3 or an S3
+// compatible store such as MinIO. Requests are signed with AWS Signature
+// Version 4; without an access key they are sent anonymously.
+type S3Source struct {
+	Endpoint  string // e.g. "http://minio:9000" (default https://s3.REGION.amazonaws.com)
+	Region    string // Default "us-east-1"
+	Bucket    string
+	Prefix    string // Only objects whose key starts with Prefix
+	AccessKey string
+	SecretKey string
+	PathStyle bool // Address the bucket in the path, as MinIO needs, instead of the host name
+
+	// HTTP client for requests (default http.DefaultClient)
+	Client *http.Client
+}
+
+// S3Object describes an object in a bucket
+type S3Object struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+}
+
+// s3Error is the error document returned by S3
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// List returns the objects under the source's prefix
+func (s S3Source) List(ctx context.Context) ([]S3Object, error) {
+	var objects []S3Object
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.Prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		body, err := s.do(ctx, "", query)
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %w", s.Bucket, err)
+		}
+
+		var result struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				ETag         string    `xml:"ETag"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("list %s: parse response: %w", s.Bucket, err)
+		}
+		for _, c := range result.Contents {
+			objects = append(objects, S3Object{Key: c.Key, Size: c.Size, ETag: strings.Trim(c.ETag, `"`), LastModified: c.LastModified})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Get downloads an object
+func (s S3Source) Get(ctx context.Context, key string) ([]byte, error) {
+	body, err := s.do(ctx, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", key, err)
+	}
+	return body, nil
+}
+
+// do sends a signed GET for an object key (or the bucket when empty)
+func (s S3Source) do(ctx context.Context, key string, query url.Values) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.objectURL(key, query), nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if s.AccessKey != "" {
+		s.sign(req, emptySHA256, time.Now())
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Objects are images, so they get the bound of DisplayImageURL
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxImageDownload+1))
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if len(body) > maxImageDownload {
+		return nil, fmt.Errorf("response larger than %d bytes", maxImageDownload)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e s3Error
+		if xml.Unmarshal(body, &e) == nil && e.Code != "" {
+			return nil, fmt.Errorf("HTTP %d: %s: %s", resp.StatusCode, e.Code, e.Message)
+		}
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return body, nil
+}
+
+// region returns the signing region
+func (s S3Source) region() string {
+	if s.Region == "" {
+		return "us-east-1"
+	}
+	return s.Region
+}
+
+// objectURL builds the URL of an object key, or of the bucket when empty
+func (s S3Source) objectURL(key string, query url.Values) string {
+	endpoint := strings.TrimSuffix(s.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = "https://s3." + s.region() + ".amazonaws.com"
+	}
+
+	path := "/" + s3Escape(key, false)
+	if s.PathStyle {
+		path = "/" + s.Bucket + path
+	} else if scheme, host, ok := strings.Cut(endpoint, "://"); ok {
+		endpoint = scheme + "://" + s.Bucket + "." + host
+	}
+
+	u := endpoint + path
+	if len(query) > 0 {
+		u += "?" + s3Query(query)
+	}
+	return u
+}
+
+// sign adds AWS Signature Version 4 headers to req
+func (s S3Source) sign(req *http.Request, payloadHash string, t time.Time) {
+	amzDate := t.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		s3Escape(req.URL.Path, true),
+		s3Query(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region() + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.region())
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape percent-encodes everything but RFC 3986 unreserved characters,
+// keeping slashes when path is set
+func s3Escape(s string, path bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && path:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3Query encodes query parameters sorted by name, as signing requires
+func s3Query(query url.Values) string {
+	var parts []string
+	for name, values := range query {
+		for _, v := range values {
+			parts = append(parts, s3Escape(name, false)+"="+s3Escape(v, false))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "&")
+}
+
+// S3Watcher displays objects uploaded to an S3 bucket on a group of TVs,
+// e.g. dashboards a pipeline renders to object storage. It polls the bucket
+// and can also take bucket notifications (MinIO webhooks, S3 event records)
+// through Handler. It is safe for concurrent use.
+type S3Watcher struct {
+	renderer *Renderer
+	source   S3Source
+	tvs      []*TV
+	interval time.Duration
+
+	mu        sync.Mutex
+	seen      map[string]string // ETag by key
+	started   bool
+	listeners []func(key string, err error)
+	showing   bool   // An object is being shown
+	pending   string // Key to show after it (empty = none)
+}
+
+// NewS3Watcher creates a watcher showing new objects of source on tvs,
+// polling every interval (default 10s). Objects already in the bucket when
+// the watcher starts are not shown; uploading a new version shows it again.
+func NewS3Watcher(renderer *Renderer, source S3Source, tvs []*TV, interval time.Duration) *S3Watcher {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return &S3Watcher{
+		renderer: renderer,
+		source:   source,
+		tvs:      tvs,
+		interval: interval,
+		seen:     make(map[string]string),
+	}
+}
+
+// OnDisplay registers fn to be called after each object was sent to the
+// TVs, with the error if it failed. fn should not block.
+func (w *S3Watcher) OnDisplay(fn func(key string, err error)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.listeners = append(w.listeners, fn)
+}
+
+// Run polls the bucket every interval until ctx is done. It fails only if
+// the bucket can't be listed on the first poll.
+func (w *S3Watcher) Run(ctx context.Context) error {
+	if err := w.Poll(ctx); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		// Storage that is briefly unavailable is retried on the next tick
+		w.Poll(ctx)
+	}
+}
+
+// Poll lists the bucket once and displays the newest object uploaded since
+// the last poll
+func (w *S3Watcher) Poll(ctx context.Context) error {
+	objects, err := w.source.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	present := make(map[string]bool, len(objects))
+	var newest *S3Object
+	for i, obj := range objects {
+		if strings.HasSuffix(obj.Key, "/") || !watchable(obj.Key[strings.LastIndex(obj.Key, "/")+1:]) {
+			continue
+		}
+		present[obj.Key] = true
+		if etag, ok := w.seen[obj.Key]; ok && etag == obj.ETag {
+			continue
+		}
+		w.seen[obj.Key] = obj.ETag
+		if w.started && (newest == nil || obj.LastModified.After(newest.LastModified)) {
+			newest = &objects[i]
+		}
+	}
+	for key := range w.seen {
+		if !present[key] {
+			delete(w.seen, key)
+		}
+	}
+	w.started = true
+	w.mu.Unlock()
+
+	if newest != nil {
+		w.show(ctx, newest.Key)
+	}
+	return nil
+}
+
+// Handler returns an HTTP handler for bucket notifications, e.g. a MinIO
+// webhook target. Objects created under the prefix are shown right away
+// instead of on the next poll. Notifications must carry token in the
+// Authorization header ("Bearer TOKEN" or just TOKEN, as MinIO's
+// auth_token sends it); with an empty token every one is refused.
+func (w *S3Watcher) Handler(token string) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		got := req.Header.Get("Authorization")
+		got = strings.TrimPrefix(got, "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(rw, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var event struct {
+			Records []struct {
+				EventName string `json:"eventName"`
+				S3        struct {
+					Bucket struct {
+						Name string `json:"name"`
+					} `json:"bucket"`
+					Object struct {
+						Key  string `json:"key"`
+						ETag string `json:"eTag"`
+					} `json:"object"`
+				} `json:"s3"`
+			} `json:"Records"`
+		}
+		// Probes from the notifying server have no body
+		if req.Method != http.MethodPost || json.NewDecoder(io.LimitReader(req.Body, 1<<20)).Decode(&event) != nil {
+			rw.WriteHeader(http.StatusOK)
+			return
+		}
+
+		var keys []string
+		w.mu.Lock()
+		for _, rec := range event.Records {
+			key, err := url.QueryUnescape(rec.S3.Object.Key)
+			if err != nil || rec.S3.Bucket.Name != w.source.Bucket || !strings.Contains(rec.EventName, "ObjectCreated") ||
+				!strings.HasPrefix(key, w.source.Prefix) || !watchable(key[strings.LastIndex(key, "/")+1:]) {
+				continue
+			}
+			w.seen[key] = strings.Trim(rec.S3.Object.ETag, `"`)
+			keys = append(keys, key)
+		}
+		w.mu.Unlock()
+
+		// Answer before the TVs are done so the sender doesn't time out
+		rw.WriteHeader(http.StatusOK)
+		if len(keys) > 0 {
+			go w.show(context.WithoutCancel(req.Context()), keys[len(keys)-1])
+		}
+	})
+}
+
+// show displays an object on the watcher's TVs. Objects are shown one at
+// a time: while one is, only the latest key asked for waits, and is shown
+// by the call already showing.
+func (w *S3Watcher) show(ctx context.Context, key string) {
+	w.mu.Lock()
+	w.pending = key
+	if w.showing {
+		w.mu.Unlock()
+		return
+	}
+	w.showing = true
+	for w.pending != "" {
+		key, w.pending = w.pending, ""
+		listeners := slices.Clone(w.listeners)
+		w.mu.Unlock()
+
+		err := w.display(ctx, key)
+		for _, fn := range listeners {
+			fn(key, err)
+		}
+		w.mu.Lock()
+	}
+	w.showing = false
+	w.mu.Unlock()
+}
+
+func (w *S3Watcher) display(ctx context.Context, key string) error {
+	body, err := w.source.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	data, contentType, err := decodeImagePayload(body)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return w.renderer.Broadcast(ctx, w.tvs, func(ctx context.Context, tv *TV) error {
+		return w.renderer.DisplayImageData(ctx, tv, data, contentType)
+	})
+}
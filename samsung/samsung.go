@@ -0,0 +1,491 @@
+// Package samsung controls Samsung Tizen TVs (2016 and later) through their
+// WebSocket remote control API, which they need for anything beyond DLNA:
+// remote keys, text input and apps. Newer models only accept it after the
+// user allowed the remote on the TV, so pairing hands out a token to keep.
+package samsung
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	smarttv "github.com/nimsforest/nimsforestsmarttv"
+	"github.com/nimsforest/nimsforestsmarttv/internal/websocket"
+)
+
+// Backend names the credentials of Samsung TVs in a Registry
+const Backend = "samsung"
+
+// Ports of the API: plain on apiPort, and TLS with token pairing on
+// securePort for TVs that support tokens (2018 models and later)
+var (
+	apiPort    = 8001
+	securePort = 8002
+)
+
+// promptDelay is how long pairing waits for the TV to accept a remote it
+// already knows before asking the user to allow it
+var promptDelay = 500 * time.Millisecond
+
+// errConnClosed is returned when the TV drops the connection mid-request
+var errConnClosed = errors.New("connection closed by TV")
+
+// keys maps keys to Samsung key codes
+var keys = map[smarttv.Key]string{
+	smarttv.KeyUp:         "KEY_UP",
+	smarttv.KeyDown:       "KEY_DOWN",
+	smarttv.KeyLeft:       "KEY_LEFT",
+	smarttv.KeyRight:      "KEY_RIGHT",
+	smarttv.KeyOK:         "KEY_ENTER",
+	smarttv.KeyBack:       "KEY_RETURN",
+	smarttv.KeyHome:       "KEY_HOME",
+	smarttv.KeyPower:      "KEY_POWER",
+	smarttv.KeyPlay:       "KEY_PLAY",
+	smarttv.KeyPause:      "KEY_PAUSE",
+	smarttv.KeyVolumeUp:   "KEY_VOLUP",
+	smarttv.KeyVolumeDown: "KEY_VOLDOWN",
+	smarttv.KeyMute:       "KEY_MUTE",
+}
+
+// App is an app installed on the TV
+type App struct {
+	ID   string
+	Name string
+	Type int // 2 for web apps, 4 for native ones
+}
+
+// Option configures a Remote
+type Option func(*Remote)
+
+// WithName sets the name the TV shows when asking the user to allow the
+// remote (default "smarttv")
+func WithName(name string) Option {
+	return func(r *Remote) {
+		r.name = name
+	}
+}
+
+// WithToken connects with a token from an earlier pairing
+func WithToken(token string) Option {
+	return func(r *Remote) {
+		r.token = token
+	}
+}
+
+// WithTokenFunc calls fn with every new token the TV hands out, to store it
+// for the next connection. A failing fn fails the connection.
+func WithTokenFunc(fn func(token string) error) Option {
+	return func(r *Remote) {
+		r.onToken = fn
+	}
+}
+
+// event is a message from the TV
+type event struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// Remote controls a Samsung TV over its WebSocket API. It connects on the
+// first command and reconnects after the TV dropped the connection, e.g.
+// while it was off. It implements smarttv.RemoteControl and is safe for
+// concurrent use.
+type Remote struct {
+	host    string
+	name    string
+	onToken func(token string) error
+
+	// WebSocket URL up to the path (empty = ask the TV which port)
+	url string
+
+	mu     sync.Mutex
+	token  string
+	conn   *websocket.Conn
+	events chan event     // Events of conn, closed when it drops
+	apps   map[string]int // App types by ID, from Apps
+}
+
+// NewRemote returns a remote for the TV at host (an IP or host name)
+func NewRemote(host string, opts ...Option) *Remote {
+	r := &Remote{host: host, name: "smarttv"}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Connect connects to the TV unless already connected. The first
+// connection of a new remote to a TV using tokens waits until the user
+// allowed it on the TV; ErrPairingRejected means they didn't.
+func (r *Remote) Connect(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.connect(ctx)
+}
+
+// Token returns the token the TV handed out ("" for TVs without tokens)
+func (r *Remote) Token() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.token
+}
+
+// SendKey presses a key. Besides the common keys, Samsung key codes can be
+// given directly (e.g. "KEY_SOURCE" or "key_hdmi").
+func (r *Remote) SendKey(ctx context.Context, key smarttv.Key) error {
+	code, ok := keys[key]
+	if !ok {
+		if code = strings.ToUpper(string(key)); !strings.HasPrefix(code, "KEY_") {
+			return fmt.Errorf("key %q: %w", key, smarttv.ErrUnsupportedAction)
+		}
+	}
+	_, err := r.request(ctx, map[string]any{
+		"method": "ms.remote.control",
+		"params": map[string]string{
+			"Cmd":          "Click",
+			"DataOfCmd":    code,
+			"Option":       "false",
+			"TypeOfRemote": "SendRemoteKey",
+		},
+	}, "")
+	return err
+}
+
+// TypeText types s into the text field the TV's on-screen keyboard is open
+// for, replacing what it holds
+func (r *Remote) TypeText(ctx context.Context, s string) error {
+	_, err := r.request(ctx, map[string]any{
+		"method": "ms.remote.control",
+		"params": map[string]string{
+			"Cmd":          base64.StdEncoding.EncodeToString([]byte(s)),
+			"DataOfCmd":    "base64",
+			"TypeOfRemote": "SendInputString",
+		},
+	}, "")
+	return err
+}
+
+// Apps lists the apps installed on the TV
+func (r *Remote) Apps(ctx context.Context) ([]App, error) {
+	ev, err := r.request(ctx, emit("ed.installedApp.get", nil), "ed.installedApp.get")
+	if err != nil {
+		return nil, err
+	}
+	var data struct {
+		Data []struct {
+			ID   string `json:"appId"`
+			Name string `json:"name"`
+			Type int    `json:"app_type"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(ev.Data, &data); err != nil {
+		return nil, fmt.Errorf("parse app list: %w", err)
+	}
+
+	apps := make([]App, 0, len(data.Data))
+	types := make(map[string]int, len(data.Data))
+	for _, app := range data.Data {
+		apps = append(apps, App{ID: app.ID, Name: app.Name, Type: app.Type})
+		types[app.ID] = app.Type
+	}
+	r.mu.Lock()
+	r.apps = types
+	r.mu.Unlock()
+	return apps, nil
+}
+
+// LaunchApp starts the app with the given ID (see Apps). Native apps are
+// only told apart from web apps after Apps was called.
+func (r *Remote) LaunchApp(ctx context.Context, appID string) error {
+	r.mu.Lock()
+	action := "DEEP_LINK"
+	if r.apps[appID] == 4 {
+		action = "NATIVE_LAUNCH"
+	}
+	r.mu.Unlock()
+
+	_, err := r.request(ctx, emit("ed.apps.launch", map[string]string{"appId": appID, "action_type": action}), "")
+	return err
+}
+
+// Close closes the connection to the TV
+func (r *Remote) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.disconnect()
+}
+
+// emit builds a message for the TV's host application
+func emit(name string, data any) map[string]any {
+	params := map[string]any{"event": name, "to": "host"}
+	if data != nil {
+		params["data"] = data
+	}
+	return map[string]any{"method": "ms.channel.emit", "params": params}
+}
+
+// request sends msg and, unless reply is empty, waits for the event of that
+// name. A connection the TV dropped is reopened once.
+func (r *Remote) request(ctx context.Context, msg any, reply string) (event, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return event{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.connect(ctx); err != nil {
+		return event{}, err
+	}
+	if !drain(r.events) || r.conn.WriteText(data) != nil {
+		r.disconnect()
+		if err := r.connect(ctx); err != nil {
+			return event{}, err
+		}
+		if err := r.conn.WriteText(data); err != nil {
+			r.disconnect()
+			return event{}, fmt.Errorf("send: %w", err)
+		}
+	}
+	if reply == "" {
+		return event{}, nil
+	}
+
+	ev, err := waitEvent(ctx, r.events, reply)
+	if errors.Is(err, errConnClosed) {
+		r.disconnect()
+	}
+	return ev, err
+}
+
+// connect opens the connection if there is none; r.mu must be held
+func (r *Remote) connect(ctx context.Context) error {
+	if r.conn != nil {
+		return nil
+	}
+
+	base := r.url
+	if base == "" {
+		var err error
+		if base, err = r.endpoint(ctx); err != nil {
+			return err
+		}
+	}
+	wsURL := base + "/api/v2/channels/samsung.remote.control?name=" + url.QueryEscape(base64.StdEncoding.EncodeToString([]byte(r.name)))
+	if r.token != "" {
+		wsURL += "&token=" + url.QueryEscape(r.token)
+	}
+
+	conn, err := websocket.Dial(ctx, wsURL)
+	if err != nil {
+		return err
+	}
+	events := make(chan event, 16)
+	go readEvents(conn, events)
+
+	// The TV confirms the connection once the remote is allowed
+	ev, err := waitEvent(ctx, events, "ms.channel.connect")
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	var data struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(ev.Data, &data)
+	if data.Token != "" && data.Token != r.token {
+		if r.onToken != nil {
+			if err := r.onToken(data.Token); err != nil {
+				conn.Close()
+				return fmt.Errorf("save token: %w", err)
+			}
+		}
+		r.token = data.Token
+	}
+
+	r.conn, r.events = conn, events
+	return nil
+}
+
+// disconnect closes the connection, if any; r.mu must be held
+func (r *Remote) disconnect() error {
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn, r.events = nil, nil
+	return err
+}
+
+// endpoint asks the TV on which port it serves the API
+func (r *Remote) endpoint(ctx context.Context) (string, error) {
+	infoURL := "http://" + net.JoinHostPort(r.host, strconv.Itoa(apiPort)) + "/api/v2/"
+	req, err := http.NewRequestWithContext(ctx, "GET", infoURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetch device info: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetch device info: HTTP %d", resp.StatusCode)
+	}
+
+	var info struct {
+		Device struct {
+			TokenAuthSupport string `json:"TokenAuthSupport"`
+		} `json:"device"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&info); err != nil {
+		return "", fmt.Errorf("parse device info: %w", err)
+	}
+	if info.Device.TokenAuthSupport == "true" {
+		return "wss://" + net.JoinHostPort(r.host, strconv.Itoa(securePort)), nil
+	}
+	return "ws://" + net.JoinHostPort(r.host, strconv.Itoa(apiPort)), nil
+}
+
+// readEvents passes the events of conn on until it is closed. Events
+// nobody waits for are dropped once the buffer is full.
+func readEvents(conn *websocket.Conn, events chan<- event) {
+	defer close(events)
+	for {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var ev event
+		if json.Unmarshal(data, &ev) != nil {
+			continue
+		}
+		select {
+		case events <- ev:
+		default:
+		}
+	}
+}
+
+// drain discards stale events and reports whether the connection is open
+func drain(events chan event) bool {
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return false
+			}
+		default:
+			return true
+		}
+	}
+}
+
+// waitEvent waits for the event called name
+func waitEvent(ctx context.Context, events <-chan event, name string) (event, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return event{}, ctx.Err()
+		case ev, ok := <-events:
+			if !ok {
+				return event{}, errConnClosed
+			}
+			switch ev.Event {
+			case name:
+				return ev, nil
+			case "ms.channel.unauthorized":
+				return event{}, smarttv.ErrPairingRejected
+			case "ms.channel.timeOut":
+				return event{}, fmt.Errorf("%w: nobody allowed the remote on the TV in time", smarttv.ErrPairingRejected)
+			case "ms.error":
+				return event{}, fmt.Errorf("TV error: %s", ev.Data)
+			}
+		}
+	}
+}
+
+// IsSamsung reports whether tv is made by Samsung
+func IsSamsung(tv *smarttv.TV) bool {
+	return strings.Contains(strings.ToLower(tv.Manufacturer), "samsung")
+}
+
+// Pairer pairs with Samsung TVs for Registry.Pair: the TV asks the user to
+// allow the remote and then hands out the token stored as "token"
+type Pairer struct {
+	Name string // Shown on the TV (default "smarttv")
+}
+
+// Backend returns "samsung"
+func (p Pairer) Backend() string {
+	return Backend
+}
+
+// Pair connects to the TV, asking the user to allow the remote there
+func (p Pairer) Pair(ctx context.Context, tv *smarttv.TV, prompt smarttv.PromptFunc) (smarttv.Credentials, error) {
+	var opts []Option
+	if p.Name != "" {
+		opts = append(opts, WithName(p.Name))
+	}
+	r := NewRemote(tv.IP, opts...)
+	defer r.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- r.Connect(ctx) }()
+
+	select {
+	case err := <-done:
+		// Older TVs accept any remote without asking
+		if err != nil {
+			return nil, err
+		}
+	case <-time.After(promptDelay):
+		message := fmt.Sprintf("Allow %q on %s with the TV remote", r.name, tv.Name)
+		if _, err := prompt(ctx, smarttv.Prompt{Kind: smarttv.PromptConfirm, TV: tv, Message: message}); err != nil {
+			return nil, err
+		}
+		if err := <-done; err != nil {
+			return nil, err
+		}
+	}
+	return smarttv.Credentials{"token": r.Token()}, nil
+}
+
+// Attach sets tv.Remote to a Remote for the TV if it is a Samsung TV, so
+// tv.SendKey and tv.LaunchApp go through the WebSocket API. The token is
+// taken from reg, pairing first if there is none, and tokens the TV hands
+// out later are saved there. It reports whether tv is a Samsung TV.
+func Attach(ctx context.Context, reg *smarttv.Registry, tv *smarttv.TV, prompt smarttv.PromptFunc, opts ...Option) (bool, error) {
+	if !IsSamsung(tv) {
+		return false, nil
+	}
+
+	r := NewRemote(tv.IP, opts...)
+	creds, err := reg.Pair(ctx, tv, Pairer{Name: r.name}, prompt)
+	if err != nil {
+		return true, err
+	}
+	r.token = creds["token"]
+	r.onToken = func(token string) error {
+		if err := reg.SetCredentials(tv, Backend, smarttv.Credentials{"token": token}); err != nil {
+			return err
+		}
+		return reg.Save()
+	}
+	tv.Remote = r
+	return true, nil
+}
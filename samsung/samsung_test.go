@@ -0,0 +1,328 @@
+package samsung
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	smarttv "github.com/nimsforest/nimsforestsmarttv"
+	"github.com/nimsforest/nimsforestsmarttv/internal/websocket"
+)
+
+// mockTV is a Samsung TV using tokens, serving its API on 127.0.0.1
+type mockTV struct {
+	allow chan struct{} // Closed when the user allows the remote
+
+	mu       sync.Mutex
+	reject   bool
+	names    []string // Remote name of every connection
+	tokens   []string // Token of every connection
+	messages []string // Key code or event of every message
+	conns    []net.Conn
+}
+
+func newMockTV(t *testing.T) *mockTV {
+	m := &mockTV{allow: make(chan struct{})}
+	ws := httptest.NewTLSServer(http.HandlerFunc(m.serve))
+	info := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"device":{"TokenAuthSupport":"true","modelName":"QE55Q80T"}}`)
+	}))
+
+	savedAPI, savedSecure := apiPort, securePort
+	apiPort, securePort = port(info.URL), port(ws.URL)
+	t.Cleanup(func() {
+		apiPort, securePort = savedAPI, savedSecure
+		m.dropAll()
+		ws.Close()
+		info.Close()
+	})
+	return m
+}
+
+func port(rawURL string) int {
+	u, _ := url.Parse(rawURL)
+	p, _ := strconv.Atoi(u.Port())
+	return p
+}
+
+// frame encodes an unmasked text frame, as servers send them
+func frame(data []byte) []byte {
+	b := []byte{0x81} // FIN, text
+	switch {
+	case len(data) < 126:
+		b = append(b, byte(len(data)))
+	case len(data) <= 0xFFFF:
+		b = binary.BigEndian.AppendUint16(append(b, 126), uint16(len(data)))
+	default:
+		b = binary.BigEndian.AppendUint64(append(b, 127), uint64(len(data)))
+	}
+	return append(b, data...)
+}
+
+func (m *mockTV) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/v2/channels/samsung.remote.control" || r.Header.Get("Upgrade") != "websocket" {
+		http.NotFound(w, r)
+		return
+	}
+	name, _ := base64.StdEncoding.DecodeString(r.URL.Query().Get("name"))
+	token := r.URL.Query().Get("token")
+	sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + websocket.GUID))
+
+	conn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	rw.Flush()
+	send := func(v any) {
+		data, _ := json.Marshal(v)
+		conn.Write(frame(data))
+	}
+
+	m.mu.Lock()
+	m.names = append(m.names, string(name))
+	m.tokens = append(m.tokens, token)
+	m.conns = append(m.conns, conn)
+	reject := m.reject
+	m.mu.Unlock()
+
+	// Other remotes come and go; the client has to skip such events
+	send(map[string]any{"event": "ms.channel.clientConnect", "data": map[string]string{"id": "other"}})
+	switch {
+	case reject:
+		send(map[string]any{"event": "ms.channel.unauthorized"})
+		return
+	case token == "":
+		select {
+		case <-m.allow:
+		case <-time.After(5 * time.Second):
+			send(map[string]any{"event": "ms.channel.timeOut"})
+			return
+		}
+		send(map[string]any{"event": "ms.channel.connect", "data": map[string]any{"token": "tok-1", "clients": []any{}}})
+	default:
+		send(map[string]any{"event": "ms.channel.connect", "data": map[string]any{"clients": []any{}}})
+	}
+
+	c := websocket.NewConn(conn, rw.Reader)
+	for {
+		data, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg struct {
+			Method string `json:"method"`
+			Params struct {
+				Cmd          string `json:"Cmd"`
+				TypeOfRemote string `json:"TypeOfRemote"`
+				DataOfCmd    string `json:"DataOfCmd"`
+				Event        string `json:"event"`
+				Data         struct {
+					AppID  string `json:"appId"`
+					Action string `json:"action_type"`
+				} `json:"data"`
+			} `json:"params"`
+		}
+		json.Unmarshal(data, &msg)
+
+		m.mu.Lock()
+		switch {
+		case msg.Params.TypeOfRemote == "SendInputString":
+			text, _ := base64.StdEncoding.DecodeString(msg.Params.Cmd)
+			m.messages = append(m.messages, "text "+string(text))
+		case msg.Method == "ms.remote.control":
+			m.messages = append(m.messages, msg.Params.DataOfCmd)
+		default:
+			m.messages = append(m.messages, strings.TrimSpace(msg.Params.Event+" "+msg.Params.Data.AppID+" "+msg.Params.Data.Action))
+		}
+		m.mu.Unlock()
+
+		if msg.Params.Event == "ed.installedApp.get" {
+			send(map[string]any{"event": "ed.installedApp.get", "data": map[string]any{"data": []map[string]any{
+				{"appId": "111299001912", "name": "YouTube", "app_type": 2, "icon": "/opt/share/webappservice/apps_icon/FirstScreen/111299001912/250x250.png"},
+				{"appId": "3201907018807", "name": "Netflix", "app_type": 4, "icon": "/opt/share/webappservice/apps_icon/FirstScreen/3201907018807/250x250.png"},
+			}}})
+		}
+	}
+}
+
+// dropAll closes every connection, as a TV does when turned off
+func (m *mockTV) dropAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, conn := range m.conns {
+		conn.Close()
+	}
+	m.conns = nil
+}
+
+// waitMessages waits until the TV has read n messages; keys are sent
+// without waiting for an answer
+func (m *mockTV) waitMessages(n int) {
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		m.mu.Lock()
+		got := len(m.messages)
+		m.mu.Unlock()
+		if got >= n {
+			return
+		}
+	}
+}
+
+func (m *mockTV) state() (names, tokens, messages []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.names), slices.Clone(m.tokens), slices.Clone(m.messages)
+}
+
+// TestAttach tests pairing through the registry, keys, text and apps on an
+// attached TV, and connecting with the stored token later
+func TestAttach(t *testing.T) {
+	mock := newMockTV(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reg, err := smarttv.LoadRegistry(filepath.Join(t.TempDir(), "registry.json"))
+	if err != nil {
+		t.Fatalf("LoadRegistry failed: %v", err)
+	}
+	tv := &smarttv.TV{Name: "Living Room", IP: "127.0.0.1", UDN: "uuid:samsung", Manufacturer: "Samsung Electronics"}
+
+	prompts := 0
+	prompt := func(ctx context.Context, p smarttv.Prompt) (string, error) {
+		prompts++
+		if p.Kind != smarttv.PromptConfirm || !strings.Contains(p.Message, `"Kitchen display"`) {
+			t.Errorf("Unexpected prompt: %+v", p)
+		}
+		close(mock.allow)
+		return "", nil
+	}
+	ok, err := Attach(ctx, reg, tv, prompt, WithName("Kitchen display"))
+	if !ok || err != nil {
+		t.Fatalf("Attach = %v, %v", ok, err)
+	}
+	if prompts != 1 {
+		t.Errorf("Expected 1 prompt, got %d", prompts)
+	}
+	if creds, err := reg.Credentials(tv, Backend); err != nil || creds["token"] != "tok-1" {
+		t.Errorf("Stored credentials = %v, %v", creds, err)
+	}
+
+	if err := tv.SendKey(ctx, smarttv.KeyVolumeUp); err != nil {
+		t.Fatalf("SendKey failed: %v", err)
+	}
+	if err := tv.SendKey(ctx, "key_source"); err != nil {
+		t.Fatalf("SendKey of a key code failed: %v", err)
+	}
+	if err := tv.SendKey(ctx, "warp"); !errors.Is(err, smarttv.ErrUnsupportedAction) {
+		t.Errorf("Expected ErrUnsupportedAction for an unknown key, got %v", err)
+	}
+	if err := tv.TypeText(ctx, "guest wifi"); err != nil {
+		t.Fatalf("TypeText failed: %v", err)
+	}
+
+	remote := tv.Remote.(*Remote)
+	apps, err := remote.Apps(ctx)
+	if err != nil || len(apps) != 2 || apps[1] != (App{ID: "3201907018807", Name: "Netflix", Type: 4}) {
+		t.Fatalf("Apps = %+v, %v", apps, err)
+	}
+	if err := tv.LaunchApp(ctx, "3201907018807"); err != nil {
+		t.Fatalf("LaunchApp failed: %v", err)
+	}
+	if err := tv.LaunchApp(ctx, "111299001912"); err != nil {
+		t.Fatalf("LaunchApp failed: %v", err)
+	}
+	remote.Close()
+
+	// Later sessions connect with the stored token without asking
+	again := &smarttv.TV{Name: "Living Room", IP: "127.0.0.1", UDN: "uuid:samsung", Manufacturer: "Samsung Electronics"}
+	if _, err := Attach(ctx, reg, again, prompt, WithName("Kitchen display")); err != nil {
+		t.Fatalf("Second Attach failed: %v", err)
+	}
+	if err := again.SendKey(ctx, smarttv.KeyHome); err != nil {
+		t.Fatalf("SendKey failed: %v", err)
+	}
+	mock.waitMessages(7)
+	again.Remote.(*Remote).Close()
+
+	names, tokens, messages := mock.state()
+	// Pairing, the attached remote, the second remote
+	if strings.Join(tokens, ",") != ",tok-1,tok-1" {
+		t.Errorf("Connected with tokens %q", tokens)
+	}
+	if names[0] != "Kitchen display" {
+		t.Errorf("Remote name = %q", names[0])
+	}
+	want := "KEY_VOLUP,KEY_SOURCE,text guest wifi,ed.installedApp.get,ed.apps.launch 3201907018807 NATIVE_LAUNCH,ed.apps.launch 111299001912 DEEP_LINK,KEY_HOME"
+	if strings.Join(messages, ",") != want {
+		t.Errorf("Messages = %s, want %s", strings.Join(messages, ","), want)
+	}
+
+	other := &smarttv.TV{Name: "Bravia", Manufacturer: "Sony Corporation"}
+	if ok, err := Attach(ctx, reg, other, prompt); ok || err != nil || other.Remote != nil {
+		t.Errorf("Attach of a Sony TV = %v, %v", ok, err)
+	}
+}
+
+func TestPairRejected(t *testing.T) {
+	mock := newMockTV(t)
+	mock.reject = true
+
+	tv := &smarttv.TV{Name: "Living Room", IP: "127.0.0.1", Manufacturer: "Samsung"}
+	prompt := func(ctx context.Context, p smarttv.Prompt) (string, error) { return "", nil }
+	_, err := Pairer{}.Pair(context.Background(), tv, prompt)
+	if !errors.Is(err, smarttv.ErrPairingRejected) {
+		t.Errorf("Expected ErrPairingRejected, got %v", err)
+	}
+}
+
+// TestReconnect tests that commands reconnect after the TV dropped the
+// connection
+func TestReconnect(t *testing.T) {
+	mock := newMockTV(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	r := NewRemote("127.0.0.1", WithToken("tok-1"))
+	defer r.Close()
+	if err := r.SendKey(ctx, smarttv.KeyMute); err != nil {
+		t.Fatalf("SendKey failed: %v", err)
+	}
+	mock.waitMessages(1)
+	mock.dropAll()
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		r.mu.Lock()
+		open := drain(r.events)
+		r.mu.Unlock()
+		if !open || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := r.SendKey(ctx, smarttv.KeyMute); err != nil {
+		t.Fatalf("SendKey after the TV dropped the connection failed: %v", err)
+	}
+	mock.waitMessages(2)
+	if _, tokens, messages := mock.state(); len(tokens) != 2 || len(messages) != 2 {
+		t.Errorf("Expected 2 connections and 2 keys, got %q and %q", tokens, messages)
+	}
+}
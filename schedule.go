@@ -0,0 +1,401 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schedule is a recurring time of day, e.g. weekdays at 08:30 in
+// Europe/Berlin. Times are wall-clock times, so a schedule keeps firing at
+// 08:30 across daylight saving changes.
+type Schedule struct {
+	Hour     int
+	Minute   int
+	Weekdays []time.Weekday // Days to run on (empty = every day)
+	Location *time.Location // Time zone (nil = the TV's, see Scheduler)
+}
+
+// weekdayNames are the day names ParseSchedule accepts
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseSchedule parses "[DAYS] HH:MM [ZONE]", e.g. "08:30",
+// "mon-fri 08:30 Europe/Berlin" or "sat,sun 10:00 America/New_York".
+func ParseSchedule(spec string) (Schedule, error) {
+	var s Schedule
+	fields := strings.Fields(spec)
+	if len(fields) == 0 || len(fields) > 3 {
+		return s, fmt.Errorf("schedule %q: want [DAYS] HH:MM [ZONE]", spec)
+	}
+
+	// The time is the only field with a colon
+	at := slices.IndexFunc(fields, func(f string) bool { return strings.Contains(f, ":") })
+	if at < 0 || at > 1 {
+		return s, fmt.Errorf("schedule %q: missing HH:MM", spec)
+	}
+	h, m, _ := strings.Cut(fields[at], ":")
+	var err1, err2 error
+	s.Hour, err1 = strconv.Atoi(h)
+	s.Minute, err2 = strconv.Atoi(m)
+	if err1 != nil || err2 != nil || s.Hour < 0 || s.Hour > 23 || s.Minute < 0 || s.Minute > 59 {
+		return s, fmt.Errorf("schedule %q: invalid time %s", spec, fields[at])
+	}
+
+	if at == 1 {
+		days, err := parseWeekdays(fields[0])
+		if err != nil {
+			return s, fmt.Errorf("schedule %q: %w", spec, err)
+		}
+		s.Weekdays = days
+	}
+	if at+1 < len(fields) {
+		loc, err := time.LoadLocation(fields[at+1])
+		if err != nil {
+			return s, fmt.Errorf("schedule %q: %w", spec, err)
+		}
+		s.Location = loc
+	}
+	return s, nil
+}
+
+// parseWeekdays parses "mon-fri" or "sat,sun"
+func parseWeekdays(spec string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for part := range strings.SplitSeq(strings.ToLower(spec), ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, ok1 := weekdayNames[from]
+		last, ok2 := weekdayNames[to]
+		if !ok1 || (isRange && !ok2) {
+			return nil, fmt.Errorf("invalid days %q", spec)
+		}
+		if !isRange {
+			last = first
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			if !slices.Contains(days, d) {
+				days = append(days, d)
+			}
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// Next returns the first run strictly after t, in the schedule's location
+// (or t's, if it has none). On days when the wall-clock time doesn't exist
+// because clocks spring forward, it runs at the same time after the jump.
+func (s Schedule) Next(t time.Time) time.Time {
+	loc := s.Location
+	if loc == nil {
+		loc = t.Location()
+	}
+	t = t.In(loc)
+
+	// Step through calendar days, not 24h periods, so DST days of 23 or 25
+	// hours don't shift the run
+	year, month, day := t.Date()
+	for i := 0; i <= 7; i++ {
+		next := time.Date(year, month, day+i, s.Hour, s.Minute, 0, 0, loc)
+		if !next.After(t) {
+			continue
+		}
+		if len(s.Weekdays) > 0 && !slices.Contains(s.Weekdays, next.Weekday()) {
+			continue
+		}
+		return next
+	}
+	return time.Time{} // unreachable for valid weekdays
+}
+
+// ScheduleEntry shows content on TVs at the times of a schedule
+type ScheduleEntry struct {
+	Name     string
+	Schedule Schedule
+	TVs      []*TV
+
+	// Content returns what to show; now is in the TV's time zone
+	Content func(now time.Time) Content
+
+	// Blackout replaces the scheduler's calendar for this entry
+	Blackout *Calendar
+
+	// Alternate is shown instead of Content on blackout dates (nil = skip
+	// the run)
+	Alternate func(now time.Time) Content
+}
+
+// ScheduleRun reports one run of an entry on a TV
+type ScheduleRun struct {
+	Entry string
+	TV    *TV
+	At    time.Time // Scheduled time in the TV's time zone
+	Err   error
+
+	// Holiday is the summary of the blackout date the run fell on, if any
+	Holiday string
+	Skipped bool // Nothing was shown because of the blackout
+}
+
+// Scheduler runs schedule entries. Entries without a Schedule.Location run
+// at the wall-clock time of each TV's own time zone, so "08:00" is 08:00
+// in Berlin for the lobby TV and 08:00 in New York for the office TV.
+type Scheduler struct {
+	renderer *Renderer
+	locate   func(tv *TV) *time.Location
+	now      func() time.Time
+
+	mu        sync.Mutex
+	entries   []ScheduleEntry
+	blackout  *Calendar
+	next      map[scheduleKey]time.Time
+	listeners []func(ScheduleRun)
+	changed   chan struct{}
+}
+
+type scheduleKey struct {
+	entry string
+	tv    string // ControlURL
+}
+
+// NewScheduler creates a scheduler that shows content through r. locate
+// returns a TV's time zone (e.g. Registry.Location); nil uses time.Local.
+func NewScheduler(r *Renderer, locate func(tv *TV) *time.Location) *Scheduler {
+	if locate == nil {
+		locate = func(*TV) *time.Location { return time.Local }
+	}
+	return &Scheduler{
+		renderer: r,
+		locate:   locate,
+		now:      time.Now,
+		next:     make(map[scheduleKey]time.Time),
+		changed:  make(chan struct{}, 1),
+	}
+}
+
+// Add adds an entry, replacing one of the same name
+func (s *Scheduler) Add(e ScheduleEntry) error {
+	if e.Name == "" || e.Content == nil {
+		return errors.New("schedule entry needs a name and content")
+	}
+
+	s.mu.Lock()
+	s.removeLocked(e.Name)
+	s.entries = append(s.entries, e)
+	now := s.now()
+	for _, tv := range e.TVs {
+		s.next[scheduleKey{e.Name, tv.ControlURL}] = e.Schedule.Next(now.In(s.location(e, tv)))
+	}
+	s.mu.Unlock()
+
+	s.wake()
+	return nil
+}
+
+// Remove deletes an entry by name
+func (s *Scheduler) Remove(name string) {
+	s.mu.Lock()
+	s.removeLocked(name)
+	s.mu.Unlock()
+	s.wake()
+}
+
+func (s *Scheduler) removeLocked(name string) {
+	s.entries = slices.DeleteFunc(s.entries, func(e ScheduleEntry) bool { return e.Name == name })
+	for key := range s.next {
+		if key.entry == name {
+			delete(s.next, key)
+		}
+	}
+}
+
+// OnRun registers a function called after every run, e.g. to log failures
+func (s *Scheduler) OnRun(fn func(run ScheduleRun)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+// SetBlackout sets the calendar of dates on which entries skip their runs
+// or show their Alternate content (nil = none)
+func (s *Scheduler) SetBlackout(c *Calendar) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blackout = c
+}
+
+// NextRun returns when an entry runs next on a TV (zero if unknown)
+func (s *Scheduler) NextRun(name string, tv *TV) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.next[scheduleKey{name, tv.ControlURL}]
+}
+
+// location returns the time zone an entry runs in for a TV
+func (s *Scheduler) location(e ScheduleEntry, tv *TV) *time.Location {
+	if e.Schedule.Location != nil {
+		return e.Schedule.Location
+	}
+	if loc := s.locate(tv); loc != nil {
+		return loc
+	}
+	return time.Local
+}
+
+// wake makes Run recompute its next deadline
+func (s *Scheduler) wake() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Run shows scheduled content until ctx is done. Runs missed while the
+// process was busy are made up once, not once per missed day.
+func (s *Scheduler) Run(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		s.RunDue(ctx)
+
+		s.mu.Lock()
+		var soonest time.Time
+		for _, at := range s.next {
+			if soonest.IsZero() || at.Before(soonest) {
+				soonest = at
+			}
+		}
+		s.mu.Unlock()
+
+		wait := time.Hour
+		if !soonest.IsZero() {
+			wait = min(soonest.Sub(s.now()), wait)
+		}
+		timer.Reset(max(wait, 0))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.changed:
+		case <-timer.C:
+		}
+	}
+}
+
+// RunDue runs every entry whose time has come and schedules its next run
+func (s *Scheduler) RunDue(ctx context.Context) {
+	type due struct {
+		entry    ScheduleEntry
+		tv       *TV
+		at       time.Time
+		blackout *Calendar
+	}
+
+	s.mu.Lock()
+	now := s.now()
+	var runs []due
+	for _, e := range s.entries {
+		for _, tv := range e.TVs {
+			key := scheduleKey{e.Name, tv.ControlURL}
+			at, ok := s.next[key]
+			if !ok || at.After(now) {
+				continue
+			}
+			loc := s.location(e, tv)
+			blackout := e.Blackout
+			if blackout == nil {
+				blackout = s.blackout
+			}
+			runs = append(runs, due{e, tv, at.In(loc), blackout})
+			s.next[key] = e.Schedule.Next(now.In(loc))
+		}
+	}
+	listeners := slices.Clone(s.listeners)
+	s.mu.Unlock()
+
+	for _, run := range runs {
+		result := ScheduleRun{Entry: run.entry.Name, TV: run.tv, At: run.at}
+		content := run.entry.Content
+		if holiday, ok := run.blackout.Contains(run.at); ok {
+			result.Holiday = holiday
+			content = run.entry.Alternate
+		}
+
+		if content != nil {
+			var err error
+			if j := s.renderer.journal; j != nil {
+				if _, err = j.Append(JournalEntry{Op: JournalSchedule, TV: run.tv, Entry: run.entry.Name}); err != nil {
+					err = fmt.Errorf("journal: %w", err)
+				}
+			}
+			if err == nil {
+				err = s.renderer.Show(ctx, run.tv, content(now.In(run.at.Location())))
+			}
+			result.Err = err
+		} else {
+			result.Skipped = true
+		}
+		for _, fn := range listeners {
+			fn(result)
+		}
+	}
+}
+
+// Clock shows the time in a time zone
+type Clock struct {
+	Label    string         // Line above the time, e.g. "Berlin" (optional)
+	Layout   string         // Time layout (default "15:04")
+	Location *time.Location // Time zone (nil = the time passed to Content)
+}
+
+// Content renders the clock at now, e.g. as a ScheduleEntry's Content
+func (c Clock) Content(now time.Time) Content {
+	if c.Location != nil {
+		now = now.In(c.Location)
+	}
+	layout := c.Layout
+	if layout == "" {
+		layout = "15:04"
+	}
+	text := now.Format(layout)
+	if c.Label != "" {
+		text = c.Label + "\n" + text
+	}
+	return Content{Text: text}
+}
+
+// Countdown shows the time left until an instant
+type Countdown struct {
+	Label  string    // Line above the time left (optional)
+	Target time.Time // Instant to count down to
+	Done   string    // Text once the target has passed (default "00:00:00")
+}
+
+// Content renders the time left at now, as "3d 04:05:06" or "04:05:06"
+func (c Countdown) Content(now time.Time) Content {
+	left := c.Target.Sub(now)
+	text := c.Done
+	if left > 0 || text == "" {
+		left = max(left, 0).Truncate(time.Second)
+		days := left / (24 * time.Hour)
+		left -= days * 24 * time.Hour
+		text = fmt.Sprintf("%02d:%02d:%02d", int(left.Hours()), int(left.Minutes())%60, int(left.Seconds())%60)
+		if days > 0 {
+			text = fmt.Sprintf("%dd %s", days, text)
+		}
+	}
+	if c.Label != "" {
+		text = c.Label + "\n" + text
+	}
+	return Content{Text: text}
+}
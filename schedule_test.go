@@ -0,0 +1,196 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		spec     string
+		hour     int
+		minute   int
+		weekdays []time.Weekday
+		zone     string
+		wantErr  bool
+	}{
+		{spec: "08:30", hour: 8, minute: 30},
+		{spec: "mon-fri 07:05 Europe/Berlin", hour: 7, minute: 5, zone: "Europe/Berlin",
+			weekdays: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}},
+		{spec: "sat,sun 10:00", hour: 10, weekdays: []time.Weekday{time.Saturday, time.Sunday}},
+		{spec: "fri-mon 23:59", hour: 23, minute: 59,
+			weekdays: []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday}},
+		{spec: "18:00 America/New_York", hour: 18, zone: "America/New_York"},
+		{spec: "", wantErr: true},
+		{spec: "25:00", wantErr: true},
+		{spec: "someday 08:00", wantErr: true},
+		{spec: "08:00 Mars/Olympus", wantErr: true},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseSchedule(%q) succeeded, want error", tt.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSchedule(%q) failed: %v", tt.spec, err)
+			continue
+		}
+		if s.Hour != tt.hour || s.Minute != tt.minute || !slices.Equal(s.Weekdays, tt.weekdays) {
+			t.Errorf("ParseSchedule(%q) = %+v", tt.spec, s)
+		}
+		if (s.Location == nil && tt.zone != "") || (s.Location != nil && s.Location.String() != tt.zone) {
+			t.Errorf("ParseSchedule(%q) location = %v, want %q", tt.spec, s.Location, tt.zone)
+		}
+	}
+}
+
+// TestScheduleNextDST tests that runs keep their wall-clock time across
+// daylight saving changes
+func TestScheduleNextDST(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	s := Schedule{Hour: 8, Minute: 30, Location: berlin}
+
+	// Clocks go forward on 29 March 2026 and back on 25 October 2026
+	for _, start := range []time.Time{
+		time.Date(2026, 3, 27, 12, 0, 0, 0, berlin),
+		time.Date(2026, 10, 23, 12, 0, 0, 0, berlin),
+	} {
+		at := start
+		for range 4 {
+			at = s.Next(at)
+			if h, m, _ := at.Clock(); h != 8 || m != 30 {
+				t.Errorf("run at %v, want 08:30 Berlin time", at)
+			}
+		}
+		if days := at.YearDay() - start.YearDay(); days != 4 {
+			t.Errorf("4 runs from %v ended on %v, want one run per day", start, at)
+		}
+	}
+
+	// A time inside the spring-forward gap runs after the jump
+	gap := Schedule{Hour: 2, Minute: 30, Location: berlin}
+	at := gap.Next(time.Date(2026, 3, 28, 12, 0, 0, 0, berlin))
+	if at.Day() != 29 || at.Hour() != 3 {
+		t.Errorf("gap run at %v, want 29 March 03:30", at)
+	}
+
+	weekdays := Schedule{Hour: 9, Weekdays: []time.Weekday{time.Monday}, Location: berlin}
+	if at := weekdays.Next(time.Date(2026, 10, 16, 12, 0, 0, 0, berlin)); at.Weekday() != time.Monday || at.Day() != 19 {
+		t.Errorf("weekday run at %v, want Monday 19 October", at)
+	}
+}
+
+// TestSchedulerTimeZones tests that an entry without a time zone runs at
+// the same wall-clock time in each TV's own zone
+func TestSchedulerTimeZones(t *testing.T) {
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	var tvs []*TV
+	for _, name := range []string{"Lobby", "Office"} {
+		vtv, err := NewVirtualTV(name)
+		if err != nil {
+			t.Fatalf("NewVirtualTV failed: %v", err)
+		}
+		defer vtv.Close()
+		tvs = append(tvs, vtv.TV())
+	}
+	tvs[0].TimeZone = "Europe/Berlin"
+
+	reg := NewRegistry()
+	for _, tv := range tvs {
+		reg.AddTV(*tv)
+	}
+	reg.SetZone("us", "Office")
+	if err := reg.SetZoneTimeZone("us", "America/New_York"); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 3, 2, 6, 30, 0, 0, time.UTC)
+	scheduler := NewScheduler(renderer, reg.Location)
+	scheduler.now = func() time.Time { return now }
+
+	var runs []ScheduleRun
+	scheduler.OnRun(func(run ScheduleRun) { runs = append(runs, run) })
+
+	var shown []string
+	clock := Clock{Layout: "15:04 MST"}
+	err = scheduler.Add(ScheduleEntry{
+		Name:     "morning",
+		Schedule: Schedule{Hour: 8},
+		TVs:      tvs,
+		Content: func(now time.Time) Content {
+			c := clock.Content(now)
+			shown = append(shown, c.Text)
+			return c
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []time.Time{
+		time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC),  // 08:00 CET
+		time.Date(2026, 3, 2, 13, 0, 0, 0, time.UTC), // 08:00 EST
+	}
+	for i, tv := range tvs {
+		if got := scheduler.NextRun("morning", tv); !got.Equal(want[i]) {
+			t.Errorf("%s next run = %v, want %v", tv.Name, got, want[i])
+		}
+	}
+
+	ctx := context.Background()
+	now = want[0]
+	scheduler.RunDue(ctx)
+	if len(runs) != 1 || runs[0].TV != tvs[0] || runs[0].Err != nil {
+		t.Fatalf("runs = %+v, want one run on the lobby TV", runs)
+	}
+	if shown[0] != "08:00 CET" {
+		t.Errorf("lobby clock = %q, want 08:00 CET", shown[0])
+	}
+
+	now = want[1]
+	scheduler.RunDue(ctx)
+	if len(runs) != 2 || runs[1].TV != tvs[1] || shown[1] != "08:00 EST" {
+		t.Fatalf("runs = %+v, shown = %q", runs, shown)
+	}
+	if got := scheduler.NextRun("morning", tvs[0]); !got.Equal(want[0].AddDate(0, 0, 1)) {
+		t.Errorf("lobby next run = %v, want the next day", got)
+	}
+}
+
+func TestCountdown(t *testing.T) {
+	now := time.Date(2026, 12, 31, 20, 0, 0, 0, time.UTC)
+	tests := []struct {
+		c    Countdown
+		want string
+	}{
+		{Countdown{Target: now.Add(3*time.Hour + 59*time.Minute + 30*time.Second)}, "03:59:30"},
+		{Countdown{Label: "Launch", Target: now.Add(50 * time.Hour)}, "Launch\n2d 02:00:00"},
+		{Countdown{Target: now.Add(-time.Minute)}, "00:00:00"},
+		{Countdown{Target: now.Add(-time.Minute), Done: "Happy New Year"}, "Happy New Year"},
+	}
+	for _, tt := range tests {
+		if got := tt.c.Content(now).Text; got != tt.want {
+			t.Errorf("Content() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnsupportedAction is returned when the TV's service description shows
+// that it does not implement a SOAP action
+var ErrUnsupportedAction = errors.New("action not supported by TV")
+
+// scpd represents a UPnP service description (SCPD) XML document
+type scpd struct {
+	XMLName xml.Name `xml:"scpd"`
+	Actions []struct {
+		Name      string `xml:"name"`
+		Arguments []struct {
+			Name          string `xml:"name"`
+			Direction     string `xml:"direction"`
+			StateVariable string `xml:"relatedStateVariable"`
+		} `xml:"argumentList>argument"`
+	} `xml:"actionList>action"`
+	StateVariables []struct {
+		Name          string   `xml:"name"`
+		SendEvents    string   `xml:"sendEvents,attr"`
+		DataType      string   `xml:"dataType"`
+		Default       string   `xml:"defaultValue"`
+		AllowedValues []string `xml:"allowedValueList>allowedValue"`
+		Range         *struct {
+			Minimum string `xml:"minimum"`
+			Maximum string `xml:"maximum"`
+			Step    string `xml:"step"`
+		} `xml:"allowedValueRange"`
+	} `xml:"serviceStateTable>stateVariable"`
+}
+
+// serviceInfo is what we use from a service description
+type serviceInfo struct {
+	actions    []string
+	playSpeeds []string // Allowed TransportPlaySpeed values (nil if not listed)
+}
+
+// scpdCache holds parsed service descriptions keyed by UDN (or SCPD URL
+// when the device has no UDN), so rediscovered TVs don't refetch their SCPD
+var scpdCache = struct {
+	sync.Mutex
+	services map[string]serviceInfo
+}{services: make(map[string]serviceInfo)}
+
+// parseSCPD parses a service description and returns its action names
+func parseSCPD(r io.Reader) ([]string, error) {
+	info, err := parseServiceInfo(r, false)
+	return info.actions, err
+}
+
+// parseServiceInfo parses a service description
+func parseServiceInfo(r io.Reader, lenient bool) (serviceInfo, error) {
+	var desc scpd
+	if err := decodeXML(r, &desc, lenient); err != nil {
+		return serviceInfo{}, fmt.Errorf("parse SCPD: %w", err)
+	}
+
+	// No actions listed means unknown, not none: actions stays nil
+	var info serviceInfo
+	for _, a := range desc.Actions {
+		if name := strings.TrimSpace(a.Name); name != "" {
+			info.actions = append(info.actions, name)
+		}
+	}
+	for _, v := range desc.StateVariables {
+		if strings.TrimSpace(v.Name) != "TransportPlaySpeed" {
+			continue
+		}
+		for _, speed := range v.AllowedValues {
+			if speed = strings.TrimSpace(speed); speed != "" {
+				info.playSpeeds = append(info.playSpeeds, speed)
+			}
+		}
+	}
+	return info, nil
+}
+
+// LoadActions fetches the TV's AVTransport service description and stores
+// the supported actions in tv.Actions and play speeds in tv.PlaySpeeds.
+// Results are cached per UDN.
+func (tv *TV) LoadActions(ctx context.Context) error {
+	if tv.SCPDURL == "" {
+		return fmt.Errorf("no SCPD URL for %s", tv.Name)
+	}
+
+	key := tv.UDN
+	if key == "" {
+		key = tv.SCPDURL
+	}
+
+	scpdCache.Lock()
+	info, ok := scpdCache.services[key]
+	scpdCache.Unlock()
+	if ok {
+		tv.Actions, tv.PlaySpeeds = info.actions, info.playSpeeds
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", tv.SCPDURL, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch SCPD: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch SCPD: HTTP %d", resp.StatusCode)
+	}
+
+	info, err = parseServiceInfo(resp.Body, tv.lenientXML)
+	if err != nil {
+		return err
+	}
+
+	scpdCache.Lock()
+	if len(scpdCache.services) >= maxCachedDescriptions {
+		clear(scpdCache.services)
+	}
+	scpdCache.services[key] = info
+	scpdCache.Unlock()
+
+	tv.Actions, tv.PlaySpeeds = info.actions, info.playSpeeds
+	return nil
+}
+
+// SupportsAction reports whether the TV implements an AVTransport action.
+// If the action list was never loaded every action is assumed supported.
+func (tv *TV) SupportsAction(action string) bool {
+	if tv.Actions == nil {
+		return true
+	}
+	return slices.Contains(tv.Actions, action)
+}
@@ -0,0 +1,186 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Screenshotter captures what a TV is currently showing. Platforms that
+// allow it (Roku developer mode, Android TV via ADB, webOS developer mode)
+// each need their own access, so a Screenshotter is attached per TV.
+type Screenshotter interface {
+	Screenshot(ctx context.Context, tv *TV) (image.Image, error)
+}
+
+// Screenshot captures the TV's screen using its Screenshotter, e.g. so a
+// fleet dashboard can verify what is actually on each panel. TVs without
+// one return ErrUnsupportedAction.
+func (tv *TV) Screenshot(ctx context.Context) (image.Image, error) {
+	if tv.Screenshotter == nil {
+		return nil, tv.wrapError("Screenshot", "", ErrUnsupportedAction)
+	}
+	img, err := tv.Screenshotter.Screenshot(ctx, tv)
+	return img, tv.wrapError("Screenshot", "", err)
+}
+
+// rokuDevPort is the port of the Roku developer web server
+var rokuDevPort = 80
+
+// rokuScreenshotPath finds the screenshot link in the plugin inspector page
+var rokuScreenshotPath = regexp.MustCompile(`pkgs/dev\.(?:jpg|png)(?:\?[^"']*)?`)
+
+// RokuDevScreenshotter takes screenshots of Roku TVs with developer mode
+// enabled, logging in to the developer web server as "rokudev".
+// Screenshots only show channels sideloaded in developer mode.
+type RokuDevScreenshotter struct {
+	Password string // Developer web server password set when enabling dev mode
+}
+
+// Screenshot asks the Roku to capture its screen and downloads the result
+func (s RokuDevScreenshotter) Screenshot(ctx context.Context, tv *TV) (image.Image, error) {
+	base := "http://" + net.JoinHostPort(tv.IP, strconv.Itoa(rokuDevPort))
+	client := &digestClient{
+		client:   &http.Client{Timeout: 20 * time.Second},
+		user:     "rokudev",
+		password: s.Password,
+	}
+
+	// Trigger the capture through the plugin inspector form
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	mw.WriteField("mysubmit", "Screenshot")
+	mw.WriteField("archive", "")
+	mw.Close()
+
+	page, err := client.do(ctx, "POST", base+"/plugin_inspect", mw.FormDataContentType(), form.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("request screenshot: %w", err)
+	}
+
+	path := rokuScreenshotPath.Find(page)
+	if path == nil {
+		return nil, fmt.Errorf("request screenshot: no screenshot in response")
+	}
+
+	data, err := client.do(ctx, "GET", base+"/"+string(path), "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetch screenshot: %w", err)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode screenshot: %w", err)
+	}
+	return img, nil
+}
+
+// digestClient sends requests with HTTP Digest authentication (RFC 7616,
+// MD5 with qop=auth), as used by embedded web servers like Roku's
+type digestClient struct {
+	client   *http.Client
+	user     string
+	password string
+}
+
+// do sends a request, answering a Digest challenge once, and returns the body
+func (c *digestClient) do(ctx context.Context, method, rawURL, contentType string, body []byte) ([]byte, error) {
+	send := func(auth string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, rawURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		return c.client.Do(req)
+	}
+
+	resp, err := send("")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		auth, err := c.authorization(method, resp.Request.URL.RequestURI(), challenge)
+		if err != nil {
+			return nil, err
+		}
+		if resp, err = send(auth); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return data, nil
+}
+
+// authorization answers a Digest challenge for a request
+func (c *digestClient) authorization(method, uri, challenge string) (string, error) {
+	scheme, rest, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Digest") {
+		return "", fmt.Errorf("unsupported authentication %q", scheme)
+	}
+
+	params := make(map[string]string)
+	for _, part := range strings.Split(rest, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok {
+			params[strings.ToLower(k)] = strings.Trim(v, `"`)
+		}
+	}
+
+	cnonceBytes := make([]byte, 8)
+	rand.Read(cnonceBytes)
+	cnonce := hex.EncodeToString(cnonceBytes)
+	const nc = "00000001"
+
+	ha1 := md5Hex(c.user + ":" + params["realm"] + ":" + c.password)
+	ha2 := md5Hex(method + ":" + uri)
+
+	var response string
+	if params["qop"] != "" {
+		response = md5Hex(ha1 + ":" + params["nonce"] + ":" + nc + ":" + cnonce + ":auth:" + ha2)
+	} else {
+		response = md5Hex(ha1 + ":" + params["nonce"] + ":" + ha2)
+	}
+
+	auth := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		c.user, params["realm"], params["nonce"], uri, response)
+	if params["qop"] != "" {
+		auth += fmt.Sprintf(`, qop=auth, nc=%s, cnonce="%s"`, nc, cnonce)
+	}
+	if params["opaque"] != "" {
+		auth += fmt.Sprintf(`, opaque="%s"`, params["opaque"])
+	}
+	return auth, nil
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
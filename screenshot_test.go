@@ -0,0 +1,81 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestRokuDevScreenshot tests the digest-authenticated Roku screenshot flow
+func TestRokuDevScreenshot(t *testing.T) {
+	const realm, nonce = "rokudev", "abc123"
+
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		params := make(map[string]string)
+		for _, part := range strings.Split(strings.TrimPrefix(auth, "Digest "), ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+			params[k] = strings.Trim(v, `"`)
+		}
+		ha1 := md5Hex("rokudev:" + realm + ":secret")
+		ha2 := md5Hex(r.Method + ":" + r.URL.RequestURI())
+		want := md5Hex(ha1 + ":" + nonce + ":" + params["nc"] + ":" + params["cnonce"] + ":auth:" + ha2)
+		if params["response"] != want {
+			w.Header().Set("WWW-Authenticate", `Digest realm="`+realm+`", nonce="`+nonce+`", qop="auth"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/plugin_inspect":
+			w.Write([]byte(`<img src="pkgs/dev.png?time=1700000000">`))
+		case "/pkgs/dev.png":
+			png.Encode(w, image.NewRGBA(image.Rect(0, 0, 32, 18)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer mockTV.Close()
+
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(mockTV.URL, "http://"))
+	defer func(p int) { rokuDevPort = p }(rokuDevPort)
+	rokuDevPort, _ = strconv.Atoi(port)
+
+	tv := &TV{Name: "Roku TV", IP: host, Screenshotter: RokuDevScreenshotter{Password: "secret"}}
+	if !tv.Has(CapScreenshot) {
+		t.Error("Expected the screenshot capability")
+	}
+
+	img, err := tv.Screenshot(context.Background())
+	if err != nil {
+		t.Fatalf("Screenshot failed: %v", err)
+	}
+	if img.Bounds().Dx() != 32 {
+		t.Errorf("Expected a 32px wide screenshot, got %v", img.Bounds())
+	}
+
+	tv.Screenshotter = RokuDevScreenshotter{Password: "wrong"}
+	if _, err := tv.Screenshot(context.Background()); err == nil {
+		t.Error("Expected a wrong password to fail")
+	}
+}
+
+// TestCapabilities tests capability detection from discovery data
+func TestCapabilities(t *testing.T) {
+	tv := &TV{Name: "Test TV", Actions: []string{"SetAVTransportURI", "Play", "Stop"}}
+	caps := tv.Capabilities()
+	if len(caps) != 1 || caps[0] != CapImage {
+		t.Errorf("Expected only the image capability, got %v", caps)
+	}
+
+	if _, err := tv.Screenshot(context.Background()); !errors.Is(err, ErrUnsupportedAction) {
+		t.Errorf("Expected ErrUnsupportedAction, got %v", err)
+	}
+}
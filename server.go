@@ -1,9 +1,18 @@
 package nimsforestsmarttv
 
 import (
+	"bytes"
+	"crypto/rand"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"net"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -12,54 +21,127 @@ import (
 // ImageServer serves images over HTTP for TVs to fetch
 type ImageServer struct {
 	server   *http.Server
+	addr     string // Listen address (default ":0")
 	listener net.Listener
 	localIP  string
 	port     int
 
-	mu      sync.RWMutex
-	images  map[string][]byte
-	counter uint64
+	mu          sync.RWMutex
+	images      map[string]storedImage
+	order       []string // image paths, oldest first
+	streams     map[string]*readerImage
+	streamOrder []string         // unfetched stream paths, oldest first
+	fetches     map[string]Fetch // last fetch per image path
+	counter     uint64
+	maxImages   int // fetched images and unfetched streams kept
 
 	// Latest frame for streaming mode
-	latestFrame     []byte
+	latestFrame     storedImage
 	latestFrameLock sync.RWMutex
+	frameEpoch      uint64 // Frame stream the endpoint follows
+
+	// Called after every request (nil = no access log)
+	accessLog func(AccessEntry)
+
+	// Bytes served per client
+	bandwidth *bandwidthMeter
+
+	// Called after a stored image is fetched (nil = none)
+	fetchHook func(path string, f Fetch)
+
+	// Ends when the HTTP server stops serving
+	life *lifecycle
+
+	// Served paths start with pathPrefix (e.g. "/smarttv")
+	pathPrefix string
+
+	// Image IDs are random instead of sequential
+	randomIDs bool
+
+	// Identify the TV behind a client IP
+	resolvers []func(ip string) (*TV, bool)
+
+	// Receives every fetch (nil = none)
+	fetchObserver FetchObserver
+
+	// Sources of the media proxy by token
+	proxies map[string]proxyTarget
+
+	// Recorded live streams by token
+	timeshifts map[string]*LiveBuffer
+
+	// Traces every request (nil = off)
+	tracer Tracer
+
+	// Checks the sources of Proxy and RecordLive (nil = off)
+	urlPolicy *URLPolicy
+
+	// Caps images read by StoreReader
+	limits Limits
+
+	// Streams being recorded to files by path
+	recordings map[string]*streamRecorder
 }
 
 // NewImageServer creates a new image server on an available port
-func NewImageServer() (*ImageServer, error) {
+func NewImageServer(opts ...ServerOption) (*ImageServer, error) {
 	// Find local IP that can reach the network
 	localIP, err := getLocalIP()
 	if err != nil {
 		return nil, fmt.Errorf("get local IP: %w", err)
 	}
 
-	// Listen on a random available port
-	listener, err := net.Listen("tcp", ":0")
+	srv := &ImageServer{
+		addr:       ":0",
+		localIP:    localIP,
+		images:     make(map[string]storedImage),
+		streams:    make(map[string]*readerImage),
+		fetches:    make(map[string]Fetch),
+		proxies:    make(map[string]proxyTarget),
+		timeshifts: make(map[string]*LiveBuffer),
+		recordings: make(map[string]*streamRecorder),
+		bandwidth:  newBandwidthMeter(),
+		life:       newLifecycle(),
+		limits:     DefaultLimits,
+		maxImages:  10,
+	}
+
+	for _, opt := range opts {
+		opt(srv)
+	}
+
+	// Listen on a random available port unless told otherwise
+	listener, err := net.Listen("tcp", srv.addr)
 	if err != nil {
 		return nil, fmt.Errorf("listen: %w", err)
 	}
+	srv.listener = listener
+	srv.port = listener.Addr().(*net.TCPAddr).Port
 
-	port := listener.Addr().(*net.TCPAddr).Port
-
-	srv := &ImageServer{
-		listener: listener,
-		localIP:  localIP,
-		port:     port,
-		images:   make(map[string][]byte),
+	// Bound to one address: that's the one TVs must use
+	if ip := listener.Addr().(*net.TCPAddr).IP; !ip.IsUnspecified() {
+		srv.localIP = ip.String()
 	}
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/stream.jpg", srv.handleStreamImage)
+	mux.HandleFunc(srv.pathPrefix+"/stream.jpg", srv.handleStreamImage)
+	mux.HandleFunc(srv.pathPrefix+"/proxy/", srv.handleProxy)
+	mux.HandleFunc(srv.pathPrefix+"/timeshift/", srv.handleTimeShift)
 	mux.HandleFunc("/", srv.handleImage)
 
 	srv.server = &http.Server{
-		Handler:      mux,
+		Handler:      srv.traceRequest(srv.instrument(mux)),
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
 
 	// Start serving
-	go srv.server.Serve(listener)
+	srv.life.Go("image server", func() error {
+		if err := srv.server.Serve(listener); err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	})
 
 	return srv, nil
 }
@@ -68,81 +150,559 @@ func NewImageServer() (*ImageServer, error) {
 // Includes headers to encourage TV to re-fetch periodically
 func (s *ImageServer) handleStreamImage(w http.ResponseWriter, r *http.Request) {
 	s.latestFrameLock.RLock()
-	data := s.latestFrame
+	frame := s.latestFrame
 	s.latestFrameLock.RUnlock()
 
-	if data == nil {
+	if frame.data == nil {
 		http.NotFound(w, r)
 		return
 	}
 
-	w.Header().Set("Content-Type", "image/jpeg")
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
-	// Aggressive no-cache to force re-fetch
-	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate, max-age=0")
+	// Always revalidate, but let unchanged frames come back as 304
+	w.Header().Set("Cache-Control", "no-cache, must-revalidate, max-age=0")
 	w.Header().Set("Pragma", "no-cache")
 	w.Header().Set("Expires", "Thu, 01 Jan 1970 00:00:00 GMT")
 	// Refresh header - some clients honor this
 	w.Header().Set("Refresh", "1")
-	w.Write(data)
-	fmt.Printf("[ImageServer] Stream: sent %d bytes to %s\n", len(data), r.RemoteAddr)
+	frame.serve(w, r)
 }
 
 // handleImage serves stored images
 func (s *ImageServer) handleImage(w http.ResponseWriter, r *http.Request) {
-	fmt.Printf("[ImageServer] Request: %s %s from %s\n", r.Method, r.URL.Path, r.RemoteAddr)
+	start := time.Now()
 
 	s.mu.RLock()
-	data, ok := s.images[r.URL.Path]
+	img, ok := s.images[r.URL.Path]
+	stream := s.streams[r.URL.Path]
 	s.mu.RUnlock()
 
+	if !ok && stream != nil {
+		s.serveStream(w, r, stream, start)
+		return
+	}
+
 	if !ok {
-		fmt.Printf("[ImageServer] Not found: %s (have %d images)\n", r.URL.Path, len(s.images))
 		http.NotFound(w, r)
 		return
 	}
 
-	w.Header().Set("Content-Type", "image/jpeg")
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
-	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-	n, _ := w.Write(data)
-	fmt.Printf("[ImageServer] Sent %d bytes\n", n)
+	w.Header().Set("Cache-Control", "no-cache, must-revalidate")
+	img.serve(w, r)
+	s.recordFetch(r, start)
 }
 
-// Store stores an image and returns its URL
-func (s *ImageServer) Store(jpegData []byte) string {
+// Fetch records a client downloading a stored image
+type Fetch struct {
+	At       time.Time     // When the download finished
+	ClientIP string        // Address of the client
+	Duration time.Duration // How long the download took
+	TV       *TV           // TV at ClientIP (nil if unknown, see WithClientResolver)
+}
+
+// recordFetch remembers who last fetched the requested image
+func (s *ImageServer) recordFetch(r *http.Request, start time.Time) {
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+
+	now := time.Now()
+	f := Fetch{At: now, ClientIP: clientIP, Duration: now.Sub(start), TV: s.resolveClient(clientIP)}
+
+	s.mu.Lock()
+	_, ok := s.images[r.URL.Path]
+	if ok {
+		s.fetches[r.URL.Path] = f
+	}
+	s.mu.Unlock()
+
+	if ok && s.fetchHook != nil {
+		s.fetchHook(r.URL.Path, f)
+	}
+}
+
+// WithServerAddr sets the address the image server listens on (default
+// ":0", any free port). Binding a specific IP also makes it the address
+// image URLs are built with.
+func WithServerAddr(addr string) ServerOption {
+	return func(s *ImageServer) {
+		s.addr = addr
+	}
+}
+
+// WithPathPrefix serves images under prefix (e.g. "/smarttv"), so a
+// reverse proxy in front of several services can route them
+func WithPathPrefix(prefix string) ServerOption {
+	return func(s *ImageServer) {
+		prefix = strings.Trim(prefix, "/")
+		if prefix != "" {
+			prefix = "/" + prefix
+		}
+		s.pathPrefix = prefix
+	}
+}
+
+// WithRandomIDs names images with random IDs instead of a counter, so
+// other devices on the network can't guess the URLs of frames
+func WithRandomIDs() ServerOption {
+	return func(s *ImageServer) {
+		s.randomIDs = true
+	}
+}
+
+// newImagePath returns the path for a new image with the file extension ext
+func (s *ImageServer) newImagePath(ext string) string {
+	if s.randomIDs {
+		return fmt.Sprintf("%s/img_%s%s", s.pathPrefix, rand.Text(), ext)
+	}
 	id := atomic.AddUint64(&s.counter, 1)
-	path := fmt.Sprintf("/img_%d_%d.jpg", id, time.Now().UnixNano())
+	return fmt.Sprintf("%s/img_%d_%d%s", s.pathPrefix, id, time.Now().UnixNano(), ext)
+}
+
+// withFetchObserver reports every fetch to o
+func withFetchObserver(o FetchObserver) ServerOption {
+	return func(s *ImageServer) {
+		s.fetchObserver = o
+	}
+}
+
+// withFetchHook calls fn whenever a stored image has been fetched
+func withFetchHook(fn func(path string, f Fetch)) ServerOption {
+	return func(s *ImageServer) {
+		s.fetchHook = fn
+	}
+}
+
+// LastFetch returns when and by whom an image URL returned by Store was
+// last downloaded, e.g. to confirm a TV actually fetched a frame
+func (s *ImageServer) LastFetch(imageURL string) (Fetch, bool) {
+	path, ok := imagePath(imageURL)
+	if !ok {
+		return Fetch{}, false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, ok := s.fetches[path]
+	return f, ok
+}
+
+// imagePath returns the server path of an image URL
+func imagePath(imageURL string) (string, bool) {
+	u, err := url.Parse(imageURL)
+	if err != nil {
+		return "", false
+	}
+	return u.Path, true
+}
+
+// storedImage is an image kept in memory together with its MIME type
+type storedImage struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+	etag        string
+
+	// Sequence number and capture time of streamed frames (0 = not a frame)
+	seq        uint64
+	capturedAt time.Time
+}
+
+// newStoredImage wraps image data with the validators used for caching
+func newStoredImage(data []byte, contentType string) storedImage {
+	h := fnv.New64a()
+	h.Write(data)
+	return storedImage{
+		data:        data,
+		contentType: contentType,
+		modTime:     time.Now(),
+		etag:        fmt.Sprintf(`"%x"`, h.Sum64()),
+	}
+}
+
+// newStoredFrame wraps a streamed frame. Its ETag names the stream and the
+// frame too, so a frame repeating an earlier one's image is still new.
+func newStoredFrame(f StreamFrame, epoch uint64) storedImage {
+	img := newStoredImage(f.JPEG, "image/jpeg")
+	img.seq, img.capturedAt = f.Seq, f.CapturedAt
+	img.etag = fmt.Sprintf(`%s-%d-%d"`, strings.TrimSuffix(img.etag, `"`), epoch, f.Seq)
+	return img
+}
+
+// serve writes the image, answering If-None-Match and If-Modified-Since
+// requests for an unchanged image with 304 Not Modified. Frames change
+// more than once a second, too often for Last-Modified, so they are only
+// validated by their ETag.
+func (img storedImage) serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", img.contentType)
+	w.Header().Set("ETag", img.etag)
+	modTime := img.modTime
+	if img.seq > 0 {
+		w.Header().Set("X-Frame-Seq", strconv.FormatUint(img.seq, 10))
+		w.Header().Set("X-Frame-Timestamp", img.capturedAt.UTC().Format(time.RFC3339Nano))
+		modTime = time.Time{}
+	}
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(img.data))
+}
+
+// Store stores a JPEG image and returns its URL
+func (s *ImageServer) Store(jpegData []byte) string {
+	return s.StoreContent(jpegData, "image/jpeg")
+}
+
+// StoreContent stores an image of the given MIME type and returns its URL
+func (s *ImageServer) StoreContent(data []byte, contentType string) string {
+	return s.store(newStoredImage(data, contentType))
+}
+
+// storeFrame stores a streamed JPEG frame, served with its sequence number
+// and capture time in X-Frame-Seq and X-Frame-Timestamp headers
+func (s *ImageServer) storeFrame(f StreamFrame) string {
+	return s.store(newStoredFrame(f, 0))
+}
+
+// store stores an image and returns its URL
+func (s *ImageServer) store(img storedImage) string {
+	path := s.newImagePath(imageExtension(img.contentType))
 
 	s.mu.Lock()
-	// Clean up old images (keep only last 10)
-	if len(s.images) > 10 {
-		for k := range s.images {
-			delete(s.images, k)
-			break
+	s.keep(path, img)
+	s.mu.Unlock()
+
+	return fmt.Sprintf("http://%s:%d%s", s.localIP, s.port, path)
+}
+
+// keep stores an image at path. Call with mu held.
+func (s *ImageServer) keep(path string, img storedImage) {
+	if _, ok := s.images[path]; !ok {
+		s.order = append(s.order, path)
+	}
+	s.images[path] = img
+
+	// Clean up old images: keep the newest fetched ones, and images nobody
+	// fetched yet until there are far too many of them
+	if len(s.images) <= s.maxImages {
+		return
+	}
+	fetchedLeft, unfetchedLeft := s.maxImages, unfetchedFactor*s.maxImages
+	drop := make(map[string]bool)
+	for i := len(s.order) - 1; i >= 0; i-- {
+		left := &unfetchedLeft
+		if _, ok := s.fetches[s.order[i]]; ok {
+			left = &fetchedLeft
+		}
+		if *left > 0 {
+			*left--
+			continue
+		}
+		drop[s.order[i]] = true
+	}
+	for p := range drop {
+		delete(s.images, p)
+		delete(s.fetches, p)
+	}
+	s.order = slices.DeleteFunc(s.order, func(p string) bool { return drop[p] })
+}
+
+// unfetchedFactor times the server's image cap is how many images nobody
+// fetched yet are kept
+const unfetchedFactor = 10
+
+// WithMaxImages sets how many fetched images the server keeps (default
+// 10), evicting the oldest first. Images no TV fetched yet are kept on top
+// of that, up to ten times n, so a video wall or a frame plan storing many
+// images at once doesn't lose them before its TVs fetch them. It also caps
+// the streams from StoreReader nobody fetched yet.
+func WithMaxImages(n int) ServerOption {
+	return func(s *ImageServer) {
+		if n > 0 {
+			s.maxImages = n
 		}
 	}
-	s.images[path] = jpegData
+}
+
+// lookup returns the stored image behind a URL returned by Store
+func (s *ImageServer) lookup(imageURL string) (storedImage, bool) {
+	path, ok := imagePath(imageURL)
+	if !ok {
+		return storedImage{}, false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	img, ok := s.images[path]
+	return img, ok
+}
+
+// imageExtension returns the file extension used in URLs for a MIME type.
+// Some TVs decide by extension whether they can show a URL.
+func imageExtension(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "audio/wav":
+		return ".wav"
+	case "audio/mpeg":
+		return ".mp3"
+	case "audio/mp4":
+		return ".m4a"
+	case "audio/ogg":
+		return ".ogg"
+	case "audio/flac":
+		return ".flac"
+	default:
+		return ""
+	}
+}
+
+// readerImage is a stored image whose bytes are still being read from a stream
+type readerImage struct {
+	mu   sync.Mutex
+	path string
+	r    io.Reader
+}
+
+// StoreReader registers an image of unknown length and returns its URL.
+// Nothing is read until a TV fetches the URL; the first fetch streams the
+// data with chunked transfer encoding while it is read from r. The bytes
+// are read to the end even if that TV hangs up, and kept like other
+// stored images so later fetches of the same URL still succeed. If r is an
+// io.Closer it is closed once fully read. Streams longer than the server's
+// Limits.MaxBytes are cut off and the fetch aborted. Only the last 10
+// unfetched streams are kept (see WithMaxImages); older ones are closed.
+func (s *ImageServer) StoreReader(r io.Reader) string {
+	path := s.newImagePath(".jpg")
+
+	s.mu.Lock()
+	s.streams[path] = &readerImage{path: path, r: r}
+	s.streamOrder = append(s.streamOrder, path)
+	for len(s.streamOrder) > s.maxImages {
+		go s.streams[s.streamOrder[0]].discard()
+		delete(s.streams, s.streamOrder[0])
+		s.streamOrder = s.streamOrder[1:]
+	}
 	s.mu.Unlock()
 
 	return fmt.Sprintf("http://%s:%d%s", s.localIP, s.port, path)
 }
 
-// UpdateLatestFrame updates the latest frame for streaming mode
+// serveStream streams a reader-backed image, then stores the bytes read
+func (s *ImageServer) serveStream(w http.ResponseWriter, r *http.Request, stream *readerImage, start time.Time) {
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "no-cache, must-revalidate")
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	// Concurrent fetches wait for the first one to finish reading
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	if stream.r == nil {
+		// Read by an earlier fetch, which may have failed
+		s.mu.RLock()
+		img, ok := s.images[stream.path]
+		s.mu.RUnlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		img.serve(w, r)
+		s.recordFetch(r, start)
+		return
+	}
+
+	// No Content-Length: net/http falls back to chunked encoding. The TV
+	// hanging up doesn't stop the reading, so the image can be fetched
+	// again; only errors reading the stream lose it.
+	var buf bytes.Buffer
+	var err error
+	client := &tolerantWriter{w: w}
+	if max := s.limits.MaxBytes; max > 0 {
+		var n int64
+		n, err = io.Copy(io.MultiWriter(&buf, client), io.LimitReader(stream.r, int64(max)))
+		var probe [1]byte
+		if err == nil && n == int64(max) && readByte(stream.r, probe[:]) {
+			err = fmt.Errorf("%w: stream longer than %d bytes", ErrImageTooLarge, max)
+		}
+	} else {
+		_, err = io.Copy(io.MultiWriter(&buf, client), stream.r)
+	}
+	if c, ok := stream.r.(io.Closer); ok {
+		c.Close()
+	}
+	stream.r = nil
+
+	s.mu.Lock()
+	s.forgetStream(stream.path)
+	if err == nil {
+		s.keep(stream.path, newStoredImage(buf.Bytes(), "image/jpeg"))
+	}
+	s.mu.Unlock()
+	s.recordFetch(r, start)
+
+	if errors.Is(err, ErrImageTooLarge) {
+		// Don't let the TV take the truncated image for a whole one
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// forgetStream drops a stream that has been read. Call with mu held.
+func (s *ImageServer) forgetStream(path string) {
+	if _, ok := s.streams[path]; !ok {
+		// Evicted while it was read
+		return
+	}
+	delete(s.streams, path)
+	for i, p := range s.streamOrder {
+		if p == path {
+			s.streamOrder = slices.Delete(s.streamOrder, i, i+1)
+			break
+		}
+	}
+}
+
+// discard closes the stream of an image evicted before it was fetched
+func (stream *readerImage) discard() {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	if c, ok := stream.r.(io.Closer); ok {
+		c.Close()
+	}
+	stream.r = nil
+}
+
+// tolerantWriter writes to w until a write fails, and then pretends to
+type tolerantWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (t *tolerantWriter) Write(p []byte) (int, error) {
+	if t.err == nil {
+		_, t.err = t.w.Write(p)
+	}
+	return len(p), nil
+}
+
+// readByte reports whether r has another byte
+func readByte(r io.Reader, buf []byte) bool {
+	_, err := io.ReadFull(r, buf)
+	return err == nil
+}
+
+// UpdateLatestFrame updates the latest frame for streaming mode, numbering
+// it after the current one
 func (s *ImageServer) UpdateLatestFrame(jpegData []byte) {
 	s.latestFrameLock.Lock()
-	s.latestFrame = jpegData
-	s.latestFrameLock.Unlock()
+	defer s.latestFrameLock.Unlock()
+	s.setLatestFrame(StreamFrame{Seq: s.latestFrame.seq + 1, CapturedAt: time.Now(), JPEG: jpegData})
+}
+
+// PublishFrame updates the latest frame for streaming mode unless it is
+// older than the current one, in which case it returns ErrStaleFrame.
+// Frames with Seq 0 are numbered after the current one, and a zero
+// CapturedAt means now.
+func (s *ImageServer) PublishFrame(f StreamFrame) error {
+	s.latestFrameLock.Lock()
+	defer s.latestFrameLock.Unlock()
+	return s.publishFrame(f)
+}
+
+// startFrameStream makes the streaming endpoint follow a new frame stream,
+// whose numbering starts over, and returns the epoch it publishes with
+func (s *ImageServer) startFrameStream() uint64 {
+	s.latestFrameLock.Lock()
+	defer s.latestFrameLock.Unlock()
+	s.frameEpoch++
+	s.latestFrame.seq = 0
+	return s.frameEpoch
+}
+
+// publishStreamFrame is PublishFrame for the frame stream started as
+// epoch. Frames of streams started before the latest one are stale.
+func (s *ImageServer) publishStreamFrame(epoch uint64, f StreamFrame) error {
+	s.latestFrameLock.Lock()
+	defer s.latestFrameLock.Unlock()
+	if epoch != s.frameEpoch {
+		return fmt.Errorf("frame %d of a replaced stream: %w", f.Seq, ErrStaleFrame)
+	}
+	return s.publishFrame(f)
+}
+
+// publishFrame is PublishFrame with latestFrameLock held
+func (s *ImageServer) publishFrame(f StreamFrame) error {
+	current := s.latestFrame.seq
+	switch {
+	case f.Seq == 0:
+		f.Seq = current + 1
+	case f.Seq <= current:
+		return fmt.Errorf("frame %d after %d: %w", f.Seq, current, ErrStaleFrame)
+	}
+	if f.CapturedAt.IsZero() {
+		f.CapturedAt = time.Now()
+	}
+	s.setLatestFrame(f)
+	return nil
+}
+
+// setLatestFrame replaces the latest frame. Call with latestFrameLock held.
+func (s *ImageServer) setLatestFrame(f StreamFrame) {
+	s.latestFrame = newStoredFrame(f, s.frameEpoch)
+}
+
+// LatestFrame describes the frame on the streaming endpoint
+func (s *ImageServer) LatestFrame() (StreamFrameInfo, bool) {
+	s.latestFrameLock.RLock()
+	defer s.latestFrameLock.RUnlock()
+	if s.latestFrame.data == nil {
+		return StreamFrameInfo{}, false
+	}
+	return StreamFrameInfo{
+		Seq:         s.latestFrame.seq,
+		CapturedAt:  s.latestFrame.capturedAt,
+		PublishedAt: s.latestFrame.modTime,
+		Size:        len(s.latestFrame.data),
+	}, true
 }
 
 // StreamURL returns the URL for the streaming endpoint
 func (s *ImageServer) StreamURL() string {
-	return fmt.Sprintf("http://%s:%d/stream.jpg", s.localIP, s.port)
+	return fmt.Sprintf("http://%s:%d%s/stream.jpg", s.localIP, s.port, s.pathPrefix)
 }
 
 // Close shuts down the image server
 func (s *ImageServer) Close() error {
-	return s.server.Close()
+	s.life.stop()
+	err := s.server.Close()
+
+	s.mu.Lock()
+	recordings := s.recordings
+	s.recordings = make(map[string]*streamRecorder)
+	s.proxies = make(map[string]proxyTarget)
+	s.mu.Unlock()
+	for _, rec := range recordings {
+		rec.close()
+	}
+	return err
+}
+
+// Done is closed when the server stops serving, because of Close or
+// because it failed (e.g. it ran out of file descriptors)
+func (s *ImageServer) Done() <-chan struct{} {
+	return s.life.Done()
+}
+
+// Err returns why the server stopped serving. It is nil while the server
+// runs and after Close.
+func (s *ImageServer) Err() error {
+	return s.life.Err()
 }
 
 // URL returns the base URL of the image server
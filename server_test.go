@@ -0,0 +1,368 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestStoreReader tests that reader-backed images stream once and are then kept
+func TestStoreReader(t *testing.T) {
+	server, err := NewImageServer()
+	if err != nil {
+		t.Fatalf("Failed to create image server: %v", err)
+	}
+	defer server.Close()
+
+	payload := bytes.Repeat([]byte("jpeg"), 10000)
+	url := server.StoreReader(bytes.NewReader(payload))
+
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("Fetch %d failed: %v", i, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Fetch %d: expected 200, got %d", i, resp.StatusCode)
+		}
+		if !bytes.Equal(body, payload) {
+			t.Errorf("Fetch %d: expected %d bytes, got %d", i, len(payload), len(body))
+		}
+	}
+}
+
+// TestDisplayJPEGReader tests that the TV is pointed at the streamed JPEG
+func TestDisplayJPEGReader(t *testing.T) {
+	tv, lastURI := recordingTV(t)
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	payload := noisyJPEG(t, 64, 36)
+	if err := renderer.DisplayJPEGReader(context.Background(), tv, bytes.NewReader(payload)); err != nil {
+		t.Fatalf("DisplayJPEGReader failed: %v", err)
+	}
+
+	uri := lastURI()
+	if uri == "" {
+		t.Fatal("Nothing reached the TV")
+	}
+	resp, err := http.Get(uri)
+	if err != nil {
+		t.Fatalf("Fetch %s: %v", uri, err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(body, payload) {
+		t.Errorf("TV got %d bytes, want the %d streamed", len(body), len(payload))
+	}
+}
+
+// closeReader records whether it was closed
+type closeReader struct {
+	io.Reader
+	closed atomic.Bool
+}
+
+func (c *closeReader) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+// TestStoreReaderRetry tests that a TV hanging up on the first fetch
+// doesn't lose the image
+func TestStoreReaderRetry(t *testing.T) {
+	server, err := NewImageServer()
+	if err != nil {
+		t.Fatalf("Failed to create image server: %v", err)
+	}
+	defer server.Close()
+
+	payload := bytes.Repeat([]byte("jpeg"), 1<<20)
+	url := server.StoreReader(bytes.NewReader(payload))
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("First fetch failed: %v", err)
+	}
+	io.ReadFull(resp.Body, make([]byte, 16))
+	resp.Body.Close()
+
+	resp, err = http.Get(url)
+	if err != nil {
+		t.Fatalf("Second fetch failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, payload) {
+		t.Errorf("Second fetch: expected %d bytes, got %d (HTTP %d)", len(payload), len(body), resp.StatusCode)
+	}
+}
+
+// TestStoreReaderEviction tests that streams nobody fetches are closed and
+// dropped like other stored images
+func TestStoreReaderEviction(t *testing.T) {
+	server, err := NewImageServer()
+	if err != nil {
+		t.Fatalf("Failed to create image server: %v", err)
+	}
+	defer server.Close()
+
+	readers := make([]*closeReader, 20)
+	for i := range readers {
+		readers[i] = &closeReader{Reader: strings.NewReader("jpeg")}
+		server.StoreReader(readers[i])
+	}
+
+	server.mu.RLock()
+	streams := len(server.streams)
+	server.mu.RUnlock()
+	if streams != 10 {
+		t.Errorf("Kept %d streams, want 10", streams)
+	}
+	// The oldest streams go first
+	waitFor(t, func() bool {
+		for _, r := range readers[:10] {
+			if !r.closed.Load() {
+				return false
+			}
+		}
+		return true
+	})
+	for i, r := range readers[10:] {
+		if r.closed.Load() {
+			t.Errorf("Stream %d closed, want one of the last 10 kept", 10+i)
+		}
+	}
+}
+
+// TestStoreEviction tests that fetched images are evicted oldest first,
+// while images nobody fetched yet are kept up to ten times the cap
+func TestStoreEviction(t *testing.T) {
+	server, err := NewImageServer(WithMaxImages(2))
+	if err != nil {
+		t.Fatalf("Failed to create image server: %v", err)
+	}
+	defer server.Close()
+
+	fetched := make([]string, 5)
+	for i := range fetched {
+		fetched[i] = server.Store([]byte{byte(i)})
+		resp, err := http.Get(fetched[i])
+		if err != nil {
+			t.Fatalf("Fetch image %d: %v", i, err)
+		}
+		resp.Body.Close()
+	}
+	unfetched := make([]string, 25)
+	for i := range unfetched {
+		unfetched[i] = server.Store([]byte{byte(i)})
+	}
+
+	for i, url := range fetched {
+		_, ok := server.lookup(url)
+		if want := i >= 3; ok != want {
+			t.Errorf("Fetched image %d kept = %v, want %v", i, ok, want)
+		}
+	}
+	for i, url := range unfetched {
+		_, ok := server.lookup(url)
+		if want := i >= 5; ok != want {
+			t.Errorf("Unfetched image %d kept = %v, want %v", i, ok, want)
+		}
+	}
+}
+
+// TestAccessLogger tests that served requests are reported to the access logger
+func TestAccessLogger(t *testing.T) {
+	entries := make(chan AccessEntry, 1)
+	server, err := NewImageServer(WithAccessLogger(func(e AccessEntry) {
+		entries <- e
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create image server: %v", err)
+	}
+	defer server.Close()
+
+	payload := []byte{0xFF, 0xD8, 0xFF, 0xD9}
+	url := server.Store(payload)
+
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("User-Agent", "TestTV/1.0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	e := <-entries
+	if !strings.HasSuffix(url, e.Path) {
+		t.Errorf("Expected path of %s, got %q", url, e.Path)
+	}
+	if e.Status != http.StatusOK || e.Bytes != int64(len(payload)) {
+		t.Errorf("Expected 200 and %d bytes, got %d and %d", len(payload), e.Status, e.Bytes)
+	}
+	if e.UserAgent != "TestTV/1.0" || e.ClientIP == "" {
+		t.Errorf("Unexpected client details: %+v", e)
+	}
+}
+
+// TestConditionalGet tests that unchanged images are answered with 304
+func TestConditionalGet(t *testing.T) {
+	server, err := NewImageServer()
+	if err != nil {
+		t.Fatalf("Failed to create image server: %v", err)
+	}
+	defer server.Close()
+
+	server.UpdateLatestFrame([]byte{0xFF, 0xD8, 0x01, 0xFF, 0xD9})
+	urls := []string{server.Store([]byte{0xFF, 0xD8, 0xFF, 0xD9}), server.StreamURL()}
+
+	for _, url := range urls {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("Fetch %s failed: %v", url, err)
+		}
+		resp.Body.Close()
+
+		etag := resp.Header.Get("ETag")
+		if etag == "" || (resp.Header.Get("Last-Modified") == "") != (url == server.StreamURL()) {
+			t.Fatalf("%s: expected ETag and Last-Modified for stored images only, got %v", url, resp.Header)
+		}
+
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set("If-None-Match", etag)
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Conditional fetch %s failed: %v", url, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNotModified {
+			t.Errorf("%s: expected 304, got %d", url, resp.StatusCode)
+		}
+	}
+
+	// A new frame invalidates the old ETag, even with the same image, and
+	// If-Modified-Since can't hide frames published within a second
+	for _, next := range [][]byte{{0xFF, 0xD8, 0x02, 0xFF, 0xD9}, {0xFF, 0xD8, 0x02, 0xFF, 0xD9}} {
+		resp, _ := http.Get(server.StreamURL())
+		resp.Body.Close()
+		etag := resp.Header.Get("ETag")
+		server.UpdateLatestFrame(next)
+
+		for _, header := range []string{"If-None-Match", "If-Modified-Since"} {
+			req, _ := http.NewRequest("GET", server.StreamURL(), nil)
+			if header == "If-None-Match" {
+				req.Header.Set(header, etag)
+			} else {
+				req.Header.Set(header, time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+			}
+			resp, err = http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Conditional fetch failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("%s: expected 200 for a new frame, got %d", header, resp.StatusCode)
+			}
+		}
+	}
+}
+
+// TestServerErr tests that a server dying on its own is reported, and a
+// closed one is not
+func TestServerErr(t *testing.T) {
+	server, err := NewImageServer()
+	if err != nil {
+		t.Fatalf("Failed to create image server: %v", err)
+	}
+
+	// Pull the listener from under the server, like running out of fds
+	server.listener.Close()
+	select {
+	case <-server.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Done to close when the server fails")
+	}
+	if err := server.Err(); err == nil || !strings.Contains(err.Error(), "image server") {
+		t.Errorf("Expected the server error, got %v", err)
+	}
+	server.Close()
+
+	closed, err := NewImageServer()
+	if err != nil {
+		t.Fatalf("Failed to create image server: %v", err)
+	}
+	closed.Close()
+	<-closed.Done()
+	if err := closed.Err(); err != nil {
+		t.Errorf("Expected no error after Close, got %v", err)
+	}
+}
+
+// TestLifecyclePanic tests that a panicking goroutine ends the lifecycle
+// instead of the process
+func TestLifecyclePanic(t *testing.T) {
+	life := newLifecycle()
+	life.Go("loop", func() error { panic("boom") })
+	<-life.Done()
+	if err := life.Err(); err == nil || !strings.Contains(err.Error(), "loop panicked: boom") {
+		t.Errorf("Expected the panic as error, got %v", err)
+	}
+}
+
+// TestPathPrefixAndRandomIDs tests that images are served under the prefix
+// with unguessable names
+func TestPathPrefixAndRandomIDs(t *testing.T) {
+	server, err := NewImageServer(WithPathPrefix("smarttv/"), WithRandomIDs())
+	if err != nil {
+		t.Fatalf("Failed to create image server: %v", err)
+	}
+	defer server.Close()
+
+	first := server.Store([]byte("one"))
+	second := server.Store([]byte("two"))
+	prefix := server.URL() + "/smarttv/img_"
+	if !strings.HasPrefix(first, prefix) || !strings.HasSuffix(first, ".jpg") {
+		t.Errorf("Unexpected image URL %s", first)
+	}
+	if strings.TrimPrefix(first, prefix) == strings.TrimPrefix(second, prefix) || len(strings.TrimPrefix(first, prefix)) < 20 {
+		t.Errorf("Expected distinct random IDs, got %s and %s", first, second)
+	}
+
+	resp, err := http.Get(first)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "one" {
+		t.Errorf("Expected the image under the prefix, got %d %q", resp.StatusCode, body)
+	}
+
+	if want := server.URL() + "/smarttv/stream.jpg"; server.StreamURL() != want {
+		t.Errorf("Expected stream URL %s, got %s", want, server.StreamURL())
+	}
+	server.UpdateLatestFrame([]byte("frame"))
+	resp, err = http.Get(server.StreamURL())
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the stream under the prefix, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,158 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrNoSession is returned by StopSession when no TV shows the session
+var ErrNoSession = errors.New("no such session")
+
+// Session names what is being displayed and who owns it, e.g.
+// {Name: "fire-drill-alert", Owner: "alerts-service"}
+type Session struct {
+	Name   string
+	Owner  string
+	Labels map[string]string
+
+	// Priority orders sessions passed to Present; higher preempts lower
+	Priority int
+
+	// Persistent sessions are cast again by a KeepAlive when the TV stops
+	// showing them on its own
+	Persistent bool
+
+	// File videos are recorded to (see RecordTo)
+	record string
+}
+
+// sessionKey is the context key for the current Session
+type sessionKey struct{}
+
+// WithSession returns a context whose display calls are recorded under
+// session, so they show up by name in Renderer.State:
+//
+//	ctx = smarttv.WithSession(ctx, smarttv.Session{Name: "menu", Owner: "kitchen"})
+//	renderer.DisplayImage(ctx, tv, img)
+func WithSession(ctx context.Context, session Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, session)
+}
+
+// SessionFrom returns the session attached to ctx, if any
+func SessionFrom(ctx context.Context) (Session, bool) {
+	session, ok := ctx.Value(sessionKey{}).(Session)
+	return session, ok
+}
+
+// SessionState describes what a TV is currently showing
+type SessionState struct {
+	TV      *TV
+	Session Session   // Empty for calls without WithSession
+	Kind    string    // "image" or "video"
+	Started time.Time // First display of this session on the TV
+	Updated time.Time // Most recent display
+
+	// File the video is recorded to (see Session.RecordTo)
+	Recording string
+
+	// Stream of video sessions, to cast them again
+	videoURL   string
+	videoTitle string
+	recorder   *streamRecorder
+}
+
+// recordSession notes that ctx's session is now on the TV
+func (r *Renderer) recordSession(ctx context.Context, tv *TV, kind string) {
+	session, _ := SessionFrom(ctx)
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, ok := r.sessions[tv.ControlURL]
+	if ok && state.Session.Name == session.Name && state.Session.Owner == session.Owner && state.Kind == kind {
+		state.Session = session
+		state.Updated = now
+		return
+	}
+	if ok {
+		r.stopRecording(state)
+	}
+	r.sessions[tv.ControlURL] = &SessionState{TV: tv, Session: session, Kind: kind, Started: now, Updated: now}
+}
+
+// recordVideo notes that ctx's session is now streaming a video on the
+// TV, recorded by rec (if not nil)
+func (r *Renderer) recordVideo(ctx context.Context, tv *TV, videoURL string, title string, rec *streamRecorder) {
+	r.recordSession(ctx, tv, "video")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state := r.sessions[tv.ControlURL]
+	if state.recorder != rec {
+		r.stopRecording(state)
+	}
+	state.videoURL = videoURL
+	state.videoTitle = title
+	state.recorder = rec
+	if rec != nil {
+		state.Recording = rec.path
+	}
+}
+
+// stopRecording ends the recording of a session's video, unless another
+// TV still plays it; r.mu must be held
+func (r *Renderer) stopRecording(state *SessionState) {
+	rec := state.recorder
+	if rec == nil {
+		return
+	}
+	state.recorder, state.Recording = nil, ""
+	for _, other := range r.sessions {
+		if other.recorder == rec {
+			return
+		}
+	}
+	r.server.stopRecording(rec)
+}
+
+// clearSession forgets the TV's session after it was stopped
+func (r *Renderer) clearSession(tv *TV) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if state, ok := r.sessions[tv.ControlURL]; ok {
+		r.stopRecording(state)
+	}
+	delete(r.sessions, tv.ControlURL)
+}
+
+// State returns the session active on each TV, sorted by TV name
+func (r *Renderer) State() []SessionState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	states := make([]SessionState, 0, len(r.sessions))
+	for _, state := range r.sessions {
+		states = append(states, *state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].TV.Name < states[j].TV.Name })
+	return states
+}
+
+// StopSession stops every TV currently showing the named session and
+// leaves other TVs alone
+func (r *Renderer) StopSession(ctx context.Context, name string) error {
+	var tvs []*TV
+	for _, state := range r.State() {
+		if state.Session.Name == name {
+			tvs = append(tvs, state.TV)
+		}
+	}
+	if len(tvs) == 0 {
+		return ErrNoSession
+	}
+
+	return fanOut(ctx, tvs, r.Stop)
+}
@@ -0,0 +1,55 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestSessions tests that named sessions appear in State and stop selectively
+func TestSessions(t *testing.T) {
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	lobby := &TV{Name: "Lobby", ControlURL: mockTV.URL + "/lobby"}
+	bar := &TV{Name: "Bar", ControlURL: mockTV.URL + "/bar"}
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	ctx := context.Background()
+	alert := WithSession(ctx, Session{Name: "fire-drill-alert", Owner: "alerts-service"})
+	if err := renderer.DisplayText(alert, lobby, "DRILL"); err != nil {
+		t.Fatalf("DisplayText failed: %v", err)
+	}
+	if err := renderer.StreamVideo(WithSession(ctx, Session{Name: "match"}), bar, "http://example.com/live.m3u8", ""); err != nil {
+		t.Fatalf("StreamVideo failed: %v", err)
+	}
+
+	state := renderer.State()
+	if len(state) != 2 {
+		t.Fatalf("Expected 2 sessions, got %d", len(state))
+	}
+	if state[1].TV != lobby || state[1].Session.Owner != "alerts-service" || state[1].Kind != "image" {
+		t.Errorf("Unexpected lobby state: %+v", state[1])
+	}
+
+	if err := renderer.StopSession(ctx, "fire-drill-alert"); err != nil {
+		t.Fatalf("StopSession failed: %v", err)
+	}
+	state = renderer.State()
+	if len(state) != 1 || state[0].Session.Name != "match" {
+		t.Errorf("Expected only the match session left, got %+v", state)
+	}
+
+	if err := renderer.StopSession(ctx, "fire-drill-alert"); !errors.Is(err, ErrNoSession) {
+		t.Errorf("Expected ErrNoSession, got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package nimsforestsmarttv
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// slugFold spells accented Latin letters without their accents
+var slugFold = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a", "æ", "ae",
+	"ç", "c", "č", "c", "ć", "c", "ď", "d", "ð", "d",
+	"è", "e", "é", "e", "ê", "e", "ë", "e", "ě", "e", "ę", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i", "ı", "i", "ğ", "g",
+	"ł", "l", "ñ", "n", "ń", "n", "ň", "n",
+	"ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ø", "o", "ő", "o", "œ", "oe",
+	"ř", "r", "ß", "ss", "š", "s", "ś", "s", "ş", "s", "ť", "t", "þ", "th",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u", "ů", "u", "ű", "u",
+	"ý", "y", "ÿ", "y", "ž", "z", "ź", "z", "ż", "z",
+)
+
+// Slugify turns a TV's friendly name into a name that is easy to type on
+// a command line: lower case, accents removed, and emoji, punctuation and
+// whitespace collapsed into single dashes ("🍳 Kitchen – Samsung QN90"
+// becomes "kitchen-samsung-qn90"). Letters of other scripts are kept.
+// Names without any letter or digit become "tv".
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range slugFold.Replace(strings.ToLower(name)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(r)
+		case unicode.Is(unicode.Mn, r) || r == '\'' || r == '’':
+			// Combining accents and apostrophes ("Bob's") vanish
+		default:
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return "tv"
+	}
+	return b.String()
+}
+
+// uniqueSlug returns base, or base with a number appended if taken
+func uniqueSlug(base string, taken func(slug string) bool) string {
+	slug := base
+	for n := 2; taken(slug); n++ {
+		slug = base + "-" + strconv.Itoa(n)
+	}
+	return slug
+}
+
+// Matches reports whether nameOrID addresses the TV: its UDN, its friendly
+// name (case-insensitive) or its slug
+func (tv *TV) Matches(nameOrID string) bool {
+	return nameOrID != "" && (nameOrID == tv.UDN || strings.EqualFold(nameOrID, tv.Name) ||
+		(tv.Slug != "" && strings.EqualFold(nameOrID, tv.Slug)))
+}
@@ -0,0 +1,40 @@
+package nimsforestsmarttv
+
+import "testing"
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"🍳 Kitchen – Samsung QN90":     "kitchen-samsung-qn90",
+		"[TV] Samsung Q60 Series (55)": "tv-samsung-q60-series-55",
+		"  Télé du Salon  ":            "tele-du-salon",
+		"Bob's 📺":                      "bobs",
+		"リビング TV":                      "リビング-tv",
+		"🔥✨":                           "tv",
+	}
+	for name, want := range tests {
+		if got := Slugify(name); got != want {
+			t.Errorf("Slugify(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestRegistrySlugs(t *testing.T) {
+	reg := NewRegistry()
+	reg.AddTV(TV{Name: "[TV] Samsung 🏠", UDN: "uuid:a"})
+	reg.AddTV(TV{Name: "[TV] Samsung", UDN: "uuid:b"})
+	reg.AddTV(TV{Name: "[TV] Samsung 🏠", UDN: "uuid:a", IP: "10.0.0.9"}) // Rediscovered
+
+	a, ok := reg.Lookup("tv-samsung")
+	if !ok || a.UDN != "uuid:a" || a.IP != "10.0.0.9" {
+		t.Errorf("tv-samsung = %+v, want the first TV keeping its slug", a)
+	}
+	b, ok := reg.Lookup("TV-Samsung-2")
+	if !ok || b.UDN != "uuid:b" {
+		t.Errorf("TV-Samsung-2 = %+v, want the second TV", b)
+	}
+
+	reg.SetZone("home", "tv-samsung", "tv-samsung-2")
+	if tvs, err := reg.Zone("home"); err != nil || len(tvs) != 2 {
+		t.Errorf("zone of slugs: %v, %v", tvs, err)
+	}
+}
@@ -0,0 +1,169 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"image"
+)
+
+// SubjectDetector finds the part of a photo that must not be cropped away,
+// such as faces. Plug in a real face detector (e.g. cgo bindings to a
+// vision library) with WithSubjectDetector.
+type SubjectDetector interface {
+	// Detect returns the bounding box of the subject, or false if there is
+	// nothing to focus on
+	Detect(img image.Image) (image.Rectangle, bool)
+}
+
+// SaliencyDetector is a simple SubjectDetector that looks for detail (edges)
+// and skin tones. It has no notion of faces, but keeps people and busy
+// areas in frame far more often than a center crop.
+type SaliencyDetector struct {
+	// SkinWeight is the extra energy of skin-colored pixels (default 64)
+	SkinWeight int
+}
+
+// saliencyGrid is the width of the downscaled image the detector works on
+const saliencyGrid = 64
+
+// Detect returns the box holding the central 80% of the image's energy
+// along each axis
+func (d SaliencyDetector) Detect(img image.Image) (image.Rectangle, bool) {
+	skinWeight := d.SkinWeight
+	if skinWeight == 0 {
+		skinWeight = 64
+	}
+
+	b := img.Bounds()
+	if b.Empty() {
+		return image.Rectangle{}, false
+	}
+	gw := min(saliencyGrid, b.Dx())
+	gh := max(b.Dy()*gw/b.Dx(), 1)
+	small := scaleImage(img, b, gw, gh)
+
+	luma := func(x, y int) int {
+		p := small.Pix[y*small.Stride+x*4:]
+		return (299*int(p[0]) + 587*int(p[1]) + 114*int(p[2])) / 1000
+	}
+
+	// Energy per column and row
+	cols := make([]int, gw)
+	rows := make([]int, gh)
+	total := 0
+	for y := 0; y < gh; y++ {
+		for x := 0; x < gw; x++ {
+			e := 0
+			if x+1 < gw {
+				e += abs(luma(x, y) - luma(x+1, y))
+			}
+			if y+1 < gh {
+				e += abs(luma(x, y) - luma(x, y+1))
+			}
+			p := small.Pix[y*small.Stride+x*4:]
+			if isSkin(p[0], p[1], p[2]) {
+				e += skinWeight
+			}
+			cols[x] += e
+			rows[y] += e
+			total += e
+		}
+	}
+	if total == 0 {
+		return image.Rectangle{}, false
+	}
+
+	x0, x1 := energySpan(cols, total)
+	y0, y1 := energySpan(rows, total)
+
+	// Map grid cells back to the source image
+	return image.Rect(
+		b.Min.X+x0*b.Dx()/gw,
+		b.Min.Y+y0*b.Dy()/gh,
+		b.Min.X+(x1+1)*b.Dx()/gw,
+		b.Min.Y+(y1+1)*b.Dy()/gh,
+	), true
+}
+
+// energySpan returns the first and last index between the 10th and 90th
+// percentile of the energy
+func energySpan(energy []int, total int) (first, last int) {
+	sum := 0
+	first, last = -1, len(energy)-1
+	for i, e := range energy {
+		sum += e
+		if first < 0 && sum*10 > total {
+			first = i
+		}
+		if sum*10 >= total*9 {
+			last = i
+			break
+		}
+	}
+	return max(first, 0), last
+}
+
+// isSkin reports whether a color is in the common range of skin tones
+func isSkin(r, g, b uint8) bool {
+	return r > 95 && g > 40 && b > 20 && r > g && r > b &&
+		int(r)-int(min(g, b)) > 15 && abs(int(r)-int(g)) > 15
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// SmartCrop returns the region of img with the aspect ratio w:h that keeps
+// the subject found by detector in frame. It crops as little as a center
+// crop would, only shifted. Subjects taller than the crop keep their top
+// edge, where heads usually are.
+func SmartCrop(img image.Image, w, h int, detector SubjectDetector) image.Rectangle {
+	src := img.Bounds()
+	crop := coverRect(src, w, h)
+	if detector == nil {
+		return crop
+	}
+	subject, ok := detector.Detect(img)
+	if !ok {
+		return crop
+	}
+
+	cw, ch := crop.Dx(), crop.Dy()
+	x := (subject.Min.X+subject.Max.X)/2 - cw/2
+	y := (subject.Min.Y+subject.Max.Y)/2 - ch/2
+	if subject.Dx() > cw {
+		x = subject.Min.X
+	}
+	if subject.Dy() > ch {
+		y = subject.Min.Y - ch/10
+	}
+
+	x = clampInt(x, src.Min.X, src.Max.X-cw)
+	y = clampInt(y, src.Min.Y, src.Max.Y-ch)
+	return image.Rect(x, y, x+cw, y+ch)
+}
+
+// WithSubjectDetector crops photos around their subject instead of their
+// center wherever they are fitted to a canvas (DisplayPhoto, collages and
+// video walls). SaliencyDetector is a simple detector to start with.
+func WithSubjectDetector(detector SubjectDetector) Option {
+	return func(r *Renderer) {
+		r.detector = detector
+	}
+}
+
+// cropRect returns the region of img to scale to w x h, using the subject
+// detector if one is set
+func (r *Renderer) cropRect(img image.Image, w, h int) image.Rectangle {
+	return SmartCrop(img, w, h, r.detector)
+}
+
+// DisplayPhoto fills a 1920x1080 frame with the photo, cropping what
+// doesn't fit. With a subject detector the crop follows the subject, so
+// portrait photos don't lose people's heads.
+func (r *Renderer) DisplayPhoto(ctx context.Context, tv *TV, photo image.Image) error {
+	const w, h = 1920, 1080
+	return r.DisplayImage(ctx, tv, r.resizer.Resize(photo, r.cropRect(photo, w, h), w, h))
+}
@@ -0,0 +1,102 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// TestSmartCrop tests that the crop follows the subject of a portrait photo
+func TestSmartCrop(t *testing.T) {
+	// Portrait photo with a detailed, skin-toned subject near the top
+	photo := solid(300, 600, color.RGBA{20, 30, 60, 255})
+	skin := color.RGBA{220, 170, 140, 255}
+	for y := 60; y < 140; y++ {
+		for x := 100; x < 200; x++ {
+			if (x/4+y/4)%2 == 0 {
+				photo.Set(x, y, skin)
+			} else {
+				photo.Set(x, y, Black)
+			}
+		}
+	}
+	subject := image.Rect(100, 60, 200, 140)
+
+	center := SmartCrop(photo, 1920, 1080, nil)
+	if center.Overlaps(subject) {
+		t.Fatalf("Expected the center crop %v to miss the subject", center)
+	}
+
+	crop := SmartCrop(photo, 1920, 1080, SaliencyDetector{})
+	if crop.Dx() != center.Dx() || crop.Dy() != center.Dy() {
+		t.Errorf("Expected the same crop size as the center crop, got %v", crop)
+	}
+	if !subject.In(crop) {
+		t.Errorf("Expected the crop %v to contain the subject %v", crop, subject)
+	}
+}
+
+// TestSaliencyDetectorFlat tests that flat images have no subject
+func TestSaliencyDetectorFlat(t *testing.T) {
+	if _, ok := (SaliencyDetector{}).Detect(solid(100, 100, Gray)); ok {
+		t.Error("Expected no subject in a flat image")
+	}
+}
+
+// fixedSubject is a SubjectDetector that always finds the same subject
+type fixedSubject image.Rectangle
+
+func (f fixedSubject) Detect(image.Image) (image.Rectangle, bool) {
+	return image.Rectangle(f), true
+}
+
+// TestDisplayPhoto tests that photos reach the TV as full frames cropped
+// around the subject when a detector is set
+func TestDisplayPhoto(t *testing.T) {
+	// Portrait photo with a red band at the top, blue below
+	photo := solid(300, 600, Blue)
+	for y := range 100 {
+		for x := range 300 {
+			photo.Set(x, y, Red)
+		}
+	}
+
+	isRed := func(c color.Color) bool {
+		r, _, b, _ := c.RGBA()
+		return r>>8 > 200 && b>>8 < 60
+	}
+
+	tests := []struct {
+		name    string
+		options []Option
+		wantRed bool
+	}{
+		{"center crop", nil, false},
+		{"subject crop", []Option{WithSubjectDetector(fixedSubject(image.Rect(0, 0, 300, 100)))}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tv, lastURI := recordingTV(t)
+
+			renderer, err := NewRenderer(tt.options...)
+			if err != nil {
+				t.Fatalf("Failed to create renderer: %v", err)
+			}
+			defer renderer.Close()
+
+			if err := renderer.DisplayPhoto(context.Background(), tv, photo); err != nil {
+				t.Fatalf("DisplayPhoto failed: %v", err)
+			}
+
+			frame := fetchJPEG(t, lastURI())
+			if frame.Bounds() != image.Rect(0, 0, 1920, 1080) {
+				t.Fatalf("Sent a %v frame, want 1920x1080", frame.Bounds())
+			}
+			if got := isRed(frame.At(960, 10)); got != tt.wantRed {
+				t.Errorf("Top of the frame is %v, want red %v", frame.At(960, 10), tt.wantRed)
+			}
+		})
+	}
+}
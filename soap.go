@@ -0,0 +1,213 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SOAPError is a failed SOAP call. TVs report most failures as a UPnP
+// fault with an error code (e.g. 701 "Transition not available"); Code is
+// 0 when the TV only answered with an HTTP error.
+type SOAPError struct {
+	Action      string
+	HTTPStatus  int
+	Code        int    // UPnP errorCode
+	Description string // UPnP errorDescription, or the fault string
+	Body        string // Raw response when there was no fault to parse
+}
+
+func (e *SOAPError) Error() string {
+	switch {
+	case e.Code != 0 && e.Description != "":
+		return fmt.Sprintf("%s: UPnP error %d: %s", e.Action, e.Code, e.Description)
+	case e.Code != 0:
+		return fmt.Sprintf("%s: UPnP error %d", e.Action, e.Code)
+	case e.Description != "":
+		return fmt.Sprintf("%s: SOAP error: HTTP %d: %s", e.Action, e.HTTPStatus, e.Description)
+	default:
+		return fmt.Sprintf("%s: SOAP error: HTTP %d: %s", e.Action, e.HTTPStatus, e.Body)
+	}
+}
+
+// soapEnvelopeXML is the part of a SOAP response envelope we read
+type soapEnvelopeXML struct {
+	Body struct {
+		Content []byte `xml:",innerxml"`
+	} `xml:"Body"`
+}
+
+// soapFaultXML is a SOAP fault carrying a UPnP error
+type soapFaultXML struct {
+	FaultString string `xml:"faultstring"`
+	Detail      struct {
+		UPnPError struct {
+			Code        int    `xml:"errorCode"`
+			Description string `xml:"errorDescription"`
+		} `xml:"UPnPError"`
+	} `xml:"detail"`
+}
+
+// maxSOAPResponse bounds the size of a SOAP response
+const maxSOAPResponse = 1 << 20
+
+// readSOAPResponse checks a SOAP response and returns the output arguments
+// of the action by name. A 2xx response with an empty body, or one that
+// isn't SOAP at all, is a success without arguments, which many TVs send
+// for Play and Stop.
+func readSOAPResponse(action string, status int, body io.Reader) (map[string]string, error) {
+	data, err := readLimited(body, maxSOAPResponse)
+	if err != nil {
+		return nil, fmt.Errorf("read SOAP response: %w", err)
+	}
+
+	out, fault, err := parseSOAPBody(action, data)
+	switch {
+	case fault != nil:
+		fault.HTTPStatus = status
+		return nil, fault
+	case status < 200 || status > 299:
+		return nil, &SOAPError{Action: action, HTTPStatus: status, Body: string(data)}
+	case err != nil:
+		return nil, nil
+	}
+	return out, nil
+}
+
+// parseSOAPBody returns either the output arguments of action or the fault
+// in a SOAP response envelope
+func parseSOAPBody(action string, data []byte) (map[string]string, *SOAPError, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil, nil
+	}
+
+	var env soapEnvelopeXML
+	if err := xml.Unmarshal(data, &env); err != nil {
+		return nil, nil, err
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(env.Body.Content))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			// Empty body: nothing to return
+			return nil, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "Fault":
+			var f soapFaultXML
+			if err := dec.DecodeElement(&f, &start); err != nil {
+				return nil, nil, err
+			}
+			fault := &SOAPError{
+				Action:      action,
+				Code:        f.Detail.UPnPError.Code,
+				Description: strings.TrimSpace(f.Detail.UPnPError.Description),
+			}
+			if fault.Code == 0 && fault.Description == "" {
+				fault.Description = strings.TrimSpace(f.FaultString)
+			}
+			return nil, fault, nil
+
+		case action + "Response":
+			out, err := soapArgs(dec)
+			return out, nil, err
+
+		default:
+			return nil, nil, fmt.Errorf("unexpected element <%s>, want <%sResponse>", start.Name.Local, action)
+		}
+	}
+}
+
+// soapArgs reads the child elements of the current element into a map of
+// name to text
+func soapArgs(dec *xml.Decoder) (map[string]string, error) {
+	out := make(map[string]string)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			var value string
+			if err := dec.DecodeElement(&value, &t); err != nil {
+				return nil, err
+			}
+			out[t.Name.Local] = strings.TrimSpace(value)
+		case xml.EndElement:
+			return out, nil
+		}
+	}
+}
+
+// callSOAP calls an AVTransport action and returns its output arguments
+func (tv *TV) callSOAP(ctx context.Context, action string, args string) (map[string]string, error) {
+	if !tv.SupportsAction(action) {
+		return nil, tv.wrapError(action, tv.ControlURL, ErrUnsupportedAction)
+	}
+	return tv.sendServiceSOAP(ctx, tv.ControlURL, tv.avTransportType(), action, tv.soapEnvelope(action, args))
+}
+
+// TransportInfo is the playback state reported by GetTransportInfo
+type TransportInfo struct {
+	State  string // e.g. PLAYING, STOPPED, PAUSED_PLAYBACK, TRANSITIONING, NO_MEDIA_PRESENT
+	Status string // OK or ERROR_OCCURRED
+	Speed  string // Usually "1"
+}
+
+// GetTransportInfo asks the TV for its playback state
+func (tv *TV) GetTransportInfo(ctx context.Context) (TransportInfo, error) {
+	out, err := tv.callSOAP(ctx, "GetTransportInfo", `
+      <InstanceID>0</InstanceID>`)
+	if err != nil {
+		return TransportInfo{}, err
+	}
+	return TransportInfo{
+		State:  out["CurrentTransportState"],
+		Status: out["CurrentTransportStatus"],
+		Speed:  out["CurrentSpeed"],
+	}, nil
+}
+
+// PositionInfo is the current track and position reported by
+// GetPositionInfo
+type PositionInfo struct {
+	Track         string
+	TrackDuration string // H:MM:SS
+	TrackURI      string
+	RelTime       string // Position in the track, H:MM:SS
+}
+
+// GetPositionInfo asks the TV what it is playing and how far along it is
+func (tv *TV) GetPositionInfo(ctx context.Context) (PositionInfo, error) {
+	out, err := tv.callSOAP(ctx, "GetPositionInfo", `
+      <InstanceID>0</InstanceID>`)
+	if err != nil {
+		return PositionInfo{}, err
+	}
+	return PositionInfo{
+		Track:         out["Track"],
+		TrackDuration: out["TrackDuration"],
+		TrackURI:      out["TrackURI"],
+		RelTime:       out["RelTime"],
+	}, nil
+}
+
+// IsUPnPError reports whether err is a UPnP fault with the given code
+func IsUPnPError(err error, code int) bool {
+	var se *SOAPError
+	return errors.As(err, &se) && se.Code == code
+}
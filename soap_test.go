@@ -0,0 +1,124 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestReadSOAPResponse tests parsing of action responses and faults
+func TestReadSOAPResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantArgs map[string]string
+		wantCode int
+		wantErr  string
+	}{
+		{
+			name:   "empty body",
+			status: 200,
+			body:   "",
+		},
+		{
+			name:   "empty envelope",
+			status: 200,
+			body:   `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body></s:Body></s:Envelope>`,
+		},
+		{
+			name:   "response arguments",
+			status: 200,
+			body: `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>
+				<u:GetTransportInfoResponse xmlns:u="urn:schemas-upnp-org:service:AVTransport:1">
+					<CurrentTransportState>PLAYING</CurrentTransportState>
+					<CurrentSpeed>1</CurrentSpeed>
+				</u:GetTransportInfoResponse></s:Body></s:Envelope>`,
+			wantArgs: map[string]string{"CurrentTransportState": "PLAYING", "CurrentSpeed": "1"},
+		},
+		{
+			name:     "UPnP fault",
+			status:   500,
+			body:     soapFault(701, "Transition not available"),
+			wantCode: 701,
+			wantErr:  "GetTransportInfo: UPnP error 701: Transition not available",
+		},
+		{
+			name:     "fault with HTTP 200",
+			status:   200,
+			body:     soapFault(718, "Invalid InstanceID"),
+			wantCode: 718,
+			wantErr:  "UPnP error 718",
+		},
+		{
+			name:    "HTTP error without fault",
+			status:  503,
+			body:    "busy",
+			wantErr: "SOAP error: HTTP 503: busy",
+		},
+		{
+			name:   "malformed on success",
+			status: 200,
+			body:   "<s:Envelope><s:Body>",
+		},
+		{
+			name:   "not XML on success",
+			status: 200,
+			body:   "OK",
+		},
+		{
+			name:   "no content",
+			status: 204,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := readSOAPResponse("GetTransportInfo", tt.status, strings.NewReader(tt.body))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if tt.wantCode != 0 && !IsUPnPError(err, tt.wantCode) {
+				t.Errorf("Expected UPnP error %d, got %v", tt.wantCode, err)
+			}
+			for k, v := range tt.wantArgs {
+				if args[k] != v {
+					t.Errorf("%s = %q, want %q", k, args[k], v)
+				}
+			}
+		})
+	}
+}
+
+// TestGetTransportInfo tests reading the playback state from a TV
+func TestGetTransportInfo(t *testing.T) {
+	vtv, err := NewVirtualTV("Den")
+	if err != nil {
+		t.Fatalf("NewVirtualTV failed: %v", err)
+	}
+	defer vtv.Close()
+
+	ctx := context.Background()
+	tv := vtv.TV()
+
+	info, err := tv.GetTransportInfo(ctx)
+	if err != nil {
+		t.Fatalf("GetTransportInfo failed: %v", err)
+	}
+	if info.State != "NO_MEDIA_PRESENT" || info.Status != "OK" {
+		t.Errorf("Unexpected transport info: %+v", info)
+	}
+
+	// The virtual TV doesn't implement GetPositionInfo
+	tv.Actions = nil
+	_, err = tv.GetPositionInfo(ctx)
+	var se *SOAPError
+	if !errors.As(err, &se) || se.Code != 401 || se.HTTPStatus != 500 {
+		t.Errorf("Expected UPnP error 401, got %v", err)
+	}
+}
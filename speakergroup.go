@@ -0,0 +1,291 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSpeakerLead bounds the learned start compensation of one speaker
+const maxSpeakerLead = 2 * time.Second
+
+// SpeakerSync is how one speaker of a SpeakerGroup is doing
+type SpeakerSync struct {
+	TV *TV
+
+	// Lead is how much earlier than its command latency the speaker is
+	// sent Play, learned from earlier drift checks
+	Lead time.Duration
+
+	// Lag is how long after the group's target start the speaker began
+	// playing, estimated from its position
+	Lag time.Duration
+
+	// Drift is the speaker's position relative to the group's median;
+	// positive is ahead
+	Drift time.Duration
+
+	// RTT is the round trip of the last position query
+	RTT time.Duration
+
+	Resyncs int   // Seeks to pull the speaker back in line
+	Err     error // Why the last check failed (nil = ok)
+}
+
+// SyncQuality describes how well the speakers of a group play together
+type SyncQuality struct {
+	Speakers []SpeakerSync
+
+	// Spread is the distance between the speakers furthest ahead and
+	// behind. Below ~30ms the rooms sound like one; above ~100ms an echo
+	// is heard where two speakers can be heard at once.
+	Spread time.Duration
+
+	// Precision is how far off the measurement may be: half the slowest
+	// round trip, plus a second for TVs that report whole seconds only
+	Precision time.Duration
+
+	CheckedAt time.Time
+}
+
+// SpeakerGroup plays the same audio on several renderers at once, as
+// best-effort multi-room audio. Play is sent staggered by each speaker's
+// command latency and a lead learned from earlier plays; Check measures how
+// far the speakers drifted apart and reports the SyncQuality. DLNA has no
+// shared clock, so expect tens to hundreds of milliseconds, depending on
+// the TVs. It is safe for concurrent use.
+type SpeakerGroup struct {
+	renderer *Renderer
+	tvs      []*TV
+	interval time.Duration
+
+	mu        sync.Mutex
+	start     time.Time                // Target start of the audio playing
+	leads     map[string]time.Duration // Learned start compensation per TV
+	learned   map[string]bool          // TVs whose lead was learned from the current play
+	resyncs   map[string]int
+	maxDrift  time.Duration
+	quality   SyncQuality
+	listeners []func(SyncQuality)
+}
+
+// NewSpeakerGroup creates a group of speakers whose drift is checked every
+// interval (default 10s) while Run runs
+func NewSpeakerGroup(renderer *Renderer, tvs []*TV, interval time.Duration) *SpeakerGroup {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return &SpeakerGroup{
+		renderer: renderer,
+		tvs:      tvs,
+		interval: interval,
+		leads:    make(map[string]time.Duration),
+		learned:  make(map[string]bool),
+		resyncs:  make(map[string]int),
+	}
+}
+
+// SetMaxDrift makes Check seek speakers that drifted more than d from the
+// group back in line, on TVs that support Seek. 0 (default) only measures.
+func (g *SpeakerGroup) SetMaxDrift(d time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.maxDrift = d
+}
+
+// OnCheck registers fn to be called with the result of every drift check.
+// fn runs on the checking goroutine and should not block.
+func (g *SpeakerGroup) OnCheck(fn func(SyncQuality)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.listeners = append(g.listeners, fn)
+}
+
+// Play starts the audio at audioURL on every speaker at the same moment.
+// Speakers must be DLNA renderers; others fail with ErrUnsupportedAction
+// before any speaker is loaded.
+func (g *SpeakerGroup) Play(ctx context.Context, audioURL string, title string) (SyncReport, error) {
+	for _, tv := range g.tvs {
+		if tv.Protocol != ProtocolDLNA {
+			return SyncReport{}, tv.wrapError("SpeakerGroup.Play", "", ErrUnsupportedAction)
+		}
+	}
+	if err := g.renderer.checkMediaURL(ctx, audioURL); err != nil {
+		return SyncReport{}, err
+	}
+	track := Track{URL: audioURL, Title: title}
+	load := func(ctx context.Context, tv *TV) error {
+		if err := g.renderer.intend(ctx, tv, JournalAudio, audioURL, "", title); err != nil {
+			return err
+		}
+		if err := tv.setAVTransportURIMetadata(ctx, audioURL, trackMetadata(track)); err != nil {
+			return fmt.Errorf("set URI: %w", err)
+		}
+		return nil
+	}
+
+	g.mu.Lock()
+	leads := make(map[string]time.Duration, len(g.leads))
+	for key, lead := range g.leads {
+		leads[key] = lead
+	}
+	g.mu.Unlock()
+
+	report, err := g.renderer.startSynced(ctx, g.tvs, load, func(tv *TV) time.Duration {
+		return leads[tv.ControlURL]
+	})
+
+	g.mu.Lock()
+	g.start = report.Start
+	g.learned = make(map[string]bool)
+	g.mu.Unlock()
+	return report, err
+}
+
+// Stop stops every speaker
+func (g *SpeakerGroup) Stop(ctx context.Context) error {
+	g.mu.Lock()
+	g.start = time.Time{}
+	g.mu.Unlock()
+	return fanOut(ctx, g.tvs, g.renderer.Stop)
+}
+
+// Quality returns the result of the last check
+func (g *SpeakerGroup) Quality() SyncQuality {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	q := g.quality
+	q.Speakers = slices.Clone(q.Speakers)
+	return q
+}
+
+// Run checks the drift every interval until ctx is done
+func (g *SpeakerGroup) Run(ctx context.Context) error {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		g.Check(ctx)
+	}
+}
+
+// speakerPosition is one measured playback position
+type speakerPosition struct {
+	started time.Time // When the speaker was at position 0
+	rtt     time.Duration
+	coarse  bool // Whole seconds only
+	err     error
+}
+
+// Check measures every speaker's position once, learns the start
+// compensation from the first check of each play and, with SetMaxDrift,
+// seeks speakers that drifted too far
+func (g *SpeakerGroup) Check(ctx context.Context) (SyncQuality, error) {
+	g.mu.Lock()
+	start, maxDrift := g.start, g.maxDrift
+	listeners := slices.Clone(g.listeners)
+	g.mu.Unlock()
+	if start.IsZero() {
+		return SyncQuality{}, fmt.Errorf("speaker group is not playing")
+	}
+
+	positions := make([]speakerPosition, len(g.tvs))
+	fanOut(ctx, g.tvs, func(ctx context.Context, tv *TV) error {
+		p := &positions[slices.Index(g.tvs, tv)]
+		sent := time.Now()
+		info, err := tv.GetPositionInfo(ctx)
+		p.rtt = time.Since(sent)
+		if err != nil {
+			p.err = err
+			return nil
+		}
+		pos, ok := parseUPnPDuration(info.RelTime)
+		if !ok {
+			p.err = fmt.Errorf("no position reported (%q)", info.RelTime)
+			return nil
+		}
+		// The TV answered halfway through the round trip
+		p.started = sent.Add(p.rtt / 2).Add(-pos)
+		p.coarse = !strings.Contains(info.RelTime, ".")
+		return nil
+	})
+
+	var starts []time.Time
+	for _, p := range positions {
+		if p.err == nil {
+			starts = append(starts, p.started)
+		}
+	}
+	quality := SyncQuality{Speakers: make([]SpeakerSync, len(g.tvs)), CheckedAt: time.Now()}
+	if len(starts) == 0 {
+		for i, tv := range g.tvs {
+			quality.Speakers[i] = SpeakerSync{TV: tv, Err: positions[i].err}
+		}
+		g.publish(quality, listeners)
+		return quality, fmt.Errorf("no speaker reported its position")
+	}
+	slices.SortFunc(starts, func(a, b time.Time) int { return a.Compare(b) })
+	median := starts[len(starts)/2]
+	quality.Spread = starts[len(starts)-1].Sub(starts[0])
+
+	g.mu.Lock()
+	for i, tv := range g.tvs {
+		p := positions[i]
+		s := SpeakerSync{TV: tv, RTT: p.rtt, Err: p.err}
+		if p.err == nil {
+			s.Drift = median.Sub(p.started)
+			s.Lag = p.started.Sub(start)
+			quality.Precision = max(quality.Precision, p.rtt/2)
+			if p.coarse {
+				quality.Precision = max(quality.Precision, p.rtt/2+time.Second)
+			} else if key := tv.ControlURL; !g.learned[key] {
+				// Speakers behind the median need Play earlier next time.
+				// Only the first check of a play tells how it started.
+				g.leads[key] = max(-maxSpeakerLead, min(g.leads[key]-s.Drift/2, maxSpeakerLead))
+				g.learned[key] = true
+			}
+		}
+		s.Lead = g.leads[tv.ControlURL]
+		s.Resyncs = g.resyncs[tv.ControlURL]
+		quality.Speakers[i] = s
+	}
+	g.mu.Unlock()
+
+	// Pull speakers that wandered off back to the median position
+	if maxDrift > 0 {
+		for i, s := range quality.Speakers {
+			if s.Err != nil || positions[i].coarse || (s.Drift <= maxDrift && s.Drift >= -maxDrift) {
+				continue
+			}
+			if err := s.TV.Seek(ctx, time.Since(median)+s.RTT/2); err != nil {
+				quality.Speakers[i].Err = fmt.Errorf("resync: %w", err)
+				continue
+			}
+			g.mu.Lock()
+			g.resyncs[s.TV.ControlURL]++
+			quality.Speakers[i].Resyncs = g.resyncs[s.TV.ControlURL]
+			g.mu.Unlock()
+		}
+	}
+
+	g.publish(quality, listeners)
+	return quality, nil
+}
+
+// publish stores a check result and tells the listeners
+func (g *SpeakerGroup) publish(quality SyncQuality, listeners []func(SyncQuality)) {
+	g.mu.Lock()
+	g.quality = quality
+	g.mu.Unlock()
+	for _, fn := range listeners {
+		fn(quality)
+	}
+}
@@ -0,0 +1,80 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSpeakerGroup(t *testing.T) {
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	// The kitchen speaker takes 200ms longer to start playing
+	var tvs []*TV
+	for _, delay := range []time.Duration{0, 200 * time.Millisecond} {
+		server := httptest.NewServer(&audioTV{length: time.Minute, delay: delay})
+		defer server.Close()
+		tvs = append(tvs, &TV{Name: "Speaker", ControlURL: server.URL + "/avt"})
+	}
+
+	ctx := context.Background()
+	group := NewSpeakerGroup(renderer, tvs, 0)
+	if _, err := group.Check(ctx); err == nil {
+		t.Error("Expected an error checking a group that isn't playing")
+	}
+
+	play := func() SyncQuality {
+		t.Helper()
+		if _, err := group.Play(ctx, "http://music/radio.mp3", "Radio"); err != nil {
+			t.Fatalf("Play failed: %v", err)
+		}
+		time.Sleep(400 * time.Millisecond)
+		quality, err := group.Check(ctx)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		return quality
+	}
+
+	first := play()
+	if first.Spread < 150*time.Millisecond || first.Spread > 300*time.Millisecond {
+		t.Errorf("Spread = %v, want about 200ms", first.Spread)
+	}
+	if first.Speakers[0].Drift < 150*time.Millisecond || first.Precision > 100*time.Millisecond {
+		t.Errorf("Unexpected first check: %+v", first)
+	}
+
+	// The next start is compensated with the learned lead
+	second := play()
+	if second.Spread > first.Spread-50*time.Millisecond || second.Speakers[0].Lead >= 0 {
+		t.Errorf("Spread %v after compensating (lead %v), was %v", second.Spread, second.Speakers[0].Lead, first.Spread)
+	}
+
+	// Later checks of the same play leave the lead alone
+	for range 3 {
+		if again, err := group.Check(ctx); err != nil || again.Speakers[0].Lead != second.Speakers[0].Lead {
+			t.Errorf("Lead moved from %v to %v within one play (%v)", second.Speakers[0].Lead, again.Speakers[0].Lead, err)
+		}
+	}
+
+	// Speakers drifting too far are sought back in line
+	group.SetMaxDrift(50 * time.Millisecond)
+	resynced, err := group.Check(ctx)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if resynced.Speakers[0].Resyncs != 1 {
+		t.Errorf("Resyncs = %d, want 1", resynced.Speakers[0].Resyncs)
+	}
+	if after, _ := group.Check(ctx); after.Spread > 50*time.Millisecond {
+		t.Errorf("Spread after resync = %v", after.Spread)
+	}
+	if got := group.Quality(); got.Speakers[0].Resyncs != 1 {
+		t.Errorf("Quality() = %+v", got)
+	}
+}
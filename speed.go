@@ -0,0 +1,96 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ErrUnsupportedSpeed is returned when the TV can't play at the requested
+// speed
+var ErrUnsupportedSpeed = errors.New("play speed not supported by TV")
+
+// upnpErrSpeedNotSupported is the AVTransport error code for unsupported
+// play speeds
+const upnpErrSpeedNotSupported = 717
+
+// Common play speeds. AVTransport speeds are fractions of normal speed;
+// negative speeds play backwards.
+const (
+	SpeedNormal      = "1"
+	SpeedSlowMotion  = "1/2"
+	SpeedFastForward = "2"
+	SpeedRewind      = "-2"
+)
+
+// SupportsSpeed reports whether the TV can play at speed. TVs that don't
+// list their speeds are assumed to support all of them; normal speed is
+// always supported.
+func (tv *TV) SupportsSpeed(speed string) bool {
+	if speed == SpeedNormal || tv.PlaySpeeds == nil {
+		return true
+	}
+	return slices.Contains(tv.PlaySpeeds, speed)
+}
+
+// Play starts or resumes playback at speed (e.g. SpeedFastForward, "1/2").
+// Speeds the TV doesn't list, or rejects, return ErrUnsupportedSpeed.
+func (tv *TV) Play(ctx context.Context, speed string) error {
+	if speed == "" {
+		speed = SpeedNormal
+	}
+	if !tv.SupportsSpeed(speed) {
+		return fmt.Errorf("speed %s: %w", speed, ErrUnsupportedSpeed)
+	}
+
+	args := fmt.Sprintf(`
+      <InstanceID>0</InstanceID>
+      <Speed>%s</Speed>`, escapeXML(speed))
+
+	err := tv.sendSOAP(ctx, "Play", tv.soapEnvelope("Play", args))
+	if IsUPnPError(err, upnpErrSpeedNotSupported) {
+		return fmt.Errorf("speed %s: %w: %w", speed, ErrUnsupportedSpeed, err)
+	}
+	return err
+}
+
+// Pause pauses playback; Play resumes it
+func (tv *TV) Pause(ctx context.Context) error {
+	args := `
+      <InstanceID>0</InstanceID>`
+	return tv.sendSOAP(ctx, "Pause", tv.soapEnvelope("Pause", args))
+}
+
+// Seek jumps to a position in the current track
+func (tv *TV) Seek(ctx context.Context, position time.Duration) error {
+	args := fmt.Sprintf(`
+      <InstanceID>0</InstanceID>
+      <Unit>REL_TIME</Unit>
+      <Target>%s</Target>`, formatUPnPDuration(position))
+	return tv.sendSOAP(ctx, "Seek", tv.soapEnvelope("Seek", args))
+}
+
+// FastForward scans forward. TVs with the vendor X_DLNA_FF action use it,
+// others play at SpeedFastForward.
+func (tv *TV) FastForward(ctx context.Context) error {
+	return tv.scan(ctx, "X_DLNA_FF", SpeedFastForward)
+}
+
+// Rewind scans backward. TVs with the vendor X_DLNA_REW action use it,
+// others play at SpeedRewind.
+func (tv *TV) Rewind(ctx context.Context) error {
+	return tv.scan(ctx, "X_DLNA_REW", SpeedRewind)
+}
+
+// scan sends a vendor trick-play action if the SCPD lists it, and plays at
+// speed otherwise
+func (tv *TV) scan(ctx context.Context, action string, speed string) error {
+	if slices.Contains(tv.Actions, action) {
+		args := `
+      <InstanceID>0</InstanceID>`
+		return tv.sendSOAP(ctx, action, tv.soapEnvelope(action, args))
+	}
+	return tv.Play(ctx, speed)
+}
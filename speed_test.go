@@ -0,0 +1,88 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestParsePlaySpeeds tests reading the allowed speeds from the SCPD
+func TestParsePlaySpeeds(t *testing.T) {
+	info, err := parseServiceInfo(strings.NewReader(`<?xml version="1.0"?>
+<scpd xmlns="urn:schemas-upnp-org:service-1-0">
+  <actionList><action><name>Play</name></action></actionList>
+  <serviceStateTable>
+    <stateVariable><name>TransportState</name><allowedValueList><allowedValue>STOPPED</allowedValue></allowedValueList></stateVariable>
+    <stateVariable><name>TransportPlaySpeed</name><allowedValueList>
+      <allowedValue>1</allowedValue><allowedValue>2</allowedValue><allowedValue>-2</allowedValue>
+    </allowedValueList></stateVariable>
+  </serviceStateTable>
+</scpd>`), false)
+	if err != nil {
+		t.Fatalf("parseServiceInfo failed: %v", err)
+	}
+	if strings.Join(info.playSpeeds, ",") != "1,2,-2" {
+		t.Errorf("Unexpected play speeds %v", info.playSpeeds)
+	}
+}
+
+// TestPlaySpeed tests Play at other speeds and trick-play fallbacks
+func TestPlaySpeed(t *testing.T) {
+	var mu sync.Mutex
+	var sent []string
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		action := r.Header.Get("SOAPAction")
+		action = strings.Trim(action[strings.LastIndex(action, "#")+1:], `"`)
+		speed := soapArg(body, "Speed")
+
+		mu.Lock()
+		sent = append(sent, strings.TrimSpace(action+" "+speed))
+		mu.Unlock()
+
+		if speed == "4" {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, soapFault(717, "Play speed not supported"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	ctx := context.Background()
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+
+	if err := tv.Play(ctx, SpeedFastForward); err != nil {
+		t.Errorf("Play at 2x failed: %v", err)
+	}
+	if err := tv.Play(ctx, "4"); !errors.Is(err, ErrUnsupportedSpeed) || !IsUPnPError(err, 717) {
+		t.Errorf("Expected ErrUnsupportedSpeed from the TV, got %v", err)
+	}
+	if err := tv.Rewind(ctx); err != nil {
+		t.Errorf("Rewind failed: %v", err)
+	}
+
+	tv.Actions = []string{"Play", "X_DLNA_FF"}
+	tv.PlaySpeeds = []string{"1"}
+	if !tv.Has(CapTrickPlay) {
+		t.Error("Expected trick play with X_DLNA_FF")
+	}
+	if err := tv.FastForward(ctx); err != nil {
+		t.Errorf("FastForward failed: %v", err)
+	}
+	if err := tv.Play(ctx, SpeedSlowMotion); !errors.Is(err, ErrUnsupportedSpeed) {
+		t.Errorf("Expected unlisted speed to fail locally, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := "Play 2|Play 4|Play -2|X_DLNA_FF"
+	if got := strings.Join(sent, "|"); got != want {
+		t.Errorf("Expected requests %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,303 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"image"
+	"sync"
+	"time"
+)
+
+// ErrStaleFrame is returned for streamed frames older than the latest one
+var ErrStaleFrame = errors.New("stale frame")
+
+// StreamFrame is a JPEG frame of a stream with its position in the stream
+type StreamFrame struct {
+	Seq        uint64    // Increasing frame number
+	CapturedAt time.Time // When the producer captured the frame
+	JPEG       []byte
+}
+
+// StreamFrameInfo describes the frame on the image server's streaming
+// endpoint
+type StreamFrameInfo struct {
+	Seq         uint64
+	CapturedAt  time.Time
+	PublishedAt time.Time
+	Size        int
+}
+
+// StreamStatus reports the progress of a frame stream to a TV
+type StreamStatus struct {
+	Seq        uint64    // Last frame sent to the TV
+	CapturedAt time.Time // When that frame was captured
+	SentAt     time.Time // When it was sent
+	Received   int       // Frames received from the producer
+	Sent       int       // Frames sent to the TV
+	Dropped    int       // Frames replaced by newer ones before they were sent
+	Rejected   int       // Frames out of order or older than MaxFrameAge
+}
+
+// StreamOptions configures DisplayJPEGStream
+type StreamOptions struct {
+	// MaxFPS caps how many frames per second are sent to the TV (default 1).
+	// Frames arriving faster are dropped, keeping only the latest.
+	MaxFPS float64
+
+	// StaleAfter shows a "signal lost" card when no new frame arrives within
+	// this window, instead of freezing silently on outdated data (0 = never)
+	StaleAfter time.Duration
+
+	// StaleCard renders the card shown once the stream goes stale, given the
+	// time the last frame arrived. Defaults to a text card with that time.
+	StaleCard func(lastFrame time.Time) image.Image
+
+	// MaxFrameAge drops frames captured longer ago than this by the time
+	// they would be sent, e.g. when the TV falls behind (0 = never)
+	MaxFrameAge time.Duration
+}
+
+// frameSlot holds the most recent frame received from a producer
+type frameSlot struct {
+	mu      sync.Mutex
+	frame   *StreamFrame
+	at      time.Time
+	lastSeq uint64
+	status  StreamStatus
+	closed  bool
+	arrived chan struct{}
+}
+
+// put stores a frame (replacing any unsent one) and wakes the sender.
+// Frames not newer than the last one are rejected.
+func (s *frameSlot) put(frame *StreamFrame, closed bool) bool {
+	s.mu.Lock()
+	accepted := frame != nil && frame.Seq > s.lastSeq
+	if frame != nil {
+		s.status.Received++
+	}
+	switch {
+	case accepted:
+		if s.frame != nil {
+			s.status.Dropped++
+		}
+		s.frame = frame
+		s.at = time.Now()
+		s.lastSeq = frame.Seq
+	case frame != nil:
+		s.status.Rejected++
+	}
+	s.closed = s.closed || closed
+	s.mu.Unlock()
+
+	select {
+	case s.arrived <- struct{}{}:
+	default:
+	}
+	return accepted
+}
+
+// take removes and returns the pending frame
+func (s *frameSlot) take() (frame *StreamFrame, closed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	frame, s.frame = s.frame, nil
+	return frame, s.closed
+}
+
+// reject counts a frame dropped for its age
+func (s *frameSlot) reject() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Rejected++
+}
+
+// sent records a frame sent to the TV and returns the stream's status
+func (s *frameSlot) sent(frame *StreamFrame) StreamStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Seq, s.status.CapturedAt, s.status.SentAt = frame.Seq, frame.CapturedAt, time.Now()
+	s.status.Sent++
+	return s.status
+}
+
+// lastArrival returns when the most recent frame arrived
+func (s *frameSlot) lastArrival() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.at
+}
+
+// DisplayJPEGStream shows JPEG frames from a channel on the TV until the
+// channel is closed or ctx is done. Frames are numbered as they arrive;
+// see DisplayFrameStream.
+func (r *Renderer) DisplayJPEGStream(ctx context.Context, tv *TV, frames <-chan []byte, opts StreamOptions) error {
+	numbered := make(chan StreamFrame)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		defer close(numbered)
+		var seq uint64
+		for frame := range frames {
+			seq++
+			select {
+			case numbered <- StreamFrame{Seq: seq, CapturedAt: time.Now(), JPEG: frame}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return r.DisplayFrameStream(ctx, tv, numbered, opts)
+}
+
+// DisplayFrameStream shows numbered JPEG frames from a channel on the TV
+// until the channel is closed or ctx is done.
+//
+// Producers may push frames as fast as they like: the channel is always
+// drained, and only the most recent frame is sent, at most MaxFPS times
+// per second. Sends are spaced evenly, which smooths out bursty producers
+// so updates on the TV appear at a steady pace. Frames that arrive out of
+// order, or grow older than MaxFrameAge, are never shown. Each frame is
+// also published on the image server's /stream.jpg endpoint, which shows
+// the frames of the stream started last.
+//
+// Frames are served with X-Frame-Seq and X-Frame-Timestamp headers, and
+// StreamStatus reports the frame last sent, so a TV lagging behind the
+// producer can be told apart from a stalled producer.
+//
+// With StaleAfter set, a "signal lost" card replaces the last frame when
+// the producer goes quiet, and the next frame restores the stream.
+func (r *Renderer) DisplayFrameStream(ctx context.Context, tv *TV, frames <-chan StreamFrame, opts StreamOptions) error {
+	if opts.MaxFPS <= 0 {
+		opts.MaxFPS = 1
+	}
+	interval := time.Duration(float64(time.Second) / opts.MaxFPS)
+	if opts.StaleCard == nil {
+		opts.StaleCard = r.staleCard
+	}
+
+	// Drain the channel continuously into a latest-wins slot
+	slot := &frameSlot{arrived: make(chan struct{}, 1), at: time.Now()}
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// The endpoint follows the latest stream, which numbers frames anew
+	epoch := r.server.startFrameStream()
+	publish := true
+
+	// The stream's first frame is journaled right away
+	r.mu.Lock()
+	delete(r.streamJournaled, tv.ControlURL)
+	r.mu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case frame, ok := <-frames:
+				if !ok {
+					slot.put(nil, true)
+					return
+				}
+				if frame.CapturedAt.IsZero() {
+					frame.CapturedAt = time.Now()
+				}
+				if slot.put(&frame, false) && publish {
+					if err := r.server.publishStreamFrame(epoch, frame); errors.Is(err, ErrStaleFrame) {
+						// A newer stream took over the endpoint
+						publish = false
+					}
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	// The watchdog fires once per quiet period and is re-armed by new frames
+	var watchdog *time.Timer
+	var stale <-chan time.Time
+	if opts.StaleAfter > 0 {
+		watchdog = time.NewTimer(opts.StaleAfter)
+		defer watchdog.Stop()
+		stale = watchdog.C
+	}
+
+	var nextSend time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-stale:
+			stale = nil
+			if err := r.DisplayImage(ctx, tv, opts.StaleCard(slot.lastArrival())); err != nil {
+				return err
+			}
+			continue
+		case <-slot.arrived:
+		}
+
+		// Keep sends evenly spaced; frames arriving meanwhile replace this one
+		if wait := time.Until(nextSend); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		frame, closed := slot.take()
+		if frame != nil {
+			if watchdog != nil {
+				watchdog.Reset(opts.StaleAfter)
+				stale = watchdog.C
+			}
+			if err := r.sendFrame(ctx, tv, slot, frame, opts.MaxFrameAge); err != nil {
+				return err
+			}
+			nextSend = time.Now().Add(interval)
+		}
+		if closed {
+			// Send a frame that arrived together with the close
+			if frame, _ := slot.take(); frame != nil {
+				return r.sendFrame(ctx, tv, slot, frame, opts.MaxFrameAge)
+			}
+			return nil
+		}
+	}
+}
+
+// sendFrame shows a stream frame on the TV unless it is older than maxAge
+func (r *Renderer) sendFrame(ctx context.Context, tv *TV, slot *frameSlot, frame *StreamFrame, maxAge time.Duration) error {
+	if maxAge > 0 && time.Since(frame.CapturedAt) > maxAge {
+		slot.reject()
+		return nil
+	}
+	ctx = context.WithValue(ctx, streamFrameKey{}, true)
+	if err := r.showURL(ctx, tv, r.server.storeFrame(*frame), "image/jpeg"); err != nil {
+		return err
+	}
+
+	status := slot.sent(frame)
+	r.mu.Lock()
+	r.streams[tv.ControlURL] = status
+	r.mu.Unlock()
+	return nil
+}
+
+// StreamStatus reports the last frame stream sent to the TV: which frame
+// it shows, when that frame was captured, and how many frames were
+// dropped on the way
+func (r *Renderer) StreamStatus(tv *TV) (StreamStatus, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status, ok := r.streams[tv.ControlURL]
+	return status, ok
+}
+
+// staleCard renders the default "signal lost" card
+func (r *Renderer) staleCard(lastFrame time.Time) image.Image {
+	return RenderText(r.message(MsgNoSignal, lastFrame.Format("15:04:05")), r.defaultText())
+}
@@ -0,0 +1,267 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestDisplayJPEGStreamDropsFrames tests that bursts are collapsed to the latest frame
+func TestDisplayJPEGStreamDropsFrames(t *testing.T) {
+	var mu sync.Mutex
+	var sets int
+
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("SOAPAction"), "#SetAVTransportURI") {
+			mu.Lock()
+			sets++
+			mu.Unlock()
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	frames := make(chan []byte, 20)
+	for i := 0; i < 20; i++ {
+		frames <- []byte{0xFF, 0xD8, byte(i), 0xFF, 0xD9}
+	}
+	close(frames)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := renderer.DisplayJPEGStream(ctx, tv, frames, StreamOptions{MaxFPS: 5}); err != nil {
+		t.Fatalf("DisplayJPEGStream failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if sets == 0 || sets >= 20 {
+		t.Errorf("Expected between 1 and 19 frames sent, got %d", sets)
+	}
+}
+
+// TestDisplayJPEGStreamStaleCard tests that a quiet producer triggers the stale card
+func TestDisplayJPEGStreamStaleCard(t *testing.T) {
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	frames := make(chan []byte, 1)
+	frames <- []byte{0xFF, 0xD8, 0xFF, 0xD9}
+
+	staleShown := make(chan time.Time, 1)
+	opts := StreamOptions{
+		MaxFPS:     10,
+		StaleAfter: 50 * time.Millisecond,
+		StaleCard: func(lastFrame time.Time) image.Image {
+			staleShown <- lastFrame
+			close(frames)
+			return image.NewRGBA(image.Rect(0, 0, 16, 9))
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := renderer.DisplayJPEGStream(ctx, tv, frames, opts); err != nil {
+		t.Fatalf("DisplayJPEGStream failed: %v", err)
+	}
+
+	select {
+	case lastFrame := <-staleShown:
+		if lastFrame.IsZero() {
+			t.Error("Expected the stale card to receive the last frame time")
+		}
+	default:
+		t.Error("Expected the stale card to be shown")
+	}
+}
+
+// TestDisplayFrameStreamSeq tests that frames keep their sequence numbers
+// and that out-of-order frames are rejected
+func TestDisplayFrameStreamSeq(t *testing.T) {
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	captured := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	frames := make(chan StreamFrame, 4)
+	for _, seq := range []uint64{1, 3, 2, 5} {
+		frames <- StreamFrame{Seq: seq, CapturedAt: captured.Add(time.Duration(seq) * time.Second), JPEG: []byte{0xFF, 0xD8, byte(seq), 0xFF, 0xD9}}
+	}
+	close(frames)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := renderer.DisplayFrameStream(ctx, tv, frames, StreamOptions{MaxFPS: 50}); err != nil {
+		t.Fatalf("DisplayFrameStream failed: %v", err)
+	}
+
+	status, ok := renderer.StreamStatus(tv)
+	if !ok {
+		t.Fatal("No stream status")
+	}
+	if status.Seq != 5 || !status.CapturedAt.Equal(captured.Add(5*time.Second)) {
+		t.Errorf("status = %+v, want frame 5", status)
+	}
+	if status.Received != 4 || status.Rejected != 1 || status.Sent+status.Dropped != 3 {
+		t.Errorf("status = %+v, want 4 received, 1 rejected", status)
+	}
+
+	info, _ := renderer.LastFrame(tv)
+	if info.Seq != 5 {
+		t.Errorf("LastFrame seq = %d, want 5", info.Seq)
+	}
+
+	resp, err := http.Get(renderer.server.StreamURL())
+	if err != nil {
+		t.Fatalf("Fetch stream failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Frame-Seq") != "5" || resp.Header.Get("X-Frame-Timestamp") != "2026-10-16T12:00:05Z" {
+		t.Errorf("stream headers = %v", resp.Header)
+	}
+
+	if err := renderer.server.PublishFrame(StreamFrame{Seq: 4, JPEG: []byte{0xFF, 0xD8}}); !errors.Is(err, ErrStaleFrame) {
+		t.Errorf("PublishFrame(old) = %v, want ErrStaleFrame", err)
+	}
+}
+
+// TestDisplayJPEGStreamRestart tests that the streaming endpoint follows a
+// stream started after another, although its numbering starts over
+func TestDisplayJPEGStreamRestart(t *testing.T) {
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	latest := func() string {
+		t.Helper()
+		resp, err := http.Get(renderer.server.StreamURL())
+		if err != nil {
+			t.Fatalf("Fetch stream failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	stream := func(frames ...string) chan []byte {
+		ch := make(chan []byte, len(frames))
+		for _, frame := range frames {
+			ch <- []byte(frame)
+		}
+		return ch
+	}
+
+	first := stream("a1", "a2", "a3")
+	close(first)
+	if err := renderer.DisplayJPEGStream(ctx, tv, first, StreamOptions{MaxFPS: 50}); err != nil {
+		t.Fatalf("DisplayJPEGStream failed: %v", err)
+	}
+	second := stream("b1")
+	close(second)
+	if err := renderer.DisplayJPEGStream(ctx, tv, second, StreamOptions{MaxFPS: 50}); err != nil {
+		t.Fatalf("DisplayJPEGStream failed: %v", err)
+	}
+	if got := latest(); got != "b1" {
+		t.Errorf("After a restart the endpoint serves %q, want b1", got)
+	}
+
+	// Of two streams running at once, the one started last is served
+	older := stream("c1")
+	done := make(chan error, 1)
+	go func() {
+		done <- renderer.DisplayJPEGStream(ctx, tv, older, StreamOptions{MaxFPS: 50})
+	}()
+	for latest() != "c1" {
+		if ctx.Err() != nil {
+			t.Fatal("The first frame of the older stream was never served")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	newer := stream("d1")
+	close(newer)
+	if err := renderer.DisplayJPEGStream(ctx, tv, newer, StreamOptions{MaxFPS: 50}); err != nil {
+		t.Fatalf("DisplayJPEGStream failed: %v", err)
+	}
+	older <- []byte("c2")
+	close(older)
+	if err := <-done; err != nil {
+		t.Fatalf("DisplayJPEGStream failed: %v", err)
+	}
+	if got := latest(); got != "d1" {
+		t.Errorf("The endpoint serves %q of the older stream, want d1", got)
+	}
+}
+
+// TestStreamMaxFrameAge tests that frames the TV fell behind on are not shown
+func TestStreamMaxFrameAge(t *testing.T) {
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	frames := make(chan StreamFrame, 1)
+	frames <- StreamFrame{Seq: 1, CapturedAt: time.Now().Add(-40 * time.Second), JPEG: []byte{0xFF, 0xD8, 0xFF, 0xD9}}
+	close(frames)
+
+	if err := renderer.DisplayFrameStream(context.Background(), tv, frames, StreamOptions{MaxFrameAge: 5 * time.Second}); err != nil {
+		t.Fatalf("DisplayFrameStream failed: %v", err)
+	}
+	if _, ok := renderer.LastFrame(tv); ok {
+		t.Error("A 40 second old frame was shown")
+	}
+}
@@ -0,0 +1,111 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// maxSweepHosts caps how many addresses a single subnet sweep contacts
+const maxSweepHosts = 1024
+
+// minSweepPrefix is the largest subnet a sweep accepts (a /16). Local
+// subnets that are larger are narrowed to the /16 around this host.
+const minSweepPrefix = 16
+
+// ErrMulticastBlocked is returned by discovery when running inside a
+// container whose network does not pass SSDP multicast and the unicast
+// sweep of the local subnets found nothing either
+var ErrMulticastBlocked = errors.New("no TVs answered: running in a container without host networking, SSDP multicast is blocked " +
+	"(run the container with --network host, set DiscoverOptions.SweepSubnets to your LAN, or add the TV with its IP)")
+
+// inContainer reports whether the process appears to run in a container
+func inContainer() bool {
+	for _, marker := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+
+	cgroup, err := os.ReadFile("/proc/1/cgroup")
+	if err != nil {
+		return false
+	}
+	for _, hint := range []string{"docker", "kubepods", "containerd", "lxc"} {
+		if bytes.Contains(cgroup, []byte(hint)) {
+			return true
+		}
+	}
+	return false
+}
+
+// localSubnets returns the CIDRs of the IPv4 networks this host is on
+func localSubnets() []string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+
+	var subnets []string
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.To4() == nil {
+			continue
+		}
+		if ones, _ := ipnet.Mask.Size(); ones < minSweepPrefix {
+			ipnet.Mask = net.CIDRMask(minSweepPrefix, 32)
+		}
+		subnets = append(subnets, ipnet.String())
+	}
+	return subnets
+}
+
+// sweepTargets expands CIDRs into the SSDP addresses of their hosts.
+// Subnets larger than maxSweepHosts are narrowed to the addresses nearest
+// to the one given in the CIDR; subnets larger than a /16 are refused.
+func sweepTargets(subnets []string) ([]*net.UDPAddr, error) {
+	var targets []*net.UDPAddr
+	for _, cidr := range subnets {
+		ip, ipnet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("parse sweep subnet: %w", err)
+		}
+		ip4 := ip.To4()
+		if ip4 == nil {
+			return nil, fmt.Errorf("sweep subnet %s is not IPv4", cidr)
+		}
+
+		ones, bits := ipnet.Mask.Size()
+		if ones < minSweepPrefix {
+			return nil, fmt.Errorf("sweep subnet %s is larger than a /%d", cidr, minSweepPrefix)
+		}
+		size := uint32(1) << uint(bits-ones)
+		network := binary.BigEndian.Uint32(ipnet.IP.To4())
+
+		first, last := network+1, network+size-2
+		if size <= 2 {
+			first, last = network, network+size-1
+		}
+		if last-first+1 > maxSweepHosts {
+			// Center the window on the given address
+			center := binary.BigEndian.Uint32(ip4)
+			first = max(first, center-maxSweepHosts/2)
+			last = min(last, first+maxSweepHosts-1)
+		}
+
+		for n := first; n <= last && n >= first; n++ {
+			host := make(net.IP, 4)
+			binary.BigEndian.PutUint32(host, n)
+			if host.Equal(ip4) {
+				// The CIDR names our own address; don't search ourselves
+				continue
+			}
+			targets = append(targets, &net.UDPAddr{IP: host, Port: 1900})
+		}
+	}
+	return targets, nil
+}
@@ -1,9 +1,13 @@
 package nimsforestsmarttv
 
 import (
+	"errors"
+	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
+	"strings"
+	"unicode"
 )
 
 // Predefined colors
@@ -12,33 +16,115 @@ var (
 	White = color.RGBA{255, 255, 255, 255}
 )
 
-// TextOptions configures text rendering
+// TextOptions configures text rendering. Zero fields take their default.
 type TextOptions struct {
 	FontSize   int         // Character height in pixels (default 100)
 	Width      int         // Image width (default 1920)
 	Height     int         // Image height (default 1080)
 	Color      color.Color // Text color (default white)
 	Background color.Color // Background color (default black)
+
+	// Shortcodes expands :shortcodes: like ":fire:" to color emoji
+	Shortcodes bool
 }
 
-// RenderText renders text to an image using a simple bitmap font
-// Note: This uses a basic pixel font. For better fonts, render your own image.
-func RenderText(text string, opts TextOptions) image.Image {
-	// Apply defaults
-	if opts.Width == 0 {
-		opts.Width = 1920
+// ErrInvalidTextOptions is returned for text options that cannot render
+// readable text
+var ErrInvalidTextOptions = errors.New("invalid text options")
+
+// Limits for text rendering
+const (
+	// minFontSize is the smallest font size that still gives every pixel of
+	// the 5x7 bitmap font at least one screen pixel
+	minFontSize = 7
+
+	// maxTextImageSize bounds each side of a text image (16K)
+	maxTextImageSize = 15360
+)
+
+// Validate reports every problem with the options, after applying defaults:
+// sizes must be positive and within 15360 pixels, the font must be at least
+// 7 pixels tall and fit the image, and the text color must be visible, i.e.
+// not fully transparent and not the same as the background.
+func (o TextOptions) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: "+format, append([]any{ErrInvalidTextOptions}, args...)...))
+	}
+
+	for _, side := range []struct {
+		name  string
+		value int
+	}{{"width", o.Width}, {"height", o.Height}} {
+		if side.value < 0 {
+			invalid("%s must be positive, got %d", side.name, side.value)
+		} else if side.value > maxTextImageSize {
+			invalid("%s %d exceeds the maximum of %d", side.name, side.value, maxTextImageSize)
+		}
+	}
+
+	switch {
+	case o.FontSize < 0:
+		invalid("font size must be positive, got %d", o.FontSize)
+	case o.FontSize > 0 && o.FontSize < minFontSize:
+		invalid("font size %d is below the minimum of %d", o.FontSize, minFontSize)
+	}
+
+	d := o.withDefaults()
+	if o.FontSize >= 0 && o.Height >= 0 && d.FontSize > d.Height {
+		invalid("font size %d is taller than the image height %d", d.FontSize, d.Height)
+	}
+
+	if _, _, _, a := d.Color.RGBA(); a == 0 {
+		invalid("text color is fully transparent")
+	} else if sameColor(d.Color, d.Background) {
+		invalid("text color is the same as the background")
+	}
+
+	return errors.Join(errs...)
+}
+
+// withDefaults returns the options with zero and negative fields replaced
+// by their defaults
+func (o TextOptions) withDefaults() TextOptions {
+	if o.Width <= 0 {
+		o.Width = 1920
+	}
+	if o.Height <= 0 {
+		o.Height = 1080
 	}
-	if opts.Height == 0 {
-		opts.Height = 1080
+	if o.FontSize <= 0 {
+		o.FontSize = 100
 	}
-	if opts.FontSize == 0 {
-		opts.FontSize = 100
+	if o.Color == nil {
+		o.Color = White
 	}
-	if opts.Color == nil {
-		opts.Color = White
+	if o.Background == nil {
+		o.Background = Black
 	}
-	if opts.Background == nil {
-		opts.Background = Black
+	return o
+}
+
+// sameColor reports whether two colors look identical
+func sameColor(a, b color.Color) bool {
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	return r1 == r2 && g1 == g2 && b1 == b2 && a1 == a2
+}
+
+// RenderText renders text to an image using a simple bitmap font
+// Note: This uses a basic pixel font. For better fonts, render your own image.
+// Lines are separated by "\n" and centered; see MeasureText and WrapText.
+//
+// RenderText never fails: zero or negative sizes fall back to the defaults
+// and oversized images are clamped. Use TextOptions.Validate to catch
+// options like these.
+func RenderText(text string, opts TextOptions) image.Image {
+	opts = opts.withDefaults()
+	opts.Width = min(opts.Width, maxTextImageSize)
+	opts.Height = min(opts.Height, maxTextImageSize)
+	if opts.Shortcodes {
+		text = ExpandShortcodes(text)
 	}
 
 	// Create image
@@ -47,25 +133,139 @@ func RenderText(text string, opts TextOptions) image.Image {
 	// Fill background
 	draw.Draw(img, img.Bounds(), &image.Uniform{opts.Background}, image.Point{}, draw.Src)
 
-	// Calculate character dimensions
-	charWidth := opts.FontSize * 3 / 5  // 3:5 aspect ratio
-	charHeight := opts.FontSize
-	spacing := charWidth / 5
+	// Center the block of lines, and each line within it
+	m := metricsFor(opts.FontSize)
+	lines := strings.Split(text, "\n")
+	_, blockHeight := m.measure(lines)
+	y := (opts.Height - blockHeight) / 2
 
-	// Calculate total text width
-	totalWidth := len(text)*charWidth + (len(text)-1)*spacing
+	for _, line := range lines {
+		x := (opts.Width - m.lineWidth(line)) / 2
+		for _, ch := range line {
+			w := m.glyphWidth(ch)
+			if w == 0 {
+				continue
+			}
+			if isEmoji(ch) {
+				drawEmoji(img, x, y, m.charHeight, ch)
+			} else {
+				drawChar(img, x, y, m.charWidth, m.charHeight, ch, opts.Color)
+			}
+			x += w + m.spacing
+		}
+		y += m.charHeight + m.lineGap
+	}
+
+	return img
+}
 
-	// Center the text
-	startX := (opts.Width - totalWidth) / 2
-	startY := (opts.Height - charHeight) / 2
+// textMetrics are the glyph dimensions of the bitmap font at a font size
+type textMetrics struct {
+	charWidth  int
+	charHeight int
+	spacing    int // Between characters
+	lineGap    int // Between lines
+}
 
-	// Draw each character
-	for i, ch := range text {
-		x := startX + i*(charWidth+spacing)
-		drawChar(img, x, startY, charWidth, charHeight, ch, opts.Color)
+// metricsFor returns the metrics of the bitmap font at fontSize
+func metricsFor(fontSize int) textMetrics {
+	charWidth := fontSize * 3 / 5 // 3:5 aspect ratio
+	return textMetrics{
+		charWidth:  charWidth,
+		charHeight: fontSize,
+		spacing:    charWidth / 5,
+		lineGap:    fontSize / 4,
 	}
+}
 
-	return img
+// glyphWidth returns how wide ch is drawn: emoji are square, and invisible
+// modifiers (combining marks, variation selectors, zero width joiners) take
+// no space
+func (m textMetrics) glyphWidth(ch rune) int {
+	switch {
+	case ch == '\uFE0E' || ch == '\uFE0F' || ch == '\u200D' || unicode.Is(unicode.Mn, ch):
+		return 0
+	case isEmoji(ch):
+		return m.charHeight
+	default:
+		return m.charWidth
+	}
+}
+
+// lineWidth returns the width of a single line of text
+func (m textMetrics) lineWidth(line string) int {
+	w := 0
+	for _, ch := range line {
+		if gw := m.glyphWidth(ch); gw > 0 {
+			if w > 0 {
+				w += m.spacing
+			}
+			w += gw
+		}
+	}
+	return w
+}
+
+// measure returns the size of a block of lines
+func (m textMetrics) measure(lines []string) (w, h int) {
+	for _, line := range lines {
+		w = max(w, m.lineWidth(line))
+	}
+	h = len(lines)*m.charHeight + (len(lines)-1)*m.lineGap
+	return w, h
+}
+
+// MeasureText returns the size in pixels of text rendered with opts, so
+// custom layouts can position it without rendering. Lines are separated by
+// "\n"; shortcodes are expanded if opts.Shortcodes is set. The result may
+// exceed opts.Width and opts.Height, in which case RenderText crops.
+func MeasureText(text string, opts TextOptions) (w, h int) {
+	opts = opts.withDefaults()
+	if opts.Shortcodes {
+		text = ExpandShortcodes(text)
+	}
+	return metricsFor(opts.FontSize).measure(strings.Split(text, "\n"))
+}
+
+// WrapText breaks text into lines no wider than maxWidth pixels at the
+// font size of opts. Lines break between words; words wider than maxWidth
+// are split between characters. Existing "\n" line breaks are kept.
+func WrapText(text string, maxWidth int, opts TextOptions) []string {
+	opts = opts.withDefaults()
+	if opts.Shortcodes {
+		text = ExpandShortcodes(text)
+	}
+	m := metricsFor(opts.FontSize)
+
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if m.lineWidth(candidate) <= maxWidth {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+
+			// Split words that don't fit on a line of their own
+			line = ""
+			for _, ch := range word {
+				if line != "" && m.lineWidth(line+string(ch)) > maxWidth {
+					lines = append(lines, line)
+					line = ""
+				}
+				line += string(ch)
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
 }
 
 // drawChar draws a single character using simple pixel graphics
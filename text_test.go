@@ -0,0 +1,114 @@
+package nimsforestsmarttv
+
+import (
+	"errors"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// TestTextOptionsValidate tests the validation of text options
+func TestTextOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		opts TextOptions
+		want string // substring of the error, empty = valid
+	}{
+		{"defaults", TextOptions{}, ""},
+		{"custom", TextOptions{FontSize: 40, Width: 640, Height: 360, Color: Black, Background: White}, ""},
+		{"negative width", TextOptions{Width: -1}, "width must be positive, got -1"},
+		{"huge height", TextOptions{Height: 100000}, "height 100000 exceeds the maximum"},
+		{"negative font", TextOptions{FontSize: -10}, "font size must be positive"},
+		{"tiny font", TextOptions{FontSize: 3}, "below the minimum of 7"},
+		{"font taller than image", TextOptions{FontSize: 200, Height: 100}, "taller than the image height 100"},
+		{"default font taller than image", TextOptions{Height: 50}, "font size 100 is taller"},
+		{"transparent text", TextOptions{Color: color.RGBA{255, 255, 255, 0}}, "fully transparent"},
+		{"invisible text", TextOptions{Color: Black}, "same as the background"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Expected valid options, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidTextOptions) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// TestRenderTextDefaults tests that RenderText falls back to defaults for
+// invalid sizes instead of panicking
+func TestRenderTextDefaults(t *testing.T) {
+	img := RenderText("HI", TextOptions{Width: -5, Height: 0, FontSize: -1})
+	if b := img.Bounds(); b.Dx() != 1920 || b.Dy() != 1080 {
+		t.Errorf("Expected the default 1920x1080, got %v", b)
+	}
+}
+
+// TestNewRendererRejectsInvalidTextOptions tests that invalid default text
+// options are caught when the renderer is created
+func TestNewRendererRejectsInvalidTextOptions(t *testing.T) {
+	_, err := NewRenderer(WithTextOptions(TextOptions{FontSize: -1}))
+	if !errors.Is(err, ErrInvalidTextOptions) {
+		t.Errorf("Expected ErrInvalidTextOptions, got %v", err)
+	}
+}
+
+// TestMeasureText tests text measurement with multiple lines and emoji
+func TestMeasureText(t *testing.T) {
+	opts := TextOptions{FontSize: 50} // 30 wide glyphs, 6 spacing, 12 line gap
+
+	tests := []struct {
+		text string
+		w, h int
+	}{
+		{"", 0, 50},
+		{"A", 30, 50},
+		{"AB", 66, 50},
+		{"AB\nA", 66, 112},
+		{"é", 30, 50},        // precomposed
+		{"e\u0301", 30, 50},  // combining accent takes no space
+		{"A❤\uFE0F", 86, 50}, // emoji are square, the selector is invisible
+	}
+
+	for _, tt := range tests {
+		w, h := MeasureText(tt.text, opts)
+		if w != tt.w || h != tt.h {
+			t.Errorf("MeasureText(%q) = %dx%d, want %dx%d", tt.text, w, h, tt.w, tt.h)
+		}
+	}
+}
+
+// TestWrapText tests word wrapping
+func TestWrapText(t *testing.T) {
+	opts := TextOptions{FontSize: 50}
+	maxWidth := 4*30 + 3*6 // four characters
+
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"AB CD EF", []string{"AB", "CD", "EF"}},
+		{"A B C", []string{"A B", "C"}},
+		{"ABCDEFGHI", []string{"ABCD", "EFGH", "I"}},
+		{"AB\nCD", []string{"AB", "CD"}},
+	}
+
+	for _, tt := range tests {
+		got := WrapText(tt.text, maxWidth, opts)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("WrapText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+		for _, line := range got {
+			if w, _ := MeasureText(line, opts); w > maxWidth {
+				t.Errorf("WrapText(%q): line %q is %d wide", tt.text, line, w)
+			}
+		}
+	}
+}
@@ -0,0 +1,486 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotLive is returned when a time-shifted source isn't a live HLS
+// stream
+var ErrNotLive = errors.New("not a live HLS stream")
+
+// liveSegments is how many segments the time-shifted playlist lists; TVs
+// start playing a few segments before its end
+const liveSegments = 3
+
+// recordedSegment is a segment kept in a LiveBuffer
+type recordedSegment struct {
+	seq         uint64
+	duration    float64
+	data        []byte
+	contentType string
+	recordedAt  time.Time
+}
+
+// LiveBuffer records a live HLS stream into a ring buffer and serves it to
+// TVs with a delay that can change, like a DVR: paused playback resumes
+// where it stopped and viewers can jump back within the buffer. Streams
+// with encrypted segments are not supported. It is safe for concurrent use.
+type LiveBuffer struct {
+	server *ImageServer
+	target proxyTarget
+	token  string
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	media     *url.URL // Media playlist being recorded
+	segments  []recordedSegment
+	nextSeq   uint64
+	upstream  int64   // Media sequence number of the last recorded segment (-1 = none)
+	longest   float64 // Longest segment duration, seconds
+	offset    time.Duration
+	pausedAt  time.Time       // Zero unless paused
+	gen       int             // Bumped when the position jumps, for a fresh URL
+	recording *streamRecorder // Segments TVs fetch are recorded to (nil = off)
+	err       error           // Last recording error
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// RecordLive starts recording the live HLS stream at sourceURL, keeping the
+// last window (default 30 minutes) of it. It returns once the first
+// segments are recorded. The proxy options give credentials for the source.
+func (s *ImageServer) RecordLive(ctx context.Context, sourceURL string, window time.Duration, opts ...ProxyOption) (*LiveBuffer, error) {
+	source, err := url.Parse(sourceURL)
+	if err != nil {
+		return nil, fmt.Errorf("record live: %w", err)
+	}
+	if window <= 0 {
+		window = 30 * time.Minute
+	}
+	target, err := newProxyTarget(source, opts)
+	if err != nil {
+		return nil, fmt.Errorf("record live: %w", err)
+	}
+	if err := s.applyURLPolicy(ctx, &target); err != nil {
+		return nil, fmt.Errorf("record live: %w", err)
+	}
+
+	b := &LiveBuffer{
+		server:   s,
+		target:   target,
+		token:    rand.Text(),
+		window:   window,
+		now:      time.Now,
+		media:    source,
+		upstream: -1,
+		done:     make(chan struct{}),
+	}
+	if err := b.poll(ctx); err != nil {
+		return nil, fmt.Errorf("record live: %w", err)
+	}
+
+	s.mu.Lock()
+	s.timeshifts[b.token] = b
+	s.mu.Unlock()
+
+	recordCtx, stop := context.WithCancel(context.Background())
+	b.stop = stop
+	go b.record(recordCtx)
+	return b, nil
+}
+
+// record polls the source about twice per segment until stopped
+func (b *LiveBuffer) record(ctx context.Context) {
+	defer close(b.done)
+	for {
+		b.mu.Lock()
+		interval := time.Duration(b.longest * float64(time.Second) / 2)
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(max(interval, time.Second)):
+		}
+
+		err := b.poll(ctx)
+		b.mu.Lock()
+		b.err = err
+		b.mu.Unlock()
+	}
+}
+
+// poll fetches the media playlist once and records new segments
+func (b *LiveBuffer) poll(ctx context.Context) error {
+	b.mu.Lock()
+	media := b.media
+	last := b.upstream
+	b.mu.Unlock()
+
+	playlist, base, err := b.fetchPlaylist(ctx, media)
+	if err != nil {
+		return err
+	}
+
+	// Record the first variant of a master playlist
+	if variant, ok := firstVariant(playlist, base); ok {
+		b.mu.Lock()
+		b.media = variant
+		b.mu.Unlock()
+		if playlist, base, err = b.fetchPlaylist(ctx, variant); err != nil {
+			return err
+		}
+	}
+
+	type entry struct {
+		seq      int64
+		duration float64
+		source   *url.URL
+	}
+	var entries []entry
+	var seq int64
+	duration := 0.0
+	for line := range strings.Lines(playlist) {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			seq, _ = strconv.ParseInt(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"), 10, 64)
+		case line == "#EXT-X-ENDLIST":
+			return ErrNotLive
+		case strings.HasPrefix(line, "#EXT-X-KEY:") && !strings.Contains(line, "METHOD=NONE"):
+			return errors.New("encrypted streams are not supported")
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			duration, _ = strconv.ParseFloat(value, 64)
+		case line == "" || strings.HasPrefix(line, "#"):
+		default:
+			ref, err := url.Parse(line)
+			if err != nil {
+				continue
+			}
+			entries = append(entries, entry{seq, duration, base.ResolveReference(ref)})
+			seq++
+		}
+	}
+	if len(entries) == 0 {
+		return errors.New("playlist has no segments")
+	}
+
+	// Join a running stream at the live edge
+	if last < 0 {
+		entries = entries[max(len(entries)-liveSegments, 0):]
+	}
+
+	download := b.target.downloader()
+	for _, e := range entries {
+		if e.seq <= last {
+			continue
+		}
+		data, contentType, err := download(e.source)
+		if err != nil {
+			return err
+		}
+		b.add(recordedSegment{duration: e.duration, data: data, contentType: contentType}, e.seq)
+	}
+	return nil
+}
+
+// fetchPlaylist downloads a playlist and returns it with its final URL
+func (b *LiveBuffer) fetchPlaylist(ctx context.Context, u *url.URL) (string, *url.URL, error) {
+	resp, err := b.target.fetch(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("playlist: HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPlaylistSize))
+	if err != nil {
+		return "", nil, err
+	}
+	return string(body), resp.Request.URL, nil
+}
+
+// firstVariant returns the first variant stream of a master playlist
+func firstVariant(playlist string, base *url.URL) (*url.URL, bool) {
+	variant := false
+	for line := range strings.Lines(playlist) {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF"):
+			variant = true
+		case variant && line != "" && !strings.HasPrefix(line, "#"):
+			ref, err := url.Parse(line)
+			if err != nil {
+				return nil, false
+			}
+			return base.ResolveReference(ref), true
+		}
+	}
+	return nil, false
+}
+
+// add appends the segment with the upstream media sequence number
+// upstream and drops the ones that fell out of the window
+func (b *LiveBuffer) add(seg recordedSegment, upstream int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.upstream = upstream
+	seg.seq = b.nextSeq
+	seg.recordedAt = b.now()
+	b.nextSeq++
+	b.segments = append(b.segments, seg)
+	b.longest = max(b.longest, seg.duration)
+
+	for len(b.segments) > liveSegments && seg.recordedAt.Sub(b.segments[0].recordedAt) > b.window {
+		b.segments = b.segments[1:]
+	}
+}
+
+// effectiveOffset is how far playback is behind live. Call with mu held.
+func (b *LiveBuffer) effectiveOffset() time.Duration {
+	offset := b.offset
+	if !b.pausedAt.IsZero() {
+		offset += b.now().Sub(b.pausedAt)
+	}
+	return offset
+}
+
+// span is how much of the stream is buffered. Call with mu held.
+func (b *LiveBuffer) span() time.Duration {
+	if len(b.segments) < 2 {
+		return 0
+	}
+	return b.segments[len(b.segments)-1].recordedAt.Sub(b.segments[0].recordedAt)
+}
+
+// URL returns the playlist URL TVs play. It changes when the position
+// jumps (SeekBack, GoLive), so the TV must be given the new one.
+func (b *LiveBuffer) URL() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return fmt.Sprintf("%s%s/timeshift/%s/live%d.m3u8", b.server.URL(), b.server.pathPrefix, b.token, b.gen)
+}
+
+// Pause freezes the playlist served to TVs while recording continues
+func (b *LiveBuffer) Pause() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pausedAt.IsZero() {
+		b.pausedAt = b.now()
+	}
+}
+
+// Resume continues playback from where it was paused, now that much
+// behind live
+func (b *LiveBuffer) Resume() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.offset = min(b.effectiveOffset(), b.span())
+	b.pausedAt = time.Time{}
+}
+
+// SeekBack moves playback d further behind live, at most to the start of
+// the buffer. Negative d moves towards live.
+func (b *LiveBuffer) SeekBack(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.offset = min(max(b.effectiveOffset()+d, 0), b.span())
+	if !b.pausedAt.IsZero() {
+		b.pausedAt = b.now()
+	}
+	b.gen++
+}
+
+// GoLive jumps back to the live edge
+func (b *LiveBuffer) GoLive() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.offset = 0
+	b.pausedAt = time.Time{}
+	b.gen++
+}
+
+// Offset returns how far playback is behind live
+func (b *LiveBuffer) Offset() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return min(b.effectiveOffset(), b.span())
+}
+
+// Buffered returns how much of the stream the buffer holds
+func (b *LiveBuffer) Buffered() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.span()
+}
+
+// Err returns the last recording error, nil while recording works
+func (b *LiveBuffer) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// Close stops recording and serving the stream
+func (b *LiveBuffer) Close() error {
+	b.stop()
+	<-b.done
+	b.server.mu.Lock()
+	delete(b.server.timeshifts, b.token)
+	b.server.mu.Unlock()
+	return nil
+}
+
+// playlist renders the media playlist at the current playback position
+func (b *LiveBuffer) playlist() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// The newest segment recorded before the playback position, keeping
+	// enough segments to start from
+	position := b.now().Add(-b.effectiveOffset())
+	end := len(b.segments)
+	for end > liveSegments && b.segments[end-1].recordedAt.After(position) {
+		end--
+	}
+	segments := b.segments[max(end-liveSegments, 0):end]
+
+	var sb strings.Builder
+	sb.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&sb, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(b.longest)))
+	if len(segments) > 0 {
+		fmt.Fprintf(&sb, "#EXT-X-MEDIA-SEQUENCE:%d\n", segments[0].seq)
+	}
+	for _, seg := range segments {
+		fmt.Fprintf(&sb, "#EXTINF:%.3f,\n%d.ts\n", seg.duration, seg.seq)
+	}
+	return sb.String()
+}
+
+// segment returns a recorded segment by sequence number
+func (b *LiveBuffer) segment(seq uint64) (recordedSegment, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, seg := range b.segments {
+		if seg.seq == seq {
+			return seg, true
+		}
+	}
+	return recordedSegment{}, false
+}
+
+// handleTimeShift serves the playlists and segments of live buffers
+func (s *ImageServer) handleTimeShift(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, s.pathPrefix+"/timeshift/")
+	token, name, _ := strings.Cut(rest, "/")
+
+	s.mu.RLock()
+	b, ok := s.timeshifts[token]
+	s.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if strings.HasPrefix(name, "live") && strings.HasSuffix(name, ".m3u8") {
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Header().Set("Cache-Control", "no-cache")
+		io.WriteString(w, b.playlist())
+		return
+	}
+
+	seq, err := strconv.ParseUint(strings.TrimSuffix(name, ".ts"), 10, 64)
+	seg, ok := b.segment(seq)
+	if err != nil || !ok {
+		http.NotFound(w, r)
+		return
+	}
+	b.mu.Lock()
+	rec := b.recording
+	b.mu.Unlock()
+	if rec != nil && r.Method == http.MethodGet {
+		rec.segment(name, seg.data)
+	}
+
+	if seg.contentType != "" {
+		w.Header().Set("Content-Type", seg.contentType)
+	}
+	http.ServeContent(w, r, "", seg.recordedAt, bytes.NewReader(seg.data))
+}
+
+// TimeShift is a live stream playing on a TV through a LiveBuffer, with
+// DVR controls
+type TimeShift struct {
+	renderer *Renderer
+	tv       *TV
+	title    string
+	buffer   *LiveBuffer
+}
+
+// StreamLive records a live HLS stream and plays it on the TV with a delay
+// that PauseLive, ResumeLive and SeekBack control. window is how much of
+// the stream is kept (default 30 minutes). Close the TimeShift to stop
+// recording.
+func (r *Renderer) StreamLive(ctx context.Context, tv *TV, hlsURL string, title string, window time.Duration, opts ...ProxyOption) (*TimeShift, error) {
+	buffer, err := r.server.RecordLive(ctx, hlsURL, window, opts...)
+	if err != nil {
+		return nil, err
+	}
+	ts := &TimeShift{renderer: r, tv: tv, title: title, buffer: buffer}
+	if err := r.StreamVideo(ctx, tv, buffer.URL(), title); err != nil {
+		buffer.Close()
+		return nil, err
+	}
+	return ts, nil
+}
+
+// Buffer returns the recording behind the stream
+func (ts *TimeShift) Buffer() *LiveBuffer {
+	return ts.buffer
+}
+
+// PauseLive pauses the TV; the stream keeps recording
+func (ts *TimeShift) PauseLive(ctx context.Context) error {
+	ts.buffer.Pause()
+	return ts.tv.Pause(ctx)
+}
+
+// ResumeLive continues playback where it was paused
+func (ts *TimeShift) ResumeLive(ctx context.Context) error {
+	ts.buffer.Resume()
+	return ts.tv.Play(ctx, SpeedNormal)
+}
+
+// SeekBack jumps d further back in the buffered stream
+func (ts *TimeShift) SeekBack(ctx context.Context, d time.Duration) error {
+	ts.buffer.SeekBack(d)
+	return ts.renderer.StreamVideo(ctx, ts.tv, ts.buffer.URL(), ts.title)
+}
+
+// GoLive jumps to the live edge of the stream
+func (ts *TimeShift) GoLive(ctx context.Context) error {
+	ts.buffer.GoLive()
+	return ts.renderer.StreamVideo(ctx, ts.tv, ts.buffer.URL(), ts.title)
+}
+
+// Close stops recording; the TV stops getting new segments
+func (ts *TimeShift) Close() error {
+	return ts.buffer.Close()
+}
@@ -0,0 +1,198 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// liveOrigin serves a live playlist of the five newest 10s segments
+type liveOrigin struct {
+	mu      sync.Mutex
+	head    int
+	endList bool
+}
+
+func (o *liveOrigin) advance() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.head++
+}
+
+func (o *liveOrigin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if name, ok := strings.CutPrefix(r.URL.Path, "/live/"); ok && strings.HasSuffix(name, ".ts") {
+		io.WriteString(w, strings.TrimSuffix(name, ".ts"))
+		return
+	}
+	first := max(o.head-4, 0)
+	fmt.Fprintf(w, "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-MEDIA-SEQUENCE:%d\n", first)
+	for i := first; i <= o.head; i++ {
+		fmt.Fprintf(w, "#EXTINF:10.0,\ns%d.ts\n", i)
+	}
+	if o.endList {
+		io.WriteString(w, "#EXT-X-ENDLIST\n")
+	}
+}
+
+func TestLiveBuffer(t *testing.T) {
+	origin := &liveOrigin{head: 4}
+	upstream := httptest.NewServer(origin)
+	defer upstream.Close()
+
+	server, err := NewImageServer()
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Close()
+
+	ctx := context.Background()
+	buffer, err := server.RecordLive(ctx, upstream.URL+"/live/index.m3u8", time.Hour)
+	if err != nil {
+		t.Fatalf("RecordLive failed: %v", err)
+	}
+	defer buffer.Close()
+
+	// Drive the clock and the recording by hand
+	clock := time.Now()
+	buffer.mu.Lock()
+	buffer.now = func() time.Time { return clock }
+	buffer.mu.Unlock()
+	step := func() {
+		t.Helper()
+		clock = clock.Add(10 * time.Second)
+		origin.advance()
+		if err := buffer.poll(ctx); err != nil {
+			t.Fatalf("poll failed: %v", err)
+		}
+	}
+
+	// Local sequence numbers: s2..s4 joined live as 0..2, then s5 = 3, ...
+	expect := func(what string, seqs ...int) {
+		t.Helper()
+		playlist := buffer.playlist()
+		var want strings.Builder
+		for _, seq := range seqs {
+			fmt.Fprintf(&want, "#EXTINF:10.000,\n%d.ts\n", seq)
+		}
+		if !strings.Contains(playlist, want.String()) || !strings.Contains(playlist, fmt.Sprintf("#EXT-X-MEDIA-SEQUENCE:%d\n", seqs[0])) {
+			t.Errorf("%s: playlist\n%s\nwant segments %v", what, playlist, seqs)
+		}
+	}
+
+	step()
+	step()
+	expect("live", 2, 3, 4)
+
+	buffer.Pause()
+	step()
+	expect("paused", 2, 3, 4)
+
+	buffer.Resume()
+	if got := buffer.Offset(); got != 10*time.Second {
+		t.Errorf("Offset after resume = %v, want 10s", got)
+	}
+	step()
+	expect("resumed", 3, 4, 5)
+
+	url := buffer.URL()
+	buffer.SeekBack(15 * time.Second)
+	expect("seek back", 1, 2, 3)
+	if buffer.URL() == url {
+		t.Error("URL did not change after seeking")
+	}
+	if got := buffer.Buffered(); got < 40*time.Second {
+		t.Errorf("Buffered = %v, want at least 40s", got)
+	}
+
+	buffer.GoLive()
+	expect("live again", 4, 5, 6)
+
+	// Segments are served from the buffer
+	base := buffer.URL()[:strings.LastIndex(buffer.URL(), "/")+1]
+	resp, err := http.Get(base + "3.ts")
+	if err != nil {
+		t.Fatalf("GET segment: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "s5" {
+		t.Errorf("segment 3 = %q, want s5", body)
+	}
+
+	origin.mu.Lock()
+	origin.endList = true
+	origin.mu.Unlock()
+	if _, err := server.RecordLive(ctx, upstream.URL+"/live/index.m3u8", time.Hour); !errors.Is(err, ErrNotLive) {
+		t.Errorf("Expected ErrNotLive for a VOD playlist, got %v", err)
+	}
+}
+
+// TestTimeShift tests the TV commands behind the DVR controls
+func TestTimeShift(t *testing.T) {
+	upstream := httptest.NewServer(&liveOrigin{head: 4})
+	defer upstream.Close()
+
+	var mu sync.Mutex
+	var actions []string
+	var lastURI string
+	currentURI := regexp.MustCompile(`<CurrentURI>([^<]+)</CurrentURI>`)
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		action := r.Header.Get("SOAPAction")
+		action = strings.Trim(action[strings.LastIndex(action, "#")+1:], `"`)
+		mu.Lock()
+		actions = append(actions, action)
+		if m := currentURI.FindSubmatch(body); m != nil {
+			lastURI = string(m[1])
+		}
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	ctx := context.Background()
+	ts, err := renderer.StreamLive(ctx, tv, upstream.URL+"/live/index.m3u8", "Camera", 0)
+	if err != nil {
+		t.Fatalf("StreamLive failed: %v", err)
+	}
+	defer ts.Close()
+
+	first := lastURI
+	if err := ts.PauseLive(ctx); err != nil {
+		t.Fatalf("PauseLive failed: %v", err)
+	}
+	if err := ts.ResumeLive(ctx); err != nil {
+		t.Fatalf("ResumeLive failed: %v", err)
+	}
+	if err := ts.SeekBack(ctx, time.Minute); err != nil {
+		t.Fatalf("SeekBack failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := "SetAVTransportURI Play Pause Play SetAVTransportURI Play"
+	if got := strings.Join(actions, " "); got != want {
+		t.Errorf("actions = %s, want %s", got, want)
+	}
+	if !strings.Contains(first, "/timeshift/") || lastURI == first {
+		t.Errorf("TV played %s then %s, want a new time-shift URL after seeking", first, lastURI)
+	}
+}
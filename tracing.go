@@ -0,0 +1,120 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// Tracer starts trace spans, e.g. by handing them to an OpenTelemetry
+// TracerProvider. It has the shape of OpenTelemetry's trace.Tracer, so an
+// adapter takes a few lines (see the README) and the package keeps its
+// zero dependencies.
+type Tracer interface {
+	// Start starts a span as a child of the one in ctx, if any, and
+	// returns a context carrying the new span
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is an operation being traced
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+
+	// RecordError records err and marks the span as failed
+	RecordError(err error)
+
+	End()
+}
+
+// Attribute annotates a span (e.g. "smarttv.tv.name" = "TV Salon")
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// tracerKey is the context key of the Tracer
+type tracerKey struct{}
+
+// ContextWithTracer returns a context under which discovery, SOAP actions
+// and Cast commands are traced with t. Renderers configured WithTracer
+// pass theirs down on their own.
+func ContextWithTracer(ctx context.Context, t Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// WithTracer traces the renderer's display and streaming pipelines, the
+// commands they send to TVs and the requests of its image server with t
+func WithTracer(t Tracer) Option {
+	return func(r *Renderer) {
+		r.tracer = t
+		r.serverOpts = append(r.serverOpts, WithServerTracer(t))
+	}
+}
+
+// WithServerTracer traces every request of the image server with t
+func WithServerTracer(t Tracer) ServerOption {
+	return func(s *ImageServer) {
+		s.tracer = t
+	}
+}
+
+// noopSpan is the span of untraced operations
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) RecordError(error)          {}
+func (noopSpan) End()                       {}
+
+// startSpan starts a span with the tracer of ctx; without one it returns
+// ctx and a span that does nothing
+func startSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	t, _ := ctx.Value(tracerKey{}).(Tracer)
+	if t == nil {
+		return ctx, noopSpan{}
+	}
+	return t.Start(ctx, name, attrs...)
+}
+
+// endSpan records err, if any, and ends span
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// startSpan starts a span for a pipeline on tv, tracing with the
+// renderer's tracer unless ctx brings its own
+func (r *Renderer) startSpan(ctx context.Context, name string, tv *TV) (context.Context, Span) {
+	if r.tracer != nil && ctx.Value(tracerKey{}) == nil {
+		ctx = ContextWithTracer(ctx, r.tracer)
+	}
+	return startSpan(ctx, name, tv.traceAttributes()...)
+}
+
+// traceAttributes identifies the TV on a span
+func (tv *TV) traceAttributes() []Attribute {
+	attrs := []Attribute{{Key: "smarttv.tv.name", Value: tv.Name}}
+	if tv.UDN != "" {
+		attrs = append(attrs, Attribute{Key: "smarttv.tv.udn", Value: tv.UDN})
+	}
+	return attrs
+}
+
+// traceRequest wraps h in a span per request when the server has a tracer
+func (s *ImageServer) traceRequest(h http.Handler) http.Handler {
+	if s.tracer == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := s.tracer.Start(r.Context(), "smarttv.serve",
+			Attribute{Key: "http.request.method", Value: r.Method},
+			Attribute{Key: "url.path", Value: r.URL.Path},
+			Attribute{Key: "client.address", Value: r.RemoteAddr},
+		)
+		defer span.End()
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r.WithContext(ctx))
+		span.SetAttributes(Attribute{Key: "http.response.status_code", Value: strconv.Itoa(rec.status)})
+	})
+}
@@ -0,0 +1,103 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingTracer records finished spans as "parent > name"
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []string
+	errs  []string
+}
+
+type recordingSpan struct {
+	t      *recordingTracer
+	name   string
+	parent string
+	err    error
+}
+
+type spanKey struct{}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	parent, _ := ctx.Value(spanKey{}).(string)
+	return context.WithValue(ctx, spanKey{}, name), &recordingSpan{t: t, name: name, parent: parent}
+}
+
+func (s *recordingSpan) SetAttributes(...Attribute) {}
+func (s *recordingSpan) RecordError(err error)      { s.err = err }
+
+func (s *recordingSpan) End() {
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+	s.t.spans = append(s.t.spans, s.parent+" > "+s.name)
+	if s.err != nil {
+		s.t.errs = append(s.t.errs, s.name)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("SOAPAction"), "#Stop") {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(soapFault(701, "Transition not available")))
+			return
+		}
+		w.Write([]byte(`<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body></s:Body></s:Envelope>`))
+	}))
+	defer mockTV.Close()
+
+	tracer := &recordingTracer{}
+	renderer, err := NewRenderer(WithTracer(tracer))
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	ctx := context.Background()
+	tv := &TV{Name: "Lobby", ControlURL: mockTV.URL, Actions: []string{"SetAVTransportURI", "Play", "Stop"}}
+	if err := renderer.DisplayText(ctx, tv, "Hello"); err != nil {
+		t.Fatalf("DisplayText failed: %v", err)
+	}
+	renderer.Stop(ctx, tv)
+
+	// The TV would fetch the frame; a request of the image server is traced
+	resp, err := http.Get(renderer.ServerURL() + "/missing.jpg")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+
+	// The server ends its span after the response went out
+	deadline := time.Now().Add(time.Second)
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	for len(tracer.spans) < 8 && time.Now().Before(deadline) {
+		tracer.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		tracer.mu.Lock()
+	}
+	want := []string{
+		"smarttv.display_text > smarttv.encode",
+		"smarttv.display > smarttv.soap SetAVTransportURI",
+		"smarttv.display > smarttv.soap Play",
+		"smarttv.display_text > smarttv.display",
+		" > smarttv.display_text",
+		"smarttv.stop > smarttv.soap Stop",
+		" > smarttv.stop",
+		" > smarttv.serve",
+	}
+	if got := strings.Join(tracer.spans, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("Spans:\n%s\nwant:\n%s", got, strings.Join(want, "\n"))
+	}
+	if got := strings.Join(tracer.errs, ","); got != "smarttv.soap Stop,smarttv.stop" {
+		t.Errorf("Failed spans: %s", got)
+	}
+}
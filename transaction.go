@@ -0,0 +1,180 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Transaction switches a group of TVs to new content together: content is
+// preloaded on every TV first and only then started with a coordinated
+// Play, so a video wall never ends up half updated. If any TV fails, all
+// of them are rolled back to what they showed before.
+//
+// TVs that start playing as soon as their URI is set cannot be held back
+// during preloading; they are still rolled back on failure.
+type Transaction struct {
+	renderer *Renderer
+	tvs      []*TV
+	content  map[*TV]Content
+}
+
+// Begin starts a transaction for a group of TVs, e.g. a zone
+func (r *Renderer) Begin(tvs []*TV) *Transaction {
+	return &Transaction{renderer: r, tvs: tvs, content: make(map[*TV]Content)}
+}
+
+// Set assigns the content one TV switches to
+func (tx *Transaction) Set(tv *TV, c Content) *Transaction {
+	tx.content[tv] = c
+	return tx
+}
+
+// SetAll assigns the same content to every TV without its own content
+func (tx *Transaction) SetAll(c Content) *Transaction {
+	for _, tv := range tx.tvs {
+		if _, ok := tx.content[tv]; !ok {
+			tx.content[tv] = c
+		}
+	}
+	return tx
+}
+
+// prepared is content stored and ready to load on a TV
+type prepared struct {
+	url         string
+	contentType string
+	video       bool
+	title       string
+}
+
+// Commit preloads every TV's content, then plays it on all TVs at once.
+// On failure every TV is restored to its previous frame (or stopped when
+// none is known) and the error is returned.
+func (tx *Transaction) Commit(ctx context.Context) error {
+	r := tx.renderer
+
+	// Encode everything before touching any TV
+	items := make(map[*TV]prepared, len(tx.tvs))
+	for _, tv := range tx.tvs {
+		c, ok := tx.content[tv]
+		if !ok {
+			return fmt.Errorf("%s: no content set", tv.Name)
+		}
+		item, err := r.prepare(tv, c)
+		if err != nil {
+			return fmt.Errorf("%s: %w", tv.Name, err)
+		}
+		items[tv] = item
+	}
+
+	unlock, err := r.lockTVs(ctx, tx.tvs)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Remember what to roll back to
+	previous := make(map[*TV]shownFrame, len(tx.tvs))
+	r.mu.Lock()
+	for _, tv := range tx.tvs {
+		if frame, ok := r.lastFrame[tv.ControlURL]; ok {
+			previous[tv] = frame
+		}
+	}
+	r.mu.Unlock()
+
+	start := time.Now()
+
+	// Phase 1: preload
+	err = fanOut(ctx, tx.tvs, func(ctx context.Context, tv *TV) error {
+		item := items[tv]
+		if item.video {
+			if err := r.intend(ctx, tv, JournalVideo, item.url, "", item.title); err != nil {
+				return err
+			}
+			return tv.setAVTransportURIForVideo(ctx, item.url, item.title)
+		}
+		if err := r.intend(ctx, tv, JournalCast, item.url, item.contentType, ""); err != nil {
+			return err
+		}
+		return tv.setAVTransportURI(ctx, item.url, r.imageRes(item.url, item.contentType))
+	})
+	if err != nil {
+		return tx.rollback(ctx, previous, fmt.Errorf("preload: %w", err))
+	}
+
+	// Phase 2: flip every TV together
+	err = fanOut(ctx, tx.tvs, func(ctx context.Context, tv *TV) error {
+		return tv.play(ctx)
+	})
+	if err != nil {
+		return tx.rollback(ctx, previous, fmt.Errorf("play: %w", err))
+	}
+
+	for _, tv := range tx.tvs {
+		item := items[tv]
+		if item.video {
+			r.recordVideo(ctx, tv, item.url, item.title, nil)
+			continue
+		}
+		r.mu.Lock()
+		r.activeTVs[tv.ControlURL] = true
+		r.mu.Unlock()
+		r.shown(ctx, tv, item.url, start)
+	}
+	return nil
+}
+
+// rollback restores every TV of the transaction to its previous frame
+func (tx *Transaction) rollback(ctx context.Context, previous map[*TV]shownFrame, cause error) error {
+	r := tx.renderer
+	ctx = context.WithoutCancel(ctx)
+
+	err := fanOut(ctx, tx.tvs, func(ctx context.Context, tv *TV) error {
+		frame, ok := previous[tv]
+		if !ok {
+			if err := r.intend(ctx, tv, JournalStop, "", "", ""); err != nil {
+				return err
+			}
+			return tv.stop(ctx)
+		}
+
+		// The old URL may have been evicted from the server; store it again
+		url := r.server.StoreContent(frame.img.data, frame.img.contentType)
+		if err := r.intend(ctx, tv, JournalCast, url, frame.img.contentType, ""); err != nil {
+			return err
+		}
+		if err := tv.setAVTransportURI(ctx, url, r.imageRes(url, frame.img.contentType)); err != nil {
+			return err
+		}
+		return tv.play(ctx)
+	})
+	if err != nil {
+		return errors.Join(cause, fmt.Errorf("rollback: %w", err))
+	}
+	return fmt.Errorf("%w (rolled back)", cause)
+}
+
+// prepare encodes and stores content for a TV without contacting it
+func (r *Renderer) prepare(tv *TV, c Content) (prepared, error) {
+	switch {
+	case c.Text != "":
+		url, contentType, err := r.storeImageFor(tv, RenderText(c.Text, r.defaultText()))
+		return prepared{url: url, contentType: contentType}, err
+	case c.Image != nil:
+		url, contentType, err := r.storeImageFor(tv, c.Image)
+		return prepared{url: url, contentType: contentType}, err
+	case c.JPEG != nil:
+		return prepared{url: r.server.Store(c.JPEG), contentType: "image/jpeg"}, nil
+	case c.VideoURL != "":
+		title := c.Title
+		if title == "" {
+			title = r.message(MsgVideoStream)
+		}
+		return prepared{url: c.VideoURL, video: true, title: title}, nil
+	default:
+		return prepared{}, ErrEmptyContent
+	}
+}
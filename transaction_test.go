@@ -0,0 +1,82 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestTransactionRollback tests that a failing TV rolls the whole group back
+// to its previous content
+func TestTransactionRollback(t *testing.T) {
+	var mu sync.Mutex
+	var actions []string
+	var failPlay atomic.Bool
+
+	newMock := func(fail bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			soapAction := r.Header.Get("SOAPAction")
+			action := strings.Trim(soapAction[strings.Index(soapAction, "#")+1:], `"`)
+			if fail && action == "Play" && failPlay.CompareAndSwap(true, false) {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if !fail {
+				mu.Lock()
+				actions = append(actions, action)
+				mu.Unlock()
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+	good := newMock(false)
+	defer good.Close()
+	bad := newMock(true)
+	defer bad.Close()
+
+	tvActions := []string{"SetAVTransportURI", "Play", "Stop"}
+	tvs := []*TV{
+		{Name: "Left", ControlURL: good.URL, Actions: tvActions},
+		{Name: "Right", ControlURL: bad.URL, Actions: tvActions},
+	}
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	ctx := context.Background()
+	if err := renderer.DisplayTextAll(ctx, tvs, "BEFORE"); err != nil {
+		t.Fatalf("DisplayTextAll failed: %v", err)
+	}
+	before, _ := renderer.LastFrame(tvs[0])
+
+	failPlay.Store(true)
+	err = renderer.Begin(tvs).SetAll(Content{Text: "AFTER"}).Commit(ctx)
+	if err == nil || !strings.Contains(err.Error(), "rolled back") {
+		t.Fatalf("Expected a rolled back error, got %v", err)
+	}
+
+	mu.Lock()
+	got := strings.Join(actions, ",")
+	mu.Unlock()
+	want := "SetAVTransportURI,Play,SetAVTransportURI,Play,SetAVTransportURI,Play"
+	if got != want {
+		t.Errorf("Expected actions %s, got %s", want, got)
+	}
+
+	after, _ := renderer.LastFrame(tvs[0])
+	if !after.ShownAt.Equal(before.ShownAt) {
+		t.Error("Expected the failed transaction not to be recorded as shown")
+	}
+
+	// Once the TV recovers the same transaction goes through
+	if err := renderer.Begin(tvs).SetAll(Content{Text: "AFTER"}).Commit(ctx); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+}
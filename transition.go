@@ -0,0 +1,179 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/draw"
+	"time"
+)
+
+// TransitionKind selects how one frame turns into the next
+type TransitionKind string
+
+// Transition kinds
+const (
+	TransitionCut        TransitionKind = "cut"         // Switch at once
+	TransitionCrossfade  TransitionKind = "crossfade"   // Blend into the new frame
+	TransitionSlideLeft  TransitionKind = "slide-left"  // New frame pushes in from the right
+	TransitionSlideRight TransitionKind = "slide-right" // New frame pushes in from the left
+	TransitionSlideUp    TransitionKind = "slide-up"    // New frame pushes in from the bottom
+	TransitionSlideDown  TransitionKind = "slide-down"  // New frame pushes in from the top
+	TransitionWipeLeft   TransitionKind = "wipe-left"   // New frame is revealed right to left
+	TransitionWipeRight  TransitionKind = "wipe-right"  // New frame is revealed left to right
+)
+
+// Easing maps linear progress (0-1) to eased progress (0-1)
+type Easing func(t float64) float64
+
+// Easing functions
+var (
+	Linear    Easing = func(t float64) float64 { return t }
+	EaseIn    Easing = func(t float64) float64 { return t * t }
+	EaseOut   Easing = func(t float64) float64 { return t * (2 - t) }
+	EaseInOut Easing = func(t float64) float64 {
+		if t < 0.5 {
+			return 2 * t * t
+		}
+		return -1 + (4-2*t)*t
+	}
+)
+
+// Transition animates the change from the frame on screen to a new one.
+// The intermediate frames are sent like a FramePlan, so the effect is only
+// as smooth as the TV switches images; most DLNA TVs manage a few per
+// second.
+type Transition struct {
+	Kind     TransitionKind
+	Duration time.Duration // Default 1s
+	FPS      float64       // Intermediate frames per second (default 4)
+	Easing   Easing        // Default EaseInOut
+}
+
+// withDefaults returns the transition with zero fields set to defaults
+func (t Transition) withDefaults() Transition {
+	if t.Duration <= 0 {
+		t.Duration = time.Second
+	}
+	if t.FPS <= 0 {
+		t.FPS = 4
+	}
+	if t.Easing == nil {
+		t.Easing = EaseInOut
+	}
+	return t
+}
+
+// Frames returns the intermediate frames from one image to another, not
+// including either of them. from is scaled to the size of to if needed.
+func (t Transition) Frames(from, to image.Image) []image.Image {
+	t = t.withDefaults()
+	if t.Kind == TransitionCut || t.Kind == "" {
+		return nil
+	}
+
+	bounds := image.Rect(0, 0, to.Bounds().Dx(), to.Bounds().Dy())
+	a := fitTo(from, bounds)
+	b := fitTo(to, bounds)
+
+	n := int(t.Duration.Seconds()*t.FPS) - 1
+	frames := make([]image.Image, 0, max(n, 0))
+	for i := 1; i <= n; i++ {
+		p := t.Easing(float64(i) / float64(n+1))
+		frames = append(frames, t.frameAt(a, b, p))
+	}
+	return frames
+}
+
+// frameAt renders the transition at progress p (0 = a, 1 = b)
+func (t Transition) frameAt(a, b *image.RGBA, p float64) *image.RGBA {
+	w, h := a.Rect.Dx(), a.Rect.Dy()
+	dst := image.NewRGBA(a.Rect)
+
+	switch t.Kind {
+	case TransitionSlideLeft, TransitionSlideRight, TransitionSlideUp, TransitionSlideDown:
+		// Offset of the new frame; the old one moves along with it
+		var off image.Point
+		switch t.Kind {
+		case TransitionSlideLeft:
+			off = image.Pt(w-int(float64(w)*p), 0)
+			draw.Draw(dst, a.Rect.Sub(image.Pt(w, 0)).Add(off), a, image.Point{}, draw.Src)
+		case TransitionSlideRight:
+			off = image.Pt(int(float64(w)*p)-w, 0)
+			draw.Draw(dst, a.Rect.Add(image.Pt(w, 0)).Add(off), a, image.Point{}, draw.Src)
+		case TransitionSlideUp:
+			off = image.Pt(0, h-int(float64(h)*p))
+			draw.Draw(dst, a.Rect.Sub(image.Pt(0, h)).Add(off), a, image.Point{}, draw.Src)
+		case TransitionSlideDown:
+			off = image.Pt(0, int(float64(h)*p)-h)
+			draw.Draw(dst, a.Rect.Add(image.Pt(0, h)).Add(off), a, image.Point{}, draw.Src)
+		}
+		draw.Draw(dst, b.Rect.Add(off), b, image.Point{}, draw.Src)
+
+	case TransitionWipeLeft, TransitionWipeRight:
+		draw.Draw(dst, dst.Rect, a, image.Point{}, draw.Src)
+		edge := int(float64(w) * p)
+		reveal := image.Rect(0, 0, edge, h)
+		if t.Kind == TransitionWipeLeft {
+			reveal = image.Rect(w-edge, 0, w, h)
+		}
+		draw.Draw(dst, reveal, b, reveal.Min, draw.Src)
+
+	default: // TransitionCrossfade
+		weight := uint32(p*256 + 0.5)
+		for i := range dst.Pix {
+			dst.Pix[i] = uint8((uint32(a.Pix[i])*(256-weight) + uint32(b.Pix[i])*weight) >> 8)
+		}
+	}
+
+	return dst
+}
+
+// fitTo returns img as an RGBA image covering bounds, cropping to fill
+func fitTo(img image.Image, bounds image.Rectangle) *image.RGBA {
+	src := img.Bounds()
+	if src.Dx() == bounds.Dx() && src.Dy() == bounds.Dy() {
+		// Copy so both frames share the same tight pixel layout
+		dst := image.NewRGBA(bounds)
+		draw.Draw(dst, bounds, img, src.Min, draw.Src)
+		return dst
+	}
+	return scaleImage(img, coverRect(src, bounds.Dx(), bounds.Dy()), bounds.Dx(), bounds.Dy())
+}
+
+// DisplayWithTransition shows img on the TV, animating the change from the
+// frame currently on screen. Without a known previous frame the image is
+// simply displayed.
+func (r *Renderer) DisplayWithTransition(ctx context.Context, tv *TV, img image.Image, t Transition) error {
+	r.mu.Lock()
+	prev, ok := r.lastFrame[tv.ControlURL]
+	r.mu.Unlock()
+
+	if ok && t.Kind != TransitionCut && t.Kind != "" {
+		if from, _, err := image.Decode(bytes.NewReader(prev.img.data)); err == nil {
+			t = t.withDefaults()
+			frames := t.Frames(from, img)
+
+			interval := time.Duration(float64(time.Second) / t.FPS)
+			start := time.Now()
+			plan := FramePlan{LateTolerance: interval}
+			for i, frame := range frames {
+				plan.Frames = append(plan.Frames, Frame{At: start.Add(time.Duration(i) * interval), Image: frame})
+			}
+
+			// Late intermediate frames are skipped; only the final one matters
+			if _, err := r.PlayFramePlan(ctx, []*TV{tv}, plan); err != nil {
+				return err
+			}
+			if wait := time.Until(start.Add(time.Duration(len(frames)) * interval)); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+	}
+
+	return r.DisplayImage(ctx, tv, img)
+}
@@ -0,0 +1,102 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// solid returns a w x h image filled with c
+func solid(w, h int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), &image.Uniform{c}, image.Point{}, draw.Src)
+	return img
+}
+
+// TestTransitionFrames tests the intermediate frames of each effect
+func TestTransitionFrames(t *testing.T) {
+	from := solid(8, 4, Black)
+	to := solid(8, 4, White)
+
+	half := func(kind TransitionKind) image.Image {
+		frames := Transition{Kind: kind, Duration: time.Second, FPS: 2, Easing: Linear}.Frames(from, to)
+		if len(frames) != 1 {
+			t.Fatalf("%s: expected 1 intermediate frame, got %d", kind, len(frames))
+		}
+		return frames[0]
+	}
+	gray := func(img image.Image, x, y int) uint8 {
+		return color.RGBAModel.Convert(img.At(x, y)).(color.RGBA).R
+	}
+
+	if g := gray(half(TransitionCrossfade), 0, 0); g < 126 || g > 129 {
+		t.Errorf("crossfade: expected mid gray, got %d", g)
+	}
+
+	tests := []struct {
+		kind         TransitionKind
+		x, y         int
+		wantNewFrame bool
+	}{
+		{TransitionSlideLeft, 1, 0, false},
+		{TransitionSlideLeft, 6, 0, true},
+		{TransitionSlideRight, 1, 0, true},
+		{TransitionSlideUp, 0, 3, true},
+		{TransitionSlideDown, 0, 3, false},
+		{TransitionWipeLeft, 6, 0, true},
+		{TransitionWipeRight, 6, 0, false},
+	}
+	for _, tt := range tests {
+		got := gray(half(tt.kind), tt.x, tt.y) == 255
+		if got != tt.wantNewFrame {
+			t.Errorf("%s at (%d,%d): new frame shown = %v, want %v", tt.kind, tt.x, tt.y, got, tt.wantNewFrame)
+		}
+	}
+
+	if frames := (Transition{Kind: TransitionCut}).Frames(from, to); frames != nil {
+		t.Errorf("cut: expected no frames, got %d", len(frames))
+	}
+}
+
+// TestDisplayWithTransition tests that intermediate frames are sent before
+// the final image
+func TestDisplayWithTransition(t *testing.T) {
+	var sets atomic.Int32
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("SOAPAction"), "#SetAVTransportURI") {
+			sets.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	tv := &TV{Name: "Frame", ControlURL: mockTV.URL, Actions: []string{"SetAVTransportURI", "Play"}}
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	ctx := context.Background()
+	if err := renderer.DisplayImage(ctx, tv, solid(64, 36, Black)); err != nil {
+		t.Fatalf("DisplayImage failed: %v", err)
+	}
+
+	tr := Transition{Kind: TransitionCrossfade, Duration: 600 * time.Millisecond, FPS: 5}
+	if err := renderer.DisplayWithTransition(ctx, tv, solid(64, 36, White), tr); err != nil {
+		t.Fatalf("DisplayWithTransition failed: %v", err)
+	}
+
+	// First image, 2 intermediate frames, final image
+	if got := sets.Load(); got != 4 {
+		t.Errorf("Expected 4 frames sent, got %d", got)
+	}
+}
@@ -0,0 +1,649 @@
+package nimsforestsmarttv
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tunnel protocol
+//
+// A daemon on the TVs' network can't be reached from outside without port
+// forwarding, so it dials out instead: it sends an HTTP/1.1 request with
+// "Upgrade: smarttv-tunnel", its name in X-Tunnel-Name and the token as
+// "Authorization: Bearer TOKEN" to a TunnelRelay. Once the relay answers
+// 101 Switching Protocols the roles swap: the relay sends plain HTTP/1.1
+// requests over the connection and the daemon answers them with its
+// handler. Each connection carries one request at a time, so the daemon
+// keeps a few open.
+const tunnelProtocol = "smarttv-tunnel"
+
+const (
+	tunnelConns      = 4                // Connections a daemon keeps open
+	tunnelMaxBackoff = 30 * time.Second // Longest wait between reconnects
+	tunnelDialWait   = 30 * time.Second // Limit for connecting and upgrading
+)
+
+// ErrTunnelOffline is returned for requests to a daemon that has no tunnel
+// to the relay
+var ErrTunnelOffline = errors.New("tunnel not connected")
+
+// ErrTunnelRejected is returned by Tunnel.Run when the relay refuses the
+// daemon's token
+var ErrTunnelRejected = errors.New("tunnel rejected by relay")
+
+// TunnelOption configures a Tunnel or TunnelRelay
+type TunnelOption func(*tunnelConfig)
+
+type tunnelConfig struct {
+	token     string
+	name      string
+	conns     int
+	authorize func(name, token string) bool
+	tlsConfig *tls.Config
+	insecure  bool // Allow plain http relays on other hosts
+}
+
+// WithTunnelToken sets the shared token: daemons send it and relays refuse
+// daemons without it
+func WithTunnelToken(token string) TunnelOption {
+	return func(c *tunnelConfig) {
+		c.token = token
+	}
+}
+
+// WithTunnelName sets the name the daemon registers under at the relay
+// (default the host name)
+func WithTunnelName(name string) TunnelOption {
+	return func(c *tunnelConfig) {
+		c.name = name
+	}
+}
+
+// WithTunnelConns sets how many connections a daemon keeps open, which is
+// how many requests the relay can send it at once (default 4)
+func WithTunnelConns(n int) TunnelOption {
+	return func(c *tunnelConfig) {
+		c.conns = n
+	}
+}
+
+// WithTunnelAuth makes a relay authorize daemons with fn instead of a
+// shared token, e.g. to give every daemon a token of its own
+func WithTunnelAuth(fn func(name, token string) bool) TunnelOption {
+	return func(c *tunnelConfig) {
+		c.authorize = fn
+	}
+}
+
+// WithTunnelTLSConfig sets the TLS configuration for https relays
+func WithTunnelTLSConfig(cfg *tls.Config) TunnelOption {
+	return func(c *tunnelConfig) {
+		c.tlsConfig = cfg
+	}
+}
+
+// WithInsecureRelay lets a daemon connect to a plain http relay on another
+// host. The token then travels in cleartext and anyone on the path can
+// pose as the relay, so only use it on networks you trust.
+func WithInsecureRelay() TunnelOption {
+	return func(c *tunnelConfig) {
+		c.insecure = true
+	}
+}
+
+func newTunnelConfig(opts []TunnelOption) tunnelConfig {
+	cfg := tunnelConfig{conns: tunnelConns}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.name == "" {
+		cfg.name, _ = os.Hostname()
+	}
+	if cfg.conns <= 0 {
+		cfg.conns = tunnelConns
+	}
+	return cfg
+}
+
+// Tunnel connects a daemon on the TVs' network to a TunnelRelay, so a cloud
+// service can send it requests without port forwarding
+type Tunnel struct {
+	relay   *url.URL
+	handler http.Handler
+	cfg     tunnelConfig
+
+	mu        sync.Mutex
+	connected int
+}
+
+// NewTunnel creates a tunnel to the relay at relayURL serving requests
+// with handler. The relay must be https, except on this host or with
+// WithInsecureRelay.
+func NewTunnel(relayURL string, handler http.Handler, opts ...TunnelOption) (*Tunnel, error) {
+	u, err := url.Parse(relayURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse relay URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported relay URL scheme %q", u.Scheme)
+	}
+	cfg := newTunnelConfig(opts)
+	if u.Scheme == "http" && !cfg.insecure && !isLoopbackHost(u.Hostname()) {
+		return nil, fmt.Errorf("relay %s is not https: the token would travel in cleartext (see WithInsecureRelay)", u.Host)
+	}
+	return &Tunnel{relay: u, handler: handler, cfg: cfg}, nil
+}
+
+// isLoopbackHost reports whether host names this machine
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Connected returns the number of open connections to the relay
+func (t *Tunnel) Connected() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.connected
+}
+
+// Run keeps connections to the relay open and serves the requests sent
+// over them until ctx is done. Lost connections are dialed again with a
+// growing delay. It returns ErrTunnelRejected if the relay refuses the
+// token.
+func (t *Tunnel) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ln := &tunnelListener{conns: make(chan net.Conn), done: make(chan struct{})}
+	server := &http.Server{Handler: t.handler}
+	go server.Serve(ln)
+
+	errs := make(chan error, t.cfg.conns)
+	for range t.cfg.conns {
+		go func() {
+			errs <- t.keepConnected(ctx, ln)
+		}()
+	}
+
+	var err error
+	for range t.cfg.conns {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+			cancel()
+		}
+	}
+	server.Close()
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// keepConnected keeps one connection to the relay open until ctx is done
+func (t *Tunnel) keepConnected(ctx context.Context, ln *tunnelListener) error {
+	backoff := time.Second
+	for {
+		conn, err := t.dial(ctx)
+		if errors.Is(err, ErrTunnelRejected) {
+			return err
+		}
+		if ctx.Err() != nil {
+			if conn != nil {
+				conn.Close()
+			}
+			return nil
+		}
+		if err != nil {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil
+			case <-timer.C:
+			}
+			backoff = min(backoff*2, tunnelMaxBackoff)
+			continue
+		}
+		backoff = time.Second
+
+		closed := make(chan struct{})
+		tc := &tunnelConn{Conn: conn, closed: closed}
+		select {
+		case ln.conns <- tc:
+		case <-ctx.Done():
+			conn.Close()
+			return nil
+		}
+		t.addConnected(1)
+		select {
+		case <-closed:
+		case <-ctx.Done():
+		}
+		t.addConnected(-1)
+	}
+}
+
+func (t *Tunnel) addConnected(n int) {
+	t.mu.Lock()
+	t.connected += n
+	t.mu.Unlock()
+}
+
+// dial opens a connection to the relay and upgrades it to a tunnel
+func (t *Tunnel) dial(ctx context.Context) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, tunnelDialWait)
+	defer cancel()
+
+	host := t.relay.Host
+	if t.relay.Port() == "" {
+		port := "80"
+		if t.relay.Scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(t.relay.Hostname(), port)
+	}
+	var conn net.Conn
+	var err error
+	if t.relay.Scheme == "https" {
+		dialer := &tls.Dialer{Config: t.cfg.tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", host)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connect to relay: %w", err)
+	}
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	req, err := http.NewRequest(http.MethodGet, t.relay.String(), nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", tunnelProtocol)
+	req.Header.Set("X-Tunnel-Name", t.cfg.name)
+	if t.cfg.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.cfg.token)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("upgrade: %w", err)
+	}
+
+	// The relay may send its first request right after the upgrade, so
+	// reads go on through the buffer
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("upgrade: %w", err)
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusSwitchingProtocols:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		conn.Close()
+		return nil, fmt.Errorf("%w: HTTP %d", ErrTunnelRejected, resp.StatusCode)
+	default:
+		conn.Close()
+		return nil, fmt.Errorf("upgrade: relay answered HTTP %d", resp.StatusCode)
+	}
+	conn.SetDeadline(time.Time{})
+	return &bufferedConn{Conn: conn, r: br}, nil
+}
+
+// tunnelListener hands the connections to the relay to the daemon's HTTP
+// server as if it had accepted them
+type tunnelListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (l *tunnelListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *tunnelListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *tunnelListener) Addr() net.Addr {
+	return tunnelAddr{}
+}
+
+type tunnelAddr struct{}
+
+func (tunnelAddr) Network() string { return tunnelProtocol }
+func (tunnelAddr) String() string  { return tunnelProtocol }
+
+// tunnelConn reports when the HTTP server is done with a connection
+type tunnelConn struct {
+	net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (c *tunnelConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() { close(c.closed) })
+	return err
+}
+
+// bufferedConn reads through a buffer that may hold data already received
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// TunnelRelay is the cloud end of tunnels: an HTTP handler daemons connect
+// to, and a client sending requests to them through their tunnels:
+//
+//	relay := smarttv.NewTunnelRelay(smarttv.WithTunnelToken(token))
+//	http.Handle("/tunnel", relay)
+//	resp, err := relay.Client("home").Get("http://home/status")
+type TunnelRelay struct {
+	cfg tunnelConfig
+
+	mu      sync.Mutex
+	daemons map[string]*relayPool
+}
+
+// relayPool holds the connections of one daemon
+type relayPool struct {
+	conns map[*relayConn]bool // Open connections, idle or busy
+	idle  []*relayConn
+	wake  chan struct{} // Closed when connections come or go
+}
+
+// relayConn is a tunnel connection at the relay. While idle, a reader
+// watches it so connections the daemon drops are noticed.
+type relayConn struct {
+	conn  net.Conn
+	br    *bufio.Reader
+	watch chan error // Result of the idle watch
+}
+
+// NewTunnelRelay creates a relay. Daemons need the token of
+// WithTunnelToken, or pass WithTunnelAuth; a relay with neither refuses
+// them all.
+func NewTunnelRelay(opts ...TunnelOption) *TunnelRelay {
+	return &TunnelRelay{cfg: newTunnelConfig(opts), daemons: make(map[string]*relayPool)}
+}
+
+// ServeHTTP takes a tunnel from a daemon
+func (r *TunnelRelay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !strings.EqualFold(req.Header.Get("Upgrade"), tunnelProtocol) {
+		w.Header().Set("Upgrade", tunnelProtocol)
+		http.Error(w, "Upgrade required", http.StatusUpgradeRequired)
+		return
+	}
+	name := req.Header.Get("X-Tunnel-Name")
+	if name == "" {
+		http.Error(w, "Missing X-Tunnel-Name", http.StatusBadRequest)
+		return
+	}
+	token, _ := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !r.authorized(name, token) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Connection can't be taken over", http.StatusInternalServerError)
+		return
+	}
+	conn, bufrw, err := hj.Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	bufrw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: " + tunnelProtocol + "\r\nConnection: Upgrade\r\n\r\n")
+	if err := bufrw.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+
+	rc := &relayConn{conn: conn, br: bufrw.Reader}
+	r.mu.Lock()
+	pool := r.daemons[name]
+	if pool == nil {
+		pool = &relayPool{conns: make(map[*relayConn]bool), wake: make(chan struct{})}
+		r.daemons[name] = pool
+	}
+	pool.conns[rc] = true
+	r.mu.Unlock()
+	r.release(name, rc)
+}
+
+// authorized checks a daemon's token
+func (r *TunnelRelay) authorized(name, token string) bool {
+	if r.cfg.authorize != nil {
+		return r.cfg.authorize(name, token)
+	}
+	return r.cfg.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(r.cfg.token)) == 1
+}
+
+// Connected returns the names of the daemons with open tunnels
+func (r *TunnelRelay) Connected() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var names []string
+	for name := range r.daemons {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Close closes all tunnels
+func (r *TunnelRelay) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, pool := range r.daemons {
+		for rc := range pool.conns {
+			rc.conn.Close()
+		}
+		close(pool.wake)
+		delete(r.daemons, name)
+	}
+	return nil
+}
+
+// Client returns an HTTP client sending requests to the named daemon
+// through its tunnel. The host of request URLs doesn't matter, e.g.
+// "http://home/frames". Requests fail with ErrTunnelOffline while the
+// daemon isn't connected.
+func (r *TunnelRelay) Client(name string) *http.Client {
+	return &http.Client{Transport: &tunnelTransport{relay: r, name: name}}
+}
+
+// release makes a connection idle and watches it for the daemon going away
+func (r *TunnelRelay) release(name string, rc *relayConn) {
+	rc.watch = make(chan error, 1)
+	r.mu.Lock()
+	pool := r.daemons[name]
+	if pool == nil || !pool.conns[rc] {
+		r.mu.Unlock()
+		rc.conn.Close()
+		return
+	}
+	pool.idle = append(pool.idle, rc)
+	close(pool.wake)
+	pool.wake = make(chan struct{})
+	r.mu.Unlock()
+
+	go func() {
+		_, err := rc.br.Peek(1)
+		r.mu.Lock()
+		idle := slices.Contains(pool.idle, rc)
+		r.mu.Unlock()
+		if idle {
+			// Closed by the daemon, or it sent something unasked
+			r.drop(name, rc)
+			return
+		}
+		rc.watch <- err
+	}()
+}
+
+// drop closes a connection and forgets it
+func (r *TunnelRelay) drop(name string, rc *relayConn) {
+	rc.conn.Close()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pool := r.daemons[name]
+	if pool == nil || !pool.conns[rc] {
+		return
+	}
+	delete(pool.conns, rc)
+	if i := slices.Index(pool.idle, rc); i >= 0 {
+		pool.idle = slices.Delete(pool.idle, i, i+1)
+	}
+	close(pool.wake)
+	pool.wake = make(chan struct{})
+	if len(pool.conns) == 0 {
+		delete(r.daemons, name)
+	}
+}
+
+// take returns an idle connection to the daemon, waiting for one while
+// all are busy
+func (r *TunnelRelay) take(ctx context.Context, name string) (*relayConn, error) {
+	for {
+		r.mu.Lock()
+		pool := r.daemons[name]
+		if pool == nil {
+			r.mu.Unlock()
+			return nil, fmt.Errorf("%s: %w", name, ErrTunnelOffline)
+		}
+		if n := len(pool.idle); n > 0 {
+			rc := pool.idle[n-1]
+			pool.idle = pool.idle[:n-1]
+			r.mu.Unlock()
+
+			// Stop the watch; a deadline error means the connection is fine
+			rc.conn.SetReadDeadline(time.Now())
+			err := <-rc.watch
+			rc.conn.SetReadDeadline(time.Time{})
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return rc, nil
+			}
+			r.drop(name, rc)
+			continue
+		}
+		wake := pool.wake
+		r.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// tunnelTransport sends requests through a daemon's tunnel
+type tunnelTransport struct {
+	relay *TunnelRelay
+	name  string
+}
+
+func (t *tunnelTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rc, err := t.relay.take(req.Context(), t.name)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	stop := context.AfterFunc(req.Context(), func() { rc.conn.Close() })
+
+	// Write the request while reading the response: the daemon may answer
+	// before it has read the whole body, e.g. to refuse it
+	written := make(chan error, 1)
+	go func() {
+		written <- req.Write(rc.conn)
+	}()
+	resp, err := http.ReadResponse(rc.br, req)
+	if err != nil {
+		stop()
+		t.relay.drop(t.name, rc)
+		if req.Context().Err() != nil {
+			return nil, req.Context().Err()
+		}
+		return nil, fmt.Errorf("%s: %w", t.name, err)
+	}
+
+	body := &tunnelBody{ReadCloser: resp.Body}
+	body.finish = func(complete bool) {
+		reuse := stop() && complete && !resp.Close
+		select {
+		case err := <-written:
+			reuse = reuse && err == nil
+		default:
+			// Still sending a body the daemon didn't want
+			reuse = false
+		}
+		if reuse {
+			t.relay.release(t.name, rc)
+		} else {
+			t.relay.drop(t.name, rc)
+		}
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// tunnelBody hands the connection back once the response is read
+type tunnelBody struct {
+	io.ReadCloser
+	finish func(complete bool)
+	once   sync.Once
+}
+
+func (b *tunnelBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(func() { b.finish(true) })
+	}
+	return n, err
+}
+
+func (b *tunnelBody) Close() error {
+	// Closing early drops the connection rather than draining the rest
+	b.once.Do(func() { b.finish(false) })
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,214 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startTunnel connects a daemon serving handler to the relay and waits
+// until all its connections are up
+func startTunnel(t *testing.T, relayURL string, relay *TunnelRelay, handler http.Handler) context.CancelFunc {
+	t.Helper()
+	tunnel, err := NewTunnel(relayURL, handler, WithTunnelName("home"), WithTunnelToken("secret"), WithTunnelConns(2))
+	if err != nil {
+		t.Fatalf("NewTunnel failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- tunnel.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	waitFor(t, func() bool {
+		return tunnel.Connected() == 2 && slices.Contains(relay.Connected(), "home")
+	})
+	return cancel
+}
+
+// waitFor polls cond for up to two seconds
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTunnelRoundTrip(t *testing.T) {
+	relay := NewTunnelRelay(WithTunnelToken("secret"))
+	server := httptest.NewServer(relay)
+	defer server.Close()
+	defer relay.Close()
+
+	release := make(chan struct{})
+	startTunnel(t, server.URL, relay, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.URL.Path, body)
+	}))
+
+	client := relay.Client("home")
+	get := func(path string) (string, error) {
+		resp, err := client.Get("http://home" + path)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	// More requests than connections: the rest wait their turn
+	var wg sync.WaitGroup
+	for i := range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			path := fmt.Sprintf("/status/%d", i)
+			if got, err := get(path); err != nil || got != "GET "+path+" " {
+				t.Errorf("GET %s = %q, %v", path, got, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// A slow request holds one connection, the other one keeps serving
+	slow := make(chan string, 1)
+	go func() {
+		got, _ := get("/slow")
+		slow <- got
+	}()
+	time.Sleep(50 * time.Millisecond)
+	resp, err := client.Post("http://home/frames", "text/plain", strings.NewReader("data"))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "POST /frames data" {
+		t.Errorf("POST = %q", body)
+	}
+	close(release)
+	if got := <-slow; got != "GET /slow " {
+		t.Errorf("Slow GET = %q", got)
+	}
+
+	if _, err := relay.Client("office").Get("http://office/"); !errors.Is(err, ErrTunnelOffline) {
+		t.Errorf("Expected ErrTunnelOffline, got %v", err)
+	}
+}
+
+func TestTunnelReconnect(t *testing.T) {
+	relay := NewTunnelRelay(WithTunnelToken("secret"))
+	server := httptest.NewServer(relay)
+	defer server.Close()
+
+	startTunnel(t, server.URL, relay, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+
+	// The relay restarting drops the tunnels; the daemon dials again
+	relay.Close()
+	waitFor(t, func() bool {
+		return slices.Contains(relay.Connected(), "home")
+	})
+	resp, err := relay.Client("home").Get("http://home/")
+	if err != nil {
+		t.Fatalf("GET after reconnect failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestTunnelRejected(t *testing.T) {
+	relay := NewTunnelRelay(WithTunnelAuth(func(name, token string) bool {
+		return name == "home" && token == "secret"
+	}))
+	server := httptest.NewServer(relay)
+	defer server.Close()
+
+	tunnel, err := NewTunnel(server.URL, http.NotFoundHandler(), WithTunnelName("home"), WithTunnelToken("wrong"))
+	if err != nil {
+		t.Fatalf("NewTunnel failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tunnel.Run(ctx); !errors.Is(err, ErrTunnelRejected) {
+		t.Errorf("Expected ErrTunnelRejected, got %v", err)
+	}
+	if len(relay.Connected()) != 0 {
+		t.Errorf("Connected() = %v", relay.Connected())
+	}
+
+	// A relay without a token or WithTunnelAuth lets no one in
+	open := httptest.NewServer(NewTunnelRelay())
+	defer open.Close()
+	tunnel, err = NewTunnel(open.URL, http.NotFoundHandler(), WithTunnelName("home"))
+	if err != nil {
+		t.Fatalf("NewTunnel failed: %v", err)
+	}
+	if err := tunnel.Run(ctx); !errors.Is(err, ErrTunnelRejected) {
+		t.Errorf("Expected ErrTunnelRejected without a token, got %v", err)
+	}
+}
+
+func TestTunnelFramePush(t *testing.T) {
+	relay := NewTunnelRelay(WithTunnelToken("secret"))
+	server := httptest.NewServer(relay)
+	defer server.Close()
+	defer relay.Close()
+
+	receiver := NewFrameReceiver()
+	defer receiver.Close()
+	startTunnel(t, server.URL, relay, receiver)
+
+	// A producer in the cloud streams frames to the daemon through the relay
+	pusher := NewFramePusher("http://home/frames", WithUploadClient(relay.Client("home")))
+	frames := make(chan StreamFrame)
+	pushed := make(chan error, 1)
+	go func() {
+		pushed <- pusher.Push(context.Background(), frames)
+	}()
+	for i := range 3 {
+		frames <- StreamFrame{JPEG: []byte{byte(i)}}
+		if got := <-receiver.Frames(); got.Seq != uint64(i+1) {
+			t.Errorf("Received frame %d, want %d", got.Seq, i+1)
+		}
+	}
+	close(frames)
+	if err := <-pushed; err != nil {
+		t.Errorf("Push through tunnel failed: %v", err)
+	}
+}
+
+// TestTunnelInsecureRelay tests that plain http relays on other hosts are
+// refused unless allowed
+func TestTunnelInsecureRelay(t *testing.T) {
+	if _, err := NewTunnel("http://relay.example.com/tunnel", http.NotFoundHandler()); err == nil {
+		t.Error("Expected an error for a plain http relay")
+	}
+	for _, relayURL := range []string{"https://relay.example.com/tunnel", "http://localhost:8080/tunnel", "http://127.0.0.1:8080/tunnel"} {
+		if _, err := NewTunnel(relayURL, http.NotFoundHandler()); err != nil {
+			t.Errorf("NewTunnel(%s) failed: %v", relayURL, err)
+		}
+	}
+	if _, err := NewTunnel("http://relay.example.com/tunnel", http.NotFoundHandler(), WithInsecureRelay()); err != nil {
+		t.Errorf("NewTunnel with WithInsecureRelay failed: %v", err)
+	}
+}
@@ -6,21 +6,79 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
 // TV represents a discovered Smart TV
 type TV struct {
 	Name       string // Friendly name (e.g., "TV Salon")
+	Slug       string // Name for the command line (e.g., "tv-salon"), set by the Registry
 	IP         string // IP address
 	Port       int    // UPnP port
 	ControlURL string // Full AVTransport control endpoint URL
 	BaseURL    string // Base URL for the device
+
+	AVTransportType    string // Advertised service URN (e.g., "urn:schemas-upnp-org:service:AVTransport:2")
+	AVTransportVersion int    // AVTransport service version (1, 2, 3)
+
+	UDN        string   // Unique device name (e.g., "uuid:...")
+	SCPDURL    string   // Full AVTransport service description URL
+	Actions    []string // AVTransport actions from the SCPD (nil if not loaded)
+	PlaySpeeds []string // Allowed Play speeds from the SCPD (nil if not listed)
+	IconURL    string   // Full URL of the device's advertised icon (empty if none)
+
+	Manufacturer string // Device manufacturer (e.g. "Panasonic")
+	ModelName    string // Device model name
+
+	// Vendor remote control service offering X_SendKey (empty if none)
+	KeyControlURL  string
+	KeyServiceType string
+
+	// RenderingControl service for the volume (empty if none)
+	VolumeControlURL  string
+	VolumeServiceType string
+
+	// Screenshotter captures the screen for Screenshot (nil if unsupported)
+	Screenshotter Screenshotter `json:"-"`
+
+	// Remote sends keys and launches apps through a vendor API, e.g. the
+	// samsung and webos packages (nil = UPnP and Roku ECP only)
+	Remote RemoteControl `json:"-"`
+
+	// Quirks adjust the metadata for TVs that need it
+	Quirks Quirks
+
+	// Addresses lists every IP the TV answered discovery on (e.g. both its
+	// Wi-Fi and Ethernet address), fastest first. Commands fail over to the
+	// other addresses when IP is unreachable.
+	Addresses []string
+
+	// TimeZone is the IANA time zone where the TV hangs (e.g.
+	// "Europe/Berlin"), for schedules and clocks. Empty uses its zone's.
+	TimeZone string
+
+	// Protocol is how the TV is driven: ProtocolDLNA (empty),
+	// ProtocolCast for Google Cast devices, whose ControlURL is
+	// cast://host:port, or ProtocolAirPlay for AirPlay receivers, whose
+	// ControlURL is airplay://host:port
+	Protocol string
+
+	// descLatency is how long fetching the device description took
+	descLatency time.Duration
+
+	// lenientXML is set for TVs discovered with DiscoverOptions.LenientXML
+	lenientXML bool
 }
 
+// defaultAVTransportType is used for TVs whose service type is unknown
+const defaultAVTransportType = "urn:schemas-upnp-org:service:AVTransport:1"
+
 // deviceDescription represents the UPnP device description XML
 type deviceDescription struct {
 	XMLName     xml.Name `xml:"root"`
@@ -29,21 +87,24 @@ type deviceDescription struct {
 }
 
 type device struct {
+	UDN          string    `xml:"UDN"`
 	FriendlyName string    `xml:"friendlyName"`
 	Manufacturer string    `xml:"manufacturer"`
 	ModelName    string    `xml:"modelName"`
+	IconList     []icon    `xml:"iconList>icon"`
 	ServiceList  []service `xml:"serviceList>service"`
 }
 
 type service struct {
 	ServiceType string `xml:"serviceType"`
 	ControlURL  string `xml:"controlURL"`
+	SCPDURL     string `xml:"SCPDURL"`
 }
 
 // parseDeviceDescription parses the UPnP device description XML
-func parseDeviceDescription(r io.Reader, location string) (*TV, error) {
+func parseDeviceDescription(r io.Reader, location string, lenient bool) (*TV, error) {
 	var desc deviceDescription
-	if err := xml.NewDecoder(r).Decode(&desc); err != nil {
+	if err := decodeXML(r, &desc, lenient); err != nil {
 		return nil, fmt.Errorf("parse device description: %w", err)
 	}
 
@@ -60,12 +121,23 @@ func parseDeviceDescription(r io.Reader, location string) (*TV, error) {
 	}
 	baseURL = strings.TrimSuffix(baseURL, "/")
 
-	// Find AVTransport service
-	var controlURL string
+	// Find AVTransport service, and a vendor remote control service if any
+	var controlURL, scpdURL, serviceType string
+	var keyControlURL, keyServiceType string
+	var volumeControlURL, volumeServiceType string
 	for _, svc := range desc.Device.ServiceList {
-		if strings.Contains(svc.ServiceType, "AVTransport") {
-			controlURL = svc.ControlURL
-			break
+		if controlURL == "" && strings.Contains(svc.ServiceType, "AVTransport") {
+			controlURL = strings.TrimSpace(svc.ControlURL)
+			scpdURL = strings.TrimSpace(svc.SCPDURL)
+			serviceType = strings.TrimSpace(svc.ServiceType)
+		}
+		if keyControlURL == "" && strings.Contains(svc.ServiceType, "NetworkControl") {
+			keyControlURL = deviceURL(baseURL, svc.ControlURL)
+			keyServiceType = strings.TrimSpace(svc.ServiceType)
+		}
+		if volumeControlURL == "" && strings.Contains(svc.ServiceType, "RenderingControl") {
+			volumeControlURL = deviceURL(baseURL, svc.ControlURL)
+			volumeServiceType = strings.TrimSpace(svc.ServiceType)
 		}
 	}
 
@@ -73,12 +145,16 @@ func parseDeviceDescription(r io.Reader, location string) (*TV, error) {
 		return nil, fmt.Errorf("no AVTransport service found")
 	}
 
-	// Build full control URL
-	if !strings.HasPrefix(controlURL, "http") {
-		if !strings.HasPrefix(controlURL, "/") {
-			controlURL = "/" + controlURL
-		}
-		controlURL = baseURL + controlURL
+	// Build full control, SCPD and icon URLs
+	if controlURL = deviceURL(baseURL, controlURL); controlURL == "" {
+		return nil, fmt.Errorf("invalid AVTransport control URL")
+	}
+	if scpdURL != "" {
+		scpdURL = deviceURL(baseURL, scpdURL)
+	}
+	iconURL := pickIcon(desc.Device.IconList)
+	if iconURL != "" {
+		iconURL = deviceURL(baseURL, iconURL)
 	}
 
 	// Extract port from host
@@ -88,49 +164,128 @@ func parseDeviceDescription(r io.Reader, location string) (*TV, error) {
 	}
 
 	return &TV{
-		Name:       desc.Device.FriendlyName,
-		IP:         locURL.Hostname(),
-		Port:       port,
-		ControlURL: controlURL,
-		BaseURL:    baseURL,
+		Name:               cleanText(desc.Device.FriendlyName),
+		IP:                 locURL.Hostname(),
+		Port:               port,
+		ControlURL:         controlURL,
+		BaseURL:            baseURL,
+		AVTransportType:    serviceType,
+		AVTransportVersion: serviceVersion(serviceType),
+		UDN:                cleanText(desc.Device.UDN),
+		SCPDURL:            scpdURL,
+		IconURL:            iconURL,
+		Manufacturer:       cleanText(desc.Device.Manufacturer),
+		ModelName:          cleanText(desc.Device.ModelName),
+		Quirks:             QuirksFor(desc.Device.Manufacturer, desc.Device.ModelName),
+		KeyControlURL:      keyControlURL,
+		KeyServiceType:     keyServiceType,
+		VolumeControlURL:   volumeControlURL,
+		VolumeServiceType:  volumeServiceType,
+		Addresses:          []string{locURL.Hostname()},
 	}, nil
 }
 
+// ParseDeviceDescriptionBytes parses a UPnP device description fetched
+// earlier, e.g. saved to disk, into a TV. location is the URL the
+// description was fetched from; relative service URLs are resolved against
+// it. The TV's action list is not loaded.
+func ParseDeviceDescriptionBytes(data []byte, location string) (*TV, error) {
+	return parseDeviceDescription(bytes.NewReader(data), location, false)
+}
+
+// resolveURL makes a URL from the device description absolute
+func resolveURL(baseURL, ref string) string {
+	if strings.HasPrefix(ref, "http") {
+		return ref
+	}
+	if !strings.HasPrefix(ref, "/") {
+		ref = "/" + ref
+	}
+	return baseURL + ref
+}
+
+// deviceURL resolves a URL of the device description, returning "" unless
+// the result is an absolute http or https URL
+func deviceURL(baseURL, ref string) string {
+	resolved := resolveURL(baseURL, strings.TrimSpace(ref))
+	if !isHTTPURL(resolved) {
+		return ""
+	}
+	return resolved
+}
+
+// isHTTPURL reports whether s is an absolute http or https URL
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// cleanText trims a name from a device description and drops control
+// characters, which would garble logs and terminals
+func cleanText(s string) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s))
+}
+
+// serviceVersion extracts the trailing version from a service URN
+// ("urn:schemas-upnp-org:service:AVTransport:2" -> 2), defaulting to 1
+func serviceVersion(serviceType string) int {
+	i := strings.LastIndex(serviceType, ":")
+	if i < 0 {
+		return 1
+	}
+	v, err := strconv.Atoi(serviceType[i+1:])
+	if err != nil || v < 1 {
+		return 1
+	}
+	return v
+}
+
+// avTransportType returns the service URN to use in SOAP requests
+func (tv *TV) avTransportType() string {
+	if tv.AVTransportType == "" {
+		return defaultAVTransportType
+	}
+	return tv.AVTransportType
+}
+
+// SupportsAVTransportVersion reports whether the TV's AVTransport service
+// is at least the given version. TVs with an unknown version count as 1.
+func (tv *TV) SupportsAVTransportVersion(v int) bool {
+	return max(tv.AVTransportVersion, 1) >= v
+}
+
 // setAVTransportURI sends the SetAVTransportURI SOAP action to the TV
-func (tv *TV) setAVTransportURI(ctx context.Context, uri string) error {
+func (tv *TV) setAVTransportURI(ctx context.Context, uri string, res imageRes) error {
 	// Build DIDL-Lite metadata for image
-	metadata := fmt.Sprintf(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/"><item id="1" parentID="0" restricted="1"><dc:title>Image</dc:title><upnp:class>object.item.imageItem.photo</upnp:class><res protocolInfo="http-get:*:image/jpeg:*">%s</res></item></DIDL-Lite>`, uri)
+	return tv.setAVTransportURIMetadata(ctx, uri, tv.imageMetadata(uri, res))
+}
 
+// setAVTransportURIMetadata sends SetAVTransportURI with the given DIDL-Lite
+// metadata
+func (tv *TV) setAVTransportURIMetadata(ctx context.Context, uri string, metadata string) error {
 	// Escape for XML
 	metadata = escapeXML(metadata)
 
-	soap := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
-<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
-  <s:Body>
-    <u:SetAVTransportURI xmlns:u="urn:schemas-upnp-org:service:AVTransport:1">
+	args := fmt.Sprintf(`
       <InstanceID>0</InstanceID>
       <CurrentURI>%s</CurrentURI>
-      <CurrentURIMetaData>%s</CurrentURIMetaData>
-    </u:SetAVTransportURI>
-  </s:Body>
-</s:Envelope>`, uri, metadata)
+      <CurrentURIMetaData>%s</CurrentURIMetaData>`, escapeXML(uri), metadata)
 
-	return tv.sendSOAP(ctx, "SetAVTransportURI", soap)
+	return tv.sendSOAP(ctx, "SetAVTransportURI", tv.soapEnvelope("SetAVTransportURI", args))
 }
 
 // play sends the Play SOAP action to the TV
 func (tv *TV) play(ctx context.Context) error {
-	soap := `<?xml version="1.0" encoding="utf-8"?>
-<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
-  <s:Body>
-    <u:Play xmlns:u="urn:schemas-upnp-org:service:AVTransport:1">
+	args := `
       <InstanceID>0</InstanceID>
-      <Speed>1</Speed>
-    </u:Play>
-  </s:Body>
-</s:Envelope>`
+      <Speed>1</Speed>`
 
-	return tv.sendSOAP(ctx, "Play", soap)
+	return tv.sendSOAP(ctx, "Play", tv.soapEnvelope("Play", args))
 }
 
 // setAVTransportURIForVideo sends the SetAVTransportURI SOAP action for video/HLS streams
@@ -150,83 +305,127 @@ func (tv *TV) setAVTransportURIForVideo(ctx context.Context, uri string, title s
 	// Escape for XML
 	metadata = escapeXML(metadata)
 
-	soap := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
-<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
-  <s:Body>
-    <u:SetAVTransportURI xmlns:u="urn:schemas-upnp-org:service:AVTransport:1">
+	args := fmt.Sprintf(`
       <InstanceID>0</InstanceID>
       <CurrentURI>%s</CurrentURI>
-      <CurrentURIMetaData>%s</CurrentURIMetaData>
-    </u:SetAVTransportURI>
-  </s:Body>
-</s:Envelope>`, uri, metadata)
+      <CurrentURIMetaData>%s</CurrentURIMetaData>`, uri, metadata)
 
-	return tv.sendSOAP(ctx, "SetAVTransportURI", soap)
+	return tv.sendSOAP(ctx, "SetAVTransportURI", tv.soapEnvelope("SetAVTransportURI", args))
 }
 
 // stop sends the Stop SOAP action to the TV
 func (tv *TV) stop(ctx context.Context) error {
-	soap := `<?xml version="1.0" encoding="utf-8"?>
-<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
-  <s:Body>
-    <u:Stop xmlns:u="urn:schemas-upnp-org:service:AVTransport:1">
-      <InstanceID>0</InstanceID>
-    </u:Stop>
-  </s:Body>
-</s:Envelope>`
+	args := `
+      <InstanceID>0</InstanceID>`
 
-	return tv.sendSOAP(ctx, "Stop", soap)
+	return tv.sendSOAP(ctx, "Stop", tv.soapEnvelope("Stop", args))
 }
 
 // setNextAVTransportURI sets the next content to play (for gapless transitions)
-func (tv *TV) setNextAVTransportURI(ctx context.Context, uri string) error {
-	metadata := fmt.Sprintf(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/"><item id="1" parentID="0" restricted="1"><dc:title>Image</dc:title><upnp:class>object.item.imageItem.photo</upnp:class><res protocolInfo="http-get:*:image/jpeg:*">%s</res></item></DIDL-Lite>`, uri)
+func (tv *TV) setNextAVTransportURI(ctx context.Context, uri string, res imageRes) error {
+	return tv.setNextAVTransportURIMetadata(ctx, uri, tv.imageMetadata(uri, res))
+}
+
+// setNextAVTransportURIMetadata sends SetNextAVTransportURI with the given
+// DIDL-Lite metadata
+func (tv *TV) setNextAVTransportURIMetadata(ctx context.Context, uri string, metadata string) error {
 	metadata = escapeXML(metadata)
 
-	soap := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
-<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
-  <s:Body>
-    <u:SetNextAVTransportURI xmlns:u="urn:schemas-upnp-org:service:AVTransport:1">
+	args := fmt.Sprintf(`
       <InstanceID>0</InstanceID>
       <NextURI>%s</NextURI>
-      <NextURIMetaData>%s</NextURIMetaData>
-    </u:SetNextAVTransportURI>
-  </s:Body>
-</s:Envelope>`, uri, metadata)
+      <NextURIMetaData>%s</NextURIMetaData>`, uri, metadata)
+
+	return tv.sendSOAP(ctx, "SetNextAVTransportURI", tv.soapEnvelope("SetNextAVTransportURI", args))
+}
 
-	return tv.sendSOAP(ctx, "SetNextAVTransportURI", soap)
+// soapEnvelope wraps action arguments in a SOAP envelope addressed to the
+// TV's AVTransport service
+func (tv *TV) soapEnvelope(action string, args string) string {
+	return serviceEnvelope(tv.avTransportType(), action, args)
+}
+
+// serviceEnvelope wraps action arguments in a SOAP envelope for a service
+func serviceEnvelope(serviceType string, action string, args string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+  <s:Body>
+    <u:%s xmlns:u="%s">%s
+    </u:%s>
+  </s:Body>
+</s:Envelope>`, action, serviceType, args, action)
 }
 
 // sendSOAP sends a SOAP request to the TV's AVTransport control endpoint
 func (tv *TV) sendSOAP(ctx context.Context, action string, body string) error {
-	req, err := http.NewRequestWithContext(ctx, "POST", tv.ControlURL, bytes.NewBufferString(body))
-	if err != nil {
-		return fmt.Errorf("create request: %w", err)
+	if !tv.SupportsAction(action) {
+		return tv.wrapError(action, tv.ControlURL, ErrUnsupportedAction)
 	}
 
-	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
-	req.Header.Set("SOAPAction", fmt.Sprintf(`"urn:schemas-upnp-org:service:AVTransport:1#%s"`, action))
+	_, err := tv.sendServiceSOAP(ctx, tv.ControlURL, tv.avTransportType(), action, body)
+	return err
+}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+// sendServiceSOAP sends a SOAP request to any of the TV's service endpoints
+// and returns the action's output arguments. Failures are returned as
+// *TVError; those reported by the TV wrap a *SOAPError.
+func (tv *TV) sendServiceSOAP(ctx context.Context, controlURL string, serviceType string, action string, body string) (out map[string]string, err error) {
+	ctx, span := startSpan(ctx, "smarttv.soap "+action, append(tv.traceAttributes(), Attribute{Key: "url.full", Value: controlURL})...)
+	defer func() { endSpan(span, err) }()
+
+	resp, err := postSOAP(ctx, controlURL, serviceType, action, body)
 	if err != nil {
-		return fmt.Errorf("send SOAP request: %w", err)
+		// The TV may still be reachable on another interface
+		for _, alt := range tv.alternateURLs(controlURL) {
+			if resp, err = postSOAP(ctx, alt, serviceType, action, body); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return nil, tv.wrapError(action, controlURL, fmt.Errorf("send SOAP request: %w", err))
+		}
 	}
 	defer resp.Body.Close()
 
-	// Read response body for error checking
-	respBody, _ := io.ReadAll(resp.Body)
+	out, err = readSOAPResponse(action, resp.StatusCode, resp.Body)
+	return out, tv.wrapError(action, controlURL, err)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("SOAP error: HTTP %d: %s", resp.StatusCode, string(respBody))
+// postSOAP posts a SOAP envelope to a control URL
+func postSOAP(ctx context.Context, controlURL string, serviceType string, action string, body string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", controlURL, bytes.NewBufferString(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
 	}
 
-	// Check for UPnP error in response
-	if bytes.Contains(respBody, []byte("<UPnPError")) {
-		return fmt.Errorf("UPnP error: %s", string(respBody))
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	req.Header.Set("SOAPAction", fmt.Sprintf(`"%s#%s"`, serviceType, action))
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	return client.Do(req)
+}
+
+// alternateURLs returns rawURL rewritten to each of the TV's other addresses
+func (tv *TV) alternateURLs(rawURL string) []string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
 	}
 
-	return nil
+	var alts []string
+	for _, addr := range tv.Addresses {
+		if addr == u.Hostname() {
+			continue
+		}
+		alt := *u
+		if port := u.Port(); port != "" {
+			alt.Host = net.JoinHostPort(addr, port)
+		} else {
+			alt.Host = addr
+		}
+		alts = append(alts, alt.String())
+	}
+	return alts
 }
 
 // escapeXML escapes special characters for XML
@@ -0,0 +1,143 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <friendlyName>TV Salon</friendlyName>
+    <manufacturer>JVC</manufacturer>
+    <modelName>VIDAA</modelName>
+    <iconList>
+      <icon>
+        <mimetype>image/png</mimetype>
+        <width>120</width>
+        <height>120</height>
+        <depth>24</depth>
+        <url>/icons/tv120.png</url>
+      </icon>
+    </iconList>
+    <serviceList>
+      <service>
+        <serviceType>urn:schemas-upnp-org:service:RenderingControl:1</serviceType>
+        <controlURL>/upnp/control/RenderingControl</controlURL>
+      </service>
+      <service>
+        <serviceType>urn:schemas-upnp-org:service:AVTransport:2</serviceType>
+        <controlURL>upnp/control/AVTransport</controlURL>
+      </service>
+    </serviceList>
+  </device>
+</root>`
+
+// TestParseDeviceDescription tests extraction of the AVTransport endpoint and version
+func TestParseDeviceDescription(t *testing.T) {
+	tv, err := parseDeviceDescription(strings.NewReader(testDescription), "http://192.168.1.20:9197/dmr", false)
+	if err != nil {
+		t.Fatalf("parseDeviceDescription failed: %v", err)
+	}
+
+	if tv.Name != "TV Salon" {
+		t.Errorf("Expected name 'TV Salon', got %q", tv.Name)
+	}
+	if tv.IP != "192.168.1.20" || tv.Port != 9197 {
+		t.Errorf("Expected 192.168.1.20:9197, got %s:%d", tv.IP, tv.Port)
+	}
+	if tv.ControlURL != "http://192.168.1.20:9197/upnp/control/AVTransport" {
+		t.Errorf("Unexpected control URL: %s", tv.ControlURL)
+	}
+	if tv.AVTransportVersion != 2 {
+		t.Errorf("Expected AVTransport version 2, got %d", tv.AVTransportVersion)
+	}
+	if tv.IconURL != "http://192.168.1.20:9197/icons/tv120.png" {
+		t.Errorf("Unexpected icon URL: %s", tv.IconURL)
+	}
+	if tv.VolumeControlURL != "http://192.168.1.20:9197/upnp/control/RenderingControl" {
+		t.Errorf("Unexpected volume control URL: %s", tv.VolumeControlURL)
+	}
+}
+
+// TestSOAPActionUsesServiceType tests that the advertised service URN is used in requests
+func TestSOAPActionUsesServiceType(t *testing.T) {
+	var receivedAction string
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedAction = r.Header.Get("SOAPAction")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	tv := &TV{
+		Name:            "Test TV",
+		ControlURL:      mockTV.URL,
+		AVTransportType: "urn:schemas-upnp-org:service:AVTransport:3",
+	}
+
+	if err := tv.stop(context.Background()); err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+
+	expected := `"urn:schemas-upnp-org:service:AVTransport:3#Stop"`
+	if receivedAction != expected {
+		t.Errorf("Expected SOAPAction %s, got %s", expected, receivedAction)
+	}
+}
+
+// TestSCPDWithoutActions tests that a service description listing no
+// actions doesn't make every action count as unsupported
+func TestSCPDWithoutActions(t *testing.T) {
+	for _, desc := range []string{
+		`<scpd xmlns="urn:schemas-upnp-org:service-1-0"><actionList></actionList></scpd>`,
+		`<scpd xmlns="urn:schemas-upnp-org:service-1-0"><serviceStateTable/></scpd>`,
+	} {
+		actions, err := parseSCPD(strings.NewReader(desc))
+		if err != nil {
+			t.Fatalf("parseSCPD failed: %v", err)
+		}
+		tv := &TV{Name: "Test TV", Actions: actions}
+		if actions != nil || !tv.SupportsAction("Stop") {
+			t.Errorf("%s: actions = %#v, want nil", desc, actions)
+		}
+	}
+}
+
+// TestUnsupportedActionSkipped tests that actions missing from the SCPD are not sent
+func TestUnsupportedActionSkipped(t *testing.T) {
+	actions, err := parseSCPD(strings.NewReader(`<?xml version="1.0"?>
+<scpd xmlns="urn:schemas-upnp-org:service-1-0">
+  <actionList>
+    <action><name>SetAVTransportURI</name></action>
+    <action><name>Play</name></action>
+  </actionList>
+</scpd>`))
+	if err != nil {
+		t.Fatalf("parseSCPD failed: %v", err)
+	}
+
+	requests := 0
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL, Actions: actions}
+
+	err = tv.stop(context.Background())
+	if !errors.Is(err, ErrUnsupportedAction) {
+		t.Errorf("Expected ErrUnsupportedAction, got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("Expected no request for unsupported action, got %d", requests)
+	}
+
+	if err := tv.play(context.Background()); err != nil {
+		t.Errorf("play failed: %v", err)
+	}
+}
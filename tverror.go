@@ -0,0 +1,47 @@
+package nimsforestsmarttv
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TVError is a failure of a TV to do what it was asked: a SOAP action it
+// rejected or didn't answer, a remote key, a screenshot, a busy TV or one
+// that didn't start playing. Errors returned by TV and Renderer methods
+// that talk to a TV carry one, so applications driving many TVs can log
+// and group failures with errors.As. errors.Is still finds the cause,
+// e.g. ErrUnsupportedAction or ErrTVBusy.
+type TVError struct {
+	TV       string // Friendly name
+	UDN      string
+	Action   string // e.g. "SetAVTransportURI", "keypress"
+	Endpoint string // URL the request went to (empty if none was sent)
+	Err      error
+}
+
+func (e *TVError) Error() string {
+	name := e.TV
+	if name == "" {
+		name = e.Endpoint
+	}
+	msg := e.Err.Error()
+	if e.Action != "" && !strings.HasPrefix(msg, e.Action+":") {
+		msg = e.Action + ": " + msg
+	}
+	return fmt.Sprintf("%s: %s", name, msg)
+}
+
+func (e *TVError) Unwrap() error {
+	return e.Err
+}
+
+// wrapError attaches the TV, action and endpoint to err. Errors that
+// already carry a TVError are returned as they are.
+func (tv *TV) wrapError(action string, endpoint string, err error) error {
+	var tvErr *TVError
+	if err == nil || errors.As(err, &tvErr) {
+		return err
+	}
+	return &TVError{TV: tv.Name, UDN: tv.UDN, Action: action, Endpoint: endpoint, Err: err}
+}
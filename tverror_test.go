@@ -0,0 +1,49 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTVError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(soapFault(701, "Transition not available")))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	tv := &TV{Name: "Salon", UDN: "uuid:salon", ControlURL: server.URL + "/avt"}
+
+	err := tv.stop(ctx)
+	var tvErr *TVError
+	if !errors.As(err, &tvErr) {
+		t.Fatalf("Expected a TVError, got %v", err)
+	}
+	if tvErr.TV != "Salon" || tvErr.UDN != "uuid:salon" || tvErr.Action != "Stop" || tvErr.Endpoint != tv.ControlURL {
+		t.Errorf("Unexpected TVError: %+v", tvErr)
+	}
+	if !IsUPnPError(err, 701) || strings.Count(err.Error(), "Stop") != 1 || !strings.HasPrefix(err.Error(), "Salon: ") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// Fanned out errors name the TV once
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+	err = renderer.StopAll(ctx, []*TV{tv})
+	if !errors.As(err, &tvErr) || strings.Count(err.Error(), "Salon") != 1 {
+		t.Errorf("Unexpected fan-out error: %v", err)
+	}
+
+	tv.Actions = []string{"Play"}
+	if err := tv.stop(ctx); !errors.Is(err, ErrUnsupportedAction) || !errors.As(err, &tvErr) || tvErr.Action != "Stop" {
+		t.Errorf("Expected an unsupported action TVError, got %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrTVBusy is returned with BusyFail when another command to the TV is
+// still running
+var ErrTVBusy = errors.New("TV is busy with another command")
+
+// BusyPolicy decides what a command does when the TV is still busy with
+// another one
+type BusyPolicy int
+
+const (
+	// BusyQueue waits for the commands before it, in the order they were
+	// issued (default)
+	BusyQueue BusyPolicy = iota
+
+	// BusyFail returns ErrTVBusy at once
+	BusyFail
+)
+
+// WithBusyPolicy sets what display calls do while another call to the same
+// TV is in progress. Either way, SetURI/Play sequences to one TV never
+// interleave.
+func WithBusyPolicy(policy BusyPolicy) Option {
+	return func(r *Renderer) {
+		r.busy = policy
+	}
+}
+
+// tvQueue is a lock that is handed to waiters in arrival order
+type tvQueue struct {
+	mu      sync.Mutex
+	held    bool
+	waiters []chan struct{}
+}
+
+// lock takes the queue, waiting for earlier holders unless failFast is set
+func (q *tvQueue) lock(ctx context.Context, failFast bool) error {
+	q.mu.Lock()
+	if !q.held {
+		q.held = true
+		q.mu.Unlock()
+		return nil
+	}
+	if failFast {
+		q.mu.Unlock()
+		return ErrTVBusy
+	}
+	turn := make(chan struct{})
+	q.waiters = append(q.waiters, turn)
+	q.mu.Unlock()
+
+	select {
+	case <-turn:
+		return nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		if i := slices.Index(q.waiters, turn); i >= 0 {
+			q.waiters = slices.Delete(q.waiters, i, i+1)
+			q.mu.Unlock()
+			return ctx.Err()
+		}
+		q.mu.Unlock()
+
+		// Our turn came as we gave up; pass it on
+		q.unlock()
+		return ctx.Err()
+	}
+}
+
+// unlock hands the queue to the next waiter
+func (q *tvQueue) unlock() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.waiters) == 0 {
+		q.held = false
+		return
+	}
+	next := q.waiters[0]
+	q.waiters = q.waiters[1:]
+	close(next)
+}
+
+// queued returns the number of commands waiting
+func (q *tvQueue) queued() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.waiters)
+}
+
+// tvHold marks the TVs a context holds through Renderer.Hold
+type tvHold struct {
+	renderer *Renderer
+	keys     map[string]bool
+	parent   *tvHold     // Hold of the context this one was made from (nil = none)
+	released atomic.Bool // Set by release: the TVs aren't held anymore
+}
+
+// tvHoldKey is the context key for a tvHold
+type tvHoldKey struct{}
+
+// holds reports whether ctx holds the TV through a Hold not yet released
+func (r *Renderer) holds(ctx context.Context, tv *TV) bool {
+	hold, _ := ctx.Value(tvHoldKey{}).(*tvHold)
+	for ; hold != nil; hold = hold.parent {
+		if hold.renderer == r && hold.keys[tv.ControlURL] && !hold.released.Load() {
+			return true
+		}
+	}
+	return false
+}
+
+// queueFor returns the TV's command queue
+func (r *Renderer) queueFor(tv *TV) *tvQueue {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	q, ok := r.tvLocks[tv.ControlURL]
+	if !ok {
+		q = &tvQueue{}
+		r.tvLocks[tv.ControlURL] = q
+	}
+	return q
+}
+
+// lockTV serializes commands to a single TV and returns the unlock function.
+// Calls with a context holding the TV through Hold pass straight through.
+func (r *Renderer) lockTV(ctx context.Context, tv *TV) (func(), error) {
+	if r.holds(ctx, tv) {
+		return func() {}, nil
+	}
+	q := r.queueFor(tv)
+	if err := q.lock(ctx, r.busy == BusyFail); err != nil {
+		if errors.Is(err, ErrTVBusy) {
+			err = tv.wrapError("lock", "", err)
+		}
+		return nil, err
+	}
+	return q.unlock, nil
+}
+
+// lockTVs locks several TVs in a stable order and returns the unlock function
+func (r *Renderer) lockTVs(ctx context.Context, tvs []*TV) (func(), error) {
+	keys := make([]string, 0, len(tvs))
+	byKey := make(map[string]*TV, len(tvs))
+	for _, tv := range tvs {
+		if _, ok := byKey[tv.ControlURL]; !ok {
+			keys = append(keys, tv.ControlURL)
+			byKey[tv.ControlURL] = tv
+		}
+	}
+	sort.Strings(keys)
+
+	unlocks := make([]func(), 0, len(keys))
+	unlockAll := func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+	for _, key := range keys {
+		unlock, err := r.lockTV(ctx, byKey[key])
+		if err != nil {
+			unlockAll()
+			return nil, err
+		}
+		unlocks = append(unlocks, unlock)
+	}
+	return unlockAll, nil
+}
+
+// Hold reserves TVs for a sequence of calls: display calls made with the
+// returned context run right away, while calls with other contexts queue
+// (or fail with BusyFail) until release is called.
+//
+//	ctx, release, err := renderer.Hold(ctx, tv)
+//	defer release()
+//	renderer.DisplayImage(ctx, tv, first)
+//	renderer.DisplayImage(ctx, tv, second)
+func (r *Renderer) Hold(ctx context.Context, tvs ...*TV) (context.Context, func(), error) {
+	unlock, err := r.lockTVs(ctx, tvs)
+	if err != nil {
+		return ctx, nil, err
+	}
+
+	hold := &tvHold{renderer: r, keys: make(map[string]bool, len(tvs))}
+	hold.parent, _ = ctx.Value(tvHoldKey{}).(*tvHold)
+	for _, tv := range tvs {
+		hold.keys[tv.ControlURL] = true
+	}
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			// Calls still made with the context must queue from now on
+			hold.released.Store(true)
+			unlock()
+		})
+	}
+	return context.WithValue(ctx, tvHoldKey{}, hold), release, nil
+}
+
+// Queued returns the number of display calls waiting for the TV
+func (r *Renderer) Queued(tv *TV) int {
+	return r.queueFor(tv).queued()
+}
@@ -0,0 +1,178 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestTVQueueOrder tests that waiters get the TV in the order they came
+func TestTVQueueOrder(t *testing.T) {
+	ctx := context.Background()
+	q := &tvQueue{}
+	if err := q.lock(ctx, false); err != nil {
+		t.Fatalf("lock failed: %v", err)
+	}
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := q.lock(ctx, false); err != nil {
+				t.Errorf("lock failed: %v", err)
+				return
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			q.unlock()
+		}()
+		for q.queued() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// A waiter that gives up leaves the queue
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := q.lock(cancelled, false); !errors.Is(err, context.Canceled) || q.queued() != 5 {
+		t.Errorf("Expected a cancelled waiter to leave, got %v with %d queued", err, q.queued())
+	}
+
+	q.unlock()
+	wg.Wait()
+	for i, got := range order {
+		if got != i {
+			t.Fatalf("Expected first-come first-served, got %v", order)
+		}
+	}
+	if q.held {
+		t.Error("Expected the queue to be free")
+	}
+}
+
+// TestHoldAndBusyFail tests that a held TV serves only the holding context
+// and others fail fast with BusyFail
+func TestHoldAndBusyFail(t *testing.T) {
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	renderer, err := NewRenderer(WithBusyPolicy(BusyFail))
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+
+	held, release, err := renderer.Hold(context.Background(), tv)
+	if err != nil {
+		t.Fatalf("Hold failed: %v", err)
+	}
+	if err := renderer.DisplayImage(held, tv, img); err != nil {
+		t.Errorf("Expected the holder to display, got %v", err)
+	}
+	if err := renderer.DisplayImage(context.Background(), tv, img); !errors.Is(err, ErrTVBusy) {
+		t.Errorf("Expected ErrTVBusy, got %v", err)
+	}
+
+	release()
+	release() // Releasing twice is harmless
+	if err := renderer.DisplayImage(context.Background(), tv, img); err != nil {
+		t.Errorf("Expected display after release, got %v", err)
+	}
+}
+
+// TestHoldAfterRelease tests that a released context no longer skips the
+// queue, even when it is reused
+func TestHoldAfterRelease(t *testing.T) {
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	renderer, err := NewRenderer(WithBusyPolicy(BusyFail))
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+
+	held, release, err := renderer.Hold(context.Background(), tv)
+	if err != nil {
+		t.Fatalf("Hold failed: %v", err)
+	}
+	release()
+
+	_, releaseOther, err := renderer.Hold(context.Background(), tv)
+	if err != nil {
+		t.Fatalf("Second Hold failed: %v", err)
+	}
+	defer releaseOther()
+	if err := renderer.DisplayImage(held, tv, img); !errors.Is(err, ErrTVBusy) {
+		t.Errorf("Expected ErrTVBusy with the released context, got %v", err)
+	}
+}
+
+// TestStopDuringDisplay tests that a Stop issued while an image is being
+// displayed waits for its Play instead of cutting in before it
+func TestStopDuringDisplay(t *testing.T) {
+	var mu sync.Mutex
+	var actions []string
+	loading := make(chan struct{})
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action := r.Header.Get("SOAPAction")
+		action = action[strings.LastIndex(action, "#")+1:]
+		action = strings.Trim(action, `"`)
+		mu.Lock()
+		actions = append(actions, action)
+		mu.Unlock()
+		if action == "SetAVTransportURI" {
+			close(loading)
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+	done := make(chan error, 1)
+	go func() {
+		done <- renderer.DisplayImage(context.Background(), tv, image.NewRGBA(image.Rect(0, 0, 8, 8)))
+	}()
+	<-loading
+	if err := renderer.Stop(context.Background(), tv); err != nil {
+		t.Errorf("Stop failed: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("DisplayImage failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	play, stop := slices.Index(actions, "Play"), slices.Index(actions, "Stop")
+	if play < 0 || stop < play {
+		t.Errorf("TV got %v, want Stop after Play", actions)
+	}
+}
@@ -0,0 +1,223 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrURLNotAllowed is returned for URLs a URLPolicy refuses
+var ErrURLNotAllowed = errors.New("URL not allowed")
+
+// URLPolicy restricts the URLs the renderer fetches, proxies or hands to
+// TVs on behalf of callers, so a service accepting URLs from clients can't
+// be used to reach hosts it shouldn't. Addresses are checked again when
+// connecting, so a host name resolving differently later (DNS rebinding)
+// doesn't get through either.
+type URLPolicy struct {
+	// Schemes lists the allowed URL schemes (default http and https)
+	Schemes []string
+
+	// Allow lists host names ("media.example.com", "*.example.com"), IPs
+	// and CIDRs ("192.168.1.0/24"). When set, other hosts are refused.
+	// Addresses in an allowed CIDR pass BlockPrivate.
+	Allow []string
+
+	// Deny lists host names, IPs and CIDRs that are always refused
+	Deny []string
+
+	// BlockPrivate refuses loopback, private, link-local, unspecified and
+	// multicast addresses, e.g. the cloud metadata service at
+	// 169.254.169.254 or the admin page of the router
+	BlockPrivate bool
+}
+
+// WithURLPolicy checks the URLs given to DisplayImageURL, StreamVideo,
+// Proxy and the other calls taking media URLs against p. URLs of the
+// renderer's own server are always allowed.
+func WithURLPolicy(p URLPolicy) Option {
+	return func(r *Renderer) {
+		r.urlPolicy = &p
+		r.serverOpts = append(r.serverOpts, WithServerURLPolicy(p))
+	}
+}
+
+// WithServerURLPolicy checks the sources of Proxy and RecordLive against p
+func WithServerURLPolicy(p URLPolicy) ServerOption {
+	return func(s *ImageServer) {
+		s.urlPolicy = &p
+	}
+}
+
+// Check reports whether rawURL is allowed, resolving its host to check the
+// addresses it points to. Refused URLs return an error wrapping
+// ErrURLNotAllowed.
+func (p *URLPolicy) Check(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrURLNotAllowed, err)
+	}
+	if err := p.checkName(u); err != nil {
+		return err
+	}
+
+	host := u.Hostname()
+	allowedName := matchHost(p.Allow, strings.ToLower(host))
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return p.checkAddr(addr, host, allowedName)
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if err := p.checkAddr(addr, host, allowedName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkName checks the scheme and host name of u, without resolving it
+func (p *URLPolicy) checkName(u *url.URL) error {
+	schemes := p.Schemes
+	if len(schemes) == 0 {
+		schemes = []string{"http", "https"}
+	}
+	if !slices.Contains(schemes, strings.ToLower(u.Scheme)) {
+		return fmt.Errorf("%w: scheme %q", ErrURLNotAllowed, u.Scheme)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return fmt.Errorf("%w: no host", ErrURLNotAllowed)
+	}
+	if matchHost(p.Deny, host) {
+		return fmt.Errorf("%w: host %s is denied", ErrURLNotAllowed, host)
+	}
+	return nil
+}
+
+// checkAddr checks an address host resolved to; allowedName is whether
+// the host name is on the allow list
+func (p *URLPolicy) checkAddr(addr netip.Addr, host string, allowedName bool) error {
+	addr = addr.Unmap()
+	if matchAddr(p.Deny, addr) {
+		return fmt.Errorf("%w: %s is denied", ErrURLNotAllowed, addr)
+	}
+	inAllowed := matchAddr(p.Allow, addr)
+	if len(p.Allow) > 0 && !inAllowed && !allowedName {
+		return fmt.Errorf("%w: host %s is not allowed", ErrURLNotAllowed, host)
+	}
+	if p.BlockPrivate && !inAllowed && isPrivateAddr(addr) {
+		return fmt.Errorf("%w: %s is a private address", ErrURLNotAllowed, addr)
+	}
+	return nil
+}
+
+// isPrivateAddr reports whether addr is not a public unicast address
+func isPrivateAddr(addr netip.Addr) bool {
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() ||
+		cgnat.Contains(addr)
+}
+
+// cgnat is the shared address space of carrier-grade NAT
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+// matchHost reports whether host matches a name in rules; "*.example.com"
+// matches the subdomains of example.com
+func matchHost(rules []string, host string) bool {
+	for _, rule := range rules {
+		rule = strings.ToLower(rule)
+		if suffix, ok := strings.CutPrefix(rule, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if rule == host {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAddr reports whether addr is one of the IPs or in one of the CIDRs
+// of rules
+func matchAddr(rules []string, addr netip.Addr) bool {
+	for _, rule := range rules {
+		if prefix, err := netip.ParsePrefix(rule); err == nil {
+			if prefix.Contains(addr) {
+				return true
+			}
+		} else if ip, err := netip.ParseAddr(rule); err == nil && ip.Unmap() == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// client returns a copy of base whose requests, including redirects, are
+// checked against the policy, with addresses checked again on connecting
+func (p *URLPolicy) client(base *http.Client) *http.Client {
+	client := *base
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok || transport == nil {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	transport = transport.Clone()
+	// The policy must see the real destination, not a proxy
+	transport.Proxy = nil
+	transport.DialContext = p.dialContext
+	client.Transport = policyTransport{policy: p, base: transport}
+	return &client
+}
+
+// dialContext connects like net.Dialer, checking each address it resolved
+// right before connecting to it
+func (p *URLPolicy) dialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	allowedName := matchHost(p.Allow, strings.ToLower(host))
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(_ string, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrURLNotAllowed, address)
+			}
+			return p.checkAddr(addrPort.Addr(), host, allowedName)
+		},
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// policyTransport checks every request, e.g. each redirect, before sending
+type policyTransport struct {
+	policy *URLPolicy
+	base   http.RoundTripper
+}
+
+func (t policyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.policy.checkName(req.URL); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// checkMediaURL checks a URL a TV is told to fetch against the renderer's
+// policy. The renderer's own URLs, e.g. from Proxy, are always fine.
+func (r *Renderer) checkMediaURL(ctx context.Context, mediaURL string) error {
+	if r.urlPolicy == nil || strings.HasPrefix(mediaURL, r.server.URL()+"/") {
+		return nil
+	}
+	return r.urlPolicy.Check(ctx, mediaURL)
+}
@@ -0,0 +1,119 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestURLPolicyCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  URLPolicy
+		url     string
+		allowed bool
+	}{
+		{"public", URLPolicy{BlockPrivate: true}, "http://93.184.216.34/a.png", true},
+		{"file scheme", URLPolicy{}, "file:///etc/passwd", false},
+		{"javascript", URLPolicy{}, "javascript:alert(1)", false},
+		{"rtsp allowed", URLPolicy{Schemes: []string{"rtsp"}}, "rtsp://93.184.216.34/cam", true},
+		{"no host", URLPolicy{}, "http:///a.png", false},
+		{"loopback", URLPolicy{BlockPrivate: true}, "http://127.0.0.1:8080/", false},
+		{"metadata service", URLPolicy{BlockPrivate: true}, "http://169.254.169.254/latest/meta-data/", false},
+		{"mapped loopback", URLPolicy{BlockPrivate: true}, "http://[::ffff:127.0.0.1]/", false},
+		{"LAN", URLPolicy{BlockPrivate: true}, "http://192.168.1.10/", false},
+		{"allowed CIDR", URLPolicy{BlockPrivate: true, Allow: []string{"192.168.1.0/24"}}, "http://192.168.1.10/", true},
+		{"not on allow list", URLPolicy{Allow: []string{"192.168.1.0/24"}}, "http://93.184.216.34/", false},
+		{"denied CIDR", URLPolicy{Deny: []string{"93.184.0.0/16"}}, "http://93.184.216.34/", false},
+		{"denied IP", URLPolicy{Deny: []string{"93.184.216.34"}}, "http://93.184.216.34/", false},
+		{"denied name", URLPolicy{Deny: []string{"*.example.com"}}, "http://cdn.Example.com/", false},
+		{"other name", URLPolicy{Deny: []string{"*.example.com"}}, "http://localhost/", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(context.Background(), tt.url)
+			if tt.allowed && err != nil {
+				t.Errorf("Check(%s) = %v, want allowed", tt.url, err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrURLNotAllowed) {
+				t.Errorf("Check(%s) = %v, want ErrURLNotAllowed", tt.url, err)
+			}
+		})
+	}
+
+	if !matchHost([]string{"*.example.com"}, "a.b.example.com") || matchHost([]string{"*.example.com"}, "badexample.com") {
+		t.Error("Wildcard matched wrongly")
+	}
+}
+
+func TestURLPolicyClient(t *testing.T) {
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://"+strings.Replace(r.Host, "127.0.0.1", "localhost", 1)+"/ok", http.StatusFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer remote.Close()
+
+	// Addresses are checked on connecting, even without calling Check
+	blocked := (&URLPolicy{BlockPrivate: true}).client(http.DefaultClient)
+	if _, err := blocked.Get(remote.URL + "/ok"); !errors.Is(err, ErrURLNotAllowed) {
+		t.Errorf("Expected the dial to be refused, got %v", err)
+	}
+
+	// Redirects are checked too
+	policy := &URLPolicy{Allow: []string{"127.0.0.1"}, Deny: []string{"localhost"}}
+	client := policy.client(http.DefaultClient)
+	resp, err := client.Get(remote.URL + "/ok")
+	if err != nil {
+		t.Fatalf("Allowed request failed: %v", err)
+	}
+	resp.Body.Close()
+	if _, err := client.Get(remote.URL + "/redirect"); !errors.Is(err, ErrURLNotAllowed) {
+		t.Errorf("Expected the redirect to be refused, got %v", err)
+	}
+}
+
+func TestRendererURLPolicy(t *testing.T) {
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not reached"))
+	}))
+	defer remote.Close()
+
+	var soapCalls int
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		soapCalls++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+
+	renderer, err := NewRenderer(WithURLPolicy(URLPolicy{BlockPrivate: true}))
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	ctx := context.Background()
+	if err := renderer.DisplayImageURL(ctx, tv, remote.URL+"/a.png"); !errors.Is(err, ErrURLNotAllowed) {
+		t.Errorf("DisplayImageURL: expected ErrURLNotAllowed, got %v", err)
+	}
+	if err := renderer.StreamVideo(ctx, tv, "file:///etc/passwd", ""); !errors.Is(err, ErrURLNotAllowed) {
+		t.Errorf("StreamVideo: expected ErrURLNotAllowed, got %v", err)
+	}
+	if _, err := renderer.Proxy(remote.URL + "/movie.mp4"); !errors.Is(err, ErrURLNotAllowed) {
+		t.Errorf("Proxy: expected ErrURLNotAllowed, got %v", err)
+	}
+	if soapCalls != 0 {
+		t.Errorf("TV received %d commands for refused URLs", soapCalls)
+	}
+
+	// The renderer's own URLs are fine, although on a private address
+	if err := renderer.StreamVideo(ctx, tv, renderer.ServerURL()+"/clip.mp4", ""); err != nil {
+		t.Errorf("StreamVideo of the renderer's URL failed: %v", err)
+	}
+}
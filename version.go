@@ -0,0 +1,225 @@
+package nimsforestsmarttv
+
+import (
+	"runtime/debug"
+	"slices"
+	"strings"
+)
+
+// modulePath is the import path of this package's module
+const modulePath = "github.com/nimsforest/nimsforestsmarttv"
+
+// BuildInfo describes the build of this package
+type BuildInfo struct {
+	Version   string // Module version, "(devel)" when built from a checkout
+	Revision  string // VCS commit of a checkout build (empty if unknown)
+	Time      string // VCS commit time, RFC 3339 (empty if unknown)
+	Modified  bool   // The checkout had uncommitted changes
+	GoVersion string // Go toolchain that built the binary
+}
+
+// String formats the build info on one line, e.g.
+// "v1.4.0 (go1.25.5)" or "(devel) 1a2b3c4d5e6f+dirty (go1.25.5)"
+func (b BuildInfo) String() string {
+	parts := []string{b.Version}
+	if b.Revision != "" {
+		rev := b.Revision[:min(len(b.Revision), 12)]
+		if b.Modified {
+			rev += "+dirty"
+		}
+		parts = append(parts, rev)
+	}
+	if b.GoVersion != "" {
+		parts = append(parts, "("+b.GoVersion+")")
+	}
+	return strings.Join(parts, " ")
+}
+
+// Build returns the build info of this package as linked into the running
+// binary
+func Build() BuildInfo {
+	info := BuildInfo{Version: "(devel)"}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.GoVersion = bi.GoVersion
+
+	if bi.Main.Path == modulePath {
+		// Built from this module, e.g. the smarttv command
+		if bi.Main.Version != "" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Revision = s.Value
+			case "vcs.time":
+				info.Time = s.Value
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+		return info
+	}
+
+	for _, dep := range bi.Deps {
+		if dep.Path == modulePath {
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			if dep.Version != "" {
+				info.Version = dep.Version
+			}
+			break
+		}
+	}
+	return info
+}
+
+// Version returns the module version of this package, "(devel)" when
+// built from a checkout
+func Version() string {
+	return Build().Version
+}
+
+// Feature names a feature of this package that integrators can check for
+// at runtime with HasFeature, instead of comparing versions
+type Feature string
+
+// Features of this package
+const (
+	FeatureRegistry         Feature = "registry"          // Registry and zones
+	FeatureTransactions     Feature = "transactions"      // Renderer.Begin
+	FeatureVirtualTV        Feature = "virtual-tv"        // NewVirtualTV, browser playback
+	FeatureKiosk            Feature = "kiosk"             // NewKiosk, Framebuffer
+	FeatureTransitions      Feature = "transitions"       // Transition, DisplayKenBurns
+	FeatureCollage          Feature = "collage"           // Collage, SmartCrop
+	FeatureSOAPErrors       Feature = "soap-errors"       // SOAPError, GetTransportInfo
+	FeaturePlayVerification Feature = "play-verification" // WithPlayVerification
+	FeatureKeepAlive        Feature = "keep-alive"        // KeepAlive
+	FeatureQuirks           Feature = "quirks"            // TV.Quirks
+	FeatureImageAudio       Feature = "image-audio"       // DisplayImageWithAudio
+	FeatureCommandQueue     Feature = "command-queue"     // Hold, WithBusyPolicy
+	FeatureServerErr        Feature = "server-err"        // Renderer.Err, Done
+	FeaturePathPrefix       Feature = "path-prefix"       // WithPathPrefix, WithRandomIDs
+	FeatureTrickPlay        Feature = "trick-play"        // TV.Play speeds, FastForward, Rewind
+	FeatureConfig           Feature = "config"            // Config, LoadConfig
+	FeatureConfigure        Feature = "configure"         // Renderer.Configure
+	FeatureLanguages        Feature = "languages"         // WithLanguage, Catalog
+	FeatureScheduler        Feature = "scheduler"         // Scheduler, Clock, Countdown
+	FeatureBlackout         Feature = "blackout"          // Calendar, Scheduler.SetBlackout
+	FeatureJournal          Feature = "journal"           // Journal, Renderer.Replay
+	FeatureFrameSeq         Feature = "frame-seq"         // DisplayFrameStream, StreamStatus
+	FeatureClientID         Feature = "client-id"         // WithClientResolver, AccessEntry.TV
+	FeatureImageDecoders    Feature = "image-decoders"    // DisplayImageFile, WithImageDecoder
+	FeatureRAWPreview       Feature = "raw-preview"       // ExtractRAWPreview
+	FeatureWatchFolder      Feature = "watch-folder"      // FolderWatcher
+	FeatureS3Watch          Feature = "s3-watch"          // S3Source, S3Watcher
+	FeatureImageURL         Feature = "image-url"         // DisplayImageURL
+	FeatureMediaProxy       Feature = "media-proxy"       // Renderer.Proxy, ImageServer.Proxy
+	FeatureProxyAuth        Feature = "proxy-auth"        // WithProxyHeader, WithProxyCookies, WithProxyAuth
+	FeatureSegmentCache     Feature = "segment-cache"     // WithSegmentCache
+	FeatureTimeShift        Feature = "time-shift"        // Renderer.StreamLive, LiveBuffer
+	FeatureRecording        Feature = "recording"         // Session.RecordTo
+	FeatureLoudness         Feature = "loudness"          // PlayAudio, NormalizeWAV
+	FeatureAudioQueue       Feature = "audio-queue"       // AudioQueue, TV.SetVolume
+	FeatureSpeakerGroups    Feature = "speaker-groups"    // SpeakerGroup, TV.Seek
+	FeatureExplorer         Feature = "explorer"          // ExploreDevice, ExploreIP, UPnPDevice.Call
+	FeatureDescriptionCache Feature = "description-cache" // ParseDeviceDescriptionBytes
+	FeatureLenientXML       Feature = "lenient-xml"       // DiscoverOptions.LenientXML
+	FeatureCharsets         Feature = "charsets"          // ISO-8859-1, Windows-1252, Shift_JIS descriptions
+	FeatureDiscoverer       Feature = "discoverer"        // Discoverer, TVAdded, TVRemoved
+	FeatureSlugs            Feature = "slugs"             // TV.Slug, Slugify, TV.Matches
+	FeatureNotify           Feature = "ssdp-notify"       // ListenNotify, passive Discoverer
+	FeatureTVErrors         Feature = "tv-errors"         // TVError
+	FeatureCast             Feature = "cast"              // DiscoverCast, ProtocolCast
+	FeatureTracing          Feature = "tracing"           // WithTracer, ContextWithTracer
+	FeatureURLPolicy        Feature = "url-policy"        // WithURLPolicy, URLPolicy
+	FeatureSamsung          Feature = "samsung"           // samsung package, TV.Remote, TV.LaunchApp
+	FeatureLimits           Feature = "limits"            // WithLimits, Limits
+	FeatureFrameUpload      Feature = "frame-upload"      // FrameReceiver, FramePusher, smarttv receive
+	FeatureTunnel           Feature = "tunnel"            // Tunnel, TunnelRelay, smarttv receive --relay
+	FeatureAirPlay          Feature = "airplay"           // DiscoverAirPlay, ProtocolAirPlay
+	FeatureAdvertise        Feature = "advertise"         // Advertiser, DiscoverDaemons
+	FeatureWebUI            Feature = "webui"             // WebUI
+	FeatureDirectAdd        Feature = "direct-add"        // FromIP, FromLocation
+	FeatureRoles            Feature = "roles"             // WithWebUIUsers, Role
+	FeatureAudit            Feature = "audit"             // AuditLog, Journal.Export
+	FeatureSearchOptions    Feature = "search-options"    // DiscoverWithOptions, DiscoverOptions.SearchTargets
+	FeatureWebOS            Feature = "webos"             // webos package
+)
+
+// features lists the features of this build
+var features = []Feature{
+	FeatureRegistry,
+	FeatureTransactions,
+	FeatureVirtualTV,
+	FeatureKiosk,
+	FeatureTransitions,
+	FeatureCollage,
+	FeatureSOAPErrors,
+	FeaturePlayVerification,
+	FeatureKeepAlive,
+	FeatureQuirks,
+	FeatureImageAudio,
+	FeatureCommandQueue,
+	FeatureServerErr,
+	FeaturePathPrefix,
+	FeatureTrickPlay,
+	FeatureConfig,
+	FeatureConfigure,
+	FeatureLanguages,
+	FeatureScheduler,
+	FeatureBlackout,
+	FeatureJournal,
+	FeatureFrameSeq,
+	FeatureClientID,
+	FeatureImageDecoders,
+	FeatureRAWPreview,
+	FeatureWatchFolder,
+	FeatureS3Watch,
+	FeatureImageURL,
+	FeatureMediaProxy,
+	FeatureProxyAuth,
+	FeatureSegmentCache,
+	FeatureTimeShift,
+	FeatureRecording,
+	FeatureLoudness,
+	FeatureAudioQueue,
+	FeatureSpeakerGroups,
+	FeatureExplorer,
+	FeatureDescriptionCache,
+	FeatureLenientXML,
+	FeatureCharsets,
+	FeatureDiscoverer,
+	FeatureSlugs,
+	FeatureNotify,
+	FeatureTVErrors,
+	FeatureCast,
+	FeatureTracing,
+	FeatureURLPolicy,
+	FeatureSamsung,
+	FeatureLimits,
+	FeatureFrameUpload,
+	FeatureTunnel,
+	FeatureAirPlay,
+	FeatureAdvertise,
+	FeatureWebUI,
+	FeatureDirectAdd,
+	FeatureRoles,
+	FeatureAudit,
+	FeatureSearchOptions,
+	FeatureWebOS,
+}
+
+// Features returns the features of this build
+func Features() []Feature {
+	return slices.Clone(features)
+}
+
+// HasFeature reports whether this build has a feature. Unknown names,
+// e.g. features of newer releases, report false.
+func HasFeature(f Feature) bool {
+	return slices.Contains(features, f)
+}
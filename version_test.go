@@ -0,0 +1,51 @@
+package nimsforestsmarttv
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// TestVersionAndFeatures tests the build info and feature report
+func TestVersionAndFeatures(t *testing.T) {
+	if Version() == "" {
+		t.Error("Expected a version")
+	}
+	if !HasFeature(FeatureTransactions) || HasFeature("teleport") {
+		t.Error("Unexpected feature detection")
+	}
+
+	features := Features()
+	features[0] = "changed"
+	if Features()[0] == "changed" {
+		t.Error("Expected Features to return a copy")
+	}
+
+	b := BuildInfo{Version: "(devel)", Revision: "0123456789abcdef", Modified: true, GoVersion: "go1.25.5"}
+	if got, want := b.String(), "(devel) 0123456789ab+dirty (go1.25.5)"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+// TestVirtualTVStatus tests the status endpoint of a virtual TV
+func TestVirtualTVStatus(t *testing.T) {
+	vtv, err := NewVirtualTV("Den")
+	if err != nil {
+		t.Fatalf("NewVirtualTV failed: %v", err)
+	}
+	defer vtv.Close()
+
+	resp, err := http.Get(vtv.URL() + "status")
+	if err != nil {
+		t.Fatalf("GET /status failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var status VirtualTVStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("Decode status failed: %v", err)
+	}
+	if status.Name != "Den" || status.State != "NO_MEDIA_PRESENT" || status.Version != Version() || len(status.Features) == 0 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
@@ -0,0 +1,215 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"time"
+)
+
+// syncMargin is extra head room added to the slowest TV's latency so every
+// Play command can be sent before the common start time
+const syncMargin = 150 * time.Millisecond
+
+// SyncResult reports how a single TV was started by StreamVideoSynced
+type SyncResult struct {
+	TV      *TV
+	Latency time.Duration // Measured SetAVTransportURI round trip
+	SentAt  time.Time     // When Play was sent to this TV
+}
+
+// SyncReport summarizes a synchronized start across several TVs
+type SyncReport struct {
+	Start   time.Time // Target moment at which all TVs should start playing
+	Results []SyncResult
+}
+
+// StreamVideoSynced starts the same video on several TVs so playback begins
+// at (roughly) the same moment on every screen of a video wall.
+//
+// The video URI is loaded on every TV first while measuring each TV's
+// action latency. Play is then staggered: slow TVs are sent Play earlier
+// than fast ones so all of them start at a common target time. Sync is
+// best effort and typically within a fraction of a second.
+func (r *Renderer) StreamVideoSynced(ctx context.Context, tvs []*TV, videoURL string, title string) (SyncReport, error) {
+	if err := r.checkMediaURL(ctx, videoURL); err != nil {
+		return SyncReport{}, err
+	}
+	if title == "" {
+		title = r.message(MsgVideoStream)
+	}
+
+	load := func(ctx context.Context, tv *TV) error {
+		if err := r.intend(ctx, tv, JournalVideo, videoURL, "", title); err != nil {
+			return err
+		}
+		if err := tv.setAVTransportURIForVideo(ctx, videoURL, title); err != nil {
+			return fmt.Errorf("set video URI: %w", err)
+		}
+		return nil
+	}
+	return r.startSynced(ctx, tvs, load, nil)
+}
+
+// startSynced loads content on every TV with load, measuring each TV's
+// latency, then sends Play staggered so all TVs start at a common time.
+// lead (if not nil) returns how much earlier than its latency suggests a
+// TV needs Play, e.g. because it buffers longer.
+func (r *Renderer) startSynced(ctx context.Context, tvs []*TV, load func(ctx context.Context, tv *TV) error, lead func(tv *TV) time.Duration) (SyncReport, error) {
+	if err := distinctTVs(tvs); err != nil {
+		return SyncReport{}, err
+	}
+
+	report := SyncReport{Results: make([]SyncResult, len(tvs))}
+	index := make(map[*TV]int, len(tvs))
+	for i, tv := range tvs {
+		index[tv] = i
+		report.Results[i].TV = tv
+	}
+
+	// Hold every TV for the whole sequence so nothing interleaves
+	unlock, err := r.lockTVs(ctx, tvs)
+	if err != nil {
+		return report, err
+	}
+	defer unlock()
+
+	// Phase 1: load the URI everywhere and measure latency
+	err = fanOut(ctx, tvs, func(ctx context.Context, tv *TV) error {
+		start := time.Now()
+		if err := load(ctx, tv); err != nil {
+			return err
+		}
+		report.Results[index[tv]].Latency = time.Since(start)
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	early := func(tv *TV) time.Duration {
+		d := report.Results[index[tv]].Latency
+		if lead != nil {
+			// Negative leads send Play after the start time
+			d += lead(tv)
+		}
+		return d
+	}
+	var slowest time.Duration
+	for _, tv := range tvs {
+		slowest = max(slowest, early(tv))
+	}
+	report.Start = time.Now().Add(slowest + syncMargin)
+
+	// Phase 2: staggered Play so every TV starts at report.Start
+	err = fanOut(ctx, tvs, func(ctx context.Context, tv *TV) error {
+		res := &report.Results[index[tv]]
+		timer := time.NewTimer(time.Until(report.Start.Add(-early(tv))))
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		res.SentAt = time.Now()
+		if err := tv.play(ctx); err != nil {
+			return fmt.Errorf("play: %w", err)
+		}
+		return nil
+	})
+
+	return report, err
+}
+
+// distinctTVs fails if a TV is listed twice, which would load it twice
+// and throw its timing off
+func distinctTVs(tvs []*TV) error {
+	seen := make(map[string]bool, len(tvs))
+	for _, tv := range tvs {
+		if seen[tv.ControlURL] {
+			return fmt.Errorf("TV %s is listed twice", tv.Name)
+		}
+		seen[tv.ControlURL] = true
+	}
+	return nil
+}
+
+// TileLayout describes the physical panels of a video wall. The zero
+// value is a wall of 1920x1080 panels without bezel compensation.
+type TileLayout struct {
+	PanelWidth  int // Pixel width of each panel (default 1920)
+	PanelHeight int // Pixel height of each panel (default 1080)
+
+	// Bezel compensation: the gap between two neighbouring panels expressed
+	// in panel pixels. Image content "behind" the bezels is skipped so lines
+	// stay straight across panels.
+	BezelX int // Gap between columns
+	BezelY int // Gap between rows
+}
+
+// DisplayTiled splits one image across a grid of TVs forming a video wall.
+// grid[row][col] is the TV showing that tile; nil entries are skipped and
+// a TV may appear only once.
+//
+// The image is scaled to cover the whole wall (cropping the edges if the
+// aspect ratio differs), then each tile is cut out at the panel resolution
+// from layout and pushed to its TV concurrently.
+func (r *Renderer) DisplayTiled(ctx context.Context, grid [][]*TV, img image.Image, layout TileLayout) error {
+	if layout.PanelWidth == 0 {
+		layout.PanelWidth = 1920
+	}
+	if layout.PanelHeight == 0 {
+		layout.PanelHeight = 1080
+	}
+
+	rows := len(grid)
+	cols := 0
+	for _, row := range grid {
+		cols = max(cols, len(row))
+	}
+	if rows == 0 || cols == 0 {
+		return fmt.Errorf("empty video wall grid")
+	}
+
+	// Virtual canvas covering all panels and the bezels between them
+	wallW := cols*layout.PanelWidth + (cols-1)*layout.BezelX
+	wallH := rows*layout.PanelHeight + (rows-1)*layout.BezelY
+	src := r.cropRect(img, wallW, wallH)
+	scale := float64(src.Dx()) / float64(wallW)
+
+	var tvs []*TV
+	cells := make(map[*TV]image.Point)
+	for y, row := range grid {
+		for x, tv := range row {
+			if tv != nil {
+				tvs = append(tvs, tv)
+				cells[tv] = image.Pt(x, y)
+			}
+		}
+	}
+	if err := distinctTVs(tvs); err != nil {
+		return err
+	}
+
+	// Each tile is stored right before its TV is told to fetch it
+	return fanOut(ctx, tvs, func(ctx context.Context, tv *TV) error {
+		cell := cells[tv]
+
+		// Tile position on the wall canvas, mapped back into the source
+		wx := cell.X * (layout.PanelWidth + layout.BezelX)
+		wy := cell.Y * (layout.PanelHeight + layout.BezelY)
+		region := image.Rect(
+			src.Min.X+int(float64(wx)*scale),
+			src.Min.Y+int(float64(wy)*scale),
+			src.Min.X+int(float64(wx+layout.PanelWidth)*scale),
+			src.Min.Y+int(float64(wy+layout.PanelHeight)*scale),
+		)
+
+		tileURL, contentType, err := r.storeImage(r.resizer.Resize(img, region, layout.PanelWidth, layout.PanelHeight))
+		if err != nil {
+			return fmt.Errorf("tile %d,%d: %w", cell.Y, cell.X, err)
+		}
+		return r.showURL(ctx, tv, tileURL, contentType)
+	})
+}
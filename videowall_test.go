@@ -0,0 +1,237 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestStreamVideoSynced tests that a slow TV is sent Play earlier than a
+// fast one so both start at the reported time
+func TestStreamVideoSynced(t *testing.T) {
+	var mu sync.Mutex
+	played := make(map[string]time.Time)
+	newMock := func(name string, delay time.Duration) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch soapAction := r.Header.Get("SOAPAction"); {
+			case strings.Contains(soapAction, "#SetAVTransportURI"):
+				time.Sleep(delay)
+			case strings.Contains(soapAction, "#Play"):
+				mu.Lock()
+				played[name] = time.Now()
+				mu.Unlock()
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+	fast := newMock("fast", 0)
+	defer fast.Close()
+	slow := newMock("slow", 200*time.Millisecond)
+	defer slow.Close()
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	tvs := []*TV{{Name: "Fast", ControlURL: fast.URL}, {Name: "Slow", ControlURL: slow.URL}}
+	report, err := renderer.StreamVideoSynced(context.Background(), tvs, "http://example.com/wall.mp4", "")
+	if err != nil {
+		t.Fatalf("StreamVideoSynced failed: %v", err)
+	}
+
+	if len(report.Results) != 2 || report.Results[0].TV != tvs[0] || report.Results[1].TV != tvs[1] {
+		t.Fatalf("Unexpected results %+v", report.Results)
+	}
+	fastRes, slowRes := report.Results[0], report.Results[1]
+	if slowRes.Latency < 200*time.Millisecond || fastRes.Latency >= slowRes.Latency {
+		t.Errorf("Latencies fast %s, slow %s", fastRes.Latency, slowRes.Latency)
+	}
+	if !slowRes.SentAt.Before(fastRes.SentAt) {
+		t.Errorf("Slow TV got Play at %s, not before the fast one at %s", slowRes.SentAt, fastRes.SentAt)
+	}
+	// The fast TV's latency is tiny, so allow for timer jitter
+	if fastRes.SentAt.After(report.Start.Add(50 * time.Millisecond)) {
+		t.Errorf("Fast TV got Play at %s, after the start time %s", fastRes.SentAt, report.Start)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if played["fast"].IsZero() || played["slow"].IsZero() {
+		t.Errorf("Play reached %v, want both TVs", played)
+	}
+}
+
+// TestStreamVideoSyncedDuplicate tests that a TV listed twice is refused
+// before any TV is loaded
+func TestStreamVideoSyncedDuplicate(t *testing.T) {
+	var calls int
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mock.Close()
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	tvs := []*TV{{Name: "Left", ControlURL: mock.URL}, {Name: "Left again", ControlURL: mock.URL}}
+	if _, err := renderer.StreamVideoSynced(context.Background(), tvs, "http://example.com/wall.mp4", ""); err == nil {
+		t.Error("Expected an error for a TV listed twice")
+	}
+	if calls != 0 {
+		t.Errorf("TV got %d calls, want none", calls)
+	}
+}
+
+// TestDisplayTiled tests that each TV of a wall gets its tile at the panel
+// size of the layout, skipping the image behind the bezels
+func TestDisplayTiled(t *testing.T) {
+	var mu sync.Mutex
+	uris := make(map[string]string)
+	newMock := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if strings.Contains(r.Header.Get("SOAPAction"), "#SetAVTransportURI") {
+				mu.Lock()
+				uris[name] = soapArg(body, "CurrentURI")
+				mu.Unlock()
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+	left := newMock("left")
+	defer left.Close()
+	right := newMock("right")
+	defer right.Close()
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	// Red and blue panels with green behind the bezel between them
+	img := image.NewRGBA(image.Rect(0, 0, 220, 50))
+	draw.Draw(img, image.Rect(0, 0, 100, 50), image.NewUniform(color.RGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(100, 0, 120, 50), image.NewUniform(color.RGBA{0, 255, 0, 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(120, 0, 220, 50), image.NewUniform(color.RGBA{0, 0, 255, 255}), image.Point{}, draw.Src)
+
+	grid := [][]*TV{{{Name: "Left", ControlURL: left.URL}, {Name: "Right", ControlURL: right.URL}}}
+	layout := TileLayout{PanelWidth: 100, PanelHeight: 50, BezelX: 20}
+	if err := renderer.DisplayTiled(context.Background(), grid, img, layout); err != nil {
+		t.Fatalf("DisplayTiled failed: %v", err)
+	}
+
+	tile := func(name string) image.Image {
+		t.Helper()
+		mu.Lock()
+		uri := uris[name]
+		mu.Unlock()
+		resp, err := http.Get(uri)
+		if err != nil {
+			t.Fatalf("Fetch %s tile: %v", name, err)
+		}
+		defer resp.Body.Close()
+		tile, _, err := image.Decode(resp.Body)
+		if err != nil {
+			t.Fatalf("Decode %s tile: %v", name, err)
+		}
+		if tile.Bounds().Dx() != 100 || tile.Bounds().Dy() != 50 {
+			t.Errorf("%s tile is %v, want 100x50", name, tile.Bounds())
+		}
+		return tile
+	}
+	dominant := func(c color.Color) string {
+		r, g, b, _ := c.RGBA()
+		switch {
+		case r > g && r > b:
+			return "red"
+		case g > r && g > b:
+			return "green"
+		default:
+			return "blue"
+		}
+	}
+	for _, tt := range []struct {
+		name string
+		x    int
+		want string
+	}{
+		{"left", 2, "red"}, {"left", 97, "red"}, {"right", 2, "blue"}, {"right", 97, "blue"},
+	} {
+		if got := dominant(tile(tt.name).At(tt.x, 25)); got != tt.want {
+			t.Errorf("%s tile at x=%d is %s, want %s", tt.name, tt.x, got, tt.want)
+		}
+	}
+
+	twice := [][]*TV{{grid[0][0]}, {{Name: "Left again", ControlURL: left.URL}}}
+	if err := renderer.DisplayTiled(context.Background(), twice, img, layout); err == nil {
+		t.Error("Expected an error for a TV in two tiles")
+	}
+}
+
+// TestDisplayTiledGrid tests that every tile of a 4x4 wall is still served
+// once all panels have been told to fetch it
+func TestDisplayTiledGrid(t *testing.T) {
+	var mu sync.Mutex
+	uris := make(map[string]string)
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(r.Header.Get("SOAPAction"), "#SetAVTransportURI") {
+			mu.Lock()
+			uris[r.URL.Path] = soapArg(body, "CurrentURI")
+			mu.Unlock()
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mock.Close()
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	grid := make([][]*TV, 4)
+	for y := range grid {
+		grid[y] = make([]*TV, 4)
+		for x := range grid[y] {
+			grid[y][x] = &TV{Name: fmt.Sprintf("Panel %d,%d", y, x), ControlURL: fmt.Sprintf("%s/%d/%d", mock.URL, y, x)}
+		}
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 160, 90))
+	layout := TileLayout{PanelWidth: 40, PanelHeight: 20}
+	if err := renderer.DisplayTiled(context.Background(), grid, img, layout); err != nil {
+		t.Fatalf("DisplayTiled failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(uris) != 16 {
+		t.Fatalf("%d panels got a tile, want 16", len(uris))
+	}
+	for panel, uri := range uris {
+		resp, err := http.Get(uri)
+		if err != nil {
+			t.Fatalf("Fetch tile of %s: %v", panel, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Tile of %s: status %d, want 200", panel, resp.StatusCode)
+		}
+	}
+}
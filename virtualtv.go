@@ -0,0 +1,588 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"hash/fnv"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VirtualTV simulates a DLNA TV for developing layouts without one. It
+// answers AVTransport requests like a real TV and fetches whatever it is
+// told to play. Frames are shown on a web page (an MJPEG stream, so any
+// browser works as the "screen") and can be written to disk.
+//
+// Add it to a Registry or pass TV() to the Renderer like any other TV.
+// Video URLs are only played with WithBrowserPlayback.
+type VirtualTV struct {
+	name      string
+	udn       string
+	addr      string
+	frameDir  string
+	inBrowser bool               // The page's browser fetches and plays media itself
+	onFrame   func(frame []byte) // Called with every new frame (nil = blank)
+
+	server   *http.Server
+	listener net.Listener
+	localIP  string
+	port     int
+
+	mu          sync.Mutex
+	uri         string
+	contentType string // MIME type of uri from its DIDL-Lite metadata
+	nextURI     string
+	state       string        // UPnP transport state
+	frame       []byte        // Latest frame as JPEG (nil = blank screen)
+	media       browserMedia  // What the page plays (browser playback)
+	frames      int           // Frames shown so far
+	frameSeq    uint64        // X-Frame-Seq of the latest frame (0 = none)
+	capturedAt  time.Time     // X-Frame-Timestamp of the latest frame
+	changed     chan struct{} // Closed and replaced on every new frame
+	loadGen     int           // Bumped to cancel a running refresh loop
+	closed      bool
+
+	life *lifecycle // Ends when the HTTP server stops serving
+}
+
+// VirtualTVOption configures a VirtualTV
+type VirtualTVOption func(*VirtualTV)
+
+// WithFrameDir writes every frame the virtual TV shows to dir as
+// frame_000001.jpg, frame_000002.jpg, ...
+func WithFrameDir(dir string) VirtualTVOption {
+	return func(v *VirtualTV) {
+		v.frameDir = dir
+	}
+}
+
+// WithFrameHandler calls fn with every frame the virtual TV shows, as JPEG,
+// and with nil when the screen goes blank
+func WithFrameHandler(fn func(frame []byte)) VirtualTVOption {
+	return func(v *VirtualTV) {
+		v.onFrame = fn
+	}
+}
+
+// WithListenAddr sets the address the virtual TV listens on (default
+// ":0", a random port). A fixed port keeps registry entries valid across
+// restarts.
+func WithListenAddr(addr string) VirtualTVOption {
+	return func(v *VirtualTV) {
+		v.addr = addr
+	}
+}
+
+// virtualAVTransport is the service type the virtual TV advertises
+const virtualAVTransport = "urn:schemas-upnp-org:service:AVTransport:1"
+
+// virtualActions are the AVTransport actions the virtual TV implements
+var virtualActions = []string{"SetAVTransportURI", "SetNextAVTransportURI", "Play", "Pause", "Stop", "GetTransportInfo"}
+
+// NewVirtualTV starts a virtual TV with the given friendly name
+func NewVirtualTV(name string, opts ...VirtualTVOption) (*VirtualTV, error) {
+	// Derive the UDN from the name so the registry recognizes it next time
+	h := fnv.New64a()
+	h.Write([]byte(name))
+
+	v := &VirtualTV{
+		name:    name,
+		udn:     fmt.Sprintf("uuid:virtual-%016x", h.Sum64()),
+		addr:    ":0",
+		state:   "NO_MEDIA_PRESENT",
+		changed: make(chan struct{}),
+		life:    newLifecycle(),
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	if v.frameDir != "" {
+		if err := os.MkdirAll(v.frameDir, 0755); err != nil {
+			return nil, fmt.Errorf("create frame dir: %w", err)
+		}
+	}
+
+	localIP, err := getLocalIP()
+	if err != nil {
+		return nil, fmt.Errorf("get local IP: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", v.addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	v.listener = listener
+	v.localIP = localIP
+	v.port = listener.Addr().(*net.TCPAddr).Port
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/description.xml", v.handleDescription)
+	mux.HandleFunc("/AVTransport/scpd.xml", v.handleSCPD)
+	mux.HandleFunc("/AVTransport/control", v.handleControl)
+	mux.HandleFunc("/frame.jpg", v.handleFrame)
+	mux.HandleFunc("/mjpeg", v.handleMJPEG)
+	mux.HandleFunc("/status", v.handleStatus)
+	mux.HandleFunc("/{$}", v.handlePage)
+	if v.inBrowser {
+		mux.HandleFunc("/events", v.handleEvents)
+	}
+
+	// No write timeout: MJPEG viewers stay connected
+	v.server = &http.Server{
+		Handler:     mux,
+		ReadTimeout: 30 * time.Second,
+	}
+	v.life.Go("virtual TV server", func() error {
+		if err := v.server.Serve(listener); err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	})
+
+	return v, nil
+}
+
+// URL returns the web page showing the virtual screen
+func (v *VirtualTV) URL() string {
+	return fmt.Sprintf("http://%s:%d/", v.localIP, v.port)
+}
+
+// Location returns the URL of the device description, as SSDP would
+// advertise it
+func (v *VirtualTV) Location() string {
+	return v.URL() + "description.xml"
+}
+
+// TV returns the virtual TV as a TV the Renderer can drive
+func (v *VirtualTV) TV() *TV {
+	base := fmt.Sprintf("http://%s:%d", v.localIP, v.port)
+	return &TV{
+		Name:               v.name,
+		IP:                 v.localIP,
+		Port:               v.port,
+		ControlURL:         base + "/AVTransport/control",
+		BaseURL:            base,
+		AVTransportType:    virtualAVTransport,
+		AVTransportVersion: 1,
+		UDN:                v.udn,
+		SCPDURL:            base + "/AVTransport/scpd.xml",
+		Actions:            append([]string(nil), virtualActions...),
+		Manufacturer:       "nimsforest",
+		ModelName:          "Virtual TV",
+	}
+}
+
+// Frame returns the JPEG currently on the virtual screen (nil if blank)
+func (v *VirtualTV) Frame() []byte {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.frame
+}
+
+// Frames returns how many frames the virtual TV has shown
+func (v *VirtualTV) Frames() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.frames
+}
+
+// CurrentURI returns the URI the virtual TV was last told to play
+func (v *VirtualTV) CurrentURI() string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.uri
+}
+
+// Close stops the virtual TV
+func (v *VirtualTV) Close() error {
+	v.mu.Lock()
+	v.closed = true
+	v.loadGen++
+	v.mu.Unlock()
+	v.life.stop()
+	return v.server.Close()
+}
+
+// Done is closed when the virtual TV stops serving, because of Close or
+// because its server failed
+func (v *VirtualTV) Done() <-chan struct{} {
+	return v.life.Done()
+}
+
+// Err returns why the virtual TV stopped serving. It is nil while it runs
+// and after Close.
+func (v *VirtualTV) Err() error {
+	return v.life.Err()
+}
+
+// handleControl implements the AVTransport SOAP actions
+func (v *VirtualTV) handleControl(w http.ResponseWriter, r *http.Request) {
+	soapAction := strings.Trim(r.Header.Get("SOAPAction"), `"`)
+	action := soapAction[strings.LastIndex(soapAction, "#")+1:]
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var out string
+	switch action {
+	case "SetAVTransportURI":
+		uri := soapArg(body, "CurrentURI")
+		v.mu.Lock()
+		v.uri = uri
+		v.contentType = didlContentType(soapArg(body, "CurrentURIMetaData"))
+		playing := v.state == "PLAYING"
+		if !playing {
+			v.state = "STOPPED"
+		}
+		v.mu.Unlock()
+		// Like most TVs, switch right away while playing
+		if playing {
+			v.load(uri)
+		}
+
+	case "SetNextAVTransportURI":
+		v.mu.Lock()
+		v.nextURI = soapArg(body, "NextURI")
+		v.mu.Unlock()
+
+	case "Play":
+		v.mu.Lock()
+		uri := v.uri
+		v.state = "PLAYING"
+		v.mu.Unlock()
+		v.load(uri)
+
+	case "Pause":
+		v.mu.Lock()
+		v.state = "PAUSED_PLAYBACK"
+		v.loadGen++
+		v.mu.Unlock()
+
+	case "Stop":
+		v.mu.Lock()
+		v.state = "STOPPED"
+		v.loadGen++
+		gen := v.loadGen
+		v.mu.Unlock()
+		v.setFrame(nil, gen)
+
+	case "GetTransportInfo":
+		v.mu.Lock()
+		state := v.state
+		v.mu.Unlock()
+		out = fmt.Sprintf(`<CurrentTransportState>%s</CurrentTransportState><CurrentTransportStatus>OK</CurrentTransportStatus><CurrentSpeed>1</CurrentSpeed>`, state)
+
+	default:
+		w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, soapFault(401, "Invalid Action"))
+		return
+	}
+
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body><u:%sResponse xmlns:u="%s">%s</u:%sResponse></s:Body></s:Envelope>`,
+		action, virtualAVTransport, out, action)
+}
+
+// load fetches uri in the background and shows it. URLs answered with a
+// Refresh header (like the streaming endpoint) are refetched until
+// something else is played.
+func (v *VirtualTV) load(uri string) {
+	v.mu.Lock()
+	v.loadGen++
+	gen := v.loadGen
+	v.mu.Unlock()
+
+	if uri == "" {
+		return
+	}
+	if v.inBrowser {
+		v.showInBrowser(uri, gen)
+		return
+	}
+
+	go func() {
+		for {
+			refresh, err := v.fetch(uri, gen)
+			if err != nil || refresh <= 0 {
+				return
+			}
+			time.Sleep(refresh)
+
+			v.mu.Lock()
+			current := v.loadGen == gen
+			v.mu.Unlock()
+			if !current {
+				return
+			}
+		}
+	}()
+}
+
+// fetch downloads one frame of load generation gen and returns the
+// refresh interval the server asked for (0 = none)
+func (v *VirtualTV) fetch(uri string, gen int) (time.Duration, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(uri)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "image/") {
+		// Video and other media are not rendered
+		return 0, nil
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	// Keep JPEGs as they are, convert everything else for the MJPEG stream
+	if resp.Header.Get("Content-Type") != "image/jpeg" {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return 0, fmt.Errorf("decode frame: %w", err)
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, toRGBA(img), &jpeg.Options{Quality: 90}); err != nil {
+			return 0, err
+		}
+		data = buf.Bytes()
+	}
+
+	v.setFrame(data, gen)
+
+	seq, _ := strconv.ParseUint(resp.Header.Get("X-Frame-Seq"), 10, 64)
+	capturedAt, _ := time.Parse(time.RFC3339Nano, resp.Header.Get("X-Frame-Timestamp"))
+	v.mu.Lock()
+	if gen == v.loadGen {
+		v.frameSeq, v.capturedAt = seq, capturedAt
+	}
+	v.mu.Unlock()
+
+	var refresh time.Duration
+	if secs, err := strconv.Atoi(resp.Header.Get("Refresh")); err == nil {
+		refresh = time.Duration(secs) * time.Second
+	}
+	return refresh, nil
+}
+
+// setFrame puts a frame of load generation gen on the virtual screen and
+// wakes MJPEG viewers. Frames of an older generation are dropped.
+func (v *VirtualTV) setFrame(data []byte, gen int) {
+	v.mu.Lock()
+	if v.closed || gen != v.loadGen {
+		v.mu.Unlock()
+		return
+	}
+	v.frame = data
+	if data != nil {
+		v.frames++
+	} else {
+		v.media = browserMedia{}
+	}
+	n := v.frames
+	v.notify()
+	v.mu.Unlock()
+
+	if v.frameDir != "" && data != nil {
+		// Best effort: a full disk must not stop the screen
+		os.WriteFile(filepath.Join(v.frameDir, fmt.Sprintf("frame_%06d.jpg", n)), data, 0644)
+	}
+	if v.onFrame != nil {
+		v.onFrame(data)
+	}
+}
+
+// notify wakes everyone waiting for the screen to change. Call with v.mu
+// held.
+func (v *VirtualTV) notify() {
+	close(v.changed)
+	v.changed = make(chan struct{})
+}
+
+// VirtualTVStatus is the JSON served on a virtual TV's /status endpoint
+type VirtualTVStatus struct {
+	Name     string    `json:"name"`
+	State    string    `json:"state"`    // UPnP transport state
+	URI      string    `json:"uri"`      // Current media (empty if none)
+	Frames   int       `json:"frames"`   // Frames shown so far
+	Version  string    `json:"version"`  // Module version
+	Build    BuildInfo `json:"build"`    // Full build info
+	Features []Feature `json:"features"` // Features of this build
+
+	// Stream frame shown (see DisplayFrameStream), zero otherwise
+	FrameSeq        uint64    `json:"frame_seq,omitempty"`
+	FrameCapturedAt time.Time `json:"frame_captured_at,omitzero"`
+}
+
+// handleStatus serves the virtual TV's state and build info as JSON
+func (v *VirtualTV) handleStatus(w http.ResponseWriter, r *http.Request) {
+	build := Build()
+
+	v.mu.Lock()
+	status := VirtualTVStatus{
+		Name:     v.name,
+		State:    v.state,
+		URI:      v.uri,
+		Frames:   v.frames,
+		Version:  build.Version,
+		Build:    build,
+		Features: Features(),
+
+		FrameSeq:        v.frameSeq,
+		FrameCapturedAt: v.capturedAt,
+	}
+	v.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleFrame serves the current frame as a single JPEG
+func (v *VirtualTV) handleFrame(w http.ResponseWriter, r *http.Request) {
+	frame := v.Frame()
+	if frame == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(frame)
+}
+
+// handleMJPEG streams every new frame as multipart/x-mixed-replace
+func (v *VirtualTV) handleMJPEG(w http.ResponseWriter, r *http.Request) {
+	const boundary = "frame"
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+boundary)
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+
+	for {
+		v.mu.Lock()
+		frame, changed := v.frame, v.changed
+		v.mu.Unlock()
+
+		if frame == nil {
+			frame = blankFrame()
+		}
+		fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", boundary, len(frame))
+		if _, err := w.Write(frame); err != nil {
+			return
+		}
+		io.WriteString(w, "\r\n")
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// blankFrame returns a small black JPEG shown while nothing plays
+var blankFrame = sync.OnceValue(func() []byte {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 16, 9)), nil)
+	return buf.Bytes()
+})
+
+// handlePage serves a full screen page showing the MJPEG stream
+func (v *VirtualTV) handlePage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if v.inBrowser {
+		fmt.Fprintf(w, browserPage, escapeXML(v.name))
+		return
+	}
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html><head><title>%s</title>
+<style>html,body{margin:0;height:100%%;background:#000}img{width:100%%;height:100%%;object-fit:contain}</style>
+</head><body><img src="/mjpeg" alt=""></body></html>
+`, escapeXML(v.name))
+}
+
+// handleDescription serves the UPnP device description
+func (v *VirtualTV) handleDescription(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <specVersion><major>1</major><minor>0</minor></specVersion>
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:MediaRenderer:1</deviceType>
+    <friendlyName>%s</friendlyName>
+    <manufacturer>nimsforest</manufacturer>
+    <modelName>Virtual TV</modelName>
+    <UDN>%s</UDN>
+    <serviceList>
+      <service>
+        <serviceType>%s</serviceType>
+        <serviceId>urn:upnp-org:serviceId:AVTransport</serviceId>
+        <controlURL>/AVTransport/control</controlURL>
+        <SCPDURL>/AVTransport/scpd.xml</SCPDURL>
+      </service>
+    </serviceList>
+  </device>
+</root>
+`, escapeXML(v.name), v.udn, virtualAVTransport)
+}
+
+// handleSCPD serves the AVTransport service description
+func (v *VirtualTV) handleSCPD(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?>
+<scpd xmlns="urn:schemas-upnp-org:service-1-0"><actionList>`)
+	for _, action := range virtualActions {
+		fmt.Fprintf(w, "<action><name>%s</name></action>", action)
+	}
+	fmt.Fprint(w, "</actionList></scpd>\n")
+}
+
+// soapArg returns the text of the first element called name in a SOAP body
+func soapArg(body []byte, name string) string {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == name {
+			var value string
+			if err := dec.DecodeElement(&value, &start); err != nil {
+				return ""
+			}
+			return strings.TrimSpace(value)
+		}
+	}
+}
+
+// soapFault returns a UPnP error response body
+func soapFault(code int, description string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body><s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail><UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>%d</errorCode><errorDescription>%s</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>`, code, description)
+}
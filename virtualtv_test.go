@@ -0,0 +1,110 @@
+package nimsforestsmarttv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"image/jpeg"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestVirtualTV tests that a virtual TV can be discovered from its
+// description and shows what the renderer sends it
+func TestVirtualTV(t *testing.T) {
+	dir := t.TempDir()
+	vtv, err := NewVirtualTV("Laptop", WithFrameDir(dir))
+	if err != nil {
+		t.Fatalf("NewVirtualTV failed: %v", err)
+	}
+	defer vtv.Close()
+
+	ctx := context.Background()
+	tv, err := fetchTVInfo(ctx, vtv.Location(), false)
+	if err != nil {
+		t.Fatalf("fetchTVInfo failed: %v", err)
+	}
+	if tv.Name != "Laptop" || tv.ControlURL != vtv.TV().ControlURL || !tv.SupportsAction("SetNextAVTransportURI") {
+		t.Errorf("Unexpected TV from description: %+v", tv)
+	}
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	if err := renderer.DisplayText(ctx, tv, "HELLO"); err != nil {
+		t.Fatalf("DisplayText failed: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for vtv.Frames() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	frame := vtv.Frame()
+	if frame == nil {
+		t.Fatal("Expected a frame on the virtual screen")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(frame)); err != nil {
+		t.Errorf("Frame is not a JPEG: %v", err)
+	}
+
+	onDisk, err := os.ReadFile(filepath.Join(dir, "frame_000001.jpg"))
+	if err != nil || !bytes.Equal(onDisk, frame) {
+		t.Errorf("Expected the frame written to disk, got err=%v", err)
+	}
+
+	if err := renderer.Stop(ctx, tv); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if vtv.Frame() != nil {
+		t.Error("Expected a blank screen after Stop")
+	}
+}
+
+// TestBrowserPlayback tests that a browser-backed virtual TV pushes the
+// media URL to its page instead of rendering it
+func TestBrowserPlayback(t *testing.T) {
+	vtv, err := NewVirtualTV("Office", WithBrowserPlayback())
+	if err != nil {
+		t.Fatalf("NewVirtualTV failed: %v", err)
+	}
+	defer vtv.Close()
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	ctx := context.Background()
+	tv := vtv.TV()
+	if err := renderer.StreamVideo(ctx, tv, "http://example.com/live.m3u8", "Live"); err != nil {
+		t.Fatalf("StreamVideo failed: %v", err)
+	}
+	if uri, contentType := vtv.Media(); uri != "http://example.com/live.m3u8" || contentType != "application/x-mpegURL" {
+		t.Errorf("Unexpected media %q (%s)", uri, contentType)
+	}
+
+	resp, err := http.Get(vtv.URL() + "events")
+	if err != nil {
+		t.Fatalf("GET events failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Read event failed: %v", err)
+	}
+	if !strings.Contains(line, `"uri":"http://example.com/live.m3u8"`) {
+		t.Errorf("Expected the current media in the first event, got %q", line)
+	}
+	if vtv.Frame() != nil {
+		t.Error("Expected no frame rendered by the virtual TV itself")
+	}
+}
@@ -0,0 +1,48 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// defaultRenderingControlType is used for TVs whose RenderingControl
+// service type is unknown
+const defaultRenderingControlType = "urn:schemas-upnp-org:service:RenderingControl:1"
+
+// volumeCall sends a RenderingControl action
+func (tv *TV) volumeCall(ctx context.Context, action string, args string) (map[string]string, error) {
+	if tv.VolumeControlURL == "" {
+		return nil, tv.wrapError(action, "", ErrUnsupportedAction)
+	}
+	serviceType := tv.VolumeServiceType
+	if serviceType == "" {
+		serviceType = defaultRenderingControlType
+	}
+	return tv.sendServiceSOAP(ctx, tv.VolumeControlURL, serviceType, action, serviceEnvelope(serviceType, action, args))
+}
+
+// GetVolume returns the TV's volume (usually 0-100). TVs without a
+// RenderingControl service fail with ErrUnsupportedAction.
+func (tv *TV) GetVolume(ctx context.Context) (int, error) {
+	out, err := tv.volumeCall(ctx, "GetVolume", `
+      <InstanceID>0</InstanceID>
+      <Channel>Master</Channel>`)
+	if err != nil {
+		return 0, err
+	}
+	volume, err := strconv.Atoi(out["CurrentVolume"])
+	if err != nil {
+		return 0, fmt.Errorf("GetVolume: bad volume %q", out["CurrentVolume"])
+	}
+	return volume, nil
+}
+
+// SetVolume sets the TV's volume (usually 0-100)
+func (tv *TV) SetVolume(ctx context.Context, volume int) error {
+	_, err := tv.volumeCall(ctx, "SetVolume", fmt.Sprintf(`
+      <InstanceID>0</InstanceID>
+      <Channel>Master</Channel>
+      <DesiredVolume>%d</DesiredVolume>`, max(volume, 0)))
+	return err
+}
@@ -0,0 +1,165 @@
+package nimsforestsmarttv
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// watchedExtensions are the file types a FolderWatcher displays
+var watchedExtensions = []string{
+	".jpg", ".jpeg", ".png", ".gif",
+	".heic", ".heif", ".avif",
+	".cr2", ".nef", ".arw", ".dng", ".tif", ".tiff",
+}
+
+// fileStamp identifies one version of a file
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// FolderWatcher displays images dropped into a directory, e.g. a network
+// share, on a group of TVs. The directory is polled rather than watched
+// with OS notifications, which network shares don't deliver reliably.
+// Files are displayed once they stopped changing for one interval, so
+// half-copied images are never sent. It is safe for concurrent use.
+type FolderWatcher struct {
+	renderer *Renderer
+	dir      string
+	tvs      []*TV
+	interval time.Duration
+
+	mu        sync.Mutex
+	seen      map[string]fileStamp // Versions handled (or present at start)
+	changed   map[string]fileStamp // Versions waiting to settle
+	started   bool
+	listeners []func(path string, err error)
+}
+
+// NewFolderWatcher creates a watcher showing new images in dir on tvs,
+// polling every interval (default 1s). Images already in dir when the
+// watcher starts are not shown; overwriting one shows it again.
+func NewFolderWatcher(renderer *Renderer, dir string, tvs []*TV, interval time.Duration) *FolderWatcher {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &FolderWatcher{
+		renderer: renderer,
+		dir:      dir,
+		tvs:      tvs,
+		interval: interval,
+		seen:     make(map[string]fileStamp),
+		changed:  make(map[string]fileStamp),
+	}
+}
+
+// OnDisplay registers fn to be called after each image was sent to the
+// TVs, with the error if it failed. fn runs on the watcher's goroutine and
+// should not block.
+func (w *FolderWatcher) OnDisplay(fn func(path string, err error)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.listeners = append(w.listeners, fn)
+}
+
+// Run polls the directory every interval until ctx is done. It fails only
+// if the directory can't be read on the first poll.
+func (w *FolderWatcher) Run(ctx context.Context) error {
+	if err := w.Poll(ctx); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		// A share that is briefly unavailable is retried on the next tick
+		w.Poll(ctx)
+	}
+}
+
+// Poll scans the directory once and displays the newest image that
+// settled since the last poll. Several images settling at once only show
+// the newest, as each would replace the one before.
+func (w *FolderWatcher) Poll(ctx context.Context) error {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	present := make(map[string]bool, len(entries))
+	var newest string
+	var newestStamp fileStamp
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !watchable(name) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		present[name] = true
+		stamp := fileStamp{size: info.Size(), modTime: info.ModTime()}
+
+		switch {
+		case !w.started || w.seen[name] == stamp:
+			w.seen[name] = stamp
+		case w.changed[name] == stamp:
+			// Unchanged for one interval: the copy is complete
+			w.seen[name] = stamp
+			delete(w.changed, name)
+			if newest == "" || stamp.modTime.After(newestStamp.modTime) {
+				newest, newestStamp = name, stamp
+			}
+		default:
+			w.changed[name] = stamp
+		}
+	}
+	for name := range w.seen {
+		if !present[name] {
+			delete(w.seen, name)
+		}
+	}
+	for name := range w.changed {
+		if !present[name] {
+			delete(w.changed, name)
+		}
+	}
+	w.started = true
+	listeners := slices.Clone(w.listeners)
+	w.mu.Unlock()
+
+	if newest == "" {
+		return nil
+	}
+
+	path := filepath.Join(w.dir, newest)
+	err = w.renderer.Broadcast(ctx, w.tvs, func(ctx context.Context, tv *TV) error {
+		return w.renderer.DisplayImageFile(ctx, tv, path)
+	})
+	for _, fn := range listeners {
+		fn(path, err)
+	}
+	return nil
+}
+
+// watchable reports whether a file name looks like a finished image.
+// Hidden files and partial downloads are skipped.
+func watchable(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~") {
+		return false
+	}
+	return slices.Contains(watchedExtensions, strings.ToLower(filepath.Ext(name)))
+}
@@ -0,0 +1,84 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFolderWatcher(t *testing.T) {
+	casts := 0
+	mockTV := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("SOAPAction") == `"urn:schemas-upnp-org:service:AVTransport:1#SetAVTransportURI"` {
+			casts++
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockTV.Close()
+	tv := &TV{Name: "Test TV", ControlURL: mockTV.URL}
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	dir := t.TempDir()
+	write := func(name string, mod time.Time) {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mod, mod)
+	}
+
+	ctx := context.Background()
+	start := time.Now()
+	write("old.png", start)
+	write("notes.txt", start)
+
+	watcher := NewFolderWatcher(renderer, dir, []*TV{tv}, time.Second)
+	var shown []string
+	watcher.OnDisplay(func(path string, err error) {
+		if err != nil {
+			t.Errorf("display %s: %v", path, err)
+		}
+		shown = append(shown, filepath.Base(path))
+	})
+
+	poll := func() {
+		t.Helper()
+		if err := watcher.Poll(ctx); err != nil {
+			t.Fatalf("Poll failed: %v", err)
+		}
+	}
+
+	poll() // old.png was there before
+	write("a.png", start.Add(time.Second))
+	write("b.png", start.Add(2*time.Second))
+	write(".hidden.png", start.Add(3*time.Second))
+	poll() // not settled yet
+	if len(shown) != 0 {
+		t.Fatalf("shown %v before the files settled", shown)
+	}
+	poll()
+	write("old.png", start.Add(4*time.Second))
+	poll()
+	poll()
+
+	if want := []string{"b.png", "old.png"}; len(shown) != 2 || shown[0] != want[0] || shown[1] != want[1] {
+		t.Errorf("shown %v, want %v", shown, want)
+	}
+	if casts != 2 {
+		t.Errorf("TV cast %d times, want 2", casts)
+	}
+}
@@ -0,0 +1,496 @@
+// Package webos controls LG webOS TVs through their SSAP WebSocket API,
+// which they need for anything beyond DLNA: remote keys, text input and
+// apps. The TV only accepts a remote after the user allowed it on the TV,
+// so pairing hands out a client key to keep.
+package webos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	smarttv "github.com/nimsforest/nimsforestsmarttv"
+	"github.com/nimsforest/nimsforestsmarttv/internal/websocket"
+)
+
+// Backend names the credentials of webOS TVs in a Registry
+const Backend = "webos"
+
+// Ports of the API: TLS on securePort, which recent models require, and
+// plain on apiPort for older ones
+var (
+	securePort = 3001
+	apiPort    = 3000
+)
+
+// promptDelay is how long pairing waits for the TV to accept a remote it
+// already knows before asking the user to allow it
+var promptDelay = 500 * time.Millisecond
+
+// errConnClosed is returned when the TV drops the connection mid-request
+var errConnClosed = errors.New("connection closed by TV")
+
+// registerID is the ID of the register request opening every connection
+const registerID = "register_0"
+
+// permissions are what the remote asks the user to allow
+var permissions = []string{
+	"LAUNCH",
+	"CONTROL_AUDIO",
+	"CONTROL_POWER",
+	"CONTROL_INPUT_JOYSTICK",
+	"CONTROL_INPUT_TEXT",
+	"CONTROL_MOUSE_AND_KEYBOARD",
+	"READ_INSTALLED_APPS",
+}
+
+// buttons maps keys to buttons of the pointer input socket
+var buttons = map[smarttv.Key]string{
+	smarttv.KeyUp:         "UP",
+	smarttv.KeyDown:       "DOWN",
+	smarttv.KeyLeft:       "LEFT",
+	smarttv.KeyRight:      "RIGHT",
+	smarttv.KeyOK:         "ENTER",
+	smarttv.KeyBack:       "BACK",
+	smarttv.KeyHome:       "HOME",
+	smarttv.KeyPlay:       "PLAY",
+	smarttv.KeyPause:      "PAUSE",
+	smarttv.KeyVolumeUp:   "VOLUMEUP",
+	smarttv.KeyVolumeDown: "VOLUMEDOWN",
+	smarttv.KeyMute:       "MUTE",
+}
+
+// Option configures a Remote
+type Option func(*Remote)
+
+// WithClientKey connects with a client key from an earlier pairing
+func WithClientKey(key string) Option {
+	return func(r *Remote) {
+		r.key = key
+	}
+}
+
+// WithClientKeyFunc calls fn with every new client key the TV hands out,
+// to store it for the next connection. A failing fn fails the connection.
+func WithClientKeyFunc(fn func(key string) error) Option {
+	return func(r *Remote) {
+		r.onKey = fn
+	}
+}
+
+// message is a message from the TV
+type message struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id"`
+	Error   string          `json:"error"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Remote controls an LG TV over its SSAP API. It connects on the first
+// command and reconnects after the TV dropped the connection, e.g. while
+// it was off. It implements smarttv.RemoteControl and is safe for
+// concurrent use.
+type Remote struct {
+	host  string
+	onKey func(key string) error
+
+	mu       sync.Mutex
+	key      string
+	conn     *websocket.Conn
+	messages chan message    // Messages of conn, closed when it drops
+	pointer  *websocket.Conn // Pointer input socket for buttons
+	pointed  chan struct{}   // Closed when pointer drops
+	lastID   int
+}
+
+// NewRemote returns a remote for the TV at host (an IP or host name)
+func NewRemote(host string, opts ...Option) *Remote {
+	r := &Remote{host: host}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Connect connects to the TV unless already connected. The first
+// connection of a new remote waits until the user allowed it on the TV;
+// ErrPairingRejected means they didn't.
+func (r *Remote) Connect(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.connect(ctx)
+}
+
+// ClientKey returns the client key the TV handed out
+func (r *Remote) ClientKey() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.key
+}
+
+// SendKey presses a key. Besides the common keys, webOS button names can
+// be given directly in upper case (e.g. "INFO" or "RED"). KeyPower turns
+// the TV off; webOS TVs can't be turned on over the network.
+func (r *Remote) SendKey(ctx context.Context, key smarttv.Key) error {
+	if key == smarttv.KeyPower {
+		_, err := r.request(ctx, "ssap://system/turnOff", nil)
+		return err
+	}
+
+	button, ok := buttons[key]
+	if !ok {
+		if button = string(key); button == "" || button != strings.ToUpper(button) {
+			return fmt.Errorf("key %q: %w", key, smarttv.ErrUnsupportedAction)
+		}
+	}
+	data := []byte("type:button\nname:" + button + "\n\n")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pointer != nil && (closed(r.pointed) || !drain(r.messages)) {
+		r.disconnect()
+	}
+	if err := r.openPointer(ctx); err != nil {
+		return err
+	}
+	if r.pointer.WriteText(data) != nil {
+		// The socket dies with the main connection, e.g. while the TV was off
+		r.disconnect()
+		if err := r.openPointer(ctx); err != nil {
+			return err
+		}
+		if err := r.pointer.WriteText(data); err != nil {
+			return fmt.Errorf("send: %w", err)
+		}
+	}
+	return nil
+}
+
+// LaunchApp starts the app with the given ID (e.g. "youtube.leanback.v4"
+// or "netflix")
+func (r *Remote) LaunchApp(ctx context.Context, appID string) error {
+	_, err := r.request(ctx, "ssap://system.launcher/launch", map[string]string{"id": appID})
+	return err
+}
+
+// TypeText inserts s into the text field the TV's on-screen keyboard is
+// open for
+func (r *Remote) TypeText(ctx context.Context, s string) error {
+	_, err := r.request(ctx, "ssap://com.webos.service.ime/insertText", map[string]any{"text": s, "replace": false})
+	return err
+}
+
+// Close closes the connection to the TV
+func (r *Remote) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.disconnect()
+}
+
+// request calls uri with payload and returns the payload of the answer.
+// A connection the TV dropped is reopened once.
+func (r *Remote) request(ctx context.Context, uri string, payload any) (json.RawMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.call(ctx, uri, payload)
+}
+
+// call is request with r.mu held
+func (r *Remote) call(ctx context.Context, uri string, payload any) (json.RawMessage, error) {
+	r.lastID++
+	id := strconv.Itoa(r.lastID)
+	msg := map[string]any{"type": "request", "id": id, "uri": uri}
+	if payload != nil {
+		msg["payload"] = payload
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.connect(ctx); err != nil {
+		return nil, err
+	}
+	if !drain(r.messages) || r.conn.WriteText(data) != nil {
+		r.disconnect()
+		if err := r.connect(ctx); err != nil {
+			return nil, err
+		}
+		if err := r.conn.WriteText(data); err != nil {
+			r.disconnect()
+			return nil, fmt.Errorf("send: %w", err)
+		}
+	}
+
+	m, err := waitMessage(ctx, r.messages, id)
+	if errors.Is(err, errConnClosed) {
+		r.disconnect()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		ReturnValue *bool  `json:"returnValue"`
+		ErrorText   string `json:"errorText"`
+	}
+	json.Unmarshal(m.Payload, &result)
+	if result.ReturnValue != nil && !*result.ReturnValue {
+		return nil, fmt.Errorf("TV error: %s", result.ErrorText)
+	}
+	return m.Payload, nil
+}
+
+// openPointer opens the pointer input socket buttons are sent on, if it
+// isn't open; r.mu must be held
+func (r *Remote) openPointer(ctx context.Context) error {
+	if r.pointer != nil {
+		return nil
+	}
+
+	payload, err := r.call(ctx, "ssap://com.webos.service.networkinput/getPointerInputSocket", nil)
+	if err != nil {
+		return err
+	}
+	var socket struct {
+		Path string `json:"socketPath"`
+	}
+	if err := json.Unmarshal(payload, &socket); err != nil || socket.Path == "" {
+		return errors.New("TV has no pointer input socket")
+	}
+
+	conn, err := websocket.Dial(ctx, socket.Path)
+	if err != nil {
+		return fmt.Errorf("pointer input socket: %w", err)
+	}
+	// Nothing is expected on it, but pings have to be answered
+	pointed := make(chan struct{})
+	go func() {
+		defer close(pointed)
+		for {
+			if _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	r.pointer, r.pointed = conn, pointed
+	return nil
+}
+
+// connect opens the connection and registers the remote if there is no
+// connection; r.mu must be held
+func (r *Remote) connect(ctx context.Context) error {
+	if r.conn != nil {
+		return nil
+	}
+
+	// Older models only serve the plain port
+	conn, err := websocket.Dial(ctx, "wss://"+net.JoinHostPort(r.host, strconv.Itoa(securePort))+"/")
+	if err != nil && ctx.Err() == nil {
+		conn, err = websocket.Dial(ctx, "ws://"+net.JoinHostPort(r.host, strconv.Itoa(apiPort))+"/")
+	}
+	if err != nil {
+		return err
+	}
+	messages := make(chan message, 16)
+	go readMessages(conn, messages)
+
+	register := map[string]any{
+		"pairingType": "PROMPT",
+		"manifest": map[string]any{
+			"manifestVersion": 1,
+			"appVersion":      "1.0",
+			"permissions":     permissions,
+		},
+	}
+	if r.key != "" {
+		register["client-key"] = r.key
+	}
+	data, _ := json.Marshal(map[string]any{"type": "register", "id": registerID, "payload": register})
+	if err := conn.WriteText(data); err != nil {
+		conn.Close()
+		return fmt.Errorf("register: %w", err)
+	}
+
+	// The TV answers once the remote is allowed
+	m, err := waitMessage(ctx, messages, registerID)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	var registered struct {
+		ClientKey string `json:"client-key"`
+	}
+	json.Unmarshal(m.Payload, &registered)
+	if registered.ClientKey != "" && registered.ClientKey != r.key {
+		if r.onKey != nil {
+			if err := r.onKey(registered.ClientKey); err != nil {
+				conn.Close()
+				return fmt.Errorf("save client key: %w", err)
+			}
+		}
+		r.key = registered.ClientKey
+	}
+
+	r.conn, r.messages = conn, messages
+	return nil
+}
+
+// disconnect closes the connections, if any; r.mu must be held
+func (r *Remote) disconnect() error {
+	if r.pointer != nil {
+		r.pointer.Close()
+		r.pointer, r.pointed = nil, nil
+	}
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn, r.messages = nil, nil
+	return err
+}
+
+// readMessages passes the messages of conn on until it is closed.
+// Messages nobody waits for are dropped once the buffer is full.
+func readMessages(conn *websocket.Conn, messages chan<- message) {
+	defer close(messages)
+	for {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var m message
+		if json.Unmarshal(data, &m) != nil {
+			continue
+		}
+		select {
+		case messages <- m:
+		default:
+		}
+	}
+}
+
+// drain discards stale messages and reports whether the connection is open
+func drain(messages chan message) bool {
+	for {
+		select {
+		case _, ok := <-messages:
+			if !ok {
+				return false
+			}
+		default:
+			return true
+		}
+	}
+}
+
+// closed reports whether ch is closed
+func closed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitMessage waits for the answer to the request with the given ID. The
+// register request is answered by "registered" once the user allowed the
+// remote, after a response saying the TV is asking.
+func waitMessage(ctx context.Context, messages <-chan message, id string) (message, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return message{}, ctx.Err()
+		case m, ok := <-messages:
+			if !ok {
+				return message{}, errConnClosed
+			}
+			if m.ID != id {
+				continue
+			}
+			switch {
+			case m.Type == "error" && id == registerID:
+				return message{}, fmt.Errorf("%w: %s", smarttv.ErrPairingRejected, m.Error)
+			case m.Type == "error":
+				return message{}, fmt.Errorf("TV error: %s", m.Error)
+			case id == registerID && m.Type != "registered":
+				continue
+			default:
+				return m, nil
+			}
+		}
+	}
+}
+
+// IsWebOS reports whether tv is made by LG, whose smart TVs run webOS
+func IsWebOS(tv *smarttv.TV) bool {
+	return strings.HasPrefix(strings.ToLower(tv.Manufacturer), "lg")
+}
+
+// Pairer pairs with webOS TVs for Registry.Pair: the TV asks the user to
+// allow the remote and then hands out the client key stored as "client-key"
+type Pairer struct{}
+
+// Backend returns "webos"
+func (p Pairer) Backend() string {
+	return Backend
+}
+
+// Pair connects to the TV, asking the user to allow the remote there
+func (p Pairer) Pair(ctx context.Context, tv *smarttv.TV, prompt smarttv.PromptFunc) (smarttv.Credentials, error) {
+	r := NewRemote(tv.IP)
+	defer r.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- r.Connect(ctx) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+	case <-time.After(promptDelay):
+		message := fmt.Sprintf("Allow the remote on %s with the TV remote", tv.Name)
+		if _, err := prompt(ctx, smarttv.Prompt{Kind: smarttv.PromptConfirm, TV: tv, Message: message}); err != nil {
+			return nil, err
+		}
+		if err := <-done; err != nil {
+			return nil, err
+		}
+	}
+	return smarttv.Credentials{"client-key": r.ClientKey()}, nil
+}
+
+// Attach sets tv.Remote to a Remote for the TV if it is an LG TV, so
+// tv.SendKey and tv.LaunchApp go through the SSAP API. The client key is
+// taken from reg, pairing first if there is none, and keys the TV hands
+// out later are saved there. It reports whether tv is an LG TV.
+func Attach(ctx context.Context, reg *smarttv.Registry, tv *smarttv.TV, prompt smarttv.PromptFunc, opts ...Option) (bool, error) {
+	if !IsWebOS(tv) {
+		return false, nil
+	}
+
+	r := NewRemote(tv.IP, opts...)
+	creds, err := reg.Pair(ctx, tv, Pairer{}, prompt)
+	if err != nil {
+		return true, err
+	}
+	r.key = creds["client-key"]
+	r.onKey = func(key string) error {
+		if err := reg.SetCredentials(tv, Backend, smarttv.Credentials{"client-key": key}); err != nil {
+			return err
+		}
+		return reg.Save()
+	}
+	tv.Remote = r
+	return true, nil
+}
@@ -0,0 +1,321 @@
+package webos
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	smarttv "github.com/nimsforest/nimsforestsmarttv"
+	"github.com/nimsforest/nimsforestsmarttv/internal/websocket"
+)
+
+// mockTV is an LG TV serving its API on 127.0.0.1
+type mockTV struct {
+	allow  chan struct{} // Closed when the user allows the remote
+	server *httptest.Server
+
+	mu       sync.Mutex
+	reject   bool
+	keys     []string // Client key of every connection
+	messages []string // URI of every request and every button pressed
+	conns    []net.Conn
+}
+
+// newMockTV starts a mock TV on the TLS port, or on the plain port with
+// the TLS port closed
+func newMockTV(t *testing.T, plain bool) *mockTV {
+	m := &mockTV{allow: make(chan struct{})}
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	savedAPI, savedSecure := apiPort, securePort
+	if plain {
+		m.server = httptest.NewServer(http.HandlerFunc(m.serve))
+		apiPort, securePort = port(m.server.URL), port(closed.URL)
+	} else {
+		m.server = httptest.NewTLSServer(http.HandlerFunc(m.serve))
+		securePort = port(m.server.URL)
+	}
+	t.Cleanup(func() {
+		apiPort, securePort = savedAPI, savedSecure
+		m.dropAll()
+		m.server.Close()
+	})
+	return m
+}
+
+func port(rawURL string) int {
+	u, _ := url.Parse(rawURL)
+	p, _ := strconv.Atoi(u.Port())
+	return p
+}
+
+// accept completes the WebSocket handshake
+func accept(w http.ResponseWriter, r *http.Request) (net.Conn, *websocket.Conn, error) {
+	sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + websocket.GUID))
+	conn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	rw.Flush()
+	return conn, websocket.NewConn(conn, rw.Reader), nil
+}
+
+func (m *mockTV) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Upgrade") != "websocket" {
+		http.NotFound(w, r)
+		return
+	}
+	conn, ws, err := accept(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	m.mu.Lock()
+	m.conns = append(m.conns, conn)
+	m.mu.Unlock()
+
+	if r.URL.Path == "/pointer" {
+		for {
+			data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			name := strings.TrimPrefix(strings.Split(string(data), "\n")[1], "name:")
+			m.mu.Lock()
+			m.messages = append(m.messages, "button "+name)
+			m.mu.Unlock()
+		}
+	}
+
+	send := func(v any) {
+		data, _ := json.Marshal(v)
+		ws.WriteText(data)
+	}
+	for {
+		data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg struct {
+			Type    string `json:"type"`
+			ID      string `json:"id"`
+			URI     string `json:"uri"`
+			Payload struct {
+				ClientKey string `json:"client-key"`
+				AppID     string `json:"id"`
+				Text      string `json:"text"`
+			} `json:"payload"`
+		}
+		json.Unmarshal(data, &msg)
+
+		if msg.Type == "register" {
+			m.mu.Lock()
+			m.keys = append(m.keys, msg.Payload.ClientKey)
+			reject := m.reject
+			m.mu.Unlock()
+
+			key := msg.Payload.ClientKey
+			switch {
+			case reject:
+				send(map[string]any{"type": "error", "id": msg.ID, "error": "403 User denied access"})
+				return
+			case key == "":
+				send(map[string]any{"type": "response", "id": msg.ID, "payload": map[string]any{"pairingType": "PROMPT", "returnValue": true}})
+				select {
+				case <-m.allow:
+				case <-time.After(5 * time.Second):
+					return
+				}
+				key = "key-1"
+			}
+			send(map[string]any{"type": "registered", "id": msg.ID, "payload": map[string]string{"client-key": key}})
+			continue
+		}
+
+		m.mu.Lock()
+		m.messages = append(m.messages, strings.TrimSpace(strings.TrimPrefix(msg.URI, "ssap://")+" "+msg.Payload.AppID+msg.Payload.Text))
+		m.mu.Unlock()
+
+		payload := map[string]any{"returnValue": true}
+		switch {
+		case strings.HasSuffix(msg.URI, "/getPointerInputSocket"):
+			scheme := "wss"
+			if m.server.TLS == nil {
+				scheme = "ws"
+			}
+			payload["socketPath"] = scheme + "://" + m.server.Listener.Addr().String() + "/pointer"
+		case msg.Payload.AppID == "missing":
+			payload = map[string]any{"returnValue": false, "errorText": "app not found"}
+		}
+		send(map[string]any{"type": "response", "id": msg.ID, "payload": payload})
+	}
+}
+
+// dropAll closes every connection, as a TV does when turned off
+func (m *mockTV) dropAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, conn := range m.conns {
+		conn.Close()
+	}
+	m.conns = nil
+}
+
+// waitMessages waits until the TV has read n messages; buttons are sent
+// without waiting for an answer
+func (m *mockTV) waitMessages(n int) {
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		m.mu.Lock()
+		got := len(m.messages)
+		m.mu.Unlock()
+		if got >= n {
+			return
+		}
+	}
+}
+
+func (m *mockTV) state() (keys, messages []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.keys), slices.Clone(m.messages)
+}
+
+// TestAttach tests pairing through the registry, keys, text and apps on an
+// attached TV, and connecting with the stored client key later
+func TestAttach(t *testing.T) {
+	mock := newMockTV(t, false)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reg, err := smarttv.LoadRegistry(filepath.Join(t.TempDir(), "registry.json"))
+	if err != nil {
+		t.Fatalf("LoadRegistry failed: %v", err)
+	}
+	tv := &smarttv.TV{Name: "Living Room", IP: "127.0.0.1", UDN: "uuid:lg", Manufacturer: "LG Electronics"}
+
+	prompts := 0
+	prompt := func(ctx context.Context, p smarttv.Prompt) (string, error) {
+		prompts++
+		if p.Kind != smarttv.PromptConfirm || !strings.Contains(p.Message, "Living Room") {
+			t.Errorf("Unexpected prompt: %+v", p)
+		}
+		close(mock.allow)
+		return "", nil
+	}
+	ok, err := Attach(ctx, reg, tv, prompt)
+	if !ok || err != nil {
+		t.Fatalf("Attach = %v, %v", ok, err)
+	}
+	if prompts != 1 {
+		t.Errorf("Expected 1 prompt, got %d", prompts)
+	}
+	if creds, err := reg.Credentials(tv, Backend); err != nil || creds["client-key"] != "key-1" {
+		t.Errorf("Stored credentials = %v, %v", creds, err)
+	}
+
+	if err := tv.SendKey(ctx, smarttv.KeyVolumeUp); err != nil {
+		t.Fatalf("SendKey failed: %v", err)
+	}
+	if err := tv.SendKey(ctx, "INFO"); err != nil {
+		t.Fatalf("SendKey of a button name failed: %v", err)
+	}
+	if err := tv.SendKey(ctx, "warp"); !errors.Is(err, smarttv.ErrUnsupportedAction) {
+		t.Errorf("Expected ErrUnsupportedAction for an unknown key, got %v", err)
+	}
+	mock.waitMessages(3)
+	if err := tv.LaunchApp(ctx, "netflix"); err != nil {
+		t.Fatalf("LaunchApp failed: %v", err)
+	}
+	if err := tv.LaunchApp(ctx, "missing"); err == nil || !strings.Contains(err.Error(), "app not found") {
+		t.Errorf("Expected the TV's error for a missing app, got %v", err)
+	}
+	if err := tv.TypeText(ctx, "guest wifi"); err != nil {
+		t.Fatalf("TypeText failed: %v", err)
+	}
+	if err := tv.SendKey(ctx, smarttv.KeyPower); err != nil {
+		t.Fatalf("SendKey of the power key failed: %v", err)
+	}
+	tv.Remote.(*Remote).Close()
+
+	// Later sessions connect with the stored client key without asking
+	again := &smarttv.TV{Name: "Living Room", IP: "127.0.0.1", UDN: "uuid:lg", Manufacturer: "LG Electronics"}
+	if _, err := Attach(ctx, reg, again, prompt); err != nil {
+		t.Fatalf("Second Attach failed: %v", err)
+	}
+	if err := again.SendKey(ctx, smarttv.KeyHome); err != nil {
+		t.Fatalf("SendKey failed: %v", err)
+	}
+	mock.waitMessages(10)
+	again.Remote.(*Remote).Close()
+
+	keys, messages := mock.state()
+	// Pairing, the attached remote, the second remote
+	if strings.Join(keys, ",") != ",key-1,key-1" {
+		t.Errorf("Connected with client keys %q", keys)
+	}
+	want := "com.webos.service.networkinput/getPointerInputSocket,button VOLUMEUP,button INFO," +
+		"system.launcher/launch netflix,system.launcher/launch missing,com.webos.service.ime/insertText guest wifi,system/turnOff," +
+		"com.webos.service.networkinput/getPointerInputSocket,button HOME"
+	if strings.Join(messages, ",") != want {
+		t.Errorf("Messages = %s, want %s", strings.Join(messages, ","), want)
+	}
+
+	other := &smarttv.TV{Name: "Bravia", Manufacturer: "Sony Corporation"}
+	if ok, err := Attach(ctx, reg, other, prompt); ok || err != nil || other.Remote != nil {
+		t.Errorf("Attach of a Sony TV = %v, %v", ok, err)
+	}
+}
+
+func TestPairRejected(t *testing.T) {
+	mock := newMockTV(t, false)
+	mock.reject = true
+
+	tv := &smarttv.TV{Name: "Living Room", IP: "127.0.0.1", Manufacturer: "LG Electronics"}
+	prompt := func(ctx context.Context, p smarttv.Prompt) (string, error) { return "", nil }
+	_, err := Pairer{}.Pair(context.Background(), tv, prompt)
+	if !errors.Is(err, smarttv.ErrPairingRejected) {
+		t.Errorf("Expected ErrPairingRejected, got %v", err)
+	}
+}
+
+// TestReconnect tests that buttons reconnect after the TV dropped the
+// connections, on the plain port of an older model
+func TestReconnect(t *testing.T) {
+	mock := newMockTV(t, true)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	r := NewRemote("127.0.0.1", WithClientKey("key-1"))
+	defer r.Close()
+	if err := r.SendKey(ctx, smarttv.KeyMute); err != nil {
+		t.Fatalf("SendKey failed: %v", err)
+	}
+	mock.waitMessages(2)
+	mock.dropAll()
+	time.Sleep(50 * time.Millisecond)
+
+	if err := r.SendKey(ctx, smarttv.KeyMute); err != nil {
+		t.Fatalf("SendKey after the TV dropped the connection failed: %v", err)
+	}
+	mock.waitMessages(4)
+	if keys, messages := mock.state(); len(keys) != 2 || len(messages) != 4 {
+		t.Errorf("Expected 2 connections and 2 buttons, got %q and %q", keys, messages)
+	}
+}
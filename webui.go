@@ -0,0 +1,298 @@
+package nimsforestsmarttv
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"image/jpeg"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//go:embed webui
+var webUIFiles embed.FS
+
+// maxWebUIRequest limits the JSON bodies of web UI API calls
+const maxWebUIRequest = 64 << 10
+
+// WebUI is a small mobile-friendly web app for the household: it lists the
+// registry's TVs and sends text, photos and URLs to them or stops them. It
+// is an http.Handler serving the app at / and its JSON API under /api/,
+// with the role each call needs:
+//
+//	GET    /api/me                   viewer    the caller's name and role
+//	GET    /api/tvs                  viewer    the TVs, sorted by name
+//	GET    /api/tvs/{tv}/state       viewer    {"state": "PLAYING"}
+//	GET    /api/tvs/{tv}/screenshot  viewer    the last frame shown, as JPEG
+//	POST   /api/tvs/{tv}/text        operator  {"text": "Dinner is ready"}
+//	POST   /api/tvs/{tv}/photo       operator  an image, raw or multipart
+//	POST   /api/tvs/{tv}/cast        operator  {"url": "http://..."}
+//	POST   /api/tvs/{tv}/stop        operator
+//	GET    /api/zones                viewer    the zones and their members
+//	PUT    /api/zones/{zone}         admin     {"members": [...], "time_zone": "..."}
+//	DELETE /api/zones/{zone}         admin
+//
+// {tv} is a TV's slug, name or UDN. Errors are answered as {"error": "..."}.
+// Callers are told apart by token, see WithWebUIUsers. Browsers may only
+// change things from the app's own origin, so web pages a household member
+// opens can't send commands to the TVs.
+type WebUI struct {
+	renderer *Renderer
+	reg      *Registry
+	cfg      webUIConfig
+	mux      *http.ServeMux
+	handler  http.Handler // mux behind the cross-origin check
+}
+
+// WebUITV is a TV as listed by the web UI API
+type WebUITV struct {
+	Slug     string `json:"slug"`
+	Name     string `json:"name"`
+	Model    string `json:"model,omitempty"`
+	Protocol string `json:"protocol"`
+	IP       string `json:"ip,omitempty"`
+}
+
+// NewWebUI creates the web UI for the TVs of reg, driven by renderer.
+// Zones changed through it are saved to reg.
+func NewWebUI(renderer *Renderer, reg *Registry, opts ...WebUIOption) *WebUI {
+	ui := &WebUI{renderer: renderer, reg: reg, mux: http.NewServeMux()}
+	for _, opt := range opts {
+		opt(&ui.cfg)
+	}
+
+	static, _ := fs.Sub(webUIFiles, "webui")
+	ui.mux.Handle("GET /", http.FileServerFS(static))
+	ui.handle("GET /api/me", RoleViewer, ui.handleMe)
+	ui.handle("GET /api/tvs", RoleViewer, ui.handleTVs)
+	ui.handle("GET /api/tvs/{tv}/state", RoleViewer, ui.handleState)
+	ui.handle("GET /api/tvs/{tv}/screenshot", RoleViewer, ui.handleScreenshot)
+	ui.handle("POST /api/tvs/{tv}/text", RoleOperator, ui.handleText)
+	ui.handle("POST /api/tvs/{tv}/photo", RoleOperator, ui.handlePhoto)
+	ui.handle("POST /api/tvs/{tv}/cast", RoleOperator, ui.handleCast)
+	ui.handle("POST /api/tvs/{tv}/stop", RoleOperator, ui.handleStop)
+	ui.handle("GET /api/zones", RoleViewer, ui.handleZones)
+	ui.handle("PUT /api/zones/{zone}", RoleAdmin, ui.handleSetZone)
+	ui.handle("DELETE /api/zones/{zone}", RoleAdmin, ui.handleRemoveZone)
+
+	csrf := http.NewCrossOriginProtection()
+	csrf.SetDenyHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSONError(w, http.StatusForbidden, "cross-origin request refused")
+	}))
+	ui.handler = csrf.Handler(ui.mux)
+	return ui
+}
+
+// handle registers an API call that needs role. Its commands are sent in a
+// "webui" session owned by the user, so journals and audit trails tell who
+// sent them.
+func (ui *WebUI) handle(pattern string, role Role, h http.HandlerFunc) {
+	ui.mux.HandleFunc(pattern, ui.cfg.authorize(role, func(w http.ResponseWriter, r *http.Request) {
+		user := webUIUserFrom(r.Context())
+		h(w, r.WithContext(WithSession(r.Context(), Session{Name: "webui", Owner: user.Name})))
+	}))
+}
+
+func (ui *WebUI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ui.handler.ServeHTTP(w, r)
+}
+
+func (ui *WebUI) handleMe(w http.ResponseWriter, r *http.Request) {
+	user := webUIUserFrom(r.Context())
+	writeJSON(w, http.StatusOK, map[string]string{"name": user.Name, "role": string(user.Role)})
+}
+
+func (ui *WebUI) handleTVs(w http.ResponseWriter, r *http.Request) {
+	tvs := ui.reg.TVs()
+	list := make([]WebUITV, len(tvs))
+	for i, tv := range tvs {
+		protocol := tv.Protocol
+		if protocol == ProtocolDLNA {
+			protocol = "dlna"
+		}
+		list[i] = WebUITV{Slug: tv.Slug, Name: tv.Name, Model: tv.ModelName, Protocol: protocol, IP: tv.IP}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (ui *WebUI) handleState(w http.ResponseWriter, r *http.Request) {
+	tv, ok := ui.lookup(w, r)
+	if !ok {
+		return
+	}
+	info, err := tv.GetTransportInfo(r.Context())
+	if err != nil {
+		writeJSONError(w, webUIStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"state": info.State})
+}
+
+func (ui *WebUI) handleScreenshot(w http.ResponseWriter, r *http.Request) {
+	tv, ok := ui.lookup(w, r)
+	if !ok {
+		return
+	}
+	img, err := ui.renderer.Thumbnail(tv, 640, 360)
+	if err != nil {
+		writeJSONError(w, webUIStatus(err), err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "no-store")
+	jpeg.Encode(w, img, &jpeg.Options{Quality: 80})
+}
+
+func (ui *WebUI) handleText(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Text string `json:"text"`
+	}
+	ui.run(w, r, &req, func(tv *TV) error {
+		if strings.TrimSpace(req.Text) == "" {
+			return ErrEmptyContent
+		}
+		return ui.renderer.DisplayText(r.Context(), tv, req.Text)
+	})
+}
+
+func (ui *WebUI) handlePhoto(w http.ResponseWriter, r *http.Request) {
+	ui.run(w, r, nil, func(tv *TV) error {
+		data, contentType, err := ImageFromRequest(r)
+		if err != nil {
+			return err
+		}
+		return ui.renderer.DisplayImageData(r.Context(), tv, data, contentType)
+	})
+}
+
+func (ui *WebUI) handleCast(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL string `json:"url"`
+	}
+	ui.run(w, r, &req, func(tv *TV) error {
+		if req.URL == "" {
+			return ErrEmptyContent
+		}
+		if strings.HasPrefix(guessContentType(req.URL), "image/") {
+			return ui.renderer.DisplayImageURL(r.Context(), tv, req.URL)
+		}
+		return ui.renderer.StreamVideo(r.Context(), tv, req.URL, "")
+	})
+}
+
+func (ui *WebUI) handleStop(w http.ResponseWriter, r *http.Request) {
+	ui.run(w, r, nil, func(tv *TV) error {
+		return ui.renderer.Stop(r.Context(), tv)
+	})
+}
+
+func (ui *WebUI) handleZones(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, ui.reg.Zones())
+}
+
+func (ui *WebUI) handleSetZone(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Members  []string `json:"members"`
+		TimeZone string   `json:"time_zone"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	name := r.PathValue("zone")
+	if len(req.Members) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "zone "+name+" has no members")
+		return
+	}
+	if _, err := time.LoadLocation(req.TimeZone); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ui.reg.SetZone(name, req.Members...)
+	if req.TimeZone != "" {
+		ui.reg.SetZoneTimeZone(name, req.TimeZone)
+	}
+	ui.save(w)
+}
+
+func (ui *WebUI) handleRemoveZone(w http.ResponseWriter, r *http.Request) {
+	ui.reg.RemoveZone(r.PathValue("zone"))
+	ui.save(w)
+}
+
+// save saves the registry and answers with the outcome
+func (ui *WebUI) save(w http.ResponseWriter) {
+	if err := ui.reg.Save(); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// run looks up the TV of the request, decodes its JSON body into req (if
+// not nil) and answers with the outcome of fn
+func (ui *WebUI) run(w http.ResponseWriter, r *http.Request, req any, fn func(tv *TV) error) {
+	tv, ok := ui.lookup(w, r)
+	if !ok {
+		return
+	}
+	if req != nil && !decodeJSON(w, r, req) {
+		return
+	}
+	if err := fn(tv); err != nil {
+		writeJSONError(w, webUIStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// lookup finds the TV of the request, or answers 404
+func (ui *WebUI) lookup(w http.ResponseWriter, r *http.Request) (*TV, bool) {
+	tv, ok := ui.reg.Lookup(r.PathValue("tv"))
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "unknown TV "+r.PathValue("tv"))
+	}
+	return tv, ok
+}
+
+// decodeJSON decodes the request body into v, or answers 400
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxWebUIRequest)).Decode(v); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// webUIStatus is the HTTP status for a failed command
+func webUIStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrEmptyContent):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrImageTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrNotImage), errors.Is(err, ErrUnsupportedImage):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrURLNotAllowed):
+		return http.StatusForbidden
+	case errors.Is(err, ErrTVBusy):
+		return http.StatusConflict
+	case errors.Is(err, ErrNoThumbnail):
+		return http.StatusNotFound
+	case errors.Is(err, ErrUnsupportedAction):
+		return http.StatusNotImplemented
+	}
+	return http.StatusBadGateway // The TV failed
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,117 @@
+"use strict";
+
+const tvSelect = document.getElementById("tv");
+const statusLine = document.getElementById("status");
+const preview = document.getElementById("preview");
+const roles = ["viewer", "operator", "admin"];
+
+function setStatus(message, isError) {
+  statusLine.textContent = message;
+  statusLine.className = isError ? "error" : "";
+}
+
+// api calls the API with the saved token, asking for one when the daemon
+// doesn't know the caller
+async function api(path, options = {}) {
+  for (;;) {
+    const headers = { ...options.headers };
+    const token = localStorage.getItem("token");
+    if (token) {
+      headers.Authorization = `Bearer ${token}`;
+    }
+    const resp = await fetch(`api/${path}`, { ...options, headers });
+    if (resp.status !== 401) {
+      return resp;
+    }
+    const entered = prompt("Token");
+    if (!entered) {
+      throw new Error("Not signed in");
+    }
+    localStorage.setItem("token", entered);
+  }
+}
+
+// send posts to the API of the selected TV and reports the outcome
+async function send(action, body, contentType) {
+  const tv = tvSelect.value;
+  if (!tv) {
+    setStatus("No TV selected", true);
+    return;
+  }
+  const headers = contentType ? { "Content-Type": contentType } : {};
+  setStatus("Sending…");
+  try {
+    const resp = await api(`tvs/${encodeURIComponent(tv)}/${action}`, { method: "POST", headers, body });
+    const result = await resp.json();
+    if (!resp.ok) {
+      throw new Error(result.error || `HTTP ${resp.status}`);
+    }
+    setStatus("Done");
+    setTimeout(refreshPreview, 1000);
+  } catch (err) {
+    setStatus(err.message, true);
+  }
+}
+
+// refreshPreview shows the last frame sent to the selected TV
+async function refreshPreview() {
+  const tv = tvSelect.value;
+  const resp = tv && await api(`tvs/${encodeURIComponent(tv)}/screenshot`).catch(() => null);
+  if (!resp || !resp.ok) {
+    preview.hidden = true;
+    return;
+  }
+  URL.revokeObjectURL(preview.src);
+  preview.src = URL.createObjectURL(await resp.blob());
+  preview.hidden = false;
+}
+
+async function load() {
+  try {
+    const me = await (await api("me")).json();
+    const rank = roles.indexOf(me.role);
+    document.querySelectorAll("[data-role]").forEach(el => {
+      el.hidden = roles.indexOf(el.dataset.role) > rank;
+    });
+
+    const tvs = await (await api("tvs")).json();
+    tvSelect.replaceChildren(...tvs.map(tv => new Option(tv.name, tv.slug)));
+    const saved = localStorage.getItem("tv");
+    if (tvs.some(tv => tv.slug === saved)) {
+      tvSelect.value = saved;
+    }
+    if (tvs.length === 0) {
+      setStatus("No TVs yet: run smarttv discover", true);
+    }
+    refreshPreview();
+  } catch (err) {
+    setStatus(err.message, true);
+  }
+}
+
+// handle wires a form to an action, disabling it while the TV is busy
+function handle(id, fn) {
+  const form = document.getElementById(id);
+  form.addEventListener("submit", async event => {
+    event.preventDefault();
+    const button = form.querySelector("button");
+    button.disabled = true;
+    await fn(form);
+    button.disabled = false;
+  });
+}
+
+handle("text", form => send("text", JSON.stringify({ text: form.text.value }), "application/json"));
+handle("photo", form => {
+  const data = new FormData();
+  data.append("photo", form.photo.files[0]);
+  return send("photo", data);
+});
+handle("cast", form => send("cast", JSON.stringify({ url: form.url.value }), "application/json"));
+document.getElementById("stop").addEventListener("click", () => send("stop"));
+tvSelect.addEventListener("change", () => {
+  localStorage.setItem("tv", tvSelect.value);
+  refreshPreview();
+});
+
+load();
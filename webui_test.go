@@ -0,0 +1,223 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWebUI(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+	}))
+	defer mock.Close()
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	reg := NewRegistry()
+	reg.AddTV(TV{Name: "Living Room", UDN: "airplay:1", ControlURL: "airplay://" + strings.TrimPrefix(mock.URL, "http://"), Protocol: ProtocolAirPlay, Actions: []string{}})
+	server := httptest.NewServer(NewWebUI(renderer, reg))
+	defer server.Close()
+
+	post := func(path, contentType string, body []byte) (int, string) {
+		t.Helper()
+		resp, err := http.Post(server.URL+path, contentType, bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		var result struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result.Error
+	}
+
+	// The app and the TV list
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("GET / failed: %v", err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), "app.js") {
+		t.Errorf("GET / didn't serve the app: %.100s", page)
+	}
+	resp, err = http.Get(server.URL + "/api/tvs")
+	if err != nil {
+		t.Fatalf("GET /api/tvs failed: %v", err)
+	}
+	var tvs []WebUITV
+	json.NewDecoder(resp.Body).Decode(&tvs)
+	resp.Body.Close()
+	if len(tvs) != 1 || tvs[0].Slug != "living-room" || tvs[0].Protocol != ProtocolAirPlay {
+		t.Errorf("Unexpected TVs: %+v", tvs)
+	}
+
+	// Commands reach the TV
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	part, _ := mw.CreateFormFile("photo", "photo.jpg")
+	part.Write(noisyJPEG(t, 64, 48))
+	mw.Close()
+	for _, c := range []struct {
+		path, contentType string
+		body              []byte
+	}{
+		{"/api/tvs/living-room/text", "application/json", []byte(`{"text": "Dinner is ready"}`)},
+		{"/api/tvs/living-room/photo", mw.FormDataContentType(), form.Bytes()},
+		{"/api/tvs/Living%20Room/cast", "application/json", []byte(`{"url": "http://media/movie.mp4"}`)},
+		{"/api/tvs/living-room/stop", "", nil},
+	} {
+		if status, msg := post(c.path, c.contentType, c.body); status != http.StatusOK {
+			t.Errorf("POST %s = %d %s", c.path, status, msg)
+		}
+	}
+	mu.Lock()
+	if got := strings.Join(requests, ","); got != "PUT /photo,PUT /photo,POST /play,POST /stop" {
+		t.Errorf("TV requests = %s", got)
+	}
+	mu.Unlock()
+
+	// Failures are JSON errors with a fitting status
+	tests := []struct {
+		path, body string
+		status     int
+	}{
+		{"/api/tvs/kitchen/stop", "", http.StatusNotFound},
+		{"/api/tvs/living-room/text", `{"text": " "}`, http.StatusBadRequest},
+		{"/api/tvs/living-room/text", `not json`, http.StatusBadRequest},
+		{"/api/tvs/living-room/photo", "not an image", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		if status, msg := post(tt.path, "application/json", []byte(tt.body)); status != tt.status || msg == "" {
+			t.Errorf("POST %s %q = %d %q, want %d", tt.path, tt.body, status, msg, tt.status)
+		}
+	}
+
+	// Other web pages can't send commands through the household's browsers
+	mu.Lock()
+	requests = nil
+	mu.Unlock()
+	for _, header := range []http.Header{
+		{"Sec-Fetch-Site": {"cross-site"}},
+		{"Origin": {"http://evil.example"}},
+	} {
+		req, _ := http.NewRequest("POST", server.URL+"/api/tvs/living-room/cast", strings.NewReader(`{"url": "http://evil.example/ad.mp4"}`))
+		req.Header = header
+		req.Header.Set("Content-Type", "text/plain")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Cross-origin POST failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Cross-origin POST with %v = %d, want 403", header, resp.StatusCode)
+		}
+	}
+	mu.Lock()
+	if len(requests) > 0 {
+		t.Errorf("Cross-origin requests reached the TV: %v", requests)
+	}
+	mu.Unlock()
+}
+
+func TestWebUIRoles(t *testing.T) {
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer mock.Close()
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	reg := NewRegistry()
+	reg.AddTV(TV{Name: "Lobby", UDN: "airplay:1", ControlURL: "airplay://" + strings.TrimPrefix(mock.URL, "http://"), Protocol: ProtocolAirPlay, Actions: []string{}})
+	server := httptest.NewServer(NewWebUI(renderer, reg, WithWebUIUsers(
+		WebUIUser{Name: "Reception", Token: "view", Role: RoleViewer},
+		WebUIUser{Name: "Facilities", Token: "operate", Role: RoleOperator},
+		WebUIUser{Name: "IT", Token: "admin", Role: RoleAdmin},
+	)))
+	defer server.Close()
+
+	do := func(method, path, token, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	tests := []struct {
+		method, path, token, body string
+		status                    int
+	}{
+		{"GET", "/api/tvs", "", "", http.StatusUnauthorized},
+		{"GET", "/api/tvs", "wrong", "", http.StatusUnauthorized},
+		{"GET", "/api/tvs", "view", "", http.StatusOK},
+		{"GET", "/api/tvs/lobby/screenshot", "view", "", http.StatusNotFound},
+		{"POST", "/api/tvs/lobby/text", "view", `{"text": "Hi"}`, http.StatusForbidden},
+		{"POST", "/api/tvs/lobby/text", "operate", `{"text": "Hi"}`, http.StatusOK},
+		{"GET", "/api/tvs/lobby/screenshot", "view", "", http.StatusOK},
+		{"GET", "/api/tvs/lobby/state", "view", "", http.StatusNotImplemented},
+		{"PUT", "/api/zones/lobby", "operate", `{"members": ["Lobby"]}`, http.StatusForbidden},
+		{"PUT", "/api/zones/lobby", "admin", `{"members": ["Lobby"], "time_zone": "Europe/Paris"}`, http.StatusOK},
+		{"PUT", "/api/zones/lobby", "admin", `{"members": ["Lobby"], "time_zone": "Nowhere/Town"}`, http.StatusBadRequest},
+		{"POST", "/api/tvs/lobby/stop", "admin", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if resp := do(tt.method, tt.path, tt.token, tt.body); resp.StatusCode != tt.status {
+			msg, _ := io.ReadAll(resp.Body)
+			t.Errorf("%s %s as %q = %d %s, want %d", tt.method, tt.path, tt.token, resp.StatusCode, msg, tt.status)
+		}
+	}
+	if zones := reg.Zones(); len(zones) != 1 || zones[0].TimeZone != "Europe/Paris" {
+		t.Errorf("Zones = %+v", zones)
+	}
+
+	var me map[string]string
+	json.NewDecoder(do("GET", "/api/me", "operate", "").Body).Decode(&me)
+	if me["name"] != "Facilities" || me["role"] != "operator" {
+		t.Errorf("GET /api/me = %v", me)
+	}
+
+	// A hallway screen may look without a token
+	hallway := NewWebUI(renderer, reg, WithWebUIUsers(WebUIUser{Name: "IT", Token: "admin", Role: RoleAdmin}), WithWebUIAnonymous(RoleViewer))
+	for _, tt := range []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/api/tvs", http.StatusOK},
+		{"POST", "/api/tvs/lobby/stop", http.StatusForbidden},
+	} {
+		rec := httptest.NewRecorder()
+		hallway.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.status {
+			t.Errorf("Anonymous %s %s = %d, want %d", tt.method, tt.path, rec.Code, tt.status)
+		}
+	}
+}
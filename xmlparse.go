@@ -0,0 +1,86 @@
+package nimsforestsmarttv
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// maxXMLSize bounds device and service descriptions; real ones are a few
+// kilobytes
+const maxXMLSize = 1 << 20
+
+// xmlEncodingDecl matches the encoding declared in an XML prolog
+var xmlEncodingDecl = regexp.MustCompile(`^\s*<\?xml[^>]*\sencoding\s*=\s*["']([^"']+)["']`)
+
+// decodeXML decodes a device's XML document into v, converting the
+// charsets charsetReader knows. Strict mode accepts only what encoding/xml
+// does. Lenient mode also accepts what some TVs send although it isn't
+// well-formed: bare ampersands, HTML entities such as &nbsp;, stray
+// control characters, invalid UTF-8 and unknown charsets. Duplicate
+// attributes are accepted in either mode; the last one wins.
+func decodeXML(r io.Reader, v any, lenient bool) error {
+	data, err := readLimited(r, maxXMLSize)
+	if err != nil {
+		return err
+	}
+	if !lenient {
+		d := xml.NewDecoder(bytes.NewReader(data))
+		d.CharsetReader = charsetReader
+		return d.Decode(v)
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(sanitizeXML(data)))
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+	d.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		if r, err := charsetReader(label, input); err == nil {
+			return r, nil
+		}
+		// Unknown charsets are read as UTF-8 as far as they are valid
+		data, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(bytes.ToValidUTF8(data, []byte("\uFFFD"))), nil
+	}
+	return d.Decode(v)
+}
+
+// readLimited reads all of r, failing if it holds more than limit bytes
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("larger than %d bytes", limit)
+	}
+	return data, nil
+}
+
+// sanitizeXML drops the control characters XML forbids and, in UTF-8
+// documents, replaces invalid byte sequences
+func sanitizeXML(data []byte) []byte {
+	clean := make([]byte, 0, len(data))
+	for _, b := range data {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' {
+			continue
+		}
+		clean = append(clean, b)
+	}
+
+	if m := xmlEncodingDecl.FindSubmatch(clean); m != nil && !isUTF8Label(string(m[1])) {
+		return clean
+	}
+	return bytes.ToValidUTF8(clean, []byte("\uFFFD"))
+}
+
+// isUTF8Label reports whether a charset label denotes UTF-8
+func isUTF8Label(label string) bool {
+	label = strings.ToLower(strings.TrimSpace(label))
+	return label == "utf-8" || label == "utf8"
+}
@@ -0,0 +1,41 @@
+package nimsforestsmarttv
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLenientXML(t *testing.T) {
+	// A bare ampersand, an HTML entity, a control character, invalid UTF-8
+	// and a charset encoding/xml doesn't know
+	malformed := strings.NewReplacer(
+		`<?xml version="1.0"?>`, `<?xml version="1.0" encoding="x-vendor"?>`,
+		"TV Salon", "Tom & Jerry\x01&nbsp;TV\xff",
+	).Replace(testDescription)
+
+	if _, err := parseDeviceDescription(strings.NewReader(malformed), "http://192.168.1.20:9197/dmr", false); err == nil {
+		t.Fatal("strict parsing accepted malformed XML")
+	}
+	tv, err := parseDeviceDescription(strings.NewReader(malformed), "http://192.168.1.20:9197/dmr", true)
+	if err != nil {
+		t.Fatalf("lenient parsing failed: %v", err)
+	}
+	if tv.Name != "Tom & Jerry\u00a0TV\uFFFD" {
+		t.Errorf("Unexpected name %q", tv.Name)
+	}
+	if tv.ControlURL != "http://192.168.1.20:9197/upnp/control/AVTransport" {
+		t.Errorf("Unexpected control URL: %s", tv.ControlURL)
+	}
+}
+
+func TestDecodeXMLSizeLimit(t *testing.T) {
+	huge := strings.Replace(testDescription, "TV Salon", strings.Repeat("x", maxXMLSize), 1)
+	for _, lenient := range []bool{false, true} {
+		if _, err := parseDeviceDescription(strings.NewReader(huge), "http://192.168.1.20:9197/dmr", lenient); err == nil || !strings.Contains(err.Error(), "larger than") {
+			t.Errorf("lenient=%v: expected a size error, got %v", lenient, err)
+		}
+	}
+	if _, err := readSOAPResponse("Play", 200, strings.NewReader(strings.Repeat(" ", maxSOAPResponse+1))); err == nil {
+		t.Error("oversized SOAP response accepted")
+	}
+}